@@ -8,14 +8,21 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"regexp"
+	"strings"
 	"syscall"
 	"time"
 
+	"github.com/adfharrison1/go-db/pkg/api"
 	"github.com/adfharrison1/go-db/pkg/server"
 	"github.com/adfharrison1/go-db/pkg/storage"
 	v2 "github.com/adfharrison1/go-db/pkg/storage/v2"
 )
 
+// version is the go-db release reported by GET /version.
+// Release builds set it with -ldflags "-X main.version=v1.2.3".
+var version = "dev"
+
 func main() {
 	// Command line flags
 	var (
@@ -26,8 +33,35 @@ func main() {
 		noSaves       = flag.Bool("no-saves", false, "Disable automatic disk writes (only save on shutdown)")
 		useV2Storage  = flag.Bool("v2", false, "Use v2 storage engine with WAL")
 		durability    = flag.String("durability", "os", "V2 engine durability level: none, memory, os, full")
+		consistency   = flag.String("consistency", "read-your-writes", "V2 engine consistency level: read-your-writes, linearizable")
 		walDir        = flag.String("wal-dir", "", "WAL directory for V2 engine (default: data-dir/wal)")
 		checkpointDir = flag.String("checkpoint-dir", "", "Checkpoint directory for V2 engine (default: data-dir/checkpoints)")
+		perCollWAL    = flag.Bool("per-collection-wal", false, "V2 engine: write a separate WAL per collection")
+		storageLayout = flag.String("storage-layout", "per-collection", "V1 on-disk layout: per-collection, single-file")
+		deltaLog      = flag.Bool("delta-log", false, "V1 per-collection layout: persist updates as appended deltas instead of rewriting collection files")
+		tombstones    = flag.Bool("tombstone-deletes", false, "V1 per-collection layout: persist deletes as tombstones in the delta log, purged when it is compacted")
+		compactEvery  = flag.Duration("compact-interval", 0, "V1 per-collection layout: check for bloated collection files this often, e.g. 10m (0 = disabled)")
+		compactRatio  = flag.Float64("compact-ratio", storage.DefaultCompactionRatio, "V1 engine: compact a collection once its files exceed this multiple of its live data")
+		autoStamps    = flag.Bool("auto-timestamps", false, "V1 engine: maintain _created_at and _updated_at on every document")
+		docVersions   = flag.Bool("document-versions", false, "V1 engine: maintain _version on every document for If-Match updates")
+		namePattern   = flag.String("collection-name-pattern", "", "Regex of allowed collection names (default: "+storage.DefaultCollectionNamePattern+")")
+		maxColls      = flag.Int("max-collections", 0, "Maximum number of collections (0 = unlimited)")
+		maxResults    = flag.Int("max-result-size", 0, "Maximum documents a find may match before pagination (0 = unlimited)")
+		snapshotReads = flag.Bool("snapshot-reads", false, "Serve streams and aggregations from a snapshot taken when they start")
+		maxWrites     = flag.Int("max-concurrent-writes", 0, "Maximum concurrent writes per collection; others queue (0 = unlimited)")
+		saveWorkers   = flag.Int("save-concurrency", storage.DefaultSaveConcurrency, "V1 engine: maximum collection files written at once by background saves")
+		coalesceWrite = flag.Duration("write-coalesce-window", 0, "V1 per-collection layout: write document saves to one collection within this window together, e.g. 5ms (0 = write each at once)")
+		queryTimeout  = flag.Duration("query-timeout", 0, "Maximum duration for find/stream queries, e.g. 5s (0 = unlimited)")
+		cursorSecret  = flag.String("cursor-secret", "", "Secret for signing pagination cursors (default: unsigned)")
+		cursorMaxAge  = flag.Duration("cursor-max-age", 0, "Reject signed cursors older than this, e.g. 1h (0 = never expire)")
+		envelope      = flag.Bool("envelope", true, "Wrap find and query results in a pagination object (false: bare arrays with metadata headers)")
+		adminToken    = flag.String("admin-token", "", "Bearer token required by the /admin endpoints (default: admin endpoints disabled)")
+		jobRetention  = flag.Duration("job-retention", api.DefaultJobRetention, "How long GET /admin/jobs lists finished background jobs")
+		preload       = flag.String("preload", "", "Comma-separated collections to load and index at startup; /ready reports 503 until done")
+		preloadFile   = flag.String("preload-manifest", "", "File listing collections to preload, one per line (# comments allowed)")
+		pin           = flag.String("pin", "", "Comma-separated collections never evicted from the V1 cache")
+		changeLogSize = flag.Int("change-log-size", storage.DefaultChangeLogSize, "Recent changes retained per collection for the change feed (0 = disabled)")
+		insertOrder   = flag.Bool("insertion-order", false, "Track document insertion order per collection for find ?order=inserted")
 		showHelp      = flag.Bool("help", false, "Show help message")
 	)
 
@@ -46,6 +80,7 @@ func main() {
 		fmt.Fprintf(os.Stderr, "\nPersistence Options:\n")
 		fmt.Fprintf(os.Stderr, "  Dual-write mode: Data saved to memory and disk immediately (default)\n")
 		fmt.Fprintf(os.Stderr, "  No-saves mode: Data only saved on graceful shutdown (maximum performance)\n")
+		fmt.Fprintf(os.Stderr, "  Storage layout: per-collection files (default) or a single data file (-storage-layout single-file)\n")
 	}
 
 	flag.Parse()
@@ -57,6 +92,30 @@ func main() {
 
 	var srv *server.Server
 
+	// Compile collection name policy
+	var collectionNamePattern *regexp.Regexp
+	if *namePattern != "" {
+		pattern, err := regexp.Compile(*namePattern)
+		if err != nil {
+			log.Fatalf("Invalid collection name pattern %q: %v", *namePattern, err)
+		}
+		collectionNamePattern = pattern
+		log.Printf("INFO: Collection names must match: %s", *namePattern)
+	}
+
+	// Collect the collections to preload
+	var preloadCollections []string
+	if *preload != "" {
+		preloadCollections = strings.Split(*preload, ",")
+	}
+	if *preloadFile != "" {
+		names, err := storage.ReadPreloadManifest(*preloadFile)
+		if err != nil {
+			log.Fatalf("Invalid preload manifest: %v", err)
+		}
+		preloadCollections = append(preloadCollections, names...)
+	}
+
 	if *useV2Storage {
 		// Build v2 storage options
 		var v2Options []v2.StorageOption
@@ -109,6 +168,67 @@ func main() {
 		v2Options = append(v2Options, v2.WithDurabilityLevel(durabilityLevel))
 		log.Printf("INFO: Using durability level: %s", *durability)
 
+		// Set consistency level
+		var consistencyLevel v2.ConsistencyLevel
+		switch *consistency {
+		case "read-your-writes":
+			consistencyLevel = v2.ConsistencyReadYourWrites
+		case "linearizable":
+			consistencyLevel = v2.ConsistencyLinearizable
+		default:
+			log.Fatalf("Invalid consistency level: %s. Must be one of: read-your-writes, linearizable", *consistency)
+		}
+		v2Options = append(v2Options, v2.WithConsistencyLevel(consistencyLevel))
+		log.Printf("INFO: Using consistency level: %s", *consistency)
+
+		if *perCollWAL {
+			v2Options = append(v2Options, v2.WithPerCollectionWAL(true))
+			log.Printf("INFO: Per-collection WAL enabled")
+		}
+
+		if collectionNamePattern != nil {
+			v2Options = append(v2Options, v2.WithCollectionNamePattern(collectionNamePattern))
+		}
+
+		if *maxColls > 0 {
+			v2Options = append(v2Options, v2.WithMaxCollections(*maxColls))
+			log.Printf("INFO: Max collections set to: %d", *maxColls)
+		}
+
+		if *maxResults > 0 {
+			v2Options = append(v2Options, v2.WithMaxResultSize(*maxResults))
+			log.Printf("INFO: Max result size set to: %d", *maxResults)
+		}
+
+		if *snapshotReads {
+			v2Options = append(v2Options, v2.WithSnapshotRead(true))
+			log.Printf("INFO: Snapshot reads enabled for streams")
+		}
+
+		if *maxWrites > 0 {
+			v2Options = append(v2Options, v2.WithMaxConcurrentWrites(*maxWrites))
+			log.Printf("INFO: Max concurrent writes per collection set to: %d", *maxWrites)
+		}
+
+		if len(preloadCollections) > 0 {
+			v2Options = append(v2Options, v2.WithPreloadCollections(preloadCollections))
+			log.Printf("INFO: Preloading collections: %s", strings.Join(preloadCollections, ", "))
+		}
+
+		if *pin != "" {
+			v2Options = append(v2Options, v2.WithPinnedCollections(strings.Split(*pin, ",")))
+		}
+
+		if *changeLogSize != storage.DefaultChangeLogSize {
+			v2Options = append(v2Options, v2.WithChangeLogSize(*changeLogSize))
+			log.Printf("INFO: Change log size per collection set to: %d", *changeLogSize)
+		}
+
+		if *insertOrder {
+			v2Options = append(v2Options, v2.WithInsertionOrder(true))
+			log.Printf("INFO: Insertion order tracking enabled")
+		}
+
 		log.Printf("INFO: Using v2 storage engine with WAL")
 		srv = server.NewServerV2(v2Options...)
 	} else {
@@ -135,15 +255,132 @@ func main() {
 			log.Printf("INFO: Dual-write mode enabled - data saved to memory and disk immediately")
 		}
 
+		// Set on-disk layout
+		layout, err := storage.ParseStorageLayout(*storageLayout)
+		if err != nil {
+			log.Fatalf("Invalid storage layout: %v", err)
+		}
+		storageOptions = append(storageOptions, storage.WithStorageLayout(layout))
+		log.Printf("INFO: Using %s storage layout", layout)
+
+		if *deltaLog {
+			storageOptions = append(storageOptions, storage.WithDeltaLog(true))
+			log.Printf("INFO: Delta log enabled - updates are appended and compacted every %v", storage.DefaultDeltaCompactionInterval)
+		}
+
+		if *tombstones {
+			storageOptions = append(storageOptions, storage.WithTombstoneDeletes(true))
+			log.Printf("INFO: Tombstone deletes enabled - deleted documents are purged from collection files every %v", storage.DefaultDeltaCompactionInterval)
+		}
+
+		if *compactEvery > 0 {
+			storageOptions = append(storageOptions, storage.WithCompaction(*compactEvery, *compactRatio))
+			log.Printf("INFO: Compaction enabled - collections over %.1fx their live data are rewritten, checked every %v", *compactRatio, *compactEvery)
+		}
+
+		if *autoStamps {
+			storageOptions = append(storageOptions, storage.WithAutoTimestamps(true))
+			log.Printf("INFO: Auto timestamps enabled - documents carry _created_at and _updated_at")
+		}
+
+		if *docVersions {
+			storageOptions = append(storageOptions, storage.WithDocumentVersions(true))
+			log.Printf("INFO: Document versions enabled - documents carry _version")
+		}
+
+		if collectionNamePattern != nil {
+			storageOptions = append(storageOptions, storage.WithCollectionNamePattern(collectionNamePattern))
+		}
+
+		if *maxColls > 0 {
+			storageOptions = append(storageOptions, storage.WithMaxCollections(*maxColls))
+			log.Printf("INFO: Max collections set to: %d", *maxColls)
+		}
+
+		if *maxResults > 0 {
+			storageOptions = append(storageOptions, storage.WithMaxResultSize(*maxResults))
+			log.Printf("INFO: Max result size set to: %d", *maxResults)
+		}
+
+		if *snapshotReads {
+			storageOptions = append(storageOptions, storage.WithSnapshotRead(true))
+			log.Printf("INFO: Snapshot reads enabled for streams")
+		}
+
+		if *maxWrites > 0 {
+			storageOptions = append(storageOptions, storage.WithMaxConcurrentWrites(*maxWrites))
+			log.Printf("INFO: Max concurrent writes per collection set to: %d", *maxWrites)
+		}
+
+		if *saveWorkers != storage.DefaultSaveConcurrency {
+			storageOptions = append(storageOptions, storage.WithSaveConcurrency(*saveWorkers))
+			log.Printf("INFO: Background save concurrency set to: %d", *saveWorkers)
+		}
+
+		if *coalesceWrite > 0 {
+			storageOptions = append(storageOptions, storage.WithWriteCoalescing(*coalesceWrite))
+			log.Printf("INFO: Document saves coalesced per collection over %v", *coalesceWrite)
+		}
+
+		if len(preloadCollections) > 0 {
+			storageOptions = append(storageOptions, storage.WithPreloadCollections(preloadCollections))
+			log.Printf("INFO: Preloading collections: %s", strings.Join(preloadCollections, ", "))
+		}
+
+		if *pin != "" {
+			storageOptions = append(storageOptions, storage.WithPinnedCollections(strings.Split(*pin, ",")))
+			log.Printf("INFO: Pinned collections: %s", *pin)
+		}
+
+		if *changeLogSize != storage.DefaultChangeLogSize {
+			storageOptions = append(storageOptions, storage.WithChangeLogSize(*changeLogSize))
+			log.Printf("INFO: Change log size per collection set to: %d", *changeLogSize)
+		}
+
+		if *insertOrder {
+			storageOptions = append(storageOptions, storage.WithInsertionOrder(true))
+			log.Printf("INFO: Insertion order tracking enabled")
+		}
+
 		log.Printf("INFO: Using v1 storage engine")
 		srv = server.NewServer(storageOptions...)
 	}
 	defer srv.StopBackgroundWorkers() // Ensure cleanup
 
+	srv.ApplyHandlerOptions(api.WithVersion(version))
+
+	// Configure query timeout
+	if *queryTimeout > 0 {
+		srv.ApplyHandlerOptions(api.WithQueryTimeout(*queryTimeout))
+		log.Printf("INFO: Query timeout set to: %s", *queryTimeout)
+	}
+
+	// Configure cursor signing
+	if *cursorSecret != "" {
+		srv.ApplyHandlerOptions(api.WithCursorSecret([]byte(*cursorSecret), *cursorMaxAge))
+		log.Printf("INFO: Pagination cursors are signed (max age: %s)", *cursorMaxAge)
+	}
+
+	// Configure response shape
+	if !*envelope {
+		srv.ApplyHandlerOptions(api.WithEnvelope(false))
+		log.Printf("INFO: Find and query return bare arrays unless ?envelope=true is passed")
+	}
+
+	// Configure admin endpoints
+	if *adminToken != "" {
+		srv.ApplyHandlerOptions(api.WithAdminToken(*adminToken))
+		log.Printf("INFO: Admin endpoints enabled")
+	}
+	srv.ApplyHandlerOptions(api.WithJobRetention(*jobRetention))
+
 	// Initialize database from file
 	log.Printf("INFO: Loading data from: %s", *dataFile)
 	srv.InitDB(*dataFile)
 
+	// Preload hot collections while serving; /ready reports 503 until done
+	go srv.PreloadCollections()
+
 	// Create HTTP server
 	httpServer := &http.Server{
 		Addr:    ":" + *port,
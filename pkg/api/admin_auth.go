@@ -0,0 +1,35 @@
+package api
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+)
+
+// WithAdminToken enables the /admin endpoints, which then require an
+// "Authorization: Bearer <token>" header. Without a token they are disabled.
+func WithAdminToken(token string) HandlerOption {
+	return func(h *Handler) {
+		h.adminToken = token
+	}
+}
+
+// AdminAuthMiddleware guards the /admin endpoints: requests are rejected with 403
+// while no admin token is configured and with 401 unless they carry the token.
+func (h *Handler) AdminAuthMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if h.adminToken == "" {
+			writeError(w, http.StatusForbidden, ErrCodeForbidden, "Admin endpoints are disabled; start the server with -admin-token")
+			return
+		}
+
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(h.adminToken)) != 1 {
+			logf(r, "WARN: Rejected unauthenticated admin request %s %s", r.Method, r.URL.Path)
+			w.Header().Set("WWW-Authenticate", `Bearer realm="go-db admin"`)
+			writeError(w, http.StatusUnauthorized, ErrCodeUnauthorized, "Missing or invalid admin token")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,34 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// HandleCheckpoint handles POST requests to save every dirty collection to disk now.
+// In no-saves mode this gives a durable checkpoint without changing modes: writes
+// after it are still kept in memory only until the next checkpoint or shutdown.
+func (h *Handler) HandleCheckpoint(w http.ResponseWriter, r *http.Request) {
+	logf(r, "INFO: handleCheckpoint called")
+
+	start := time.Now()
+	if err := h.storage.CheckpointNow(); err != nil {
+		logf(r, "ERROR: Checkpoint failed: %v", err)
+		writeStorageError(w, err, http.StatusInternalServerError)
+		return
+	}
+	elapsed := time.Since(start)
+
+	response := map[string]interface{}{
+		"success":     true,
+		"message":     "Checkpoint completed",
+		"no_saves":    h.storage.IsNoSavesEnabled(),
+		"duration_ms": elapsed.Milliseconds(),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+
+	logf(r, "INFO: Checkpoint completed in %s", elapsed)
+}
@@ -0,0 +1,20 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// HandleGetLocks handles GET requests for how many goroutines hold and wait for each
+// collection's collection-wide and document locks, for diagnosing hung operations
+func (h *Handler) HandleGetLocks(w http.ResponseWriter, r *http.Request) {
+	logf(r, "INFO: handleGetLocks called")
+
+	response := map[string]interface{}{
+		"success":     true,
+		"collections": h.storage.LockStats(),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
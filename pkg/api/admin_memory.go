@@ -0,0 +1,123 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"runtime"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// MemoryLimitRequest represents the request body for changing the memory limit
+type MemoryLimitRequest struct {
+	MaxMemoryMB int `json:"max_memory_mb"`
+}
+
+// HandleGetMemory handles GET requests for the engine's memory statistics together
+// with per-collection memory estimates and cache residency
+func (h *Handler) HandleGetMemory(w http.ResponseWriter, r *http.Request) {
+	logf(r, "INFO: handleGetMemory called")
+
+	response := map[string]interface{}{
+		"success":     true,
+		"stats":       h.storage.GetMemoryStats(),
+		"collections": h.storage.CollectionMemoryUsage(),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// HandleMemoryGC handles POST requests to run a garbage collection and report how
+// much heap it released
+func (h *Handler) HandleMemoryGC(w http.ResponseWriter, r *http.Request) {
+	logf(r, "INFO: handleMemoryGC called")
+
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	start := time.Now()
+	runtime.GC()
+	elapsed := time.Since(start)
+	runtime.ReadMemStats(&after)
+
+	var freed uint64
+	if before.HeapAlloc > after.HeapAlloc {
+		freed = before.HeapAlloc - after.HeapAlloc
+	}
+
+	response := map[string]interface{}{
+		"success":           true,
+		"heap_before_bytes": before.HeapAlloc,
+		"heap_after_bytes":  after.HeapAlloc,
+		"freed_bytes":       freed,
+		"duration_ms":       elapsed.Milliseconds(),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+
+	logf(r, "INFO: Garbage collection freed %d bytes in %s", freed, elapsed)
+}
+
+// HandleSetMemoryLimit handles POST requests to change the engine's memory limit,
+// which sizes its cache, without a restart
+func (h *Handler) HandleSetMemoryLimit(w http.ResponseWriter, r *http.Request) {
+	logf(r, "INFO: handleSetMemoryLimit called")
+
+	var req MemoryLimitRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		logf(r, "ERROR: Decoding body failed: %v", err)
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "Invalid request body")
+		return
+	}
+
+	if err := h.storage.SetMaxMemory(req.MaxMemoryMB); err != nil {
+		writeStorageError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	response := map[string]interface{}{
+		"success":       true,
+		"message":       "Memory limit updated",
+		"max_memory_mb": req.MaxMemoryMB,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+
+	logf(r, "INFO: Set memory limit to %d MB", req.MaxMemoryMB)
+}
+
+// HandlePinCollection handles POST requests to pin a collection in the cache, so it is
+// never evicted however other collections are accessed
+func (h *Handler) HandlePinCollection(w http.ResponseWriter, r *http.Request) {
+	h.setCollectionPinned(w, r, true)
+}
+
+// HandleUnpinCollection handles DELETE requests to let a pinned collection be evicted
+func (h *Handler) HandleUnpinCollection(w http.ResponseWriter, r *http.Request) {
+	h.setCollectionPinned(w, r, false)
+}
+
+// setCollectionPinned pins or unpins the request's collection
+func (h *Handler) setCollectionPinned(w http.ResponseWriter, r *http.Request, pinned bool) {
+	collName := mux.Vars(r)["coll"]
+
+	logf(r, "INFO: setCollectionPinned called for collection '%s' (pinned: %v)", collName, pinned)
+
+	if pinned {
+		h.storage.PinCollection(collName)
+	} else {
+		h.storage.UnpinCollection(collName)
+	}
+
+	response := map[string]interface{}{
+		"success":    true,
+		"collection": collName,
+		"pinned":     h.storage.IsCollectionPinned(collName),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,94 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/adfharrison1/go-db/pkg/domain"
+	"github.com/adfharrison1/go-db/pkg/storage"
+	"github.com/gorilla/mux"
+)
+
+// AggregateRequest represents the request body for an aggregation
+type AggregateRequest struct {
+	Filter map[string]interface{} `json:"filter,omitempty"`
+	storage.AggregateSpec
+}
+
+// AggregateResponse represents the response for an aggregation
+type AggregateResponse struct {
+	Success    bool                     `json:"success"`
+	Collection string                   `json:"collection"`
+	Groups     []storage.AggregateGroup `json:"groups"`
+	Truncated  bool                     `json:"truncated"`
+	OtherCount int64                    `json:"other_count"`
+}
+
+// HandleAggregate handles POST requests to group matching documents by a field and
+// compute counts and numeric metrics per group. Documents are consumed from the
+// collection stream one at a time, so only the per-group totals are held in memory.
+func (h *Handler) HandleAggregate(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	collName := vars["coll"]
+
+	logf(r, "INFO: handleAggregate called for collection '%s'", collName)
+
+	var req AggregateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		logf(r, "ERROR: Decoding body failed: %v", err)
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "Invalid request body")
+		return
+	}
+
+	if err := storage.ValidateAggregateSpec(req.AggregateSpec); err != nil {
+		writeStorageError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel, err := h.queryContext(r)
+	if err != nil {
+		writeStorageError(w, err, http.StatusBadRequest)
+		return
+	}
+	defer cancel()
+
+	docChan, err := h.storage.FindAllStreamContext(ctx, collName, req.Filter)
+	if err != nil {
+		if errors.Is(err, domain.ErrInvalidFilter) {
+			logf(r, "ERROR: Invalid filter for collection '%s': %v", collName, err)
+			writeStorageError(w, err, http.StatusBadRequest)
+			return
+		}
+		logf(r, "ERROR: Collection '%s' not found: %v", collName, err)
+		writeStorageError(w, err, http.StatusNotFound)
+		return
+	}
+
+	result, err := storage.AggregateStream(ctx, docChan, req.AggregateSpec)
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			logf(r, "WARN: Aggregation on collection '%s' timed out: %v", collName, err)
+			writeError(w, http.StatusGatewayTimeout, ErrCodeTimeout, "Query timed out")
+			return
+		}
+		logf(r, "ERROR: Aggregation on collection '%s' failed: %v", collName, err)
+		writeStorageError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	if result.Truncated {
+		logf(r, "WARN: Aggregation on collection '%s' truncated at %d groups (%d documents in other groups)", collName, len(result.Groups), result.OtherCount)
+	}
+	logf(r, "INFO: Aggregated %d groups in collection '%s'", len(result.Groups), collName)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(AggregateResponse{
+		Success:    true,
+		Collection: collName,
+		Groups:     result.Groups,
+		Truncated:  result.Truncated,
+		OtherCount: result.OtherCount,
+	})
+}
@@ -0,0 +1,70 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/adfharrison1/go-db/pkg/storage"
+	"github.com/gorilla/mux"
+)
+
+// HandleGetArraySlice handles GET requests for a window of a document's array field,
+// so a long array can be paged through without fetching the whole document. It
+// returns up to ?limit= elements (default 50) starting at ?offset= (default 0). The
+// field may be a dotted path into nested objects.
+func (h *Handler) HandleGetArraySlice(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	collName := vars["coll"]
+	docId := vars["id"]
+	field := vars["field"]
+
+	logf(r, "INFO: handleGetArraySlice called for collection '%s', document '%s', field '%s'", collName, docId, field)
+
+	queryParams := r.URL.Query()
+
+	offset := 0
+	if offsetStr := queryParams.Get("offset"); offsetStr != "" {
+		parsed, err := strconv.Atoi(offsetStr)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, ErrCodeValidationFailed, "offset must be an integer")
+			return
+		}
+		offset = parsed
+	}
+
+	limit := storage.DefaultArraySliceLimit
+	if limitStr := queryParams.Get("limit"); limitStr != "" {
+		parsed, err := strconv.Atoi(limitStr)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, ErrCodeValidationFailed, "limit must be an integer")
+			return
+		}
+		limit = parsed
+	}
+	if err := storage.ValidateArraySlice(offset, limit); err != nil {
+		writeStorageError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	// Documents hidden by the collection default filter are reported as not found
+	if !includeDeleted(r) {
+		if defaultFilter := h.storage.GetCollectionDefaultFilter(collName); defaultFilter != nil && !h.storage.DocumentExists(collName, docId, defaultFilter) {
+			logf(r, "INFO: Document '%s' in collection '%s' excluded by default filter", docId, collName)
+			writeError(w, http.StatusNotFound, ErrCodeDocumentNotFound, fmt.Sprintf("document with id %s not found in collection %s", docId, collName))
+			return
+		}
+	}
+
+	slice, err := h.storage.GetArraySlice(collName, docId, field, offset, limit)
+	if err != nil {
+		logf(r, "ERROR: Failed to slice field '%s' of document '%s' in collection '%s': %v", field, docId, collName, err)
+		writeStorageError(w, err, http.StatusNotFound)
+		return
+	}
+
+	logf(r, "INFO: Returned %d of %d elements of field '%s' of document '%s'", len(slice.Items), slice.Total, field, docId)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(slice)
+}
@@ -2,16 +2,19 @@ package api
 
 import (
 	"encoding/json"
-	"log"
+	"errors"
+	"fmt"
 	"net/http"
 
 	"github.com/adfharrison1/go-db/pkg/domain"
 	"github.com/gorilla/mux"
 )
 
-// BatchInsertRequest represents the request body for batch insert operations
+// BatchInsertRequest represents the request body for batch insert operations.
+// Indexes names fields to index before the documents are inserted; see ensureIndexes.
 type BatchInsertRequest struct {
 	Documents []map[string]interface{} `json:"documents"`
+	Indexes   []string                 `json:"indexes,omitempty"`
 }
 
 // BatchInsertResponse represents the response for batch insert operations
@@ -20,6 +23,7 @@ type BatchInsertResponse struct {
 	Message       string            `json:"message"`
 	InsertedCount int               `json:"inserted_count"`
 	Collection    string            `json:"collection"`
+	IDs           []string          `json:"ids"` // IDs of Documents, in request order
 	Documents     []domain.Document `json:"documents"`
 }
 
@@ -28,25 +32,31 @@ func (h *Handler) HandleBatchInsert(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	collName := vars["coll"]
 
-	log.Printf("INFO: handleBatchInsert called for collection '%s'", collName)
+	logf(r, "INFO: handleBatchInsert called for collection '%s'", collName)
 
 	var req BatchInsertRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		log.Printf("ERROR: Decoding body failed: %v", err)
-		WriteJSONError(w, http.StatusBadRequest, "Invalid request body")
+		logf(r, "ERROR: Decoding body failed: %v", err)
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "Invalid request body")
 		return
 	}
 
 	// Validate request
 	if len(req.Documents) == 0 {
-		log.Printf("ERROR: No documents provided for batch insert")
-		WriteJSONError(w, http.StatusBadRequest, "No documents provided")
+		logf(r, "ERROR: No documents provided for batch insert")
+		writeError(w, http.StatusBadRequest, ErrCodeValidationFailed, "No documents provided")
 		return
 	}
 
 	if len(req.Documents) > 1000 {
-		log.Printf("ERROR: Too many documents for batch insert: %d", len(req.Documents))
-		WriteJSONError(w, http.StatusBadRequest, "Maximum 1000 documents allowed per batch")
+		logf(r, "ERROR: Too many documents for batch insert: %d", len(req.Documents))
+		writeError(w, http.StatusBadRequest, ErrCodeValidationFailed, "Maximum 1000 documents allowed per batch")
+		return
+	}
+
+	if err := h.ensureIndexes(collName, req.Indexes); err != nil {
+		logf(r, "ERROR: Creating indexes for batch insert into '%s' failed: %v", collName, err)
+		writeStorageError(w, err, http.StatusBadRequest)
 		return
 	}
 
@@ -61,25 +71,31 @@ func (h *Handler) HandleBatchInsert(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Perform batch insert
-	createdDocs, err := h.storage.BatchInsert(collName, docs)
+	createdDocs, err := h.storage.BatchInsertContext(r.Context(), collName, docs)
 	if err != nil {
-		log.Printf("ERROR: Batch insert failed for collection '%s': %v", collName, err)
-		WriteJSONError(w, http.StatusInternalServerError, err.Error())
+		logf(r, "ERROR: Batch insert failed for collection '%s': %v", collName, err)
+		writeStorageError(w, err, http.StatusInternalServerError)
 		return
 	}
 
 	// Save collection to disk if transaction saves are enabled
 	if err := h.storage.SaveCollectionAfterTransaction(collName); err != nil {
-		log.Printf("WARN: Failed to save collection '%s' after batch insert: %v", collName, err)
+		logf(r, "WARN: Failed to save collection '%s' after batch insert: %v", collName, err)
 		// Don't fail the request if save fails, just log the warning
 	}
 
+	ids := make([]string, len(createdDocs))
+	for i, doc := range createdDocs {
+		ids[i], _ = doc["_id"].(string)
+	}
+
 	// Return success response with created documents
 	response := BatchInsertResponse{
 		Success:       true,
 		Message:       "Batch insert completed successfully",
 		InsertedCount: len(createdDocs),
 		Collection:    collName,
+		IDs:           ids,
 		Documents:     createdDocs,
 	}
 
@@ -87,5 +103,48 @@ func (h *Handler) HandleBatchInsert(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(response)
 
-	log.Printf("INFO: Batch insert successful for collection '%s', inserted %d documents", collName, len(docs))
+	logf(r, "INFO: Batch insert successful for collection '%s', inserted %d documents", collName, len(docs))
+}
+
+// ensureIndexes creates the indexes on fields that a collection does not have yet.
+// A missing collection is created with them, so they start empty and are filled in
+// as documents are inserted instead of by a scan over the loaded collection.
+func (h *Handler) ensureIndexes(collName string, fields []string) error {
+	if len(fields) == 0 {
+		return nil
+	}
+	var unique []string
+	for _, field := range fields {
+		if field == "" {
+			return domain.Errorf(domain.ErrInvalidField, "index field name is required")
+		}
+		if !containsString(unique, field) {
+			unique = append(unique, field)
+		}
+	}
+
+	opts := domain.CollectionOptions{}
+	for _, field := range unique {
+		if field != "_id" {
+			opts.Indexes = append(opts.Indexes, domain.CollectionIndex{Field: field})
+		}
+	}
+	err := h.storage.CreateCollectionWithOptions(collName, opts)
+	if !errors.Is(err, domain.ErrCollectionExists) {
+		return err
+	}
+
+	existing, err := h.storage.GetIndexes(collName)
+	if err != nil {
+		return err
+	}
+	for _, field := range unique {
+		if field == "_id" || containsString(existing, field) {
+			continue
+		}
+		if err := h.storage.CreateIndex(collName, field); err != nil {
+			return fmt.Errorf("failed to create index on %s: %w", field, err)
+		}
+	}
+	return nil
 }
@@ -2,7 +2,6 @@ package api
 
 import (
 	"encoding/json"
-	"log"
 	"net/http"
 
 	"github.com/adfharrison1/go-db/pkg/domain"
@@ -36,25 +35,25 @@ func (h *Handler) HandleBatchUpdate(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	collName := vars["coll"]
 
-	log.Printf("INFO: handleBatchUpdate called for collection '%s'", collName)
+	logf(r, "INFO: handleBatchUpdate called for collection '%s'", collName)
 
 	var req BatchUpdateRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		log.Printf("ERROR: Decoding body failed: %v", err)
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		logf(r, "ERROR: Decoding body failed: %v", err)
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "Invalid request body")
 		return
 	}
 
 	// Validate request
 	if len(req.Operations) == 0 {
-		log.Printf("ERROR: No operations provided for batch update")
-		http.Error(w, "No operations provided", http.StatusBadRequest)
+		logf(r, "ERROR: No operations provided for batch update")
+		writeError(w, http.StatusBadRequest, ErrCodeValidationFailed, "No operations provided")
 		return
 	}
 
 	if len(req.Operations) > 1000 {
-		log.Printf("ERROR: Too many operations for batch update: %d", len(req.Operations))
-		http.Error(w, "Maximum 1000 operations allowed per batch", http.StatusBadRequest)
+		logf(r, "ERROR: Too many operations for batch update: %d", len(req.Operations))
+		writeError(w, http.StatusBadRequest, ErrCodeValidationFailed, "Maximum 1000 operations allowed per batch")
 		return
 	}
 
@@ -80,8 +79,10 @@ func (h *Handler) HandleBatchUpdate(w http.ResponseWriter, r *http.Request) {
 
 	if err != nil {
 		// Atomic failure - all operations failed
-		log.Printf("ERROR: Batch update failed for collection '%s': %v", collName, err)
-		WriteJSONError(w, http.StatusInternalServerError, err.Error())
+		logf(r, "ERROR: Batch update failed for collection '%s': %v", collName, err)
+		// The status stays 500 for any failed batch; the code names the cause
+		_, code := storageErrorStatus(err, http.StatusInternalServerError)
+		writeError(w, http.StatusInternalServerError, code, err.Error())
 		return
 	} else {
 		// Complete success
@@ -94,7 +95,7 @@ func (h *Handler) HandleBatchUpdate(w http.ResponseWriter, r *http.Request) {
 
 	// Save collection to disk if transaction saves are enabled
 	if err := h.storage.SaveCollectionAfterTransaction(collName); err != nil {
-		log.Printf("WARN: Failed to save collection '%s' after batch update: %v", collName, err)
+		logf(r, "WARN: Failed to save collection '%s' after batch update: %v", collName, err)
 		// Don't fail the request if save fails, just log the warning
 	}
 
@@ -107,6 +108,6 @@ func (h *Handler) HandleBatchUpdate(w http.ResponseWriter, r *http.Request) {
 	}
 	json.NewEncoder(w).Encode(response)
 
-	log.Printf("INFO: Batch update completed for collection '%s', updated %d, failed %d",
+	logf(r, "INFO: Batch update completed for collection '%s', updated %d, failed %d",
 		collName, response.UpdatedCount, response.FailedCount)
 }
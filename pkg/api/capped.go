@@ -0,0 +1,134 @@
+package api
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"github.com/adfharrison1/go-db/pkg/domain"
+	"github.com/adfharrison1/go-db/pkg/storage"
+	"github.com/gorilla/mux"
+)
+
+// CreateCollectionRequest represents the optional configuration body for creating a collection
+type CreateCollectionRequest struct {
+	Capped *domain.CappedConfig `json:"capped,omitempty"`
+}
+
+// HandleCreateCollection handles PUT requests to create an empty collection. The
+// optional body configures it, e.g. {"capped": {"max_docs": 1000, "policy": "fifo"}}.
+func (h *Handler) HandleCreateCollection(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	collName := vars["coll"]
+
+	logf(r, "INFO: handleCreateCollection called for collection '%s'", collName)
+
+	var req CreateCollectionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		logf(r, "ERROR: Decoding body failed: %v", err)
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "Invalid request body")
+		return
+	}
+
+	if req.Capped != nil {
+		if err := storage.ValidateCappedConfig(req.Capped.MaxDocs, req.Capped.Policy); err != nil {
+			writeStorageError(w, err, http.StatusBadRequest)
+			return
+		}
+	}
+
+	if err := h.storage.CreateCollection(collName); err != nil {
+		logf(r, "ERROR: Creating collection '%s' failed: %v", collName, err)
+		writeStorageError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	if req.Capped != nil {
+		if err := h.storage.SetCollectionCapped(collName, req.Capped.MaxDocs, req.Capped.Policy); err != nil {
+			writeStorageError(w, err, http.StatusBadRequest)
+			return
+		}
+	}
+
+	logf(r, "INFO: Created collection '%s'", collName)
+
+	response := map[string]interface{}{
+		"success":    true,
+		"message":    "Collection created",
+		"collection": collName,
+	}
+	if capped := h.storage.GetCollectionCapped(collName); capped != nil {
+		response["capped"] = capped
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(response)
+}
+
+// HandleGetCapped handles GET requests to retrieve a collection's cap
+func (h *Handler) HandleGetCapped(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	collName := vars["coll"]
+
+	logf(r, "INFO: handleGetCapped called for collection '%s'", collName)
+
+	h.writeCappedResponse(w, collName, "")
+}
+
+// HandleSetCapped handles PUT requests to cap an existing collection. Documents
+// already over the cap are evicted immediately.
+func (h *Handler) HandleSetCapped(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	collName := vars["coll"]
+
+	logf(r, "INFO: handleSetCapped called for collection '%s'", collName)
+
+	var req domain.CappedConfig
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		logf(r, "ERROR: Decoding body failed: %v", err)
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "Invalid request body")
+		return
+	}
+
+	if err := h.storage.SetCollectionCapped(collName, req.MaxDocs, req.Policy); err != nil {
+		writeStorageError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	h.writeCappedResponse(w, collName, "Cap updated")
+
+	logf(r, "INFO: Set cap for collection '%s': %d documents (%s)", collName, req.MaxDocs, req.Policy)
+}
+
+// HandleDeleteCapped handles DELETE requests to remove a collection's cap
+func (h *Handler) HandleDeleteCapped(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	collName := vars["coll"]
+
+	logf(r, "INFO: handleDeleteCapped called for collection '%s'", collName)
+
+	h.storage.SetCollectionCapped(collName, 0, "")
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// writeCappedResponse writes a collection's cap, reporting "capped": false when it has none
+func (h *Handler) writeCappedResponse(w http.ResponseWriter, collName, message string) {
+	response := map[string]interface{}{
+		"success":    true,
+		"collection": collName,
+		"capped":     false,
+	}
+	if message != "" {
+		response["message"] = message
+	}
+	if capped := h.storage.GetCollectionCapped(collName); capped != nil {
+		response["capped"] = true
+		response["max_docs"] = capped.MaxDocs
+		response["policy"] = capped.Policy
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
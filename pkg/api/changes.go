@@ -0,0 +1,97 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/adfharrison1/go-db/pkg/domain"
+	"github.com/gorilla/mux"
+)
+
+const (
+	// DefaultChangesLimit is how many changes a change feed request returns by default
+	DefaultChangesLimit = 100
+
+	// MaxChangesLimit bounds the ?limit= of a change feed request
+	MaxChangesLimit = 1000
+
+	// MaxChangesWait bounds how long a change feed request may long-poll with ?wait=
+	MaxChangesWait = 60 * time.Second
+)
+
+// ChangesResponse is the response body of a change feed request
+type ChangesResponse struct {
+	Success    bool            `json:"success"`
+	Collection string          `json:"collection"`
+	Changes    []domain.Change `json:"changes"`
+	Count      int             `json:"count"`
+	NextOffset int64           `json:"next_offset"`
+	HasMore    bool            `json:"has_more"`
+	Truncated  bool            `json:"truncated"`
+}
+
+// HandleGetChanges handles GET requests for the changes to a collection after
+// ?since= (default 0, the oldest retained change), up to ?limit= of them. With
+// ?wait= (a duration such as 30s) the request long-polls until a change arrives or
+// the wait elapses. Clients poll again from next_offset; truncated means changes
+// they have not seen were dropped from the log and they should resync.
+func (h *Handler) HandleGetChanges(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	collName := vars["coll"]
+
+	logf(r, "INFO: handleGetChanges called for collection '%s'", collName)
+
+	queryParams := r.URL.Query()
+
+	var since int64
+	if sinceStr := queryParams.Get("since"); sinceStr != "" {
+		parsed, err := strconv.ParseInt(sinceStr, 10, 64)
+		if err != nil || parsed < 0 {
+			writeError(w, http.StatusBadRequest, ErrCodeValidationFailed, "since must be a non-negative integer")
+			return
+		}
+		since = parsed
+	}
+
+	limit := DefaultChangesLimit
+	if limitStr := queryParams.Get("limit"); limitStr != "" {
+		parsed, err := strconv.Atoi(limitStr)
+		if err != nil || parsed < 1 || parsed > MaxChangesLimit {
+			writeError(w, http.StatusBadRequest, ErrCodeValidationFailed, "limit must be an integer between 1 and "+strconv.Itoa(MaxChangesLimit))
+			return
+		}
+		limit = parsed
+	}
+
+	var wait time.Duration
+	if waitStr := queryParams.Get("wait"); waitStr != "" {
+		parsed, err := time.ParseDuration(waitStr)
+		if err != nil || parsed < 0 || parsed > MaxChangesWait {
+			writeError(w, http.StatusBadRequest, ErrCodeValidationFailed, "wait must be a duration between 0s and "+MaxChangesWait.String())
+			return
+		}
+		wait = parsed
+	}
+
+	feed, err := h.storage.GetChanges(r.Context(), collName, since, limit, wait)
+	if err != nil {
+		logf(r, "ERROR: Failed to read changes of collection '%s': %v", collName, err)
+		writeStorageError(w, err, http.StatusNotFound)
+		return
+	}
+
+	logf(r, "INFO: Returned %d changes of collection '%s' after offset %d", len(feed.Changes), collName, since)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ChangesResponse{
+		Success:    true,
+		Collection: collName,
+		Changes:    feed.Changes,
+		Count:      len(feed.Changes),
+		NextOffset: feed.NextOffset,
+		HasMore:    feed.HasMore,
+		Truncated:  feed.Truncated,
+	})
+}
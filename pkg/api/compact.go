@@ -0,0 +1,66 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// HandleGetCompact handles GET requests reporting whether a collection keeps its
+// documents in memory in the compact encoding
+func (h *Handler) HandleGetCompact(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	collName := vars["coll"]
+
+	logf(r, "INFO: handleGetCompact called for collection '%s'", collName)
+
+	h.writeCompactResponse(w, collName, "")
+}
+
+// HandleSetCompact handles PUT requests to keep a collection's documents in memory in
+// the compact encoding, converting the documents already loaded. Reads decode each
+// document, so this suits large collections of small documents that are read less
+// often than they are held.
+func (h *Handler) HandleSetCompact(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	collName := vars["coll"]
+
+	logf(r, "INFO: handleSetCompact called for collection '%s'", collName)
+
+	if err := h.storage.SetCollectionCompact(collName, true); err != nil {
+		writeStorageError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	h.writeCompactResponse(w, collName, "Collection is compact")
+
+	logf(r, "INFO: Collection '%s' is compact", collName)
+}
+
+// HandleDeleteCompact handles DELETE requests to keep a collection's documents as maps again
+func (h *Handler) HandleDeleteCompact(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	collName := vars["coll"]
+
+	logf(r, "INFO: handleDeleteCompact called for collection '%s'", collName)
+
+	h.storage.SetCollectionCompact(collName, false)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// writeCompactResponse writes whether a collection is compact
+func (h *Handler) writeCompactResponse(w http.ResponseWriter, collName, message string) {
+	response := map[string]interface{}{
+		"success":    true,
+		"collection": collName,
+		"compact":    h.storage.IsCollectionCompact(collName),
+	}
+	if message != "" {
+		response["message"] = message
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,69 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/adfharrison1/go-db/pkg/domain"
+	"github.com/gorilla/mux"
+)
+
+// CompareAndSetRequest represents the request body for a compare-and-set on one field.
+// Expected is compared with the stored value, so a null expected matches a missing field.
+type CompareAndSetRequest struct {
+	Field    string      `json:"field"`
+	Expected interface{} `json:"expected"`
+	Value    interface{} `json:"value"`
+}
+
+// CompareAndSetResponse reports whether the value was set, with the document as it is
+// after the operation so a caller whose expected value was stale can retry
+type CompareAndSetResponse struct {
+	Applied  bool            `json:"applied"`
+	Document domain.Document `json:"document,omitempty"`
+}
+
+// HandleCompareAndSet handles POST requests that set a field only if it still has an expected value
+func (h *Handler) HandleCompareAndSet(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	collName := vars["coll"]
+	docId := vars["id"]
+
+	logf(r, "INFO: handleCompareAndSet called for collection '%s', document '%s'", collName, docId)
+
+	var req CompareAndSetRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		logf(r, "ERROR: Decoding body failed: %v", err)
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "Invalid request body")
+		return
+	}
+
+	applied, err := h.storage.CompareAndSetField(collName, docId, req.Field, req.Expected, req.Value)
+	if err != nil {
+		if errors.Is(err, domain.ErrInvalidField) {
+			logf(r, "ERROR: Invalid compare-and-set field for document '%s' in collection '%s': %v", docId, collName, err)
+			writeStorageError(w, err, http.StatusBadRequest)
+			return
+		}
+		logf(r, "ERROR: Compare-and-set failed for document '%s' in collection '%s': %v", docId, collName, err)
+		writeStorageError(w, err, http.StatusNotFound)
+		return
+	}
+
+	if applied {
+		// Save collection to disk if transaction saves are enabled
+		if err := h.storage.SaveCollectionAfterTransaction(collName); err != nil {
+			logf(r, "WARN: Failed to save collection '%s' after compare-and-set: %v", collName, err)
+		}
+	}
+
+	logf(r, "INFO: Compare-and-set on field '%s' of document '%s' in collection '%s' applied: %t", req.Field, docId, collName, applied)
+
+	// Re-read after the lock is released; a concurrent write may already have changed it
+	doc, _ := h.storage.GetById(collName, docId)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(CompareAndSetResponse{Applied: applied, Document: doc})
+}
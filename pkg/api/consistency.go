@@ -0,0 +1,82 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+// OffsetHeader carries the storage engine's applied offset in every response: the
+// last-applied WAL offset on v2, the save generation on v1
+const OffsetHeader = "X-GoDB-Offset"
+
+// MinOffsetHeader asks the server to answer only once it has applied at least the
+// given offset, so a client can read its own writes from any replica
+const MinOffsetHeader = "X-GoDB-Min-Offset"
+
+// ConsistencyMiddleware rejects requests whose X-GoDB-Min-Offset is ahead of the
+// engine with 425 Too Early, and sets X-GoDB-Offset on every response. The offset is
+// read when the handler starts writing its response, so it covers the request's own
+// write.
+func (h *Handler) ConsistencyMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if value := r.Header.Get(MinOffsetHeader); value != "" {
+			minOffset, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || minOffset < 0 {
+				writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, fmt.Sprintf("%s must be a non-negative integer", MinOffsetHeader))
+				return
+			}
+			if offset := h.storage.AppliedOffset(); offset < minOffset {
+				w.Header().Set(OffsetHeader, strconv.FormatInt(offset, 10))
+				writeErrorDetails(w, http.StatusTooEarly, ErrCodeTooEarly,
+					fmt.Sprintf("Server has applied offset %d, behind the required %d", offset, minOffset),
+					map[string]interface{}{"offset": offset, "min_offset": minOffset})
+				return
+			}
+		}
+
+		next.ServeHTTP(&offsetResponseWriter{ResponseWriter: w, handler: h}, r)
+	})
+}
+
+// offsetResponseWriter sets X-GoDB-Offset just before the response header is written
+type offsetResponseWriter struct {
+	http.ResponseWriter
+	handler     *Handler
+	wroteHeader bool
+}
+
+func (w *offsetResponseWriter) WriteHeader(statusCode int) {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		w.Header().Set(OffsetHeader, strconv.FormatInt(w.handler.storage.AppliedOffset(), 10))
+	}
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (w *offsetResponseWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush lets streaming handlers flush through the wrapper
+func (w *offsetResponseWriter) Flush() {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// EnableFullDuplex lets the ingest handler read its body while streaming acks
+func (w *offsetResponseWriter) EnableFullDuplex() error {
+	return http.NewResponseController(w.ResponseWriter).EnableFullDuplex()
+}
+
+// Unwrap gives http.ResponseController the underlying writer
+func (w *offsetResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
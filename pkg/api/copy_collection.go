@@ -0,0 +1,52 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// CopyCollectionRequest represents the request body for copying a collection
+type CopyCollectionRequest struct {
+	Dest string `json:"dest"`
+}
+
+// HandleCopyCollection handles POST requests to copy a collection's documents and
+// index definitions under a new name
+func (h *Handler) HandleCopyCollection(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	collName := vars["coll"]
+
+	logf(r, "INFO: handleCopyCollection called for collection '%s'", collName)
+
+	var req CopyCollectionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		logf(r, "ERROR: Decoding body failed: %v", err)
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "Invalid request body")
+		return
+	}
+	if req.Dest == "" {
+		writeError(w, http.StatusBadRequest, ErrCodeValidationFailed, "dest is required")
+		return
+	}
+
+	if err := h.storage.CopyCollection(collName, req.Dest); err != nil {
+		logf(r, "ERROR: Copy of collection '%s' to '%s' failed: %v", collName, req.Dest, err)
+		writeStorageError(w, err, http.StatusNotFound)
+		return
+	}
+
+	logf(r, "INFO: Copied collection '%s' to '%s'", collName, req.Dest)
+
+	response := map[string]interface{}{
+		"success":    true,
+		"message":    "Collection copied",
+		"collection": collName,
+		"dest":       req.Dest,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,70 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+
+	"github.com/adfharrison1/go-db/pkg/domain"
+	"github.com/adfharrison1/go-db/pkg/storage"
+)
+
+// CreateCollectionWithOptionsRequest represents the request body for provisioning a
+// collection: its name and the options it is created with
+type CreateCollectionWithOptionsRequest struct {
+	Name string `json:"name"`
+	domain.CollectionOptions
+}
+
+// HandleCreateCollectionWithOptions handles POST requests to create a collection with
+// its indexes, schema, defaults, default filter and cap in one step. Nothing is created
+// unless all of it can be, and unknown fields are rejected rather than ignored, so the
+// collection is never left half-configured.
+func (h *Handler) HandleCreateCollectionWithOptions(w http.ResponseWriter, r *http.Request) {
+	logf(r, "INFO: handleCreateCollectionWithOptions called")
+
+	var req CreateCollectionWithOptionsRequest
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&req); err != nil {
+		logf(r, "ERROR: Decoding body failed: %v", err)
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "Invalid request body: "+err.Error())
+		return
+	}
+	if req.Name == "" {
+		writeError(w, http.StatusBadRequest, ErrCodeValidationFailed, "name is required")
+		return
+	}
+
+	if err := storage.ValidateCollectionOptions(req.CollectionOptions); err != nil {
+		writeStorageError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	if err := h.storage.CreateCollectionWithOptions(req.Name, req.CollectionOptions); err != nil {
+		logf(r, "ERROR: Creating collection '%s' failed: %v", req.Name, err)
+		writeStorageError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	logf(r, "INFO: Created collection '%s' with %d indexes", req.Name, len(req.Indexes))
+
+	indexes, _ := h.storage.GetIndexes(req.Name)
+	sort.Strings(indexes)
+	response := map[string]interface{}{
+		"success":    true,
+		"message":    "Collection created",
+		"collection": req.Name,
+		"indexes":    indexes,
+	}
+	if capped := h.storage.GetCollectionCapped(req.Name); capped != nil {
+		response["capped"] = capped
+	}
+	if h.storage.IsCollectionCompact(req.Name) {
+		response["compact"] = true
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(response)
+}
@@ -2,11 +2,25 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 
+	"github.com/adfharrison1/go-db/pkg/domain"
 	"github.com/gorilla/mux"
 )
 
+// TypeCheckParam is the query parameter that scans existing documents for the types
+// stored in the indexed field: "report" returns a summary, "reject" also refuses to
+// create an index whose field holds more than one type
+const TypeCheckParam = "typeCheck"
+
+// Type check modes accepted by TypeCheckParam and IndexSpec.TypeCheck
+const (
+	TypeCheckReport = "report"
+	TypeCheckReject = "reject"
+)
+
 // HandleCreateIndex creates an index on a specific field in a collection
 func (h *Handler) HandleCreateIndex(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
@@ -14,19 +28,45 @@ func (h *Handler) HandleCreateIndex(w http.ResponseWriter, r *http.Request) {
 	fieldName := vars["field"]
 
 	if fieldName == "" {
-		WriteJSONError(w, http.StatusBadRequest, "field name is required")
+		writeError(w, http.StatusBadRequest, ErrCodeValidationFailed, "field name is required")
 		return
 	}
 
 	// Prevent creating index on _id (it's automatically created)
 	if fieldName == "_id" {
-		WriteJSONError(w, http.StatusBadRequest, "cannot create index on _id field (automatically indexed)")
+		writeError(w, http.StatusBadRequest, ErrCodeValidationFailed, "cannot create index on _id field (automatically indexed)")
 		return
 	}
 
-	err := h.storage.CreateIndex(collName, fieldName)
+	typeCheck := r.URL.Query().Get(TypeCheckParam)
+	if err := validateTypeCheck(typeCheck); err != nil {
+		writeStorageError(w, err, http.StatusBadRequest)
+		return
+	}
+	collation := r.URL.Query().Get(CollationParam)
+	if err := validateIndexCollation(collation, typeCheck); err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeValidationFailed, err.Error())
+		return
+	}
+
+	var report *domain.FieldTypeReport
+	var err error
+	if collation != "" {
+		err = h.storage.CreateCollatedIndex(collName, fieldName, collation, false)
+	} else if typeCheck != "" {
+		report, err = h.storage.CreateIndexWithTypeCheck(collName, fieldName, typeCheck == TypeCheckReject)
+	} else {
+		err = h.storage.CreateIndex(collName, fieldName)
+	}
 	if err != nil {
-		WriteJSONError(w, http.StatusInternalServerError, err.Error())
+		if errors.Is(err, domain.ErrInconsistentFieldTypes) {
+			logf(r, "WARN: Index on '%s' in collection '%s' rejected: %v", fieldName, collName, err)
+			writeErrorDetails(w, http.StatusConflict, ErrCodeInconsistentFieldTypes, err.Error(), map[string]interface{}{
+				"type_report": report,
+			})
+			return
+		}
+		writeStorageError(w, err, http.StatusInternalServerError)
 		return
 	}
 
@@ -36,8 +76,35 @@ func (h *Handler) HandleCreateIndex(w http.ResponseWriter, r *http.Request) {
 		"collection": collName,
 		"field":      fieldName,
 	}
+	if report != nil {
+		response["type_report"] = report
+		if !report.Consistent {
+			response["message"] = "Index created, but the field holds more than one type"
+		}
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(response)
 }
+
+// validateIndexCollation checks the collation of an index, which cannot be combined
+// with a type check; an empty collation creates an index with exact keys
+func validateIndexCollation(collation, typeCheck string) error {
+	if collation == "" {
+		return nil
+	}
+	if typeCheck != "" {
+		return errors.New("type checks are not supported for collated indexes")
+	}
+	return domain.ValidateCollation(collation)
+}
+
+// validateTypeCheck checks a type check mode; an empty mode skips the check
+func validateTypeCheck(mode string) error {
+	switch mode {
+	case "", TypeCheckReport, TypeCheckReject:
+		return nil
+	}
+	return fmt.Errorf("invalid type check %q: use %q or %q", mode, TypeCheckReport, TypeCheckReject)
+}
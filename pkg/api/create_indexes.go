@@ -0,0 +1,181 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/adfharrison1/go-db/pkg/domain"
+	"github.com/gorilla/mux"
+)
+
+// IndexSpec describes a single index to create in a bulk index request
+type IndexSpec struct {
+	Field     string                 `json:"field,omitempty"`
+	Fields    []string               `json:"fields,omitempty"` // Compound index fields
+	Unique    bool                   `json:"unique,omitempty"`
+	Condition map[string]interface{} `json:"condition,omitempty"`  // Partial index: only documents matching this filter
+	Collation string                 `json:"collation,omitempty"`  // String keys compare under this collation, see CollationParam
+	TypeCheck string                 `json:"type_check,omitempty"` // "report" or "reject", see TypeCheckParam
+}
+
+// CreateIndexesRequest represents the request body for bulk index creation
+type CreateIndexesRequest struct {
+	Indexes []IndexSpec `json:"indexes"`
+}
+
+// IndexCreateResult reports the outcome of creating a single index
+type IndexCreateResult struct {
+	Field     string   `json:"field,omitempty"`
+	Fields    []string `json:"fields,omitempty"`
+	Unique    bool     `json:"unique,omitempty"`
+	Collation string   `json:"collation,omitempty"`
+	Success   bool     `json:"success"`
+	Error     string   `json:"error,omitempty"`
+
+	TypeReport *domain.FieldTypeReport `json:"type_report,omitempty"`
+}
+
+// CreateIndexesResponse represents the response for bulk index creation
+type CreateIndexesResponse struct {
+	Success      bool                `json:"success"`
+	Message      string              `json:"message"`
+	Collection   string              `json:"collection"`
+	CreatedCount int                 `json:"created_count"`
+	FailedCount  int                 `json:"failed_count"`
+	Results      []IndexCreateResult `json:"results"`
+}
+
+// HandleCreateIndexes handles POST requests to create multiple indexes in one call.
+// Each index is created independently, so one failure does not abort the others.
+func (h *Handler) HandleCreateIndexes(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	collName := vars["coll"]
+
+	logf(r, "INFO: handleCreateIndexes called for collection '%s'", collName)
+
+	var req CreateIndexesRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		logf(r, "ERROR: Decoding body failed: %v", err)
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "Invalid request body")
+		return
+	}
+
+	// Validate request
+	if len(req.Indexes) == 0 {
+		writeError(w, http.StatusBadRequest, ErrCodeValidationFailed, "No indexes provided")
+		return
+	}
+
+	if len(req.Indexes) > 100 {
+		writeError(w, http.StatusBadRequest, ErrCodeValidationFailed, "Maximum 100 indexes allowed per request")
+		return
+	}
+
+	response := CreateIndexesResponse{
+		Collection: collName,
+		Results:    make([]IndexCreateResult, 0, len(req.Indexes)),
+	}
+
+	for _, spec := range req.Indexes {
+		result := IndexCreateResult{
+			Field:     spec.Field,
+			Fields:    spec.Fields,
+			Unique:    spec.Unique,
+			Collation: spec.Collation,
+		}
+
+		report, err := h.createIndexFromSpec(collName, spec)
+		result.TypeReport = report
+		if err != nil {
+			result.Error = err.Error()
+			response.FailedCount++
+		} else {
+			result.Success = true
+			response.CreatedCount++
+		}
+
+		response.Results = append(response.Results, result)
+	}
+
+	status := http.StatusCreated
+	switch {
+	case response.FailedCount == 0:
+		response.Success = true
+		response.Message = "All indexes created successfully"
+	case response.CreatedCount > 0:
+		response.Message = "Some indexes could not be created"
+		status = http.StatusMultiStatus // 207: the results report which indexes failed
+	default:
+		response.Message = "No indexes could be created"
+		status = http.StatusBadRequest
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(response)
+
+	logf(r, "INFO: Bulk index creation for collection '%s', created %d, failed %d",
+		collName, response.CreatedCount, response.FailedCount)
+}
+
+// createIndexFromSpec validates a single index spec and creates it via the storage engine.
+// The type report is non-nil when the spec asked for a type check.
+func (h *Handler) createIndexFromSpec(collName string, spec IndexSpec) (*domain.FieldTypeReport, error) {
+	fieldName := spec.Field
+
+	// A compound spec with a single field is just a regular index
+	if len(spec.Fields) > 0 {
+		if fieldName != "" {
+			return nil, errors.New("specify either field or fields, not both")
+		}
+		if len(spec.Fields) > 1 {
+			if spec.Condition != nil || spec.Collation != "" || spec.TypeCheck != "" {
+				return nil, errors.New("conditions, collations and type checks are not supported for compound indexes")
+			}
+			return nil, h.storage.CreateCompoundIndex(collName, spec.Fields, spec.Unique)
+		}
+		fieldName = spec.Fields[0]
+	}
+
+	if fieldName == "" {
+		return nil, errors.New("field name is required")
+	}
+
+	// Prevent creating index on _id (it's automatically created)
+	if fieldName == "_id" {
+		return nil, errors.New("cannot create index on _id field (automatically indexed)")
+	}
+
+	if err := validateTypeCheck(spec.TypeCheck); err != nil {
+		return nil, err
+	}
+
+	if spec.Collation != "" {
+		if spec.Condition != nil {
+			return nil, errors.New("conditions are not supported for collated indexes")
+		}
+		if err := validateIndexCollation(spec.Collation, spec.TypeCheck); err != nil {
+			return nil, err
+		}
+		return nil, h.storage.CreateCollatedIndex(collName, fieldName, spec.Collation, spec.Unique)
+	}
+
+	if spec.Unique {
+		if spec.Condition != nil || spec.TypeCheck != "" {
+			return nil, errors.New("conditions and type checks are not supported for unique indexes")
+		}
+		return nil, h.storage.CreateUniqueIndex(collName, fieldName)
+	}
+
+	if spec.Condition != nil {
+		if spec.TypeCheck != "" {
+			return nil, errors.New("type checks are not supported for partial indexes")
+		}
+		return nil, h.storage.CreatePartialIndex(collName, fieldName, spec.Condition)
+	}
+	if spec.TypeCheck != "" {
+		return h.storage.CreateIndexWithTypeCheck(collName, fieldName, spec.TypeCheck == TypeCheckReject)
+	}
+	return nil, h.storage.CreateIndex(collName, fieldName)
+}
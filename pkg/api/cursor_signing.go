@@ -0,0 +1,38 @@
+package api
+
+import (
+	"github.com/adfharrison1/go-db/pkg/domain"
+)
+
+// verifyCursors checks the signatures of request cursors and strips them so the
+// storage engine sees plain cursors. It does nothing without a cursor secret.
+func (h *Handler) verifyCursors(options *domain.PaginationOptions) error {
+	if len(h.cursorSecret) == 0 {
+		return nil
+	}
+	for _, cursor := range []*string{&options.After, &options.Before} {
+		if *cursor == "" {
+			continue
+		}
+		encoded, err := domain.VerifySignedCursor(*cursor, h.cursorSecret, h.cursorMaxAge)
+		if err != nil {
+			return err
+		}
+		*cursor = encoded
+	}
+	return nil
+}
+
+// signCursors signs the cursors of a result before it is returned to the client.
+// It does nothing without a cursor secret.
+func (h *Handler) signCursors(result *domain.PaginationResult) {
+	if len(h.cursorSecret) == 0 {
+		return
+	}
+	if result.NextCursor != "" {
+		result.NextCursor = domain.SignCursor(result.NextCursor, h.cursorSecret)
+	}
+	if result.PrevCursor != "" {
+		result.PrevCursor = domain.SignCursor(result.PrevCursor, h.cursorSecret)
+	}
+}
@@ -0,0 +1,83 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/adfharrison1/go-db/pkg/storage"
+	"github.com/gorilla/mux"
+)
+
+// DefaultFilterRequest represents the request body for setting a collection default filter
+type DefaultFilterRequest struct {
+	Filter map[string]interface{} `json:"filter"`
+}
+
+// HandleGetDefaultFilter handles GET requests to retrieve a collection's default filter
+func (h *Handler) HandleGetDefaultFilter(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	collName := vars["coll"]
+
+	logf(r, "INFO: handleGetDefaultFilter called for collection '%s'", collName)
+
+	filter := h.storage.GetCollectionDefaultFilter(collName)
+	if filter == nil {
+		filter = map[string]interface{}{}
+	}
+
+	response := map[string]interface{}{
+		"success":    true,
+		"collection": collName,
+		"filter":     filter,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// HandleSetDefaultFilter handles PUT requests to set a collection's default filter.
+// The filter is ANDed into every find and stream query unless ?includeDeleted=true is passed.
+func (h *Handler) HandleSetDefaultFilter(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	collName := vars["coll"]
+
+	logf(r, "INFO: handleSetDefaultFilter called for collection '%s'", collName)
+
+	var req DefaultFilterRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		logf(r, "ERROR: Decoding body failed: %v", err)
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "Invalid request body")
+		return
+	}
+
+	if err := storage.ValidateFilter(req.Filter); err != nil {
+		writeStorageError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	h.storage.SetCollectionDefaultFilter(collName, req.Filter)
+
+	response := map[string]interface{}{
+		"success":    true,
+		"message":    "Default filter updated",
+		"collection": collName,
+		"filter":     h.storage.GetCollectionDefaultFilter(collName),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+
+	logf(r, "INFO: Set default filter for collection '%s': %v", collName, req.Filter)
+}
+
+// HandleDeleteDefaultFilter handles DELETE requests to remove a collection's default filter
+func (h *Handler) HandleDeleteDefaultFilter(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	collName := vars["coll"]
+
+	logf(r, "INFO: handleDeleteDefaultFilter called for collection '%s'", collName)
+
+	h.storage.SetCollectionDefaultFilter(collName, nil)
+
+	w.WriteHeader(http.StatusNoContent)
+}
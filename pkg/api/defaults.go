@@ -0,0 +1,89 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/adfharrison1/go-db/pkg/domain"
+	"github.com/adfharrison1/go-db/pkg/storage"
+	"github.com/gorilla/mux"
+)
+
+// DefaultsRequest represents the request body for setting collection insert defaults
+type DefaultsRequest struct {
+	Defaults domain.Document `json:"defaults"`
+}
+
+// HandleGetDefaults handles GET requests to retrieve a collection's insert defaults
+func (h *Handler) HandleGetDefaults(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	collName := vars["coll"]
+
+	logf(r, "INFO: handleGetDefaults called for collection '%s'", collName)
+
+	defaults := h.storage.GetCollectionDefaults(collName)
+	if defaults == nil {
+		defaults = domain.Document{}
+	}
+
+	response := map[string]interface{}{
+		"success":    true,
+		"collection": collName,
+		"defaults":   defaults,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// HandleSetDefaults handles PUT requests to set a collection's insert defaults.
+// Defaults are added to inserted documents that do not already contain the field.
+func (h *Handler) HandleSetDefaults(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	collName := vars["coll"]
+
+	logf(r, "INFO: handleSetDefaults called for collection '%s'", collName)
+
+	var req DefaultsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		logf(r, "ERROR: Decoding body failed: %v", err)
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "Invalid request body")
+		return
+	}
+
+	if err := storage.ValidateDocumentDefaults(req.Defaults); err != nil {
+		writeStorageError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	h.storage.SetCollectionDefaults(collName, req.Defaults)
+
+	defaults := h.storage.GetCollectionDefaults(collName)
+	if defaults == nil {
+		defaults = domain.Document{}
+	}
+
+	response := map[string]interface{}{
+		"success":    true,
+		"message":    "Defaults updated",
+		"collection": collName,
+		"defaults":   defaults,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+
+	logf(r, "INFO: Set insert defaults for collection '%s': %v", collName, req.Defaults)
+}
+
+// HandleDeleteDefaults handles DELETE requests to remove a collection's insert defaults
+func (h *Handler) HandleDeleteDefaults(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	collName := vars["coll"]
+
+	logf(r, "INFO: handleDeleteDefaults called for collection '%s'", collName)
+
+	h.storage.SetCollectionDefaults(collName, nil)
+
+	w.WriteHeader(http.StatusNoContent)
+}
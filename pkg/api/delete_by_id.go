@@ -1,32 +1,66 @@
 package api
 
 import (
-	"log"
+	"encoding/json"
+	"fmt"
 	"net/http"
+	"strconv"
 
+	"github.com/adfharrison1/go-db/pkg/domain"
 	"github.com/gorilla/mux"
 )
 
-// HandleDeleteById handles DELETE requests to remove a specific document by ID
+// ReturnParam is the query parameter asking a delete to respond with the removed document
+const ReturnParam = "return"
+
+// HandleDeleteById handles DELETE requests to remove a specific document by ID.
+// With ?return=true the response is 200 with the removed document instead of 204.
 func (h *Handler) HandleDeleteById(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	collName := vars["coll"]
 	docId := vars["id"]
 
-	log.Printf("INFO: handleDeleteById called for collection '%s', document '%s'", collName, docId)
+	logf(r, "INFO: handleDeleteById called for collection '%s', document '%s'", collName, docId)
+
+	returnDoc := false
+	if raw := r.URL.Query().Get(ReturnParam); raw != "" {
+		parsed, err := strconv.ParseBool(raw)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, ErrCodeValidationFailed, fmt.Sprintf("invalid %s '%s': must be true or false", ReturnParam, raw))
+			return
+		}
+		returnDoc = parsed
+	}
 
-	if err := h.storage.DeleteById(collName, docId); err != nil {
-		log.Printf("ERROR: Delete failed for document '%s' in collection '%s': %v", docId, collName, err)
-		WriteJSONError(w, http.StatusNotFound, err.Error())
+	ctx, err := writeContext(r)
+	if err != nil {
+		writeStorageError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	var deleted domain.Document
+	if returnDoc {
+		deleted, err = h.storage.DeleteByIdReturningContext(ctx, collName, docId)
+	} else {
+		err = h.storage.DeleteByIdContext(ctx, collName, docId)
+	}
+	if err != nil {
+		logf(r, "ERROR: Delete failed for document '%s' in collection '%s': %v", docId, collName, err)
+		writeStorageError(w, err, http.StatusNotFound)
 		return
 	}
 
 	// Save collection to disk if transaction saves are enabled
 	if err := h.storage.SaveCollectionAfterTransaction(collName); err != nil {
-		log.Printf("WARN: Failed to save collection '%s' after delete: %v", collName, err)
+		logf(r, "WARN: Failed to save collection '%s' after delete: %v", collName, err)
 		// Don't fail the request if save fails, just log the warning
 	}
 
-	log.Printf("INFO: Deleted document '%s' from collection '%s'", docId, collName)
+	logf(r, "INFO: Deleted document '%s' from collection '%s'", docId, collName)
+	if returnDoc {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(deleted)
+		return
+	}
 	w.WriteHeader(http.StatusNoContent)
 }
@@ -0,0 +1,44 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// HandleDropAllIndexes handles DELETE requests to drop every secondary index on a collection.
+// The _id index is always kept.
+func (h *Handler) HandleDropAllIndexes(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	collName := vars["coll"]
+
+	logf(r, "INFO: handleDropAllIndexes called for collection '%s'", collName)
+
+	dropped, err := h.storage.DropAllIndexes(collName)
+	if err != nil {
+		logf(r, "ERROR: Failed to drop indexes for collection '%s': %v", collName, err)
+		writeStorageError(w, err, http.StatusNotFound)
+		return
+	}
+
+	after, err := h.storage.GetIndexes(collName)
+	if err != nil {
+		logf(r, "ERROR: Failed to get indexes for collection '%s': %v", collName, err)
+		writeStorageError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	response := map[string]interface{}{
+		"success":       true,
+		"message":       "Indexes dropped successfully",
+		"collection":    collName,
+		"dropped_count": dropped,
+		"indexes":       after,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+
+	logf(r, "INFO: Dropped %d indexes from collection '%s'", dropped, collName)
+}
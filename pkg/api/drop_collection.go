@@ -0,0 +1,25 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// HandleDropCollection handles DELETE requests to remove a whole collection: its
+// documents, indexes and settings, and its data on disk
+func (h *Handler) HandleDropCollection(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	collName := vars["coll"]
+
+	logf(r, "INFO: handleDropCollection called for collection '%s'", collName)
+
+	if err := h.storage.DropCollection(collName); err != nil {
+		logf(r, "ERROR: Dropping collection '%s' failed: %v", collName, err)
+		writeStorageError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	logf(r, "INFO: Dropped collection '%s'", collName)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,80 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/adfharrison1/go-db/pkg/domain"
+	"github.com/gorilla/mux"
+)
+
+const (
+	// DefaultIndexDumpLimit is how many index keys a dump returns by default
+	DefaultIndexDumpLimit = 1000
+
+	// MaxIndexDumpLimit bounds the ?limit= of an index dump
+	MaxIndexDumpLimit = 10000
+
+	// MaxIndexDumpIDs bounds the document IDs an index dump returns across its keys
+	MaxIndexDumpIDs = 10000
+)
+
+// IndexDumpResponse is the response body of an index dump. Warning explains a
+// truncated dump.
+type IndexDumpResponse struct {
+	Success bool `json:"success"`
+	*domain.IndexDump
+	Warning string `json:"warning,omitempty"`
+}
+
+// HandleDumpIndex handles GET requests for an index's raw key -> document IDs
+// entries in key order, ?limit= keys (default 1000) after the first ?offset=, for
+// diagnosing index drift. It is routed behind the admin token. Dumps are capped at
+// MaxIndexDumpIDs IDs; truncated dumps carry a warning and are continued from
+// next_offset.
+func (h *Handler) HandleDumpIndex(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	collName := vars["coll"]
+	fieldName := vars["field"]
+
+	logf(r, "INFO: handleDumpIndex called for index '%s' of collection '%s'", fieldName, collName)
+
+	queryParams := r.URL.Query()
+
+	offset := 0
+	if offsetStr := queryParams.Get("offset"); offsetStr != "" {
+		parsed, err := strconv.Atoi(offsetStr)
+		if err != nil || parsed < 0 {
+			writeError(w, http.StatusBadRequest, ErrCodeValidationFailed, "offset must be a non-negative integer")
+			return
+		}
+		offset = parsed
+	}
+
+	limit := DefaultIndexDumpLimit
+	if limitStr := queryParams.Get("limit"); limitStr != "" {
+		parsed, err := strconv.Atoi(limitStr)
+		if err != nil || parsed < 1 || parsed > MaxIndexDumpLimit {
+			writeError(w, http.StatusBadRequest, ErrCodeValidationFailed, "limit must be an integer between 1 and "+strconv.Itoa(MaxIndexDumpLimit))
+			return
+		}
+		limit = parsed
+	}
+
+	dump, err := h.indexer.DumpIndex(collName, fieldName, offset, limit, MaxIndexDumpIDs)
+	if err != nil {
+		logf(r, "ERROR: Failed to dump index '%s' of collection '%s': %v", fieldName, collName, err)
+		writeStorageError(w, err, http.StatusNotFound)
+		return
+	}
+
+	response := IndexDumpResponse{Success: true, IndexDump: dump}
+	if dump.Truncated {
+		response.Warning = "Dump truncated: continue from next_offset; keys listing fewer ids than their count were cut short"
+		logf(r, "WARN: Dump of index '%s' of collection '%s' truncated after %d of %d keys", fieldName, collName, len(dump.Entries), dump.TotalKeys)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,32 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/adfharrison1/go-db/pkg/domain"
+)
+
+// DurableParam is the write query parameter that makes the write fail unless it is
+// persisted before the response, rather than being retried in the background
+const DurableParam = "durable"
+
+// writeContext derives the context used to run a write. ?durable=true marks it with
+// domain.WithDurableWrite.
+func writeContext(r *http.Request) (context.Context, error) {
+	ctx := r.Context()
+	raw := r.URL.Query().Get(DurableParam)
+	if raw == "" {
+		return ctx, nil
+	}
+	durable, err := strconv.ParseBool(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s '%s': must be true or false", DurableParam, raw)
+	}
+	if durable {
+		ctx = domain.WithDurableWrite(ctx)
+	}
+	return ctx, nil
+}
@@ -0,0 +1,79 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/adfharrison1/go-db/pkg/domain"
+)
+
+// EnvelopeParam is the query parameter choosing whether find and query wrap their
+// documents in a pagination object (true) or return a bare array (false)
+const EnvelopeParam = "envelope"
+
+// Pagination metadata headers sent with bare-array responses, so that every list
+// endpoint can be parsed as an array of documents. Streams send TotalCountHeader as
+// a trailer, since the count is only known once the last document is written.
+const (
+	TotalCountHeader = "X-Total-Count"
+	HasNextHeader    = "X-Has-Next"
+	HasPrevHeader    = "X-Has-Prev"
+	NextCursorHeader = "X-Next-Cursor"
+	PrevCursorHeader = "X-Prev-Cursor"
+	PageHeader       = "X-Page"
+	TotalPagesHeader = "X-Total-Pages"
+)
+
+// WithEnvelope sets whether find and query responses wrap their documents in a
+// pagination object when the request does not pass ?envelope=. The default, true,
+// keeps the {"documents": [...], "has_next": ...} shape existing clients expect.
+func WithEnvelope(enabled bool) HandlerOption {
+	return func(h *Handler) {
+		h.noEnvelope = !enabled
+	}
+}
+
+// useEnvelope reports whether a find or query response should be enveloped
+func (h *Handler) useEnvelope(r *http.Request) (bool, error) {
+	raw := r.URL.Query().Get(EnvelopeParam)
+	if raw == "" {
+		return !h.noEnvelope, nil
+	}
+	envelope, err := strconv.ParseBool(raw)
+	if err != nil {
+		return false, fmt.Errorf("invalid %s '%s': must be true or false", EnvelopeParam, raw)
+	}
+	return envelope, nil
+}
+
+// writePaginationResult writes a page of documents, either as the result object or
+// as a bare array with the pagination metadata in headers
+func writePaginationResult(w http.ResponseWriter, result *domain.PaginationResult, envelope bool) {
+	w.Header().Set("Content-Type", "application/json")
+	if envelope {
+		json.NewEncoder(w).Encode(result)
+		return
+	}
+
+	w.Header().Set(TotalCountHeader, strconv.FormatInt(result.Total, 10))
+	w.Header().Set(HasNextHeader, strconv.FormatBool(result.HasNext))
+	w.Header().Set(HasPrevHeader, strconv.FormatBool(result.HasPrev))
+	if result.NextCursor != "" {
+		w.Header().Set(NextCursorHeader, result.NextCursor)
+	}
+	if result.PrevCursor != "" {
+		w.Header().Set(PrevCursorHeader, result.PrevCursor)
+	}
+	if result.Page > 0 {
+		w.Header().Set(PageHeader, strconv.Itoa(result.Page))
+		w.Header().Set(TotalPagesHeader, strconv.Itoa(result.TotalPages))
+	}
+
+	docs := result.Documents
+	if docs == nil {
+		docs = []domain.Document{}
+	}
+	json.NewEncoder(w).Encode(docs)
+}
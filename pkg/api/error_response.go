@@ -1,27 +1,185 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
+
+	"github.com/adfharrison1/go-db/pkg/domain"
+)
+
+// Error codes identify the cause of an error response. They are part of the API and
+// stay stable across releases, unlike messages, so clients should branch on them.
+const (
+	ErrCodeInvalidRequest         = "INVALID_REQUEST"          // Malformed body or parameter
+	ErrCodeValidationFailed       = "VALIDATION_FAILED"        // Well-formed input with invalid values
+	ErrCodeInvalidFilter          = "INVALID_FILTER"           // Filter cannot be parsed or evaluated
+	ErrCodeInvalidCursor          = "INVALID_CURSOR"           // Pagination cursor is malformed, tampered with or expired
+	ErrCodeInvalidCollectionName  = "INVALID_COLLECTION_NAME"  // Collection name violates the naming policy
+	ErrCodeInvalidField           = "INVALID_FIELD"            // Operation cannot apply to the named field
+	ErrCodeFieldNotInSchema       = "FIELD_NOT_IN_SCHEMA"      // Strict collection schema does not declare a written field
+	ErrCodeUnauthorized           = "UNAUTHORIZED"             // Missing or invalid credentials
+	ErrCodeForbidden              = "FORBIDDEN"                // Operation is not allowed
+	ErrCodeCollectionLimitReached = "COLLECTION_LIMIT_REACHED" // Creating a collection would exceed the maximum
+	ErrCodeNotFound               = "NOT_FOUND"                // Resource without a more specific code does not exist
+	ErrCodeCollectionNotFound     = "COLLECTION_NOT_FOUND"
+	ErrCodeDocumentNotFound       = "DOCUMENT_NOT_FOUND"
+	ErrCodeFieldNotFound          = "FIELD_NOT_FOUND"
+	ErrCodeIndexNotFound          = "INDEX_NOT_FOUND"
+	ErrCodeMethodNotAllowed       = "METHOD_NOT_ALLOWED"
+	ErrCodeConflict               = "CONFLICT"                 // Request conflicts with the current state
+	ErrCodeCollectionExists       = "COLLECTION_EXISTS"        // Collection name is already in use
+	ErrCodeDocumentExists         = "DOCUMENT_EXISTS"          // Document ID is already in use
+	ErrCodeDuplicateKey           = "DUPLICATE_KEY"            // Unique index already holds the written key
+	ErrCodeInconsistentFieldTypes = "INCONSISTENT_FIELD_TYPES" // Strict type check found mixed field types
+	ErrCodeResultTooLarge         = "RESULT_TOO_LARGE"         // Query matches more documents than allowed
+	ErrCodeTooLarge               = "TOO_LARGE"                // Request or response exceeds a size limit
+	ErrCodeReadOnly               = "READ_ONLY"                // Writes are rejected by a read-only server or collection
+	ErrCodeRateLimited            = "RATE_LIMITED"             // Too many requests; retry later
+	ErrCodeTimeout                = "TIMEOUT"                  // Query did not finish within its timeout
+	ErrCodeTooEarly               = "TOO_EARLY"                // Server has not yet applied the required offset
+	ErrCodeNotDurable             = "NOT_DURABLE"              // Durable write could not be persisted before the response
+	ErrCodeChangeFeedDisabled     = "CHANGE_FEED_DISABLED"     // Server runs without a change log
+	ErrCodeInsertionOrderDisabled = "INSERTION_ORDER_DISABLED" // Server does not track insertion order
+	ErrCodeTimestampsDisabled     = "TIMESTAMPS_DISABLED"      // Server does not maintain modification times
+	ErrCodeVersionsDisabled       = "VERSIONS_DISABLED"        // Server does not maintain document versions
+	ErrCodeVersionConflict        = "VERSION_CONFLICT"         // Document is not at the version the request expects
+	ErrCodeCompactUnsupported     = "COMPACT_UNSUPPORTED"      // Storage engine cannot keep collections compact
+	ErrCodeInternal               = "INTERNAL_ERROR"
 )
 
-// ErrorResponse represents a standard JSON error response
+// ErrorResponse represents a standard JSON error response:
+// {"error": {"code": "COLLECTION_NOT_FOUND", "message": "...", "details": {}}}
 type ErrorResponse struct {
-	Error   string `json:"error"`
-	Message string `json:"message"`
-	Code    int    `json:"code"`
+	Error ErrorDetail `json:"error"`
 }
 
-// WriteJSONError writes a JSON error response with the given status code and message
-func WriteJSONError(w http.ResponseWriter, statusCode int, message string) {
+// ErrorDetail describes an error. Details holds extra machine-readable context and is
+// always an object, empty when there is none.
+type ErrorDetail struct {
+	Code    string                 `json:"code"`
+	Message string                 `json:"message"`
+	Details map[string]interface{} `json:"details"`
+}
+
+// newErrorResponse builds an error response body, defaulting details to an empty object
+func newErrorResponse(code, message string, details map[string]interface{}) ErrorResponse {
+	if details == nil {
+		details = map[string]interface{}{}
+	}
+	return ErrorResponse{Error: ErrorDetail{Code: code, Message: message, Details: details}}
+}
+
+// writeError writes a JSON error response with the given status, error code and message
+func writeError(w http.ResponseWriter, statusCode int, code, message string) {
+	writeErrorDetails(w, statusCode, code, message, nil)
+}
+
+// writeErrorDetails writes a JSON error response carrying extra details
+func writeErrorDetails(w http.ResponseWriter, statusCode int, code, message string, details map[string]interface{}) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(newErrorResponse(code, message, details))
+}
+
+// writeStorageError writes an error returned by the storage engine. Errors matching a
+// domain sentinel get its status and code; others are written with fallbackStatus.
+func writeStorageError(w http.ResponseWriter, err error, fallbackStatus int) {
+	statusCode, code := storageErrorStatus(err, fallbackStatus)
+	message := err.Error()
+	if code == ErrCodeTimeout {
+		message = "Query timed out"
+	}
+	writeError(w, statusCode, code, message)
+}
+
+// storageErrorStatus maps a storage error to an HTTP status and error code
+func storageErrorStatus(err error, fallbackStatus int) (int, string) {
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return http.StatusGatewayTimeout, ErrCodeTimeout
+	case errors.Is(err, domain.ErrInvalidFilter):
+		return http.StatusBadRequest, ErrCodeInvalidFilter
+	case errors.Is(err, domain.ErrInvalidCursor):
+		return http.StatusBadRequest, ErrCodeInvalidCursor
+	case errors.Is(err, domain.ErrInvalidCollectionName):
+		return http.StatusBadRequest, ErrCodeInvalidCollectionName
+	case errors.Is(err, domain.ErrInvalidField):
+		return http.StatusBadRequest, ErrCodeInvalidField
+	case errors.Is(err, domain.ErrFieldNotInSchema):
+		return http.StatusBadRequest, ErrCodeFieldNotInSchema
+	case errors.Is(err, domain.ErrCollectionLimitReached):
+		return http.StatusForbidden, ErrCodeCollectionLimitReached
+	case errors.Is(err, domain.ErrCollectionNotFound):
+		return http.StatusNotFound, ErrCodeCollectionNotFound
+	case errors.Is(err, domain.ErrDocumentNotFound):
+		return http.StatusNotFound, ErrCodeDocumentNotFound
+	case errors.Is(err, domain.ErrFieldNotFound):
+		return http.StatusNotFound, ErrCodeFieldNotFound
+	case errors.Is(err, domain.ErrIndexNotFound):
+		return http.StatusNotFound, ErrCodeIndexNotFound
+	case errors.Is(err, domain.ErrCollectionExists):
+		return http.StatusConflict, ErrCodeCollectionExists
+	case errors.Is(err, domain.ErrDocumentExists):
+		return http.StatusConflict, ErrCodeDocumentExists
+	case errors.Is(err, domain.ErrDuplicateKey):
+		return http.StatusConflict, ErrCodeDuplicateKey
+	case errors.Is(err, domain.ErrInconsistentFieldTypes):
+		return http.StatusConflict, ErrCodeInconsistentFieldTypes
+	case errors.Is(err, domain.ErrResultTooLarge):
+		return http.StatusRequestEntityTooLarge, ErrCodeResultTooLarge
+	case errors.Is(err, domain.ErrNotDurable):
+		return http.StatusServiceUnavailable, ErrCodeNotDurable
+	case errors.Is(err, domain.ErrChangeFeedDisabled):
+		return http.StatusNotImplemented, ErrCodeChangeFeedDisabled
+	case errors.Is(err, domain.ErrInsertionOrderDisabled):
+		return http.StatusNotImplemented, ErrCodeInsertionOrderDisabled
+	case errors.Is(err, domain.ErrTimestampsDisabled):
+		return http.StatusNotImplemented, ErrCodeTimestampsDisabled
+	case errors.Is(err, domain.ErrVersionsDisabled):
+		return http.StatusNotImplemented, ErrCodeVersionsDisabled
+	case errors.Is(err, domain.ErrVersionConflict):
+		return http.StatusPreconditionFailed, ErrCodeVersionConflict
+	case errors.Is(err, domain.ErrCompactUnsupported):
+		return http.StatusNotImplemented, ErrCodeCompactUnsupported
+	}
+	return fallbackStatus, codeForStatus(fallbackStatus)
+}
 
-	response := ErrorResponse{
-		Error:   http.StatusText(statusCode),
-		Message: message,
-		Code:    statusCode,
+// codeForStatus returns the generic error code for an HTTP status
+func codeForStatus(statusCode int) string {
+	switch statusCode {
+	case http.StatusBadRequest:
+		return ErrCodeValidationFailed
+	case http.StatusUnauthorized:
+		return ErrCodeUnauthorized
+	case http.StatusForbidden:
+		return ErrCodeForbidden
+	case http.StatusNotFound:
+		return ErrCodeNotFound
+	case http.StatusMethodNotAllowed:
+		return ErrCodeMethodNotAllowed
+	case http.StatusConflict:
+		return ErrCodeConflict
+	case http.StatusRequestEntityTooLarge:
+		return ErrCodeTooLarge
+	case http.StatusTooEarly:
+		return ErrCodeTooEarly
+	case http.StatusTooManyRequests:
+		return ErrCodeRateLimited
+	case http.StatusGatewayTimeout:
+		return ErrCodeTimeout
+	}
+	if statusCode >= http.StatusInternalServerError {
+		return ErrCodeInternal
 	}
+	return ErrCodeInvalidRequest
+}
 
-	json.NewEncoder(w).Encode(response)
+// WriteJSONError writes a JSON error response with the given status code and message,
+// using the generic error code for the status. Handlers use writeError to give a
+// specific code.
+func WriteJSONError(w http.ResponseWriter, statusCode int, message string) {
+	writeError(w, statusCode, codeForStatus(statusCode), message)
 }
@@ -0,0 +1,107 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/adfharrison1/go-db/pkg/domain"
+	"github.com/adfharrison1/go-db/pkg/storage"
+	"github.com/gorilla/mux"
+)
+
+// FacetsRequest represents the request body for a facets query
+type FacetsRequest struct {
+	Filter map[string]interface{} `json:"filter,omitempty"`
+	Fields []string               `json:"fields"`
+}
+
+// FacetCount is the number of matching documents with a given field value
+type FacetCount struct {
+	Value interface{} `json:"value"`
+	Count int64       `json:"count"`
+}
+
+// FacetsResponse represents the response for a facets query
+type FacetsResponse struct {
+	Success    bool                    `json:"success"`
+	Collection string                  `json:"collection"`
+	Facets     map[string][]FacetCount `json:"facets"`
+}
+
+// HandleFacets handles POST requests to count matching documents per value of
+// several fields in one pass, e.g. for faceted search sidebars
+func (h *Handler) HandleFacets(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	collName := vars["coll"]
+
+	logf(r, "INFO: handleFacets called for collection '%s'", collName)
+
+	var req FacetsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		logf(r, "ERROR: Decoding body failed: %v", err)
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "Invalid request body")
+		return
+	}
+
+	if err := storage.ValidateFacetFields(req.Fields); err != nil {
+		writeStorageError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel, err := h.queryContext(r)
+	if err != nil {
+		writeStorageError(w, err, http.StatusBadRequest)
+		return
+	}
+	defer cancel()
+
+	counts, err := h.storage.FacetsContext(ctx, collName, req.Filter, req.Fields)
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			logf(r, "WARN: Facets on collection '%s' timed out: %v", collName, err)
+			writeError(w, http.StatusGatewayTimeout, ErrCodeTimeout, "Query timed out")
+			return
+		}
+		if errors.Is(err, domain.ErrInvalidFilter) {
+			logf(r, "ERROR: Invalid filter for collection '%s': %v", collName, err)
+			writeStorageError(w, err, http.StatusBadRequest)
+			return
+		}
+		logf(r, "ERROR: Collection '%s' not found: %v", collName, err)
+		writeStorageError(w, err, http.StatusNotFound)
+		return
+	}
+
+	response := FacetsResponse{
+		Success:    true,
+		Collection: collName,
+		Facets:     make(map[string][]FacetCount, len(counts)),
+	}
+	for field, values := range counts {
+		response.Facets[field] = sortFacetCounts(values)
+	}
+
+	logf(r, "INFO: Computed facets for %d fields in collection '%s'", len(req.Fields), collName)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// sortFacetCounts orders facet values by descending count, then by value
+func sortFacetCounts(values map[interface{}]int64) []FacetCount {
+	facets := make([]FacetCount, 0, len(values))
+	for value, count := range values {
+		facets = append(facets, FacetCount{Value: value, Count: count})
+	}
+	sort.Slice(facets, func(i, j int) bool {
+		if facets[i].Count != facets[j].Count {
+			return facets[i].Count > facets[j].Count
+		}
+		return fmt.Sprint(facets[i].Value) < fmt.Sprint(facets[j].Value)
+	})
+	return facets
+}
@@ -0,0 +1,111 @@
+package api
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/adfharrison1/go-db/pkg/domain"
+	"github.com/adfharrison1/go-db/pkg/storage"
+)
+
+// Type hints accepted as a query parameter key suffix, e.g. ?age:int=30 or ?zip:string=02134
+const (
+	TypeHintString = "string"
+	TypeHintInt    = "int"
+	TypeHintFloat  = "float"
+	TypeHintBool   = "bool"
+)
+
+// decimalPattern matches the plain decimal numbers that are inferred as numbers
+// (so values like "NaN", "Inf" or "0x1F" stay strings)
+var decimalPattern = regexp.MustCompile(`^[-+]?(\d+\.?\d*|\.\d+)([eE][-+]?\d+)?$`)
+
+// filterFromQuery builds an equality filter from query parameters, skipping the
+// reserved (non-filter) parameters. Only the first value of a parameter is used.
+//
+// Values are coerced to match JSON-typed document fields: "true" and "false" become
+// booleans, decimal numbers become numbers (float64, like numbers decoded from JSON
+// documents) and everything else stays a string. A ":type" suffix on the key
+// (string, int, float or bool) overrides inference, e.g. ?zip:string=02134. $expr
+// values are always passed through as strings.
+func filterFromQuery(params url.Values, reserved ...string) (map[string]interface{}, error) {
+	filter := make(map[string]interface{})
+	for key, values := range params {
+		if len(values) == 0 || containsString(reserved, key) {
+			continue
+		}
+		value := values[0] // Take first value if multiple provided
+
+		if key == storage.ExprFilterKey {
+			filter[key] = value
+			continue
+		}
+
+		field, hint := key, ""
+		if i := strings.LastIndex(key, ":"); i >= 0 {
+			field, hint = key[:i], key[i+1:]
+		}
+		if field == "" {
+			return nil, fmt.Errorf("%w: query parameter %q has no field name", domain.ErrInvalidFilter, key)
+		}
+
+		coerced, err := coerceQueryValue(value, hint)
+		if err != nil {
+			return nil, fmt.Errorf("%w: query parameter %q: %v", domain.ErrInvalidFilter, key, err)
+		}
+		filter[field] = coerced
+	}
+	return filter, nil
+}
+
+// coerceQueryValue converts a query parameter value using an explicit type hint,
+// or infers its type when hint is empty
+func coerceQueryValue(value, hint string) (interface{}, error) {
+	switch hint {
+	case "":
+		if value == "true" || value == "false" {
+			return value == "true", nil
+		}
+		if decimalPattern.MatchString(value) {
+			if num, err := strconv.ParseFloat(value, 64); err == nil {
+				return num, nil
+			}
+		}
+		return value, nil
+	case TypeHintString:
+		return value, nil
+	case TypeHintInt:
+		num, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not an integer", value)
+		}
+		// Stored as float64 so it matches, and finds index entries for, JSON-decoded numbers
+		return float64(num), nil
+	case TypeHintFloat:
+		if !decimalPattern.MatchString(value) {
+			return nil, fmt.Errorf("%q is not a number", value)
+		}
+		return strconv.ParseFloat(value, 64)
+	case TypeHintBool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a boolean", value)
+		}
+		return b, nil
+	default:
+		return nil, fmt.Errorf("unknown type hint %q (use string, int, float or bool)", hint)
+	}
+}
+
+// containsString reports whether list contains s
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,24 @@
+package api
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/adfharrison1/go-db/pkg/domain"
+)
+
+// findAcrossCollections writes a page of the documents matching filter in every
+// collection whose name matches pattern, each tagged with its collection. Plain
+// errors come from pagination the merge does not support, so they are client errors.
+func (h *Handler) findAcrossCollections(ctx context.Context, w http.ResponseWriter, r *http.Request, pattern string, filter map[string]interface{}, options *domain.PaginationOptions, envelope bool) {
+	result, err := h.storage.FindAcrossCollectionsContext(ctx, pattern, filter, options)
+	if err != nil {
+		logf(r, "ERROR: Query across collections '%s' failed: %v", pattern, err)
+		writeStorageError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	logf(r, "INFO: Found %d documents across collections matching '%s'", len(result.Documents), pattern)
+
+	writePaginationResult(w, result, envelope)
+}
@@ -1,24 +1,40 @@
 package api
 
 import (
-	"encoding/json"
-	"log"
+	"context"
+	"errors"
 	"net/http"
 	"strconv"
 
 	"github.com/adfharrison1/go-db/pkg/domain"
+	"github.com/adfharrison1/go-db/pkg/storage"
 	"github.com/gorilla/mux"
 )
 
-// HandleFindAll handles GET requests to find documents with filter criteria and pagination
+// SortParam is the query parameter naming the field find results are sorted by, in
+// the direction given by order
+const SortParam = "sort"
+
+// CollationParam is the query parameter naming how strings compare, when sorting by
+// a field and in the filter's equality conditions (see storage.CollationFilterKey);
+// domain.CollationCaseInsensitive ignores case. On index creation it names the
+// collation of the index.
+const CollationParam = "collation"
+
+// Directions for the order query parameter when sorting by a field
+const (
+	SortAscending  = "asc"
+	SortDescending = "desc"
+)
+
+// HandleFindAll handles GET requests to find documents with filter criteria and pagination.
+// A collection glob such as logs_2024_01_* finds documents across every matching collection.
 func (h *Handler) HandleFindAll(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	collName := vars["coll"]
 
-	log.Printf("INFO: handleFindAll called for collection '%s'", collName)
+	logf(r, "INFO: handleFindAll called for collection '%s'", collName)
 
-	// Parse query parameters to build filter
-	filter := make(map[string]interface{})
 	queryParams := r.URL.Query()
 
 	// Extract pagination parameters
@@ -47,39 +63,95 @@ func (h *Handler) HandleFindAll(w http.ResponseWriter, r *http.Request) {
 		paginationOptions.Before = before
 	}
 
-	// Build filter from remaining query parameters
-	for key, values := range queryParams {
-		// Skip pagination parameters
-		if key == "limit" || key == "offset" || key == "after" || key == "before" {
-			continue
+	// Parse result order: a sort field with asc or desc and a collation, or else id or inserted
+	if sortField := queryParams.Get(SortParam); sortField != "" {
+		paginationOptions.SortField = sortField
+		switch order := queryParams.Get("order"); order {
+		case "", SortAscending:
+		case SortDescending:
+			paginationOptions.SortDesc = true
+		default:
+			writeError(w, http.StatusBadRequest, ErrCodeValidationFailed, "order must be "+SortAscending+" or "+SortDescending+" when sorting by a field, got "+order)
+			return
 		}
+	} else {
+		paginationOptions.Order = queryParams.Get("order")
+	}
+	paginationOptions.Collation = queryParams.Get(CollationParam)
 
-		if len(values) > 0 {
-			value := values[0] // Take first value if multiple provided
-
-			// Try to convert to number if possible
-			if num, err := strconv.ParseFloat(value, 64); err == nil {
-				filter[key] = num
-			} else if num, err := strconv.ParseInt(value, 10, 64); err == nil {
-				filter[key] = num
-			} else {
-				// Treat as string
-				filter[key] = value
-			}
-		}
+	if err := paginationOptions.Validate(); err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeValidationFailed, err.Error())
+		return
+	}
+
+	// Build filter from remaining query parameters, skipping pagination parameters
+	filter, err := filterFromQuery(queryParams, "limit", "offset", "after", "before", "order", SortParam, CollationParam, TimeoutParam, IncludeDeletedParam, EnvelopeParam, PrettyParam, ModifiedSinceParam, ModifiedFieldParam)
+	if err != nil {
+		logf(r, "ERROR: Invalid filter for collection '%s': %v", collName, err)
+		writeStorageError(w, err, http.StatusBadRequest)
+		return
+	}
+	if filter, err = h.applyModifiedSince(queryParams, filter); err != nil {
+		logf(r, "ERROR: Invalid modification time filter for collection '%s': %v", collName, err)
+		writeStorageError(w, err, http.StatusBadRequest)
+		return
+	}
+	if paginationOptions.Collation != "" && len(filter) > 0 {
+		filter[storage.CollationFilterKey] = paginationOptions.Collation
+	}
+
+	envelope, err := h.useEnvelope(r)
+	if err != nil {
+		writeStorageError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	if err := h.verifyCursors(paginationOptions); err != nil {
+		logf(r, "ERROR: Rejected cursor for collection '%s': %v", collName, err)
+		writeStorageError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel, err := h.queryContext(r)
+	if err != nil {
+		writeStorageError(w, err, http.StatusBadRequest)
+		return
+	}
+	defer cancel()
+
+	// A glob such as logs_2024_01_* queries every matching collection
+	if storage.IsCollectionPattern(collName) {
+		h.findAcrossCollections(ctx, w, r, collName, filter, paginationOptions, envelope)
+		return
 	}
 
 	// Always use paginated version
-	result, err := h.storage.FindAll(collName, filter, paginationOptions)
+	result, err := h.storage.FindAllContext(ctx, collName, filter, paginationOptions)
 	if err != nil {
-		log.Printf("ERROR: Collection '%s' not found: %v", collName, err)
-		WriteJSONError(w, http.StatusNotFound, err.Error())
+		if errors.Is(err, context.DeadlineExceeded) {
+			logf(r, "WARN: Query on collection '%s' timed out: %v", collName, err)
+			writeError(w, http.StatusGatewayTimeout, ErrCodeTimeout, "Query timed out")
+			return
+		}
+		if errors.Is(err, domain.ErrInvalidFilter) {
+			logf(r, "ERROR: Invalid filter for collection '%s': %v", collName, err)
+			writeStorageError(w, err, http.StatusBadRequest)
+			return
+		}
+		if errors.Is(err, domain.ErrResultTooLarge) {
+			logf(r, "WARN: Query on collection '%s' matched too many documents: %v", collName, err)
+			writeStorageError(w, err, http.StatusRequestEntityTooLarge)
+			return
+		}
+		logf(r, "ERROR: Collection '%s' not found: %v", collName, err)
+		writeStorageError(w, err, http.StatusNotFound)
 		return
 	}
 
-	log.Printf("INFO: Found %d documents in collection '%s' with pagination (total: %d)",
+	logf(r, "INFO: Found %d documents in collection '%s' with pagination (total: %d)",
 		len(result.Documents), collName, result.Total)
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(result)
+	h.signCursors(result)
+
+	writePaginationResult(w, result, envelope)
 }
@@ -1,14 +1,19 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
-	"log"
+	"errors"
 	"net/http"
 	"strconv"
 
+	"github.com/adfharrison1/go-db/pkg/domain"
 	"github.com/gorilla/mux"
 )
 
+// PartialResultsTrailer is the HTTP trailer set to "true" when a stream was cut short by its timeout
+const PartialResultsTrailer = "X-Partial-Results"
+
 // HandleFindAllWithStream handles GET requests to stream documents from collections
 // NOTE: This endpoint does NOT apply pagination - it streams ALL matching documents.
 // Use /collections/{coll}/find for paginated queries, or handle pagination at the client level.
@@ -16,49 +21,54 @@ func (h *Handler) HandleFindAllWithStream(w http.ResponseWriter, r *http.Request
 	vars := mux.Vars(r)
 	collName := vars["coll"]
 
-	log.Printf("INFO: handleFindAllWithStream called for collection '%s'", collName)
+	logf(r, "INFO: handleFindAllWithStream called for collection '%s'", collName)
+
+	ctx, cancel, err := h.queryContext(r)
+	if err != nil {
+		writeStorageError(w, err, http.StatusBadRequest)
+		return
+	}
+	defer cancel()
 
 	// Set headers for streaming
+	w.Header().Set("Trailer", PartialResultsTrailer+", "+TotalCountHeader)
 	w.Header().Set("Content-Type", "application/json")
 	w.Header().Set("Transfer-Encoding", "chunked")
 	w.Header().Set("Cache-Control", "no-cache")
 	w.Header().Set("Connection", "keep-alive")
 
 	// Parse query parameters for filtering only (pagination is ignored)
-	filter := make(map[string]interface{})
 	queryParams := r.URL.Query()
-
-	// Build filter from query parameters (ignore pagination parameters)
-	for key, values := range queryParams {
-		// Skip pagination parameters - they are ignored in streaming
-		if key == "limit" || key == "offset" || key == "after" || key == "before" {
-			log.Printf("WARN: Pagination parameter '%s' ignored in streaming endpoint", key)
-			continue
-		}
-
-		if len(values) > 0 {
-			value := values[0] // Take first value if multiple provided
-
-			// Try to convert to number if possible
-			if num, err := strconv.ParseFloat(value, 64); err == nil {
-				filter[key] = num
-			} else if num, err := strconv.ParseInt(value, 10, 64); err == nil {
-				filter[key] = num
-			} else {
-				// Treat as string
-				filter[key] = value
-			}
+	for _, key := range []string{"limit", "offset", "after", "before", EnvelopeParam} {
+		if queryParams.Has(key) {
+			logf(r, "WARN: Pagination parameter '%s' ignored in streaming endpoint", key)
 		}
 	}
+	filter, err := filterFromQuery(queryParams, "limit", "offset", "after", "before", TimeoutParam, IncludeDeletedParam, EnvelopeParam, PrettyParam)
+	if err != nil {
+		logf(r, "ERROR: Invalid filter for collection '%s': %v", collName, err)
+		writeStorageError(w, err, http.StatusBadRequest)
+		return
+	}
 
 	// Stream all matching documents (no pagination)
-	docChan, err := h.storage.FindAllStream(collName, filter)
+	docChan, err := h.storage.FindAllStreamContext(ctx, collName, filter)
 	if err != nil {
-		log.Printf("ERROR: Collection '%s' not found: %v", collName, err)
-		WriteJSONError(w, http.StatusNotFound, err.Error())
+		if errors.Is(err, domain.ErrInvalidFilter) {
+			logf(r, "ERROR: Invalid filter for collection '%s': %v", collName, err)
+			writeStorageError(w, err, http.StatusBadRequest)
+			return
+		}
+		logf(r, "ERROR: Collection '%s' not found: %v", collName, err)
+		writeStorageError(w, err, http.StatusNotFound)
 		return
 	}
 
+	// The bare array carries the same metadata headers as an unenveloped find, with
+	// the count sent as a trailer
+	w.Header().Set(HasNextHeader, "false")
+	w.Header().Set(HasPrevHeader, "false")
+
 	// Start JSON array
 	w.Write([]byte("[\n"))
 
@@ -75,13 +85,13 @@ func (h *Handler) HandleFindAllWithStream(w http.ResponseWriter, r *http.Request
 		// Marshal document to JSON
 		docJSON, err := json.Marshal(doc)
 		if err != nil {
-			log.Printf("ERROR: Failed to marshal document: %v", err)
+			logf(r, "ERROR: Failed to marshal document: %v", err)
 			continue // Skip this document and continue streaming
 		}
 
 		// Write document to response
 		if _, err := w.Write(docJSON); err != nil {
-			log.Printf("ERROR: Failed to write to response: %v", err)
+			logf(r, "ERROR: Failed to write to response: %v", err)
 			return
 		}
 
@@ -95,6 +105,14 @@ func (h *Handler) HandleFindAllWithStream(w http.ResponseWriter, r *http.Request
 
 	// End JSON array
 	w.Write([]byte("\n]"))
+	w.Header().Set(TotalCountHeader, strconv.Itoa(docCount))
+
+	// Headers are already sent, so a timeout is reported via a trailer
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		w.Header().Set(PartialResultsTrailer, "true")
+		logf(r, "WARN: Stream from collection '%s' timed out after %d documents", collName, docCount)
+		return
+	}
 
-	log.Printf("INFO: Streamed %d documents from collection '%s' (no pagination applied)", docCount, collName)
+	logf(r, "INFO: Streamed %d documents from collection '%s' (no pagination applied)", docCount, collName)
 }
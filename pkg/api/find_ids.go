@@ -0,0 +1,69 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/adfharrison1/go-db/pkg/domain"
+	"github.com/gorilla/mux"
+)
+
+// FindIdsResponse is the response body of an ID-only find request
+type FindIdsResponse struct {
+	Success    bool     `json:"success"`
+	Collection string   `json:"collection"`
+	Ids        []string `json:"ids"`
+	Count      int      `json:"count"`
+}
+
+// HandleFindIds handles GET requests for the sorted IDs of documents matching
+// filter criteria taken from the query parameters, without their contents
+func (h *Handler) HandleFindIds(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	collName := vars["coll"]
+
+	logf(r, "INFO: handleFindIds called for collection '%s'", collName)
+
+	filter, err := filterFromQuery(r.URL.Query(), TimeoutParam, IncludeDeletedParam, PrettyParam)
+	if err != nil {
+		logf(r, "ERROR: Invalid filter for collection '%s': %v", collName, err)
+		writeStorageError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel, err := h.queryContext(r)
+	if err != nil {
+		writeStorageError(w, err, http.StatusBadRequest)
+		return
+	}
+	defer cancel()
+
+	ids, err := h.storage.FindIdsContext(ctx, collName, filter)
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			logf(r, "WARN: ID query on collection '%s' timed out: %v", collName, err)
+			writeError(w, http.StatusGatewayTimeout, ErrCodeTimeout, "Query timed out")
+			return
+		}
+		if errors.Is(err, domain.ErrInvalidFilter) {
+			logf(r, "ERROR: Invalid filter for collection '%s': %v", collName, err)
+			writeStorageError(w, err, http.StatusBadRequest)
+			return
+		}
+		logf(r, "ERROR: Collection '%s' not found: %v", collName, err)
+		writeStorageError(w, err, http.StatusNotFound)
+		return
+	}
+
+	logf(r, "INFO: Found %d document IDs in collection '%s'", len(ids), collName)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(FindIdsResponse{
+		Success:    true,
+		Collection: collName,
+		Ids:        ids,
+		Count:      len(ids),
+	})
+}
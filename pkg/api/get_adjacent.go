@@ -0,0 +1,67 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/adfharrison1/go-db/pkg/domain"
+	"github.com/adfharrison1/go-db/pkg/storage"
+	"github.com/gorilla/mux"
+)
+
+// HandleGetNextById handles GET requests for the document following an ID in _id
+// order, for record-by-record browsing. The ID itself need not exist.
+func (h *Handler) HandleGetNextById(w http.ResponseWriter, r *http.Request) {
+	h.handleGetAdjacent(w, r, true)
+}
+
+// HandleGetPrevById handles GET requests for the document preceding an ID in _id order
+func (h *Handler) HandleGetPrevById(w http.ResponseWriter, r *http.Request) {
+	h.handleGetAdjacent(w, r, false)
+}
+
+// handleGetAdjacent writes the neighbouring document of the request's ID. Documents
+// hidden by the collection default filter are skipped, as GET reports them missing.
+func (h *Handler) handleGetAdjacent(w http.ResponseWriter, r *http.Request, next bool) {
+	vars := mux.Vars(r)
+	collName := vars["coll"]
+	docId := vars["id"]
+
+	direction := "next"
+	getAdjacent := h.storage.GetNextById
+	if !next {
+		direction = "previous"
+		getAdjacent = h.storage.GetPrevById
+	}
+
+	logf(r, "INFO: handleGetAdjacent called for collection '%s', document '%s' (%s)", collName, docId, direction)
+
+	var defaultFilter map[string]interface{}
+	if !includeDeleted(r) {
+		defaultFilter = h.storage.GetCollectionDefaultFilter(collName)
+	}
+
+	var doc domain.Document
+	for id := docId; ; id = doc["_id"].(string) {
+		var err error
+		doc, err = getAdjacent(collName, id)
+		if err != nil {
+			logf(r, "INFO: No %s document for '%s' in collection '%s': %v", direction, docId, collName, err)
+			if id != docId {
+				// Not naming the hidden document the search stopped at
+				writeError(w, http.StatusNotFound, ErrCodeNotFound, fmt.Sprintf("no %s document for id %s in collection %s", direction, docId, collName))
+				return
+			}
+			writeStorageError(w, err, http.StatusNotFound)
+			return
+		}
+		if defaultFilter == nil || storage.MatchesFilter(doc, defaultFilter) {
+			break
+		}
+	}
+
+	logf(r, "INFO: Retrieved %s document '%v' for '%s' in collection '%s'", direction, doc["_id"], docId, collName)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(doc)
+}
@@ -2,9 +2,11 @@ package api
 
 import (
 	"encoding/json"
-	"log"
+	"fmt"
 	"net/http"
 
+	"github.com/adfharrison1/go-db/pkg/domain"
+	"github.com/adfharrison1/go-db/pkg/storage"
 	"github.com/gorilla/mux"
 )
 
@@ -14,16 +16,67 @@ func (h *Handler) HandleGetById(w http.ResponseWriter, r *http.Request) {
 	collName := vars["coll"]
 	docId := vars["id"]
 
-	log.Printf("INFO: handleGetById called for collection '%s', document '%s'", collName, docId)
+	logf(r, "INFO: handleGetById called for collection '%s', document '%s'", collName, docId)
 
 	doc, err := h.storage.GetById(collName, docId)
 	if err != nil {
-		log.Printf("ERROR: Document '%s' not found in collection '%s': %v", docId, collName, err)
-		WriteJSONError(w, http.StatusNotFound, err.Error())
+		logf(r, "ERROR: Document '%s' not found in collection '%s': %v", docId, collName, err)
+		writeStorageError(w, err, http.StatusNotFound)
 		return
 	}
 
-	log.Printf("INFO: Retrieved document '%s' from collection '%s'", docId, collName)
+	// Documents hidden by the collection default filter are reported as not found
+	if !includeDeleted(r) {
+		if defaultFilter := h.storage.GetCollectionDefaultFilter(collName); defaultFilter != nil && !storage.MatchesFilter(doc, defaultFilter) {
+			logf(r, "INFO: Document '%s' in collection '%s' excluded by default filter", docId, collName)
+			writeError(w, http.StatusNotFound, ErrCodeDocumentNotFound, fmt.Sprintf("document with id %s not found in collection %s", docId, collName))
+			return
+		}
+	}
+
+	logf(r, "INFO: Retrieved document '%s' from collection '%s'", docId, collName)
+	h.setVersionETag(w, doc)
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(doc)
 }
+
+// setVersionETag sets the ETag header to the document's _version as an entity tag such
+// as "3", which If-Match accepts for a conditional update, when the storage engine
+// maintains versions
+func (h *Handler) setVersionETag(w http.ResponseWriter, doc domain.Document) {
+	if h.storage.DocumentVersionsEnabled() {
+		w.Header().Set("ETag", fmt.Sprintf(`"%d"`, storage.DocumentVersion(doc)))
+	}
+}
+
+// HandleHeadById handles HEAD requests that check whether a document exists without
+// transferring it. It responds 200 or 404 with no body; documents hidden by the
+// collection default filter are reported as not found, as with GET. When the engine
+// maintains versions the document is read to send its ETag.
+func (h *Handler) HandleHeadById(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	collName := vars["coll"]
+	docId := vars["id"]
+
+	logf(r, "INFO: handleHeadById called for collection '%s', document '%s'", collName, docId)
+
+	var filter map[string]interface{}
+	if !includeDeleted(r) {
+		filter = h.storage.GetCollectionDefaultFilter(collName)
+	}
+
+	if h.storage.DocumentVersionsEnabled() {
+		doc, err := h.storage.GetById(collName, docId)
+		if err != nil || (filter != nil && !storage.MatchesFilter(doc, filter)) {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		h.setVersionETag(w, doc)
+	} else if !h.storage.DocumentExists(collName, docId, filter) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+}
@@ -2,7 +2,6 @@ package api
 
 import (
 	"encoding/json"
-	"log"
 	"net/http"
 
 	"github.com/gorilla/mux"
@@ -13,13 +12,13 @@ func (h *Handler) HandleGetIndexes(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	collName := vars["coll"]
 
-	log.Printf("INFO: handleGetIndexes called for collection '%s'", collName)
+	logf(r, "INFO: handleGetIndexes called for collection '%s'", collName)
 
 	// Get all indexes for the collection
 	indexes, err := h.storage.GetIndexes(collName)
 	if err != nil {
-		log.Printf("ERROR: Failed to get indexes for collection '%s': %v", collName, err)
-		WriteJSONError(w, http.StatusInternalServerError, err.Error())
+		logf(r, "ERROR: Failed to get indexes for collection '%s': %v", collName, err)
+		writeStorageError(w, err, http.StatusInternalServerError)
 		return
 	}
 
@@ -34,5 +33,5 @@ func (h *Handler) HandleGetIndexes(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
 
-	log.Printf("INFO: Retrieved %d indexes for collection '%s'", len(indexes), collName)
+	logf(r, "INFO: Retrieved %d indexes for collection '%s'", len(indexes), collName)
 }
@@ -1,19 +1,97 @@
 package api
 
 import (
+	"net/http"
+	"sync"
+	"time"
+
 	"github.com/adfharrison1/go-db/pkg/domain"
 )
 
 // Handler provides HTTP handlers for the database API
 type Handler struct {
-	storage domain.StorageEngine
-	indexer domain.IndexEngine
+	storage      domain.StorageEngine
+	indexer      domain.IndexEngine
+	queryTimeout time.Duration // Maximum time a query may run (0 = unlimited)
+	version      string        // go-db release reported by GET /version
+	engine       string        // Active storage engine ("v1" or "v2")
+	cursorSecret []byte        // Key for signing pagination cursors (nil = unsigned)
+	cursorMaxAge time.Duration // Age after which signed cursors are rejected (0 = never)
+	noEnvelope   bool          // Find and query return bare arrays unless ?envelope=true
+	adminToken   string        // Bearer token for /admin endpoints (empty = disabled)
+
+	// Router that POST /batch dispatches sub-requests to (set by RegisterRoutes)
+	router http.Handler
+
+	// Background index rebuilds, the most recent per collection
+	rebuildJobs map[string]*rebuildJob
+	rebuildSeq  int64
+	rebuildMu   sync.Mutex
+
+	// Background migrations, the most recent per collection
+	migrationJobs map[string]*migrationJob
+	migrationSeq  int64
+	migrationMu   sync.Mutex
+
+	// Background schema validations, the most recent per collection
+	validationJobs map[string]*validationJob
+	validationSeq  int64
+	validationMu   sync.Mutex
+
+	// Every background job by ID, kept for jobRetention once finished
+	jobs         map[string]backgroundJob
+	jobRetention time.Duration
+	jobsMu       sync.Mutex
+}
+
+// HandlerOption configures optional Handler behaviour
+type HandlerOption func(*Handler)
+
+// WithQueryTimeout sets the server-side maximum duration for find and stream
+// queries. Per-request ?timeout= values are capped at this duration.
+func WithQueryTimeout(d time.Duration) HandlerOption {
+	return func(h *Handler) {
+		h.queryTimeout = d
+	}
+}
+
+// WithVersion sets the go-db release reported by GET /version
+func WithVersion(version string) HandlerOption {
+	return func(h *Handler) {
+		h.version = version
+	}
+}
+
+// WithEngine sets the storage engine name ("v1" or "v2") reported by GET /version
+func WithEngine(engine string) HandlerOption {
+	return func(h *Handler) {
+		h.engine = engine
+	}
+}
+
+// WithCursorSecret signs pagination cursors with an HMAC keyed by secret so that
+// clients cannot forge them. Cursors older than maxAge are rejected; 0 disables expiry.
+func WithCursorSecret(secret []byte, maxAge time.Duration) HandlerOption {
+	return func(h *Handler) {
+		h.cursorSecret = secret
+		h.cursorMaxAge = maxAge
+	}
 }
 
 // NewHandler creates a new API handler with dependency injection
-func NewHandler(storage domain.StorageEngine, indexer domain.IndexEngine) *Handler {
-	return &Handler{
-		storage: storage,
-		indexer: indexer,
+func NewHandler(storage domain.StorageEngine, indexer domain.IndexEngine, opts ...HandlerOption) *Handler {
+	h := &Handler{
+		storage:      storage,
+		indexer:      indexer,
+		jobRetention: DefaultJobRetention,
+	}
+	h.ApplyOptions(opts...)
+	return h
+}
+
+// ApplyOptions applies handler options to an existing handler
+func (h *Handler) ApplyOptions(opts ...HandlerOption) {
+	for _, opt := range opts {
+		opt(h)
 	}
 }
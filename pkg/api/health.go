@@ -3,6 +3,8 @@ package api
 import (
 	"encoding/json"
 	"net/http"
+
+	"github.com/adfharrison1/go-db/pkg/domain"
 )
 
 // HealthResponse represents the health check response
@@ -22,3 +24,28 @@ func (h *Handler) HandleHealth(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(response)
 }
+
+// ReadyResponse represents the readiness check response
+type ReadyResponse struct {
+	Status  string                 `json:"status"` // "ready" or "loading"
+	Preload domain.PreloadProgress `json:"preload"`
+}
+
+// HandleReady handles GET requests to the readiness endpoint. It returns 503 until
+// the startup preload of collections has finished, so load balancers hold traffic
+// back while hot collections are still loading; /health stays 200 meanwhile.
+func (h *Handler) HandleReady(w http.ResponseWriter, r *http.Request) {
+	response := ReadyResponse{
+		Status:  "ready",
+		Preload: h.storage.PreloadProgress(),
+	}
+	status := http.StatusOK
+	if !response.Preload.Done {
+		response.Status = "loading"
+		status = http.StatusServiceUnavailable
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(response)
+}
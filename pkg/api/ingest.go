@@ -0,0 +1,215 @@
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/adfharrison1/go-db/pkg/domain"
+	"github.com/gorilla/mux"
+)
+
+const (
+	// ingestBatchSize is the number of documents inserted per batch
+	ingestBatchSize = 100
+
+	// ingestFlushInterval bounds how long a partial batch waits before it is
+	// inserted and acknowledged, so slow producers still get timely acks
+	ingestFlushInterval = 250 * time.Millisecond
+
+	// ingestMaxLineBytes is the largest NDJSON line accepted
+	ingestMaxLineBytes = 1024 * 1024
+)
+
+// IngestAck acknowledges a single NDJSON line of an ingest request
+type IngestAck struct {
+	Line  int    `json:"line"`
+	ID    string `json:"_id,omitempty"`
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+}
+
+// ingestLine is a parsed NDJSON line waiting to be inserted
+type ingestLine struct {
+	number int
+	doc    domain.Document
+	err    error
+}
+
+// HandleIngest handles POST requests that stream NDJSON documents into a collection.
+// Lines are read incrementally and inserted in batches; each line is acknowledged
+// in order with a streamed NDJSON IngestAck. The request may stay open for
+// long-running producers and ends cleanly when the producer disconnects.
+func (h *Handler) HandleIngest(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	collName := vars["coll"]
+
+	logf(r, "INFO: handleIngest called for collection '%s'", collName)
+
+	// HTTP/1 normally drains the request body before the response is written;
+	// acknowledgements are streamed while reading, so opt in to full duplex
+	if fd, ok := w.(interface{ EnableFullDuplex() error }); ok {
+		if err := fd.EnableFullDuplex(); err != nil {
+			logf(r, "WARN: Full duplex unavailable for ingest: %v", err)
+		}
+	}
+
+	ctx := r.Context()
+	lines := make(chan ingestLine)
+
+	// Read lines in the background so partial batches can be flushed on a timer
+	go func() {
+		defer close(lines)
+
+		scanner := bufio.NewScanner(r.Body)
+		scanner.Buffer(make([]byte, 64*1024), ingestMaxLineBytes)
+
+		number := 0
+		for scanner.Scan() {
+			number++
+			data := bytes.TrimSpace(scanner.Bytes())
+			if len(data) == 0 {
+				continue
+			}
+
+			line := ingestLine{number: number}
+			if err := json.Unmarshal(data, &line.doc); err != nil {
+				line.err = fmt.Errorf("invalid JSON: %w", err)
+			} else if line.doc == nil {
+				line.err = fmt.Errorf("line is not a JSON object")
+			}
+
+			select {
+			case lines <- line:
+			case <-ctx.Done():
+				return
+			}
+		}
+
+		if err := scanner.Err(); err != nil {
+			select {
+			case lines <- ingestLine{number: number + 1, err: fmt.Errorf("failed to read request body: %w", err)}:
+			case <-ctx.Done():
+			}
+		}
+	}()
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	encoder := json.NewEncoder(w)
+	flusher, _ := w.(http.Flusher)
+
+	ticker := time.NewTicker(ingestFlushInterval)
+	defer ticker.Stop()
+
+	var pending []ingestLine
+	inserted, failed := 0, 0
+
+	flush := func() {
+		if len(pending) == 0 {
+			return
+		}
+		for _, ack := range h.ingestBatch(r.Context(), collName, pending) {
+			if ack.OK {
+				inserted++
+			} else {
+				failed++
+			}
+			if err := encoder.Encode(ack); err != nil {
+				logf(r, "ERROR: Failed to write ingest acknowledgement: %v", err)
+			}
+		}
+		pending = pending[:0]
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+
+	for {
+		select {
+		case line, ok := <-lines:
+			if !ok {
+				flush()
+				logf(r, "INFO: Ingest into collection '%s' finished: %d inserted, %d failed", collName, inserted, failed)
+				return
+			}
+			pending = append(pending, line)
+			if len(pending) >= ingestBatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		case <-ctx.Done():
+			logf(r, "INFO: Ingest into collection '%s' stopped by client: %d inserted, %d failed, %d unacknowledged",
+				collName, inserted, failed, len(pending))
+			return
+		}
+	}
+}
+
+// ingestBatch inserts the valid documents of a batch and returns one ack per line in order.
+// If the batch insert is rejected by a check of its documents, nothing was inserted, so
+// documents are inserted one by one and each line reports its own outcome. Any other
+// failure may have left part of the batch inserted, so every line reports it instead
+// of being inserted again.
+func (h *Handler) ingestBatch(ctx context.Context, collName string, lines []ingestLine) []IngestAck {
+	acks := make([]IngestAck, len(lines))
+	var docs []domain.Document
+	var positions []int
+
+	for i, line := range lines {
+		acks[i] = IngestAck{Line: line.number}
+		if line.err != nil {
+			acks[i].Error = line.err.Error()
+			continue
+		}
+		docs = append(docs, line.doc)
+		positions = append(positions, i)
+	}
+
+	if len(docs) == 0 {
+		return acks
+	}
+
+	created, err := h.storage.BatchInsertContext(ctx, collName, docs)
+	if err == nil {
+		for j, doc := range created {
+			acks[positions[j]].OK = true
+			acks[positions[j]].ID = fmt.Sprint(doc["_id"])
+		}
+	} else if rejectsDocuments(err) {
+		logContextf(ctx, "WARN: Ingest batch into collection '%s' failed, inserting individually: %v", collName, err)
+		for j, doc := range docs {
+			createdDoc, err := h.storage.InsertContext(ctx, collName, doc)
+			if err != nil {
+				acks[positions[j]].Error = err.Error()
+				continue
+			}
+			acks[positions[j]].OK = true
+			acks[positions[j]].ID = fmt.Sprint(createdDoc["_id"])
+		}
+	} else {
+		logContextf(ctx, "ERROR: Ingest batch into collection '%s' failed: %v", collName, err)
+		for _, position := range positions {
+			acks[position].Error = err.Error()
+		}
+	}
+
+	// Save collection to disk if transaction saves are enabled
+	if err := h.storage.SaveCollectionAfterTransaction(collName); err != nil {
+		logContextf(ctx, "WARN: Failed to save collection '%s' after ingest batch: %v", collName, err)
+	}
+
+	return acks
+}
+
+// rejectsDocuments reports whether a batch insert error comes from the checks made on
+// its documents before any of them is written: a strict schema, an invalid field or a
+// unique index key
+func rejectsDocuments(err error) bool {
+	return errors.Is(err, domain.ErrFieldNotInSchema) || errors.Is(err, domain.ErrInvalidField) || errors.Is(err, domain.ErrDuplicateKey)
+}
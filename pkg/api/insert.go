@@ -2,24 +2,44 @@ package api
 
 import (
 	"encoding/json"
-	"log"
 	"net/http"
+	"net/url"
 
 	"github.com/adfharrison1/go-db/pkg/domain"
 	"github.com/gorilla/mux"
 )
 
-// HandleInsert handles POST requests to insert documents into collections
+// UnlessExistsParam is the insert query parameter holding a JSON filter: the document
+// is only inserted if no document in the collection matches it
+const UnlessExistsParam = "unlessExists"
+
+// documentLocation returns the path of a document, for the Location header of a 201
+func documentLocation(collName string, doc domain.Document) string {
+	id, _ := doc["_id"].(string)
+	return "/collections/" + url.PathEscape(collName) + "/documents/" + url.PathEscape(id)
+}
+
+// HandleInsert handles POST requests to insert documents into collections.
+// A created document's path is returned in the Location header.
+// With ?unlessExists=<filter> it responds 201 when the document was created and
+// 200 with the existing matching document otherwise. With ?durable=true a document
+// that cannot be saved before the response is an error.
 func (h *Handler) HandleInsert(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	collName := vars["coll"]
 
-	log.Printf("INFO: handleInsert called for collection '%s'", collName)
+	logf(r, "INFO: handleInsert called for collection '%s'", collName)
+
+	ctx, err := writeContext(r)
+	if err != nil {
+		writeStorageError(w, err, http.StatusBadRequest)
+		return
+	}
 
 	var doc map[string]interface{}
 	if err := json.NewDecoder(r.Body).Decode(&doc); err != nil {
-		log.Printf("ERROR: Decoding body failed: %v", err)
-		WriteJSONError(w, http.StatusBadRequest, "Invalid request body")
+		logf(r, "ERROR: Decoding body failed: %v", err)
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "Invalid request body")
 		return
 	}
 
@@ -29,23 +49,45 @@ func (h *Handler) HandleInsert(w http.ResponseWriter, r *http.Request) {
 		document[k] = v
 	}
 
-	createdDoc, err := h.storage.Insert(collName, document)
+	var unlessExists map[string]interface{}
+	if raw := r.URL.Query().Get(UnlessExistsParam); raw != "" {
+		if err := json.Unmarshal([]byte(raw), &unlessExists); err != nil || unlessExists == nil {
+			writeError(w, http.StatusBadRequest, ErrCodeValidationFailed, "Invalid "+UnlessExistsParam+" parameter: must be a JSON object filter")
+			return
+		}
+	}
+
+	var createdDoc domain.Document
+	created := true
+	if unlessExists != nil {
+		createdDoc, created, err = h.storage.InsertIfNotExistsContext(ctx, collName, unlessExists, document)
+	} else {
+		createdDoc, err = h.storage.InsertContext(ctx, collName, document)
+	}
 	if err != nil {
-		log.Printf("ERROR: Insert failed for collection '%s': %v", collName, err)
-		WriteJSONError(w, http.StatusInternalServerError, err.Error())
+		logf(r, "ERROR: Insert failed for collection '%s': %v", collName, err)
+		writeStorageError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	if !created {
+		logf(r, "INFO: Insert skipped for collection '%s': a document matches %s", collName, UnlessExistsParam)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(createdDoc)
 		return
 	}
 
 	// Save collection to disk if transaction saves are enabled
 	if err := h.storage.SaveCollectionAfterTransaction(collName); err != nil {
-		log.Printf("WARN: Failed to save collection '%s' after insert: %v", collName, err)
+		logf(r, "WARN: Failed to save collection '%s' after insert: %v", collName, err)
 		// Don't fail the request if save fails, just log the warning
 	}
 
-	log.Printf("INFO: Insert successful for collection '%s'", collName)
+	logf(r, "INFO: Insert successful for collection '%s'", collName)
 
 	// Return the created document
 	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", documentLocation(collName, createdDoc))
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(createdDoc)
 }
@@ -2,11 +2,14 @@ package api
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
+	"log"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"os"
 	"path/filepath"
 	"strings"
@@ -18,7 +21,7 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
-	"github.com/adfharrison1/go-db/pkg/indexing"
+	"github.com/adfharrison1/go-db/pkg/domain"
 	"github.com/adfharrison1/go-db/pkg/storage"
 )
 
@@ -46,9 +49,7 @@ func NewTestServer(t *testing.T, storageOptions ...storage.StorageOption) *TestS
 	allOptions := append(defaultOptions, storageOptions...)
 
 	storageEngine := storage.NewStorageEngine(allOptions...)
-	indexEngine := indexing.NewIndexEngine()
-
-	handler := NewHandler(storageEngine, indexEngine)
+	handler := NewHandler(storageEngine, storageEngine.GetIndexEngine())
 
 	router := mux.NewRouter()
 	handler.RegisterRoutes(router)
@@ -738,6 +739,169 @@ func TestAPI_Integration_IndexOperations(t *testing.T) {
 	})
 }
 
+func TestAPI_Integration_BulkCreateIndexes(t *testing.T) {
+	ts := NewTestServer(t)
+	defer ts.Close(t)
+
+	users := []map[string]interface{}{
+		{"name": "Alice", "age": 30, "email": "alice@example.com", "city": "Boston"},
+		{"name": "Bob", "age": 25, "email": "bob@example.com", "city": "Chicago"},
+	}
+	for _, user := range users {
+		resp, err := ts.POST("/collections/users", user)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	}
+
+	t.Run("Partial Success Reports Each Index", func(t *testing.T) {
+		req := map[string]interface{}{
+			"indexes": []map[string]interface{}{
+				{"field": "age"},
+				{"field": "email", "unique": true},
+				{"fields": []string{"city", "age"}},
+				{"fields": []string{"city"}},
+				{"field": "_id"},
+			},
+		}
+
+		resp, err := ts.POST("/collections/users/indexes", req)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusMultiStatus, resp.StatusCode)
+
+		body, err := ReadResponseBody(resp)
+		require.NoError(t, err)
+
+		var result CreateIndexesResponse
+		err = json.Unmarshal([]byte(body), &result)
+		require.NoError(t, err)
+
+		assert.False(t, result.Success)
+		assert.Equal(t, 4, result.CreatedCount)
+		assert.Equal(t, 1, result.FailedCount)
+		require.Len(t, result.Results, 5)
+		for _, i := range []int{0, 1, 2, 3} {
+			assert.True(t, result.Results[i].Success, result.Results[i].Error)
+		}
+		assert.Contains(t, result.Results[4].Error, "_id")
+
+		indexes, err := ts.Storage.GetIndexes("users")
+		require.NoError(t, err)
+		assert.ElementsMatch(t, []string{"_id", "age", "email", "city,age", "city"}, indexes)
+	})
+
+	t.Run("Unique Index Rejects Duplicates", func(t *testing.T) {
+		resp, err := ts.POST("/collections/users", map[string]interface{}{"name": "Robert", "email": "bob@example.com"})
+		require.NoError(t, err)
+		body, err := ReadResponseBody(resp)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusConflict, resp.StatusCode)
+		var errResp ErrorResponse
+		require.NoError(t, json.Unmarshal([]byte(body), &errResp))
+		assert.Equal(t, ErrCodeDuplicateKey, errResp.Error.Code)
+
+		req := map[string]interface{}{
+			"indexes": []map[string]interface{}{{"field": "name", "unique": true, "type_check": "report"}, {"field": "age", "unique": true}},
+		}
+		resp, err = ts.POST("/collections/users/indexes", req)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+		body, err = ReadResponseBody(resp)
+		require.NoError(t, err)
+		var result CreateIndexesResponse
+		require.NoError(t, json.Unmarshal([]byte(body), &result))
+		require.Len(t, result.Results, 2)
+		assert.Contains(t, result.Results[0].Error, "not supported for unique indexes")
+		// age already has an index
+		assert.Contains(t, result.Results[1].Error, "already exists")
+	})
+
+	t.Run("All Fail", func(t *testing.T) {
+		req := map[string]interface{}{
+			"indexes": []map[string]interface{}{{"field": "age"}},
+		}
+
+		resp, err := ts.POST("/collections/users/indexes", req)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+		resp.Body.Close()
+	})
+
+	t.Run("Empty Request", func(t *testing.T) {
+		resp, err := ts.POST("/collections/users/indexes", map[string]interface{}{"indexes": []interface{}{}})
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+		resp.Body.Close()
+	})
+}
+
+func TestAPI_Integration_CreateIndexTypeCheck(t *testing.T) {
+	ts := NewTestServer(t)
+	defer ts.Close(t)
+
+	for _, doc := range []map[string]interface{}{{"zip": "02134", "age": 30}, {"zip": 2134, "age": 41}} {
+		resp, err := ts.POST("/collections/users", doc)
+		require.NoError(t, err)
+		resp.Body.Close()
+	}
+
+	t.Run("Reject", func(t *testing.T) {
+		resp, err := ts.POST("/collections/users/indexes/zip?typeCheck=reject", nil)
+		require.NoError(t, err)
+		body, err := ReadResponseBody(resp)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusConflict, resp.StatusCode)
+
+		var result struct {
+			Error struct {
+				Code    string `json:"code"`
+				Details struct {
+					TypeReport domain.FieldTypeReport `json:"type_report"`
+				} `json:"details"`
+			} `json:"error"`
+		}
+		require.NoError(t, json.Unmarshal([]byte(body), &result))
+		assert.Equal(t, ErrCodeInconsistentFieldTypes, result.Error.Code)
+		assert.False(t, result.Error.Details.TypeReport.Consistent)
+		assert.Equal(t, map[string]int64{"string": 1, "number": 1}, result.Error.Details.TypeReport.Types)
+
+		indexes, err := ts.Storage.GetIndexes("users")
+		require.NoError(t, err)
+		assert.NotContains(t, indexes, "zip")
+	})
+
+	t.Run("Report", func(t *testing.T) {
+		resp, err := ts.POST("/collections/users/indexes/zip?typeCheck=report", nil)
+		require.NoError(t, err)
+		body, err := ReadResponseBody(resp)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusCreated, resp.StatusCode)
+		assert.Contains(t, body, `"type_report"`)
+	})
+
+	t.Run("Bulk", func(t *testing.T) {
+		resp, err := ts.POST("/collections/users/indexes", map[string]interface{}{
+			"indexes": []map[string]interface{}{{"field": "age", "type_check": "reject"}},
+		})
+		require.NoError(t, err)
+		body, err := ReadResponseBody(resp)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusCreated, resp.StatusCode)
+
+		var result CreateIndexesResponse
+		require.NoError(t, json.Unmarshal([]byte(body), &result))
+		require.Len(t, result.Results, 1)
+		require.NotNil(t, result.Results[0].TypeReport)
+		assert.True(t, result.Results[0].TypeReport.Consistent)
+	})
+
+	t.Run("InvalidMode", func(t *testing.T) {
+		resp, err := ts.POST("/collections/users/indexes/age?typeCheck=strict", nil)
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	})
+}
+
 func TestAPI_Integration_Pagination(t *testing.T) {
 	ts := NewTestServer(t)
 	defer ts.Close(t)
@@ -778,6 +942,3932 @@ func TestAPI_Integration_Pagination(t *testing.T) {
 	})
 }
 
+func TestAPI_Integration_SignedCursors(t *testing.T) {
+	ts := NewTestServer(t)
+	defer ts.Close(t)
+	ts.Handler.ApplyOptions(WithCursorSecret([]byte("test-secret"), time.Hour))
+
+	for i := 0; i < 6; i++ {
+		resp, err := ts.POST("/collections/users", map[string]interface{}{"n": i})
+		require.NoError(t, err)
+		resp.Body.Close()
+	}
+
+	findPage := func(t *testing.T, query string) (int, domain.PaginationResult) {
+		resp, err := ts.GET("/collections/users/find?limit=2" + query)
+		require.NoError(t, err)
+		body, err := ReadResponseBody(resp)
+		require.NoError(t, err)
+		var result domain.PaginationResult
+		if resp.StatusCode == http.StatusOK {
+			require.NoError(t, json.Unmarshal([]byte(body), &result))
+		}
+		return resp.StatusCode, result
+	}
+
+	status, first := findPage(t, "")
+	require.Equal(t, http.StatusOK, status)
+	require.Contains(t, first.NextCursor, ".")
+
+	t.Run("Signed Cursor Accepted", func(t *testing.T) {
+		status, second := findPage(t, "&after="+url.QueryEscape(first.NextCursor))
+		assert.Equal(t, http.StatusOK, status)
+		require.Len(t, second.Documents, 2)
+		assert.Equal(t, "3", second.Documents[0]["_id"])
+	})
+
+	t.Run("Forged Cursor Rejected", func(t *testing.T) {
+		forged, err := domain.EncodeCursor(&domain.Cursor{ID: "5", Timestamp: time.Now()})
+		require.NoError(t, err)
+		signature := first.NextCursor[strings.LastIndex(first.NextCursor, "."):]
+
+		status, _ := findPage(t, "&after="+url.QueryEscape(forged))
+		assert.Equal(t, http.StatusBadRequest, status)
+		status, _ = findPage(t, "&after="+url.QueryEscape(forged+signature))
+		assert.Equal(t, http.StatusBadRequest, status)
+	})
+
+	t.Run("Expired Cursor Rejected", func(t *testing.T) {
+		ts.Handler.ApplyOptions(WithCursorSecret([]byte("test-secret"), time.Nanosecond))
+		defer ts.Handler.ApplyOptions(WithCursorSecret([]byte("test-secret"), time.Hour))
+
+		status, _ := findPage(t, "&after="+url.QueryEscape(first.NextCursor))
+		assert.Equal(t, http.StatusBadRequest, status)
+	})
+}
+
+func TestAPI_Integration_Sample(t *testing.T) {
+	ts := NewTestServer(t)
+	defer ts.Close(t)
+
+	for i := 0; i < 25; i++ {
+		resp, err := ts.POST("/collections/events", map[string]interface{}{"n": i})
+		require.NoError(t, err)
+		resp.Body.Close()
+	}
+
+	t.Run("Default Size", func(t *testing.T) {
+		resp, err := ts.GET("/collections/events/sample")
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		body, err := ReadResponseBody(resp)
+		require.NoError(t, err)
+
+		var result SampleResponse
+		require.NoError(t, json.Unmarshal([]byte(body), &result))
+		assert.Equal(t, 10, result.Count)
+		assert.Len(t, result.Documents, 10)
+	})
+
+	t.Run("Random With Seed", func(t *testing.T) {
+		resp, err := ts.GET("/collections/events/sample?size=3&seed=42")
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		body, err := ReadResponseBody(resp)
+		require.NoError(t, err)
+
+		var result SampleResponse
+		require.NoError(t, json.Unmarshal([]byte(body), &result))
+		assert.Equal(t, 3, result.Count)
+	})
+
+	t.Run("Invalid Size", func(t *testing.T) {
+		resp, err := ts.GET("/collections/events/sample?size=0")
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	})
+
+	t.Run("Missing Collection", func(t *testing.T) {
+		resp, err := ts.GET("/collections/missing/sample")
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	})
+}
+
+func TestAPI_Integration_FindIds(t *testing.T) {
+	ts := NewTestServer(t)
+	defer ts.Close(t)
+
+	for _, team := range []string{"core", "web", "core"} {
+		resp, err := ts.POST("/collections/users", map[string]interface{}{"team": team})
+		require.NoError(t, err)
+		resp.Body.Close()
+	}
+	resp, err := ts.POST("/collections/users/indexes/team", nil)
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	t.Run("Indexed Filter", func(t *testing.T) {
+		resp, err := ts.GET("/collections/users/ids?team=core")
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		body, err := ReadResponseBody(resp)
+		require.NoError(t, err)
+
+		var result FindIdsResponse
+		require.NoError(t, json.Unmarshal([]byte(body), &result))
+		assert.Equal(t, []string{"1", "3"}, result.Ids)
+		assert.Equal(t, 2, result.Count)
+	})
+
+	t.Run("No Matches", func(t *testing.T) {
+		resp, err := ts.GET("/collections/users/ids?team=ops")
+		require.NoError(t, err)
+		body, err := ReadResponseBody(resp)
+		require.NoError(t, err)
+		assert.Contains(t, body, `"ids":[]`)
+	})
+
+	t.Run("Invalid Filter", func(t *testing.T) {
+		resp, err := ts.GET("/collections/users/ids?%24expr=team%20%3D%3D")
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	})
+
+	t.Run("Missing Collection", func(t *testing.T) {
+		resp, err := ts.GET("/collections/missing/ids")
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	})
+}
+
+func TestAPI_Integration_MaxCollections(t *testing.T) {
+	ts := NewTestServer(t, storage.WithMaxCollections(1))
+	defer ts.Close(t)
+
+	resp, err := ts.POST("/collections/first", map[string]interface{}{"name": "Alice"})
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+
+	resp, err = ts.POST("/collections/second", map[string]interface{}{"name": "Bob"})
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+	resp, err = ts.POST("/collections/second/batch", map[string]interface{}{
+		"documents": []interface{}{map[string]interface{}{"name": "Bob"}},
+	})
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+	resp, err = ts.POST("/collections/first", map[string]interface{}{"name": "Carol"})
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+}
+
+func TestAPI_Integration_MaxResultSize(t *testing.T) {
+	ts := NewTestServer(t, storage.WithMaxResultSize(2))
+	defer ts.Close(t)
+
+	for _, name := range []string{"Alice", "Bob", "Carol"} {
+		resp, err := ts.POST("/collections/users", map[string]interface{}{"name": name})
+		require.NoError(t, err)
+		resp.Body.Close()
+	}
+
+	resp, err := ts.GET("/collections/users/find?limit=1")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusRequestEntityTooLarge, resp.StatusCode)
+
+	resp, err = ts.POST("/collections/users/query", map[string]interface{}{"limit": 1})
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusRequestEntityTooLarge, resp.StatusCode)
+
+	resp, err = ts.GET("/collections/users/find?name=Alice")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func TestAPI_Integration_CompareAndSet(t *testing.T) {
+	ts := NewTestServer(t)
+	defer ts.Close(t)
+
+	resp, err := ts.POST("/collections/jobs", map[string]interface{}{"status": "pending"})
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	cas := func(expected, value interface{}) CompareAndSetResponse {
+		resp, err := ts.POST("/collections/jobs/documents/1/cas", map[string]interface{}{
+			"field": "status", "expected": expected, "value": value,
+		})
+		require.NoError(t, err)
+		body, err := ReadResponseBody(resp)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, resp.StatusCode, body)
+
+		var result CompareAndSetResponse
+		require.NoError(t, json.Unmarshal([]byte(body), &result))
+		return result
+	}
+
+	result := cas("pending", "running")
+	assert.True(t, result.Applied)
+	assert.Equal(t, "running", result.Document["status"])
+
+	// A stale expected value leaves the document alone and returns its current state
+	result = cas("pending", "failed")
+	assert.False(t, result.Applied)
+	assert.Equal(t, "running", result.Document["status"])
+
+	resp, err = ts.POST("/collections/jobs/documents/1/cas", map[string]interface{}{"field": "_id", "expected": "1", "value": "2"})
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	resp, err = ts.POST("/collections/jobs/documents/99/cas", map[string]interface{}{"field": "status", "expected": "pending", "value": "running"})
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func TestAPI_Integration_GetAdjacentById(t *testing.T) {
+	ts := NewTestServer(t)
+	defer ts.Close(t)
+
+	for i := 1; i <= 11; i++ {
+		resp, err := ts.POST("/collections/items", map[string]interface{}{"n": i, "deleted": i == 10})
+		require.NoError(t, err)
+		resp.Body.Close()
+	}
+
+	adjacent := func(path string) (int, map[string]interface{}) {
+		resp, err := ts.GET(path)
+		require.NoError(t, err)
+		body, err := ReadResponseBody(resp)
+		require.NoError(t, err)
+		var doc map[string]interface{}
+		require.NoError(t, json.Unmarshal([]byte(body), &doc))
+		return resp.StatusCode, doc
+	}
+
+	status, doc := adjacent("/collections/items/documents/9/next")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "10", doc["_id"])
+
+	status, doc = adjacent("/collections/items/documents/10/prev")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "9", doc["_id"])
+
+	status, _ = adjacent("/collections/items/documents/11/next")
+	assert.Equal(t, http.StatusNotFound, status)
+	status, _ = adjacent("/collections/missing/documents/1/next")
+	assert.Equal(t, http.StatusNotFound, status)
+
+	t.Run("Skips Documents Hidden By Default Filter", func(t *testing.T) {
+		resp, err := ts.PUT("/collections/items/default_filter", map[string]interface{}{
+			"filter": map[string]interface{}{"$expr": "deleted != true"},
+		})
+		require.NoError(t, err)
+		resp.Body.Close()
+
+		status, doc := adjacent("/collections/items/documents/9/next")
+		assert.Equal(t, http.StatusOK, status)
+		assert.Equal(t, "11", doc["_id"])
+
+		status, doc = adjacent("/collections/items/documents/9/next?includeDeleted=true")
+		assert.Equal(t, http.StatusOK, status)
+		assert.Equal(t, "10", doc["_id"])
+	})
+}
+
+func TestAPI_Integration_Envelope(t *testing.T) {
+	ts := NewTestServer(t)
+	defer ts.Close(t)
+
+	for i := 1; i <= 5; i++ {
+		resp, err := ts.POST("/collections/users", map[string]interface{}{"n": i})
+		require.NoError(t, err)
+		resp.Body.Close()
+	}
+
+	bareArray := func(t *testing.T, resp *http.Response) []map[string]interface{} {
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		body, err := ReadResponseBody(resp)
+		require.NoError(t, err)
+		var documents []map[string]interface{}
+		require.NoError(t, json.Unmarshal([]byte(body), &documents))
+		return documents
+	}
+
+	t.Run("Find Without Envelope", func(t *testing.T) {
+		resp, err := ts.GET("/collections/users/find?limit=2&envelope=false")
+		require.NoError(t, err)
+		documents := bareArray(t, resp)
+		assert.Len(t, documents, 2)
+		assert.Equal(t, "5", resp.Header.Get(TotalCountHeader))
+		assert.Equal(t, "true", resp.Header.Get(HasNextHeader))
+		assert.Equal(t, "false", resp.Header.Get(HasPrevHeader))
+		assert.Equal(t, "1", resp.Header.Get(PageHeader))
+		assert.Equal(t, "3", resp.Header.Get(TotalPagesHeader))
+
+		nextCursor := resp.Header.Get(NextCursorHeader)
+		require.NotEmpty(t, nextCursor)
+		resp, err = ts.GET("/collections/users/find?limit=2&envelope=false&after=" + url.QueryEscape(nextCursor))
+		require.NoError(t, err)
+		documents = bareArray(t, resp)
+		require.Len(t, documents, 2)
+		assert.Equal(t, "3", documents[0]["_id"])
+		assert.Equal(t, "true", resp.Header.Get(HasPrevHeader))
+		assert.Empty(t, resp.Header.Get(PageHeader), "cursor pages have no page number")
+	})
+
+	t.Run("Page Numbers In Envelope", func(t *testing.T) {
+		resp, err := ts.GET("/collections/users/find?limit=2&offset=4")
+		require.NoError(t, err)
+		body, err := ReadResponseBody(resp)
+		require.NoError(t, err)
+		var result domain.PaginationResult
+		require.NoError(t, json.Unmarshal([]byte(body), &result))
+		assert.Equal(t, 3, result.Page)
+		assert.Equal(t, 3, result.TotalPages)
+	})
+
+	t.Run("Empty Result Is Empty Array", func(t *testing.T) {
+		resp, err := ts.GET("/collections/users/find?n=99&envelope=false")
+		require.NoError(t, err)
+		assert.Empty(t, bareArray(t, resp))
+		assert.Equal(t, "0", resp.Header.Get(TotalCountHeader))
+	})
+
+	t.Run("Query Without Envelope", func(t *testing.T) {
+		resp, err := ts.POST("/collections/users/query?envelope=false", map[string]interface{}{"limit": 1})
+		require.NoError(t, err)
+		assert.Len(t, bareArray(t, resp), 1)
+		assert.Equal(t, "true", resp.Header.Get(HasNextHeader))
+	})
+
+	t.Run("Invalid Envelope Value", func(t *testing.T) {
+		resp, err := ts.GET("/collections/users/find?envelope=maybe")
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	})
+
+	t.Run("Server Default", func(t *testing.T) {
+		resp, err := ts.GET("/collections/users/find")
+		require.NoError(t, err)
+		body, err := ReadResponseBody(resp)
+		require.NoError(t, err)
+		var result domain.PaginationResult
+		require.NoError(t, json.Unmarshal([]byte(body), &result))
+		assert.Len(t, result.Documents, 5)
+
+		ts.Handler.ApplyOptions(WithEnvelope(false))
+		defer ts.Handler.ApplyOptions(WithEnvelope(true))
+
+		resp, err = ts.GET("/collections/users/find")
+		require.NoError(t, err)
+		assert.Len(t, bareArray(t, resp), 5)
+
+		resp, err = ts.GET("/collections/users/find?envelope=true")
+		require.NoError(t, err)
+		body, err = ReadResponseBody(resp)
+		require.NoError(t, err)
+		require.NoError(t, json.Unmarshal([]byte(body), &result))
+		assert.Len(t, result.Documents, 5)
+	})
+
+	t.Run("Stream Metadata", func(t *testing.T) {
+		resp, err := ts.GET("/collections/users/find_with_stream")
+		require.NoError(t, err)
+		assert.Equal(t, "false", resp.Header.Get(HasNextHeader))
+		assert.Len(t, bareArray(t, resp), 5)
+		assert.Equal(t, "5", resp.Trailer.Get(TotalCountHeader))
+	})
+}
+
+func TestAPI_Integration_CollectionSchema(t *testing.T) {
+	ts := NewTestServer(t)
+	defer ts.Close(t)
+
+	for _, at := range []string{"2024-01-01T09:59:59.9Z", "2024-01-01T12:30:00+02:00", "2024-01-01T11:00:00Z"} {
+		resp, err := ts.POST("/collections/events", map[string]interface{}{"at": at})
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	}
+
+	queryAt := func(t *testing.T, filter map[string]interface{}) []interface{} {
+		resp, err := ts.POST("/collections/events/query", map[string]interface{}{"filter": filter})
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+		body, err := ReadResponseBody(resp)
+		require.NoError(t, err)
+
+		var result map[string]interface{}
+		require.NoError(t, json.Unmarshal([]byte(body), &result))
+		var values []interface{}
+		for _, doc := range result["documents"].([]interface{}) {
+			values = append(values, doc.(map[string]interface{})["at"])
+		}
+		return values
+	}
+
+	t.Run("Set Schema", func(t *testing.T) {
+		resp, err := ts.PUT("/collections/events/schema", map[string]interface{}{
+			"fields": map[string]interface{}{"at": "time"},
+		})
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	})
+
+	t.Run("Range Compares As Time", func(t *testing.T) {
+		values := queryAt(t, map[string]interface{}{
+			"at": map[string]interface{}{"$gte": "2024-01-01T10:00:00Z", "$lt": "2024-01-01T11:00:00Z"},
+		})
+		assert.Equal(t, []interface{}{"2024-01-01T12:30:00+02:00"}, values)
+	})
+
+	t.Run("Equality Across Offsets", func(t *testing.T) {
+		values := queryAt(t, map[string]interface{}{"at": "2024-01-01T10:30:00Z"})
+		assert.Equal(t, []interface{}{"2024-01-01T12:30:00+02:00"}, values)
+	})
+
+	t.Run("Get Schema", func(t *testing.T) {
+		resp, err := ts.GET("/collections/events/schema")
+		require.NoError(t, err)
+
+		body, err := ReadResponseBody(resp)
+		require.NoError(t, err)
+
+		var result map[string]interface{}
+		require.NoError(t, json.Unmarshal([]byte(body), &result))
+		assert.Equal(t, map[string]interface{}{"at": "time"}, result["fields"])
+	})
+
+	t.Run("Reject Unknown Type", func(t *testing.T) {
+		resp, err := ts.PUT("/collections/events/schema", map[string]interface{}{
+			"fields": map[string]interface{}{"at": "date"},
+		})
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	})
+
+	t.Run("Reject Invalid Range", func(t *testing.T) {
+		resp, err := ts.POST("/collections/events/query", map[string]interface{}{
+			"filter": map[string]interface{}{"at": map[string]interface{}{"$gt": true}},
+		})
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	})
+
+	t.Run("Delete Schema", func(t *testing.T) {
+		resp, err := ts.DELETE("/collections/events/schema")
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+
+		assert.Empty(t, queryAt(t, map[string]interface{}{"at": "2024-01-01T10:30:00Z"}))
+	})
+}
+
+func TestAPI_Integration_StrictSchema(t *testing.T) {
+	ts := NewTestServer(t)
+	defer ts.Close(t)
+
+	resp, err := ts.PUT("/collections/users/schema", map[string]interface{}{
+		"fields": map[string]interface{}{"name": "any", "joined": "time"},
+		"strict": true,
+	})
+	require.NoError(t, err)
+	body, err := ReadResponseBody(resp)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	var schema map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(body), &schema))
+	assert.Equal(t, true, schema["strict"])
+
+	resp, err = ts.POST("/collections/users", map[string]interface{}{"name": "Alice"})
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+
+	resp, err = ts.POST("/collections/users", map[string]interface{}{"naem": "Bob", "name": "Bob"})
+	require.NoError(t, err)
+	body, err = ReadResponseBody(resp)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	var errResp ErrorResponse
+	require.NoError(t, json.Unmarshal([]byte(body), &errResp))
+	assert.Equal(t, ErrCodeFieldNotInSchema, errResp.Error.Code)
+	assert.Equal(t, "field not in schema: naem", errResp.Error.Message)
+
+	resp, err = ts.PATCH("/collections/users/documents/1", map[string]interface{}{"joinde": "2024-01-01T00:00:00Z"})
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	// Removing the schema turns strict mode off
+	resp, err = ts.DELETE("/collections/users/schema")
+	require.NoError(t, err)
+	resp.Body.Close()
+	resp, err = ts.GET("/collections/users/schema")
+	require.NoError(t, err)
+	body, err = ReadResponseBody(resp)
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal([]byte(body), &schema))
+	assert.Equal(t, false, schema["strict"])
+}
+
+func TestAPI_Integration_Changes(t *testing.T) {
+	ts := NewTestServer(t)
+	defer ts.Close(t)
+
+	resp, err := ts.GET("/collections/orders/changes")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	for _, status := range []string{"new", "paid"} {
+		resp, err = ts.POST("/collections/orders", map[string]interface{}{"status": status})
+		require.NoError(t, err)
+		resp.Body.Close()
+	}
+	resp, err = ts.DELETE("/collections/orders/documents/1")
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	poll := func(query string) ChangesResponse {
+		resp, err := ts.GET("/collections/orders/changes" + query)
+		require.NoError(t, err)
+		body, err := ReadResponseBody(resp)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, resp.StatusCode, body)
+		var changes ChangesResponse
+		require.NoError(t, json.Unmarshal([]byte(body), &changes))
+		return changes
+	}
+
+	changes := poll("?limit=2")
+	require.Len(t, changes.Changes, 2)
+	assert.Equal(t, domain.ChangeInsert, changes.Changes[0].Op)
+	assert.Equal(t, "new", changes.Changes[0].Document["status"])
+	assert.Equal(t, int64(2), changes.NextOffset)
+	assert.True(t, changes.HasMore)
+
+	changes = poll("?since=2")
+	require.Len(t, changes.Changes, 1)
+	assert.Equal(t, domain.ChangeDelete, changes.Changes[0].Op)
+	assert.Equal(t, "1", changes.Changes[0].DocID)
+	assert.Nil(t, changes.Changes[0].Document)
+	assert.False(t, changes.HasMore)
+
+	// Long-polling with nothing new returns no changes once the wait elapses
+	changes = poll("?since=3&wait=10ms")
+	assert.Empty(t, changes.Changes)
+	assert.Equal(t, int64(3), changes.NextOffset)
+
+	for _, query := range []string{"?since=-1", "?limit=0", "?limit=5000", "?wait=forever", "?wait=2h"} {
+		resp, err = ts.GET("/collections/orders/changes" + query)
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode, query)
+	}
+}
+
+func TestAPI_Integration_AdminMemory(t *testing.T) {
+	ts := NewTestServer(t)
+	defer ts.Close(t)
+
+	resp, err := ts.POST("/collections/users", map[string]interface{}{"name": "Alice"})
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	adminRequest := func(t *testing.T, method, path, token string, body interface{}) *http.Response {
+		var reader io.Reader
+		if body != nil {
+			jsonData, err := json.Marshal(body)
+			require.NoError(t, err)
+			reader = bytes.NewReader(jsonData)
+		}
+		req, err := http.NewRequest(method, ts.BaseURL+path, reader)
+		require.NoError(t, err)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		return resp
+	}
+
+	t.Run("Disabled Without Token", func(t *testing.T) {
+		resp := adminRequest(t, http.MethodGet, "/admin/memory", "anything", nil)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	})
+
+	ts.Handler.ApplyOptions(WithAdminToken("s3cret"))
+
+	t.Run("Rejects Missing Or Wrong Token", func(t *testing.T) {
+		for _, token := range []string{"", "wrong"} {
+			resp := adminRequest(t, http.MethodPost, "/admin/memory/gc", token, nil)
+			resp.Body.Close()
+			assert.Equal(t, http.StatusUnauthorized, resp.StatusCode, "token %q", token)
+			assert.Contains(t, resp.Header.Get("WWW-Authenticate"), "Bearer")
+		}
+	})
+
+	t.Run("Get Memory", func(t *testing.T) {
+		resp := adminRequest(t, http.MethodGet, "/admin/memory", "s3cret", nil)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+		body, err := ReadResponseBody(resp)
+		require.NoError(t, err)
+
+		var result struct {
+			Stats       map[string]interface{}         `json:"stats"`
+			Collections []domain.CollectionMemoryUsage `json:"collections"`
+		}
+		require.NoError(t, json.Unmarshal([]byte(body), &result))
+		assert.Contains(t, result.Stats, "alloc_mb")
+		require.Len(t, result.Collections, 1)
+		assert.Equal(t, "users", result.Collections[0].Name)
+		assert.True(t, result.Collections[0].Resident)
+		assert.Greater(t, result.Collections[0].EstimatedBytes, int64(0))
+	})
+
+	t.Run("Run GC", func(t *testing.T) {
+		resp := adminRequest(t, http.MethodPost, "/admin/memory/gc", "s3cret", nil)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+		body, err := ReadResponseBody(resp)
+		require.NoError(t, err)
+
+		var result map[string]interface{}
+		require.NoError(t, json.Unmarshal([]byte(body), &result))
+		assert.Contains(t, result, "freed_bytes")
+		assert.Contains(t, result, "heap_after_bytes")
+	})
+
+	t.Run("Set Limit", func(t *testing.T) {
+		resp := adminRequest(t, http.MethodPost, "/admin/memory/limit", "s3cret", map[string]interface{}{"max_memory_mb": 0})
+		resp.Body.Close()
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+		resp = adminRequest(t, http.MethodPost, "/admin/memory/limit", "s3cret", map[string]interface{}{"max_memory_mb": 256})
+		resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+		resp = adminRequest(t, http.MethodGet, "/admin/memory", "s3cret", nil)
+		body, err := ReadResponseBody(resp)
+		require.NoError(t, err)
+
+		var result struct {
+			Stats map[string]interface{} `json:"stats"`
+		}
+		require.NoError(t, json.Unmarshal([]byte(body), &result))
+		assert.Equal(t, float64(256), result.Stats["max_memory_mb"])
+	})
+}
+
+func TestAPI_Integration_AdminCheckpoint(t *testing.T) {
+	ts := NewTestServer(t, storage.WithNoSaves(true))
+	defer ts.Close(t)
+	ts.Handler.ApplyOptions(WithAdminToken("s3cret"))
+
+	resp, err := ts.POST("/collections/events", map[string]interface{}{"kind": "click"})
+	require.NoError(t, err)
+	resp.Body.Close()
+	fileName := filepath.Join(ts.TempDir, "collections", "events.godb")
+	assert.NoFileExists(t, fileName)
+
+	checkpoint := func(t *testing.T, token string) *http.Response {
+		req, err := http.NewRequest(http.MethodPost, ts.BaseURL+"/admin/checkpoint", nil)
+		require.NoError(t, err)
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		return resp
+	}
+
+	resp = checkpoint(t, "wrong")
+	resp.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	resp = checkpoint(t, "s3cret")
+	body, err := ReadResponseBody(resp)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode, body)
+
+	var result map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(body), &result))
+	assert.Equal(t, true, result["success"])
+	assert.Equal(t, true, result["no_saves"])
+	assert.FileExists(t, fileName)
+}
+
+func TestAPI_Integration_AdminPinCollection(t *testing.T) {
+	ts := NewTestServer(t)
+	defer ts.Close(t)
+	ts.Handler.ApplyOptions(WithAdminToken("s3cret"))
+
+	pin := func(t *testing.T, method, token string) *http.Response {
+		req, err := http.NewRequest(method, ts.BaseURL+"/admin/collections/countries/pin", nil)
+		require.NoError(t, err)
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		return resp
+	}
+
+	resp := pin(t, http.MethodPost, "wrong")
+	resp.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	assert.False(t, ts.Storage.IsCollectionPinned("countries"))
+
+	resp = pin(t, http.MethodPost, "s3cret")
+	body, err := ReadResponseBody(resp)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode, body)
+	var result map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(body), &result))
+	assert.Equal(t, true, result["pinned"])
+	assert.Equal(t, "countries", result["collection"])
+	assert.True(t, ts.Storage.IsCollectionPinned("countries"))
+
+	resp = pin(t, http.MethodDelete, "s3cret")
+	body, err = ReadResponseBody(resp)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode, body)
+	assert.Contains(t, body, `"pinned":false`)
+	assert.False(t, ts.Storage.IsCollectionPinned("countries"))
+}
+
+func TestAPI_Integration_AdminLocks(t *testing.T) {
+	ts := NewTestServer(t)
+	defer ts.Close(t)
+	ts.Handler.ApplyOptions(WithAdminToken("s3cret"))
+
+	resp, err := ts.POST("/collections/events", map[string]interface{}{"kind": "click"})
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	getLocks := func(t *testing.T, token string) *http.Response {
+		req, err := http.NewRequest(http.MethodGet, ts.BaseURL+"/admin/locks", nil)
+		require.NoError(t, err)
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		return resp
+	}
+
+	resp = getLocks(t, "wrong")
+	resp.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	resp = getLocks(t, "s3cret")
+	body, err := ReadResponseBody(resp)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode, body)
+
+	var result struct {
+		Success     bool                         `json:"success"`
+		Collections []domain.CollectionLockStats `json:"collections"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(body), &result))
+	assert.True(t, result.Success)
+	assert.Contains(t, result.Collections, domain.CollectionLockStats{Name: "events"})
+}
+
+func TestAPI_Integration_DumpIndex(t *testing.T) {
+	ts := NewTestServer(t)
+	defer ts.Close(t)
+
+	for _, name := range []string{"Alice", "Bob", "Carol"} {
+		resp, err := ts.POST("/collections/users", map[string]interface{}{"name": name, "team": "core"})
+		require.NoError(t, err)
+		resp.Body.Close()
+	}
+	resp, err := ts.POST("/collections/users/indexes/name", nil)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+
+	dump := func(t *testing.T, query, token string) *http.Response {
+		req, err := http.NewRequest(http.MethodGet, ts.BaseURL+"/collections/users/indexes/name/dump"+query, nil)
+		require.NoError(t, err)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		return resp
+	}
+
+	resp = dump(t, "", "")
+	resp.Body.Close()
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode, "dumps are disabled without an admin token")
+
+	ts.Handler.ApplyOptions(WithAdminToken("s3cret"))
+	resp = dump(t, "", "wrong")
+	resp.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	resp = dump(t, "?limit=2", "s3cret")
+	body, err := ReadResponseBody(resp)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode, body)
+
+	var result IndexDumpResponse
+	require.NoError(t, json.Unmarshal([]byte(body), &result))
+	assert.Equal(t, "name", result.Field)
+	assert.Equal(t, 3, result.TotalKeys)
+	require.Len(t, result.Entries, 2)
+	assert.Equal(t, "Alice", result.Entries[0].Key)
+	assert.Equal(t, []string{"1"}, result.Entries[0].IDs)
+	assert.True(t, result.Truncated)
+	assert.NotEmpty(t, result.Warning)
+
+	resp = dump(t, fmt.Sprintf("?offset=%d", result.NextOffset), "s3cret")
+	body, err = ReadResponseBody(resp)
+	require.NoError(t, err)
+	result = IndexDumpResponse{}
+	require.NoError(t, json.Unmarshal([]byte(body), &result))
+	require.Len(t, result.Entries, 1)
+	assert.Equal(t, "Carol", result.Entries[0].Key)
+	assert.False(t, result.Truncated)
+	assert.Empty(t, result.Warning)
+
+	for query, status := range map[string]int{"?limit=0": http.StatusBadRequest, "?offset=-1": http.StatusBadRequest} {
+		resp = dump(t, query, "s3cret")
+		resp.Body.Close()
+		assert.Equal(t, status, resp.StatusCode, query)
+	}
+
+	req, err := http.NewRequest(http.MethodGet, ts.BaseURL+"/collections/users/indexes/team/dump", nil)
+	require.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer s3cret")
+	resp, err = http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func TestAPI_Integration_InsertUnlessExists(t *testing.T) {
+	ts := NewTestServer(t)
+	defer ts.Close(t)
+
+	unlessExists := "/collections/users?" + UnlessExistsParam + "=" + url.QueryEscape(`{"email":"alice@example.com"}`)
+
+	t.Run("Creates When Nothing Matches", func(t *testing.T) {
+		resp, err := ts.POST(unlessExists, map[string]interface{}{"email": "alice@example.com", "name": "Alice"})
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusCreated, resp.StatusCode)
+
+		body, err := ReadResponseBody(resp)
+		require.NoError(t, err)
+
+		var doc map[string]interface{}
+		require.NoError(t, json.Unmarshal([]byte(body), &doc))
+		assert.Equal(t, "1", doc["_id"])
+	})
+
+	t.Run("Returns Existing Match", func(t *testing.T) {
+		resp, err := ts.POST(unlessExists, map[string]interface{}{"email": "alice@example.com", "name": "Duplicate"})
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+		body, err := ReadResponseBody(resp)
+		require.NoError(t, err)
+
+		var doc map[string]interface{}
+		require.NoError(t, json.Unmarshal([]byte(body), &doc))
+		assert.Equal(t, "1", doc["_id"])
+		assert.Equal(t, "Alice", doc["name"])
+
+		resp, err = ts.GET("/collections/users/ids")
+		require.NoError(t, err)
+		body, err = ReadResponseBody(resp)
+		require.NoError(t, err)
+		assert.Contains(t, body, `"count":1`)
+	})
+
+	t.Run("Invalid Filter", func(t *testing.T) {
+		for _, filter := range []string{"not-json", "null", `{"age":{"$gt":true}}`} {
+			resp, err := ts.POST("/collections/users?"+UnlessExistsParam+"="+url.QueryEscape(filter), map[string]interface{}{"name": "X"})
+			require.NoError(t, err)
+			resp.Body.Close()
+			assert.Equal(t, http.StatusBadRequest, resp.StatusCode, "filter %s", filter)
+		}
+	})
+}
+
+func TestAPI_Integration_ErrorCodes(t *testing.T) {
+	ts := NewTestServer(t)
+	defer ts.Close(t)
+
+	resp, err := ts.POST("/collections/users", map[string]interface{}{"name": "Alice"})
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	readError := func(resp *http.Response) ErrorDetail {
+		defer resp.Body.Close()
+		assert.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+		var body map[string]json.RawMessage
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+		require.Len(t, body, 1, "the error is the only top-level field")
+		var detail ErrorDetail
+		require.NoError(t, json.Unmarshal(body["error"], &detail))
+		assert.NotEmpty(t, detail.Message)
+		assert.NotNil(t, detail.Details, "details is always an object")
+		return detail
+	}
+
+	tests := []struct {
+		name   string
+		do     func() (*http.Response, error)
+		status int
+		code   string
+	}{
+		{"Document Not Found", func() (*http.Response, error) { return ts.GET("/collections/users/documents/999") }, http.StatusNotFound, ErrCodeDocumentNotFound},
+		{"Collection Not Found", func() (*http.Response, error) { return ts.GET("/collections/missing/find") }, http.StatusNotFound, ErrCodeCollectionNotFound},
+		{"Invalid Filter", func() (*http.Response, error) {
+			return ts.POST("/collections/users/query", map[string]interface{}{"filter": map[string]interface{}{"$expr": "name =="}})
+		}, http.StatusBadRequest, ErrCodeInvalidFilter},
+		{"Invalid Body", func() (*http.Response, error) { return ts.POST("/collections/users", "not an object") }, http.StatusBadRequest, ErrCodeInvalidRequest},
+		{"Validation", func() (*http.Response, error) {
+			return ts.PATCH("/collections/users/batch", BatchUpdateRequest{})
+		}, http.StatusBadRequest, ErrCodeValidationFailed},
+		{"Collection Exists", func() (*http.Response, error) { return ts.PUT("/collections/users", nil) }, http.StatusConflict, ErrCodeCollectionExists},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := tt.do()
+			require.NoError(t, err)
+			assert.Equal(t, tt.status, resp.StatusCode)
+			assert.Equal(t, tt.code, readError(resp).Code)
+		})
+	}
+}
+
+func TestAPI_Integration_Ready(t *testing.T) {
+	readReady := func(ts *TestServer) (int, ReadyResponse) {
+		resp, err := ts.GET("/ready")
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		var ready ReadyResponse
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&ready))
+		return resp.StatusCode, ready
+	}
+
+	t.Run("Without Preload", func(t *testing.T) {
+		ts := NewTestServer(t)
+		defer ts.Close(t)
+
+		status, ready := readReady(ts)
+		assert.Equal(t, http.StatusOK, status)
+		assert.Equal(t, "ready", ready.Status)
+	})
+
+	t.Run("Preload", func(t *testing.T) {
+		ts := NewTestServer(t, storage.WithPreloadCollections([]string{"users", "orders"}))
+		defer ts.Close(t)
+
+		resp, err := ts.POST("/collections/users", map[string]interface{}{"name": "Alice"})
+		require.NoError(t, err)
+		resp.Body.Close()
+
+		status, ready := readReady(ts)
+		assert.Equal(t, http.StatusServiceUnavailable, status)
+		assert.Equal(t, "loading", ready.Status)
+		assert.Equal(t, 2, ready.Preload.Total)
+
+		// /health does not wait for the preload
+		resp, err = ts.GET("/health")
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+		assert.Error(t, ts.Storage.PreloadCollections(), "orders does not exist")
+
+		status, ready = readReady(ts)
+		assert.Equal(t, http.StatusOK, status)
+		assert.Equal(t, "ready", ready.Status)
+		assert.Equal(t, 1, ready.Preload.Loaded)
+		assert.Equal(t, 1, ready.Preload.Failed)
+		assert.Contains(t, ready.Preload.Errors, "orders")
+	})
+}
+
+func TestAPI_Integration_DeleteReturning(t *testing.T) {
+	ts := NewTestServer(t)
+	defer ts.Close(t)
+
+	for _, name := range []string{"Alice", "Bob"} {
+		resp, err := ts.POST("/collections/users", map[string]interface{}{"name": name})
+		require.NoError(t, err)
+		resp.Body.Close()
+	}
+
+	resp, err := ts.DELETE("/collections/users/documents/1?return=true")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	var deleted map[string]interface{}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&deleted))
+	resp.Body.Close()
+	assert.Equal(t, map[string]interface{}{"_id": "1", "name": "Alice"}, deleted)
+
+	resp, err = ts.GET("/collections/users/documents/1")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	resp, err = ts.DELETE("/collections/users/documents/1?return=true")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	resp, err = ts.DELETE("/collections/users/documents/2?return=maybe")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	resp, err = ts.DELETE("/collections/users/documents/2")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+}
+
+func TestAPI_Integration_CopyCollection(t *testing.T) {
+	ts := NewTestServer(t)
+	defer ts.Close(t)
+
+	resp, err := ts.POST("/collections/users", map[string]interface{}{"name": "Alice", "city": "Paris"})
+	require.NoError(t, err)
+	resp.Body.Close()
+	resp, err = ts.POST("/collections/users/indexes/city", nil)
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	t.Run("Copy", func(t *testing.T) {
+		resp, err := ts.POST("/collections/users/copy", map[string]interface{}{"dest": "users_v2"})
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusCreated, resp.StatusCode)
+
+		resp, err = ts.GET("/collections/users_v2/documents/1")
+		require.NoError(t, err)
+		body, err := ReadResponseBody(resp)
+		require.NoError(t, err)
+
+		var doc map[string]interface{}
+		require.NoError(t, json.Unmarshal([]byte(body), &doc))
+		assert.Equal(t, "Alice", doc["name"])
+
+		resp, err = ts.GET("/collections/users_v2/indexes")
+		require.NoError(t, err)
+		body, err = ReadResponseBody(resp)
+		require.NoError(t, err)
+		assert.Contains(t, body, "city")
+	})
+
+	t.Run("Destination Exists", func(t *testing.T) {
+		resp, err := ts.POST("/collections/users/copy", map[string]interface{}{"dest": "users_v2"})
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusConflict, resp.StatusCode)
+	})
+
+	t.Run("Missing Source", func(t *testing.T) {
+		resp, err := ts.POST("/collections/missing/copy", map[string]interface{}{"dest": "missing_copy"})
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	})
+
+	t.Run("Missing Dest", func(t *testing.T) {
+		resp, err := ts.POST("/collections/users/copy", map[string]interface{}{})
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	})
+}
+
+func TestAPI_Integration_UpdateMany(t *testing.T) {
+	ts := NewTestServer(t)
+	defer ts.Close(t)
+
+	for _, city := range []string{"Paris", "Berlin", "Paris"} {
+		resp, err := ts.POST("/collections/users", map[string]interface{}{"city": city, "active": true})
+		require.NoError(t, err)
+		resp.Body.Close()
+	}
+
+	t.Run("Update", func(t *testing.T) {
+		resp, err := ts.PATCH("/collections/users/documents", map[string]interface{}{
+			"filter": map[string]interface{}{"city": "Paris"},
+			"update": map[string]interface{}{"active": false},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		body, err := ReadResponseBody(resp)
+		require.NoError(t, err)
+
+		var result map[string]interface{}
+		require.NoError(t, json.Unmarshal([]byte(body), &result))
+		assert.EqualValues(t, 2, result["modified"])
+
+		resp, err = ts.GET("/collections/users/documents/3")
+		require.NoError(t, err)
+		body, err = ReadResponseBody(resp)
+		require.NoError(t, err)
+		var doc map[string]interface{}
+		require.NoError(t, json.Unmarshal([]byte(body), &doc))
+		assert.Equal(t, false, doc["active"])
+	})
+
+	t.Run("Missing Filter", func(t *testing.T) {
+		resp, err := ts.PATCH("/collections/users/documents", map[string]interface{}{"update": map[string]interface{}{"active": false}})
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	})
+
+	t.Run("Missing Collection", func(t *testing.T) {
+		resp, err := ts.PATCH("/collections/missing/documents", map[string]interface{}{
+			"filter": map[string]interface{}{},
+			"update": map[string]interface{}{"active": false},
+		})
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	})
+}
+
+func TestAPI_Integration_UpsertById(t *testing.T) {
+	ts := NewTestServer(t)
+	defer ts.Close(t)
+
+	t.Run("Create", func(t *testing.T) {
+		resp, err := ts.PATCH("/collections/users/documents/7?"+UpsertParam+"=true", map[string]interface{}{"name": "Alice"})
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusCreated, resp.StatusCode)
+		assert.Equal(t, "/collections/users/documents/7", resp.Header.Get("Location"))
+		body, err := ReadResponseBody(resp)
+		require.NoError(t, err)
+
+		var doc map[string]interface{}
+		require.NoError(t, json.Unmarshal([]byte(body), &doc))
+		assert.Equal(t, "7", doc["_id"])
+		assert.Equal(t, "Alice", doc["name"])
+
+		// Generated IDs continue after the upserted one
+		resp, err = ts.POST("/collections/users", map[string]interface{}{"name": "Bob"})
+		require.NoError(t, err)
+		assert.Equal(t, "/collections/users/documents/8", resp.Header.Get("Location"))
+		resp.Body.Close()
+	})
+
+	t.Run("Update", func(t *testing.T) {
+		resp, err := ts.PATCH("/collections/users/documents/7?"+UpsertParam+"=true", map[string]interface{}{"age": 30})
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		body, err := ReadResponseBody(resp)
+		require.NoError(t, err)
+
+		var doc map[string]interface{}
+		require.NoError(t, json.Unmarshal([]byte(body), &doc))
+		assert.Equal(t, "Alice", doc["name"])
+		assert.EqualValues(t, 30, doc["age"])
+	})
+
+	t.Run("Without Upsert", func(t *testing.T) {
+		resp, err := ts.PATCH("/collections/users/documents/99", map[string]interface{}{"name": "Carol"})
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	})
+
+	t.Run("Invalid Parameter", func(t *testing.T) {
+		resp, err := ts.PATCH("/collections/users/documents/99?"+UpsertParam+"=maybe", map[string]interface{}{"name": "Carol"})
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	})
+}
+
+func TestAPI_Integration_IfMatchVersion(t *testing.T) {
+	ts := NewTestServer(t, storage.WithDocumentVersions(true))
+	defer ts.Close(t)
+
+	resp, err := ts.POST("/collections/users", map[string]interface{}{"name": "Alice"})
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	patch := func(t *testing.T, ifMatch string, body map[string]interface{}) (int, map[string]interface{}) {
+		jsonData, err := json.Marshal(body)
+		require.NoError(t, err)
+		req, err := http.NewRequest("PATCH", ts.BaseURL+"/collections/users/documents/1", bytes.NewBuffer(jsonData))
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("If-Match", ifMatch)
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		raw, err := ReadResponseBody(resp)
+		require.NoError(t, err)
+		var doc map[string]interface{}
+		require.NoError(t, json.Unmarshal([]byte(raw), &doc))
+		return resp.StatusCode, doc
+	}
+
+	status, doc := patch(t, `"1"`, map[string]interface{}{"age": 30})
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, float64(2), doc["_version"])
+
+	status, doc = patch(t, "2", map[string]interface{}{"age": 31})
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, float64(3), doc["_version"])
+
+	// A client that read an older version is refused
+	status, doc = patch(t, "2", map[string]interface{}{"age": 99})
+	assert.Equal(t, http.StatusPreconditionFailed, status)
+	assert.Equal(t, ErrCodeVersionConflict, doc["error"].(map[string]interface{})["code"])
+
+	status, _ = patch(t, "*", map[string]interface{}{"age": 32})
+	assert.Equal(t, http.StatusOK, status)
+
+	// GET and HEAD send the version as an ETag, which If-Match takes back, weak or not
+	resp, err = ts.GET("/collections/users/documents/1")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, `"4"`, resp.Header.Get("ETag"))
+	resp, err = http.Head(ts.BaseURL + "/collections/users/documents/1")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, `"4"`, resp.Header.Get("ETag"))
+	resp, err = http.Head(ts.BaseURL + "/collections/users/documents/9")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	status, doc = patch(t, `W/"4"`, map[string]interface{}{"age": 33})
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, float64(5), doc["_version"])
+
+	status, _ = patch(t, "latest", map[string]interface{}{"age": 33})
+	assert.Equal(t, http.StatusBadRequest, status)
+
+	// Without versions the precondition cannot be checked
+	plain := NewTestServer(t)
+	defer plain.Close(t)
+	resp, err = plain.POST("/collections/users", map[string]interface{}{"name": "Alice"})
+	require.NoError(t, err)
+	resp.Body.Close()
+	resp, err = plain.GET("/collections/users/documents/1")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Empty(t, resp.Header.Get("ETag"))
+	req, err := http.NewRequest("PATCH", plain.BaseURL+"/collections/users/documents/1", strings.NewReader(`{"age": 30}`))
+	require.NoError(t, err)
+	req.Header.Set("If-Match", "1")
+	resp, err = http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotImplemented, resp.StatusCode)
+}
+
+func TestAPI_Integration_ListCollections(t *testing.T) {
+	ts := NewTestServer(t)
+	defer ts.Close(t)
+
+	for _, collName := range []string{"users", "orders", "users"} {
+		resp, err := ts.POST("/collections/"+collName, map[string]interface{}{"name": "Alice"})
+		require.NoError(t, err)
+		resp.Body.Close()
+	}
+
+	resp, err := ts.GET("/collections")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	body, err := ReadResponseBody(resp)
+	require.NoError(t, err)
+
+	var result struct {
+		Collections []domain.CollectionInfoSummary `json:"collections"`
+		Count       int                            `json:"count"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(body), &result))
+	assert.Equal(t, 2, result.Count)
+	require.Len(t, result.Collections, 2)
+	assert.Equal(t, "orders", result.Collections[0].Name)
+	assert.Equal(t, "users", result.Collections[1].Name)
+	assert.EqualValues(t, 2, result.Collections[1].DocumentCount)
+	assert.NotEmpty(t, result.Collections[1].State)
+}
+
+func TestAPI_Integration_DropCollection(t *testing.T) {
+	ts := NewTestServer(t)
+	defer ts.Close(t)
+
+	resp, err := ts.POST("/collections/users", map[string]interface{}{"name": "Alice"})
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	t.Run("Drop", func(t *testing.T) {
+		resp, err := ts.DELETE("/collections/users")
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+
+		resp, err = ts.GET("/collections/users/documents/1")
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	})
+
+	t.Run("Missing Collection", func(t *testing.T) {
+		resp, err := ts.DELETE("/collections/users")
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	})
+}
+
+func TestAPI_Integration_CollectionDefaults(t *testing.T) {
+	ts := NewTestServer(t)
+	defer ts.Close(t)
+
+	t.Run("Set Defaults", func(t *testing.T) {
+		resp, err := ts.PUT("/collections/orders/defaults", map[string]interface{}{
+			"defaults": map[string]interface{}{"status": "new", "created_at": "$$NOW"},
+		})
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	})
+
+	t.Run("Insert Applies Defaults", func(t *testing.T) {
+		resp, err := ts.POST("/collections/orders", map[string]interface{}{"item": "pen"})
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusCreated, resp.StatusCode)
+
+		body, err := ReadResponseBody(resp)
+		require.NoError(t, err)
+
+		var doc map[string]interface{}
+		require.NoError(t, json.Unmarshal([]byte(body), &doc))
+		assert.Equal(t, "new", doc["status"])
+		assert.NotEmpty(t, doc["created_at"])
+	})
+
+	t.Run("Client Values Win", func(t *testing.T) {
+		resp, err := ts.POST("/collections/orders", map[string]interface{}{"item": "desk", "status": "shipped"})
+		require.NoError(t, err)
+
+		body, err := ReadResponseBody(resp)
+		require.NoError(t, err)
+
+		var doc map[string]interface{}
+		require.NoError(t, json.Unmarshal([]byte(body), &doc))
+		assert.Equal(t, "shipped", doc["status"])
+	})
+
+	t.Run("Get Defaults", func(t *testing.T) {
+		resp, err := ts.GET("/collections/orders/defaults")
+		require.NoError(t, err)
+
+		body, err := ReadResponseBody(resp)
+		require.NoError(t, err)
+
+		var result map[string]interface{}
+		require.NoError(t, json.Unmarshal([]byte(body), &result))
+		assert.Equal(t, "new", result["defaults"].(map[string]interface{})["status"])
+	})
+
+	t.Run("Reject _id Default", func(t *testing.T) {
+		resp, err := ts.PUT("/collections/orders/defaults", map[string]interface{}{
+			"defaults": map[string]interface{}{"_id": "fixed"},
+		})
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	})
+
+	t.Run("Delete Defaults", func(t *testing.T) {
+		resp, err := ts.DELETE("/collections/orders/defaults")
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+	})
+}
+
+func TestAPI_Integration_CappedCollection(t *testing.T) {
+	ts := NewTestServer(t)
+	defer ts.Close(t)
+
+	t.Run("Create Capped", func(t *testing.T) {
+		resp, err := ts.PUT("/collections/events", map[string]interface{}{
+			"capped": map[string]interface{}{"max_docs": 2, "policy": "fifo"},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusCreated, resp.StatusCode)
+
+		body, err := ReadResponseBody(resp)
+		require.NoError(t, err)
+		assert.Contains(t, body, `"max_docs":2`)
+	})
+
+	t.Run("Create Existing", func(t *testing.T) {
+		resp, err := ts.PUT("/collections/events", nil)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusConflict, resp.StatusCode)
+	})
+
+	t.Run("Invalid Policy", func(t *testing.T) {
+		resp, err := ts.PUT("/collections/other", map[string]interface{}{
+			"capped": map[string]interface{}{"max_docs": 2, "policy": "newest"},
+		})
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	})
+
+	t.Run("Inserts Evict Oldest", func(t *testing.T) {
+		for i := 1; i <= 3; i++ {
+			resp, err := ts.POST("/collections/events", map[string]interface{}{"n": i})
+			require.NoError(t, err)
+			resp.Body.Close()
+		}
+
+		resp, err := ts.GET("/collections/events/documents/1")
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+		resp, err = ts.GET("/collections/events/documents/3")
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	})
+
+	t.Run("Get And Change Cap", func(t *testing.T) {
+		resp, err := ts.PUT("/collections/events/capped", map[string]interface{}{"max_docs": 1, "policy": "lru"})
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		resp.Body.Close()
+
+		resp, err = ts.GET("/collections/events/capped")
+		require.NoError(t, err)
+		body, err := ReadResponseBody(resp)
+		require.NoError(t, err)
+
+		var result map[string]interface{}
+		require.NoError(t, json.Unmarshal([]byte(body), &result))
+		assert.Equal(t, true, result["capped"])
+		assert.Equal(t, float64(1), result["max_docs"])
+		assert.Equal(t, "lru", result["policy"])
+	})
+
+	t.Run("Delete Cap", func(t *testing.T) {
+		resp, err := ts.DELETE("/collections/events/capped")
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+
+		resp, err = ts.GET("/collections/events/capped")
+		require.NoError(t, err)
+		body, err := ReadResponseBody(resp)
+		require.NoError(t, err)
+		assert.Contains(t, body, `"capped":false`)
+	})
+}
+
+func TestAPI_Integration_HeadDocument(t *testing.T) {
+	ts := NewTestServer(t)
+	defer ts.Close(t)
+
+	resp, err := ts.POST("/collections/users", map[string]interface{}{"name": "Alice"})
+	require.NoError(t, err)
+	resp.Body.Close()
+	resp, err = ts.POST("/collections/users", map[string]interface{}{"name": "Bob", "deleted": true})
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	head := func(path string) *http.Response {
+		resp, err := http.Head(ts.BaseURL + path)
+		require.NoError(t, err)
+		resp.Body.Close()
+		return resp
+	}
+
+	t.Run("Exists", func(t *testing.T) {
+		resp := head("/collections/users/documents/1")
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+	})
+
+	t.Run("Missing", func(t *testing.T) {
+		assert.Equal(t, http.StatusNotFound, head("/collections/users/documents/99").StatusCode)
+		assert.Equal(t, http.StatusNotFound, head("/collections/missing/documents/1").StatusCode)
+	})
+
+	t.Run("Hidden By Default Filter", func(t *testing.T) {
+		resp, err := ts.PUT("/collections/users/default_filter", map[string]interface{}{
+			"filter": map[string]interface{}{"$expr": "deleted != true"},
+		})
+		require.NoError(t, err)
+		resp.Body.Close()
+
+		assert.Equal(t, http.StatusNotFound, head("/collections/users/documents/2").StatusCode)
+		assert.Equal(t, http.StatusOK, head("/collections/users/documents/2?includeDeleted=true").StatusCode)
+		assert.Equal(t, http.StatusOK, head("/collections/users/documents/1").StatusCode)
+	})
+}
+
+func TestAPI_Integration_Multiplex(t *testing.T) {
+	ts := NewTestServer(t)
+	defer ts.Close(t)
+
+	resp, err := ts.POST("/collections/users", map[string]interface{}{"name": "Alice"})
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	t.Run("Sub-Requests In Order", func(t *testing.T) {
+		resp, err := ts.POST("/batch", []map[string]interface{}{
+			{"method": "POST", "path": "/collections/orders", "body": map[string]interface{}{"item": "pen"}},
+			{"method": "GET", "path": "/collections/users/find?name=Alice"},
+			{"method": "GET", "path": "/collections/orders/documents/1"},
+			{"method": "GET", "path": "/collections/users/documents/99"},
+			{"method": "GET", "path": "/no/such/route"},
+			{"method": "POST", "path": "/batch"},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+		body, err := ReadResponseBody(resp)
+		require.NoError(t, err)
+
+		var results []struct {
+			Status int             `json:"status"`
+			Body   json.RawMessage `json:"body"`
+		}
+		require.NoError(t, json.Unmarshal([]byte(body), &results))
+		require.Len(t, results, 6)
+		jsonBody := func(i int) map[string]interface{} {
+			var decoded map[string]interface{}
+			require.NoError(t, json.Unmarshal(results[i].Body, &decoded))
+			return decoded
+		}
+
+		assert.Equal(t, http.StatusCreated, results[0].Status)
+		assert.Equal(t, "pen", jsonBody(0)["item"])
+
+		assert.Equal(t, http.StatusOK, results[1].Status)
+		assert.Len(t, jsonBody(1)["documents"], 1)
+
+		// The document inserted by the first sub-request is visible to later ones
+		assert.Equal(t, http.StatusOK, results[2].Status)
+		assert.Equal(t, "pen", jsonBody(2)["item"])
+
+		// Failures stay confined to their own sub-request
+		assert.Equal(t, http.StatusNotFound, results[3].Status)
+		assert.Equal(t, http.StatusNotFound, results[4].Status)
+		assert.JSONEq(t, `"404 page not found"`, string(results[4].Body), "non-JSON output is kept as a string")
+		assert.Equal(t, http.StatusBadRequest, results[5].Status)
+	})
+
+	t.Run("Too Many Sub-Requests", func(t *testing.T) {
+		subRequests := make([]map[string]interface{}, MaxBatchSubRequests+1)
+		for i := range subRequests {
+			subRequests[i] = map[string]interface{}{"method": "GET", "path": "/health"}
+		}
+		resp, err := ts.POST("/batch", subRequests)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	})
+
+	t.Run("Invalid Body", func(t *testing.T) {
+		resp, err := ts.POST("/batch", map[string]interface{}{"method": "GET"})
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	})
+}
+
+func TestAPI_Integration_MultiplexHeaders(t *testing.T) {
+	ts := NewTestServer(t, storage.WithDocumentVersions(true))
+	defer ts.Close(t)
+
+	resp, err := ts.POST("/collections/users", map[string]interface{}{"name": "Alice"})
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	// Sub-requests inherit the batch's If-Match unless they set their own
+	jsonData, err := json.Marshal([]map[string]interface{}{
+		{"method": "PATCH", "path": "/collections/users/documents/1", "body": map[string]interface{}{"age": 30}},
+		{"method": "PATCH", "path": "/collections/users/documents/1", "body": map[string]interface{}{"age": 31}},
+		{"method": "PATCH", "path": "/collections/users/documents/1", "headers": map[string]string{"If-Match": `"2"`}, "body": map[string]interface{}{"age": 32}},
+	})
+	require.NoError(t, err)
+	req, err := http.NewRequest("POST", ts.BaseURL+"/batch", bytes.NewBuffer(jsonData))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("If-Match", `"1"`)
+	resp, err = http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	body, err := ReadResponseBody(resp)
+	require.NoError(t, err)
+	var results []struct {
+		Status int                    `json:"status"`
+		Body   map[string]interface{} `json:"body"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(body), &results))
+	require.Len(t, results, 3)
+	assert.Equal(t, http.StatusOK, results[0].Status)
+	assert.Equal(t, float64(2), results[0].Body["_version"])
+	assert.Equal(t, http.StatusPreconditionFailed, results[1].Status)
+	assert.Equal(t, http.StatusOK, results[2].Status)
+	assert.Equal(t, float64(32), results[2].Body["age"])
+
+	resp, err = ts.GET("/collections/users/documents/1")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, `"3"`, resp.Header.Get("ETag"))
+}
+
+func TestAPI_Integration_DropAllIndexes(t *testing.T) {
+	ts := NewTestServer(t)
+	defer ts.Close(t)
+
+	resp, err := ts.POST("/collections/users", map[string]interface{}{"name": "Alice", "age": 30, "city": "Boston"})
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+
+	resp, err = ts.POST("/collections/users/indexes", map[string]interface{}{
+		"indexes": []map[string]interface{}{{"field": "name"}, {"field": "age"}, {"field": "city"}},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	resp.Body.Close()
+
+	t.Run("Drop All Indexes", func(t *testing.T) {
+		resp, err := ts.DELETE("/collections/users/indexes")
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+		body, err := ReadResponseBody(resp)
+		require.NoError(t, err)
+
+		var result map[string]interface{}
+		require.NoError(t, json.Unmarshal([]byte(body), &result))
+		assert.Equal(t, float64(3), result["dropped_count"])
+		assert.Equal(t, []interface{}{"_id"}, result["indexes"])
+	})
+
+	t.Run("Non-existent Collection", func(t *testing.T) {
+		resp, err := ts.DELETE("/collections/nonexistent/indexes")
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+		resp.Body.Close()
+	})
+}
+
+func TestAPI_Integration_RebuildIndexes(t *testing.T) {
+	ts := NewTestServer(t)
+	defer ts.Close(t)
+
+	for _, team := range []string{"core", "web", "core"} {
+		resp, err := ts.POST("/collections/users", map[string]interface{}{"team": team})
+		require.NoError(t, err)
+		resp.Body.Close()
+	}
+	resp, err := ts.POST("/collections/users/indexes/team", nil)
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	readStatus := func(t *testing.T, resp *http.Response) IndexRebuildStatus {
+		body, err := ReadResponseBody(resp)
+		require.NoError(t, err)
+		var status IndexRebuildStatus
+		require.NoError(t, json.Unmarshal([]byte(body), &status))
+		return status
+	}
+
+	t.Run("Rebuild Runs In Background", func(t *testing.T) {
+		resp, err := ts.POST("/collections/users/indexes/rebuild", nil)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusAccepted, resp.StatusCode)
+		started := readStatus(t, resp)
+		require.NotEmpty(t, started.JobID)
+
+		var status IndexRebuildStatus
+		require.Eventually(t, func() bool {
+			resp, err := ts.GET("/collections/users/indexes/rebuild/status?job_id=" + started.JobID)
+			require.NoError(t, err)
+			require.Equal(t, http.StatusOK, resp.StatusCode)
+			status = readStatus(t, resp)
+			return status.State != RebuildStateRunning
+		}, 5*time.Second, 10*time.Millisecond)
+
+		assert.Equal(t, RebuildStateCompleted, status.State)
+		assert.Equal(t, 3, status.Processed)
+		assert.Equal(t, 3, status.Total)
+		assert.NotNil(t, status.FinishedAt)
+
+		// The rebuilt index still answers queries
+		resp, err = ts.GET("/collections/users/ids?team=core")
+		require.NoError(t, err)
+		body, err := ReadResponseBody(resp)
+		require.NoError(t, err)
+		assert.Contains(t, body, `"ids":["1","3"]`)
+	})
+
+	t.Run("Cancel Finished Rebuild", func(t *testing.T) {
+		resp, err := ts.DELETE("/collections/users/indexes/rebuild")
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusConflict, resp.StatusCode)
+	})
+
+	t.Run("Unknown Job", func(t *testing.T) {
+		resp, err := ts.GET("/collections/users/indexes/rebuild/status?job_id=rebuild-99")
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+		resp, err = ts.GET("/collections/orders/indexes/rebuild/status")
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	})
+
+	t.Run("Non-existent Collection Fails", func(t *testing.T) {
+		resp, err := ts.POST("/collections/nonexistent/indexes/rebuild", nil)
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusAccepted, resp.StatusCode)
+
+		var status IndexRebuildStatus
+		require.Eventually(t, func() bool {
+			resp, err := ts.GET("/collections/nonexistent/indexes/rebuild/status")
+			require.NoError(t, err)
+			status = readStatus(t, resp)
+			return status.State != RebuildStateRunning
+		}, 5*time.Second, 10*time.Millisecond)
+		assert.Equal(t, RebuildStateFailed, status.State)
+		assert.NotEmpty(t, status.Error)
+	})
+}
+
+func TestAPI_Integration_Migrate(t *testing.T) {
+	ts := NewTestServer(t)
+	defer ts.Close(t)
+
+	for _, user := range []map[string]interface{}{
+		{"fullName": "Alice Smith", "legacyId": 7, "city": "Paris"},
+		{"fullName": "Bob Jones", "city": "Rome"},
+	} {
+		resp, err := ts.POST("/collections/users", user)
+		require.NoError(t, err)
+		resp.Body.Close()
+	}
+	resp, err := ts.POST("/collections/users/indexes/city", nil)
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	spec := map[string]interface{}{
+		"rename": map[string]interface{}{"fullName": "name", "city": "town"},
+		"add":    map[string]interface{}{"tier": "free"},
+		"remove": []string{"legacyId"},
+	}
+
+	readStatus := func(t *testing.T, resp *http.Response) MigrationStatus {
+		body, err := ReadResponseBody(resp)
+		require.NoError(t, err)
+		var status MigrationStatus
+		require.NoError(t, json.Unmarshal([]byte(body), &status))
+		return status
+	}
+	runMigration := func(t *testing.T) MigrationStatus {
+		resp, err := ts.POST("/collections/users/migrate", spec)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusAccepted, resp.StatusCode)
+		started := readStatus(t, resp)
+		require.NotEmpty(t, started.JobID)
+
+		var status MigrationStatus
+		require.Eventually(t, func() bool {
+			resp, err := ts.GET("/collections/users/migrate/status?job_id=" + started.JobID)
+			require.NoError(t, err)
+			require.Equal(t, http.StatusOK, resp.StatusCode)
+			status = readStatus(t, resp)
+			return status.State != RebuildStateRunning
+		}, 5*time.Second, 10*time.Millisecond)
+		return status
+	}
+
+	t.Run("Migration Runs In Background", func(t *testing.T) {
+		status := runMigration(t)
+		assert.Equal(t, RebuildStateCompleted, status.State)
+		assert.Equal(t, 2, status.Processed)
+		assert.Equal(t, 2, status.Total)
+		assert.Equal(t, 2, status.Modified)
+
+		resp, err := ts.GET("/collections/users/documents/1")
+		require.NoError(t, err)
+		body, err := ReadResponseBody(resp)
+		require.NoError(t, err)
+		var doc map[string]interface{}
+		require.NoError(t, json.Unmarshal([]byte(body), &doc))
+		assert.Equal(t, "Alice Smith", doc["name"])
+		assert.Equal(t, "Paris", doc["town"])
+		assert.Equal(t, "free", doc["tier"])
+		assert.NotContains(t, doc, "fullName")
+		assert.NotContains(t, doc, "legacyId")
+
+		// The index on the renamed field no longer holds the documents
+		resp, err = ts.GET("/collections/users/ids?city=Paris")
+		require.NoError(t, err)
+		body, err = ReadResponseBody(resp)
+		require.NoError(t, err)
+		assert.Contains(t, body, `"ids":[]`)
+	})
+
+	t.Run("Rerun Changes Nothing", func(t *testing.T) {
+		status := runMigration(t)
+		assert.Equal(t, RebuildStateCompleted, status.State)
+		assert.Equal(t, 0, status.Modified)
+	})
+
+	t.Run("Invalid Spec", func(t *testing.T) {
+		resp, err := ts.POST("/collections/users/migrate", map[string]interface{}{"remove": []string{"_id"}})
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	})
+
+	t.Run("Cancel Finished Migration", func(t *testing.T) {
+		resp, err := ts.DELETE("/collections/users/migrate")
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusConflict, resp.StatusCode)
+	})
+
+	t.Run("Unknown Job", func(t *testing.T) {
+		resp, err := ts.GET("/collections/orders/migrate/status")
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	})
+}
+
+func TestAPI_Integration_CancelRebuildIndexes(t *testing.T) {
+	engine := storage.NewStorageEngine(storage.WithNoSaves(true))
+	defer engine.StopBackgroundWorkers()
+
+	handler := NewHandler(&blockingStorage{engine}, engine.GetIndexEngine())
+	router := mux.NewRouter()
+	handler.RegisterRoutes(router)
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	resp, err := http.Post(server.URL+"/collections/users/indexes/rebuild", "application/json", nil)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusAccepted, resp.StatusCode)
+
+	getStatus := func() IndexRebuildStatus {
+		resp, err := http.Get(server.URL + "/collections/users/indexes/rebuild/status")
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		var status IndexRebuildStatus
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&status))
+		return status
+	}
+
+	// Progress is visible while the rebuild runs
+	require.Eventually(t, func() bool {
+		return getStatus().Processed == 5
+	}, 5*time.Second, 10*time.Millisecond)
+	status := getStatus()
+	assert.Equal(t, RebuildStateRunning, status.State)
+	assert.Equal(t, 10, status.Total)
+
+	// Only one rebuild per collection runs at a time
+	resp, err = http.Post(server.URL+"/collections/users/indexes/rebuild", "application/json", nil)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+
+	req, err := http.NewRequest(http.MethodDelete, server.URL+"/collections/users/indexes/rebuild", nil)
+	require.NoError(t, err)
+	resp, err = http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusAccepted, resp.StatusCode)
+
+	require.Eventually(t, func() bool {
+		return getStatus().State == RebuildStateCancelled
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestAPI_Integration_QueryParamTypes(t *testing.T) {
+	ts := NewTestServer(t)
+	defer ts.Close(t)
+
+	for _, doc := range []map[string]interface{}{
+		{"name": "Alice", "active": true, "age": 30, "zip": "02134"},
+		{"name": "Bob", "active": false, "age": 30.5, "zip": "10001"},
+	} {
+		resp, err := ts.POST("/collections/users", doc)
+		require.NoError(t, err)
+		resp.Body.Close()
+	}
+
+	findNames := func(t *testing.T, query string) []string {
+		resp, err := ts.GET("/collections/users/find?" + query)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		body, err := ReadResponseBody(resp)
+		require.NoError(t, err)
+
+		var result domain.PaginationResult
+		require.NoError(t, json.Unmarshal([]byte(body), &result))
+		var names []string
+		for _, doc := range result.Documents {
+			names = append(names, doc["name"].(string))
+		}
+		return names
+	}
+
+	t.Run("Inferred Types", func(t *testing.T) {
+		assert.Equal(t, []string{"Alice"}, findNames(t, "active=true"))
+		assert.Equal(t, []string{"Bob"}, findNames(t, "active=false"))
+		assert.Equal(t, []string{"Alice"}, findNames(t, "active=true&age=30"))
+		assert.Equal(t, []string{"Bob"}, findNames(t, "age=30.5"))
+		assert.Empty(t, findNames(t, "zip=02134"), "02134 is inferred as a number")
+	})
+
+	t.Run("Type Hints", func(t *testing.T) {
+		assert.Equal(t, []string{"Alice"}, findNames(t, "zip:string=02134"))
+		assert.Equal(t, []string{"Alice"}, findNames(t, "age:int=30"))
+		assert.Equal(t, []string{"Bob"}, findNames(t, "age:float=30.5"))
+		assert.Equal(t, []string{"Alice"}, findNames(t, "active:bool=1"))
+		assert.Empty(t, findNames(t, "active:string=true"))
+	})
+
+	t.Run("Other Endpoints", func(t *testing.T) {
+		resp, err := ts.GET("/collections/users/ids?active=false")
+		require.NoError(t, err)
+		body, err := ReadResponseBody(resp)
+		require.NoError(t, err)
+		assert.Contains(t, body, `"ids":["2"]`)
+
+		resp, err = ts.GET("/collections/users/find_with_stream?active=true")
+		require.NoError(t, err)
+		body, err = ReadResponseBody(resp)
+		require.NoError(t, err)
+		assert.Contains(t, body, "Alice")
+		assert.NotContains(t, body, "Bob")
+	})
+
+	t.Run("Invalid Hints", func(t *testing.T) {
+		for _, query := range []string{"age:int=30.5", "age:float=abc", "active:bool=maybe", "age:integer=30", ":int=1"} {
+			for _, path := range []string{"/collections/users/find?", "/collections/users/ids?", "/collections/users/find_with_stream?"} {
+				resp, err := ts.GET(path + query)
+				require.NoError(t, err)
+				resp.Body.Close()
+				assert.Equal(t, http.StatusBadRequest, resp.StatusCode, path+query)
+			}
+		}
+	})
+}
+
+func TestAPI_Integration_ExprFilter(t *testing.T) {
+	ts := NewTestServer(t)
+	defer ts.Close(t)
+
+	orders := []map[string]interface{}{
+		{"item": "pen", "price": 2, "quantity": 10},
+		{"item": "desk", "price": 150, "quantity": 1},
+		{"item": "chair", "price": 60, "quantity": 4},
+	}
+	for _, order := range orders {
+		resp, err := ts.POST("/collections/orders", order)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	}
+
+	t.Run("Find With Expression", func(t *testing.T) {
+		query := url.Values{"$expr": {"price * quantity > 100 && quantity > 1"}}
+		resp, err := ts.GET("/collections/orders/find?" + query.Encode())
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+		body, err := ReadResponseBody(resp)
+		require.NoError(t, err)
+
+		var result map[string]interface{}
+		err = json.Unmarshal([]byte(body), &result)
+		require.NoError(t, err)
+
+		documents := result["documents"].([]interface{})
+		require.Len(t, documents, 1)
+		assert.Equal(t, "chair", documents[0].(map[string]interface{})["item"])
+	})
+
+	t.Run("Stream With Expression", func(t *testing.T) {
+		query := url.Values{"$expr": {"price >= 60"}}
+		resp, err := ts.GET("/collections/orders/find_with_stream?" + query.Encode())
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+		body, err := ReadResponseBody(resp)
+		require.NoError(t, err)
+
+		var documents []map[string]interface{}
+		err = json.Unmarshal([]byte(body), &documents)
+		require.NoError(t, err)
+		assert.Len(t, documents, 2)
+	})
+
+	t.Run("Invalid Expression", func(t *testing.T) {
+		query := url.Values{"$expr": {"exec('rm -rf /') > 0"}}
+		resp, err := ts.GET("/collections/orders/find?" + query.Encode())
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+		body, err := ReadResponseBody(resp)
+		require.NoError(t, err)
+		assert.Contains(t, body, "unknown function")
+	})
+}
+
+func TestAPI_Integration_QueryProjection(t *testing.T) {
+	ts := NewTestServer(t)
+	defer ts.Close(t)
+
+	users := []map[string]interface{}{
+		{"name": "Alice", "age": 30, "active": true},
+		{"name": "Bob", "age": 25, "active": false},
+	}
+	for _, user := range users {
+		resp, err := ts.POST("/collections/users", user)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	}
+
+	t.Run("Renamed And Computed Fields", func(t *testing.T) {
+		resp, err := ts.POST("/collections/users/query", map[string]interface{}{
+			"filter": map[string]interface{}{"active": true},
+			"project": map[string]interface{}{
+				"fullName":    "$name",
+				"ageNextYear": map[string]interface{}{"$add": []interface{}{"$age", 1}},
+			},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+		body, err := ReadResponseBody(resp)
+		require.NoError(t, err)
+
+		var result map[string]interface{}
+		require.NoError(t, json.Unmarshal([]byte(body), &result))
+
+		documents := result["documents"].([]interface{})
+		require.Len(t, documents, 1)
+		doc := documents[0].(map[string]interface{})
+		assert.Equal(t, "Alice", doc["fullName"])
+		assert.Equal(t, float64(31), doc["ageNextYear"])
+		assert.NotEmpty(t, doc["_id"])
+		assert.NotContains(t, doc, "name")
+		assert.NotContains(t, doc, "active")
+	})
+
+	t.Run("Without Projection", func(t *testing.T) {
+		resp, err := ts.POST("/collections/users/query", map[string]interface{}{
+			"filter": map[string]interface{}{"$expr": "age < 30"},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+		body, err := ReadResponseBody(resp)
+		require.NoError(t, err)
+
+		var result map[string]interface{}
+		require.NoError(t, json.Unmarshal([]byte(body), &result))
+
+		documents := result["documents"].([]interface{})
+		require.Len(t, documents, 1)
+		assert.Equal(t, "Bob", documents[0].(map[string]interface{})["name"])
+	})
+
+	t.Run("Invalid Projection", func(t *testing.T) {
+		resp, err := ts.POST("/collections/users/query", map[string]interface{}{
+			"project": map[string]interface{}{"out": map[string]interface{}{"$pow": []interface{}{"$age", 2}}},
+		})
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	})
+
+	t.Run("Invalid Filter", func(t *testing.T) {
+		resp, err := ts.POST("/collections/users/query", map[string]interface{}{
+			"filter": map[string]interface{}{"$expr": "age +"},
+		})
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	})
+}
+
+func TestAPI_Integration_Facets(t *testing.T) {
+	ts := NewTestServer(t)
+	defer ts.Close(t)
+
+	products := []map[string]interface{}{
+		{"brand": "acme", "color": "red"},
+		{"brand": "acme", "color": "blue"},
+		{"brand": "globex", "color": "red"},
+	}
+	for _, product := range products {
+		resp, err := ts.POST("/collections/products", product)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	}
+
+	t.Run("Counts Per Field", func(t *testing.T) {
+		resp, err := ts.POST("/collections/products/facets", map[string]interface{}{
+			"fields": []string{"brand", "color"},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+		body, err := ReadResponseBody(resp)
+		require.NoError(t, err)
+
+		var result FacetsResponse
+		require.NoError(t, json.Unmarshal([]byte(body), &result))
+		assert.Equal(t, []FacetCount{{Value: "acme", Count: 2}, {Value: "globex", Count: 1}}, result.Facets["brand"])
+		assert.Equal(t, []FacetCount{{Value: "red", Count: 2}, {Value: "blue", Count: 1}}, result.Facets["color"])
+	})
+
+	t.Run("With Filter", func(t *testing.T) {
+		resp, err := ts.POST("/collections/products/facets", map[string]interface{}{
+			"filter": map[string]interface{}{"color": "red"},
+			"fields": []string{"brand"},
+		})
+		require.NoError(t, err)
+
+		body, err := ReadResponseBody(resp)
+		require.NoError(t, err)
+
+		var result FacetsResponse
+		require.NoError(t, json.Unmarshal([]byte(body), &result))
+		assert.Equal(t, []FacetCount{{Value: "acme", Count: 1}, {Value: "globex", Count: 1}}, result.Facets["brand"])
+	})
+
+	t.Run("Missing Fields", func(t *testing.T) {
+		resp, err := ts.POST("/collections/products/facets", map[string]interface{}{})
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	})
+
+	t.Run("Unknown Collection", func(t *testing.T) {
+		resp, err := ts.POST("/collections/missing/facets", map[string]interface{}{"fields": []string{"brand"}})
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	})
+}
+
+func TestAPI_Integration_Aggregate(t *testing.T) {
+	ts := NewTestServer(t)
+	defer ts.Close(t)
+
+	orders := []map[string]interface{}{
+		{"customer": "alice", "total": 10, "status": "paid"},
+		{"customer": "alice", "total": 30, "status": "paid"},
+		{"customer": "bob", "total": 5, "status": "paid"},
+		{"customer": "carol", "total": 50, "status": "refunded"},
+	}
+	for _, order := range orders {
+		resp, err := ts.POST("/collections/orders", order)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	}
+
+	t.Run("Groups With Metrics", func(t *testing.T) {
+		resp, err := ts.POST("/collections/orders/aggregate", map[string]interface{}{
+			"filter":   map[string]interface{}{"status": "paid"},
+			"group_by": "customer",
+			"metrics":  map[string]interface{}{"revenue": map[string]string{"op": "sum", "field": "total"}},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+		body, err := ReadResponseBody(resp)
+		require.NoError(t, err)
+
+		var result AggregateResponse
+		require.NoError(t, json.Unmarshal([]byte(body), &result))
+		assert.False(t, result.Truncated)
+		require.Len(t, result.Groups, 2)
+		assert.Equal(t, "alice", result.Groups[0].Key)
+		assert.Equal(t, int64(2), result.Groups[0].Count)
+		assert.Equal(t, float64(40), result.Groups[0].Metrics["revenue"])
+		assert.Equal(t, "bob", result.Groups[1].Key)
+	})
+
+	t.Run("Max Groups Truncates", func(t *testing.T) {
+		resp, err := ts.POST("/collections/orders/aggregate", map[string]interface{}{
+			"group_by":   "customer",
+			"max_groups": 1,
+		})
+		require.NoError(t, err)
+
+		body, err := ReadResponseBody(resp)
+		require.NoError(t, err)
+
+		var result AggregateResponse
+		require.NoError(t, json.Unmarshal([]byte(body), &result))
+		assert.True(t, result.Truncated)
+		require.Len(t, result.Groups, 1)
+		assert.Equal(t, int64(4), result.Groups[0].Count+result.OtherCount)
+	})
+
+	t.Run("Invalid Metric", func(t *testing.T) {
+		resp, err := ts.POST("/collections/orders/aggregate", map[string]interface{}{
+			"metrics": map[string]interface{}{"x": map[string]string{"op": "median", "field": "total"}},
+		})
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	})
+
+	t.Run("Unknown Collection", func(t *testing.T) {
+		resp, err := ts.POST("/collections/missing/aggregate", map[string]interface{}{"group_by": "customer"})
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	})
+}
+
+func TestAPI_Integration_RequestID(t *testing.T) {
+	ts := NewTestServer(t)
+	defer ts.Close(t)
+
+	t.Run("Generated When Missing", func(t *testing.T) {
+		resp, err := ts.GET("/health")
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		assert.Len(t, resp.Header.Get(RequestIDHeader), 32)
+	})
+
+	t.Run("Echoes Client ID", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodGet, ts.BaseURL+"/health", nil)
+		require.NoError(t, err)
+		req.Header.Set(RequestIDHeader, "trace-abc-123")
+
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, "trace-abc-123", resp.Header.Get(RequestIDHeader))
+	})
+
+	t.Run("Replaces Invalid ID", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodGet, ts.BaseURL+"/health", nil)
+		require.NoError(t, err)
+		req.Header.Set(RequestIDHeader, "has spaces")
+
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		id := resp.Header.Get(RequestIDHeader)
+		assert.NotEqual(t, "has spaces", id)
+		assert.NotEmpty(t, id)
+	})
+
+	t.Run("Attached To Handler Logs", func(t *testing.T) {
+		var logs bytes.Buffer
+		log.SetOutput(&logs)
+		defer log.SetOutput(os.Stderr)
+
+		req, err := http.NewRequest(http.MethodGet, ts.BaseURL+"/collections/missing/documents/1", nil)
+		require.NoError(t, err)
+		req.Header.Set(RequestIDHeader, "trace-log-1")
+
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Contains(t, logs.String(), "handleGetById called for collection 'missing', document '1' request_id=trace-log-1")
+	})
+}
+
+func TestAPI_Integration_Ingest(t *testing.T) {
+	ts := NewTestServer(t)
+	defer ts.Close(t)
+
+	t.Run("Acknowledges Each Line", func(t *testing.T) {
+		body := strings.Join([]string{
+			`{"name": "Alice"}`,
+			``,
+			`{"name": "Bob"`,
+			`[1, 2]`,
+			`{"name": "Charlie"}`,
+		}, "\n")
+
+		resp, err := http.Post(ts.BaseURL+"/collections/events/ingest", "application/x-ndjson", strings.NewReader(body))
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+		var acks []IngestAck
+		decoder := json.NewDecoder(resp.Body)
+		for decoder.More() {
+			var ack IngestAck
+			require.NoError(t, decoder.Decode(&ack))
+			acks = append(acks, ack)
+		}
+
+		require.Len(t, acks, 4)
+		assert.Equal(t, 1, acks[0].Line)
+		assert.True(t, acks[0].OK)
+		assert.NotEmpty(t, acks[0].ID)
+		assert.Equal(t, 3, acks[1].Line)
+		assert.False(t, acks[1].OK)
+		assert.Contains(t, acks[1].Error, "invalid JSON")
+		assert.False(t, acks[2].OK)
+		assert.Equal(t, 5, acks[3].Line)
+		assert.True(t, acks[3].OK)
+
+		doc, err := ts.Storage.GetById("events", acks[3].ID)
+		require.NoError(t, err)
+		assert.Equal(t, "Charlie", doc["name"])
+	})
+
+	t.Run("Retries Rejected Batch Line By Line", func(t *testing.T) {
+		require.NoError(t, ts.Storage.CreateCollection("members"))
+		require.NoError(t, ts.Storage.CreateUniqueIndex("members", "email"))
+		body := strings.Join([]string{
+			`{"email": "a@x"}`,
+			`{"email": "a@x"}`,
+			`{"email": "b@x"}`,
+		}, "\n")
+
+		resp, err := http.Post(ts.BaseURL+"/collections/members/ingest", "application/x-ndjson", strings.NewReader(body))
+		require.NoError(t, err)
+		defer resp.Body.Close()
+
+		var acks []IngestAck
+		decoder := json.NewDecoder(resp.Body)
+		for decoder.More() {
+			var ack IngestAck
+			require.NoError(t, decoder.Decode(&ack))
+			acks = append(acks, ack)
+		}
+		require.Len(t, acks, 3)
+		assert.True(t, acks[0].OK)
+		assert.False(t, acks[1].OK)
+		assert.Contains(t, acks[1].Error, "duplicate key")
+		assert.True(t, acks[2].OK)
+	})
+
+	t.Run("Streams Acks While Producer Is Open", func(t *testing.T) {
+		reader, writer := io.Pipe()
+		defer writer.Close()
+
+		req, err := http.NewRequest(http.MethodPost, ts.BaseURL+"/collections/stream_events/ingest", reader)
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", "application/x-ndjson")
+
+		responses := make(chan *http.Response, 1)
+		go func() {
+			resp, err := http.DefaultClient.Do(req)
+			if err == nil {
+				responses <- resp
+			}
+		}()
+
+		_, err = writer.Write([]byte(`{"seq": 1}` + "\n"))
+		require.NoError(t, err)
+
+		var resp *http.Response
+		select {
+		case resp = <-responses:
+		case <-time.After(5 * time.Second):
+			t.Fatal("no response while the producer was still open")
+		}
+		defer resp.Body.Close()
+
+		decoder := json.NewDecoder(resp.Body)
+		var ack IngestAck
+		require.NoError(t, decoder.Decode(&ack))
+		assert.True(t, ack.OK)
+		assert.Equal(t, 1, ack.Line)
+
+		_, err = writer.Write([]byte(`{"seq": 2}` + "\n"))
+		require.NoError(t, err)
+		require.NoError(t, decoder.Decode(&ack))
+		assert.True(t, ack.OK)
+		assert.Equal(t, 2, ack.Line)
+
+		require.NoError(t, writer.Close())
+		assert.False(t, decoder.More())
+
+		result, err := ts.Storage.FindAll("stream_events", nil, nil)
+		require.NoError(t, err)
+		assert.Len(t, result.Documents, 2)
+	})
+}
+
+func TestAPI_Integration_DefaultFilter(t *testing.T) {
+	ts := NewTestServer(t)
+	defer ts.Close(t)
+
+	users := []map[string]interface{}{
+		{"name": "Alice", "deleted": false},
+		{"name": "Bob", "deleted": true},
+		{"name": "Carol"},
+	}
+	for _, user := range users {
+		resp, err := ts.POST("/collections/users", user)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	}
+
+	countDocuments := func(t *testing.T, path string) int {
+		resp, err := ts.GET(path)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+
+		body, err := ReadResponseBody(resp)
+		require.NoError(t, err)
+
+		var result map[string]interface{}
+		require.NoError(t, json.Unmarshal([]byte(body), &result))
+		return len(result["documents"].([]interface{}))
+	}
+
+	t.Run("Set Default Filter", func(t *testing.T) {
+		req := map[string]interface{}{
+			"filter": map[string]interface{}{"$expr": "deleted != true"},
+		}
+		resp, err := ts.PUT("/collections/users/default_filter", req)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		resp.Body.Close()
+
+		resp, err = ts.GET("/collections/users/default_filter")
+		require.NoError(t, err)
+		body, err := ReadResponseBody(resp)
+		require.NoError(t, err)
+		assert.Contains(t, body, "deleted != true")
+	})
+
+	t.Run("Find Excludes Soft Deleted", func(t *testing.T) {
+		assert.Equal(t, 2, countDocuments(t, "/collections/users/find"))
+		assert.Equal(t, 3, countDocuments(t, "/collections/users/find?includeDeleted=true"))
+	})
+
+	t.Run("Get By Id Respects Default Filter", func(t *testing.T) {
+		resp, err := ts.GET("/collections/users/documents/2")
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+		resp.Body.Close()
+
+		resp, err = ts.GET("/collections/users/documents/2?includeDeleted=true")
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		resp.Body.Close()
+	})
+
+	t.Run("Invalid Default Filter", func(t *testing.T) {
+		req := map[string]interface{}{
+			"filter": map[string]interface{}{"$expr": "deleted !="},
+		}
+		resp, err := ts.PUT("/collections/users/default_filter", req)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+		resp.Body.Close()
+	})
+
+	t.Run("Delete Default Filter", func(t *testing.T) {
+		resp, err := ts.DELETE("/collections/users/default_filter")
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+		resp.Body.Close()
+
+		assert.Equal(t, 3, countDocuments(t, "/collections/users/find"))
+	})
+}
+
+// blockingStorage simulates a slow scan that only ends when the query context is done
+type blockingStorage struct {
+	*storage.StorageEngine
+}
+
+func (b *blockingStorage) FindAllContext(ctx context.Context, collName string, filter map[string]interface{}, options *domain.PaginationOptions) (*domain.PaginationResult, error) {
+	<-ctx.Done()
+	return nil, fmt.Errorf("query aborted: %w", ctx.Err())
+}
+
+func (b *blockingStorage) FindAllStreamContext(ctx context.Context, collName string, filter map[string]interface{}) (<-chan domain.Document, error) {
+	out := make(chan domain.Document, 1)
+	out <- domain.Document{"_id": "1", "name": "first"}
+	go func() {
+		defer close(out)
+		<-ctx.Done()
+	}()
+	return out, nil
+}
+
+// RebuildIndexesContext reports partial progress, then waits until the rebuild is cancelled
+func (b *blockingStorage) RebuildIndexesContext(ctx context.Context, collName string, progress func(processed, total int)) error {
+	progress(5, 10)
+	<-ctx.Done()
+	return fmt.Errorf("index rebuild aborted: %w", ctx.Err())
+}
+
+func TestAPI_Integration_CreateCollectionWithOptions(t *testing.T) {
+	ts := NewTestServer(t)
+	defer ts.Close(t)
+
+	errorCode := func(t *testing.T, resp *http.Response) string {
+		body, err := ReadResponseBody(resp)
+		require.NoError(t, err)
+		var errResp ErrorResponse
+		require.NoError(t, json.Unmarshal([]byte(body), &errResp))
+		return errResp.Error.Code
+	}
+
+	t.Run("Create With Options", func(t *testing.T) {
+		req := map[string]interface{}{
+			"name":     "orders",
+			"indexes":  []map[string]interface{}{{"field": "status"}, {"field": "total"}},
+			"defaults": map[string]interface{}{"status": "open"},
+			"capped":   map[string]interface{}{"max_docs": 100, "policy": "fifo"},
+		}
+		resp, err := ts.POST("/collections", req)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusCreated, resp.StatusCode)
+
+		body, err := ReadResponseBody(resp)
+		require.NoError(t, err)
+		var result map[string]interface{}
+		require.NoError(t, json.Unmarshal([]byte(body), &result))
+		assert.Equal(t, "orders", result["collection"])
+		assert.Equal(t, []interface{}{"_id", "status", "total"}, result["indexes"])
+		assert.NotNil(t, result["capped"])
+
+		// The first insert already gets the defaults
+		resp, err = ts.POST("/collections/orders", map[string]interface{}{"total": 5})
+		require.NoError(t, err)
+		body, err = ReadResponseBody(resp)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusCreated, resp.StatusCode)
+		assert.Contains(t, body, `"status":"open"`)
+	})
+
+	t.Run("Existing Collection", func(t *testing.T) {
+		resp, err := ts.POST("/collections", map[string]interface{}{"name": "orders"})
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusConflict, resp.StatusCode)
+		assert.Equal(t, ErrCodeCollectionExists, errorCode(t, resp))
+	})
+
+	t.Run("Unknown Option", func(t *testing.T) {
+		resp, err := ts.POST("/collections", map[string]interface{}{"name": "events", "durability": "memory"})
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+		assert.Equal(t, ErrCodeInvalidRequest, errorCode(t, resp))
+	})
+
+	t.Run("Invalid Options Create Nothing", func(t *testing.T) {
+		req := map[string]interface{}{
+			"name":     "events",
+			"defaults": map[string]interface{}{"kind": "click"},
+			"indexes":  []map[string]interface{}{{"field": "_id"}},
+		}
+		resp, err := ts.POST("/collections", req)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+		assert.Equal(t, ErrCodeInvalidField, errorCode(t, resp))
+
+		resp, err = ts.GET("/collections/events/find")
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+		resp.Body.Close()
+	})
+
+	t.Run("Missing Name", func(t *testing.T) {
+		resp, err := ts.POST("/collections", map[string]interface{}{})
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+		assert.Equal(t, ErrCodeValidationFailed, errorCode(t, resp))
+	})
+}
+
+func TestAPI_Integration_InsertionOrder(t *testing.T) {
+	ts := NewTestServer(t, storage.WithInsertionOrder(true))
+	defer ts.Close(t)
+
+	for i := 1; i <= 11; i++ {
+		resp, err := ts.POST("/collections/events", map[string]interface{}{"seq": i})
+		require.NoError(t, err)
+		resp.Body.Close()
+	}
+	resp, err := ts.DELETE("/collections/events/documents/2")
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	findIDs := func(t *testing.T, path string) []string {
+		resp, err := ts.GET(path)
+		require.NoError(t, err)
+		body, err := ReadResponseBody(resp)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, resp.StatusCode, body)
+
+		var result struct {
+			Documents []map[string]interface{} `json:"documents"`
+		}
+		require.NoError(t, json.Unmarshal([]byte(body), &result))
+		var ids []string
+		for _, doc := range result.Documents {
+			ids = append(ids, doc["_id"].(string))
+		}
+		return ids
+	}
+
+	assert.Equal(t, []string{"1", "10", "11", "3"}, findIDs(t, "/collections/events/find?limit=4"))
+	assert.Equal(t, []string{"1", "3", "4", "5"}, findIDs(t, "/collections/events/find?order=inserted&limit=4"))
+	assert.Equal(t, []string{"9", "10", "11"}, findIDs(t, "/collections/events/find?order=inserted&offset=7"))
+
+	resp, err = ts.POST("/collections/events/query", map[string]interface{}{"order": "inserted", "limit": 2})
+	require.NoError(t, err)
+	body, err := ReadResponseBody(resp)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Regexp(t, `"_id":"1".*"_id":"3"`, body)
+
+	resp, err = ts.GET("/collections/events/find?order=newest")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	untracked := NewTestServer(t)
+	defer untracked.Close(t)
+	resp, err = untracked.POST("/collections/events", map[string]interface{}{"seq": 1})
+	require.NoError(t, err)
+	resp.Body.Close()
+	resp, err = untracked.GET("/collections/events/find?order=inserted")
+	require.NoError(t, err)
+	body, err = ReadResponseBody(resp)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusNotImplemented, resp.StatusCode)
+	assert.Contains(t, body, ErrCodeInsertionOrderDisabled)
+}
+
+func TestAPI_Integration_FindAcrossCollections(t *testing.T) {
+	ts := NewTestServer(t)
+	defer ts.Close(t)
+
+	for _, day := range []string{"logs_2024_01_02", "logs_2024_01_01", "logs_2024_02_01"} {
+		for i := 1; i <= 3; i++ {
+			resp, err := ts.POST("/collections/"+day, map[string]interface{}{"n": i})
+			require.NoError(t, err)
+			resp.Body.Close()
+		}
+	}
+
+	resp, err := ts.GET("/collections/logs_2024_01_*/find?limit=4&n=2")
+	require.NoError(t, err)
+	body, err := ReadResponseBody(resp)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode, body)
+
+	var result struct {
+		Documents []map[string]interface{} `json:"documents"`
+		HasNext   bool                     `json:"has_next"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(body), &result))
+	require.Len(t, result.Documents, 2)
+	assert.Equal(t, "logs_2024_01_01", result.Documents[0]["_collection"])
+	assert.Equal(t, "logs_2024_01_02", result.Documents[1]["_collection"])
+	assert.False(t, result.HasNext)
+
+	resp, err = ts.GET("/collections/logs_*/find?limit=4&offset=4")
+	require.NoError(t, err)
+	body, err = ReadResponseBody(resp)
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal([]byte(body), &result))
+	assert.Len(t, result.Documents, 4)
+	assert.True(t, result.HasNext)
+
+	resp, err = ts.GET("/collections/logs_*/find?after=abc")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func TestAPI_Integration_ConsistencyOffset(t *testing.T) {
+	ts := NewTestServer(t, storage.WithNoSaves(true))
+	defer ts.Close(t)
+
+	getWithMinOffset := func(t *testing.T, minOffset string) *http.Response {
+		req, err := http.NewRequest(http.MethodGet, ts.BaseURL+"/collections/events/find", nil)
+		require.NoError(t, err)
+		req.Header.Set(MinOffsetHeader, minOffset)
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		return resp
+	}
+
+	resp, err := ts.POST("/collections/events", map[string]interface{}{"kind": "click"})
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, "0", resp.Header.Get(OffsetHeader))
+
+	t.Run("behind the required offset", func(t *testing.T) {
+		resp := getWithMinOffset(t, "1")
+		body, err := ReadResponseBody(resp)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusTooEarly, resp.StatusCode)
+		assert.Equal(t, "0", resp.Header.Get(OffsetHeader))
+
+		var errResp ErrorResponse
+		require.NoError(t, json.Unmarshal([]byte(body), &errResp))
+		assert.Equal(t, ErrCodeTooEarly, errResp.Error.Code)
+		assert.Equal(t, float64(1), errResp.Error.Details["min_offset"])
+	})
+
+	t.Run("invalid offset", func(t *testing.T) {
+		resp := getWithMinOffset(t, "soon")
+		resp.Body.Close()
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	})
+
+	require.NoError(t, ts.Storage.CheckpointNow())
+
+	t.Run("caught up", func(t *testing.T) {
+		resp := getWithMinOffset(t, "1")
+		resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "1", resp.Header.Get(OffsetHeader))
+	})
+}
+
+func TestAPI_Integration_MoveDocument(t *testing.T) {
+	ts := NewTestServer(t)
+	defer ts.Close(t)
+
+	for _, task := range []string{"build", "test"} {
+		resp, err := ts.POST("/collections/pending", map[string]interface{}{"task": task})
+		require.NoError(t, err)
+		resp.Body.Close()
+	}
+
+	t.Run("moves the document", func(t *testing.T) {
+		resp, err := ts.POST("/collections/pending/documents/1/move", map[string]interface{}{"dest": "completed"})
+		require.NoError(t, err)
+		body, err := ReadResponseBody(resp)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, resp.StatusCode, body)
+
+		var result map[string]interface{}
+		require.NoError(t, json.Unmarshal([]byte(body), &result))
+		document := result["document"].(map[string]interface{})
+		assert.Equal(t, "build", document["task"])
+		assert.Equal(t, "1", document["_id"])
+
+		resp, err = ts.GET("/collections/pending/documents/1")
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+		resp, err = ts.GET("/collections/completed/documents/1")
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	})
+
+	t.Run("kept id already taken", func(t *testing.T) {
+		resp, err := ts.POST("/collections/completed", map[string]interface{}{"task": "plan"})
+		require.NoError(t, err)
+		resp.Body.Close()
+
+		// completed assigned ID 2 itself, so pending/2 cannot keep its ID there
+		resp, err = ts.POST("/collections/pending/documents/2/move", map[string]interface{}{"dest": "completed", "keep_id": true})
+		require.NoError(t, err)
+		body, err := ReadResponseBody(resp)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusConflict, resp.StatusCode, body)
+		assert.Contains(t, body, ErrCodeDocumentExists)
+
+		resp, err = ts.GET("/collections/pending/documents/2")
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	})
+
+	t.Run("missing document", func(t *testing.T) {
+		resp, err := ts.POST("/collections/pending/documents/99/move", map[string]interface{}{"dest": "completed"})
+		require.NoError(t, err)
+		body, err := ReadResponseBody(resp)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+		assert.Contains(t, body, ErrCodeDocumentNotFound)
+	})
+
+	t.Run("invalid destinations", func(t *testing.T) {
+		for _, dest := range []string{"", "pending"} {
+			resp, err := ts.POST("/collections/pending/documents/2/move", map[string]interface{}{"dest": dest})
+			require.NoError(t, err)
+			resp.Body.Close()
+			assert.Equal(t, http.StatusBadRequest, resp.StatusCode, dest)
+		}
+	})
+}
+
+func TestAPI_Integration_ArraySlice(t *testing.T) {
+	ts := NewTestServer(t)
+	defer ts.Close(t)
+
+	resp, err := ts.POST("/collections/posts", map[string]interface{}{
+		"title":    "hello",
+		"comments": []interface{}{"c1", "c2", "c3", "c4"},
+	})
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	t.Run("returns a window", func(t *testing.T) {
+		resp, err := ts.GET("/collections/posts/documents/1/array/comments?offset=1&limit=2")
+		require.NoError(t, err)
+		body, err := ReadResponseBody(resp)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, resp.StatusCode, body)
+
+		var result map[string]interface{}
+		require.NoError(t, json.Unmarshal([]byte(body), &result))
+		assert.Equal(t, []interface{}{"c2", "c3"}, result["items"])
+		assert.Equal(t, float64(4), result["total"])
+		assert.Equal(t, true, result["has_more"])
+		assert.NotContains(t, result, "title")
+	})
+
+	for _, tc := range []struct {
+		name   string
+		path   string
+		status int
+		code   string
+	}{
+		{"not an array", "/collections/posts/documents/1/array/title", http.StatusBadRequest, ErrCodeInvalidField},
+		{"missing field", "/collections/posts/documents/1/array/likes", http.StatusNotFound, ErrCodeFieldNotFound},
+		{"missing document", "/collections/posts/documents/9/array/comments", http.StatusNotFound, ErrCodeDocumentNotFound},
+		{"invalid limit", "/collections/posts/documents/1/array/comments?limit=abc", http.StatusBadRequest, ErrCodeValidationFailed},
+		{"negative offset", "/collections/posts/documents/1/array/comments?offset=-1", http.StatusBadRequest, ErrCodeValidationFailed},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			resp, err := ts.GET(tc.path)
+			require.NoError(t, err)
+			body, err := ReadResponseBody(resp)
+			require.NoError(t, err)
+			assert.Equal(t, tc.status, resp.StatusCode, body)
+			assert.Contains(t, body, tc.code)
+		})
+	}
+}
+
+func TestAPI_Integration_DurableWrites(t *testing.T) {
+	ts := NewTestServer(t)
+	defer ts.Close(t)
+
+	resp, err := ts.POST("/collections/payments?durable=true", map[string]interface{}{"amount": 10})
+	require.NoError(t, err)
+	body, err := ReadResponseBody(resp)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusCreated, resp.StatusCode, body)
+
+	resp, err = ts.PATCH("/collections/payments/documents/1?durable=maybe", map[string]interface{}{"amount": 11})
+	require.NoError(t, err)
+	body, err = ReadResponseBody(resp)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode, body)
+
+	// A file in place of the collections directory makes every save fail
+	collectionsDir := filepath.Join(ts.TempDir, "collections")
+	require.NoError(t, os.RemoveAll(collectionsDir))
+	require.NoError(t, os.WriteFile(collectionsDir, []byte("blocked"), 0644))
+
+	resp, err = ts.POST("/collections/payments", map[string]interface{}{"amount": 20})
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+
+	resp, err = ts.POST("/collections/payments?durable=true", map[string]interface{}{"amount": 30})
+	require.NoError(t, err)
+	body, err = ReadResponseBody(resp)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode, body)
+	assert.Contains(t, body, ErrCodeNotDurable)
+
+	resp, err = ts.DELETE("/collections/payments/documents/1?durable=true")
+	require.NoError(t, err)
+	body, err = ReadResponseBody(resp)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode, body)
+}
+
+func TestAPI_Integration_ValidateSchema(t *testing.T) {
+	ts := NewTestServer(t)
+	defer ts.Close(t)
+
+	for _, user := range []map[string]interface{}{
+		{"name": "Alice", "joined": "2024-01-01T00:00:00Z"},
+		{"name": "Bob", "joined": "last week"},
+		{"naem": "Carol"},
+	} {
+		resp, err := ts.POST("/collections/users", user)
+		require.NoError(t, err)
+		resp.Body.Close()
+	}
+
+	readStatus := func(t *testing.T, resp *http.Response) SchemaValidationStatus {
+		body, err := ReadResponseBody(resp)
+		require.NoError(t, err)
+		var status SchemaValidationStatus
+		require.NoError(t, json.Unmarshal([]byte(body), &status))
+		return status
+	}
+
+	t.Run("No Schema", func(t *testing.T) {
+		resp, err := ts.POST("/collections/users/validate", nil)
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusConflict, resp.StatusCode)
+	})
+
+	t.Run("Reports Violations", func(t *testing.T) {
+		resp, err := ts.PUT("/collections/users/schema", map[string]interface{}{
+			"fields": map[string]interface{}{"name": "any", "joined": "time"},
+		})
+		require.NoError(t, err)
+		resp.Body.Close()
+
+		resp, err = ts.POST("/collections/users/validate", nil)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusAccepted, resp.StatusCode)
+		started := readStatus(t, resp)
+		require.NotEmpty(t, started.JobID)
+
+		var status SchemaValidationStatus
+		require.Eventually(t, func() bool {
+			resp, err := ts.GET("/collections/users/validate/status?job_id=" + started.JobID)
+			require.NoError(t, err)
+			require.Equal(t, http.StatusOK, resp.StatusCode)
+			status = readStatus(t, resp)
+			return status.State != RebuildStateRunning
+		}, 5*time.Second, 10*time.Millisecond)
+
+		assert.Equal(t, RebuildStateCompleted, status.State)
+		assert.Equal(t, 3, status.Scanned)
+		assert.Equal(t, 2, status.Invalid)
+		assert.False(t, status.Truncated)
+		assert.ElementsMatch(t, []SchemaViolation{
+			{ID: "2", Reasons: []string{"field joined is not a time"}},
+			{ID: "3", Reasons: []string{"field not in schema: naem"}},
+		}, status.Violations)
+
+		// Nothing is modified
+		resp, err = ts.GET("/collections/users/documents/3")
+		require.NoError(t, err)
+		body, err := ReadResponseBody(resp)
+		require.NoError(t, err)
+		assert.Contains(t, body, `"naem":"Carol"`)
+
+		resp, err = ts.DELETE("/collections/users/validate")
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusConflict, resp.StatusCode, "validation has already finished")
+	})
+
+	t.Run("Unknown Job", func(t *testing.T) {
+		resp, err := ts.GET("/collections/users/validate/status?job_id=validation-99")
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+		resp, err = ts.GET("/collections/orders/validate/status")
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	})
+}
+
+func TestAPI_Integration_PrettyJSON(t *testing.T) {
+	ts := NewTestServer(t)
+	defer ts.Close(t)
+
+	for _, doc := range []map[string]interface{}{
+		{"name": `Alice "Al" {x}`, "tags": []string{}, "meta": map[string]interface{}{}, "zeta": 1, "alpha": []int{1, 2}},
+		{"name": "Bob\\", "nested": map[string]interface{}{"b": true, "a": nil}},
+	} {
+		resp, err := ts.POST("/collections/users", doc)
+		require.NoError(t, err)
+		resp.Body.Close()
+	}
+
+	// Each pretty body is the compact body indented like json.Indent
+	assertPretty := func(t *testing.T, path string) string {
+		resp, err := ts.GET(path)
+		require.NoError(t, err)
+		compact, err := ReadResponseBody(resp)
+		require.NoError(t, err)
+
+		sep := "?"
+		if strings.Contains(path, "?") {
+			sep = "&"
+		}
+		resp, err = ts.GET(path + sep + "pretty=true")
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		pretty, err := ReadResponseBody(resp)
+		require.NoError(t, err)
+
+		var expected bytes.Buffer
+		require.NoError(t, json.Indent(&expected, []byte(compact), "", "  "))
+		assert.Equal(t, strings.TrimSpace(expected.String()), strings.TrimSpace(pretty))
+		assert.True(t, strings.HasSuffix(pretty, "\n"))
+		return pretty
+	}
+
+	t.Run("Enveloped Find", func(t *testing.T) {
+		pretty := assertPretty(t, "/collections/users/find")
+		assert.Contains(t, pretty, "\n  \"documents\": [\n    {\n")
+		assert.Contains(t, pretty, `"tags": []`)
+		assert.Contains(t, pretty, `"meta": {}`)
+		// Document keys are always sorted
+		assert.Less(t, strings.Index(pretty, `"alpha"`), strings.Index(pretty, `"zeta"`))
+	})
+
+	t.Run("Bare Array And Document", func(t *testing.T) {
+		assertPretty(t, "/collections/users/find?envelope=false")
+		assertPretty(t, "/collections/users/documents/2")
+	})
+
+	t.Run("Stream", func(t *testing.T) {
+		// One document, as the stream order is not fixed
+		pretty := assertPretty(t, "/collections/users/find_with_stream?zeta=1")
+		assert.True(t, strings.HasPrefix(pretty, "[\n  {\n"), pretty)
+	})
+
+	t.Run("Not A Filter", func(t *testing.T) {
+		resp, err := ts.GET("/collections/users/find?pretty=true&name=Bob%5C")
+		require.NoError(t, err)
+		body, err := ReadResponseBody(resp)
+		require.NoError(t, err)
+		assert.Contains(t, body, "\"_id\": \"2\"")
+	})
+
+	t.Run("Errors Are Indented", func(t *testing.T) {
+		resp, err := ts.GET("/collections/users/documents/99?pretty=true")
+		require.NoError(t, err)
+		body, err := ReadResponseBody(resp)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+		assert.Contains(t, body, "{\n  \"error\": {\n    \"code\": \"DOCUMENT_NOT_FOUND\"")
+	})
+
+	t.Run("Invalid Value", func(t *testing.T) {
+		resp, err := ts.GET("/collections/users/find?pretty=yes")
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	})
+}
+
+func TestAPI_Integration_Upsert(t *testing.T) {
+	ts := NewTestServer(t)
+	defer ts.Close(t)
+
+	upsert := func(t *testing.T, body map[string]interface{}) (int, map[string]interface{}) {
+		resp, err := ts.POST("/collections/users/upsert", body)
+		require.NoError(t, err)
+		raw, err := ReadResponseBody(resp)
+		require.NoError(t, err)
+		var doc map[string]interface{}
+		require.NoError(t, json.Unmarshal([]byte(raw), &doc))
+		return resp.StatusCode, doc
+	}
+
+	t.Run("Creates Then Updates", func(t *testing.T) {
+		status, doc := upsert(t, map[string]interface{}{
+			"filter": map[string]interface{}{"email": "alice@example.com"},
+			"update": map[string]interface{}{
+				"$set":         map[string]interface{}{"name": "Alice"},
+				"$setOnInsert": map[string]interface{}{"created_at": "2024-01-01T00:00:00Z"},
+			},
+		})
+		assert.Equal(t, http.StatusCreated, status)
+		assert.Equal(t, "alice@example.com", doc["email"])
+		assert.Equal(t, "2024-01-01T00:00:00Z", doc["created_at"])
+
+		status, doc = upsert(t, map[string]interface{}{
+			"filter": map[string]interface{}{"email": "alice@example.com"},
+			"update": map[string]interface{}{
+				"$set":         map[string]interface{}{"name": "Alice Smith"},
+				"$setOnInsert": map[string]interface{}{"created_at": "2025-06-01T00:00:00Z"},
+			},
+		})
+		assert.Equal(t, http.StatusOK, status)
+		assert.Equal(t, "1", doc["_id"])
+		assert.Equal(t, "Alice Smith", doc["name"])
+		assert.Equal(t, "2024-01-01T00:00:00Z", doc["created_at"])
+	})
+
+	t.Run("Invalid Update", func(t *testing.T) {
+		status, doc := upsert(t, map[string]interface{}{
+			"filter": map[string]interface{}{"email": "alice@example.com"},
+			"update": map[string]interface{}{"$set": map[string]interface{}{"_id": "2"}},
+		})
+		assert.Equal(t, http.StatusBadRequest, status)
+		assert.Equal(t, ErrCodeInvalidField, doc["error"].(map[string]interface{})["code"])
+
+		status, _ = upsert(t, map[string]interface{}{"update": map[string]interface{}{"name": "x"}})
+		assert.Equal(t, http.StatusBadRequest, status, "filter is required")
+	})
+}
+
+func TestAPI_Integration_BatchInsertIndexes(t *testing.T) {
+	ts := NewTestServer(t)
+	defer ts.Close(t)
+
+	t.Run("Creates Collection With Indexes", func(t *testing.T) {
+		resp, err := ts.POST("/collections/users/batch", map[string]interface{}{
+			"documents": []map[string]interface{}{
+				{"name": "Alice", "city": "Paris"},
+				{"name": "Bob", "city": "Berlin"},
+			},
+			"indexes": []string{"city", "name", "city"},
+		})
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusCreated, resp.StatusCode)
+
+		indexes, err := ts.Storage.GetIndexes("users")
+		require.NoError(t, err)
+		assert.Contains(t, indexes, "city")
+		assert.Contains(t, indexes, "name")
+
+		docs, err := ts.Storage.FindByIndex("users", "city", "Paris")
+		require.NoError(t, err)
+		require.Len(t, docs, 1)
+		assert.Equal(t, "Alice", docs[0]["name"])
+	})
+
+	t.Run("Adds Missing Indexes To Existing Collection", func(t *testing.T) {
+		resp, err := ts.POST("/collections/users/batch", map[string]interface{}{
+			"documents": []map[string]interface{}{{"name": "Carol", "city": "Paris", "age": 41}},
+			"indexes":   []string{"city", "age"},
+		})
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusCreated, resp.StatusCode)
+
+		docs, err := ts.Storage.FindByIndex("users", "city", "Paris")
+		require.NoError(t, err)
+		assert.Len(t, docs, 2)
+		docs, err = ts.Storage.FindByIndex("users", "age", float64(41))
+		require.NoError(t, err)
+		assert.Len(t, docs, 1)
+	})
+
+	t.Run("Rejects Empty Field", func(t *testing.T) {
+		resp, err := ts.POST("/collections/others/batch", map[string]interface{}{
+			"documents": []map[string]interface{}{{"name": "Dave"}},
+			"indexes":   []string{""},
+		})
+		require.NoError(t, err)
+		body, err := ReadResponseBody(resp)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+		assert.Contains(t, body, ErrCodeInvalidField)
+	})
+}
+
+func TestAPI_Integration_InsertLocation(t *testing.T) {
+	ts := NewTestServer(t)
+	defer ts.Close(t)
+
+	decode := func(t *testing.T, resp *http.Response, v interface{}) {
+		body, err := ReadResponseBody(resp)
+		require.NoError(t, err)
+		require.NoError(t, json.Unmarshal([]byte(body), v), body)
+	}
+
+	t.Run("Insert", func(t *testing.T) {
+		resp, err := ts.POST("/collections/users", map[string]interface{}{"name": "Alice"})
+		require.NoError(t, err)
+		require.Equal(t, http.StatusCreated, resp.StatusCode)
+		location := resp.Header.Get("Location")
+		var doc map[string]interface{}
+		decode(t, resp, &doc)
+		assert.Equal(t, "/collections/users/documents/"+doc["_id"].(string), location)
+
+		resp, err = ts.GET(location)
+		require.NoError(t, err)
+		var fetched map[string]interface{}
+		decode(t, resp, &fetched)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "Alice", fetched["name"])
+	})
+
+	t.Run("Client Supplied ID", func(t *testing.T) {
+		resp, err := ts.POST("/collections/users", map[string]interface{}{"_id": "a b/c", "name": "Bob"})
+		require.NoError(t, err)
+		require.Equal(t, http.StatusCreated, resp.StatusCode)
+		location := resp.Header.Get("Location")
+		var doc map[string]interface{}
+		decode(t, resp, &doc)
+		assert.Equal(t, "/collections/users/documents/"+url.PathEscape(doc["_id"].(string)), location)
+
+		resp, err = ts.GET(location)
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	})
+
+	t.Run("Not Created", func(t *testing.T) {
+		resp, err := ts.POST("/collections/users?unlessExists="+url.QueryEscape(`{"name":"Alice"}`), map[string]interface{}{"name": "Alice"})
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Empty(t, resp.Header.Get("Location"))
+	})
+
+	t.Run("Upsert", func(t *testing.T) {
+		resp, err := ts.POST("/collections/users/upsert", map[string]interface{}{
+			"filter": map[string]interface{}{"name": "Carol"},
+			"update": map[string]interface{}{"age": 40},
+		})
+		require.NoError(t, err)
+		require.Equal(t, http.StatusCreated, resp.StatusCode)
+		location := resp.Header.Get("Location")
+		var doc map[string]interface{}
+		decode(t, resp, &doc)
+		assert.Equal(t, "/collections/users/documents/"+doc["_id"].(string), location)
+	})
+
+	t.Run("Batch Insert IDs", func(t *testing.T) {
+		resp, err := ts.POST("/collections/users/batch", map[string]interface{}{
+			"documents": []map[string]interface{}{{"name": "Dave"}, {"name": "Erin"}},
+		})
+		require.NoError(t, err)
+		require.Equal(t, http.StatusCreated, resp.StatusCode)
+		var result BatchInsertResponse
+		decode(t, resp, &result)
+		require.Len(t, result.IDs, 2)
+		for i, doc := range result.Documents {
+			assert.Equal(t, doc["_id"], result.IDs[i])
+		}
+	})
+}
+
+func TestAPI_Integration_UpdateMaxMin(t *testing.T) {
+	ts := NewTestServer(t)
+	defer ts.Close(t)
+
+	resp, err := ts.POST("/collections/players", map[string]interface{}{"name": "Alice", "highScore": 300})
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	patch := func(t *testing.T, body map[string]interface{}) (int, map[string]interface{}) {
+		resp, err := ts.PATCH("/collections/players/documents/1", body)
+		require.NoError(t, err)
+		raw, err := ReadResponseBody(resp)
+		require.NoError(t, err)
+		var doc map[string]interface{}
+		require.NoError(t, json.Unmarshal([]byte(raw), &doc))
+		return resp.StatusCode, doc
+	}
+
+	status, doc := patch(t, map[string]interface{}{"$max": map[string]interface{}{"highScore": 500}})
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, float64(500), doc["highScore"])
+
+	status, doc = patch(t, map[string]interface{}{"$max": map[string]interface{}{"highScore": 400}, "name": "Alice Smith"})
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, float64(500), doc["highScore"])
+	assert.Equal(t, "Alice Smith", doc["name"])
+
+	status, doc = patch(t, map[string]interface{}{"$min": map[string]interface{}{"highScore": "low"}})
+	assert.Equal(t, http.StatusBadRequest, status)
+	assert.Equal(t, ErrCodeInvalidField, doc["error"].(map[string]interface{})["code"])
+
+	status, doc = patch(t, map[string]interface{}{"$inc": map[string]interface{}{"highScore": 25, "games": 1}})
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, float64(525), doc["highScore"])
+	assert.Equal(t, float64(1), doc["games"])
+
+	status, doc = patch(t, map[string]interface{}{"$inc": map[string]interface{}{"name": 1}})
+	assert.Equal(t, http.StatusBadRequest, status)
+	assert.Equal(t, ErrCodeInvalidField, doc["error"].(map[string]interface{})["code"])
+}
+
+func TestAPI_Integration_AdminJobs(t *testing.T) {
+	ts := NewTestServer(t)
+	defer ts.Close(t)
+	ts.Handler.ApplyOptions(WithAdminToken("s3cret"))
+
+	for _, team := range []string{"core", "web"} {
+		resp, err := ts.POST("/collections/users", map[string]interface{}{"team": team})
+		require.NoError(t, err)
+		resp.Body.Close()
+	}
+
+	admin := func(t *testing.T, method, path string) *http.Response {
+		req, err := http.NewRequest(method, ts.BaseURL+path, nil)
+		require.NoError(t, err)
+		req.Header.Set("Authorization", "Bearer s3cret")
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		return resp
+	}
+	listJobs := func(t *testing.T, query string) []JobStatus {
+		resp := admin(t, http.MethodGet, "/admin/jobs"+query)
+		body, err := ReadResponseBody(resp)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, resp.StatusCode, body)
+		var result struct {
+			Success bool        `json:"success"`
+			Jobs    []JobStatus `json:"jobs"`
+		}
+		require.NoError(t, json.Unmarshal([]byte(body), &result))
+		assert.True(t, result.Success)
+		return result.Jobs
+	}
+
+	resp, err := ts.POST("/collections/users/indexes/rebuild", nil)
+	require.NoError(t, err)
+	body, err := ReadResponseBody(resp)
+	require.NoError(t, err)
+	var started IndexRebuildStatus
+	require.NoError(t, json.Unmarshal([]byte(body), &started))
+
+	t.Run("List Jobs", func(t *testing.T) {
+		var jobs []JobStatus
+		require.Eventually(t, func() bool {
+			jobs = listJobs(t, "")
+			return len(jobs) == 1 && jobs[0].State != RebuildStateRunning
+		}, 5*time.Second, 10*time.Millisecond)
+
+		job := jobs[0]
+		assert.Equal(t, started.JobID, job.ID)
+		assert.Equal(t, JobTypeRebuild, job.Type)
+		assert.Equal(t, "users", job.Collection)
+		assert.Equal(t, RebuildStateCompleted, job.State)
+		assert.Equal(t, 2, job.Processed)
+		assert.Equal(t, 2, job.Total)
+		assert.NotNil(t, job.FinishedAt)
+
+		assert.Len(t, listJobs(t, "?type="+JobTypeRebuild), 1)
+		assert.Empty(t, listJobs(t, "?type="+JobTypeMigration))
+		assert.Empty(t, listJobs(t, "?state="+RebuildStateRunning))
+	})
+
+	t.Run("Get Job", func(t *testing.T) {
+		resp := admin(t, http.MethodGet, "/admin/jobs/"+started.JobID)
+		body, err := ReadResponseBody(resp)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, resp.StatusCode, body)
+		var job JobStatus
+		require.NoError(t, json.Unmarshal([]byte(body), &job))
+		assert.Equal(t, started.JobID, job.ID)
+
+		resp = admin(t, http.MethodGet, "/admin/jobs/rebuild-99")
+		resp.Body.Close()
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	})
+
+	t.Run("Cancel Finished Job", func(t *testing.T) {
+		resp := admin(t, http.MethodDelete, "/admin/jobs/"+started.JobID)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusConflict, resp.StatusCode)
+	})
+
+	t.Run("Finished Jobs Expire", func(t *testing.T) {
+		ts.Handler.ApplyOptions(WithJobRetention(0))
+		require.Eventually(t, func() bool {
+			return len(listJobs(t, "")) == 0
+		}, 5*time.Second, 10*time.Millisecond)
+
+		resp := admin(t, http.MethodGet, "/admin/jobs/"+started.JobID)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	})
+}
+
+func TestAPI_Integration_AdminCancelJob(t *testing.T) {
+	engine := storage.NewStorageEngine(storage.WithNoSaves(true))
+	defer engine.StopBackgroundWorkers()
+
+	handler := NewHandler(&blockingStorage{engine}, engine.GetIndexEngine(), WithAdminToken("s3cret"))
+	router := mux.NewRouter()
+	handler.RegisterRoutes(router)
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	resp, err := http.Post(server.URL+"/collections/users/indexes/rebuild", "application/json", nil)
+	require.NoError(t, err)
+	var started IndexRebuildStatus
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&started))
+	resp.Body.Close()
+
+	getJob := func() JobStatus {
+		req, err := http.NewRequest(http.MethodGet, server.URL+"/admin/jobs/"+started.JobID, nil)
+		require.NoError(t, err)
+		req.Header.Set("Authorization", "Bearer s3cret")
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		var job JobStatus
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&job))
+		return job
+	}
+
+	require.Eventually(t, func() bool {
+		return getJob().Processed == 5
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, RebuildStateRunning, getJob().State)
+
+	req, err := http.NewRequest(http.MethodDelete, server.URL+"/admin/jobs/"+started.JobID, nil)
+	require.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer s3cret")
+	resp, err = http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusAccepted, resp.StatusCode)
+
+	// The per-collection status reports the same cancellation
+	require.Eventually(t, func() bool {
+		return getJob().State == RebuildStateCancelled
+	}, 5*time.Second, 10*time.Millisecond)
+	resp, err = http.Get(server.URL + "/collections/users/indexes/rebuild/status")
+	require.NoError(t, err)
+	var status IndexRebuildStatus
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&status))
+	resp.Body.Close()
+	assert.Equal(t, RebuildStateCancelled, status.State)
+}
+
+func TestAPI_Integration_Lookup(t *testing.T) {
+	ts := NewTestServer(t)
+	defer ts.Close(t)
+
+	for _, user := range []map[string]interface{}{
+		{"name": "Alice", "team": "core"},
+		{"name": "Bob", "team": "core"},
+		{"name": "Carol", "team": "web"},
+	} {
+		resp, err := ts.POST("/collections/users", user)
+		require.NoError(t, err)
+		resp.Body.Close()
+	}
+	for _, order := range []map[string]interface{}{
+		{"item": "book", "userId": "1", "team": "core"},
+		{"item": "lamp", "userId": 3, "team": "web"},
+		{"item": "desk", "userId": "99", "team": "ops"},
+	} {
+		resp, err := ts.POST("/collections/orders", order)
+		require.NoError(t, err)
+		resp.Body.Close()
+	}
+
+	lookup := func(t *testing.T, req map[string]interface{}) (*http.Response, map[string]map[string]interface{}) {
+		resp, err := ts.POST("/collections/orders/lookup", req)
+		require.NoError(t, err)
+		body, err := ReadResponseBody(resp)
+		require.NoError(t, err)
+		if resp.StatusCode != http.StatusOK {
+			return resp, nil
+		}
+		var docs []map[string]interface{}
+		require.NoError(t, json.Unmarshal([]byte(body), &docs), body)
+		byItem := make(map[string]map[string]interface{}, len(docs))
+		for _, doc := range docs {
+			byItem[doc["item"].(string)] = doc
+		}
+		return resp, byItem
+	}
+
+	t.Run("Lookup By ID", func(t *testing.T) {
+		resp, orders := lookup(t, map[string]interface{}{"localField": "userId", "from": "users", "foreignField": "_id", "as": "user"})
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		require.Len(t, orders, 3)
+		assert.Equal(t, "3", resp.Trailer.Get(TotalCountHeader))
+		assert.Empty(t, resp.Trailer.Get(LookupTruncatedTrailer))
+
+		assert.Equal(t, "Alice", orders["book"]["user"].(map[string]interface{})["name"])
+		assert.Equal(t, "Carol", orders["lamp"]["user"].(map[string]interface{})["name"], "numeric references match string IDs")
+		assert.Contains(t, orders["desk"], "user")
+		assert.Nil(t, orders["desk"]["user"], "missing references embed null")
+	})
+
+	t.Run("Lookup With Filter", func(t *testing.T) {
+		resp, orders := lookup(t, map[string]interface{}{"filter": map[string]interface{}{"item": "book"}, "localField": "userId", "from": "users", "foreignField": "_id", "as": "user"})
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Len(t, orders, 1)
+		assert.Contains(t, orders, "book")
+	})
+
+	t.Run("Lookup By Index", func(t *testing.T) {
+		req := map[string]interface{}{"localField": "team", "from": "users", "foreignField": "team", "as": "members", "maxMatches": 1}
+		resp, _ := lookup(t, req)
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode, "the foreign field must be indexed")
+
+		resp, err := ts.POST("/collections/users/indexes/team", nil)
+		require.NoError(t, err)
+		resp.Body.Close()
+
+		resp, orders := lookup(t, req)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "true", resp.Trailer.Get(LookupTruncatedTrailer))
+		members := orders["book"]["members"].([]interface{})
+		require.Len(t, members, 1)
+		assert.Equal(t, "Alice", members[0].(map[string]interface{})["name"])
+		assert.Len(t, orders["lamp"]["members"], 1)
+		assert.Nil(t, orders["desk"]["members"])
+	})
+
+	t.Run("Invalid Lookups", func(t *testing.T) {
+		resp, _ := lookup(t, map[string]interface{}{"localField": "userId", "from": "users", "foreignField": "_id"})
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+		resp, _ = lookup(t, map[string]interface{}{"localField": "userId", "from": "accounts", "foreignField": "_id", "as": "user"})
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	})
+}
+
+func TestAPI_Integration_ModifiedSince(t *testing.T) {
+	ts := NewTestServer(t, storage.WithAutoTimestamps(true))
+	defer ts.Close(t)
+
+	resp, err := ts.POST("/collections/users", map[string]interface{}{"name": "Alice"})
+	require.NoError(t, err)
+	resp.Body.Close()
+	time.Sleep(time.Millisecond)
+	since := url.QueryEscape(time.Now().Format(time.RFC3339Nano))
+	time.Sleep(time.Millisecond)
+	resp, err = ts.POST("/collections/users", map[string]interface{}{"name": "Bob"})
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	find := func(t *testing.T, query string) (*http.Response, []map[string]interface{}) {
+		resp, err := ts.GET("/collections/users/find?envelope=false&" + query)
+		require.NoError(t, err)
+		body, err := ReadResponseBody(resp)
+		require.NoError(t, err)
+		var documents []map[string]interface{}
+		if resp.StatusCode == http.StatusOK {
+			require.NoError(t, json.Unmarshal([]byte(body), &documents))
+		}
+		return resp, documents
+	}
+
+	t.Run("Modified Since", func(t *testing.T) {
+		resp, documents := find(t, "modifiedSince="+since)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		require.Len(t, documents, 1)
+		assert.Equal(t, "Bob", documents[0]["name"])
+
+		resp, documents = find(t, "modifiedSince="+since+"&name=Alice")
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Empty(t, documents)
+	})
+
+	t.Run("Modified Since With Index", func(t *testing.T) {
+		resp, err := ts.POST("/collections/users/indexes/_updated_at", nil)
+		require.NoError(t, err)
+		resp.Body.Close()
+		require.Equal(t, http.StatusCreated, resp.StatusCode)
+
+		resp, documents := find(t, "modifiedSince="+since)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		require.Len(t, documents, 1)
+		assert.Equal(t, "Bob", documents[0]["name"])
+	})
+
+	t.Run("Invalid Modified Since", func(t *testing.T) {
+		resp, _ := find(t, "modifiedSince=yesterday")
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+		resp, _ = find(t, "modifiedField=_updated_at")
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode, "modifiedField requires modifiedSince")
+	})
+}
+
+func TestAPI_Integration_ModifiedSinceWithoutTimestamps(t *testing.T) {
+	ts := NewTestServer(t)
+	defer ts.Close(t)
+
+	for _, doc := range []map[string]interface{}{
+		{"name": "Alice", "changedAt": "2024-01-01T00:00:00Z"},
+		{"name": "Bob", "changedAt": "2024-06-01T00:00:00Z"},
+	} {
+		resp, err := ts.POST("/collections/users", doc)
+		require.NoError(t, err)
+		resp.Body.Close()
+	}
+
+	resp, err := ts.GET("/collections/users/find?modifiedSince=2024-03-01T00:00:00Z")
+	require.NoError(t, err)
+	body, err := ReadResponseBody(resp)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusNotImplemented, resp.StatusCode)
+	var errResp ErrorResponse
+	require.NoError(t, json.Unmarshal([]byte(body), &errResp))
+	assert.Equal(t, ErrCodeTimestampsDisabled, errResp.Error.Code)
+
+	// A collection that keeps its own modification times names the field
+	resp, err = ts.GET("/collections/users/find?envelope=false&modifiedSince=2024-03-01T00:00:00Z&modifiedField=changedAt")
+	require.NoError(t, err)
+	body, err = ReadResponseBody(resp)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var documents []map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(body), &documents))
+	require.Len(t, documents, 1)
+	assert.Equal(t, "Bob", documents[0]["name"])
+}
+
+func TestAPI_Integration_CompactCollection(t *testing.T) {
+	ts := NewTestServer(t)
+	defer ts.Close(t)
+
+	resp, err := ts.POST("/collections", map[string]interface{}{"name": "events", "compact": true})
+	require.NoError(t, err)
+	body, err := ReadResponseBody(resp)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	assert.Contains(t, body, `"compact":true`)
+
+	resp, err = ts.POST("/collections/events", map[string]interface{}{"kind": "click", "tags": []interface{}{"a", "b"}})
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+
+	// Documents read back as they were written
+	resp, err = ts.GET("/collections/events/documents/1")
+	require.NoError(t, err)
+	body, err = ReadResponseBody(resp)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	var doc map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(body), &doc))
+	assert.Equal(t, "click", doc["kind"])
+	assert.Equal(t, []interface{}{"a", "b"}, doc["tags"])
+
+	resp, err = ts.DELETE("/collections/events/compact")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+
+	resp, err = ts.GET("/collections/events/compact")
+	require.NoError(t, err)
+	body, err = ReadResponseBody(resp)
+	require.NoError(t, err)
+	assert.Contains(t, body, `"compact":false`)
+
+	resp, err = ts.PUT("/collections/events/compact", nil)
+	require.NoError(t, err)
+	body, err = ReadResponseBody(resp)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Contains(t, body, `"compact":true`)
+
+	resp, err = ts.GET("/collections/events/documents/1")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func TestAPI_Integration_SortField(t *testing.T) {
+	ts := NewTestServer(t)
+	defer ts.Close(t)
+
+	for _, doc := range []map[string]interface{}{{"name": "Carol", "age": 35}, {"name": "Alice", "age": 9}, {"name": "Bob"}, {"name": "Dave", "age": 100}} {
+		resp, err := ts.POST("/collections/users", doc)
+		require.NoError(t, err)
+		resp.Body.Close()
+	}
+
+	findNames := func(t *testing.T, path string) []string {
+		resp, err := ts.GET(path)
+		require.NoError(t, err)
+		body, err := ReadResponseBody(resp)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, resp.StatusCode, body)
+
+		var result struct {
+			Documents []map[string]interface{} `json:"documents"`
+		}
+		require.NoError(t, json.Unmarshal([]byte(body), &result))
+		var names []string
+		for _, doc := range result.Documents {
+			names = append(names, doc["name"].(string))
+		}
+		return names
+	}
+
+	assert.Equal(t, []string{"Alice", "Carol", "Dave", "Bob"}, findNames(t, "/collections/users/find?sort=age"))
+	assert.Equal(t, []string{"Dave", "Carol", "Alice", "Bob"}, findNames(t, "/collections/users/find?sort=age&order=desc"))
+	assert.Equal(t, []string{"Bob", "Carol"}, findNames(t, "/collections/users/find?sort=name&order=asc&limit=2&offset=1"))
+
+	resp, err := ts.GET("/collections/users/find?sort=age&order=inserted")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	// Byte order puts capitals first; the ci collation ignores case
+	for _, name := range []string{"alice", "Bob", "charlie"} {
+		resp, err := ts.POST("/collections/pets", map[string]interface{}{"name": name})
+		require.NoError(t, err)
+		resp.Body.Close()
+	}
+	assert.Equal(t, []string{"Bob", "alice", "charlie"}, findNames(t, "/collections/pets/find?sort=name"))
+	assert.Equal(t, []string{"alice", "Bob", "charlie"}, findNames(t, "/collections/pets/find?sort=name&collation=ci"))
+	assert.Equal(t, []string{"charlie", "Bob", "alice"}, findNames(t, "/collections/pets/find?sort=name&order=desc&collation=ci"))
+
+	// Accents sort after every ASCII letter by byte; ci_ai files them with their letter
+	for _, name := range []string{"José", "jose", "Émile"} {
+		resp, err := ts.POST("/collections/pets", map[string]interface{}{"name": name})
+		require.NoError(t, err)
+		resp.Body.Close()
+	}
+	assert.Equal(t, []string{"alice", "Bob", "charlie", "Émile", "José", "jose"}, findNames(t, "/collections/pets/find?sort=name&collation=ci_ai"))
+
+	// The collation applies to the filter's equality conditions too
+	assert.Equal(t, []string{"jose"}, findNames(t, "/collections/pets/find?name=JOSE"))
+	assert.Equal(t, []string{"José"}, findNames(t, "/collections/pets/find?name=Jose&collation=ai"))
+	assert.Equal(t, []string{"José", "jose"}, findNames(t, "/collections/pets/find?name=JOSE&collation=ci_ai&sort=_id"))
+
+	// A collated index answers filters with its collation
+	resp, err = ts.POST("/collections/pets/indexes/name?collation=ci_ai", nil)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	assert.Equal(t, []string{"José", "jose"}, findNames(t, "/collections/pets/find?name=JOSE&collation=ci_ai&sort=_id"))
+	assert.Equal(t, []string{"jose"}, findNames(t, "/collections/pets/find?name=JOSE"))
+
+	for _, path := range []string{"/collections/pets/find?sort=name&collation=fr", "/collections/pets/find?name=jose&collation=fr"} {
+		resp, err := ts.GET(path)
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode, path)
+	}
+	for _, path := range []string{"/collections/pets/indexes/age?collation=fr", "/collections/pets/indexes/age?collation=ci&typeCheck=report"} {
+		resp, err := ts.POST(path, nil)
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode, path)
+	}
+}
+
+func TestAPI_Integration_Version(t *testing.T) {
+	engine := storage.NewStorageEngine(storage.WithNoSaves(true))
+	defer engine.StopBackgroundWorkers()
+
+	handler := NewHandler(engine, engine.GetIndexEngine(), WithVersion("v1.4.0"), WithEngine("v1"))
+	router := mux.NewRouter()
+	handler.RegisterRoutes(router)
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/version")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var result VersionResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&result))
+	assert.Equal(t, "v1.4.0", result.Version)
+	assert.Equal(t, storage.FormatVersion, result.FormatVersion)
+	assert.Equal(t, "v1", result.Engine)
+	assert.Contains(t, result.FilterOperators, storage.InFilterKey)
+	assert.Contains(t, result.FilterOperators, storage.ExprFilterKey)
+
+	// Builds without a configured version report the default
+	ts := NewTestServer(t)
+	defer ts.Close(t)
+
+	resp, err = ts.GET("/version")
+	require.NoError(t, err)
+	body, err := ReadResponseBody(resp)
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal([]byte(body), &result))
+	assert.Equal(t, DefaultVersion, result.Version)
+}
+
+func TestAPI_Integration_InvalidCollectionName(t *testing.T) {
+	engine := storage.NewStorageEngine(storage.WithNoSaves(true))
+	defer engine.StopBackgroundWorkers()
+
+	handler := NewHandler(engine, engine.GetIndexEngine())
+	router := mux.NewRouter()
+	handler.RegisterRoutes(router)
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	t.Run("Insert Rejects Invalid Name", func(t *testing.T) {
+		resp, err := http.Post(server.URL+"/collections/bad.name", "application/json", bytes.NewBufferString(`{"name":"Alice"}`))
+		require.NoError(t, err)
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	})
+
+	t.Run("Batch Insert Rejects Invalid Name", func(t *testing.T) {
+		resp, err := http.Post(server.URL+"/collections/bad.name/batch", "application/json", bytes.NewBufferString(`{"documents":[{"name":"Alice"}]}`))
+		require.NoError(t, err)
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	})
+
+	t.Run("Valid Name Is Accepted", func(t *testing.T) {
+		resp, err := http.Post(server.URL+"/collections/good_name", "application/json", bytes.NewBufferString(`{"name":"Alice"}`))
+		require.NoError(t, err)
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	})
+}
+
+func TestAPI_Integration_QueryTimeout(t *testing.T) {
+	engine := storage.NewStorageEngine(storage.WithNoSaves(true))
+	defer engine.StopBackgroundWorkers()
+
+	handler := NewHandler(&blockingStorage{engine}, engine.GetIndexEngine(), WithQueryTimeout(50*time.Millisecond))
+	router := mux.NewRouter()
+	handler.RegisterRoutes(router)
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	t.Run("Find Returns 504 On Timeout", func(t *testing.T) {
+		start := time.Now()
+		resp, err := http.Get(server.URL + "/collections/users/find")
+		require.NoError(t, err)
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusGatewayTimeout, resp.StatusCode)
+		assert.Less(t, time.Since(start), 2*time.Second)
+	})
+
+	t.Run("Per-Request Timeout Is Capped By Server Max", func(t *testing.T) {
+		start := time.Now()
+		resp, err := http.Get(server.URL + "/collections/users/find?timeout=1h")
+		require.NoError(t, err)
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusGatewayTimeout, resp.StatusCode)
+		assert.Less(t, time.Since(start), 2*time.Second)
+	})
+
+	t.Run("Invalid Timeout", func(t *testing.T) {
+		resp, err := http.Get(server.URL + "/collections/users/find?timeout=soon")
+		require.NoError(t, err)
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	})
+
+	t.Run("Stream Sets Partial Results Trailer", func(t *testing.T) {
+		resp, err := http.Get(server.URL + "/collections/users/find_with_stream?timeout=20ms")
+		require.NoError(t, err)
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+
+		var documents []map[string]interface{}
+		require.NoError(t, json.Unmarshal(body, &documents))
+		assert.Len(t, documents, 1)
+		assert.Equal(t, "true", resp.Trailer.Get(PartialResultsTrailer))
+	})
+}
+
 func TestAPI_Integration_IndexOptimization(t *testing.T) {
 	ts := NewTestServer(t)
 	defer ts.Close(t)
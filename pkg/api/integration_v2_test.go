@@ -18,7 +18,6 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
-	"github.com/adfharrison1/go-db/pkg/indexing"
 	v2 "github.com/adfharrison1/go-db/pkg/storage/v2"
 )
 
@@ -40,15 +39,14 @@ func NewTestServerV2(t *testing.T, storageOptions ...v2.StorageOption) *TestServ
 	defaultOptions := []v2.StorageOption{
 		v2.WithDataDir(tempDir),
 		v2.WithWALDir(filepath.Join(tempDir, "wal")),
+		v2.WithCheckpointDir(filepath.Join(tempDir, "checkpoints")),
 	}
 
 	// Merge with provided options
 	allOptions := append(defaultOptions, storageOptions...)
 
 	storageEngine := v2.NewStorageEngine(allOptions...)
-	indexEngine := indexing.NewIndexEngine()
-
-	handler := NewHandler(storageEngine, indexEngine)
+	handler := NewHandler(storageEngine, storageEngine.GetIndexEngine())
 
 	router := mux.NewRouter()
 	handler.RegisterRoutes(router)
@@ -0,0 +1,158 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// DefaultJobRetention is how long GET /admin/jobs keeps listing a finished job
+const DefaultJobRetention = time.Hour
+
+// Types of background job
+const (
+	JobTypeRebuild    = "rebuild"
+	JobTypeMigration  = "migration"
+	JobTypeValidation = "validation"
+)
+
+// JobStatus summarises a background job of any type for GET /admin/jobs. State takes
+// the same values as an index rebuild (RebuildStateRunning and so on). Total is 0 when
+// the job does not know in advance how many documents it will process.
+type JobStatus struct {
+	ID         string     `json:"id"`
+	Type       string     `json:"type"`
+	Collection string     `json:"collection"`
+	State      string     `json:"state"`
+	Processed  int        `json:"processed"`
+	Total      int        `json:"total"`
+	Error      string     `json:"error,omitempty"`
+	StartedAt  time.Time  `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+}
+
+// backgroundJob is a job listed and cancelled through /admin/jobs
+type backgroundJob interface {
+	jobStatus() JobStatus
+	running() bool
+	stop()
+}
+
+// WithJobRetention sets how long finished background jobs stay listed by GET
+// /admin/jobs. Running jobs are always listed.
+func WithJobRetention(d time.Duration) HandlerOption {
+	return func(h *Handler) {
+		h.jobRetention = d
+	}
+}
+
+// registerJob lists a newly started job under /admin/jobs
+func (h *Handler) registerJob(job backgroundJob) {
+	h.jobsMu.Lock()
+	defer h.jobsMu.Unlock()
+	h.pruneJobsLocked(time.Now())
+	if h.jobs == nil {
+		h.jobs = make(map[string]backgroundJob)
+	}
+	h.jobs[job.jobStatus().ID] = job
+}
+
+// pruneJobsLocked drops jobs that finished more than the retention window before now
+// (caller must hold jobsMu)
+func (h *Handler) pruneJobsLocked(now time.Time) {
+	for id, job := range h.jobs {
+		status := job.jobStatus()
+		if status.FinishedAt != nil && now.Sub(*status.FinishedAt) > h.jobRetention {
+			delete(h.jobs, id)
+		}
+	}
+}
+
+// HandleListJobs handles GET requests for the background jobs that are running or
+// finished within the retention window, oldest first. Optional ?type= and ?state=
+// parameters keep only jobs of that type or state.
+func (h *Handler) HandleListJobs(w http.ResponseWriter, r *http.Request) {
+	logf(r, "INFO: handleListJobs called")
+
+	jobType := r.URL.Query().Get("type")
+	state := r.URL.Query().Get("state")
+
+	h.jobsMu.Lock()
+	h.pruneJobsLocked(time.Now())
+	jobs := make([]JobStatus, 0, len(h.jobs))
+	for _, job := range h.jobs {
+		status := job.jobStatus()
+		if (jobType == "" || status.Type == jobType) && (state == "" || status.State == state) {
+			jobs = append(jobs, status)
+		}
+	}
+	h.jobsMu.Unlock()
+
+	sort.Slice(jobs, func(i, j int) bool {
+		if !jobs[i].StartedAt.Equal(jobs[j].StartedAt) {
+			return jobs[i].StartedAt.Before(jobs[j].StartedAt)
+		}
+		return jobs[i].ID < jobs[j].ID
+	})
+
+	response := map[string]interface{}{
+		"success": true,
+		"jobs":    jobs,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// HandleGetJob handles GET requests for one background job by ID
+func (h *Handler) HandleGetJob(w http.ResponseWriter, r *http.Request) {
+	job, ok := h.findJob(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(job.jobStatus())
+}
+
+// HandleCancelJob handles DELETE requests that cancel a running background job by ID,
+// as the job type's own DELETE endpoint would
+func (h *Handler) HandleCancelJob(w http.ResponseWriter, r *http.Request) {
+	logf(r, "INFO: handleCancelJob called for job '%s'", mux.Vars(r)["id"])
+
+	job, ok := h.findJob(w, r)
+	if !ok {
+		return
+	}
+	if !job.running() {
+		writeError(w, http.StatusConflict, ErrCodeConflict, fmt.Sprintf("job %s has already finished", job.jobStatus().ID))
+		return
+	}
+	job.stop()
+
+	// The job reports cancelled once it notices, which may take a moment
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(job.jobStatus())
+}
+
+// findJob returns the job named by the request's id variable, writing a 404 if it is
+// unknown or past the retention window
+func (h *Handler) findJob(w http.ResponseWriter, r *http.Request) (backgroundJob, bool) {
+	id := mux.Vars(r)["id"]
+
+	h.jobsMu.Lock()
+	h.pruneJobsLocked(time.Now())
+	job, exists := h.jobs[id]
+	h.jobsMu.Unlock()
+
+	if !exists {
+		writeError(w, http.StatusNotFound, ErrCodeNotFound, fmt.Sprintf("job %s not found", id))
+		return nil, false
+	}
+	return job, true
+}
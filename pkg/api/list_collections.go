@@ -0,0 +1,23 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// HandleListCollections handles GET requests for a summary of every collection,
+// loaded or not, sorted by name
+func (h *Handler) HandleListCollections(w http.ResponseWriter, r *http.Request) {
+	logf(r, "INFO: handleListCollections called")
+
+	collections := h.storage.ListCollections()
+
+	response := map[string]interface{}{
+		"success":     true,
+		"collections": collections,
+		"count":       len(collections),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,156 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/adfharrison1/go-db/pkg/domain"
+	"github.com/adfharrison1/go-db/pkg/storage"
+	"github.com/gorilla/mux"
+)
+
+// LookupTruncatedTrailer is the HTTP trailer set to "true" when a lookup left out
+// foreign matches of at least one document to respect maxMatches
+const LookupTruncatedTrailer = "X-Lookup-Truncated"
+
+// LookupRequest represents the request body for a lookup
+type LookupRequest struct {
+	Filter map[string]interface{} `json:"filter,omitempty"`
+	storage.LookupSpec
+}
+
+// HandleLookup handles POST requests that stream the documents matching a filter,
+// each with the documents it references in another collection embedded (see
+// storage.LookupSpec), saving clients a round trip per document. The foreign side is
+// queried once per streamed document, by GetById when foreignField is _id and by
+// FindByIndex otherwise, so any other foreignField must be indexed. The response is
+// streamed like find_with_stream; a stream cut short by its timeout or a failed
+// foreign query sets the X-Partial-Results trailer.
+func (h *Handler) HandleLookup(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	collName := vars["coll"]
+
+	logf(r, "INFO: handleLookup called for collection '%s'", collName)
+
+	var req LookupRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		logf(r, "ERROR: Decoding body failed: %v", err)
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "Invalid request body")
+		return
+	}
+
+	find := storage.FindByID(func(docId string) (domain.Document, error) {
+		return h.storage.GetById(req.From, docId)
+	})
+	if req.ForeignField != "_id" {
+		find = func(value interface{}) ([]domain.Document, error) {
+			return h.storage.FindByIndex(req.From, req.ForeignField, value)
+		}
+	}
+	lookup, err := storage.NewLookup(req.LookupSpec, find)
+	if err != nil {
+		writeStorageError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	if _, err := h.storage.GetCollection(req.From); err != nil {
+		logf(r, "ERROR: Lookup collection '%s' not found: %v", req.From, err)
+		writeStorageError(w, err, http.StatusNotFound)
+		return
+	}
+	if req.ForeignField != "_id" {
+		indexes, err := h.storage.GetIndexes(req.From)
+		if err != nil {
+			writeStorageError(w, err, http.StatusInternalServerError)
+			return
+		}
+		if !containsString(indexes, req.ForeignField) {
+			writeError(w, http.StatusBadRequest, ErrCodeInvalidField,
+				fmt.Sprintf("foreignField %s is not indexed in collection %s; create an index on it or look up by _id", req.ForeignField, req.From))
+			return
+		}
+	}
+
+	ctx, cancel, err := h.queryContext(r)
+	if err != nil {
+		writeStorageError(w, err, http.StatusBadRequest)
+		return
+	}
+	defer cancel()
+
+	docChan, err := h.storage.FindAllStreamContext(ctx, collName, req.Filter)
+	if err != nil {
+		if errors.Is(err, domain.ErrInvalidFilter) {
+			logf(r, "ERROR: Invalid filter for collection '%s': %v", collName, err)
+			writeStorageError(w, err, http.StatusBadRequest)
+			return
+		}
+		logf(r, "ERROR: Collection '%s' not found: %v", collName, err)
+		writeStorageError(w, err, http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Trailer", PartialResultsTrailer+", "+LookupTruncatedTrailer+", "+TotalCountHeader)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Transfer-Encoding", "chunked")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	w.Write([]byte("[\n"))
+
+	docCount := 0
+	truncated := false
+	var lookupErr error
+	for doc := range docChan {
+		joined, cut, err := lookup.Apply(doc)
+		if err != nil {
+			// Stop the scan; headers are already sent, so the failure is reported via a trailer
+			lookupErr = err
+			cancel()
+			break
+		}
+		truncated = truncated || cut
+
+		docJSON, err := json.Marshal(joined)
+		if err != nil {
+			logf(r, "ERROR: Failed to marshal document: %v", err)
+			continue
+		}
+		if docCount > 0 {
+			w.Write([]byte(",\n"))
+		}
+		if _, err := w.Write(docJSON); err != nil {
+			logf(r, "ERROR: Failed to write to response: %v", err)
+			return
+		}
+		if flusher, ok := w.(http.Flusher); ok {
+			flusher.Flush()
+		}
+		docCount++
+	}
+	// Drain what the stream had already queued so its goroutine can exit
+	for range docChan {
+	}
+
+	w.Write([]byte("\n]"))
+	w.Header().Set(TotalCountHeader, strconv.Itoa(docCount))
+	if truncated {
+		w.Header().Set(LookupTruncatedTrailer, "true")
+	}
+
+	switch {
+	case lookupErr != nil:
+		w.Header().Set(PartialResultsTrailer, "true")
+		logf(r, "ERROR: Lookup in collection '%s' failed after %d documents: %v", req.From, docCount, lookupErr)
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		w.Header().Set(PartialResultsTrailer, "true")
+		logf(r, "WARN: Lookup stream from collection '%s' timed out after %d documents", collName, docCount)
+	default:
+		logf(r, "INFO: Streamed %d documents from collection '%s' with lookups in '%s'", docCount, collName, req.From)
+	}
+}
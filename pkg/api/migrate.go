@@ -0,0 +1,219 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/adfharrison1/go-db/pkg/domain"
+	"github.com/adfharrison1/go-db/pkg/storage"
+	"github.com/gorilla/mux"
+)
+
+// MigrationStatus is the response body describing a background migration. State
+// takes the same values as an index rebuild (RebuildStateRunning and so on).
+type MigrationStatus struct {
+	Success    bool                  `json:"success"`
+	Collection string                `json:"collection"`
+	JobID      string                `json:"job_id"`
+	State      string                `json:"state"`
+	Spec       storage.MigrationSpec `json:"spec"`
+	Processed  int                   `json:"processed"`
+	Total      int                   `json:"total"`
+	Modified   int                   `json:"modified"`
+	Error      string                `json:"error,omitempty"`
+	StartedAt  time.Time             `json:"started_at"`
+	FinishedAt *time.Time            `json:"finished_at,omitempty"`
+}
+
+// migrationJob tracks one background migration
+type migrationJob struct {
+	mu     sync.Mutex
+	status MigrationStatus
+	cancel context.CancelFunc
+}
+
+// snapshot returns a copy of the job's current status
+func (j *migrationJob) snapshot() MigrationStatus {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.status
+}
+
+// running reports whether the job has not finished yet
+func (j *migrationJob) running() bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.status.State == RebuildStateRunning
+}
+
+// jobStatus implements backgroundJob
+func (j *migrationJob) jobStatus() JobStatus {
+	status := j.snapshot()
+	return JobStatus{
+		ID:         status.JobID,
+		Type:       JobTypeMigration,
+		Collection: status.Collection,
+		State:      status.State,
+		Processed:  status.Processed,
+		Total:      status.Total,
+		Error:      status.Error,
+		StartedAt:  status.StartedAt,
+		FinishedAt: status.FinishedAt,
+	}
+}
+
+// stop implements backgroundJob
+func (j *migrationJob) stop() { j.cancel() }
+
+// HandleMigrate handles POST requests that start applying a MigrationSpec to every
+// document of a collection in the background. It responds immediately with the job's
+// ID and status; only one migration may run per collection at a time.
+func (h *Handler) HandleMigrate(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	collName := vars["coll"]
+
+	logf(r, "INFO: handleMigrate called for collection '%s'", collName)
+
+	var spec storage.MigrationSpec
+	if err := json.NewDecoder(r.Body).Decode(&spec); err != nil {
+		logf(r, "ERROR: Decoding body failed: %v", err)
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "Invalid request body")
+		return
+	}
+
+	migration, err := storage.CompileMigration(spec)
+	if err != nil {
+		logf(r, "ERROR: Invalid migration for collection '%s': %v", collName, err)
+		writeError(w, http.StatusBadRequest, ErrCodeValidationFailed, "invalid migration: "+err.Error())
+		return
+	}
+
+	h.migrationMu.Lock()
+	if existing, exists := h.migrationJobs[collName]; exists && existing.running() {
+		h.migrationMu.Unlock()
+		writeError(w, http.StatusConflict, ErrCodeConflict, fmt.Sprintf("a migration is already running for collection %s", collName))
+		return
+	}
+
+	// Migrations outlive the request, so they are not tied to its context, but keep its ID for logging
+	ctx, cancel := context.WithCancel(domain.WithRequestID(context.Background(), domain.RequestID(r.Context())))
+	h.migrationSeq++
+	job := &migrationJob{
+		status: MigrationStatus{
+			Success:    true,
+			Collection: collName,
+			JobID:      fmt.Sprintf("migration-%d", h.migrationSeq),
+			State:      RebuildStateRunning,
+			Spec:       spec,
+			StartedAt:  time.Now().UTC(),
+		},
+		cancel: cancel,
+	}
+	if h.migrationJobs == nil {
+		h.migrationJobs = make(map[string]*migrationJob)
+	}
+	h.migrationJobs[collName] = job
+	h.migrationMu.Unlock()
+	h.registerJob(job)
+
+	go h.runMigration(ctx, job, migration)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(job.snapshot())
+}
+
+// runMigration applies a migration to a collection and records progress and the outcome on job
+func (h *Handler) runMigration(ctx context.Context, job *migrationJob, migration *storage.Migration) {
+	defer job.cancel()
+
+	collName := job.snapshot().Collection
+	modified, err := h.storage.TransformDocumentsContext(ctx, collName, migration.Apply, func(processed, total int) {
+		job.mu.Lock()
+		job.status.Processed = processed
+		job.status.Total = total
+		job.mu.Unlock()
+	})
+
+	job.mu.Lock()
+	defer job.mu.Unlock()
+	job.status.Modified = modified
+	finishedAt := time.Now().UTC()
+	job.status.FinishedAt = &finishedAt
+	switch {
+	case err == nil:
+		job.status.State = RebuildStateCompleted
+		logContextf(ctx, "INFO: Migrated collection '%s' (%d of %d documents changed)", collName, modified, job.status.Total)
+	case errors.Is(err, context.Canceled):
+		job.status.State = RebuildStateCancelled
+		logContextf(ctx, "WARN: Migration of collection '%s' cancelled after %d of %d documents", collName, job.status.Processed, job.status.Total)
+	default:
+		job.status.State = RebuildStateFailed
+		job.status.Success = false
+		job.status.Error = err.Error()
+		logContextf(ctx, "ERROR: Migration of collection '%s' failed: %v", collName, err)
+	}
+}
+
+// HandleGetMigrationStatus handles GET requests for the progress of a collection's most
+// recent migration. An optional ?job_id= must name that migration.
+func (h *Handler) HandleGetMigrationStatus(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	collName := vars["coll"]
+
+	job, ok := h.findMigrationJob(w, r, collName)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(job.snapshot())
+}
+
+// HandleCancelMigration handles DELETE requests that stop a collection's running
+// migration. Batches already applied are kept; running the same migration again
+// finishes the remaining documents.
+func (h *Handler) HandleCancelMigration(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	collName := vars["coll"]
+
+	logf(r, "INFO: handleCancelMigration called for collection '%s'", collName)
+
+	job, ok := h.findMigrationJob(w, r, collName)
+	if !ok {
+		return
+	}
+	if !job.running() {
+		writeError(w, http.StatusConflict, ErrCodeConflict, fmt.Sprintf("migration %s has already finished", job.snapshot().JobID))
+		return
+	}
+	job.cancel()
+
+	// The job reports cancelled once the migration notices, which may take a moment
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(job.snapshot())
+}
+
+// findMigrationJob returns a collection's most recent migration, writing a 404 if there
+// is none or it does not match the request's job_id parameter
+func (h *Handler) findMigrationJob(w http.ResponseWriter, r *http.Request, collName string) (*migrationJob, bool) {
+	h.migrationMu.Lock()
+	job, exists := h.migrationJobs[collName]
+	h.migrationMu.Unlock()
+
+	if !exists {
+		writeError(w, http.StatusNotFound, ErrCodeNotFound, fmt.Sprintf("no migration found for collection %s", collName))
+		return nil, false
+	}
+	if jobID := r.URL.Query().Get("job_id"); jobID != "" && jobID != job.snapshot().JobID {
+		writeError(w, http.StatusNotFound, ErrCodeNotFound, fmt.Sprintf("migration %s not found for collection %s", jobID, collName))
+		return nil, false
+	}
+	return job, true
+}
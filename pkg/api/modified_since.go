@@ -0,0 +1,44 @@
+package api
+
+import (
+	"fmt"
+	"net/url"
+
+	"github.com/adfharrison1/go-db/pkg/domain"
+	"github.com/adfharrison1/go-db/pkg/storage"
+)
+
+// ModifiedSinceParam is the query parameter that keeps only documents modified after
+// an RFC 3339 time, for clients that pull changes incrementally
+const ModifiedSinceParam = "modifiedSince"
+
+// ModifiedFieldParam names the field holding each document's modification time for
+// ?modifiedSince=, for collections that maintain their own; it defaults to _updated_at
+const ModifiedFieldParam = "modifiedField"
+
+// applyModifiedSince adds the ?modifiedSince= condition to filter. _updated_at is only
+// trusted when the engine maintains it (auto timestamps); otherwise the request must
+// name its own field with ?modifiedField= or it fails with ErrTimestampsDisabled.
+func (h *Handler) applyModifiedSince(params url.Values, filter map[string]interface{}) (map[string]interface{}, error) {
+	raw := params.Get(ModifiedSinceParam)
+	field := params.Get(ModifiedFieldParam)
+	if raw == "" {
+		if field != "" {
+			return nil, fmt.Errorf("%w: %s requires %s", domain.ErrInvalidFilter, ModifiedFieldParam, ModifiedSinceParam)
+		}
+		return filter, nil
+	}
+
+	since, ok := storage.ParseTime(raw)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s must be an RFC 3339 time such as 2024-05-01T12:00:00Z, got %q", domain.ErrInvalidFilter, ModifiedSinceParam, raw)
+	}
+	if field == "" {
+		if !h.storage.AutoTimestampsEnabled() {
+			return nil, domain.Errorf(domain.ErrTimestampsDisabled,
+				"documents do not track modification times; start the server with -auto-timestamps or name a field with %s", ModifiedFieldParam)
+		}
+		field = storage.UpdatedAtField
+	}
+	return storage.ModifiedSince(filter, field, since)
+}
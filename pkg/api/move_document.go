@@ -0,0 +1,59 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// MoveDocumentRequest represents the request body for moving a document
+type MoveDocumentRequest struct {
+	Dest   string `json:"dest"`
+	KeepID bool   `json:"keep_id,omitempty"` // Keep the _id instead of assigning a new one in dest
+}
+
+// HandleMoveDocument handles POST requests to move a document to another collection.
+// The document is removed from its collection and inserted into dest in one step.
+func (h *Handler) HandleMoveDocument(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	collName := vars["coll"]
+	docID := vars["id"]
+
+	logf(r, "INFO: handleMoveDocument called for document '%s' in collection '%s'", docID, collName)
+
+	var req MoveDocumentRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		logf(r, "ERROR: Decoding body failed: %v", err)
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "Invalid request body")
+		return
+	}
+	if req.Dest == "" {
+		writeError(w, http.StatusBadRequest, ErrCodeValidationFailed, "dest is required")
+		return
+	}
+	if req.Dest == collName {
+		writeError(w, http.StatusBadRequest, ErrCodeValidationFailed, "dest must differ from the document's collection")
+		return
+	}
+
+	moved, err := h.storage.MoveDocument(collName, docID, req.Dest, req.KeepID)
+	if err != nil {
+		logf(r, "ERROR: Move of document '%s' from '%s' to '%s' failed: %v", docID, collName, req.Dest, err)
+		writeStorageError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	logf(r, "INFO: Moved document '%s' from '%s' to '%s' as '%v'", docID, collName, req.Dest, moved["_id"])
+
+	response := map[string]interface{}{
+		"success":    true,
+		"message":    "Document moved",
+		"collection": collName,
+		"dest":       req.Dest,
+		"document":   moved,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
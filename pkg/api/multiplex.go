@@ -0,0 +1,161 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// MaxBatchSubRequests is the largest number of sub-requests accepted by POST /batch
+const MaxBatchSubRequests = 20
+
+// batchPath is the route of the multiplexing endpoint, which sub-requests may not target
+const batchPath = "/batch"
+
+// bodyHeaders describe the batch request's own body, so sub-requests do not inherit them
+var bodyHeaders = []string{"Content-Length", "Content-Type", "Content-Encoding", "Transfer-Encoding"}
+
+// SubRequest is one request executed by POST /batch. It carries the batch request's
+// headers, e.g. Authorization, with Headers added on top and replacing any of the same name.
+type SubRequest struct {
+	Method  string            `json:"method"`
+	Path    string            `json:"path"` // Including any query string, e.g. /collections/users/find?age=30
+	Headers map[string]string `json:"headers,omitempty"`
+	Body    json.RawMessage   `json:"body,omitempty"`
+}
+
+// SubResponse is the outcome of one sub-request. Body holds the handler's JSON
+// response, or its raw output as a string when that is not a single JSON value.
+type SubResponse struct {
+	Status int         `json:"status"`
+	Body   interface{} `json:"body,omitempty"`
+}
+
+// HandleMultiplex handles POST requests carrying an array of sub-requests, which are
+// executed in order through the API's own routes. Each sub-request gets its own
+// response, so one failing does not affect the others.
+func (h *Handler) HandleMultiplex(w http.ResponseWriter, r *http.Request) {
+	logf(r, "INFO: handleMultiplex called")
+
+	var subRequests []SubRequest
+	if err := json.NewDecoder(r.Body).Decode(&subRequests); err != nil {
+		logf(r, "ERROR: Decoding body failed: %v", err)
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "Invalid request body: expected an array of sub-requests")
+		return
+	}
+	if len(subRequests) == 0 {
+		writeError(w, http.StatusBadRequest, ErrCodeValidationFailed, "no sub-requests provided")
+		return
+	}
+	if len(subRequests) > MaxBatchSubRequests {
+		writeError(w, http.StatusBadRequest, ErrCodeValidationFailed, fmt.Sprintf("batch limited to %d sub-requests, got %d", MaxBatchSubRequests, len(subRequests)))
+		return
+	}
+
+	responses := make([]SubResponse, len(subRequests))
+	for i, sub := range subRequests {
+		responses[i] = h.serveSubRequest(r, sub)
+	}
+
+	logf(r, "INFO: Executed %d sub-requests", len(subRequests))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(responses)
+}
+
+// serveSubRequest runs a sub-request through the router and captures its response.
+// Invalid sub-requests and handler panics are reported in the sub-response.
+func (h *Handler) serveSubRequest(parent *http.Request, sub SubRequest) (resp SubResponse) {
+	method := strings.ToUpper(sub.Method)
+	if method == "" {
+		method = http.MethodGet
+	}
+	if !strings.HasPrefix(sub.Path, "/") {
+		return subRequestError(http.StatusBadRequest, fmt.Sprintf("path %q must start with /", sub.Path))
+	}
+	if strings.SplitN(sub.Path, "?", 2)[0] == batchPath {
+		return subRequestError(http.StatusBadRequest, "sub-requests cannot call /batch")
+	}
+
+	req, err := http.NewRequestWithContext(parent.Context(), method, sub.Path, bytes.NewReader(sub.Body))
+	if err != nil {
+		return subRequestError(http.StatusBadRequest, err.Error())
+	}
+	req.Header = parent.Header.Clone()
+	for _, name := range bodyHeaders {
+		req.Header.Del(name)
+	}
+	if len(sub.Body) > 0 {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for name, value := range sub.Headers {
+		req.Header.Set(name, value)
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			logf(parent, "ERROR: Sub-request %s %s panicked: %v", method, sub.Path, p)
+			resp = subRequestError(http.StatusInternalServerError, "sub-request failed")
+		}
+	}()
+
+	recorder := newResponseRecorder()
+	h.router.ServeHTTP(recorder, req)
+	return recorder.subResponse()
+}
+
+// subRequestError builds a sub-response carrying the standard error body
+func subRequestError(statusCode int, message string) SubResponse {
+	return SubResponse{
+		Status: statusCode,
+		Body:   newErrorResponse(codeForStatus(statusCode), message, nil),
+	}
+}
+
+// responseRecorder buffers a handler's response so it can be embedded in a batch response
+type responseRecorder struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func newResponseRecorder() *responseRecorder {
+	return &responseRecorder{header: make(http.Header)}
+}
+
+func (rr *responseRecorder) Header() http.Header {
+	return rr.header
+}
+
+func (rr *responseRecorder) Write(b []byte) (int, error) {
+	if rr.status == 0 {
+		rr.status = http.StatusOK
+	}
+	return rr.body.Write(b)
+}
+
+func (rr *responseRecorder) WriteHeader(statusCode int) {
+	if rr.status == 0 {
+		rr.status = statusCode
+	}
+}
+
+// subResponse converts the recorded response, keeping JSON bodies as JSON
+func (rr *responseRecorder) subResponse() SubResponse {
+	resp := SubResponse{Status: rr.status}
+	if resp.Status == 0 {
+		resp.Status = http.StatusOK
+	}
+
+	body := bytes.TrimSpace(rr.body.Bytes())
+	switch {
+	case len(body) == 0:
+	case json.Valid(body):
+		resp.Body = json.RawMessage(body)
+	default:
+		resp.Body = string(body)
+	}
+	return resp
+}
@@ -0,0 +1,112 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/adfharrison1/go-db/pkg/domain"
+	"github.com/adfharrison1/go-db/pkg/storage"
+	"github.com/gorilla/mux"
+)
+
+// QueryRequest represents the request body for a POST query
+type QueryRequest struct {
+	Filter  map[string]interface{} `json:"filter,omitempty"`
+	Project map[string]interface{} `json:"project,omitempty"` // Projection spec, see storage.Projection
+	Limit   *int                   `json:"limit,omitempty"`
+	Offset  int                    `json:"offset,omitempty"`
+	After   string                 `json:"after,omitempty"`
+	Before  string                 `json:"before,omitempty"`
+	Order   string                 `json:"order,omitempty"` // domain.OrderByID (default) or domain.OrderInserted
+}
+
+// HandleQuery handles POST requests to query documents with a JSON body.
+// It supports the same filters and pagination as find, plus a projection
+// that renames fields or adds computed fields to each result document.
+func (h *Handler) HandleQuery(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	collName := vars["coll"]
+
+	logf(r, "INFO: handleQuery called for collection '%s'", collName)
+
+	var req QueryRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		logf(r, "ERROR: Decoding body failed: %v", err)
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "Invalid request body")
+		return
+	}
+
+	projection, err := storage.ParseProjection(req.Project)
+	if err != nil {
+		logf(r, "ERROR: Invalid projection for collection '%s': %v", collName, err)
+		writeError(w, http.StatusBadRequest, ErrCodeValidationFailed, "invalid projection: "+err.Error())
+		return
+	}
+
+	envelope, err := h.useEnvelope(r)
+	if err != nil {
+		writeStorageError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	paginationOptions := domain.DefaultPaginationOptions()
+	if req.Limit != nil {
+		paginationOptions.Limit = *req.Limit
+	}
+	paginationOptions.Offset = req.Offset
+	paginationOptions.After = req.After
+	paginationOptions.Before = req.Before
+	paginationOptions.Order = req.Order
+
+	if err := paginationOptions.Validate(); err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeValidationFailed, err.Error())
+		return
+	}
+
+	if err := h.verifyCursors(paginationOptions); err != nil {
+		logf(r, "ERROR: Rejected cursor for collection '%s': %v", collName, err)
+		writeStorageError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel, err := h.queryContext(r)
+	if err != nil {
+		writeStorageError(w, err, http.StatusBadRequest)
+		return
+	}
+	defer cancel()
+
+	result, err := h.storage.FindAllContext(ctx, collName, req.Filter, paginationOptions)
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			logf(r, "WARN: Query on collection '%s' timed out: %v", collName, err)
+			writeError(w, http.StatusGatewayTimeout, ErrCodeTimeout, "Query timed out")
+			return
+		}
+		if errors.Is(err, domain.ErrInvalidFilter) {
+			logf(r, "ERROR: Invalid filter for collection '%s': %v", collName, err)
+			writeStorageError(w, err, http.StatusBadRequest)
+			return
+		}
+		if errors.Is(err, domain.ErrResultTooLarge) {
+			logf(r, "WARN: Query on collection '%s' matched too many documents: %v", collName, err)
+			writeStorageError(w, err, http.StatusRequestEntityTooLarge)
+			return
+		}
+		logf(r, "ERROR: Collection '%s' not found: %v", collName, err)
+		writeStorageError(w, err, http.StatusNotFound)
+		return
+	}
+
+	// Project after pagination so cursors still refer to the stored _id
+	result.Documents = projection.ApplyAll(result.Documents)
+
+	logf(r, "INFO: Query returned %d documents from collection '%s' (total: %d)",
+		len(result.Documents), collName, result.Total)
+
+	h.signCursors(result)
+
+	writePaginationResult(w, result, envelope)
+}
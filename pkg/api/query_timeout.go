@@ -0,0 +1,53 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/adfharrison1/go-db/pkg/domain"
+)
+
+// TimeoutParam is the query parameter used to request a per-query timeout
+const TimeoutParam = "timeout"
+
+// IncludeDeletedParam is the query parameter that opts out of the collection default filter
+const IncludeDeletedParam = "includeDeleted"
+
+// queryContext derives the context used to run a query. The deadline is the
+// request's ?timeout= value (a Go duration such as "500ms" or "2s"), capped by
+// the handler's configured maximum, which is also used when no value is given.
+// ?includeDeleted=true marks the context to bypass the collection default filter.
+func (h *Handler) queryContext(r *http.Request) (context.Context, context.CancelFunc, error) {
+	timeout := h.queryTimeout
+	parent := r.Context()
+	if includeDeleted(r) {
+		parent = domain.WithoutDefaultFilter(parent)
+	}
+
+	if raw := r.URL.Query().Get(TimeoutParam); raw != "" {
+		requested, err := time.ParseDuration(raw)
+		if err != nil || requested <= 0 {
+			return nil, nil, fmt.Errorf("invalid timeout '%s': must be a positive duration such as 500ms or 2s", raw)
+		}
+		if timeout == 0 || requested < timeout {
+			timeout = requested
+		}
+	}
+
+	if timeout == 0 {
+		ctx, cancel := context.WithCancel(parent)
+		return ctx, cancel, nil
+	}
+
+	ctx, cancel := context.WithTimeout(parent, timeout)
+	return ctx, cancel, nil
+}
+
+// includeDeleted reports whether the request asked to bypass the collection default filter
+func includeDeleted(r *http.Request) bool {
+	include, _ := strconv.ParseBool(r.URL.Query().Get(IncludeDeletedParam))
+	return include
+}
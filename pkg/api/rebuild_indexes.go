@@ -0,0 +1,205 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/adfharrison1/go-db/pkg/domain"
+	"github.com/gorilla/mux"
+)
+
+// States of a background index rebuild
+const (
+	RebuildStateRunning   = "running"
+	RebuildStateCompleted = "completed"
+	RebuildStateFailed    = "failed"
+	RebuildStateCancelled = "cancelled"
+)
+
+// IndexRebuildStatus is the response body describing a background index rebuild
+type IndexRebuildStatus struct {
+	Success    bool       `json:"success"`
+	Collection string     `json:"collection"`
+	JobID      string     `json:"job_id"`
+	State      string     `json:"state"`
+	Processed  int        `json:"processed"`
+	Total      int        `json:"total"`
+	Error      string     `json:"error,omitempty"`
+	StartedAt  time.Time  `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+}
+
+// rebuildJob tracks one background index rebuild
+type rebuildJob struct {
+	mu     sync.Mutex
+	status IndexRebuildStatus
+	cancel context.CancelFunc
+}
+
+// snapshot returns a copy of the job's current status
+func (j *rebuildJob) snapshot() IndexRebuildStatus {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.status
+}
+
+// running reports whether the job has not finished yet
+func (j *rebuildJob) running() bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.status.State == RebuildStateRunning
+}
+
+// jobStatus implements backgroundJob
+func (j *rebuildJob) jobStatus() JobStatus {
+	status := j.snapshot()
+	return JobStatus{
+		ID:         status.JobID,
+		Type:       JobTypeRebuild,
+		Collection: status.Collection,
+		State:      status.State,
+		Processed:  status.Processed,
+		Total:      status.Total,
+		Error:      status.Error,
+		StartedAt:  status.StartedAt,
+		FinishedAt: status.FinishedAt,
+	}
+}
+
+// stop implements backgroundJob
+func (j *rebuildJob) stop() { j.cancel() }
+
+// HandleRebuildIndexes handles POST requests that start rebuilding every index of a
+// collection in the background. It responds immediately with the job's ID and status.
+func (h *Handler) HandleRebuildIndexes(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	collName := vars["coll"]
+
+	logf(r, "INFO: handleRebuildIndexes called for collection '%s'", collName)
+
+	h.rebuildMu.Lock()
+	if existing, exists := h.rebuildJobs[collName]; exists && existing.running() {
+		h.rebuildMu.Unlock()
+		writeError(w, http.StatusConflict, ErrCodeConflict, fmt.Sprintf("an index rebuild is already running for collection %s", collName))
+		return
+	}
+
+	// Rebuilds outlive the request, so they are not tied to its context, but keep its ID for logging
+	ctx, cancel := context.WithCancel(domain.WithRequestID(context.Background(), domain.RequestID(r.Context())))
+	h.rebuildSeq++
+	job := &rebuildJob{
+		status: IndexRebuildStatus{
+			Success:    true,
+			Collection: collName,
+			JobID:      fmt.Sprintf("rebuild-%d", h.rebuildSeq),
+			State:      RebuildStateRunning,
+			StartedAt:  time.Now().UTC(),
+		},
+		cancel: cancel,
+	}
+	if h.rebuildJobs == nil {
+		h.rebuildJobs = make(map[string]*rebuildJob)
+	}
+	h.rebuildJobs[collName] = job
+	h.rebuildMu.Unlock()
+	h.registerJob(job)
+
+	go h.runRebuild(ctx, job)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(job.snapshot())
+}
+
+// runRebuild rebuilds a collection's indexes and records progress and the outcome on job
+func (h *Handler) runRebuild(ctx context.Context, job *rebuildJob) {
+	defer job.cancel()
+
+	collName := job.snapshot().Collection
+	err := h.storage.RebuildIndexesContext(ctx, collName, func(processed, total int) {
+		job.mu.Lock()
+		job.status.Processed = processed
+		job.status.Total = total
+		job.mu.Unlock()
+	})
+
+	job.mu.Lock()
+	defer job.mu.Unlock()
+	finishedAt := time.Now().UTC()
+	job.status.FinishedAt = &finishedAt
+	switch {
+	case err == nil:
+		job.status.State = RebuildStateCompleted
+		logContextf(ctx, "INFO: Rebuilt indexes for collection '%s' (%d documents)", collName, job.status.Processed)
+	case errors.Is(err, context.Canceled):
+		job.status.State = RebuildStateCancelled
+		logContextf(ctx, "WARN: Index rebuild for collection '%s' cancelled after %d of %d documents", collName, job.status.Processed, job.status.Total)
+	default:
+		job.status.State = RebuildStateFailed
+		job.status.Success = false
+		job.status.Error = err.Error()
+		logContextf(ctx, "ERROR: Index rebuild for collection '%s' failed: %v", collName, err)
+	}
+}
+
+// HandleGetRebuildStatus handles GET requests for the progress of a collection's most
+// recent index rebuild. An optional ?job_id= must name that rebuild.
+func (h *Handler) HandleGetRebuildStatus(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	collName := vars["coll"]
+
+	job, ok := h.findRebuildJob(w, r, collName)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(job.snapshot())
+}
+
+// HandleCancelRebuild handles DELETE requests that abort a collection's running index
+// rebuild. The indexes are left as they were before the rebuild started.
+func (h *Handler) HandleCancelRebuild(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	collName := vars["coll"]
+
+	logf(r, "INFO: handleCancelRebuild called for collection '%s'", collName)
+
+	job, ok := h.findRebuildJob(w, r, collName)
+	if !ok {
+		return
+	}
+	if !job.running() {
+		writeError(w, http.StatusConflict, ErrCodeConflict, fmt.Sprintf("index rebuild %s has already finished", job.snapshot().JobID))
+		return
+	}
+	job.cancel()
+
+	// The job reports cancelled once the rebuild notices, which may take a moment
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(job.snapshot())
+}
+
+// findRebuildJob returns a collection's most recent rebuild, writing a 404 if there is
+// none or it does not match the request's job_id parameter
+func (h *Handler) findRebuildJob(w http.ResponseWriter, r *http.Request, collName string) (*rebuildJob, bool) {
+	h.rebuildMu.Lock()
+	job, exists := h.rebuildJobs[collName]
+	h.rebuildMu.Unlock()
+
+	if !exists {
+		writeError(w, http.StatusNotFound, ErrCodeNotFound, fmt.Sprintf("no index rebuild found for collection %s", collName))
+		return nil, false
+	}
+	if jobID := r.URL.Query().Get("job_id"); jobID != "" && jobID != job.snapshot().JobID {
+		writeError(w, http.StatusNotFound, ErrCodeNotFound, fmt.Sprintf("index rebuild %s not found for collection %s", jobID, collName))
+		return nil, false
+	}
+	return job, true
+}
@@ -0,0 +1,75 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/adfharrison1/go-db/pkg/domain"
+)
+
+// RequestIDHeader carries the request ID, read from requests and echoed in responses
+const RequestIDHeader = "X-Request-ID"
+
+// MaxRequestIDLength is the longest client-supplied request ID that is accepted
+const MaxRequestIDLength = 128
+
+// RequestIDMiddleware gives every request an ID: the client's X-Request-ID when it is
+// valid, the ID already in the context for batch sub-requests, or a new random one.
+// The ID is attached to the request context, so storage operations see it too, and
+// echoed in the X-Request-ID response header.
+func RequestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if !validRequestID(id) {
+			id = domain.RequestID(r.Context())
+		}
+		if id == "" {
+			id = newRequestID()
+		}
+
+		w.Header().Set(RequestIDHeader, id)
+		next.ServeHTTP(w, r.WithContext(domain.WithRequestID(r.Context(), id)))
+	})
+}
+
+// validRequestID accepts non-empty IDs of printable ASCII without spaces, so a
+// client-supplied ID cannot break up log lines
+func validRequestID(id string) bool {
+	if id == "" || len(id) > MaxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// newRequestID returns a random 128-bit ID in hex
+func newRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(b)
+}
+
+// logf logs a line for a request, tagged with its request ID when it has one
+func logf(r *http.Request, format string, args ...interface{}) {
+	logContextf(r.Context(), format, args...)
+}
+
+// logContextf is like logf for work that outlives its request, such as background
+// rebuilds, and is tagged with the request ID carried by ctx
+func logContextf(ctx context.Context, format string, args ...interface{}) {
+	line := fmt.Sprintf(format, args...)
+	if id := domain.RequestID(ctx); id != "" {
+		line += " request_id=" + id
+	}
+	log.Print(line)
+}
@@ -1,34 +1,150 @@
 package api
 
 import (
+	"net/http"
+
 	"github.com/gorilla/mux"
 )
 
 // RegisterRoutes registers all API routes with the given router
 func (h *Handler) RegisterRoutes(router *mux.Router) {
+	h.router = router
+
+	// Every request gets an ID for log correlation, echoed in X-Request-ID
+	router.Use(RequestIDMiddleware)
+
+	// Responses carry the applied offset in X-GoDB-Offset; X-GoDB-Min-Offset requires one
+	router.Use(h.ConsistencyMiddleware)
+
+	// ?pretty=true indents JSON responses
+	router.Use(PrettyJSONMiddleware)
+
 	// Health check endpoint
 	router.HandleFunc("/health", h.HandleHealth).Methods("GET")
 
+	// Readiness, including the startup preload of collections
+	router.HandleFunc("/ready", h.HandleReady).Methods("GET")
+
+	// Server version and supported features
+	router.HandleFunc("/version", h.HandleVersion).Methods("GET")
+
+	// Several requests multiplexed into one round trip
+	router.HandleFunc("/batch", h.HandleMultiplex).Methods("POST")
+
+	// Operator endpoints, behind the admin token
+	admin := router.PathPrefix("/admin").Subrouter()
+	admin.Use(h.AdminAuthMiddleware)
+	admin.HandleFunc("/memory", h.HandleGetMemory).Methods("GET")
+	admin.HandleFunc("/memory/gc", h.HandleMemoryGC).Methods("POST")
+	admin.HandleFunc("/memory/limit", h.HandleSetMemoryLimit).Methods("POST")
+	admin.HandleFunc("/collections/{coll}/pin", h.HandlePinCollection).Methods("POST")
+	admin.HandleFunc("/collections/{coll}/pin", h.HandleUnpinCollection).Methods("DELETE")
+	admin.HandleFunc("/checkpoint", h.HandleCheckpoint).Methods("POST")
+	admin.HandleFunc("/locks", h.HandleGetLocks).Methods("GET")
+	admin.HandleFunc("/jobs", h.HandleListJobs).Methods("GET")
+	admin.HandleFunc("/jobs/{id}", h.HandleGetJob).Methods("GET")
+	admin.HandleFunc("/jobs/{id}", h.HandleCancelJob).Methods("DELETE")
+
 	// Collection operations
+	router.HandleFunc("/collections", h.HandleListCollections).Methods("GET")
+	router.HandleFunc("/collections", h.HandleCreateCollectionWithOptions).Methods("POST")
 	router.HandleFunc("/collections/{coll}", h.HandleInsert).Methods("POST")
+	router.HandleFunc("/collections/{coll}", h.HandleCreateCollection).Methods("PUT")
+	router.HandleFunc("/collections/{coll}", h.HandleDropCollection).Methods("DELETE")
+	router.HandleFunc("/collections/{coll}/copy", h.HandleCopyCollection).Methods("POST")
+
+	// Update the first match of a filter, or insert a document if none matches
+	router.HandleFunc("/collections/{coll}/upsert", h.HandleUpsert).Methods("POST")
 
 	// Batch operations
 	router.HandleFunc("/collections/{coll}/batch", h.HandleBatchInsert).Methods("POST")
 	router.HandleFunc("/collections/{coll}/batch", h.HandleBatchUpdate).Methods("PATCH")
 
+	// Streaming NDJSON ingest
+	router.HandleFunc("/collections/{coll}/ingest", h.HandleIngest).Methods("POST")
+
+	// Partial update of every document matching a filter
+	router.HandleFunc("/collections/{coll}/documents", h.HandleUpdateMany).Methods("PATCH")
+
 	// Document operations (by ID)
 	router.HandleFunc("/collections/{coll}/documents/{id}", h.HandleGetById).Methods("GET")
+	router.HandleFunc("/collections/{coll}/documents/{id}", h.HandleHeadById).Methods("HEAD")    // Existence check
 	router.HandleFunc("/collections/{coll}/documents/{id}", h.HandleUpdateById).Methods("PATCH") // Partial update
 	router.HandleFunc("/collections/{coll}/documents/{id}", h.HandleReplaceById).Methods("PUT")  // Complete replacement
 	router.HandleFunc("/collections/{coll}/documents/{id}", h.HandleDeleteById).Methods("DELETE")
+	router.HandleFunc("/collections/{coll}/documents/{id}/array/{field}", h.HandleGetArraySlice).Methods("GET") // Window of an array field
+	router.HandleFunc("/collections/{coll}/documents/{id}/cas", h.HandleCompareAndSet).Methods("POST")          // Conditional single-field update
+	router.HandleFunc("/collections/{coll}/documents/{id}/move", h.HandleMoveDocument).Methods("POST")          // Atomic move to another collection
+	router.HandleFunc("/collections/{coll}/documents/{id}/next", h.HandleGetNextById).Methods("GET")            // Following document in _id order
+	router.HandleFunc("/collections/{coll}/documents/{id}/prev", h.HandleGetPrevById).Methods("GET")            // Preceding document in _id order
 
 	// Find with optional filtering (query parameters)
 	router.HandleFunc("/collections/{coll}/find", h.HandleFindAll).Methods("GET")
 	router.HandleFunc("/collections/{coll}/find_with_stream", h.HandleFindAllWithStream).Methods("GET")
+	router.HandleFunc("/collections/{coll}/ids", h.HandleFindIds).Methods("GET")
+
+	// Unsorted quick-look sample
+	router.HandleFunc("/collections/{coll}/sample", h.HandleSample).Methods("GET")
+
+	// Query with a JSON body (filter, pagination and projection)
+	router.HandleFunc("/collections/{coll}/query", h.HandleQuery).Methods("POST")
+
+	// Value counts per field (faceted search)
+	router.HandleFunc("/collections/{coll}/facets", h.HandleFacets).Methods("POST")
+
+	// Poll-based change feed, with optional long-polling
+	router.HandleFunc("/collections/{coll}/changes", h.HandleGetChanges).Methods("GET")
+
+	// Grouped counts and metrics, computed over the document stream
+	router.HandleFunc("/collections/{coll}/aggregate", h.HandleAggregate).Methods("POST")
+	router.HandleFunc("/collections/{coll}/lookup", h.HandleLookup).Methods("POST")
 
 	// Index operations
 	router.HandleFunc("/collections/{coll}/indexes", h.HandleGetIndexes).Methods("GET")
+	router.HandleFunc("/collections/{coll}/indexes", h.HandleCreateIndexes).Methods("POST")
+	router.HandleFunc("/collections/{coll}/indexes", h.HandleDropAllIndexes).Methods("DELETE")
+	// Background rebuilds; registered before /indexes/{field} so "rebuild" is not taken as a field name
+	router.HandleFunc("/collections/{coll}/indexes/rebuild", h.HandleRebuildIndexes).Methods("POST")
+	router.HandleFunc("/collections/{coll}/indexes/rebuild", h.HandleCancelRebuild).Methods("DELETE")
+	router.HandleFunc("/collections/{coll}/indexes/rebuild/status", h.HandleGetRebuildStatus).Methods("GET")
 	router.HandleFunc("/collections/{coll}/indexes/{field}", h.HandleCreateIndex).Methods("POST")
+	// Raw index contents for debugging, behind the admin token
+	router.Handle("/collections/{coll}/indexes/{field}/dump", h.AdminAuthMiddleware(http.HandlerFunc(h.HandleDumpIndex))).Methods("GET")
+
+	// Background migrations (field renames, adds and removes over every document)
+	router.HandleFunc("/collections/{coll}/migrate", h.HandleMigrate).Methods("POST")
+	router.HandleFunc("/collections/{coll}/migrate", h.HandleCancelMigration).Methods("DELETE")
+	router.HandleFunc("/collections/{coll}/migrate/status", h.HandleGetMigrationStatus).Methods("GET")
+
+	// Background schema validations (reports documents violating the schema)
+	router.HandleFunc("/collections/{coll}/validate", h.HandleValidateSchema).Methods("POST")
+	router.HandleFunc("/collections/{coll}/validate", h.HandleCancelValidation).Methods("DELETE")
+	router.HandleFunc("/collections/{coll}/validate/status", h.HandleGetValidationStatus).Methods("GET")
+
+	// Collection default filter (e.g. soft deletes)
+	router.HandleFunc("/collections/{coll}/default_filter", h.HandleGetDefaultFilter).Methods("GET")
+	router.HandleFunc("/collections/{coll}/default_filter", h.HandleSetDefaultFilter).Methods("PUT")
+	router.HandleFunc("/collections/{coll}/default_filter", h.HandleDeleteDefaultFilter).Methods("DELETE")
+
+	// Insert-time field defaults
+	router.HandleFunc("/collections/{coll}/defaults", h.HandleGetDefaults).Methods("GET")
+	router.HandleFunc("/collections/{coll}/defaults", h.HandleSetDefaults).Methods("PUT")
+	router.HandleFunc("/collections/{coll}/defaults", h.HandleDeleteDefaults).Methods("DELETE")
+
+	// Field type hints used by filters
+	router.HandleFunc("/collections/{coll}/schema", h.HandleGetSchema).Methods("GET")
+	router.HandleFunc("/collections/{coll}/schema", h.HandleSetSchema).Methods("PUT")
+	router.HandleFunc("/collections/{coll}/schema", h.HandleDeleteSchema).Methods("DELETE")
+
+	// Capped collections (size limit with FIFO or LRU eviction)
+	router.HandleFunc("/collections/{coll}/capped", h.HandleGetCapped).Methods("GET")
+	router.HandleFunc("/collections/{coll}/capped", h.HandleSetCapped).Methods("PUT")
+	router.HandleFunc("/collections/{coll}/capped", h.HandleDeleteCapped).Methods("DELETE")
+
+	// Compact in-memory encoding of documents
+	router.HandleFunc("/collections/{coll}/compact", h.HandleGetCompact).Methods("GET")
+	router.HandleFunc("/collections/{coll}/compact", h.HandleSetCompact).Methods("PUT")
+	router.HandleFunc("/collections/{coll}/compact", h.HandleDeleteCompact).Methods("DELETE")
 
 	// Add more routes as needed
 }
@@ -0,0 +1,89 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/adfharrison1/go-db/pkg/domain"
+	"github.com/adfharrison1/go-db/pkg/storage"
+	"github.com/gorilla/mux"
+)
+
+// SampleResponse is the response body of a sample request
+type SampleResponse struct {
+	Success    bool              `json:"success"`
+	Collection string            `json:"collection"`
+	Documents  []domain.Document `json:"documents"`
+	Count      int               `json:"count"`
+}
+
+// HandleSample handles GET requests for a quick, unsorted look at a collection.
+// It returns up to ?size= documents (default 10) without sorting; ?seed= picks a
+// random sample instead of the first documents found. Results are non-deterministic.
+func (h *Handler) HandleSample(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	collName := vars["coll"]
+
+	logf(r, "INFO: handleSample called for collection '%s'", collName)
+
+	queryParams := r.URL.Query()
+
+	size := storage.DefaultSampleSize
+	if sizeStr := queryParams.Get("size"); sizeStr != "" {
+		parsed, err := strconv.Atoi(sizeStr)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, ErrCodeValidationFailed, "size must be an integer")
+			return
+		}
+		size = parsed
+	}
+	if err := storage.ValidateSampleSize(size); err != nil {
+		writeStorageError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	var seed *int64
+	if seedStr := queryParams.Get("seed"); seedStr != "" {
+		parsed, err := strconv.ParseInt(seedStr, 10, 64)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, ErrCodeValidationFailed, "seed must be an integer")
+			return
+		}
+		seed = &parsed
+	}
+
+	ctx, cancel, err := h.queryContext(r)
+	if err != nil {
+		writeStorageError(w, err, http.StatusBadRequest)
+		return
+	}
+	defer cancel()
+
+	docs, err := h.storage.SampleContext(ctx, collName, size, seed)
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			logf(r, "WARN: Sample of collection '%s' timed out: %v", collName, err)
+			writeError(w, http.StatusGatewayTimeout, ErrCodeTimeout, "Query timed out")
+			return
+		}
+		logf(r, "ERROR: Collection '%s' not found: %v", collName, err)
+		writeStorageError(w, err, http.StatusNotFound)
+		return
+	}
+	if docs == nil {
+		docs = []domain.Document{}
+	}
+
+	logf(r, "INFO: Sampled %d documents from collection '%s'", len(docs), collName)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(SampleResponse{
+		Success:    true,
+		Collection: collName,
+		Documents:  docs,
+		Count:      len(docs),
+	})
+}
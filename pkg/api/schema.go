@@ -0,0 +1,95 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/adfharrison1/go-db/pkg/domain"
+	"github.com/adfharrison1/go-db/pkg/storage"
+	"github.com/gorilla/mux"
+)
+
+// SchemaRequest represents the request body for setting a collection's field types.
+// Strict rejects writes storing fields that Fields does not declare.
+type SchemaRequest struct {
+	Fields map[string]domain.FieldType `json:"fields"`
+	Strict bool                        `json:"strict"`
+}
+
+// HandleGetSchema handles GET requests to retrieve a collection's field types
+func (h *Handler) HandleGetSchema(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	collName := vars["coll"]
+
+	logf(r, "INFO: handleGetSchema called for collection '%s'", collName)
+
+	fields := h.storage.GetCollectionSchema(collName)
+	if fields == nil {
+		fields = map[string]domain.FieldType{}
+	}
+
+	response := map[string]interface{}{
+		"success":    true,
+		"collection": collName,
+		"fields":     fields,
+		"strict":     h.storage.IsCollectionSchemaStrict(collName),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// HandleSetSchema handles PUT requests to set a collection's field types.
+// Filters on a time field compare values chronologically. A strict schema makes
+// writes of undeclared fields fail.
+func (h *Handler) HandleSetSchema(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	collName := vars["coll"]
+
+	logf(r, "INFO: handleSetSchema called for collection '%s'", collName)
+
+	var req SchemaRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		logf(r, "ERROR: Decoding body failed: %v", err)
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "Invalid request body")
+		return
+	}
+
+	if err := storage.ValidateCollectionSchema(req.Fields); err != nil {
+		writeStorageError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	h.storage.SetCollectionSchema(collName, req.Fields)
+	h.storage.SetCollectionSchemaStrict(collName, req.Strict && len(req.Fields) > 0)
+
+	fields := h.storage.GetCollectionSchema(collName)
+	if fields == nil {
+		fields = map[string]domain.FieldType{}
+	}
+
+	response := map[string]interface{}{
+		"success":    true,
+		"message":    "Schema updated",
+		"collection": collName,
+		"fields":     fields,
+		"strict":     h.storage.IsCollectionSchemaStrict(collName),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+
+	logf(r, "INFO: Set schema for collection '%s': %v (strict: %v)", collName, req.Fields, req.Strict)
+}
+
+// HandleDeleteSchema handles DELETE requests to remove a collection's field types
+func (h *Handler) HandleDeleteSchema(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	collName := vars["coll"]
+
+	logf(r, "INFO: handleDeleteSchema called for collection '%s'", collName)
+
+	h.storage.SetCollectionSchema(collName, nil)
+
+	w.WriteHeader(http.StatusNoContent)
+}
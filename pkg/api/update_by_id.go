@@ -2,25 +2,77 @@ package api
 
 import (
 	"encoding/json"
-	"log"
+	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
 
 	"github.com/adfharrison1/go-db/pkg/domain"
 	"github.com/gorilla/mux"
 )
 
-// HandleUpdateById handles PATCH requests to update a specific document by ID
+// UpsertParam is the update query parameter that inserts the document under the
+// given ID when none exists
+const UpsertParam = "upsert"
+
+// ifMatchVersion parses an If-Match header holding the document version a
+// conditional update expects, as a number or an entity tag such as "3" or W/"3", as
+// sent back from an ETag. The second result is false when there is no header or it
+// is *, which any existing document matches.
+func ifMatchVersion(r *http.Request) (int, bool, error) {
+	raw := strings.TrimSpace(r.Header.Get("If-Match"))
+	if raw == "" || raw == "*" {
+		return 0, false, nil
+	}
+	version, err := strconv.Atoi(strings.Trim(strings.TrimPrefix(raw, "W/"), `"`))
+	if err != nil || version < 0 {
+		return 0, false, fmt.Errorf("invalid If-Match '%s': must be a document version such as \"3\"", raw)
+	}
+	return version, true, nil
+}
+
+// HandleUpdateById handles PATCH requests to update a specific document by ID.
+// With ?upsert=true a missing document is created with the body as its fields and
+// the response is 201 with its path in the Location header. With an If-Match header
+// holding a _version the update only applies at that version, and the response is
+// 412 otherwise.
 func (h *Handler) HandleUpdateById(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	collName := vars["coll"]
 	docId := vars["id"]
 
-	log.Printf("INFO: handleUpdateById called for collection '%s', document '%s'", collName, docId)
+	logf(r, "INFO: handleUpdateById called for collection '%s', document '%s'", collName, docId)
+
+	upsert := false
+	if raw := r.URL.Query().Get(UpsertParam); raw != "" {
+		parsed, err := strconv.ParseBool(raw)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, ErrCodeValidationFailed, fmt.Sprintf("invalid %s '%s': must be true or false", UpsertParam, raw))
+			return
+		}
+		upsert = parsed
+	}
+
+	expectedVersion, ifMatch, err := ifMatchVersion(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, ErrCodeValidationFailed, err.Error())
+		return
+	}
+	if ifMatch && upsert {
+		writeError(w, http.StatusBadRequest, ErrCodeValidationFailed, "If-Match cannot be combined with "+UpsertParam)
+		return
+	}
+
+	ctx, err := writeContext(r)
+	if err != nil {
+		writeStorageError(w, err, http.StatusBadRequest)
+		return
+	}
 
 	var updates map[string]interface{}
 	if err := json.NewDecoder(r.Body).Decode(&updates); err != nil {
-		log.Printf("ERROR: Decoding body failed: %v", err)
-		WriteJSONError(w, http.StatusBadRequest, "Invalid request body")
+		logf(r, "ERROR: Decoding body failed: %v", err)
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "Invalid request body")
 		return
 	}
 
@@ -30,23 +82,37 @@ func (h *Handler) HandleUpdateById(w http.ResponseWriter, r *http.Request) {
 		updateDoc[k] = v
 	}
 
-	updatedDoc, err := h.storage.UpdateById(collName, docId, updateDoc)
+	var updatedDoc domain.Document
+	created := false
+	switch {
+	case upsert:
+		updatedDoc, created, err = h.storage.UpsertByIdContext(ctx, collName, docId, updateDoc)
+	case ifMatch:
+		updatedDoc, err = h.storage.UpdateByIdIfVersionContext(ctx, collName, docId, expectedVersion, updateDoc)
+	default:
+		updatedDoc, err = h.storage.UpdateByIdContext(ctx, collName, docId, updateDoc)
+	}
 	if err != nil {
-		log.Printf("ERROR: Update failed for document '%s' in collection '%s': %v", docId, collName, err)
-		WriteJSONError(w, http.StatusNotFound, err.Error())
+		logf(r, "ERROR: Update failed for document '%s' in collection '%s': %v", docId, collName, err)
+		writeStorageError(w, err, http.StatusNotFound)
 		return
 	}
 
 	// Save collection to disk if transaction saves are enabled
 	if err := h.storage.SaveCollectionAfterTransaction(collName); err != nil {
-		log.Printf("WARN: Failed to save collection '%s' after update: %v", collName, err)
+		logf(r, "WARN: Failed to save collection '%s' after update: %v", collName, err)
 		// Don't fail the request if save fails, just log the warning
 	}
 
-	log.Printf("INFO: Updated document '%s' in collection '%s'", docId, collName)
-
 	// Return the updated document
 	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
+	if created {
+		logf(r, "INFO: Created document '%s' in collection '%s'", docId, collName)
+		w.Header().Set("Location", documentLocation(collName, updatedDoc))
+		w.WriteHeader(http.StatusCreated)
+	} else {
+		logf(r, "INFO: Updated document '%s' in collection '%s'", docId, collName)
+		w.WriteHeader(http.StatusOK)
+	}
 	json.NewEncoder(w).Encode(updatedDoc)
 }
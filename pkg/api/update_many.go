@@ -0,0 +1,66 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/adfharrison1/go-db/pkg/domain"
+	"github.com/gorilla/mux"
+)
+
+// UpdateManyRequest represents the request body for updating every document matching
+// a filter. Update is a partial update, as for a single document.
+type UpdateManyRequest struct {
+	Filter map[string]interface{} `json:"filter"`
+	Update domain.Document        `json:"update"`
+}
+
+// HandleUpdateMany handles PATCH requests that apply one partial update to every
+// document matching a filter and responds with the number updated. An empty filter
+// matches every document. With ?durable=true a collection that cannot be saved before
+// the response is an error.
+func (h *Handler) HandleUpdateMany(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	collName := vars["coll"]
+
+	logf(r, "INFO: handleUpdateMany called for collection '%s'", collName)
+
+	ctx, err := writeContext(r)
+	if err != nil {
+		writeStorageError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	var req UpdateManyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		logf(r, "ERROR: Decoding body failed: %v", err)
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "Invalid request body")
+		return
+	}
+	if req.Filter == nil {
+		writeError(w, http.StatusBadRequest, ErrCodeValidationFailed, "filter is required")
+		return
+	}
+	if len(req.Update) == 0 {
+		writeError(w, http.StatusBadRequest, ErrCodeValidationFailed, "update is required")
+		return
+	}
+
+	modified, err := h.storage.UpdateManyContext(ctx, collName, req.Filter, req.Update)
+	if err != nil {
+		logf(r, "ERROR: Update many failed for collection '%s' after %d documents: %v", collName, modified, err)
+		writeStorageError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	logf(r, "INFO: Updated %d documents in collection '%s'", modified, collName)
+
+	response := map[string]interface{}{
+		"success":    true,
+		"collection": collName,
+		"modified":   modified,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,65 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/adfharrison1/go-db/pkg/domain"
+	"github.com/gorilla/mux"
+)
+
+// UpsertRequest represents the request body for an upsert. Update holds $set and
+// $setOnInsert sections; fields outside them are set on every upsert.
+type UpsertRequest struct {
+	Filter map[string]interface{} `json:"filter"`
+	Update domain.Document        `json:"update"`
+}
+
+// HandleUpsert handles POST requests that update the first document matching a
+// filter or insert one if none matches. It responds 201 with the created document or
+// 200 with the updated one. With ?durable=true a document that cannot be saved
+// before the response is an error.
+func (h *Handler) HandleUpsert(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	collName := vars["coll"]
+
+	logf(r, "INFO: handleUpsert called for collection '%s'", collName)
+
+	ctx, err := writeContext(r)
+	if err != nil {
+		writeStorageError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	var req UpsertRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		logf(r, "ERROR: Decoding body failed: %v", err)
+		writeError(w, http.StatusBadRequest, ErrCodeInvalidRequest, "Invalid request body")
+		return
+	}
+	if req.Filter == nil {
+		writeError(w, http.StatusBadRequest, ErrCodeValidationFailed, "filter is required")
+		return
+	}
+
+	doc, created, err := h.storage.UpsertContext(ctx, collName, req.Filter, req.Update)
+	if err != nil {
+		logf(r, "ERROR: Upsert failed for collection '%s': %v", collName, err)
+		writeStorageError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	// Save collection to disk if transaction saves are enabled
+	if err := h.storage.SaveCollectionAfterTransaction(collName); err != nil {
+		logf(r, "WARN: Failed to save collection '%s' after upsert: %v", collName, err)
+	}
+
+	logf(r, "INFO: Upsert successful for collection '%s' (created: %v)", collName, created)
+
+	w.Header().Set("Content-Type", "application/json")
+	if created {
+		w.Header().Set("Location", documentLocation(collName, doc))
+		w.WriteHeader(http.StatusCreated)
+	}
+	json.NewEncoder(w).Encode(doc)
+}
@@ -0,0 +1,240 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/adfharrison1/go-db/pkg/domain"
+	"github.com/adfharrison1/go-db/pkg/storage"
+	"github.com/gorilla/mux"
+)
+
+// MaxReportedViolations caps the violating documents a schema validation lists; the
+// rest are only counted
+const MaxReportedViolations = 1000
+
+// SchemaViolation names a document that does not conform to its collection's schema
+type SchemaViolation struct {
+	ID      string   `json:"id"`
+	Reasons []string `json:"reasons"`
+}
+
+// SchemaValidationStatus is the response body describing a background schema
+// validation. State takes the same values as an index rebuild (RebuildStateRunning and
+// so on). Violations lists at most MaxReportedViolations documents, in the order they
+// were scanned; Invalid counts them all.
+type SchemaValidationStatus struct {
+	Success    bool                        `json:"success"`
+	Collection string                      `json:"collection"`
+	JobID      string                      `json:"job_id"`
+	State      string                      `json:"state"`
+	Schema     map[string]domain.FieldType `json:"schema"`
+	Scanned    int                         `json:"scanned"`
+	Invalid    int                         `json:"invalid"`
+	Violations []SchemaViolation           `json:"violations"`
+	Truncated  bool                        `json:"truncated"`
+	StartedAt  time.Time                   `json:"started_at"`
+	FinishedAt *time.Time                  `json:"finished_at,omitempty"`
+}
+
+// validationJob tracks one background schema validation
+type validationJob struct {
+	mu     sync.Mutex
+	status SchemaValidationStatus
+	cancel context.CancelFunc
+}
+
+// snapshot returns a copy of the job's current status
+func (j *validationJob) snapshot() SchemaValidationStatus {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	status := j.status
+	status.Violations = append([]SchemaViolation{}, j.status.Violations...)
+	return status
+}
+
+// running reports whether the job has not finished yet
+func (j *validationJob) running() bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.status.State == RebuildStateRunning
+}
+
+// jobStatus implements backgroundJob. A validation does not know its total in advance.
+func (j *validationJob) jobStatus() JobStatus {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return JobStatus{
+		ID:         j.status.JobID,
+		Type:       JobTypeValidation,
+		Collection: j.status.Collection,
+		State:      j.status.State,
+		Processed:  j.status.Scanned,
+		StartedAt:  j.status.StartedAt,
+		FinishedAt: j.status.FinishedAt,
+	}
+}
+
+// stop implements backgroundJob
+func (j *validationJob) stop() { j.cancel() }
+
+// HandleValidateSchema handles POST requests that start checking every document of a
+// collection against its schema in the background, reporting the documents that
+// violate it (see storage.SchemaViolations) without modifying anything. Undeclared
+// fields are reported whether or not the schema is strict, so a collection can be
+// cleaned up before strict mode is turned on. The collection's default filter does not
+// hide documents from the scan. It responds immediately with the job's ID and status;
+// only one validation may run per collection at a time.
+func (h *Handler) HandleValidateSchema(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	collName := vars["coll"]
+
+	logf(r, "INFO: handleValidateSchema called for collection '%s'", collName)
+
+	schema := h.storage.GetCollectionSchema(collName)
+	if len(schema) == 0 {
+		writeError(w, http.StatusConflict, ErrCodeConflict, fmt.Sprintf("collection %s has no schema", collName))
+		return
+	}
+
+	h.validationMu.Lock()
+	defer h.validationMu.Unlock()
+	if existing, exists := h.validationJobs[collName]; exists && existing.running() {
+		writeError(w, http.StatusConflict, ErrCodeConflict, fmt.Sprintf("a schema validation is already running for collection %s", collName))
+		return
+	}
+
+	// Validations outlive the request, so they are not tied to its context, but keep its ID for logging
+	ctx, cancel := context.WithCancel(domain.WithRequestID(context.Background(), domain.RequestID(r.Context())))
+	docs, err := h.storage.FindAllStreamContext(domain.WithoutDefaultFilter(ctx), collName, nil)
+	if err != nil {
+		cancel()
+		logf(r, "ERROR: Failed to scan collection '%s': %v", collName, err)
+		writeStorageError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	h.validationSeq++
+	job := &validationJob{
+		status: SchemaValidationStatus{
+			Success:    true,
+			Collection: collName,
+			JobID:      fmt.Sprintf("validation-%d", h.validationSeq),
+			State:      RebuildStateRunning,
+			Schema:     schema,
+			Violations: []SchemaViolation{},
+			StartedAt:  time.Now().UTC(),
+		},
+		cancel: cancel,
+	}
+	if h.validationJobs == nil {
+		h.validationJobs = make(map[string]*validationJob)
+	}
+	h.validationJobs[collName] = job
+	h.registerJob(job)
+
+	go h.runValidation(ctx, job, schema, docs)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(job.snapshot())
+}
+
+// runValidation checks each streamed document against schema and records progress and
+// the outcome on job
+func (h *Handler) runValidation(ctx context.Context, job *validationJob, schema map[string]domain.FieldType, docs <-chan domain.Document) {
+	defer job.cancel()
+
+	for doc := range docs {
+		reasons := storage.SchemaViolations(schema, doc)
+
+		job.mu.Lock()
+		job.status.Scanned++
+		if reasons != nil {
+			job.status.Invalid++
+			if len(job.status.Violations) < MaxReportedViolations {
+				id, _ := doc["_id"].(string)
+				job.status.Violations = append(job.status.Violations, SchemaViolation{ID: id, Reasons: reasons})
+			} else {
+				job.status.Truncated = true
+			}
+		}
+		job.mu.Unlock()
+	}
+
+	collName := job.snapshot().Collection
+	job.mu.Lock()
+	defer job.mu.Unlock()
+	finishedAt := time.Now().UTC()
+	job.status.FinishedAt = &finishedAt
+	// A stream closed by cancellation is partial
+	if ctx.Err() != nil {
+		job.status.State = RebuildStateCancelled
+		logContextf(ctx, "WARN: Schema validation of collection '%s' cancelled after %d documents", collName, job.status.Scanned)
+		return
+	}
+	job.status.State = RebuildStateCompleted
+	logContextf(ctx, "INFO: Validated collection '%s' against its schema (%d of %d documents invalid)", collName, job.status.Invalid, job.status.Scanned)
+}
+
+// HandleGetValidationStatus handles GET requests for the progress and report of a
+// collection's most recent schema validation. An optional ?job_id= must name that
+// validation.
+func (h *Handler) HandleGetValidationStatus(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	collName := vars["coll"]
+
+	job, ok := h.findValidationJob(w, r, collName)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(job.snapshot())
+}
+
+// HandleCancelValidation handles DELETE requests that stop a collection's running
+// schema validation. The report keeps the documents scanned so far.
+func (h *Handler) HandleCancelValidation(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	collName := vars["coll"]
+
+	logf(r, "INFO: handleCancelValidation called for collection '%s'", collName)
+
+	job, ok := h.findValidationJob(w, r, collName)
+	if !ok {
+		return
+	}
+	if !job.running() {
+		writeError(w, http.StatusConflict, ErrCodeConflict, fmt.Sprintf("schema validation %s has already finished", job.snapshot().JobID))
+		return
+	}
+	job.cancel()
+
+	// The job reports cancelled once the scan notices, which may take a moment
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(job.snapshot())
+}
+
+// findValidationJob returns a collection's most recent schema validation, writing a 404
+// if there is none or it does not match the request's job_id parameter
+func (h *Handler) findValidationJob(w http.ResponseWriter, r *http.Request, collName string) (*validationJob, bool) {
+	h.validationMu.Lock()
+	job, exists := h.validationJobs[collName]
+	h.validationMu.Unlock()
+
+	if !exists {
+		writeError(w, http.StatusNotFound, ErrCodeNotFound, fmt.Sprintf("no schema validation found for collection %s", collName))
+		return nil, false
+	}
+	if jobID := r.URL.Query().Get("job_id"); jobID != "" && jobID != job.snapshot().JobID {
+		writeError(w, http.StatusNotFound, ErrCodeNotFound, fmt.Sprintf("schema validation %s not found for collection %s", jobID, collName))
+		return nil, false
+	}
+	return job, true
+}
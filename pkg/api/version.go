@@ -0,0 +1,41 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/adfharrison1/go-db/pkg/storage"
+)
+
+// DefaultVersion is reported by GET /version when no release version was configured
+const DefaultVersion = "dev"
+
+// VersionResponse describes the running server for client compatibility checks
+type VersionResponse struct {
+	Version         string   `json:"version"`
+	FormatVersion   int      `json:"format_version"`
+	Engine          string   `json:"engine"`
+	FilterOperators []string `json:"filter_operators"`
+}
+
+// HandleVersion handles GET requests for the server version: the go-db release,
+// the on-disk format version, the active storage engine and the filter operators
+// accepted in queries
+func (h *Handler) HandleVersion(w http.ResponseWriter, r *http.Request) {
+	response := VersionResponse{
+		Version:         h.version,
+		FormatVersion:   storage.FormatVersion,
+		Engine:          h.engine,
+		FilterOperators: storage.SupportedFilterOperators(),
+	}
+	if response.Version == "" {
+		response.Version = DefaultVersion
+	}
+	if response.Engine == "" {
+		response.Engine = "unknown"
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,17 @@
+package domain
+
+// EvictPolicy selects which document a capped collection evicts when an insert takes it past its cap
+type EvictPolicy string
+
+const (
+	// EvictFIFO evicts the oldest inserted document first
+	EvictFIFO EvictPolicy = "fifo"
+	// EvictLRU evicts the least recently read or written document first
+	EvictLRU EvictPolicy = "lru"
+)
+
+// CappedConfig describes the size cap of a capped collection
+type CappedConfig struct {
+	MaxDocs int64       `json:"max_docs"`
+	Policy  EvictPolicy `json:"policy"`
+}
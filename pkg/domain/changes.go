@@ -0,0 +1,32 @@
+package domain
+
+import "time"
+
+// ChangeOp is the kind of write a change records
+type ChangeOp string
+
+const (
+	// ChangeInsert records a new document
+	ChangeInsert ChangeOp = "insert"
+	// ChangeUpdate records a partial update or replacement of an existing document
+	ChangeUpdate ChangeOp = "update"
+	// ChangeDelete records a removed document
+	ChangeDelete ChangeOp = "delete"
+)
+
+// Change is one write in a collection's change log
+type Change struct {
+	Offset    int64     `json:"offset"` // Position in the collection's log, starting at 1
+	Op        ChangeOp  `json:"op"`
+	DocID     string    `json:"doc_id"`
+	Document  Document  `json:"document"` // Document after the write, nil for deletes
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// ChangeFeed is a page of the changes to a collection after an offset
+type ChangeFeed struct {
+	Changes    []Change `json:"changes"`
+	NextOffset int64    `json:"next_offset"` // Offset to poll from next
+	HasMore    bool     `json:"has_more"`    // More changes follow NextOffset already
+	Truncated  bool     `json:"truncated"`   // Changes after the requested offset are no longer retained
+}
@@ -0,0 +1,10 @@
+package domain
+
+// CollectionInfoSummary describes a collection the engine knows of, whether or not its
+// documents are loaded
+type CollectionInfoSummary struct {
+	Name          string `json:"name"`
+	DocumentCount int64  `json:"document_count"`
+	State         string `json:"state"`        // "unloaded", "loading", "loaded" or "dirty" (unsaved changes)
+	SizeOnDisk    int64  `json:"size_on_disk"` // Compressed bytes of its last save; 0 if never saved
+}
@@ -0,0 +1,21 @@
+package domain
+
+// CollectionIndex describes an index created along with a collection: a regular
+// index on Field, or a partial index when Condition is set
+type CollectionIndex struct {
+	Field     string                 `json:"field"`
+	Condition map[string]interface{} `json:"condition,omitempty"`
+}
+
+// CollectionOptions configures a collection as it is created, in place of a call to
+// each setting endpoint afterwards. Each field matches the setting of the same name;
+// unset fields leave the setting off.
+type CollectionOptions struct {
+	Indexes       []CollectionIndex      `json:"indexes,omitempty"`
+	Schema        map[string]FieldType   `json:"schema,omitempty"`
+	StrictSchema  bool                   `json:"strict_schema,omitempty"` // Requires Schema
+	Defaults      Document               `json:"defaults,omitempty"`
+	DefaultFilter map[string]interface{} `json:"default_filter,omitempty"`
+	Capped        *CappedConfig          `json:"capped,omitempty"`
+	Compact       bool                   `json:"compact,omitempty"`
+}
@@ -0,0 +1,47 @@
+package domain
+
+import "context"
+
+type contextKey int
+
+const (
+	skipDefaultFilterKey contextKey = iota
+	requestIDKey
+	durableWriteKey
+)
+
+// WithoutDefaultFilter returns a context that tells the storage engine not to
+// apply the collection's default filter (e.g. to include soft-deleted documents)
+func WithoutDefaultFilter(ctx context.Context) context.Context {
+	return context.WithValue(ctx, skipDefaultFilterKey, true)
+}
+
+// SkipDefaultFilter reports whether the collection default filter should be bypassed
+func SkipDefaultFilter(ctx context.Context) bool {
+	skip, _ := ctx.Value(skipDefaultFilterKey).(bool)
+	return skip
+}
+
+// WithRequestID returns a context carrying the ID of the request that started an
+// operation, so log lines emitted on its behalf can be correlated
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey, id)
+}
+
+// RequestID returns the request ID carried by ctx, or "" if there is none
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
+
+// WithDurableWrite returns a context asking the storage engine to fail a write that
+// cannot be persisted before returning, rather than retrying it in the background
+func WithDurableWrite(ctx context.Context) context.Context {
+	return context.WithValue(ctx, durableWriteKey, true)
+}
+
+// DurableWrite reports whether a write must be persisted before it returns
+func DurableWrite(ctx context.Context) bool {
+	durable, _ := ctx.Value(durableWriteKey).(bool)
+	return durable
+}
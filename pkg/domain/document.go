@@ -3,10 +3,13 @@ package domain
 // Document represents a document in the database
 type Document map[string]interface{}
 
-// Collection represents a collection of documents
+// Collection represents a collection of documents. Its documents are in Documents,
+// or in Store for a collection kept in another encoding; use the accessor methods
+// (Get, Set, Range and so on) to reach them either way.
 type Collection struct {
 	Name      string              `json:"name"`
 	Documents map[string]Document `json:"documents"`
+	Store     DocumentStore       `json:"-"` // Holds the documents instead of Documents when set
 }
 
 // NewCollection creates a new collection
@@ -16,3 +19,13 @@ func NewCollection(name string) *Collection {
 		Documents: make(map[string]Document),
 	}
 }
+
+// ArraySlice is a window of the elements of a document's array field
+type ArraySlice struct {
+	Field   string        `json:"field"`
+	Items   []interface{} `json:"items"`
+	Offset  int           `json:"offset"`
+	Limit   int           `json:"limit"`
+	Total   int           `json:"total"` // Length of the whole array
+	HasMore bool          `json:"has_more"`
+}
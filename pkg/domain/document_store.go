@@ -0,0 +1,101 @@
+package domain
+
+// DocumentStore holds the documents of a collection in place of its Documents map,
+// for collections kept in another in-memory encoding. Get and Range return decoded
+// copies, so a document must be passed to Set again for a change to it to be kept.
+// A store is safe for concurrent use, and Range sees the documents stored when it
+// starts, so fn may change the store.
+type DocumentStore interface {
+	Get(id string) (Document, bool)
+	Has(id string) bool
+	Set(id string, doc Document)
+	Delete(id string)
+	Len() int
+	// Range calls fn for each document, in no particular order, until fn returns false
+	Range(fn func(id string, doc Document) bool)
+	// RangeIDs is like Range without decoding the documents
+	RangeIDs(fn func(id string) bool)
+	// Size returns the bytes the stored documents occupy
+	Size() int64
+}
+
+// Get returns the document with the given ID
+func (c *Collection) Get(id string) (Document, bool) {
+	if c.Store != nil {
+		return c.Store.Get(id)
+	}
+	doc, exists := c.Documents[id]
+	return doc, exists
+}
+
+// Has reports whether the collection holds a document with the given ID
+func (c *Collection) Has(id string) bool {
+	if c.Store != nil {
+		return c.Store.Has(id)
+	}
+	_, exists := c.Documents[id]
+	return exists
+}
+
+// Set stores doc under id, replacing any document already there
+func (c *Collection) Set(id string, doc Document) {
+	if c.Store != nil {
+		c.Store.Set(id, doc)
+		return
+	}
+	c.Documents[id] = doc
+}
+
+// Delete removes the document with the given ID, if any
+func (c *Collection) Delete(id string) {
+	if c.Store != nil {
+		c.Store.Delete(id)
+		return
+	}
+	delete(c.Documents, id)
+}
+
+// Len returns the number of documents in the collection
+func (c *Collection) Len() int {
+	if c.Store != nil {
+		return c.Store.Len()
+	}
+	return len(c.Documents)
+}
+
+// Range calls fn for each document until fn returns false. fn may delete the
+// document it is given.
+func (c *Collection) Range(fn func(id string, doc Document) bool) {
+	if c.Store != nil {
+		c.Store.Range(fn)
+		return
+	}
+	for id, doc := range c.Documents {
+		if !fn(id, doc) {
+			return
+		}
+	}
+}
+
+// RangeIDs calls fn with each document ID until fn returns false
+func (c *Collection) RangeIDs(fn func(id string) bool) {
+	if c.Store != nil {
+		c.Store.RangeIDs(fn)
+		return
+	}
+	for id := range c.Documents {
+		if !fn(id) {
+			return
+		}
+	}
+}
+
+// IDs returns the IDs of every document, in no particular order
+func (c *Collection) IDs() []string {
+	ids := make([]string, 0, c.Len())
+	c.RangeIDs(func(id string) bool {
+		ids = append(ids, id)
+		return true
+	})
+	return ids
+}
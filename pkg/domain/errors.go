@@ -0,0 +1,92 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrInvalidFilter is returned when a query filter cannot be parsed or evaluated
+var ErrInvalidFilter = errors.New("invalid filter")
+
+// ErrInvalidCollectionName is returned when a collection name violates the naming policy
+var ErrInvalidCollectionName = errors.New("invalid collection name")
+
+// ErrCollectionExists is returned when creating a collection under a name that is already in use
+var ErrCollectionExists = errors.New("collection already exists")
+
+// ErrCollectionLimitReached is returned when creating a collection would exceed the configured maximum
+var ErrCollectionLimitReached = errors.New("collection limit reached")
+
+// ErrInvalidCursor is returned when a pagination cursor is malformed, tampered with or expired
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// ErrResultTooLarge is returned when a query matches more documents than the configured maximum result size
+var ErrResultTooLarge = errors.New("result too large")
+
+// ErrInvalidField is returned when an operation names a field it cannot apply to, such as "_id"
+var ErrInvalidField = errors.New("invalid field")
+
+// ErrInconsistentFieldTypes is returned when a strict type check finds documents storing a field with different types
+var ErrInconsistentFieldTypes = errors.New("inconsistent field types")
+
+// ErrFieldNotInSchema is returned when a strict collection schema does not declare a field a write would store
+var ErrFieldNotInSchema = errors.New("field not in schema")
+
+// ErrChangeFeedDisabled is returned when reading the changes of a collection while the change log is turned off
+var ErrChangeFeedDisabled = errors.New("change feed disabled")
+
+// ErrInsertionOrderDisabled is returned when listing documents in insertion order while the engine does not track it
+var ErrInsertionOrderDisabled = errors.New("insertion order disabled")
+
+// ErrTimestampsDisabled is returned when selecting documents by modification time while the engine does not maintain _updated_at
+var ErrTimestampsDisabled = errors.New("timestamps disabled")
+
+// ErrVersionsDisabled is returned when updating a document conditionally on its version while the engine does not maintain _version
+var ErrVersionsDisabled = errors.New("document versions disabled")
+
+// ErrVersionConflict is returned when a conditional update expects a document version other than the stored one
+var ErrVersionConflict = errors.New("version conflict")
+
+// ErrTxnDone is returned when a transaction is used after it was committed or rolled back
+var ErrTxnDone = errors.New("transaction already finished")
+
+// ErrCompactUnsupported is returned when marking a collection compact on an engine that cannot encode documents compactly
+var ErrCompactUnsupported = errors.New("compact encoding unsupported")
+
+// ErrNotDurable is returned when a write that asked to be durable could not be persisted before returning
+var ErrNotDurable = errors.New("write not durable")
+
+// ErrCollectionNotFound is returned when an operation names a collection that does not exist
+var ErrCollectionNotFound = errors.New("collection not found")
+
+// ErrDocumentNotFound is returned when an operation names a document ID that does not exist
+var ErrDocumentNotFound = errors.New("document not found")
+
+// ErrDocumentExists is returned when a write would store a document under an ID that is already taken
+var ErrDocumentExists = errors.New("document already exists")
+
+// ErrDuplicateKey is returned when a write would give two documents the same key in a unique index
+var ErrDuplicateKey = errors.New("duplicate key")
+
+// ErrFieldNotFound is returned when an operation names a document field that does not exist
+var ErrFieldNotFound = errors.New("field not found")
+
+// ErrIndexNotFound is returned when an operation names an index that does not exist
+var ErrIndexNotFound = errors.New("index not found")
+
+// Errorf formats an error like fmt.Errorf that matches kind with errors.Is without
+// adding kind's text to its message, so existing messages stay as they are
+func Errorf(kind error, format string, args ...interface{}) error {
+	return &kindError{kind: kind, err: fmt.Errorf(format, args...)}
+}
+
+// kindError is an error classified by a sentinel error
+type kindError struct {
+	kind error
+	err  error
+}
+
+func (e *kindError) Error() string { return e.err.Error() }
+
+// Unwrap returns the sentinel and any error wrapped by the message
+func (e *kindError) Unwrap() []error { return []error{e.kind, e.err} }
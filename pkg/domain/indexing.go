@@ -7,6 +7,7 @@ type IndexEngine interface {
 	FindByIndex(collectionName, fieldName string, value interface{}) ([]Document, error)
 	GetIndexes(collectionName string) ([]string, error)
 	UpdateIndex(collectionName, fieldName string) error
+	DumpIndex(collectionName, fieldName string, offset, limit, maxIDs int) (*IndexDump, error)
 }
 
 // Index represents an index on a collection field
@@ -15,3 +16,35 @@ type Index struct {
 	FieldName      string                 `json:"field_name"`
 	Values         map[interface{}]string `json:"values"` // value -> document ID
 }
+
+// IndexEntry is one key of an index dump with the IDs of the documents stored under it
+type IndexEntry struct {
+	Key   interface{} `json:"key"`
+	Type  string      `json:"type"`  // Go type of the stored key, e.g. float64 for normalized numbers
+	Count int         `json:"count"` // Documents under the key, including any left out of IDs
+	IDs   []string    `json:"ids"`
+}
+
+// IndexDump is a page of an index's raw key -> document IDs entries, for debugging
+type IndexDump struct {
+	Collection string                 `json:"collection"`
+	Field      string                 `json:"field"`
+	Condition  map[string]interface{} `json:"condition,omitempty"` // Filter of a partial index
+	Collation  string                 `json:"collation,omitempty"` // Collation string keys are folded under
+	Multikey   bool                   `json:"multikey"`
+	TotalKeys  int                    `json:"total_keys"`
+	TotalIDs   int                    `json:"total_ids"` // Key and ID pairs across the whole index
+	Offset     int                    `json:"offset"`
+	NextOffset int                    `json:"next_offset"`
+	Entries    []IndexEntry           `json:"entries"`
+	Truncated  bool                   `json:"truncated"` // More keys follow, or IDs were left out
+}
+
+// FieldTypeReport summarizes the JSON types a field holds across a collection, so
+// an index can be checked for documents that store its field inconsistently
+type FieldTypeReport struct {
+	Field      string           `json:"field"`
+	Types      map[string]int64 `json:"types"`   // Type name (string, number, boolean, object, array, null) -> documents
+	Missing    int64            `json:"missing"` // Documents without the field
+	Consistent bool             `json:"consistent"`
+}
@@ -0,0 +1,16 @@
+package domain
+
+// LockStats counts the goroutines holding and waiting for a kind of lock at one moment
+type LockStats struct {
+	ReadHolders  int64 `json:"read_holders"`
+	ReadWaiters  int64 `json:"read_waiters"`
+	WriteHolders int64 `json:"write_holders"`
+	WriteWaiters int64 `json:"write_waiters"`
+}
+
+// CollectionLockStats reports the lock activity of one collection
+type CollectionLockStats struct {
+	Name       string    `json:"name"`
+	Collection LockStats `json:"collection"` // Collection-wide lock
+	Documents  LockStats `json:"documents"`  // Summed over the collection's document locks
+}
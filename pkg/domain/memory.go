@@ -0,0 +1,21 @@
+package domain
+
+// CollectionMemoryUsage is an estimate of the memory a collection's documents hold
+type CollectionMemoryUsage struct {
+	Name           string `json:"name"`
+	Documents      int64  `json:"documents"`
+	EstimatedBytes int64  `json:"estimated_bytes"` // 0 when the collection is not resident
+	Resident       bool   `json:"resident"`        // Documents are loaded in memory
+	CachedDocs     int    `json:"cached_documents"`
+	Pinned         bool   `json:"pinned"`  // Never evicted from the cache
+	Compact        bool   `json:"compact"` // Documents are kept in a compact encoding
+}
+
+// PreloadProgress reports how far the startup preload of collections has got
+type PreloadProgress struct {
+	Total  int               `json:"total"`
+	Loaded int               `json:"loaded"`
+	Failed int               `json:"failed"`
+	Done   bool              `json:"done"`             // Every collection has been attempted
+	Errors map[string]string `json:"errors,omitempty"` // Collection name -> load error
+}
@@ -1,9 +1,12 @@
 package domain
 
 import (
+	"crypto/hmac"
+	"crypto/sha256"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"strings"
 	"time"
 )
 
@@ -18,9 +21,21 @@ type PaginationOptions struct {
 	Offset int `json:"offset,omitempty"`
 
 	// Common
-	MaxLimit int `json:"max_limit,omitempty"` // Maximum allowed limit
+	MaxLimit int    `json:"max_limit,omitempty"` // Maximum allowed limit
+	Order    string `json:"order,omitempty"`     // OrderByID (default) or OrderInserted
+
+	// Sorting by a field instead of _id; ties and documents without the field follow in _id order
+	SortField string `json:"sort_field,omitempty"`
+	SortDesc  bool   `json:"sort_desc,omitempty"`
+	Collation string `json:"collation,omitempty"` // How SortField strings compare: "" (by byte) or a collation such as CollationCaseInsensitive
 }
 
+// Result orders for PaginationOptions.Order
+const (
+	OrderByID     = "id"       // Sorted by _id
+	OrderInserted = "inserted" // Insertion order, for engines tracking it; no sort
+)
+
 // PaginationResult contains pagination metadata
 type PaginationResult struct {
 	Documents  []Document `json:"documents"`
@@ -28,7 +43,21 @@ type PaginationResult struct {
 	HasPrev    bool       `json:"has_prev"`
 	NextCursor string     `json:"next_cursor,omitempty"`
 	PrevCursor string     `json:"prev_cursor,omitempty"`
-	Total      int64      `json:"total,omitempty"` // Only for offset-based
+	Total      int64      `json:"total,omitempty"`       // Only for offset-based
+	Page       int        `json:"page,omitempty"`        // 1-based page number; only for offset-based
+	TotalPages int        `json:"total_pages,omitempty"` // Pages needed for Total; only for offset-based
+}
+
+// SetPage sets Page and TotalPages for an offset-based page of at most limit
+// documents starting at offset. An offset that is not a multiple of limit counts as
+// the page it falls in. TotalPages is computed from Total, so it stays zero when
+// Total is not known. Cursor-based results leave both zero.
+func (r *PaginationResult) SetPage(offset, limit int) {
+	if limit <= 0 {
+		return
+	}
+	r.Page = offset/limit + 1
+	r.TotalPages = int((r.Total + int64(limit) - 1) / int64(limit))
 }
 
 // Cursor represents a pagination cursor
@@ -62,6 +91,44 @@ func DecodeCursor(encoded string) (*Cursor, error) {
 	return &cursor, nil
 }
 
+// cursorSignatureSeparator joins a cursor to its signature; it is not in the base64url alphabet
+const cursorSignatureSeparator = "."
+
+// SignCursor appends an HMAC-SHA256 signature of an encoded cursor, keyed by secret
+func SignCursor(encoded string, secret []byte) string {
+	return encoded + cursorSignatureSeparator + cursorSignature(encoded, secret)
+}
+
+// VerifySignedCursor checks a cursor produced by SignCursor and returns the encoded
+// cursor without its signature. Unsigned or tampered cursors are rejected, as are
+// cursors older than maxAge when maxAge is positive. Cursors without a timestamp
+// never expire; the signature guarantees the server issued them that way.
+func VerifySignedCursor(signed string, secret []byte, maxAge time.Duration) (string, error) {
+	sep := strings.LastIndex(signed, cursorSignatureSeparator)
+	if sep < 0 {
+		return "", fmt.Errorf("%w: cursor is not signed", ErrInvalidCursor)
+	}
+	encoded, signature := signed[:sep], signed[sep+1:]
+	if !hmac.Equal([]byte(signature), []byte(cursorSignature(encoded, secret))) {
+		return "", fmt.Errorf("%w: signature mismatch", ErrInvalidCursor)
+	}
+
+	if maxAge > 0 {
+		if cursor, err := DecodeCursor(encoded); err == nil && !cursor.Timestamp.IsZero() {
+			if age := time.Since(cursor.Timestamp); age > maxAge {
+				return "", fmt.Errorf("%w: cursor expired %s ago", ErrInvalidCursor, (age - maxAge).Round(time.Second))
+			}
+		}
+	}
+	return encoded, nil
+}
+
+func cursorSignature(encoded string, secret []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(encoded))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
 // DefaultPaginationOptions returns default pagination settings
 func DefaultPaginationOptions() *PaginationOptions {
 	return &PaginationOptions{
@@ -87,5 +154,17 @@ func (po *PaginationOptions) Validate() error {
 		return fmt.Errorf("cannot mix cursor-based and offset-based pagination")
 	}
 
+	if po.Order != "" && po.Order != OrderByID && po.Order != OrderInserted {
+		return fmt.Errorf("unknown order %q (use %s or %s)", po.Order, OrderByID, OrderInserted)
+	}
+
+	if po.SortField != "" && po.Order == OrderInserted {
+		return fmt.Errorf("cannot sort by field %s in %s order", po.SortField, OrderInserted)
+	}
+
+	if err := ValidateCollation(po.Collation); err != nil {
+		return err
+	}
+
 	return nil
 }
@@ -0,0 +1,15 @@
+package domain
+
+// FieldType is a collection schema type hint, telling filters and indexes how to
+// compare a field's values
+type FieldType string
+
+const (
+	// FieldTypeTime marks a field holding points in time, stored as RFC 3339 strings
+	// or Unix seconds, which are compared chronologically
+	FieldTypeTime FieldType = "time"
+
+	// FieldTypeAny declares a field without a type hint, so a strict schema allows it
+	// while its values compare as usual
+	FieldTypeAny FieldType = "any"
+)
@@ -1,5 +1,10 @@
 package domain
 
+import (
+	"context"
+	"time"
+)
+
 // BatchUpdateOperation represents a single update operation in a batch
 type BatchUpdateOperation struct {
 	ID      string   `json:"id"`      // Document ID to update
@@ -10,25 +15,97 @@ type BatchUpdateOperation struct {
 // This is the core business interface that implementations must conform to
 type StorageEngine interface {
 	Insert(collName string, doc Document) (Document, error)
+	InsertContext(ctx context.Context, collName string, doc Document) (Document, error)
+	InsertIfNotExists(collName string, filter map[string]interface{}, doc Document) (Document, bool, error)
+	InsertIfNotExistsContext(ctx context.Context, collName string, filter map[string]interface{}, doc Document) (Document, bool, error)
+	Upsert(collName string, filter map[string]interface{}, update Document) (Document, bool, error)
+	UpsertContext(ctx context.Context, collName string, filter map[string]interface{}, update Document) (Document, bool, error)
+	UpsertById(collName, docId string, doc Document) (Document, bool, error)
+	UpsertByIdContext(ctx context.Context, collName, docId string, doc Document) (Document, bool, error)
 	BatchInsert(collName string, docs []Document) ([]Document, error)
+	BatchInsertContext(ctx context.Context, collName string, docs []Document) ([]Document, error)
 	FindAll(collName string, filter map[string]interface{}, options *PaginationOptions) (*PaginationResult, error)
 	FindAllStream(collName string, filter map[string]interface{}) (<-chan Document, error)
+	FindAllContext(ctx context.Context, collName string, filter map[string]interface{}, options *PaginationOptions) (*PaginationResult, error)
+	FindAllStreamContext(ctx context.Context, collName string, filter map[string]interface{}) (<-chan Document, error)
+	FindAcrossCollections(pattern string, filter map[string]interface{}, options *PaginationOptions) (*PaginationResult, error)
+	FindAcrossCollectionsContext(ctx context.Context, pattern string, filter map[string]interface{}, options *PaginationOptions) (*PaginationResult, error)
+	Facets(collName string, filter map[string]interface{}, fields []string) (map[string]map[interface{}]int64, error)
+	FacetsContext(ctx context.Context, collName string, filter map[string]interface{}, fields []string) (map[string]map[interface{}]int64, error)
+	Sample(collName string, size int, seed *int64) ([]Document, error)
+	SampleContext(ctx context.Context, collName string, size int, seed *int64) ([]Document, error)
+	FindIds(collName string, filter map[string]interface{}) ([]string, error)
+	FindIdsContext(ctx context.Context, collName string, filter map[string]interface{}) ([]string, error)
 	GetById(collName, docId string) (Document, error)
+	DocumentExists(collName, docId string, filter map[string]interface{}) bool
+	GetArraySlice(collName, docId, field string, offset, limit int) (*ArraySlice, error)
+	GetNextById(collName, afterId string) (Document, error)
+	GetPrevById(collName, beforeId string) (Document, error)
 	UpdateById(collName, docId string, updates Document) (Document, error)
+	UpdateByIdContext(ctx context.Context, collName, docId string, updates Document) (Document, error)
+	UpdateByIdIfVersion(collName, docId string, expectedVersion int, updates Document) (Document, error)
+	UpdateByIdIfVersionContext(ctx context.Context, collName, docId string, expectedVersion int, updates Document) (Document, error)
 	ReplaceById(collName, docId string, newDoc Document) (Document, error)
+	ReplaceByIdContext(ctx context.Context, collName, docId string, newDoc Document) (Document, error)
+	CompareAndSetField(collName, docId, field string, expected, newValue interface{}) (bool, error)
 	BatchUpdate(collName string, updates []BatchUpdateOperation) ([]Document, error)
+	UpdateMany(collName string, filter map[string]interface{}, updates Document) (int64, error)
+	UpdateManyContext(ctx context.Context, collName string, filter map[string]interface{}, updates Document) (int64, error)
 	DeleteById(collName, docId string) error
+	DeleteByIdContext(ctx context.Context, collName, docId string) error
+	DeleteByIdReturning(collName, docId string) (Document, error)
+	DeleteByIdReturningContext(ctx context.Context, collName, docId string) (Document, error)
+	GetChanges(ctx context.Context, collName string, since int64, limit int, wait time.Duration) (*ChangeFeed, error)
 	CreateCollection(collName string) error
+	CreateCollectionWithOptions(collName string, opts CollectionOptions) error
+	CopyCollection(src, dst string) error
+	DropCollection(collName string) error
+	ListCollections() []CollectionInfoSummary
+	MoveDocument(srcColl, docId, dstColl string, keepID bool) (Document, error)
 	GetCollection(collName string) (*Collection, error)
 	LoadCollectionMetadata(filename string) error
 	SaveToFile(filename string) error
+	CheckpointNow() error
 	GetMemoryStats() map[string]interface{}
+	CollectionMemoryUsage() []CollectionMemoryUsage
+	LockStats() []CollectionLockStats
+	SetMaxMemory(mb int) error
+	PinCollection(collName string)
+	UnpinCollection(collName string)
+	IsCollectionPinned(collName string) bool
+	PreloadCollections() error
+	PreloadProgress() PreloadProgress
 	StartBackgroundWorkers()
 	StopBackgroundWorkers()
 	SaveCollectionAfterTransaction(collName string) error
 	IsNoSavesEnabled() bool
+	AutoTimestampsEnabled() bool
+	DocumentVersionsEnabled() bool
+	AppliedOffset() int64
 	GetIndexes(collName string) ([]string, error)
+	FindByIndex(collName, fieldName string, value interface{}) ([]Document, error)
+	SetCollectionDefaultFilter(collName string, filter map[string]interface{})
+	GetCollectionDefaultFilter(collName string) map[string]interface{}
+	SetCollectionDefaults(collName string, defaults Document)
+	GetCollectionDefaults(collName string) Document
+	SetCollectionSchema(collName string, schema map[string]FieldType)
+	GetCollectionSchema(collName string) map[string]FieldType
+	SetCollectionSchemaStrict(collName string, strict bool)
+	IsCollectionSchemaStrict(collName string) bool
+	SetCollectionCapped(collName string, maxDocs int64, policy EvictPolicy) error
+	GetCollectionCapped(collName string) *CappedConfig
+	SetCollectionCompact(collName string, compact bool) error
+	IsCollectionCompact(collName string) bool
 	CreateIndex(collName, fieldName string) error
+	CreatePartialIndex(collName, fieldName string, condition map[string]interface{}) error
+	CreateUniqueIndex(collName, fieldName string) error
+	CreateCompoundIndex(collName string, fieldNames []string, unique bool) error
+	CreateCollatedIndex(collName, fieldName, collation string, unique bool) error
+	CreateIndexWithTypeCheck(collName, fieldName string, reject bool) (*FieldTypeReport, error)
+	DropAllIndexes(collName string) (int, error)
+	RebuildIndexes(collName string) error
+	RebuildIndexesContext(ctx context.Context, collName string, progress func(processed, total int)) error
+	TransformDocumentsContext(ctx context.Context, collName string, transform func(Document) (Document, bool), progress func(processed, total int)) (int, error)
 }
 
 // DatabaseEngine combines StorageEngine and IndexEngine interfaces
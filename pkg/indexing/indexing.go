@@ -1,7 +1,11 @@
 package indexing
 
 import (
+	"context"
 	"fmt"
+	"reflect"
+	"sort"
+	"strings"
 	"sync"
 
 	"github.com/adfharrison1/go-db/pkg/domain"
@@ -9,22 +13,84 @@ import (
 
 // IndexEngine implements domain.IndexEngine interface
 type IndexEngine struct {
-	indexes map[string]map[string]*Index // Collection name -> field name -> index
-	mu      sync.RWMutex                 // Protects concurrent access to indexes
+	indexes   map[string]map[string]*Index // Collection name -> field name -> index
+	mu        sync.RWMutex                 // Protects concurrent access to indexes
+	exactKeys bool                         // Disables numeric key normalization for new indexes
+}
+
+// IndexEngineOption configures optional IndexEngine behaviour
+type IndexEngineOption func(*IndexEngine)
+
+// WithNumericKeyNormalization controls whether indexes created by the engine store
+// and look up numbers as float64 (the default), so that 30, 30.0 and int8(30) share
+// an index entry as they do in filter comparisons. Disabling it keys numbers by
+// their exact Go type.
+func WithNumericKeyNormalization(enabled bool) IndexEngineOption {
+	return func(ie *IndexEngine) {
+		ie.exactKeys = !enabled
+	}
 }
 
 // NewIndexEngine creates a new index engine
-func NewIndexEngine() *IndexEngine {
-	return &IndexEngine{
+func NewIndexEngine(opts ...IndexEngineOption) *IndexEngine {
+	ie := &IndexEngine{
 		indexes: make(map[string]map[string]*Index),
 	}
+	for _, opt := range opts {
+		opt(ie)
+	}
+	return ie
+}
+
+// NormalizeKey returns the canonical index key for a value: numbers of any Go
+// numeric type become float64 and other values are returned unchanged
+func NormalizeKey(value interface{}) interface{} {
+	switch v := value.(type) {
+	case float32:
+		return float64(v)
+	case int:
+		return float64(v)
+	case int8:
+		return float64(v)
+	case int16:
+		return float64(v)
+	case int32:
+		return float64(v)
+	case int64:
+		return float64(v)
+	case uint:
+		return float64(v)
+	case uint8:
+		return float64(v)
+	case uint16:
+		return float64(v)
+	case uint32:
+		return float64(v)
+	case uint64:
+		return float64(v)
+	default:
+		return value
+	}
 }
 
 // Index stores a mapping from a field's value to document IDs.
 type Index struct {
 	Field    string
 	Inverted map[interface{}][]string
-	mu       sync.RWMutex // Protects concurrent access to Inverted map
+	// Fields are the fields of a compound index, whose Field is CompoundIndexName(Fields)
+	// and whose keys are CompoundKeys (nil for a single-field index)
+	Fields []string
+	// Unique indexes reject writes that would store two documents under one key
+	Unique bool
+	// Condition is the filter a partial index's documents match (nil for a full index)
+	Condition map[string]interface{}
+	// Collation folds string keys by domain.CollationKey, so strings equal under it
+	// share a key (empty for exact keys)
+	Collation string
+	matches   func(domain.Document) bool
+	exactKeys bool         // Key numbers by their Go type instead of normalizing them
+	multikey  bool         // Some indexed document holds an array in the field
+	mu        sync.RWMutex // Protects concurrent access to Inverted map
 }
 
 // NewIndex creates an index on a specific field.
@@ -35,54 +101,515 @@ func NewIndex(field string) *Index {
 	}
 }
 
+// NewPartialIndex creates an index on a field that only holds documents for which
+// matches returns true. matches must evaluate condition, which is kept so that
+// queries can tell whether they may use the index.
+func NewPartialIndex(field string, condition map[string]interface{}, matches func(domain.Document) bool) *Index {
+	index := NewIndex(field)
+	index.Condition = condition
+	index.matches = matches
+	return index
+}
+
+// NewCompoundIndex creates an index on several fields, keyed by each document's
+// combination of their values. A document lacking any of the fields is not indexed.
+func NewCompoundIndex(fields []string) *Index {
+	index := NewIndex(CompoundIndexName(fields))
+	index.Fields = append([]string{}, fields...)
+	return index
+}
+
+// CompoundIndexName returns the name a compound index on fields is registered under
+func CompoundIndexName(fields []string) string {
+	return strings.Join(fields, ",")
+}
+
+// CompoundKey is the Inverted key of a compound index: the keys of its fields' values,
+// in field order, encoded together
+type CompoundKey string
+
+// compoundKey encodes one key per field of a compound index
+func compoundKey(fieldKeys []interface{}) CompoundKey {
+	parts := make([]string, len(fieldKeys))
+	for i, key := range fieldKeys {
+		parts[i] = fmt.Sprintf("%T:%#v", key, key)
+	}
+	return CompoundKey(strings.Join(parts, ","))
+}
+
+// key returns the Inverted key under which a field value is stored and looked up
+func (idx *Index) key(value interface{}) interface{} {
+	if s, ok := value.(string); ok && idx.Collation != "" {
+		return domain.CollationKey(s, idx.Collation)
+	}
+	if idx.exactKeys {
+		return value
+	}
+	return NormalizeKey(value)
+}
+
+// keys returns the Inverted keys a field value is stored under. An array is stored
+// under each of its distinct elements, making the index multikey, so a document
+// appears once per value it contains. Values and elements that cannot be map keys,
+// such as objects and nested arrays, are not indexed.
+func (idx *Index) keys(value interface{}) (keys []interface{}, isArray bool) {
+	elements, isArray := ArrayElements(value)
+	if !isArray {
+		if !isHashable(value) {
+			return nil, false
+		}
+		return []interface{}{idx.key(value)}, false
+	}
+
+	keys = make([]interface{}, 0, len(elements))
+	seen := make(map[interface{}]bool, len(elements))
+	for _, element := range elements {
+		if !isHashable(element) {
+			continue
+		}
+		key := idx.key(element)
+		if !seen[key] {
+			seen[key] = true
+			keys = append(keys, key)
+		}
+	}
+	return keys, true
+}
+
+// ArrayElements returns the elements of an array value. The second result is false
+// when the value is not an array.
+func ArrayElements(value interface{}) ([]interface{}, bool) {
+	switch v := value.(type) {
+	case []interface{}:
+		return v, true
+	case nil:
+		return nil, false
+	}
+	rv := reflect.ValueOf(value)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return nil, false
+	}
+	elements := make([]interface{}, rv.Len())
+	for i := range elements {
+		elements[i] = rv.Index(i).Interface()
+	}
+	return elements, true
+}
+
+// isHashable reports whether a value can be used as a map key
+func isHashable(value interface{}) bool {
+	return value == nil || reflect.TypeOf(value).Comparable()
+}
+
+// docKeys returns the keys a document is stored under, or nil if it does not
+// belong in the index, and whether its field holds an array
+func (idx *Index) docKeys(doc domain.Document) ([]interface{}, bool) {
+	if idx.Fields != nil {
+		if !idx.includes(doc) {
+			return nil, false
+		}
+		return idx.compoundDocKeys(doc)
+	}
+	value, ok := doc[idx.Field]
+	if !ok || !idx.includes(doc) {
+		return nil, false
+	}
+	return idx.keys(value)
+}
+
+// compoundDocKeys returns the CompoundKeys of a document in a compound index: one
+// per combination of its fields' keys, so an array in any field makes the index
+// multikey as it does a single-field index
+func (idx *Index) compoundDocKeys(doc domain.Document) ([]interface{}, bool) {
+	combinations := [][]interface{}{{}}
+	anyArray := false
+	for _, field := range idx.Fields {
+		value, ok := doc[field]
+		if !ok {
+			return nil, false
+		}
+		fieldKeys, isArray := idx.keys(value)
+		anyArray = anyArray || isArray
+		next := make([][]interface{}, 0, len(combinations)*len(fieldKeys))
+		for _, combination := range combinations {
+			for _, key := range fieldKeys {
+				next = append(next, append(append([]interface{}{}, combination...), key))
+			}
+		}
+		combinations = next
+	}
+
+	keys := make([]interface{}, len(combinations))
+	for i, combination := range combinations {
+		keys[i] = compoundKey(combination)
+	}
+	return keys, anyArray
+}
+
+// queryKey returns the Inverted key to look a value up under. A compound index is
+// queried with one value per field, in field order.
+func (idx *Index) queryKey(value interface{}) (interface{}, bool) {
+	if idx.Fields == nil {
+		return idx.key(value), isHashable(value)
+	}
+	values, ok := value.([]interface{})
+	if !ok || len(values) != len(idx.Fields) {
+		return nil, false
+	}
+	fieldKeys := make([]interface{}, len(values))
+	for i, v := range values {
+		if !isHashable(v) {
+			return nil, false
+		}
+		fieldKeys[i] = idx.key(v)
+	}
+	return compoundKey(fieldKeys), true
+}
+
+// addKeys adds a document under each key of a freshly built key map.
+// It reports whether the document's field held an array.
+func (idx *Index) addKeys(inverted map[interface{}][]string, docID string, doc domain.Document) bool {
+	keys, isArray := idx.docKeys(doc)
+	for _, key := range keys {
+		inverted[key] = append(inverted[key], docID)
+	}
+	return isArray
+}
+
+// Multikey reports whether the index holds array elements, i.e. whether some
+// indexed document stores an array in the field
+func (idx *Index) Multikey() bool {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	return idx.multikey
+}
+
+// includes reports whether a document belongs in the index
+func (idx *Index) includes(doc domain.Document) bool {
+	return idx.matches == nil || idx.matches(doc)
+}
+
 // BuildIndex indexes all documents in a collection by the specified field.
 func (idx *Index) BuildIndex(collection *domain.Collection) {
 	idx.mu.Lock()
 	defer idx.mu.Unlock()
 
-	for docID, doc := range collection.Documents {
-		val, ok := doc[idx.Field]
-		if ok {
-			idx.Inverted[val] = append(idx.Inverted[val], docID)
+	collection.Range(func(docID string, doc domain.Document) bool {
+		if idx.addKeys(idx.Inverted, docID, doc) {
+			idx.multikey = true
 		}
-	}
+		return true
+	})
 }
 
-// Query returns document IDs that match a given value in the indexed field.
+// Query returns document IDs that match a given value in the indexed field. A
+// compound index takes a []interface{} holding a value for each of its fields.
 func (idx *Index) Query(value interface{}) []string {
 	idx.mu.RLock()
 	defer idx.mu.RUnlock()
 
-	if docIDs, ok := idx.Inverted[value]; ok {
+	key, ok := idx.queryKey(value)
+	if !ok {
+		return nil
+	}
+	if docIDs, ok := idx.Inverted[key]; ok {
 		return docIDs
 	}
 	return nil
 }
 
-// UpdateIndex updates index after an insert/update/delete operation.
+// Duplicate returns a key that more than one document is stored under, as found when
+// a unique index is built over existing documents
+func (idx *Index) Duplicate() (key interface{}, docIDs []string, found bool) {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	for key, docIDs := range idx.Inverted {
+		if len(docIDs) > 1 {
+			return key, append([]string{}, docIDs...), true
+		}
+	}
+	return nil, nil, false
+}
+
+// checkUnique returns an ErrDuplicateKey error if storing docs under ids would put two
+// documents under one key (see IndexEngine.CheckUnique)
+func (idx *Index) checkUnique(collectionName string, ids []string, docs []domain.Document) error {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	last := make(map[string]int, len(ids))
+	for i, id := range ids {
+		last[id] = i
+	}
+	claimed := make(map[interface{}]string)
+	for i, id := range ids {
+		if last[id] != i || docs[i] == nil {
+			continue
+		}
+		keys, _ := idx.docKeys(docs[i])
+		for _, key := range keys {
+			if owner, taken := claimed[key]; taken && owner != id {
+				return duplicateKeyError(collectionName, idx, key, owner)
+			}
+			claimed[key] = id
+			for _, owner := range idx.Inverted[key] {
+				// Documents rewritten by the same write claim their new keys above
+				if _, rewritten := last[owner]; !rewritten {
+					return duplicateKeyError(collectionName, idx, key, owner)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// duplicateKeyError reports a key already held by another document in a unique index
+func duplicateKeyError(collectionName string, idx *Index, key interface{}, owner string) error {
+	return domain.Errorf(domain.ErrDuplicateKey, "duplicate key %v for unique index %s in collection %s: already used by document %s", key, idx.Field, collectionName, owner)
+}
+
+// ValueCounts returns the number of documents for each indexed value.
+// Values with no remaining documents are omitted.
+func (idx *Index) ValueCounts() map[interface{}]int64 {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	counts := make(map[interface{}]int64, len(idx.Inverted))
+	for value, docIDs := range idx.Inverted {
+		if len(docIDs) > 0 {
+			counts[value] = int64(len(docIDs))
+		}
+	}
+	return counts
+}
+
+// QueryMatching returns the IDs of documents whose indexed value satisfies match,
+// testing each distinct value once. The index is not sorted, so range conditions
+// are answered this way instead of by scanning every document.
+func (idx *Index) QueryMatching(match func(value interface{}) bool) []string {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	var docIDs []string
+	for value, ids := range idx.Inverted {
+		if len(ids) > 0 && match(value) {
+			docIDs = append(docIDs, ids...)
+		}
+	}
+	return docIDs
+}
+
+// Dump returns up to limit of the index's keys after the first offset, in key order,
+// with the IDs stored under each, copied so the index can change meanwhile. At most
+// maxIDs IDs are returned in all; their counts stay complete when IDs are left out.
+// Keys left without documents are skipped. The dump is meant for debugging: it
+// sorts every key on each call.
+func (idx *Index) Dump(offset, limit, maxIDs int) *domain.IndexDump {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	keys := make([]interface{}, 0, len(idx.Inverted))
+	dump := &domain.IndexDump{
+		Field:     idx.Field,
+		Condition: idx.Condition,
+		Collation: idx.Collation,
+		Multikey:  idx.multikey,
+		Offset:    offset,
+		Entries:   []domain.IndexEntry{},
+	}
+	for key, docIDs := range idx.Inverted {
+		if len(docIDs) > 0 {
+			keys = append(keys, key)
+			dump.TotalIDs += len(docIDs)
+		}
+	}
+	dump.TotalKeys = len(keys)
+	sort.Slice(keys, func(i, j int) bool { return keyLess(keys[i], keys[j]) })
+
+	if offset > len(keys) {
+		offset = len(keys)
+	}
+	page := keys[offset:]
+	if limit > 0 && len(page) > limit {
+		page = page[:limit]
+		dump.Truncated = true
+	}
+	for _, key := range page {
+		docIDs := idx.Inverted[key]
+		entry := domain.IndexEntry{Key: key, Type: fmt.Sprintf("%T", key), Count: len(docIDs)}
+		if len(docIDs) > maxIDs {
+			docIDs = docIDs[:maxIDs]
+			dump.Truncated = true
+		}
+		entry.IDs = append([]string{}, docIDs...)
+		maxIDs -= len(docIDs)
+		dump.Entries = append(dump.Entries, entry)
+	}
+	dump.NextOffset = offset + len(page)
+	return dump
+}
+
+// keyLess orders index keys for dumps: nil, booleans, numbers, strings, then other
+// types by their printed form
+func keyLess(a, b interface{}) bool {
+	rankA, rankB := keyRank(a), keyRank(b)
+	if rankA != rankB {
+		return rankA < rankB
+	}
+	switch rankA {
+	case 1:
+		return !a.(bool) && b.(bool)
+	case 2:
+		return NormalizeKey(a).(float64) < NormalizeKey(b).(float64)
+	case 3:
+		return a.(string) < b.(string)
+	}
+	return fmt.Sprintf("%T:%v", a, a) < fmt.Sprintf("%T:%v", b, b)
+}
+
+// keyRank groups index keys by kind for keyLess
+func keyRank(key interface{}) int {
+	switch key.(type) {
+	case nil:
+		return 0
+	case bool:
+		return 1
+	case string:
+		return 3
+	}
+	if _, isNumber := NormalizeKey(key).(float64); isNumber {
+		return 2
+	}
+	return 4
+}
+
+// UpdateIndex updates index after an insert/update/delete operation. For arrays
+// only the elements that were added or removed change the index.
 func (idx *Index) UpdateIndex(docID string, oldDoc, newDoc domain.Document) {
 	idx.mu.Lock()
 	defer idx.mu.Unlock()
 
-	// Remove old entry
-	if oldVal, ok := oldDoc[idx.Field]; ok {
-		// remove docID from the oldVal array
-		docList := idx.Inverted[oldVal]
+	// An insert only adds keys, so it skips the diff, as a bulk load into an
+	// indexed collection does this once per document
+	if oldDoc == nil {
+		if idx.addKeys(idx.Inverted, docID, newDoc) {
+			idx.multikey = true
+		}
+		return
+	}
+
+	// A partial index drops documents that stop matching its condition
+	oldKeys, _ := idx.docKeys(oldDoc)
+	newKeys, isArray := idx.docKeys(newDoc)
+	if isArray {
+		idx.multikey = true
+	}
+
+	kept := make(map[interface{}]bool, len(newKeys))
+	for _, key := range newKeys {
+		kept[key] = true
+	}
+	previous := make(map[interface{}]bool, len(oldKeys))
+	for _, key := range oldKeys {
+		previous[key] = true
+		if kept[key] {
+			continue
+		}
+		// Remove docID from the old value's list
+		docList := idx.Inverted[key]
 		for i, id := range docList {
 			if id == docID {
-				idx.Inverted[oldVal] = append(docList[:i], docList[i+1:]...)
+				idx.Inverted[key] = append(docList[:i], docList[i+1:]...)
 				break
 			}
 		}
 	}
-	// Add new entry
-	if newVal, ok := newDoc[idx.Field]; ok {
-		idx.Inverted[newVal] = append(idx.Inverted[newVal], docID)
+	for _, key := range newKeys {
+		if !previous[key] {
+			idx.Inverted[key] = append(idx.Inverted[key], docID)
+		}
 	}
 }
 
 // CreateIndex creates an index on a specific field in a collection
 func (ie *IndexEngine) CreateIndex(collectionName, fieldName string) error {
+	return ie.addIndex(collectionName, NewIndex(fieldName))
+}
+
+// CreateUniqueIndex creates an index on a field that no two documents may share a
+// value of. Documents lacking the field are not indexed, so any number may lack it.
+func (ie *IndexEngine) CreateUniqueIndex(collectionName, fieldName string) error {
+	index := NewIndex(fieldName)
+	index.Unique = true
+	return ie.addIndex(collectionName, index)
+}
+
+// CreateCollatedIndex creates an index on a field whose string keys are folded under
+// collation, so a lookup finds every document equal to the value under it and a
+// unique collated index rejects two values equal under it
+func (ie *IndexEngine) CreateCollatedIndex(collectionName, fieldName, collation string, unique bool) error {
+	if err := domain.ValidateCollation(collation); err != nil {
+		return err
+	}
+	index := NewIndex(fieldName)
+	index.Collation = collation
+	index.Unique = unique
+	return ie.addIndex(collectionName, index)
+}
+
+// CreateCompoundIndex creates an index on the combination of several fields, registered
+// under CompoundIndexName(fieldNames). A unique compound index rejects two documents
+// with the same values in all of the fields.
+func (ie *IndexEngine) CreateCompoundIndex(collectionName string, fieldNames []string, unique bool) error {
+	if len(fieldNames) < 2 {
+		return fmt.Errorf("a compound index needs at least two fields")
+	}
+	index := NewCompoundIndex(fieldNames)
+	index.Unique = unique
+	return ie.addIndex(collectionName, index)
+}
+
+// HasUniqueIndex reports whether a collection has a unique index
+func (ie *IndexEngine) HasUniqueIndex(collectionName string) bool {
+	ie.mu.RLock()
+	defer ie.mu.RUnlock()
+
+	for _, index := range ie.indexes[collectionName] {
+		if index.Unique {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckUnique returns an ErrDuplicateKey error if storing docs under ids would give two
+// documents the same key in one of a collection's unique indexes. A nil document stands
+// for a deletion, and an ID given more than once counts with its last document. The
+// caller must keep other writers out of the collection until the write is applied.
+func (ie *IndexEngine) CheckUnique(collectionName string, ids []string, docs []domain.Document) error {
+	ie.mu.RLock()
+	defer ie.mu.RUnlock()
+
+	for _, index := range ie.indexes[collectionName] {
+		if !index.Unique {
+			continue
+		}
+		if err := index.checkUnique(collectionName, ids, docs); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CreatePartialIndex creates an index on a field that only holds documents matching
+// condition, as decided by matches (see NewPartialIndex)
+func (ie *IndexEngine) CreatePartialIndex(collectionName, fieldName string, condition map[string]interface{}, matches func(domain.Document) bool) error {
+	return ie.addIndex(collectionName, NewPartialIndex(fieldName, condition, matches))
+}
+
+// addIndex registers a new, empty index on a collection
+func (ie *IndexEngine) addIndex(collectionName string, index *Index) error {
 	ie.mu.Lock()
 	defer ie.mu.Unlock()
 
@@ -92,13 +619,12 @@ func (ie *IndexEngine) CreateIndex(collectionName, fieldName string) error {
 	}
 
 	// Check if index already exists
-	if _, exists := ie.indexes[collectionName][fieldName]; exists {
-		return fmt.Errorf("index on field %s already exists in collection %s", fieldName, collectionName)
+	if _, exists := ie.indexes[collectionName][index.Field]; exists {
+		return fmt.Errorf("index on field %s already exists in collection %s", index.Field, collectionName)
 	}
 
-	// Create new index
-	index := NewIndex(fieldName)
-	ie.indexes[collectionName][fieldName] = index
+	index.exactKeys = ie.exactKeys
+	ie.indexes[collectionName][index.Field] = index
 
 	return nil
 }
@@ -114,7 +640,7 @@ func (ie *IndexEngine) DropIndex(collectionName, fieldName string) error {
 	}
 
 	if _, exists := ie.indexes[collectionName][fieldName]; !exists {
-		return fmt.Errorf("index on field %s does not exist in collection %s", fieldName, collectionName)
+		return domain.Errorf(domain.ErrIndexNotFound, "index on field %s does not exist in collection %s", fieldName, collectionName)
 	}
 
 	// Remove the index
@@ -123,6 +649,38 @@ func (ie *IndexEngine) DropIndex(collectionName, fieldName string) error {
 	return nil
 }
 
+// DropAllIndexes removes every index on a collection except the named fields
+// and returns the number of indexes dropped
+func (ie *IndexEngine) DropAllIndexes(collectionName string, keep ...string) int {
+	ie.mu.Lock()
+	defer ie.mu.Unlock()
+
+	dropped := 0
+	for fieldName := range ie.indexes[collectionName] {
+		kept := false
+		for _, k := range keep {
+			if fieldName == k {
+				kept = true
+				break
+			}
+		}
+		if !kept {
+			delete(ie.indexes[collectionName], fieldName)
+			dropped++
+		}
+	}
+
+	return dropped
+}
+
+// DropCollection removes every index of a collection, _id included, once the
+// collection itself has been removed
+func (ie *IndexEngine) DropCollection(collectionName string) {
+	ie.mu.Lock()
+	defer ie.mu.Unlock()
+	delete(ie.indexes, collectionName)
+}
+
 // FindByIndex finds documents using an index
 func (ie *IndexEngine) FindByIndex(collectionName, fieldName string, value interface{}) ([]domain.Document, error) {
 	ie.mu.RLock()
@@ -131,7 +689,7 @@ func (ie *IndexEngine) FindByIndex(collectionName, fieldName string, value inter
 	// Get the index
 	index, exists := ie.getIndex(collectionName, fieldName)
 	if !exists {
-		return nil, fmt.Errorf("index on field %s does not exist in collection %s", fieldName, collectionName)
+		return nil, domain.Errorf(domain.ErrIndexNotFound, "index on field %s does not exist in collection %s", fieldName, collectionName)
 	}
 
 	// Query the index
@@ -178,7 +736,7 @@ func (ie *IndexEngine) UpdateIndex(collectionName, fieldName string) error {
 
 	_, exists := ie.indexes[collectionName][fieldName]
 	if !exists {
-		return fmt.Errorf("index on field %s does not exist in collection %s", fieldName, collectionName)
+		return domain.Errorf(domain.ErrIndexNotFound, "index on field %s does not exist in collection %s", fieldName, collectionName)
 	}
 
 	// Note: This method would need access to the actual collection
@@ -202,6 +760,36 @@ func (ie *IndexEngine) GetIndex(collectionName, fieldName string) (*Index, bool)
 	return ie.getIndex(collectionName, fieldName)
 }
 
+// CompoundIndexes returns a collection's compound indexes, sorted by name
+func (ie *IndexEngine) CompoundIndexes(collectionName string) []*Index {
+	ie.mu.RLock()
+	defer ie.mu.RUnlock()
+
+	var compound []*Index
+	for _, index := range ie.indexes[collectionName] {
+		if index.Fields != nil {
+			compound = append(compound, index)
+		}
+	}
+	sort.Slice(compound, func(i, j int) bool { return compound[i].Field < compound[j].Field })
+	return compound
+}
+
+// DumpIndex returns a page of an index's raw key -> document IDs entries for
+// debugging (see Index.Dump)
+func (ie *IndexEngine) DumpIndex(collectionName, fieldName string, offset, limit, maxIDs int) (*domain.IndexDump, error) {
+	ie.mu.RLock()
+	defer ie.mu.RUnlock()
+
+	index, exists := ie.getIndex(collectionName, fieldName)
+	if !exists {
+		return nil, domain.Errorf(domain.ErrIndexNotFound, "index on field %s does not exist in collection %s", fieldName, collectionName)
+	}
+	dump := index.Dump(offset, limit, maxIDs)
+	dump.Collection = collectionName
+	return dump, nil
+}
+
 // BuildIndexForCollection builds an index for a specific collection
 func (ie *IndexEngine) BuildIndexForCollection(collectionName, fieldName string, collection *domain.Collection) error {
 	ie.mu.Lock()
@@ -215,6 +803,7 @@ func (ie *IndexEngine) BuildIndexForCollection(collectionName, fieldName string,
 	index, exists := ie.indexes[collectionName][fieldName]
 	if !exists {
 		index = NewIndex(fieldName)
+		index.exactKeys = ie.exactKeys
 		ie.indexes[collectionName][fieldName] = index
 	}
 
@@ -268,6 +857,79 @@ func (ie *IndexEngine) ExportIndexes() map[string]map[string][]string {
 	return exported
 }
 
+// IndexDefinition describes an index for persistence: its field (or name and fields,
+// for a compound index), whether it is unique, its collation and, for a partial
+// index, its condition.
+// Index contents are not persisted; they are rebuilt from the documents when the
+// collection is loaded.
+type IndexDefinition struct {
+	Field     string                 `msgpack:"field"`
+	Fields    []string               `msgpack:"fields,omitempty"`
+	Unique    bool                   `msgpack:"unique,omitempty"`
+	Collation string                 `msgpack:"collation,omitempty"`
+	Condition map[string]interface{} `msgpack:"condition,omitempty"`
+}
+
+// ExportIndexDefinitions returns the definitions of a collection's indexes, sorted by
+// field, or nil if it has none
+func (ie *IndexEngine) ExportIndexDefinitions(collectionName string) []IndexDefinition {
+	ie.mu.RLock()
+	defer ie.mu.RUnlock()
+
+	collectionIndexes := ie.indexes[collectionName]
+	if len(collectionIndexes) == 0 {
+		return nil
+	}
+	definitions := make([]IndexDefinition, 0, len(collectionIndexes))
+	for fieldName, index := range collectionIndexes {
+		definitions = append(definitions, IndexDefinition{Field: fieldName, Fields: index.Fields, Unique: index.Unique, Collation: index.Collation, Condition: index.Condition})
+	}
+	sort.Slice(definitions, func(i, j int) bool { return definitions[i].Field < definitions[j].Field })
+	return definitions
+}
+
+// ExportAllIndexDefinitions returns the index definitions of every collection
+func (ie *IndexEngine) ExportAllIndexDefinitions() map[string][]IndexDefinition {
+	ie.mu.RLock()
+	names := make([]string, 0, len(ie.indexes))
+	for collectionName := range ie.indexes {
+		names = append(names, collectionName)
+	}
+	ie.mu.RUnlock()
+
+	exported := make(map[string][]IndexDefinition, len(names))
+	for _, collectionName := range names {
+		if definitions := ie.ExportIndexDefinitions(collectionName); definitions != nil {
+			exported[collectionName] = definitions
+		}
+	}
+	return exported
+}
+
+// ImportIndexDefinitions replaces a collection's indexes with empty indexes for the
+// given definitions, to be filled by RebuildIndexForCollection when the collection
+// is loaded. matcher returns the membership test of a partial index's condition.
+func (ie *IndexEngine) ImportIndexDefinitions(collectionName string, definitions []IndexDefinition, matcher func(condition map[string]interface{}) func(domain.Document) bool) {
+	ie.mu.Lock()
+	defer ie.mu.Unlock()
+
+	collectionIndexes := make(map[string]*Index, len(definitions))
+	for _, definition := range definitions {
+		index := NewIndex(definition.Field)
+		switch {
+		case len(definition.Fields) > 0:
+			index = NewCompoundIndex(definition.Fields)
+		case definition.Condition != nil:
+			index = NewPartialIndex(definition.Field, definition.Condition, matcher(definition.Condition))
+		}
+		index.Unique = definition.Unique
+		index.Collation = definition.Collation
+		index.exactKeys = ie.exactKeys
+		collectionIndexes[definition.Field] = index
+	}
+	ie.indexes[collectionName] = collectionIndexes
+}
+
 // ImportIndexes imports indexes from a persistence format
 func (ie *IndexEngine) ImportIndexes(indexData map[string]map[string][]string) error {
 	ie.mu.Lock()
@@ -282,6 +944,7 @@ func (ie *IndexEngine) ImportIndexes(indexData map[string]map[string][]string) e
 		for fieldName, docIDs := range collectionIndexes {
 			// Create a new index for this field
 			index := NewIndex(fieldName)
+			index.exactKeys = ie.exactKeys
 
 			// For each document ID, we need to add it to the index
 			// Since we don't have the actual field values here, we'll create a placeholder
@@ -304,16 +967,78 @@ func (ie *IndexEngine) RebuildIndexForCollection(collectionName string, collecti
 	defer ie.mu.Unlock()
 
 	if collectionIndexes, exists := ie.indexes[collectionName]; exists {
-		for fieldName, index := range collectionIndexes {
+		for _, index := range collectionIndexes {
 			// Clear the placeholder data
 			index.Inverted = make(map[interface{}][]string)
+			index.multikey = false
 
 			// Rebuild the index with actual document data
-			for docID, doc := range collection.Documents {
-				if value, exists := doc[fieldName]; exists {
-					index.Inverted[value] = append(index.Inverted[value], docID)
+			collection.Range(func(docID string, doc domain.Document) bool {
+				if index.addKeys(index.Inverted, docID, doc) {
+					index.multikey = true
 				}
+				return true
+			})
+		}
+	}
+}
+
+// rebuildCheckInterval is the number of documents indexed between cancellation
+// checks and progress reports during RebuildIndexes
+const rebuildCheckInterval = 1000
+
+// RebuildIndexes rebuilds every index of a collection from its documents. The new
+// contents are built off to the side and swapped in only once all indexes are complete,
+// so a rebuild stopped by ctx leaves the existing indexes unchanged. progress, if not
+// nil, is called periodically with the number of documents processed and the total.
+// The caller must prevent writes to the collection during the rebuild.
+func (ie *IndexEngine) RebuildIndexes(ctx context.Context, collectionName string, collection *domain.Collection, progress func(processed, total int)) error {
+	ie.mu.RLock()
+	indexes := make([]*Index, 0, len(ie.indexes[collectionName]))
+	for _, index := range ie.indexes[collectionName] {
+		indexes = append(indexes, index)
+	}
+	ie.mu.RUnlock()
+
+	total := collection.Len()
+	report := func(processed int) {
+		if progress != nil {
+			progress(processed, total)
+		}
+	}
+
+	rebuilt := make([]map[interface{}][]string, len(indexes))
+	multikey := make([]bool, len(indexes))
+	for i := range rebuilt {
+		rebuilt[i] = make(map[interface{}][]string)
+	}
+
+	processed := 0
+	collection.Range(func(docID string, doc domain.Document) bool {
+		if processed%rebuildCheckInterval == 0 {
+			if ctx.Err() != nil {
+				return false
+			}
+			report(processed)
+		}
+		for i, index := range indexes {
+			if index.addKeys(rebuilt[i], docID, doc) {
+				multikey[i] = true
 			}
 		}
+		processed++
+		return true
+	})
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("index rebuild aborted: %w", err)
 	}
+
+	for i, index := range indexes {
+		index.mu.Lock()
+		index.Inverted = rebuilt[i]
+		index.multikey = multikey[i]
+		index.mu.Unlock()
+	}
+	report(processed)
+	return nil
 }
@@ -1,9 +1,13 @@
 package indexing_test
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"testing"
 
 	"github.com/adfharrison1/go-db/pkg/domain"
+	"github.com/adfharrison1/go-db/pkg/indexing"
 	"github.com/adfharrison1/go-db/pkg/storage"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -191,6 +195,52 @@ func TestAutomaticIdIndex(t *testing.T) {
 	assert.Error(t, err)
 }
 
+func TestDropAllIndexes(t *testing.T) {
+	engine := storage.NewStorageEngine()
+
+	err := engine.CreateCollection("test")
+	require.NoError(t, err)
+
+	_, err = engine.Insert("test", domain.Document{"name": "Alice", "age": 25, "city": "Boston"})
+	require.NoError(t, err)
+
+	for _, field := range []string{"name", "age", "city"} {
+		require.NoError(t, engine.CreateIndex("test", field))
+	}
+
+	indexes, err := engine.GetIndexes("test")
+	require.NoError(t, err)
+	assert.Len(t, indexes, 4)
+
+	// Drop everything except the primary index
+	dropped, err := engine.DropAllIndexes("test")
+	require.NoError(t, err)
+	assert.Equal(t, 3, dropped)
+
+	indexes, err = engine.GetIndexes("test")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"_id"}, indexes)
+
+	// Lookups by ID still work and filters fall back to scans
+	doc, err := engine.GetById("test", "1")
+	require.NoError(t, err)
+	assert.Equal(t, "Alice", doc["name"])
+
+	result, err := engine.FindAll("test", map[string]interface{}{"city": "Boston"}, nil)
+	require.NoError(t, err)
+	assert.Len(t, result.Documents, 1)
+
+	// Dropping again is a no-op
+	dropped, err = engine.DropAllIndexes("test")
+	assert.NoError(t, err)
+	assert.Zero(t, dropped)
+
+	// Non-existent collection
+	_, err = engine.DropAllIndexes("nonexistent")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "does not exist")
+}
+
 func TestIndexPerformance(t *testing.T) {
 	engine := storage.NewStorageEngine()
 
@@ -227,3 +277,323 @@ func TestIndexPerformance(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Len(t, results.Documents, 1000)
 }
+
+func TestIndexValueCounts(t *testing.T) {
+	idx := indexing.NewIndex("color")
+	idx.UpdateIndex("1", nil, domain.Document{"color": "red"})
+	idx.UpdateIndex("2", nil, domain.Document{"color": "red"})
+	idx.UpdateIndex("3", nil, domain.Document{"color": "blue"})
+
+	counts := idx.ValueCounts()
+	assert.Equal(t, map[interface{}]int64{"red": 2, "blue": 1}, counts)
+
+	// Values with no documents left are omitted
+	idx.UpdateIndex("3", domain.Document{"color": "blue"}, domain.Document{"color": "red"})
+	counts = idx.ValueCounts()
+	assert.Equal(t, map[interface{}]int64{"red": 3}, counts)
+}
+
+func TestNumericKeyNormalization(t *testing.T) {
+	collection := domain.NewCollection("users")
+	collection.Documents["1"] = domain.Document{"age": int8(30)}
+	collection.Documents["2"] = domain.Document{"age": 30.0}
+	collection.Documents["3"] = domain.Document{"age": "30"}
+
+	idx := indexing.NewIndex("age")
+	idx.BuildIndex(collection)
+	idx.UpdateIndex("4", nil, domain.Document{"age": int64(30)})
+
+	// Every numeric type hits the same entry; strings stay separate
+	for _, value := range []interface{}{30, 30.0, int8(30), uint16(30), float32(30)} {
+		assert.ElementsMatch(t, []string{"1", "2", "4"}, idx.Query(value), "query with %T", value)
+	}
+	assert.Equal(t, []string{"3"}, idx.Query("30"))
+
+	// Removing an entry finds it regardless of the type it was stored with
+	idx.UpdateIndex("1", domain.Document{"age": int8(30)}, domain.Document{"age": 31})
+	assert.ElementsMatch(t, []string{"2", "4"}, idx.Query(30))
+	assert.Equal(t, []string{"1"}, idx.Query(31.0))
+
+	// Normalization can be turned off to key numbers by their exact type
+	engine := indexing.NewIndexEngine(indexing.WithNumericKeyNormalization(false))
+	require.NoError(t, engine.CreateIndex("users", "age"))
+	require.NoError(t, engine.BuildIndexForCollection("users", "age", collection))
+	exact, exists := engine.GetIndex("users", "age")
+	require.True(t, exists)
+	assert.Equal(t, []string{"2"}, exact.Query(30.0))
+	assert.Empty(t, exact.Query(30))
+}
+
+func TestPartialIndexMembership(t *testing.T) {
+	matches := func(doc domain.Document) bool { return doc["status"] == "active" }
+	idx := indexing.NewPartialIndex("email", map[string]interface{}{"status": "active"}, matches)
+
+	idx.UpdateIndex("1", nil, domain.Document{"email": "a@x", "status": "active"})
+	idx.UpdateIndex("2", nil, domain.Document{"email": "b@x", "status": "archived"})
+	assert.Equal(t, []string{"1"}, idx.Query("a@x"))
+	assert.Empty(t, idx.Query("b@x"))
+
+	// Updates move documents in and out of the index
+	idx.UpdateIndex("1", domain.Document{"email": "a@x", "status": "active"}, domain.Document{"email": "a@x", "status": "archived"})
+	idx.UpdateIndex("2", domain.Document{"email": "b@x", "status": "archived"}, domain.Document{"email": "b@x", "status": "active"})
+	assert.Empty(t, idx.Query("a@x"))
+	assert.Equal(t, []string{"2"}, idx.Query("b@x"))
+
+	// Deletes remove the document
+	idx.UpdateIndex("2", domain.Document{"email": "b@x", "status": "active"}, nil)
+	assert.Empty(t, idx.ValueCounts())
+}
+
+func TestPartialIndexQueries(t *testing.T) {
+	engine := storage.NewStorageEngine(storage.WithNoSaves(true))
+	defer engine.StopBackgroundWorkers()
+
+	statuses := []string{"active", "archived", "archived", "active", "pending"}
+	for i, status := range statuses {
+		_, err := engine.Insert("users", domain.Document{"team": i % 2, "status": status})
+		require.NoError(t, err)
+	}
+
+	condition := map[string]interface{}{"status": map[string]interface{}{"$in": []interface{}{"active", "pending"}}}
+	require.NoError(t, engine.CreatePartialIndex("users", "team", condition))
+
+	index, exists := engine.GetIndexEngine().(*indexing.IndexEngine).GetIndex("users", "team")
+	require.True(t, exists)
+	assert.Equal(t, map[interface{}]int64{0.0: 2, 1.0: 1}, index.ValueCounts(), "numeric keys are normalized to float64")
+
+	// A filter implying the condition uses the index; others still see archived documents
+	ids, err := engine.FindIds("users", map[string]interface{}{"team": 0, "status": "active"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"1"}, ids)
+
+	ids, err = engine.FindIds("users", map[string]interface{}{"team": 0})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"1", "3", "5"}, ids)
+
+	result, err := engine.FindAll("users", map[string]interface{}{"team": 1}, nil)
+	require.NoError(t, err)
+	assert.Len(t, result.Documents, 2)
+
+	facets, err := engine.Facets("users", nil, []string{"team"})
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), facets["team"][0.0])
+
+	// An update that stops matching the condition leaves the index
+	_, err = engine.UpdateById("users", "1", domain.Document{"status": "archived"})
+	require.NoError(t, err)
+	ids, err = engine.FindIds("users", map[string]interface{}{"team": 0, "status": "active"})
+	require.NoError(t, err)
+	assert.Empty(t, ids)
+
+	err = engine.CreatePartialIndex("users", "status", nil)
+	assert.ErrorIs(t, err, domain.ErrInvalidFilter)
+}
+
+func TestRebuildIndexes(t *testing.T) {
+	collection := domain.NewCollection("users")
+	for i := 0; i < 2500; i++ {
+		docID := fmt.Sprintf("%d", i)
+		collection.Documents[docID] = domain.Document{"_id": docID, "team": fmt.Sprintf("team%d", i%5)}
+	}
+
+	// The index starts out stale, as if documents had been loaded without it
+	engine := indexing.NewIndexEngine()
+	require.NoError(t, engine.CreateIndex("users", "team"))
+	index, _ := engine.GetIndex("users", "team")
+
+	// A cancelled rebuild leaves the existing index untouched
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := engine.RebuildIndexes(ctx, "users", collection, nil)
+	assert.True(t, errors.Is(err, context.Canceled))
+	assert.Empty(t, index.Query("team0"))
+
+	var reports [][2]int
+	err = engine.RebuildIndexes(context.Background(), "users", collection, func(processed, total int) {
+		reports = append(reports, [2]int{processed, total})
+	})
+	require.NoError(t, err)
+	assert.Len(t, index.Query("team0"), 500)
+	assert.Equal(t, [][2]int{{0, 2500}, {1000, 2500}, {2000, 2500}, {2500, 2500}}, reports)
+}
+
+func TestMultikeyIndex(t *testing.T) {
+	collection := domain.NewCollection("posts")
+	collection.Documents["1"] = domain.Document{"tags": []interface{}{"go", "db", "go"}}
+	collection.Documents["2"] = domain.Document{"tags": []interface{}{"db", map[string]interface{}{"nested": true}}}
+	collection.Documents["3"] = domain.Document{"tags": "go"}
+
+	idx := indexing.NewIndex("tags")
+	idx.BuildIndex(collection)
+	assert.True(t, idx.Multikey())
+
+	// Each distinct element is indexed once; unhashable elements are skipped
+	assert.ElementsMatch(t, []string{"1", "3"}, idx.Query("go"))
+	assert.ElementsMatch(t, []string{"1", "2"}, idx.Query("db"))
+	assert.Equal(t, map[interface{}]int64{"go": 2, "db": 2}, idx.ValueCounts())
+
+	// Updates only touch the elements that were added or removed
+	idx.UpdateIndex("1", collection.Documents["1"], domain.Document{"tags": []interface{}{"go", "rust"}})
+	assert.ElementsMatch(t, []string{"1", "3"}, idx.Query("go"))
+	assert.Equal(t, []string{"2"}, idx.Query("db"))
+	assert.Equal(t, []string{"1"}, idx.Query("rust"))
+
+	// Deletes remove every element
+	idx.UpdateIndex("1", domain.Document{"tags": []interface{}{"go", "rust"}}, nil)
+	assert.Equal(t, []string{"3"}, idx.Query("go"))
+	assert.Empty(t, idx.Query("rust"))
+
+	// Scalar-only indexes are not multikey
+	scalar := indexing.NewIndex("name")
+	scalar.UpdateIndex("1", nil, domain.Document{"name": "Alice"})
+	assert.False(t, scalar.Multikey())
+}
+
+func TestIndexDump(t *testing.T) {
+	engine := indexing.NewIndexEngine()
+	require.NoError(t, engine.CreateIndex("users", "age"))
+	index, exists := engine.GetIndex("users", "age")
+	require.True(t, exists)
+
+	index.UpdateIndex("1", nil, domain.Document{"age": 30})
+	index.UpdateIndex("2", nil, domain.Document{"age": 9})
+	index.UpdateIndex("3", nil, domain.Document{"age": "30"})
+	index.UpdateIndex("4", nil, domain.Document{"age": 30.0})
+	index.UpdateIndex("5", nil, domain.Document{"age": true})
+	index.UpdateIndex("6", nil, domain.Document{"age": 12})
+	index.UpdateIndex("6", domain.Document{"age": 12}, nil)
+
+	dump, err := engine.DumpIndex("users", "age", 0, 10, 100)
+	require.NoError(t, err)
+	assert.Equal(t, "users", dump.Collection)
+	assert.Equal(t, 4, dump.TotalKeys, "keys left without documents are skipped")
+	assert.Equal(t, 5, dump.TotalIDs)
+	assert.False(t, dump.Truncated)
+
+	// Booleans, then numbers by value, then strings
+	var keys []interface{}
+	for _, entry := range dump.Entries {
+		keys = append(keys, entry.Key)
+	}
+	assert.Equal(t, []interface{}{true, 9.0, 30.0, "30"}, keys)
+	assert.Equal(t, "float64", dump.Entries[2].Type)
+	assert.ElementsMatch(t, []string{"1", "4"}, dump.Entries[2].IDs)
+
+	// Pages and the ID cap truncate the dump
+	dump, err = engine.DumpIndex("users", "age", 1, 2, 100)
+	require.NoError(t, err)
+	require.Len(t, dump.Entries, 2)
+	assert.Equal(t, 9.0, dump.Entries[0].Key)
+	assert.Equal(t, 3, dump.NextOffset)
+	assert.True(t, dump.Truncated)
+
+	dump, err = engine.DumpIndex("users", "age", 2, 10, 1)
+	require.NoError(t, err)
+	assert.True(t, dump.Truncated)
+	assert.Equal(t, 2, dump.Entries[0].Count)
+	assert.Len(t, dump.Entries[0].IDs, 1)
+	assert.Empty(t, dump.Entries[1].IDs)
+
+	_, err = engine.DumpIndex("users", "missing", 0, 10, 100)
+	assert.True(t, errors.Is(err, domain.ErrIndexNotFound))
+}
+
+func TestCompoundIndex(t *testing.T) {
+	idx := indexing.NewCompoundIndex([]string{"city", "age"})
+	assert.Equal(t, "city,age", idx.Field)
+	idx.UpdateIndex("1", nil, domain.Document{"city": "Boston", "age": 30})
+	idx.UpdateIndex("2", nil, domain.Document{"city": "Boston", "age": 25})
+	idx.UpdateIndex("3", nil, domain.Document{"city": "Boston"})
+	idx.UpdateIndex("4", nil, domain.Document{"city": []interface{}{"Boston", "Denver"}, "age": 30.0})
+
+	// Queries give a value per field, in order; documents lacking a field are not indexed
+	assert.ElementsMatch(t, []string{"1", "4"}, idx.Query([]interface{}{"Boston", 30}))
+	assert.Equal(t, []string{"4"}, idx.Query([]interface{}{"Denver", 30}))
+	assert.Empty(t, idx.Query([]interface{}{30, "Boston"}))
+	assert.Empty(t, idx.Query("Boston"))
+	assert.True(t, idx.Multikey())
+
+	idx.UpdateIndex("1", domain.Document{"city": "Boston", "age": 30}, domain.Document{"city": "Boston", "age": 31})
+	assert.Equal(t, []string{"4"}, idx.Query([]interface{}{"Boston", 30}))
+	assert.Equal(t, []string{"1"}, idx.Query([]interface{}{"Boston", 31}))
+}
+
+func TestCheckUnique(t *testing.T) {
+	engine := indexing.NewIndexEngine()
+	require.NoError(t, engine.CreateUniqueIndex("users", "email"))
+	require.NoError(t, engine.CreateCompoundIndex("users", []string{"first", "last"}, true))
+	assert.True(t, engine.HasUniqueIndex("users"))
+	engine.UpdateIndexForDocument("users", "1", nil, domain.Document{"email": "a@x", "first": "Ann", "last": "Lee"})
+	engine.UpdateIndexForDocument("users", "2", nil, domain.Document{"email": "b@x"})
+
+	for name, tc := range map[string]struct {
+		ids  []string
+		docs []domain.Document
+		ok   bool
+	}{
+		"new key":             {[]string{"3"}, []domain.Document{{"email": "c@x"}}, true},
+		"taken key":           {[]string{"3"}, []domain.Document{{"email": "a@x"}}, false},
+		"same document":       {[]string{"1"}, []domain.Document{{"email": "a@x"}}, true},
+		"missing field":       {[]string{"3", "4"}, []domain.Document{{"name": "x"}, {"name": "y"}}, true},
+		"numeric types":       {[]string{"3", "4"}, []domain.Document{{"email": 1}, {"email": 1.0}}, false},
+		"within the write":    {[]string{"3", "4"}, []domain.Document{{"email": "c@x"}, {"email": "c@x"}}, false},
+		"swapped keys":        {[]string{"1", "2"}, []domain.Document{{"email": "b@x"}, {"email": "a@x"}}, true},
+		"freed by a delete":   {[]string{"1", "3"}, []domain.Document{nil, {"email": "a@x"}}, true},
+		"last document wins":  {[]string{"3", "3"}, []domain.Document{{"email": "a@x"}, {"email": "c@x"}}, true},
+		"compound taken":      {[]string{"3"}, []domain.Document{{"first": "Ann", "last": "Lee"}}, false},
+		"compound other pair": {[]string{"3"}, []domain.Document{{"first": "Ann", "last": "Ray"}}, true},
+	} {
+		t.Run(name, func(t *testing.T) {
+			err := engine.CheckUnique("users", tc.ids, tc.docs)
+			if tc.ok {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorIs(t, err, domain.ErrDuplicateKey)
+			}
+		})
+	}
+
+	assert.False(t, engine.HasUniqueIndex("other"))
+	assert.NoError(t, engine.CheckUnique("other", []string{"1"}, []domain.Document{{"email": "a@x"}}))
+}
+
+func TestIndexDefinitionsRoundTrip(t *testing.T) {
+	engine := indexing.NewIndexEngine()
+	require.NoError(t, engine.CreateUniqueIndex("users", "email"))
+	require.NoError(t, engine.CreateCompoundIndex("users", []string{"city", "age"}, false))
+	definitions := engine.ExportIndexDefinitions("users")
+	assert.Equal(t, []indexing.IndexDefinition{
+		{Field: "city,age", Fields: []string{"city", "age"}},
+		{Field: "email", Unique: true},
+	}, definitions)
+
+	imported := indexing.NewIndexEngine()
+	imported.ImportIndexDefinitions("users", definitions, nil)
+	assert.Equal(t, definitions, imported.ExportIndexDefinitions("users"))
+	compound, exists := imported.GetIndex("users", "city,age")
+	require.True(t, exists)
+	compound.UpdateIndex("1", nil, domain.Document{"city": "Boston", "age": 30})
+	assert.Equal(t, []string{"1"}, compound.Query([]interface{}{"Boston", 30}))
+}
+
+func TestCollatedIndex(t *testing.T) {
+	engine := indexing.NewIndexEngine()
+	require.NoError(t, engine.CreateCollatedIndex("users", "name", domain.CollationCaseAccentInsensitive, false))
+	require.NoError(t, engine.CreateCollatedIndex("users", "email", domain.CollationCaseInsensitive, true))
+	assert.Error(t, engine.CreateCollatedIndex("users", "city", "fr", false))
+	engine.UpdateIndexForDocument("users", "1", nil, domain.Document{"name": "José", "email": "A@x", "age": 30})
+	engine.UpdateIndexForDocument("users", "2", nil, domain.Document{"name": "jose", "email": "b@x"})
+
+	// String keys are folded under the collation; other keys are stored as before
+	name, exists := engine.GetIndex("users", "name")
+	require.True(t, exists)
+	assert.ElementsMatch(t, []string{"1", "2"}, name.Query("JOSE"))
+	assert.Equal(t, "jose", name.Dump(0, 10, 10).Entries[0].Key)
+	assert.ErrorIs(t, engine.CheckUnique("users", []string{"3"}, []domain.Document{{"email": "a@X"}}), domain.ErrDuplicateKey)
+
+	definitions := engine.ExportIndexDefinitions("users")
+	assert.Contains(t, definitions, indexing.IndexDefinition{Field: "name", Collation: domain.CollationCaseAccentInsensitive})
+	imported := indexing.NewIndexEngine()
+	imported.ImportIndexDefinitions("users", definitions, nil)
+	assert.Equal(t, definitions, imported.ExportIndexDefinitions("users"))
+}
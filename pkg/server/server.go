@@ -22,7 +22,7 @@ func NewServer(storageOptions ...storage.StorageOption) *Server {
 		router:      mux.NewRouter(),
 		dbEngine:    dbEngine,
 		indexEngine: dbEngine.GetIndexEngine(), // Use the storage engine's index engine
-		api:         api.NewHandler(dbEngine, dbEngine.GetIndexEngine()),
+		api:         api.NewHandler(dbEngine, dbEngine.GetIndexEngine(), api.WithEngine("v1")),
 	}
 
 	// Register API routes
@@ -51,7 +51,7 @@ func NewServerV2(storageOptions ...v2.StorageOption) *Server {
 		router:      mux.NewRouter(),
 		dbEngine:    dbEngine,
 		indexEngine: dbEngine.GetIndexEngine(), // Use the storage engine's index engine
-		api:         api.NewHandler(dbEngine, dbEngine.GetIndexEngine()),
+		api:         api.NewHandler(dbEngine, dbEngine.GetIndexEngine(), api.WithEngine("v2")),
 	}
 
 	// Register API routes
@@ -86,13 +86,19 @@ func (s *Server) StopBackgroundWorkers() {
 	s.dbEngine.StopBackgroundWorkers()
 }
 
-// requestLoggerMiddleware logs the method, URL path, and duration for each request.
+// ApplyHandlerOptions configures the API handler (e.g. api.WithQueryTimeout)
+func (s *Server) ApplyHandlerOptions(opts ...api.HandlerOption) {
+	s.api.ApplyOptions(opts...)
+}
+
+// requestLoggerMiddleware logs the method, URL path, duration and request ID for each request.
+// It runs inside the API's request ID middleware, which registers first.
 func requestLoggerMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
 		next.ServeHTTP(w, r)
 		elapsed := time.Since(start)
-		log.Printf("INFO: Request %s %s took %s", r.Method, r.URL.Path, elapsed)
+		log.Printf("INFO: Request %s %s took %s request_id=%s", r.Method, r.URL.Path, elapsed, domain.RequestID(r.Context()))
 	})
 }
 
@@ -105,6 +111,14 @@ func (s *Server) InitDB(filename string) {
 	}
 }
 
+// PreloadCollections loads the collections configured for preloading, logging any
+// that fail. /ready reports 503 until it returns.
+func (s *Server) PreloadCollections() {
+	if err := s.dbEngine.PreloadCollections(); err != nil {
+		log.Printf("WARN: %v", err)
+	}
+}
+
 // SaveDB saves the current database state to file
 func (s *Server) SaveDB(filename string) {
 	if err := s.dbEngine.SaveToFile(filename); err != nil {
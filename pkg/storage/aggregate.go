@@ -0,0 +1,246 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/adfharrison1/go-db/pkg/domain"
+)
+
+// DefaultMaxAggregateGroups bounds the groups held by an aggregation that does not set MaxGroups
+const DefaultMaxAggregateGroups = 10000
+
+// MaxAggregateMetrics bounds the number of metrics computed per group
+const MaxAggregateMetrics = 32
+
+// Supported aggregation operators
+const (
+	AggregateSum = "sum"
+	AggregateAvg = "avg"
+	AggregateMin = "min"
+	AggregateMax = "max"
+)
+
+// AggregateMetric computes one value per group from a numeric field
+type AggregateMetric struct {
+	Op    string `json:"op"`
+	Field string `json:"field"`
+}
+
+// AggregateSpec describes an aggregation: documents are grouped by the value of
+// GroupBy (all documents form one group when it is empty), counted, and each
+// named metric is computed per group
+type AggregateSpec struct {
+	GroupBy   string                     `json:"group_by,omitempty"`
+	Metrics   map[string]AggregateMetric `json:"metrics,omitempty"`
+	MaxGroups int                        `json:"max_groups,omitempty"`
+}
+
+// AggregateGroup is the result for one group. A metric is nil when none of
+// the group's documents had a numeric value for its field.
+type AggregateGroup struct {
+	Key     interface{}            `json:"key"`
+	Count   int64                  `json:"count"`
+	Metrics map[string]interface{} `json:"metrics,omitempty"`
+}
+
+// AggregateResult holds the groups ordered by descending count. When the
+// number of groups reached the cap, Truncated is set and OtherCount is the
+// number of documents that belonged to groups that were not kept.
+type AggregateResult struct {
+	Groups     []AggregateGroup `json:"groups"`
+	Truncated  bool             `json:"truncated"`
+	OtherCount int64            `json:"other_count"`
+}
+
+// ValidateAggregateSpec checks an aggregation before any documents are read
+func ValidateAggregateSpec(spec AggregateSpec) error {
+	if spec.MaxGroups < 0 {
+		return fmt.Errorf("max_groups must not be negative, got %d", spec.MaxGroups)
+	}
+	if len(spec.Metrics) > MaxAggregateMetrics {
+		return fmt.Errorf("aggregations limited to %d metrics, got %d", MaxAggregateMetrics, len(spec.Metrics))
+	}
+	for name, metric := range spec.Metrics {
+		if name == "" {
+			return fmt.Errorf("metric name cannot be empty")
+		}
+		switch metric.Op {
+		case AggregateSum, AggregateAvg, AggregateMin, AggregateMax:
+		default:
+			return fmt.Errorf("metric %q: unknown op %q (use %s, %s, %s or %s)", name, metric.Op, AggregateSum, AggregateAvg, AggregateMin, AggregateMax)
+		}
+		if metric.Field == "" {
+			return fmt.Errorf("metric %q: field cannot be empty", name)
+		}
+	}
+	return nil
+}
+
+// Aggregator folds documents into per-group running totals one at a time, so
+// memory grows with the number of groups rather than the number of documents.
+// It is not safe for concurrent use.
+type Aggregator struct {
+	groupBy     []string
+	names       []string
+	metrics     []AggregateMetric
+	metricPaths [][]string
+	maxGroups   int
+	groups      map[interface{}]*aggregateState
+	truncated   bool
+	otherCount  int64
+}
+
+// aggregateState is the running state of one group
+type aggregateState struct {
+	count   int64
+	metrics []metricState
+}
+
+// metricState holds enough to produce any supported metric without keeping values
+type metricState struct {
+	n        int64
+	sum      float64
+	min, max float64
+}
+
+// NewAggregator validates spec and returns an empty aggregator
+func NewAggregator(spec AggregateSpec) (*Aggregator, error) {
+	if err := ValidateAggregateSpec(spec); err != nil {
+		return nil, err
+	}
+
+	a := &Aggregator{
+		maxGroups: spec.MaxGroups,
+		groups:    make(map[interface{}]*aggregateState),
+	}
+	if a.maxGroups == 0 {
+		a.maxGroups = DefaultMaxAggregateGroups
+	}
+	if spec.GroupBy != "" {
+		a.groupBy = strings.Split(spec.GroupBy, ".")
+	}
+
+	// Metrics are kept in name order so results are deterministic
+	for name := range spec.Metrics {
+		a.names = append(a.names, name)
+	}
+	sort.Strings(a.names)
+	for _, name := range a.names {
+		metric := spec.Metrics[name]
+		a.metrics = append(a.metrics, metric)
+		a.metricPaths = append(a.metricPaths, strings.Split(metric.Field, "."))
+	}
+	return a, nil
+}
+
+// Add folds a document into its group. Documents missing the group_by field
+// are grouped under a nil key; documents whose group_by value is an object or
+// array are not counted. Once the number of groups reaches the cap, documents
+// for new groups only add to OtherCount.
+func (a *Aggregator) Add(doc domain.Document) {
+	var key interface{}
+	if a.groupBy != nil {
+		if value, exists := lookupFieldPath(doc, a.groupBy); exists {
+			var ok bool
+			if key, ok = FacetKey(value); !ok {
+				return
+			}
+		}
+	}
+
+	state, exists := a.groups[key]
+	if !exists {
+		if len(a.groups) >= a.maxGroups {
+			a.truncated = true
+			a.otherCount++
+			return
+		}
+		state = &aggregateState{metrics: make([]metricState, len(a.metrics))}
+		a.groups[key] = state
+	}
+
+	state.count++
+	for i, path := range a.metricPaths {
+		value, exists := lookupFieldPath(doc, path)
+		if !exists {
+			continue
+		}
+		num, ok := ToFloat64(value)
+		if !ok {
+			continue
+		}
+		m := &state.metrics[i]
+		if m.n == 0 || num < m.min {
+			m.min = num
+		}
+		if m.n == 0 || num > m.max {
+			m.max = num
+		}
+		m.n++
+		m.sum += num
+	}
+}
+
+// Result returns the groups ordered by descending count, then by key
+func (a *Aggregator) Result() *AggregateResult {
+	result := &AggregateResult{
+		Groups:     make([]AggregateGroup, 0, len(a.groups)),
+		Truncated:  a.truncated,
+		OtherCount: a.otherCount,
+	}
+	for key, state := range a.groups {
+		group := AggregateGroup{Key: key, Count: state.count}
+		if len(a.metrics) > 0 {
+			group.Metrics = make(map[string]interface{}, len(a.metrics))
+			for i, metric := range a.metrics {
+				group.Metrics[a.names[i]] = state.metrics[i].value(metric.Op)
+			}
+		}
+		result.Groups = append(result.Groups, group)
+	}
+	sort.Slice(result.Groups, func(i, j int) bool {
+		if result.Groups[i].Count != result.Groups[j].Count {
+			return result.Groups[i].Count > result.Groups[j].Count
+		}
+		return fmt.Sprint(result.Groups[i].Key) < fmt.Sprint(result.Groups[j].Key)
+	})
+	return result
+}
+
+// value returns the metric for op, or nil if no numeric values were seen
+func (m metricState) value(op string) interface{} {
+	if m.n == 0 {
+		return nil
+	}
+	switch op {
+	case AggregateSum:
+		return m.sum
+	case AggregateAvg:
+		return m.sum / float64(m.n)
+	case AggregateMin:
+		return m.min
+	default:
+		return m.max
+	}
+}
+
+// AggregateStream drains docs into an aggregation. It is meant to consume
+// FindAllStreamContext, so documents are never all materialized at once.
+// The ctx error is returned if ctx is done before the stream is exhausted.
+func AggregateStream(ctx context.Context, docs <-chan domain.Document, spec AggregateSpec) (*AggregateResult, error) {
+	aggregator, err := NewAggregator(spec)
+	if err != nil {
+		return nil, err
+	}
+	for doc := range docs {
+		aggregator.Add(doc)
+	}
+	// Streams close early when ctx is done, so the totals would be partial
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return aggregator.Result(), nil
+}
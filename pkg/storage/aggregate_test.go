@@ -0,0 +1,103 @@
+package storage
+
+import (
+	"context"
+	"testing"
+
+	"github.com/adfharrison1/go-db/pkg/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateAggregateSpec(t *testing.T) {
+	assert.NoError(t, ValidateAggregateSpec(AggregateSpec{}))
+	assert.NoError(t, ValidateAggregateSpec(AggregateSpec{
+		GroupBy: "brand",
+		Metrics: map[string]AggregateMetric{"total": {Op: AggregateSum, Field: "price"}},
+	}))
+	assert.Error(t, ValidateAggregateSpec(AggregateSpec{MaxGroups: -1}))
+	assert.Error(t, ValidateAggregateSpec(AggregateSpec{Metrics: map[string]AggregateMetric{"x": {Op: "median", Field: "price"}}}))
+	assert.Error(t, ValidateAggregateSpec(AggregateSpec{Metrics: map[string]AggregateMetric{"x": {Op: AggregateSum}}}))
+	assert.Error(t, ValidateAggregateSpec(AggregateSpec{Metrics: map[string]AggregateMetric{"": {Op: AggregateSum, Field: "price"}}}))
+}
+
+func TestAggregateStream(t *testing.T) {
+	engine := NewStorageEngine(WithNoSaves(true))
+	defer engine.StopBackgroundWorkers()
+	insertFacetProducts(t, engine)
+
+	spec := AggregateSpec{
+		GroupBy: "brand",
+		Metrics: map[string]AggregateMetric{
+			"total":    {Op: AggregateSum, Field: "price"},
+			"average":  {Op: AggregateAvg, Field: "price"},
+			"cheapest": {Op: AggregateMin, Field: "price"},
+			"dearest":  {Op: AggregateMax, Field: "price"},
+			"weight":   {Op: AggregateSum, Field: "weight"},
+		},
+	}
+	docs, err := engine.FindAllStream("products", nil)
+	require.NoError(t, err)
+	result, err := AggregateStream(context.Background(), docs, spec)
+	require.NoError(t, err)
+
+	assert.False(t, result.Truncated)
+	require.Len(t, result.Groups, 3)
+	assert.Equal(t, AggregateGroup{
+		Key:   "acme",
+		Count: 2,
+		Metrics: map[string]interface{}{
+			"total": float64(30), "average": float64(15), "cheapest": float64(10), "dearest": float64(20), "weight": nil,
+		},
+	}, result.Groups[0])
+	assert.Equal(t, "globex", result.Groups[1].Key)
+	assert.Equal(t, "initech", result.Groups[2].Key)
+
+	// A filter narrows the stream; grouping by nothing yields one group
+	docs, err = engine.FindAllStream("products", map[string]interface{}{"color": "red"})
+	require.NoError(t, err)
+	result, err = AggregateStream(context.Background(), docs, AggregateSpec{
+		Metrics: map[string]AggregateMetric{"total": {Op: AggregateSum, Field: "price"}},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []AggregateGroup{{Key: nil, Count: 2, Metrics: map[string]interface{}{"total": float64(20)}}}, result.Groups)
+}
+
+func TestAggregator_MaxGroups(t *testing.T) {
+	aggregator, err := NewAggregator(AggregateSpec{GroupBy: "user", MaxGroups: 2})
+	require.NoError(t, err)
+
+	for _, user := range []string{"a", "b", "a", "c", "d", "b", "a"} {
+		aggregator.Add(domain.Document{"user": user})
+	}
+	// Objects cannot be group keys and are skipped; missing fields group under nil
+	aggregator.Add(domain.Document{"user": map[string]interface{}{"id": 1}})
+
+	result := aggregator.Result()
+	assert.True(t, result.Truncated)
+	assert.Equal(t, int64(2), result.OtherCount)
+	assert.Equal(t, []AggregateGroup{{Key: "a", Count: 3}, {Key: "b", Count: 2}}, result.Groups)
+
+	aggregator, err = NewAggregator(AggregateSpec{GroupBy: "n"})
+	require.NoError(t, err)
+	aggregator.Add(domain.Document{"n": 1})
+	aggregator.Add(domain.Document{"n": 1.0})
+	aggregator.Add(domain.Document{})
+	result = aggregator.Result()
+	assert.False(t, result.Truncated)
+	assert.ElementsMatch(t, []AggregateGroup{{Key: float64(1), Count: 2}, {Key: nil, Count: 1}}, result.Groups)
+}
+
+func TestAggregateStream_Cancelled(t *testing.T) {
+	engine := NewStorageEngine(WithNoSaves(true))
+	defer engine.StopBackgroundWorkers()
+	insertFacetProducts(t, engine)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	docs, err := engine.FindAllStreamContext(ctx, "products", nil)
+	require.NoError(t, err)
+	cancel()
+
+	_, err = AggregateStream(ctx, docs, AggregateSpec{GroupBy: "brand"})
+	assert.ErrorIs(t, err, context.Canceled)
+}
@@ -0,0 +1,125 @@
+package storage
+
+import (
+	"fmt"
+
+	"github.com/adfharrison1/go-db/pkg/domain"
+	"github.com/adfharrison1/go-db/pkg/indexing"
+)
+
+// ContainsFilterKey is the operator matching an array field that holds a value, e.g.
+// {"tags": {"$contains": "go"}}. Plain conditions on an array field also match when
+// any element satisfies them, so {"tags": "go"} finds the same documents plus those
+// whose tags field is the single value "go".
+const ContainsFilterKey = "$contains"
+
+// ElemMatchFilterKey is the operator matching an array of objects that has an element
+// satisfying every condition of a sub-filter, e.g.
+// {"items": {"$elemMatch": {"qty": {"$gt": 3}, "sku": "B"}}}. The sub-filter takes the
+// same conditions as a filter, applied to the element's fields. Elements that are not
+// objects never match. Documents are always scanned; indexes are not used.
+const ElemMatchFilterKey = "$elemMatch"
+
+// ContainsFilterValue returns the value of a {"$contains": value} filter value.
+// The second result is false when the filter value is not a $contains operator.
+func ContainsFilterValue(expected interface{}) (interface{}, bool) {
+	operator, ok := expected.(map[string]interface{})
+	if !ok || len(operator) != 1 {
+		return nil, false
+	}
+	value, ok := operator[ContainsFilterKey]
+	return value, ok
+}
+
+// ElemMatchFilter returns the sub-filter of an {"$elemMatch": {...}} filter value.
+// The second result is false when the filter value is not an $elemMatch operator.
+func ElemMatchFilter(expected interface{}) (map[string]interface{}, bool) {
+	operator, ok := expected.(map[string]interface{})
+	if !ok || len(operator) != 1 {
+		return nil, false
+	}
+	filter, ok := operator[ElemMatchFilterKey].(map[string]interface{})
+	return filter, ok
+}
+
+// validateContainsFilter checks that a $contains operator stands alone and holds a
+// single value rather than an array or object
+func validateContainsFilter(field string, expected interface{}) error {
+	operator, ok := expected.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	value, exists := operator[ContainsFilterKey]
+	if !exists {
+		return nil
+	}
+	if len(operator) != 1 || !isComparable(value) {
+		return fmt.Errorf("%w: %s on field %s must be the only operator and hold a single value", domain.ErrInvalidFilter, ContainsFilterKey, field)
+	}
+	return nil
+}
+
+// validateElemMatchFilter checks that an $elemMatch operator stands alone and holds a
+// valid, non-empty sub-filter
+func validateElemMatchFilter(field string, expected interface{}) error {
+	operator, ok := expected.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	if _, exists := operator[ElemMatchFilterKey]; !exists {
+		return nil
+	}
+	filter, ok := ElemMatchFilter(expected)
+	if !ok || len(filter) == 0 {
+		return fmt.Errorf("%w: %s on field %s must be the only operator and hold a non-empty object of conditions", domain.ErrInvalidFilter, ElemMatchFilterKey, field)
+	}
+	if err := ValidateFilter(filter); err != nil {
+		return fmt.Errorf("%s on field %s: %w", ElemMatchFilterKey, field, err)
+	}
+	return nil
+}
+
+// matchesContains reports whether actual is an array with an element matching value
+func matchesContains(actual, value interface{}) bool {
+	elements, isArray := indexing.ArrayElements(actual)
+	return isArray && matchesAnyElement(elements, func(element interface{}) bool {
+		return ValuesMatch(element, value)
+	})
+}
+
+// matchesElemMatch reports whether actual is an array with an object element
+// matching every condition of filter
+func matchesElemMatch(actual interface{}, filter map[string]interface{}) bool {
+	elements, isArray := indexing.ArrayElements(actual)
+	return isArray && matchesAnyElement(elements, func(element interface{}) bool {
+		switch fields := element.(type) {
+		case map[string]interface{}:
+			return MatchesFilter(fields, filter)
+		case domain.Document:
+			return MatchesFilter(fields, filter)
+		}
+		return false
+	})
+}
+
+// matchesFieldValue reports whether a field value satisfies a filter condition,
+// either as a whole or, for an array, through any of its elements
+func matchesFieldValue(actual, expected interface{}) bool {
+	if matchesCondition(actual, expected) {
+		return true
+	}
+	elements, isArray := indexing.ArrayElements(actual)
+	return isArray && matchesAnyElement(elements, func(element interface{}) bool {
+		return matchesCondition(element, expected)
+	})
+}
+
+// matchesAnyElement reports whether match accepts any of the elements
+func matchesAnyElement(elements []interface{}, match func(element interface{}) bool) bool {
+	for _, element := range elements {
+		if match(element) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,137 @@
+package storage
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/adfharrison1/go-db/pkg/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestArrayFilter_MatchesFilter(t *testing.T) {
+	doc := domain.Document{"tags": []interface{}{"go", "db"}, "scores": []interface{}{70, 95}}
+	assert.True(t, MatchesFilter(doc, map[string]interface{}{"tags": "go"}))
+	assert.True(t, MatchesFilter(doc, map[string]interface{}{"tags": map[string]interface{}{"$contains": "db"}}))
+	assert.True(t, MatchesFilter(doc, map[string]interface{}{"tags": map[string]interface{}{"$in": []interface{}{"rust", "db"}}}))
+	assert.True(t, MatchesFilter(doc, map[string]interface{}{"scores": map[string]interface{}{"$gte": 90}}))
+	assert.False(t, MatchesFilter(doc, map[string]interface{}{"tags": "rust"}))
+
+	// Elements compare like a scalar field: strings ignore case, numbers by value
+	assert.True(t, MatchesFilter(doc, map[string]interface{}{"tags": "GO"}))
+	assert.True(t, MatchesFilter(doc, map[string]interface{}{"scores": 95.0}))
+	assert.False(t, MatchesFilter(doc, map[string]interface{}{"scores": map[string]interface{}{"$gt": 95}}))
+
+	// $contains only matches arrays
+	scalar := domain.Document{"tags": "go"}
+	assert.True(t, MatchesFilter(scalar, map[string]interface{}{"tags": "go"}))
+	assert.False(t, MatchesFilter(scalar, map[string]interface{}{"tags": map[string]interface{}{"$contains": "go"}}))
+}
+
+func TestArrayFilter_InvalidContains(t *testing.T) {
+	for _, filter := range []map[string]interface{}{
+		{"tags": map[string]interface{}{"$contains": []interface{}{"go"}}},
+		{"tags": map[string]interface{}{"$contains": "go", "$gt": 1}},
+	} {
+		err := ValidateFilter(filter)
+		assert.True(t, errors.Is(err, domain.ErrInvalidFilter), "filter %v: %v", filter, err)
+	}
+}
+
+func TestArrayFilter_MultikeyIndex(t *testing.T) {
+	engine := NewStorageEngine(WithNoSaves(true))
+	t.Cleanup(engine.StopBackgroundWorkers)
+
+	for _, tags := range []interface{}{
+		[]interface{}{"go", "db"},
+		[]interface{}{"rust"},
+		"go",
+	} {
+		_, err := engine.Insert("posts", domain.Document{"tags": tags})
+		require.NoError(t, err)
+	}
+	require.NoError(t, engine.CreateIndex("posts", "tags"))
+
+	equality := map[string]interface{}{"tags": "go"}
+	ids, useIndex := engine.optimizeWithIndexes("posts", equality)
+	assert.True(t, useIndex)
+	assert.ElementsMatch(t, []string{"1", "3"}, ids)
+
+	result, err := engine.FindAll("posts", equality, nil)
+	require.NoError(t, err)
+	assert.Len(t, result.Documents, 2)
+
+	// $contains narrows with the index, then drops the scalar match
+	contains := map[string]interface{}{"tags": map[string]interface{}{"$contains": "go"}}
+	ids, useIndex = engine.optimizeWithIndexes("posts", contains)
+	assert.True(t, useIndex)
+	assert.ElementsMatch(t, []string{"1", "3"}, ids)
+
+	matched, err := engine.FindIds("posts", contains)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"1"}, matched)
+
+	// Removing an element from the array removes the document from that key only
+	_, err = engine.UpdateById("posts", "1", domain.Document{"tags": []interface{}{"db"}})
+	require.NoError(t, err)
+	matched, err = engine.FindIds("posts", equality)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"3"}, matched)
+	matched, err = engine.FindIds("posts", map[string]interface{}{"tags": "db"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"1"}, matched)
+}
+
+func TestArrayFilter_ElemMatch(t *testing.T) {
+	doc := domain.Document{"items": []interface{}{
+		map[string]interface{}{"sku": "A", "qty": 2},
+		map[string]interface{}{"sku": "B", "qty": 5},
+		"loose",
+	}}
+	elemMatch := func(conditions map[string]interface{}) map[string]interface{} {
+		return map[string]interface{}{"items": map[string]interface{}{"$elemMatch": conditions}}
+	}
+
+	assert.True(t, MatchesFilter(doc, elemMatch(map[string]interface{}{"qty": map[string]interface{}{"$gt": 3}, "sku": "B"})))
+	assert.True(t, MatchesFilter(doc, elemMatch(map[string]interface{}{"sku": map[string]interface{}{"$in": []interface{}{"A", "C"}}})))
+
+	// Every condition must hold for the same element
+	assert.False(t, MatchesFilter(doc, elemMatch(map[string]interface{}{"qty": map[string]interface{}{"$gt": 3}, "sku": "A"})))
+	assert.False(t, MatchesFilter(doc, elemMatch(map[string]interface{}{"missing": 1})))
+
+	// Non-object elements and non-array fields never match
+	assert.False(t, MatchesFilter(domain.Document{"items": []interface{}{"B", 5}}, elemMatch(map[string]interface{}{"sku": "B"})))
+	assert.False(t, MatchesFilter(domain.Document{"items": map[string]interface{}{"sku": "B"}}, elemMatch(map[string]interface{}{"sku": "B"})))
+
+	for _, filter := range []map[string]interface{}{
+		elemMatch(map[string]interface{}{}),
+		elemMatch(map[string]interface{}{"qty": map[string]interface{}{"$gt": []interface{}{1}}}),
+		{"items": map[string]interface{}{"$elemMatch": "B"}},
+		{"items": map[string]interface{}{"$elemMatch": map[string]interface{}{"sku": "B"}, "$contains": "B"}},
+	} {
+		err := ValidateFilter(filter)
+		assert.True(t, errors.Is(err, domain.ErrInvalidFilter), "filter %v: %v", filter, err)
+	}
+	assert.NoError(t, ValidateFilter(elemMatch(map[string]interface{}{"qty": map[string]interface{}{"$gte": 1}})))
+}
+
+func TestArrayFilter_ElemMatchIndexedField(t *testing.T) {
+	engine := NewStorageEngine(WithNoSaves(true))
+	t.Cleanup(engine.StopBackgroundWorkers)
+
+	_, err := engine.Insert("orders", domain.Document{"items": []interface{}{map[string]interface{}{"sku": "B", "qty": 5}}})
+	require.NoError(t, err)
+	_, err = engine.Insert("orders", domain.Document{"items": []interface{}{map[string]interface{}{"sku": "B", "qty": 1}}})
+	require.NoError(t, err)
+	require.NoError(t, engine.CreateIndex("orders", "items"))
+
+	// Objects are not indexed, so the filter scans rather than consulting the index
+	filter := map[string]interface{}{"items": map[string]interface{}{"$elemMatch": map[string]interface{}{"qty": map[string]interface{}{"$gt": 3}}}}
+	ids, err := engine.FindIds("orders", filter)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"1"}, ids)
+
+	result, err := engine.FindAll("orders", filter, nil)
+	require.NoError(t, err)
+	assert.Len(t, result.Documents, 1)
+}
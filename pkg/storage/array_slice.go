@@ -0,0 +1,91 @@
+package storage
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/adfharrison1/go-db/pkg/domain"
+	"github.com/adfharrison1/go-db/pkg/indexing"
+)
+
+const (
+	// DefaultArraySliceLimit is the number of elements returned when no limit is given
+	DefaultArraySliceLimit = 50
+
+	// MaxArraySliceLimit bounds the number of elements returned by a single slice
+	MaxArraySliceLimit = 1000
+)
+
+// ValidateArraySlice checks the offset and limit of an array slice
+func ValidateArraySlice(offset, limit int) error {
+	if offset < 0 {
+		return fmt.Errorf("offset must not be negative, got %d", offset)
+	}
+	if limit < 1 || limit > MaxArraySliceLimit {
+		return fmt.Errorf("limit must be between 1 and %d, got %d", MaxArraySliceLimit, limit)
+	}
+	return nil
+}
+
+// SliceArrayField returns up to limit elements of a document's array field, starting
+// at offset. field may be a dotted path into nested objects. A missing field is a
+// domain.ErrFieldNotFound error and a field that is not an array a
+// domain.ErrInvalidField error. Only the returned elements are copied, so the
+// document may be read in place.
+func SliceArrayField(doc domain.Document, field string, offset, limit int) (*domain.ArraySlice, error) {
+	if err := ValidateArraySlice(offset, limit); err != nil {
+		return nil, err
+	}
+
+	value, exists := lookupFieldPath(doc, strings.Split(field, "."))
+	if !exists {
+		return nil, domain.Errorf(domain.ErrFieldNotFound, "field %s not found", field)
+	}
+	elements, isArray := indexing.ArrayElements(value)
+	if !isArray {
+		return nil, domain.Errorf(domain.ErrInvalidField, "field %s is not an array", field)
+	}
+
+	start := offset
+	if start > len(elements) {
+		start = len(elements)
+	}
+	end := start + limit
+	if end > len(elements) {
+		end = len(elements)
+	}
+
+	items := make([]interface{}, end-start)
+	for i, element := range elements[start:end] {
+		items[i] = copyValue(element)
+	}
+	return &domain.ArraySlice{
+		Field:   field,
+		Items:   items,
+		Offset:  offset,
+		Limit:   limit,
+		Total:   len(elements),
+		HasMore: end < len(elements),
+	}, nil
+}
+
+// GetArraySlice returns a window of a document's array field without copying the
+// rest of the document. See SliceArrayField.
+func (se *StorageEngine) GetArraySlice(collName, docId, field string, offset, limit int) (*domain.ArraySlice, error) {
+	var slice *domain.ArraySlice
+	err := se.withCollectionReadLock(collName, func() error {
+		return se.withDocumentReadLock(collName, docId, func() error {
+			doc, err := se.getByIdUnsafe(collName, docId)
+			if err != nil {
+				return err
+			}
+			slice, err = SliceArrayField(doc, field, offset, limit)
+			return err
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	se.trackAccess(collName, docId)
+	return slice, nil
+}
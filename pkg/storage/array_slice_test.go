@@ -0,0 +1,97 @@
+package storage
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/adfharrison1/go-db/pkg/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSliceArrayField(t *testing.T) {
+	doc := domain.Document{
+		"_id":   "1",
+		"name":  "post",
+		"tags":  []interface{}{"a", "b", "c", "d", "e"},
+		"meta":  map[string]interface{}{"likes": []interface{}{1, 2, 3}},
+		"items": []interface{}{map[string]interface{}{"sku": "A"}},
+	}
+
+	t.Run("window", func(t *testing.T) {
+		slice, err := SliceArrayField(doc, "tags", 1, 2)
+		require.NoError(t, err)
+		assert.Equal(t, []interface{}{"b", "c"}, slice.Items)
+		assert.Equal(t, 5, slice.Total)
+		assert.Equal(t, 1, slice.Offset)
+		assert.Equal(t, 2, slice.Limit)
+		assert.True(t, slice.HasMore)
+	})
+
+	t.Run("last window", func(t *testing.T) {
+		slice, err := SliceArrayField(doc, "tags", 3, 10)
+		require.NoError(t, err)
+		assert.Equal(t, []interface{}{"d", "e"}, slice.Items)
+		assert.False(t, slice.HasMore)
+	})
+
+	t.Run("offset past the end", func(t *testing.T) {
+		slice, err := SliceArrayField(doc, "tags", 10, 2)
+		require.NoError(t, err)
+		assert.Empty(t, slice.Items)
+		assert.NotNil(t, slice.Items)
+		assert.Equal(t, 5, slice.Total)
+		assert.False(t, slice.HasMore)
+	})
+
+	t.Run("nested field", func(t *testing.T) {
+		slice, err := SliceArrayField(doc, "meta.likes", 0, 50)
+		require.NoError(t, err)
+		assert.Equal(t, []interface{}{1, 2, 3}, slice.Items)
+	})
+
+	t.Run("elements are copied", func(t *testing.T) {
+		slice, err := SliceArrayField(doc, "items", 0, 1)
+		require.NoError(t, err)
+		slice.Items[0].(map[string]interface{})["sku"] = "B"
+		assert.Equal(t, "A", doc["items"].([]interface{})[0].(map[string]interface{})["sku"])
+	})
+
+	t.Run("missing field", func(t *testing.T) {
+		_, err := SliceArrayField(doc, "comments", 0, 10)
+		assert.True(t, errors.Is(err, domain.ErrFieldNotFound))
+	})
+
+	t.Run("not an array", func(t *testing.T) {
+		_, err := SliceArrayField(doc, "name", 0, 10)
+		assert.True(t, errors.Is(err, domain.ErrInvalidField))
+	})
+
+	t.Run("invalid window", func(t *testing.T) {
+		_, err := SliceArrayField(doc, "tags", -1, 10)
+		assert.Error(t, err)
+		_, err = SliceArrayField(doc, "tags", 0, 0)
+		assert.Error(t, err)
+		_, err = SliceArrayField(doc, "tags", 0, MaxArraySliceLimit+1)
+		assert.Error(t, err)
+	})
+}
+
+func TestStorageEngine_GetArraySlice(t *testing.T) {
+	engine := NewStorageEngine(WithDataDir(t.TempDir()))
+	defer engine.StopBackgroundWorkers()
+
+	_, err := engine.Insert("posts", domain.Document{"comments": []interface{}{"first", "second", "third"}})
+	require.NoError(t, err)
+
+	slice, err := engine.GetArraySlice("posts", "1", "comments", 1, 1)
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{"second"}, slice.Items)
+	assert.Equal(t, 3, slice.Total)
+	assert.True(t, slice.HasMore)
+
+	_, err = engine.GetArraySlice("posts", "2", "comments", 0, 10)
+	assert.True(t, errors.Is(err, domain.ErrDocumentNotFound))
+	_, err = engine.GetArraySlice("missing", "1", "comments", 0, 10)
+	assert.True(t, errors.Is(err, domain.ErrCollectionNotFound))
+}
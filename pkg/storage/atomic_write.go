@@ -0,0 +1,64 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// writeFileAtomic writes data to a temporary file and renames it over filename, so
+// a reader sees either the previous or the new contents and never a partial file.
+// The temporary file is created next to filename unless WithTempDir is set. When
+// the temp directory is on another filesystem the rename cannot be atomic, so the
+// data is staged again next to filename and renamed from there.
+func (se *StorageEngine) writeFileAtomic(filename string, data []byte) error {
+	dir := se.tempDir
+	if dir == "" {
+		dir = filepath.Dir(filename)
+	}
+
+	tempPath, err := writeTempFile(dir, filepath.Base(filename), data)
+	if err != nil {
+		return err
+	}
+
+	err = os.Rename(tempPath, filename)
+	if err != nil && se.tempDir != "" && errors.Is(err, syscall.EXDEV) {
+		os.Remove(tempPath)
+		tempPath, err = writeTempFile(filepath.Dir(filename), filepath.Base(filename), data)
+		if err != nil {
+			return err
+		}
+		err = os.Rename(tempPath, filename)
+	}
+	if err != nil {
+		os.Remove(tempPath) // Clean up temp file
+		return fmt.Errorf("failed to rename temporary file to %s: %w", filename, err)
+	}
+	return nil
+}
+
+// writeTempFile writes data to a new uniquely named file in dir
+func writeTempFile(dir, base string, data []byte) (string, error) {
+	file, err := os.CreateTemp(dir, base+".*.tmp")
+	if err != nil {
+		return "", fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	tempPath := file.Name()
+
+	// CreateTemp uses 0600; data files are readable like those written by os.WriteFile
+	err = file.Chmod(0644)
+	if err == nil {
+		_, err = file.Write(data)
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tempPath)
+		return "", fmt.Errorf("failed to write temporary file: %w", err)
+	}
+	return tempPath, nil
+}
@@ -0,0 +1,75 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/adfharrison1/go-db/pkg/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "data.godb")
+	require.NoError(t, os.WriteFile(target, []byte("old"), 0644))
+
+	engine := NewStorageEngine(WithNoSaves(true))
+	defer engine.StopBackgroundWorkers()
+
+	require.NoError(t, engine.writeFileAtomic(target, []byte("new")))
+	content, err := os.ReadFile(target)
+	require.NoError(t, err)
+	assert.Equal(t, "new", string(content))
+
+	info, err := os.Stat(target)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0644), info.Mode().Perm())
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 1, "no temporary files are left behind")
+}
+
+func TestWriteFileAtomic_FailedRenameKeepsTarget(t *testing.T) {
+	dir := t.TempDir()
+
+	// A non-empty directory cannot be replaced by a file, so the rename fails
+	target := filepath.Join(dir, "data.godb")
+	require.NoError(t, os.MkdirAll(filepath.Join(target, "keep"), 0755))
+
+	engine := NewStorageEngine(WithNoSaves(true))
+	defer engine.StopBackgroundWorkers()
+
+	assert.Error(t, engine.writeFileAtomic(target, []byte("new")))
+	assert.DirExists(t, filepath.Join(target, "keep"))
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 1, "the temporary file is removed")
+}
+
+func TestStorageEngine_WithTempDir(t *testing.T) {
+	dataDir := t.TempDir()
+	tempDir := t.TempDir()
+
+	engine := NewStorageEngine(WithDataDir(dataDir), WithTempDir(tempDir))
+	defer engine.StopBackgroundWorkers()
+
+	_, err := engine.Insert("users", domain.Document{"name": "Alice"})
+	require.NoError(t, err)
+
+	snapshot := filepath.Join(dataDir, "snapshot.godb")
+	require.NoError(t, engine.SaveToFile(snapshot))
+	assert.FileExists(t, snapshot)
+	assert.FileExists(t, filepath.Join(dataDir, "collections", "users.godb"))
+
+	entries, err := os.ReadDir(tempDir)
+	require.NoError(t, err)
+	assert.Empty(t, entries, "temporary files are renamed out of the temp directory")
+
+	loaded, err := readStorageFile(snapshot)
+	require.NoError(t, err)
+	assert.Len(t, loaded.Collections["users"], 1)
+}
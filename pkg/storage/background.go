@@ -10,12 +10,20 @@ func (se *StorageEngine) GetMemoryStats() map[string]interface{} {
 	runtime.ReadMemStats(&m)
 
 	return map[string]interface{}{
-		"alloc_mb":       m.Alloc / 1024 / 1024,
-		"total_alloc_mb": m.TotalAlloc / 1024 / 1024,
-		"sys_mb":         m.Sys / 1024 / 1024,
-		"num_goroutines": runtime.NumGoroutine(),
-		"cache_size":     se.cache.list.Len(),
-		"collections":    len(se.collections),
+		"alloc_mb":          m.Alloc / 1024 / 1024,
+		"total_alloc_mb":    m.TotalAlloc / 1024 / 1024,
+		"sys_mb":            m.Sys / 1024 / 1024,
+		"num_goroutines":    runtime.NumGoroutine(),
+		"cache_size":        se.cache.Len(),
+		"cache_capacity":    se.cache.Capacity(),
+		"max_memory_mb":     se.getMaxMemoryMB(),
+		"collections":       len(se.collections),
+		"disk_writes":       se.getDiskWriteStats(),
+		"open_snapshots":    se.openSnapshots(),
+		"concurrent_writes": se.writeLimiter.Stats(),
+		"compaction":        se.getCompactionStats(),
+		"background_saves":  se.savePool.stats(),
+		"write_buffer":      se.writeBufferStats(),
 	}
 }
 
@@ -28,6 +36,8 @@ func (se *StorageEngine) StartBackgroundWorkers() {
 // StopBackgroundWorkers stops background workers
 func (se *StorageEngine) StopBackgroundWorkers() {
 	se.stopOnce.Do(func() {
+		// Buffered saves are written first, as a failed one is queued for retry
+		se.flushWriteBuffer()
 		close(se.stopChan)
 		close(se.diskWriteQueue)
 	})
@@ -0,0 +1,257 @@
+package storage
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/adfharrison1/go-db/pkg/domain"
+)
+
+// ValidateCappedConfig checks that a collection can be capped at maxDocs documents
+// with the given eviction policy. A maxDocs of zero (which removes the cap) is valid.
+func ValidateCappedConfig(maxDocs int64, policy domain.EvictPolicy) error {
+	if maxDocs < 0 {
+		return fmt.Errorf("max_docs must not be negative, got %d", maxDocs)
+	}
+	if maxDocs > 0 && policy != domain.EvictFIFO && policy != domain.EvictLRU {
+		return fmt.Errorf("unknown evict policy %q (use %s or %s)", policy, domain.EvictFIFO, domain.EvictLRU)
+	}
+	return nil
+}
+
+// CappedTracker keeps the documents of a capped collection in eviction order,
+// with the next document to evict at the front
+type CappedTracker struct {
+	mu       sync.Mutex
+	maxDocs  int64
+	policy   domain.EvictPolicy
+	order    *list.List
+	elements map[string]*list.Element
+}
+
+// NewCappedTracker creates a tracker for a collection that already holds the
+// documents with the given IDs. They are ordered by ID, which follows insertion
+// order for generated IDs.
+func NewCappedTracker(maxDocs int64, policy domain.EvictPolicy, existingIDs []string) *CappedTracker {
+	ids := append([]string(nil), existingIDs...)
+	sort.Slice(ids, func(i, j int) bool {
+		return lessDocumentID(ids[i], ids[j])
+	})
+
+	ct := &CappedTracker{
+		maxDocs:  maxDocs,
+		policy:   policy,
+		order:    list.New(),
+		elements: make(map[string]*list.Element, len(ids)),
+	}
+	for _, id := range ids {
+		ct.elements[id] = ct.order.PushBack(id)
+	}
+	return ct
+}
+
+// Config returns the tracker's cap and eviction policy
+func (ct *CappedTracker) Config() *domain.CappedConfig {
+	return &domain.CappedConfig{MaxDocs: ct.maxDocs, Policy: ct.policy}
+}
+
+// Added records an inserted document and returns the IDs of the documents that
+// must be evicted to bring the collection back within its cap
+func (ct *CappedTracker) Added(docID string) []string {
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+
+	if element, exists := ct.elements[docID]; exists {
+		ct.order.MoveToBack(element)
+	} else {
+		ct.elements[docID] = ct.order.PushBack(docID)
+	}
+	return ct.victimsLocked()
+}
+
+// Victims removes and returns the IDs of the documents over the cap
+func (ct *CappedTracker) Victims() []string {
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+	return ct.victimsLocked()
+}
+
+func (ct *CappedTracker) victimsLocked() []string {
+	var victims []string
+	for int64(ct.order.Len()) > ct.maxDocs {
+		front := ct.order.Front()
+		docID := ct.order.Remove(front).(string)
+		delete(ct.elements, docID)
+		victims = append(victims, docID)
+	}
+	return victims
+}
+
+// Touched records an access to a document. It only changes the eviction order
+// under the LRU policy.
+func (ct *CappedTracker) Touched(docID string) {
+	if ct.policy != domain.EvictLRU {
+		return
+	}
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+
+	if element, exists := ct.elements[docID]; exists {
+		ct.order.MoveToBack(element)
+	}
+}
+
+// Removed stops tracking a deleted document
+func (ct *CappedTracker) Removed(docID string) {
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+
+	if element, exists := ct.elements[docID]; exists {
+		ct.order.Remove(element)
+		delete(ct.elements, docID)
+	}
+}
+
+// lessDocumentID orders numeric IDs by value and any other IDs as strings, after
+// all numeric IDs, so that collections mixing both still sort consistently
+func lessDocumentID(a, b string) bool {
+	na, errA := strconv.ParseUint(a, 10, 64)
+	nb, errB := strconv.ParseUint(b, 10, 64)
+	switch {
+	case errA == nil && errB == nil && na != nb:
+		return na < nb
+	case errA == nil && errB != nil:
+		return true
+	case errA != nil && errB == nil:
+		return false
+	}
+	return a < b
+}
+
+// SetCollectionCapped caps a collection at maxDocs documents. Once an insert takes the
+// collection past the cap, documents are evicted according to policy: the oldest
+// inserted first (FIFO) or the least recently read or written first (LRU). Documents
+// already over the cap are evicted immediately. A maxDocs of zero removes the cap.
+// Caps are held in memory only and are not persisted.
+func (se *StorageEngine) SetCollectionCapped(collName string, maxDocs int64, policy domain.EvictPolicy) error {
+	if err := ValidateCappedConfig(maxDocs, policy); err != nil {
+		return err
+	}
+
+	if maxDocs == 0 {
+		se.cappedMu.Lock()
+		delete(se.capped, collName)
+		se.cappedMu.Unlock()
+		return nil
+	}
+
+	var evicted []string
+	err := se.withCollectionWriteLock(collName, func() error {
+		var existingIDs []string
+		if collection, err := se.getCollectionInternal(collName); err == nil {
+			existingIDs = collection.IDs()
+		}
+
+		tracker := NewCappedTracker(maxDocs, policy, existingIDs)
+		se.cappedMu.Lock()
+		se.capped[collName] = tracker
+		se.cappedMu.Unlock()
+
+		evicted = se.evictUnsafe(collName, tracker.Victims())
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return se.persistEvictions(context.Background(), collName, evicted)
+}
+
+// GetCollectionCapped returns the collection's cap, or nil if it is not capped
+func (se *StorageEngine) GetCollectionCapped(collName string) *domain.CappedConfig {
+	tracker := se.cappedTracker(collName)
+	if tracker == nil {
+		return nil
+	}
+	return tracker.Config()
+}
+
+// cappedTracker returns the collection's tracker, or nil if it is not capped
+func (se *StorageEngine) cappedTracker(collName string) *CappedTracker {
+	se.cappedMu.RLock()
+	defer se.cappedMu.RUnlock()
+	return se.capped[collName]
+}
+
+// trackInsertsUnsafe records inserted documents of a capped collection and evicts
+// the documents over its cap, returning the IDs of those evicted (caller must hold
+// collection write lock)
+func (se *StorageEngine) trackInsertsUnsafe(collName string, docIDs ...string) []string {
+	tracker := se.cappedTracker(collName)
+	if tracker == nil {
+		return nil
+	}
+
+	var victims []string
+	for _, docID := range docIDs {
+		victims = append(victims, tracker.Added(docID)...)
+	}
+	return se.evictUnsafe(collName, victims)
+}
+
+// trackAccess records a read or write of a document in a capped collection
+func (se *StorageEngine) trackAccess(collName, docID string) {
+	if tracker := se.cappedTracker(collName); tracker != nil {
+		tracker.Touched(docID)
+	}
+}
+
+// trackDelete stops tracking a document deleted from a capped collection
+func (se *StorageEngine) trackDelete(collName, docID string) {
+	if tracker := se.cappedTracker(collName); tracker != nil {
+		tracker.Removed(docID)
+	}
+}
+
+// evictUnsafe deletes evicted documents, updating indexes and the document count,
+// and returns the IDs of those deleted (caller must hold collection write lock)
+func (se *StorageEngine) evictUnsafe(collName string, docIDs []string) []string {
+	var evicted []string
+	for _, docID := range docIDs {
+		err := se.withDocumentWriteLock(collName, docID, func() error {
+			_, err := se.deleteByIdUnsafe(collName, docID)
+			return err
+		})
+		if err == nil {
+			evicted = append(evicted, docID)
+		}
+	}
+	return evicted
+}
+
+// persistEvictions saves the removal of evicted documents (unless no-saves mode): as
+// one tombstone each in tombstone mode, so a full capped collection is not rewritten
+// on every insert, otherwise by saving the whole collection. A failed save is queued
+// for background retry; the error is that of persistFailed.
+func (se *StorageEngine) persistEvictions(ctx context.Context, collName string, evicted []string) error {
+	if len(evicted) == 0 || se.noSaves {
+		return nil
+	}
+	if !se.tombstonesEnabled() {
+		if err := se.SaveCollectionAfterTransaction(collName); err != nil {
+			return se.persistFailed(ctx, collName, "", nil, err)
+		}
+		return nil
+	}
+	for _, docID := range evicted {
+		if err := se.persistDelete(collName, docID); err != nil {
+			if err := se.persistFailed(ctx, collName, docID, nil, err); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
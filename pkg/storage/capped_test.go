@@ -0,0 +1,171 @@
+package storage
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/adfharrison1/go-db/pkg/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateCappedConfig(t *testing.T) {
+	assert.NoError(t, ValidateCappedConfig(10, domain.EvictFIFO))
+	assert.NoError(t, ValidateCappedConfig(10, domain.EvictLRU))
+	assert.NoError(t, ValidateCappedConfig(0, ""), "zero removes the cap")
+	assert.Error(t, ValidateCappedConfig(-1, domain.EvictFIFO))
+	assert.Error(t, ValidateCappedConfig(10, "random"))
+	assert.Error(t, ValidateCappedConfig(10, ""))
+}
+
+func TestLessDocumentID(t *testing.T) {
+	assert.True(t, lessDocumentID("2", "10"), "numeric IDs order by value")
+	assert.False(t, lessDocumentID("10", "2"))
+	assert.True(t, lessDocumentID("a", "b"))
+}
+
+func TestStorageEngine_CappedFIFO(t *testing.T) {
+	engine := NewStorageEngine(WithNoSaves(true))
+	defer engine.StopBackgroundWorkers()
+
+	require.NoError(t, engine.CreateCollection("events"))
+	require.NoError(t, engine.SetCollectionCapped("events", 3, domain.EvictFIFO))
+	require.NoError(t, engine.CreateIndex("events", "kind"))
+
+	for i := 1; i <= 5; i++ {
+		_, err := engine.Insert("events", domain.Document{"n": i, "kind": "click"})
+		require.NoError(t, err)
+	}
+
+	// Reads do not change the FIFO order
+	_, err := engine.GetById("events", "3")
+	require.NoError(t, err)
+
+	ids, err := engine.FindIds("events", nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"3", "4", "5"}, ids)
+
+	_, err = engine.GetById("events", "1")
+	assert.Error(t, err)
+
+	// Indexes no longer point at evicted documents
+	indexed, err := engine.FindAll("events", map[string]interface{}{"kind": "click"}, nil)
+	require.NoError(t, err)
+	assert.Len(t, indexed.Documents, 3)
+
+	_, info, found := engine.cache.Get("events")
+	require.True(t, found)
+	assert.Equal(t, int64(3), info.DocumentCount)
+
+	// A batch past the cap evicts the oldest documents, including earlier ones in the batch
+	_, err = engine.BatchInsert("events", []domain.Document{{"n": 6}, {"n": 7}, {"n": 8}, {"n": 9}})
+	require.NoError(t, err)
+	ids, err = engine.FindIds("events", nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"7", "8", "9"}, ids)
+
+	assert.Equal(t, &domain.CappedConfig{MaxDocs: 3, Policy: domain.EvictFIFO}, engine.GetCollectionCapped("events"))
+}
+
+func TestStorageEngine_CappedLRU(t *testing.T) {
+	engine := NewStorageEngine(WithNoSaves(true))
+	defer engine.StopBackgroundWorkers()
+
+	require.NoError(t, engine.SetCollectionCapped("sessions", 3, domain.EvictLRU))
+	for i := 1; i <= 3; i++ {
+		_, err := engine.Insert("sessions", domain.Document{"n": i})
+		require.NoError(t, err)
+	}
+
+	// Touch the two oldest documents so the third becomes least recently used
+	_, err := engine.GetById("sessions", "1")
+	require.NoError(t, err)
+	_, err = engine.UpdateById("sessions", "2", domain.Document{"seen": true})
+	require.NoError(t, err)
+
+	_, err = engine.Insert("sessions", domain.Document{"n": 4})
+	require.NoError(t, err)
+
+	ids, err := engine.FindIds("sessions", nil)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"1", "2", "4"}, ids)
+
+	// Deleted documents are not evicted again and free up a slot
+	require.NoError(t, engine.DeleteById("sessions", "1"))
+	_, err = engine.Insert("sessions", domain.Document{"n": 5})
+	require.NoError(t, err)
+	ids, err = engine.FindIds("sessions", nil)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"2", "4", "5"}, ids)
+}
+
+func TestStorageEngine_SetCollectionCappedExisting(t *testing.T) {
+	engine := NewStorageEngine(WithNoSaves(true))
+	defer engine.StopBackgroundWorkers()
+
+	for i := 1; i <= 12; i++ {
+		_, err := engine.Insert("logs", domain.Document{"line": fmt.Sprintf("line %d", i)})
+		require.NoError(t, err)
+	}
+
+	// Capping evicts the oldest documents by ID order ("10" is newer than "9")
+	require.NoError(t, engine.SetCollectionCapped("logs", 4, domain.EvictFIFO))
+	ids, err := engine.FindIds("logs", nil)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"9", "10", "11", "12"}, ids)
+
+	assert.Error(t, engine.SetCollectionCapped("logs", 4, "newest"))
+
+	// Removing the cap stops eviction
+	require.NoError(t, engine.SetCollectionCapped("logs", 0, ""))
+	assert.Nil(t, engine.GetCollectionCapped("logs"))
+	_, err = engine.Insert("logs", domain.Document{"line": "line 13"})
+	require.NoError(t, err)
+	ids, err = engine.FindIds("logs", nil)
+	require.NoError(t, err)
+	assert.Len(t, ids, 5)
+}
+
+func TestStorageEngine_CappedDualWritePersistsEvictions(t *testing.T) {
+	engine := NewStorageEngine(WithDataDir(t.TempDir()))
+	defer engine.StopBackgroundWorkers()
+
+	require.NoError(t, engine.SetCollectionCapped("events", 2, domain.EvictFIFO))
+	for i := 1; i <= 3; i++ {
+		_, err := engine.Insert("events", domain.Document{"n": i})
+		require.NoError(t, err)
+	}
+
+	onDisk, err := engine.loadCollectionFromDisk("events")
+	require.NoError(t, err)
+	assert.Len(t, onDisk.Documents, 2)
+	assert.NotContains(t, onDisk.Documents, "1")
+}
+
+func TestStorageEngine_CappedTombstoneEvictions(t *testing.T) {
+	engine := NewStorageEngine(WithDataDir(t.TempDir()), WithTombstoneDeletes(true), WithWriteCoalescing(time.Hour))
+	defer engine.StopBackgroundWorkers()
+
+	require.NoError(t, engine.SetCollectionCapped("events", 3, domain.EvictFIFO))
+	for i := 1; i <= 10; i++ {
+		_, err := engine.Insert("events", domain.Document{"n": i})
+		require.NoError(t, err)
+	}
+
+	// Each eviction is one tombstone; rewriting the collection would clear the log
+	records, err := engine.readDeltaLog("events")
+	require.NoError(t, err)
+	require.Len(t, records, 7)
+	for i, record := range records {
+		assert.True(t, record.Deleted)
+		assert.Equal(t, fmt.Sprint(i+1), record.ID)
+	}
+
+	// Evicted documents are dropped from the write buffer, so flushing it does not
+	// bring them back
+	engine.flushWriteBuffer()
+	onDisk, err := engine.loadCollectionFromDisk("events")
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"8", "9", "10"}, onDisk.IDs())
+}
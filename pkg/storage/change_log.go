@@ -0,0 +1,149 @@
+package storage
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/adfharrison1/go-db/pkg/domain"
+)
+
+// DefaultChangeLogSize is how many recent changes each collection's change log retains
+const DefaultChangeLogSize = 1000
+
+// ChangeLog records the writes to each collection in order, so clients can poll for
+// the changes after an offset instead of holding a connection open. Each collection
+// keeps its most recent changes only, numbered from 1, and the log lives in memory:
+// offsets start again from 1 when the process restarts. A nil log records nothing.
+type ChangeLog struct {
+	size int
+
+	mu   sync.Mutex
+	logs map[string]*collectionChanges
+}
+
+// collectionChanges is the retained tail of one collection's changes
+type collectionChanges struct {
+	changes []domain.Change // Oldest first, offsets consecutive
+	last    int64           // Offset of the newest change, 0 before the first
+	wake    chan struct{}   // Closed and replaced when a change is recorded
+}
+
+// NewChangeLog creates a change log retaining size changes per collection, or returns
+// nil if size is not positive
+func NewChangeLog(size int) *ChangeLog {
+	if size <= 0 {
+		return nil
+	}
+	return &ChangeLog{size: size, logs: make(map[string]*collectionChanges)}
+}
+
+// collection returns a collection's changes, creating them if needed.
+// Caller must hold cl.mu.
+func (cl *ChangeLog) collection(collName string) *collectionChanges {
+	log, exists := cl.logs[collName]
+	if !exists {
+		log = &collectionChanges{wake: make(chan struct{})}
+		cl.logs[collName] = log
+	}
+	return log
+}
+
+// DocumentChanged records an insert (nil oldDoc), update or delete (nil newDoc),
+// storing a copy of the new document, and wakes pollers waiting on the collection
+func (cl *ChangeLog) DocumentChanged(collName, docID string, oldDoc, newDoc domain.Document) {
+	if cl == nil || (oldDoc == nil && newDoc == nil) {
+		return
+	}
+
+	change := domain.Change{Op: domain.ChangeUpdate, DocID: docID, Timestamp: time.Now()}
+	switch {
+	case oldDoc == nil:
+		change.Op = domain.ChangeInsert
+	case newDoc == nil:
+		change.Op = domain.ChangeDelete
+	}
+	if newDoc != nil {
+		change.Document = CopyDocument(newDoc)
+	}
+
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+
+	log := cl.collection(collName)
+	log.last++
+	change.Offset = log.last
+	log.changes = append(log.changes, change)
+	if len(log.changes) > cl.size {
+		log.changes = log.changes[len(log.changes)-cl.size:]
+	}
+	close(log.wake)
+	log.wake = make(chan struct{})
+}
+
+// Changes returns up to limit changes to a collection after offset since (no limit if
+// limit is not positive). When there are none yet it waits up to wait for one, or
+// until ctx is done, and then returns what it has, possibly nothing.
+func (cl *ChangeLog) Changes(ctx context.Context, collName string, since int64, limit int, wait time.Duration) *domain.ChangeFeed {
+	feed, wake := cl.read(collName, since, limit)
+	if len(feed.Changes) > 0 || feed.Truncated || wait <= 0 {
+		return feed
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-wake:
+		feed, _ = cl.read(collName, since, limit)
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+	return feed
+}
+
+// read returns the retained changes after since and the channel closed by the next change
+func (cl *ChangeLog) read(collName string, since int64, limit int) (*domain.ChangeFeed, <-chan struct{}) {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+
+	log := cl.collection(collName)
+	feed := &domain.ChangeFeed{Changes: []domain.Change{}, NextOffset: since}
+
+	// An offset past the newest change comes from before a restart; start again from
+	// the oldest retained change
+	if since > log.last || since < 0 {
+		since = 0
+		feed.Truncated = true
+	}
+	oldest := log.last - int64(len(log.changes)) + 1
+	if since < oldest-1 {
+		since = oldest - 1
+		feed.Truncated = true
+	}
+
+	pending := log.changes[since-oldest+1:]
+	if limit > 0 && len(pending) > limit {
+		pending = pending[:limit]
+		feed.HasMore = true
+	}
+	feed.Changes = append(feed.Changes, pending...)
+	feed.NextOffset = since + int64(len(pending))
+	return feed, log.wake
+}
+
+// GetChanges returns up to limit changes to a collection after offset since, waiting
+// up to wait for the first one when there are none yet. Changes are recorded as writes
+// update the indexes, so the feed sees exactly the writes queries see.
+func (se *StorageEngine) GetChanges(ctx context.Context, collName string, since int64, limit int, wait time.Duration) (*domain.ChangeFeed, error) {
+	if se.changeLog == nil {
+		return nil, domain.Errorf(domain.ErrChangeFeedDisabled, "change feed is disabled")
+	}
+
+	se.mu.RLock()
+	_, exists := se.collections[collName]
+	se.mu.RUnlock()
+	if !exists {
+		return nil, domain.Errorf(domain.ErrCollectionNotFound, "collection %s does not exist", collName)
+	}
+	return se.changeLog.Changes(ctx, collName, since, limit, wait), nil
+}
@@ -0,0 +1,118 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/adfharrison1/go-db/pkg/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChangeLog(t *testing.T) {
+	assert.Nil(t, NewChangeLog(0))
+	var disabled *ChangeLog
+	disabled.DocumentChanged("orders", "1", nil, domain.Document{"a": 1})
+
+	log := NewChangeLog(3)
+	ctx := context.Background()
+	feed := log.Changes(ctx, "orders", 0, 0, 0)
+	assert.Empty(t, feed.Changes)
+	assert.Equal(t, int64(0), feed.NextOffset)
+	assert.False(t, feed.Truncated)
+
+	doc := domain.Document{"_id": "1", "status": "new"}
+	log.DocumentChanged("orders", "1", nil, doc)
+	doc["status"] = "paid"
+	log.DocumentChanged("orders", "1", domain.Document{"_id": "1", "status": "new"}, doc)
+	log.DocumentChanged("orders", "1", doc, nil)
+
+	feed = log.Changes(ctx, "orders", 0, 2, 0)
+	require.Len(t, feed.Changes, 2)
+	assert.Equal(t, domain.ChangeInsert, feed.Changes[0].Op)
+	assert.Equal(t, "new", feed.Changes[0].Document["status"], "documents are copied when recorded")
+	assert.Equal(t, domain.ChangeUpdate, feed.Changes[1].Op)
+	assert.Equal(t, int64(2), feed.NextOffset)
+	assert.True(t, feed.HasMore)
+
+	feed = log.Changes(ctx, "orders", feed.NextOffset, 2, 0)
+	require.Len(t, feed.Changes, 1)
+	assert.Equal(t, domain.ChangeDelete, feed.Changes[0].Op)
+	assert.Nil(t, feed.Changes[0].Document)
+	assert.Equal(t, int64(3), feed.NextOffset)
+	assert.False(t, feed.HasMore)
+
+	// Only the newest changes are kept; a poller that fell behind is told so
+	log.DocumentChanged("orders", "2", nil, domain.Document{"_id": "2"})
+	feed = log.Changes(ctx, "orders", 0, 0, 0)
+	assert.True(t, feed.Truncated)
+	require.Len(t, feed.Changes, 3)
+	assert.Equal(t, int64(2), feed.Changes[0].Offset)
+	assert.False(t, log.Changes(ctx, "orders", 1, 0, 0).Truncated)
+
+	// An offset from before a restart starts again from the oldest change
+	feed = log.Changes(ctx, "orders", 99, 0, 0)
+	assert.True(t, feed.Truncated)
+	assert.Equal(t, int64(4), feed.NextOffset)
+
+	// Collections are numbered separately
+	assert.Empty(t, log.Changes(ctx, "users", 0, 0, 0).Changes)
+}
+
+func TestChangeLog_LongPoll(t *testing.T) {
+	log := NewChangeLog(10)
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		log.DocumentChanged("orders", "1", nil, domain.Document{"_id": "1"})
+	}()
+	start := time.Now()
+	feed := log.Changes(context.Background(), "orders", 0, 0, 5*time.Second)
+	require.Len(t, feed.Changes, 1)
+	assert.Less(t, time.Since(start), 5*time.Second)
+
+	// The wait ends empty-handed after its timeout or when the caller gives up
+	feed = log.Changes(context.Background(), "orders", 1, 0, 20*time.Millisecond)
+	assert.Empty(t, feed.Changes)
+	assert.Equal(t, int64(1), feed.NextOffset)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.Empty(t, log.Changes(ctx, "orders", 1, 0, 5*time.Second).Changes)
+}
+
+func TestStorageEngine_GetChanges(t *testing.T) {
+	engine := NewStorageEngine(WithNoSaves(true))
+	defer engine.StopBackgroundWorkers()
+
+	_, err := engine.GetChanges(context.Background(), "orders", 0, 0, 0)
+	assert.True(t, errors.Is(err, domain.ErrCollectionNotFound))
+
+	inserted, err := engine.Insert("orders", domain.Document{"status": "new"})
+	require.NoError(t, err)
+	id := inserted["_id"].(string)
+	_, err = engine.UpdateById("orders", id, domain.Document{"status": "paid"})
+	require.NoError(t, err)
+	_, err = engine.BatchInsert("orders", []domain.Document{{"status": "new"}})
+	require.NoError(t, err)
+	require.NoError(t, engine.DeleteById("orders", id))
+
+	feed, err := engine.GetChanges(context.Background(), "orders", 0, 0, 0)
+	require.NoError(t, err)
+	var ops []domain.ChangeOp
+	for _, change := range feed.Changes {
+		ops = append(ops, change.Op)
+	}
+	assert.Equal(t, []domain.ChangeOp{domain.ChangeInsert, domain.ChangeUpdate, domain.ChangeInsert, domain.ChangeDelete}, ops)
+	assert.Equal(t, "paid", feed.Changes[1].Document["status"])
+	assert.Equal(t, id, feed.Changes[3].DocID)
+
+	off := NewStorageEngine(WithNoSaves(true), WithChangeLogSize(0))
+	defer off.StopBackgroundWorkers()
+	_, err = off.Insert("orders", domain.Document{"status": "new"})
+	require.NoError(t, err)
+	_, err = off.GetChanges(context.Background(), "orders", 0, 0, 0)
+	assert.True(t, errors.Is(err, domain.ErrChangeFeedDisabled))
+}
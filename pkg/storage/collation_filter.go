@@ -0,0 +1,138 @@
+package storage
+
+import (
+	"fmt"
+
+	"github.com/adfharrison1/go-db/pkg/domain"
+	"github.com/adfharrison1/go-db/pkg/indexing"
+)
+
+// CollationFilterKey is the top-level filter operator naming the collation the
+// filter's string conditions compare under, e.g. {"name": "jose", "$collation":
+// "ci_ai"} also matches "José". Without it string equality ignores case (see
+// ValuesMatch); under it two strings are equal when their domain.CollationKey are.
+// It applies to equality, $in, $ne and $nin; ranges, $regex and the other operators
+// compare as they do without it.
+const CollationFilterKey = "$collation"
+
+// collatedCondition is an equality or $in condition on strings compared under a collation
+type collatedCondition struct {
+	collation string
+	keys      []string // domain.CollationKey of each value
+}
+
+// matches reports whether a stored value folds to one of the condition's keys.
+// Values that are not strings never match.
+func (c *collatedCondition) matches(actual interface{}) bool {
+	s, ok := actual.(string)
+	if !ok {
+		return false
+	}
+	key := domain.CollationKey(s, c.collation)
+	for _, k := range c.keys {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
+
+// newCollatedCondition builds the condition for a string or an $in list of strings.
+// Other values are left to compare as before.
+func newCollatedCondition(collation string, expected interface{}) (*collatedCondition, bool) {
+	values, ok := InFilterValues(expected)
+	if !ok {
+		values = []interface{}{expected}
+	}
+	keys := make([]string, len(values))
+	for i, value := range values {
+		s, ok := value.(string)
+		if !ok {
+			return nil, false
+		}
+		keys[i] = domain.CollationKey(s, collation)
+	}
+	return &collatedCondition{collation: collation, keys: keys}, true
+}
+
+// ApplyCollation returns filter without its $collation and with each string
+// equality, $in, $ne and $nin condition replaced by one comparing under that
+// collation. A filter without $collation is returned as it is; filter itself is not
+// modified.
+func ApplyCollation(filter map[string]interface{}) map[string]interface{} {
+	source, exists := filter[CollationFilterKey]
+	if !exists {
+		return filter
+	}
+	collated := copyFilter(filter)
+	delete(collated, CollationFilterKey)
+	collation, _ := source.(string)
+	if collation == "" {
+		return collated
+	}
+
+	for field, expected := range collated {
+		if field == ExprFilterKey {
+			continue
+		}
+		if excluded, bounds, ok := NeFilterValue(expected); ok {
+			if condition, ok := newCollatedCondition(collation, excluded); ok {
+				operator := copyFilter(bounds)
+				operator[NeFilterKey] = condition
+				collated[field] = operator
+			}
+			continue
+		}
+		if excluded, ok := NinFilterValues(expected); ok {
+			// Equal to none of the values is not equal to the condition holding them all
+			if condition, ok := newCollatedCondition(collation, map[string]interface{}{InFilterKey: excluded}); ok {
+				collated[field] = map[string]interface{}{NeFilterKey: condition}
+			}
+			continue
+		}
+		if condition, ok := newCollatedCondition(collation, expected); ok {
+			collated[field] = condition
+		}
+	}
+	return collated
+}
+
+// validateCollationFilter checks that a $collation operator names a known collation
+func validateCollationFilter(filter map[string]interface{}) error {
+	source, exists := filter[CollationFilterKey]
+	if !exists {
+		return nil
+	}
+	collation, ok := source.(string)
+	if !ok {
+		return fmt.Errorf("%w: %s must be a string, got %s", domain.ErrInvalidFilter, CollationFilterKey, FieldTypeName(source))
+	}
+	if err := domain.ValidateCollation(collation); err != nil {
+		return fmt.Errorf("%w: %s: %v", domain.ErrInvalidFilter, CollationFilterKey, err)
+	}
+	return nil
+}
+
+// indexAnswers reports whether a query may use index for a field's filter value. A
+// collated index stores folded keys, so it only answers conditions under its own
+// collation; an index without one answers those by testing its distinct values.
+func indexAnswers(index *indexing.Index, expected interface{}) bool {
+	if index.Collation == "" {
+		return true
+	}
+	condition, ok := expected.(*collatedCondition)
+	return ok && condition.collation == index.Collation
+}
+
+// queryIndexCollated answers a collated condition from an index: by looking its keys
+// up in an index of the same collation, or else by testing each distinct value
+func queryIndexCollated(index *indexing.Index, condition *collatedCondition) []string {
+	if index.Collation != condition.collation {
+		return index.QueryMatching(condition.matches)
+	}
+	values := make([]interface{}, len(condition.keys))
+	for i, key := range condition.keys {
+		values[i] = key
+	}
+	return queryIndexIn(index, values)
+}
@@ -0,0 +1,101 @@
+package storage
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/adfharrison1/go-db/pkg/domain"
+	"github.com/adfharrison1/go-db/pkg/indexing"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCollationFilter_MatchesFilter(t *testing.T) {
+	doc := domain.Document{"name": "José", "tags": []interface{}{"Café", "db"}, "age": 30}
+
+	assert.False(t, MatchesFilter(doc, map[string]interface{}{"name": "jose"}), "without a collation only case is ignored")
+	assert.True(t, MatchesFilter(doc, map[string]interface{}{"name": "JOSÉ"}))
+	assert.True(t, MatchesFilter(doc, map[string]interface{}{"name": "Jose", "$collation": domain.CollationAccentInsensitive}))
+	assert.False(t, MatchesFilter(doc, map[string]interface{}{"name": "jose", "$collation": domain.CollationAccentInsensitive}), "ai keeps case")
+	assert.False(t, MatchesFilter(doc, map[string]interface{}{"name": "JOSÉ", "$collation": domain.CollationAccentInsensitive}))
+	assert.True(t, MatchesFilter(doc, map[string]interface{}{"name": "jose", "$collation": domain.CollationCaseAccentInsensitive}))
+	assert.True(t, MatchesFilter(doc, map[string]interface{}{"name": "José", "$collation": domain.CollationAccentInsensitive}), "decomposed accents fold too")
+
+	// $in, $ne and $nin compare under the collation, and arrays match by element
+	assert.True(t, MatchesFilter(doc, map[string]interface{}{"name": map[string]interface{}{"$in": []interface{}{"ann", "jose"}}, "$collation": "ci_ai"}))
+	assert.False(t, MatchesFilter(doc, map[string]interface{}{"name": map[string]interface{}{"$ne": "JOSE"}, "$collation": "ci_ai"}))
+	assert.True(t, MatchesFilter(doc, map[string]interface{}{"name": map[string]interface{}{"$ne": "JOSE"}, "$collation": "ai"}))
+	assert.False(t, MatchesFilter(doc, map[string]interface{}{"name": map[string]interface{}{"$nin": []interface{}{"ann", "jose"}}, "$collation": "ci_ai"}))
+	assert.True(t, MatchesFilter(doc, map[string]interface{}{"tags": "cafe", "$collation": "ci_ai"}))
+	assert.True(t, MatchesFilter(doc, map[string]interface{}{"age": 30, "$collation": "ci_ai"}), "other values compare as before")
+}
+
+func TestCollationFilter_Validate(t *testing.T) {
+	assert.NoError(t, ValidateFilter(map[string]interface{}{"name": "jose", "$collation": "ci_ai"}))
+	for _, filter := range []map[string]interface{}{
+		{"name": "jose", "$collation": "fr"},
+		{"name": "jose", "$collation": 1},
+	} {
+		assert.ErrorIs(t, ValidateFilter(filter), domain.ErrInvalidFilter, "filter %v", filter)
+	}
+}
+
+func TestCollationFilter_CollatedIndex(t *testing.T) {
+	engine := NewStorageEngine(WithNoSaves(true))
+	defer engine.StopBackgroundWorkers()
+	for _, doc := range []domain.Document{
+		{"name": "José", "email": "Jo@Example.com"},
+		{"name": "jose", "email": "ann@example.com"},
+		{"name": "Ann", "email": "bob@example.com"},
+	} {
+		_, err := engine.Insert("users", doc)
+		require.NoError(t, err)
+	}
+	require.NoError(t, engine.CreateCollatedIndex("users", "name", domain.CollationCaseAccentInsensitive, false))
+	require.NoError(t, engine.CreateCollatedIndex("users", "email", domain.CollationCaseInsensitive, true))
+	getIndex := func(field string) (*indexing.Index, bool) { return engine.getIndex("users", field) }
+
+	// A filter with the index's collation is answered from the index
+	ids, ok := IndexOnlyIDs(ApplyCollation(map[string]interface{}{"name": "JOSE", "$collation": "ci_ai"}), getIndex)
+	assert.True(t, ok)
+	assert.ElementsMatch(t, []string{"1", "2"}, ids)
+	result, err := engine.FindAll("users", map[string]interface{}{"name": "JOSE", "$collation": "ci_ai"}, nil)
+	require.NoError(t, err)
+	assert.Len(t, result.Documents, 2)
+
+	// Other filters on the field scan, since the index folds its keys
+	_, ok = IndexOnlyIDs(map[string]interface{}{"name": "jose"}, getIndex)
+	assert.False(t, ok)
+	_, ok = IndexOnlyIDs(ApplyCollation(map[string]interface{}{"name": "jose", "$collation": "ai"}), getIndex)
+	assert.False(t, ok)
+	result, err = engine.FindAll("users", map[string]interface{}{"name": "jose"}, nil)
+	require.NoError(t, err)
+	assert.Len(t, result.Documents, 1)
+
+	// A unique collated index rejects values equal under its collation
+	_, err = engine.Insert("users", domain.Document{"name": "Zoe", "email": "jo@example.COM"})
+	assert.ErrorIs(t, err, domain.ErrDuplicateKey)
+
+	assert.Error(t, engine.CreateCollatedIndex("users", "city", "fr", false))
+	assert.Error(t, engine.CreateCollatedIndex("users", "city", "", false))
+}
+
+func TestCollationFilter_CollatedIndexPersisted(t *testing.T) {
+	tempDir := t.TempDir()
+	engine := NewStorageEngine(WithDataDir(tempDir))
+	_, err := engine.Insert("users", domain.Document{"name": "José"})
+	require.NoError(t, err)
+	require.NoError(t, engine.CreateCollatedIndex("users", "name", domain.CollationCaseAccentInsensitive, false))
+	engine.StopBackgroundWorkers()
+
+	restarted := NewStorageEngine(WithDataDir(tempDir))
+	defer restarted.StopBackgroundWorkers()
+	require.NoError(t, restarted.LoadCollectionMetadata(filepath.Join(tempDir, "missing.godb")))
+	result, err := restarted.FindAll("users", map[string]interface{}{"name": "jose", "$collation": "ci_ai"}, nil)
+	require.NoError(t, err)
+	assert.Len(t, result.Documents, 1)
+	index, exists := restarted.getIndex("users", "name")
+	require.True(t, exists)
+	assert.Equal(t, domain.CollationCaseAccentInsensitive, index.Collation)
+	assert.Equal(t, []string{"1"}, index.Query("JOSE"))
+}
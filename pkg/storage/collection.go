@@ -1,6 +1,7 @@
 package storage
 
 import (
+	"sync"
 	"time"
 
 	"github.com/adfharrison1/go-db/pkg/domain"
@@ -15,6 +16,22 @@ const (
 	CollectionStateDirty
 )
 
+// String returns the state's name, as reported by ListCollections
+func (s CollectionState) String() string {
+	switch s {
+	case CollectionStateUnloaded:
+		return "unloaded"
+	case CollectionStateLoading:
+		return "loading"
+	case CollectionStateLoaded:
+		return "loaded"
+	case CollectionStateDirty:
+		return "dirty"
+	default:
+		return "unknown"
+	}
+}
+
 type CollectionInfo struct {
 	Name          string
 	DocumentCount int64
@@ -23,6 +40,67 @@ type CollectionInfo struct {
 	State         CollectionState
 	AccessCount   int64
 	LastAccessed  time.Time
+	DirtySince    time.Time // When the collection last went from saved to dirty
+
+	// stateMu guards State, DirtySince, LastModified and dirtyGen once the collection
+	// is registered, since writers holding only a document lock mark it dirty
+	stateMu  sync.Mutex
+	dirtyGen uint64 // Count of changes marked with markDirty
+}
+
+// markDirty marks the collection as having unsaved changes. DirtySince keeps the time
+// of the first unsaved change, so background saves can start with the longest-waiting
+// collections however often the others are written.
+func (info *CollectionInfo) markDirty() {
+	info.stateMu.Lock()
+	defer info.stateMu.Unlock()
+	now := time.Now()
+	if info.State != CollectionStateDirty {
+		info.DirtySince = now
+	}
+	info.State = CollectionStateDirty
+	info.LastModified = now
+	info.dirtyGen++
+}
+
+// dirtyGeneration returns the count of changes marked so far. A save reads it before
+// writing and passes it to markSaved.
+func (info *CollectionInfo) dirtyGeneration() uint64 {
+	info.stateMu.Lock()
+	defer info.stateMu.Unlock()
+	return info.dirtyGen
+}
+
+// markSaved marks the collection clean after a save that began at generation gen,
+// unless a change was marked since: the save may not hold it, so the collection
+// stays dirty for the next one.
+func (info *CollectionInfo) markSaved(gen uint64) {
+	info.stateMu.Lock()
+	defer info.stateMu.Unlock()
+	if info.dirtyGen == gen {
+		info.State = CollectionStateLoaded
+	}
+}
+
+// setState sets the collection's state, for loading and unloading
+func (info *CollectionInfo) setState(state CollectionState) {
+	info.stateMu.Lock()
+	defer info.stateMu.Unlock()
+	info.State = state
+}
+
+// currentState returns the collection's state
+func (info *CollectionInfo) currentState() CollectionState {
+	info.stateMu.Lock()
+	defer info.stateMu.Unlock()
+	return info.State
+}
+
+// dirtySince returns when the collection last went from saved to dirty
+func (info *CollectionInfo) dirtySince() time.Time {
+	info.stateMu.Lock()
+	defer info.stateMu.Unlock()
+	return info.DirtySince
 }
 
 // Collection wraps domain.Collection for storage-specific functionality
@@ -35,3 +113,14 @@ type Document = domain.Document
 func NewCollection(name string) *Collection {
 	return domain.NewCollection(name)
 }
+
+// rangeDocuments calls fn for each document of a collection, however it is stored,
+// stopping at and returning the first error fn returns
+func rangeDocuments(collection *domain.Collection, fn func(docID string, doc domain.Document) error) error {
+	var err error
+	collection.Range(func(docID string, doc domain.Document) bool {
+		err = fn(docID, doc)
+		return err == nil
+	})
+	return err
+}
@@ -0,0 +1,26 @@
+package storage
+
+import (
+	"fmt"
+
+	"github.com/adfharrison1/go-db/pkg/domain"
+)
+
+// CheckCollectionLimit reports whether another collection may be created when
+// count collections already exist. A max of 0 or less means no limit.
+// Returned errors wrap domain.ErrCollectionLimitReached.
+func CheckCollectionLimit(count, max int) error {
+	if max > 0 && count >= max {
+		return fmt.Errorf("%w: maximum of %d collections", domain.ErrCollectionLimitReached, max)
+	}
+	return nil
+}
+
+// validateNewCollection checks the naming policy and the collection limit before
+// a collection is created (caller must hold the lock guarding se.collections)
+func (se *StorageEngine) validateNewCollection(collName string) error {
+	if err := se.validateCollectionName(collName); err != nil {
+		return err
+	}
+	return CheckCollectionLimit(len(se.collections), se.maxCollections)
+}
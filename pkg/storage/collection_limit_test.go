@@ -0,0 +1,55 @@
+package storage
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/adfharrison1/go-db/pkg/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckCollectionLimit(t *testing.T) {
+	assert.NoError(t, CheckCollectionLimit(100, 0), "zero means unlimited")
+	assert.NoError(t, CheckCollectionLimit(1, 2))
+
+	err := CheckCollectionLimit(2, 2)
+	require.Error(t, err)
+	assert.True(t, errors.Is(err, domain.ErrCollectionLimitReached))
+}
+
+func TestStorageEngine_MaxCollections(t *testing.T) {
+	engine := NewStorageEngine(WithDataDir(t.TempDir()), WithNoSaves(true), WithMaxCollections(2))
+	defer engine.StopBackgroundWorkers()
+
+	require.NoError(t, engine.CreateCollection("first"))
+	_, err := engine.Insert("second", domain.Document{"name": "Alice"})
+	require.NoError(t, err)
+
+	t.Run("create collection", func(t *testing.T) {
+		err := engine.CreateCollection("third")
+		assert.True(t, errors.Is(err, domain.ErrCollectionLimitReached), "got %v", err)
+	})
+
+	t.Run("implicit creation on insert", func(t *testing.T) {
+		_, err := engine.Insert("third", domain.Document{"name": "Bob"})
+		assert.True(t, errors.Is(err, domain.ErrCollectionLimitReached), "got %v", err)
+	})
+
+	t.Run("implicit creation on batch insert", func(t *testing.T) {
+		_, err := engine.BatchInsert("third", []domain.Document{{"name": "Bob"}})
+		assert.True(t, errors.Is(err, domain.ErrCollectionLimitReached), "got %v", err)
+	})
+
+	t.Run("copy collection", func(t *testing.T) {
+		err := engine.CopyCollection("second", "third")
+		assert.True(t, errors.Is(err, domain.ErrCollectionLimitReached), "got %v", err)
+	})
+
+	t.Run("existing collections still accept writes", func(t *testing.T) {
+		_, err := engine.Insert("second", domain.Document{"name": "Carol"})
+		assert.NoError(t, err)
+		_, err = engine.Insert("first", domain.Document{"name": "Dave"})
+		assert.NoError(t, err)
+	})
+}
@@ -0,0 +1,63 @@
+package storage
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/adfharrison1/go-db/pkg/domain"
+)
+
+// DefaultCollectionNamePattern is the allowed-character policy used when no
+// custom pattern is configured
+const DefaultCollectionNamePattern = `^[a-zA-Z0-9_-]+$`
+
+// MaxCollectionNameLength keeps collection file names within common filesystem limits
+const MaxCollectionNameLength = 200
+
+// illegalCollectionNameChars are rejected regardless of the configured pattern
+// because they are path separators or reserved on common filesystems
+const illegalCollectionNameChars = `/\<>:"|?*`
+
+var defaultCollectionNameRegexp = regexp.MustCompile(DefaultCollectionNamePattern)
+
+// ValidateCollectionName checks a collection name against the filesystem safety
+// rules and the allowed-character pattern. A nil pattern uses DefaultCollectionNamePattern.
+// Returned errors wrap domain.ErrInvalidCollectionName.
+func ValidateCollectionName(name string, pattern *regexp.Regexp) error {
+	if name == "" {
+		return fmt.Errorf("%w: collection name cannot be empty", domain.ErrInvalidCollectionName)
+	}
+	if len(name) > MaxCollectionNameLength {
+		return fmt.Errorf("%w: collection name exceeds %d characters", domain.ErrInvalidCollectionName, MaxCollectionNameLength)
+	}
+	if name == "." || name == ".." {
+		return fmt.Errorf("%w: collection name %q is reserved", domain.ErrInvalidCollectionName, name)
+	}
+	if i := strings.IndexAny(name, illegalCollectionNameChars); i >= 0 {
+		return fmt.Errorf("%w: collection name %q contains illegal character %q", domain.ErrInvalidCollectionName, name, name[i])
+	}
+	for _, r := range name {
+		if r == 0 || unicode.IsControl(r) {
+			return fmt.Errorf("%w: collection name %q contains a control character", domain.ErrInvalidCollectionName, name)
+		}
+	}
+	if strings.HasSuffix(name, ".") || strings.HasSuffix(name, " ") {
+		return fmt.Errorf("%w: collection name %q cannot end with a dot or space", domain.ErrInvalidCollectionName, name)
+	}
+
+	if pattern == nil {
+		pattern = defaultCollectionNameRegexp
+	}
+	if !pattern.MatchString(name) {
+		return fmt.Errorf("%w: collection name %q does not match pattern %s", domain.ErrInvalidCollectionName, name, pattern.String())
+	}
+
+	return nil
+}
+
+// validateCollectionName applies the engine's configured naming policy
+func (se *StorageEngine) validateCollectionName(collName string) error {
+	return ValidateCollectionName(collName, se.collectionNamePattern)
+}
@@ -0,0 +1,83 @@
+package storage
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/adfharrison1/go-db/pkg/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateCollectionName(t *testing.T) {
+	valid := []string{"users", "user_profiles", "orders-2024", "A1"}
+	for _, name := range valid {
+		assert.NoError(t, ValidateCollectionName(name, nil), name)
+	}
+
+	invalid := []string{
+		"",
+		".",
+		"..",
+		"../etc",
+		"a/b",
+		`a\b`,
+		"a\x00b",
+		"a:b",
+		"a*b",
+		"a?b",
+		"a\"b",
+		"a<b>",
+		"a|b",
+		"tab\tname",
+		"trailing.",
+		"has space",
+		strings.Repeat("a", MaxCollectionNameLength+1),
+	}
+	for _, name := range invalid {
+		err := ValidateCollectionName(name, nil)
+		require.Error(t, err, "%q should be rejected", name)
+		assert.True(t, errors.Is(err, domain.ErrInvalidCollectionName), name)
+	}
+}
+
+func TestValidateCollectionName_CustomPattern(t *testing.T) {
+	pattern := regexp.MustCompile(`^[a-z.]+$`)
+
+	assert.NoError(t, ValidateCollectionName("app.users", pattern))
+	assert.Error(t, ValidateCollectionName("Users", pattern))
+
+	// Filesystem safety rules apply even when the pattern would allow the name
+	permissive := regexp.MustCompile(`.*`)
+	assert.Error(t, ValidateCollectionName("a/b", permissive))
+	assert.Error(t, ValidateCollectionName("..", permissive))
+	assert.Error(t, ValidateCollectionName("a\x00b", permissive))
+}
+
+func TestStorageEngine_CollectionNameValidation(t *testing.T) {
+	engine := NewStorageEngine(WithNoSaves(true))
+	defer engine.StopBackgroundWorkers()
+
+	err := engine.CreateCollection("../outside")
+	assert.True(t, errors.Is(err, domain.ErrInvalidCollectionName))
+
+	_, err = engine.Insert("bad/name", domain.Document{"name": "Alice"})
+	assert.True(t, errors.Is(err, domain.ErrInvalidCollectionName))
+
+	_, err = engine.BatchInsert("bad name", []domain.Document{{"name": "Alice"}})
+	assert.True(t, errors.Is(err, domain.ErrInvalidCollectionName))
+
+	_, err = engine.GetCollection("bad/name")
+	assert.Error(t, err, "rejected collections must not be created")
+
+	_, err = engine.Insert("good_name", domain.Document{"name": "Alice"})
+	assert.NoError(t, err)
+
+	custom := NewStorageEngine(WithNoSaves(true), WithCollectionNamePattern(regexp.MustCompile(`^[a-z]+\.[a-z]+$`)))
+	defer custom.StopBackgroundWorkers()
+
+	assert.NoError(t, custom.CreateCollection("app.users"))
+	assert.True(t, errors.Is(custom.CreateCollection("users"), domain.ErrInvalidCollectionName))
+}
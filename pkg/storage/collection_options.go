@@ -0,0 +1,90 @@
+package storage
+
+import (
+	"fmt"
+
+	"github.com/adfharrison1/go-db/pkg/domain"
+)
+
+// ValidateCollectionOptions checks every part of a collection's options up front, so
+// creating the collection with them does not fail halfway through
+func ValidateCollectionOptions(opts domain.CollectionOptions) error {
+	indexed := make(map[string]bool, len(opts.Indexes))
+	for i, index := range opts.Indexes {
+		switch {
+		case index.Field == "":
+			return domain.Errorf(domain.ErrInvalidField, "index %d: field name is required", i)
+		case index.Field == "_id":
+			return domain.Errorf(domain.ErrInvalidField, "index %d: _id is indexed automatically", i)
+		case indexed[index.Field]:
+			return domain.Errorf(domain.ErrInvalidField, "index %d: field %s is indexed twice", i, index.Field)
+		}
+		indexed[index.Field] = true
+		if index.Condition != nil {
+			if err := ValidateIndexCondition(index.Condition); err != nil {
+				return fmt.Errorf("index %d: %w", i, err)
+			}
+		}
+	}
+
+	if err := ValidateCollectionSchema(opts.Schema); err != nil {
+		return fmt.Errorf("schema: %w", err)
+	}
+	if opts.StrictSchema && len(opts.Schema) == 0 {
+		return fmt.Errorf("strict_schema requires a schema")
+	}
+	if err := ValidateDocumentDefaults(opts.Defaults); err != nil {
+		return fmt.Errorf("defaults: %w", err)
+	}
+	if err := ValidateFilter(opts.DefaultFilter); err != nil {
+		return fmt.Errorf("default_filter: %w", err)
+	}
+	if opts.Capped != nil {
+		if err := ValidateCappedConfig(opts.Capped.MaxDocs, opts.Capped.Policy); err != nil {
+			return fmt.Errorf("capped: %w", err)
+		}
+	}
+	return nil
+}
+
+// ConfigureCollection applies a new collection's options through the engine, stopping
+// at the first failure. The settings come first, so every index is built under them.
+func ConfigureCollection(engine domain.StorageEngine, collName string, opts domain.CollectionOptions) error {
+	engine.SetCollectionSchema(collName, opts.Schema)
+	engine.SetCollectionSchemaStrict(collName, opts.StrictSchema)
+	engine.SetCollectionDefaults(collName, opts.Defaults)
+	engine.SetCollectionDefaultFilter(collName, opts.DefaultFilter)
+	if opts.Capped != nil {
+		if err := engine.SetCollectionCapped(collName, opts.Capped.MaxDocs, opts.Capped.Policy); err != nil {
+			return fmt.Errorf("capped: %w", err)
+		}
+	}
+	if opts.Compact {
+		if err := engine.SetCollectionCompact(collName, true); err != nil {
+			return fmt.Errorf("compact: %w", err)
+		}
+	}
+
+	for _, index := range opts.Indexes {
+		var err error
+		if index.Condition != nil {
+			err = engine.CreatePartialIndex(collName, index.Field, index.Condition)
+		} else {
+			err = engine.CreateIndex(collName, index.Field)
+		}
+		if err != nil {
+			return fmt.Errorf("index on %s: %w", index.Field, err)
+		}
+	}
+	return nil
+}
+
+// ResetCollectionSettings clears the settings ConfigureCollection applies, for an
+// engine discarding a collection it could not configure. Indexes are left to the engine.
+func ResetCollectionSettings(engine domain.StorageEngine, collName string) {
+	engine.SetCollectionSchema(collName, nil)
+	engine.SetCollectionDefaults(collName, nil)
+	engine.SetCollectionDefaultFilter(collName, nil)
+	engine.SetCollectionCapped(collName, 0, "")
+	engine.SetCollectionCompact(collName, false)
+}
@@ -0,0 +1,105 @@
+package storage
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/adfharrison1/go-db/pkg/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateCollectionOptions(t *testing.T) {
+	assert.NoError(t, ValidateCollectionOptions(domain.CollectionOptions{}))
+
+	invalid := map[string]domain.CollectionOptions{
+		"missing index field": {Indexes: []domain.CollectionIndex{{}}},
+		"_id index":           {Indexes: []domain.CollectionIndex{{Field: "_id"}}},
+		"duplicate index":     {Indexes: []domain.CollectionIndex{{Field: "age"}, {Field: "age"}}},
+		"empty condition":     {Indexes: []domain.CollectionIndex{{Field: "age", Condition: map[string]interface{}{}}}},
+		"bad schema type":     {Schema: map[string]domain.FieldType{"at": "date"}},
+		"strict alone":        {StrictSchema: true},
+		"_id default":         {Defaults: domain.Document{"_id": "x"}},
+		"bad default filter":  {DefaultFilter: map[string]interface{}{"age": map[string]interface{}{"$contains": []interface{}{1}}}},
+		"bad cap":             {Capped: &domain.CappedConfig{MaxDocs: 10, Policy: "random"}},
+	}
+	for name, opts := range invalid {
+		assert.Error(t, ValidateCollectionOptions(opts), name)
+	}
+	assert.True(t, errors.Is(ValidateCollectionOptions(invalid["_id index"]), domain.ErrInvalidField))
+}
+
+func TestStorageEngine_CreateCollectionWithOptions(t *testing.T) {
+	engine := NewStorageEngine(WithNoSaves(true))
+	defer engine.StopBackgroundWorkers()
+
+	opts := domain.CollectionOptions{
+		Indexes: []domain.CollectionIndex{
+			{Field: "status"},
+			{Field: "total", Condition: map[string]interface{}{"status": "open"}},
+		},
+		Schema:        map[string]domain.FieldType{"status": domain.FieldTypeAny, "total": domain.FieldTypeAny, "deleted": domain.FieldTypeAny},
+		StrictSchema:  true,
+		Defaults:      domain.Document{"status": "open"},
+		DefaultFilter: map[string]interface{}{"deleted": map[string]interface{}{"$ne": true}},
+		Capped:        &domain.CappedConfig{MaxDocs: 2, Policy: domain.EvictFIFO},
+	}
+	require.NoError(t, engine.CreateCollectionWithOptions("orders", opts))
+
+	indexes, err := engine.GetIndexes("orders")
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"_id", "status", "total"}, indexes)
+	assert.True(t, engine.IsCollectionSchemaStrict("orders"))
+	assert.Equal(t, domain.Document{"status": "open"}, engine.GetCollectionDefaults("orders"))
+	assert.NotNil(t, engine.GetCollectionDefaultFilter("orders"))
+	assert.Equal(t, &domain.CappedConfig{MaxDocs: 2, Policy: domain.EvictFIFO}, engine.GetCollectionCapped("orders"))
+
+	// The settings govern the first writes
+	doc, err := engine.Insert("orders", domain.Document{"total": 5})
+	require.NoError(t, err)
+	assert.Equal(t, "open", doc["status"])
+	_, err = engine.Insert("orders", domain.Document{"note": "undeclared"})
+	assert.True(t, errors.Is(err, domain.ErrFieldNotInSchema))
+	docs, err := engine.FindByIndex("orders", "status", "open")
+	require.NoError(t, err)
+	assert.Len(t, docs, 1)
+
+	// An existing collection is never reconfigured
+	err = engine.CreateCollectionWithOptions("orders", domain.CollectionOptions{})
+	assert.True(t, errors.Is(err, domain.ErrCollectionExists))
+	assert.True(t, engine.IsCollectionSchemaStrict("orders"))
+
+	// Invalid options create nothing
+	err = engine.CreateCollectionWithOptions("broken", domain.CollectionOptions{
+		Defaults: domain.Document{"status": "open"},
+		Indexes:  []domain.CollectionIndex{{Field: ""}},
+	})
+	assert.True(t, errors.Is(err, domain.ErrInvalidField))
+	_, err = engine.GetCollection("broken")
+	assert.True(t, errors.Is(err, domain.ErrCollectionNotFound))
+	assert.Nil(t, engine.GetCollectionDefaults("broken"))
+}
+
+func TestStorageEngine_DiscardCollection(t *testing.T) {
+	engine := NewStorageEngine(WithNoSaves(true))
+	defer engine.StopBackgroundWorkers()
+
+	require.NoError(t, engine.CreateCollection("half"))
+	require.NoError(t, ConfigureCollection(engine, "half", domain.CollectionOptions{
+		Indexes:  []domain.CollectionIndex{{Field: "age"}},
+		Defaults: domain.Document{"age": 1},
+		Capped:   &domain.CappedConfig{MaxDocs: 5, Policy: domain.EvictLRU},
+	}))
+
+	engine.discardCollection("half")
+	_, err := engine.GetCollection("half")
+	assert.True(t, errors.Is(err, domain.ErrCollectionNotFound))
+	indexes, err := engine.GetIndexes("half")
+	require.NoError(t, err)
+	assert.Empty(t, indexes)
+	assert.Nil(t, engine.GetCollectionDefaults("half"))
+	assert.Nil(t, engine.GetCollectionCapped("half"))
+
+	// The name is free again
+	assert.NoError(t, engine.CreateCollectionWithOptions("half", domain.CollectionOptions{}))
+}
@@ -1,10 +1,16 @@
 package storage
 
 import (
+	"errors"
 	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"sync/atomic"
 	"time"
 
 	"github.com/adfharrison1/go-db/pkg/domain"
+	"github.com/adfharrison1/go-db/pkg/indexing"
 )
 
 // GetCollection loads a collection on-demand (lazy loading)
@@ -25,26 +31,17 @@ func (se *StorageEngine) getCollectionInternal(collName string) (*domain.Collect
 	collectionInfo, exists := se.collections[collName]
 
 	if !exists {
-		return nil, fmt.Errorf("collection %s does not exist", collName)
-	}
-
-	// Load collection from disk
-	var collection *domain.Collection
-	var err error
-
-	// Use single file approach if dataFile is set, otherwise use per-collection files
-	if se.dataFile != "" {
-		collection, err = se.loadCollectionFromSingleFile(collName, se.dataFile)
-	} else {
-		collection, err = se.loadCollectionFromDisk(collName)
+		return nil, domain.Errorf(domain.ErrCollectionNotFound, "collection %s does not exist", collName)
 	}
 
+	// Load collection from disk according to the storage layout
+	collection, err := se.loadCollection(collName)
 	if err != nil {
 		return nil, fmt.Errorf("failed to load collection %s: %w", collName, err)
 	}
 
 	// Add to cache
-	collectionInfo.State = CollectionStateLoaded
+	collectionInfo.setState(CollectionStateLoaded)
 	collectionInfo.LastAccessed = time.Now()
 	se.cache.Put(collName, collection, collectionInfo)
 
@@ -56,15 +53,19 @@ func (se *StorageEngine) CreateCollection(collName string) error {
 	se.mu.Lock()
 	defer se.mu.Unlock()
 
-	if collName == "" {
-		return fmt.Errorf("collection name cannot be empty")
+	if err := se.validateCollectionName(collName); err != nil {
+		return err
 	}
 
 	if _, exists := se.collections[collName]; exists {
-		return fmt.Errorf("collection %s already exists", collName)
+		return fmt.Errorf("%w: %s", domain.ErrCollectionExists, collName)
+	}
+
+	if err := CheckCollectionLimit(len(se.collections), se.maxCollections); err != nil {
+		return err
 	}
 
-	collection := domain.NewCollection(collName)
+	collection := se.newCollection(collName)
 	info := &CollectionInfo{
 		Name:          collName,
 		DocumentCount: 0,
@@ -80,3 +81,256 @@ func (se *StorageEngine) CreateCollection(collName string) error {
 
 	return nil
 }
+
+// CreateCollectionWithOptions creates an empty collection configured by opts: its
+// indexes, schema, defaults, default filter and cap. The options are validated before
+// the collection is created, and if configuring it still fails the collection is
+// removed again, so it never exists half-configured.
+func (se *StorageEngine) CreateCollectionWithOptions(collName string, opts domain.CollectionOptions) error {
+	if err := ValidateCollectionOptions(opts); err != nil {
+		return err
+	}
+	if err := se.CreateCollection(collName); err != nil {
+		return err
+	}
+	if err := ConfigureCollection(se, collName, opts); err != nil {
+		se.discardCollection(collName)
+		return fmt.Errorf("failed to configure collection %s: %w", collName, err)
+	}
+	return nil
+}
+
+// discardCollection removes a collection that CreateCollectionWithOptions could not
+// configure, along with its settings and indexes
+func (se *StorageEngine) discardCollection(collName string) {
+	ResetCollectionSettings(se, collName)
+
+	se.mu.Lock()
+	delete(se.collections, collName)
+	se.cache.Remove(collName)
+	se.mu.Unlock()
+
+	se.indexEngine.DropAllIndexes(collName)
+}
+
+// CopyCollection duplicates a collection under a new name: every document with the
+// same _id, the index definitions and the ID counter. The source is snapshotted under
+// its collection read lock and each document under its own read lock, so each
+// concurrent write is either fully in the copy or not at all. The copy is persisted
+// immediately unless no-saves mode is enabled.
+func (se *StorageEngine) CopyCollection(src, dst string) error {
+	if src == dst {
+		return fmt.Errorf("%w: %s", domain.ErrCollectionExists, dst)
+	}
+	if err := se.validateCollectionName(dst); err != nil {
+		return err
+	}
+
+	var copied *domain.Collection
+	var definitions []indexing.IndexDefinition
+	var counter int64
+	err := se.withCollectionReadLock(src, func() error {
+		collection, err := se.getCollectionInternal(src)
+		if err != nil {
+			return err
+		}
+
+		copied = se.newCollection(dst)
+		collection.Range(func(docID string, doc domain.Document) bool {
+			// Updates change a document in place holding only its lock
+			if lock := se.existingDocumentLock(src, docID); lock != nil {
+				lock.RLock()
+				defer lock.RUnlock()
+			}
+			copied.Set(docID, CopyDocument(doc))
+
+			// Never hand out an ID that is already taken in the copy
+			if id, err := strconv.ParseInt(docID, 10, 64); err == nil && id > counter {
+				counter = id
+			}
+			return true
+		})
+
+		definitions = se.indexEngine.ExportIndexDefinitions(src)
+
+		se.idCountersMu.RLock()
+		if srcCounter, exists := se.idCounters[src]; exists {
+			if value := atomic.LoadInt64(srcCounter); value > counter {
+				counter = value
+			}
+		}
+		se.idCountersMu.RUnlock()
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return se.withCollectionWriteLock(dst, func() error {
+		se.mu.Lock()
+		if _, exists := se.collections[dst]; exists {
+			se.mu.Unlock()
+			return fmt.Errorf("%w: %s", domain.ErrCollectionExists, dst)
+		}
+		if err := CheckCollectionLimit(len(se.collections), se.maxCollections); err != nil {
+			se.mu.Unlock()
+			return err
+		}
+		info := &CollectionInfo{
+			Name:          dst,
+			DocumentCount: int64(copied.Len()),
+			State:         CollectionStateDirty,
+			LastModified:  time.Now(),
+		}
+		se.collections[dst] = info
+		se.cache.Put(dst, copied, info)
+		se.mu.Unlock()
+
+		// Replicate index definitions, then fill them from the copied documents
+		se.indexEngine.ImportIndexDefinitions(dst, definitions, PartialIndexMatcher)
+		se.indexEngine.CreateIndex(dst, "_id")
+		se.indexEngine.RebuildIndexForCollection(dst, copied)
+
+		se.idCountersMu.Lock()
+		se.idCounters[dst] = &counter
+		se.idCountersMu.Unlock()
+
+		if se.noSaves {
+			return nil
+		}
+		if err := se.saveCollectionToFileUnsafe(dst); err != nil {
+			return fmt.Errorf("failed to save collection %s: %w", dst, err)
+		}
+		return nil
+	})
+}
+
+// DropCollection removes a collection with its documents, indexes, settings and ID
+// counter, and deletes it from disk so that a restart does not bring it back: its
+// file and delta log with the per-collection layout, and its documents in the data
+// file with the single-file layout or in a snapshot loaded by LoadCollectionMetadata.
+// Files are deleted in no-saves mode too. Buffered saves of the collection are
+// discarded, and saves still waiting for its delta lock fail with
+// ErrCollectionNotFound instead of writing the file again.
+func (se *StorageEngine) DropCollection(collName string) error {
+	err := se.withCollectionWriteLock(collName, func() error {
+		deltaLock := se.deltaLock(collName)
+		deltaLock.Lock()
+		defer deltaLock.Unlock()
+
+		se.mu.Lock()
+		if _, exists := se.collections[collName]; !exists {
+			se.mu.Unlock()
+			return domain.Errorf(domain.ErrCollectionNotFound, "collection %s does not exist", collName)
+		}
+		delete(se.collections, collName)
+		se.cache.Remove(collName)
+		se.mu.Unlock()
+
+		se.discardWriteBatch(collName)
+		se.indexEngine.DropCollection(collName)
+		se.idKeysets.Invalidate(collName)
+		se.insertionOrder.Invalidate(collName)
+
+		se.idCountersMu.Lock()
+		delete(se.idCounters, collName)
+		se.idCountersMu.Unlock()
+
+		se.compaction.mu.Lock()
+		delete(se.compaction.stats, collName)
+		se.compaction.mu.Unlock()
+
+		return se.removeCollectionFiles(collName)
+	})
+	if errors.Is(err, domain.ErrCollectionNotFound) {
+		return err
+	}
+
+	// Settings are reset once the collection is gone, as setting them takes its locks
+	ResetCollectionSettings(se, collName)
+	if err != nil {
+		return fmt.Errorf("collection %s dropped, but deleting it from disk failed: %w", collName, err)
+	}
+	return nil
+}
+
+// requireCollection returns ErrCollectionNotFound unless the collection exists. Saves
+// check again once they hold the collection's delta lock, since DropCollection may
+// have removed the collection while they waited for it.
+func (se *StorageEngine) requireCollection(collName string) error {
+	se.mu.RLock()
+	defer se.mu.RUnlock()
+	if _, exists := se.collections[collName]; !exists {
+		return domain.Errorf(domain.ErrCollectionNotFound, "collection %s does not exist", collName)
+	}
+	return nil
+}
+
+// removeCollectionFiles deletes a dropped collection's stored documents (caller must
+// hold the collection's delta lock)
+func (se *StorageEngine) removeCollectionFiles(collName string) error {
+	if se.layout == LayoutSingleFile {
+		return se.removeCollectionFromDataFile(se.singleFilePath(), collName)
+	}
+
+	if err := os.Remove(se.collectionFilePath(collName)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove collection file: %w", err)
+	}
+	se.clearDeltaLog(collName)
+	if se.dataFile != "" {
+		return se.removeCollectionFromDataFile(se.dataFile, collName)
+	}
+	return nil
+}
+
+// removeCollectionFromDataFile rewrites a multi-collection data file without a dropped
+// collection. A missing file, or one without the collection, is left as it is.
+func (se *StorageEngine) removeCollectionFromDataFile(filename, collName string) error {
+	se.singleFileMu.Lock()
+	defer se.singleFileMu.Unlock()
+
+	storageData, err := readStorageFile(filename)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read data file: %w", err)
+	}
+	if _, exists := storageData.Collections[collName]; !exists {
+		return nil
+	}
+
+	delete(storageData.Collections, collName)
+	se.setIndexDefinitions(storageData)
+	if _, err := se.writeStorageFile(filename, storageData); err != nil {
+		return fmt.Errorf("failed to rewrite data file: %w", err)
+	}
+	return nil
+}
+
+// ListCollections returns a summary of every collection, sorted by name. Collections
+// only known from metadata, and saved collections since evicted from the cache, are
+// reported as unloaded.
+func (se *StorageEngine) ListCollections() []domain.CollectionInfoSummary {
+	se.mu.RLock()
+	defer se.mu.RUnlock()
+
+	summaries := make([]domain.CollectionInfoSummary, 0, len(se.collections))
+	for name, info := range se.collections {
+		state := info.currentState()
+		if state == CollectionStateLoaded {
+			if _, cached := se.cache.Peek(name); !cached {
+				state = CollectionStateUnloaded
+			}
+		}
+		summaries = append(summaries, domain.CollectionInfoSummary{
+			Name:          name,
+			DocumentCount: info.DocumentCount,
+			State:         state.String(),
+			SizeOnDisk:    info.SizeOnDisk,
+		})
+	}
+
+	sort.Slice(summaries, func(i, j int) bool { return summaries[i].Name < summaries[j].Name })
+	return summaries
+}
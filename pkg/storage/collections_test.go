@@ -0,0 +1,288 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/adfharrison1/go-db/pkg/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStorageEngine_CopyCollection(t *testing.T) {
+	tempDir := t.TempDir()
+	engine := NewStorageEngine(WithDataDir(tempDir))
+	defer engine.StopBackgroundWorkers()
+
+	_, err := engine.Insert("users", domain.Document{"name": "Alice", "city": "Paris", "tags": []interface{}{"a"}})
+	require.NoError(t, err)
+	_, err = engine.Insert("users", domain.Document{"name": "Bob", "city": "Rome"})
+	require.NoError(t, err)
+	require.NoError(t, engine.CreateIndex("users", "city"))
+
+	require.NoError(t, engine.CopyCollection("users", "users_v2"))
+
+	t.Run("documents keep their ids", func(t *testing.T) {
+		doc, err := engine.GetById("users_v2", "1")
+		require.NoError(t, err)
+		assert.Equal(t, "Alice", doc["name"])
+
+		doc, err = engine.GetById("users_v2", "2")
+		require.NoError(t, err)
+		assert.Equal(t, "Bob", doc["name"])
+	})
+
+	t.Run("indexes are replicated", func(t *testing.T) {
+		indexes, err := engine.GetIndexes("users_v2")
+		require.NoError(t, err)
+		assert.ElementsMatch(t, []string{"_id", "city"}, indexes)
+
+		docs, err := engine.FindByIndex("users_v2", "city", "Rome")
+		require.NoError(t, err)
+		require.Len(t, docs, 1)
+		assert.Equal(t, "Bob", docs[0]["name"])
+	})
+
+	t.Run("id counter continues after the copied ids", func(t *testing.T) {
+		doc, err := engine.Insert("users_v2", domain.Document{"name": "Carol"})
+		require.NoError(t, err)
+		assert.Equal(t, "3", doc["_id"])
+	})
+
+	t.Run("copy is independent of the source", func(t *testing.T) {
+		_, err := engine.UpdateById("users", "1", domain.Document{"name": "Alicia"})
+		require.NoError(t, err)
+
+		doc, err := engine.GetById("users_v2", "1")
+		require.NoError(t, err)
+		assert.Equal(t, "Alice", doc["name"])
+		assert.Equal(t, []interface{}{"a"}, doc["tags"])
+	})
+
+	t.Run("copy is persisted", func(t *testing.T) {
+		assert.FileExists(t, filepath.Join(tempDir, "collections", "users_v2.godb"))
+	})
+
+	t.Run("destination must not exist", func(t *testing.T) {
+		err := engine.CopyCollection("users", "users_v2")
+		require.Error(t, err)
+		assert.True(t, errors.Is(err, domain.ErrCollectionExists))
+	})
+
+	t.Run("source must exist", func(t *testing.T) {
+		err := engine.CopyCollection("missing", "copy_of_missing")
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "does not exist")
+	})
+
+	t.Run("destination name is validated", func(t *testing.T) {
+		err := engine.CopyCollection("users", "bad/name")
+		require.Error(t, err)
+		assert.True(t, errors.Is(err, domain.ErrInvalidCollectionName))
+	})
+}
+
+func TestStorageEngine_CopyCollection_ConcurrentWrites(t *testing.T) {
+	engine := NewStorageEngine(WithDataDir(t.TempDir()), WithNoSaves(true))
+	defer engine.StopBackgroundWorkers()
+
+	for i := 0; i < 50; i++ {
+		_, err := engine.Insert("events", domain.Document{"n": i})
+		require.NoError(t, err)
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 200; i++ {
+			engine.Insert("events", domain.Document{"n": i})
+		}
+	}()
+
+	require.NoError(t, engine.CopyCollection("events", "events_copy"))
+	wg.Wait()
+
+	result, err := engine.FindAll("events_copy", nil, &domain.PaginationOptions{Limit: 1000})
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, len(result.Documents), 50)
+	for _, doc := range result.Documents {
+		assert.NotNil(t, doc["_id"])
+		assert.NotNil(t, doc["n"])
+	}
+}
+
+func TestStorageEngine_CopyCollection_ConcurrentUpdates(t *testing.T) {
+	engine := NewStorageEngine(WithDataDir(t.TempDir()))
+	defer engine.StopBackgroundWorkers()
+
+	for i := 0; i < 50; i++ {
+		_, err := engine.Insert("events", domain.Document{"n": 0})
+		require.NoError(t, err)
+	}
+
+	// Updates change the documents in place while they are copied
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 1; i <= 500; i++ {
+			_, err := engine.UpdateById("events", strconv.Itoa(i%50+1), domain.Document{"n": i})
+			assert.NoError(t, err)
+		}
+	}()
+
+	for i := 0; i < 5; i++ {
+		require.NoError(t, engine.CopyCollection("events", fmt.Sprintf("events_copy%d", i)))
+	}
+	wg.Wait()
+
+	result, err := engine.FindAll("events_copy4", nil, &domain.PaginationOptions{Limit: 100})
+	require.NoError(t, err)
+	assert.Len(t, result.Documents, 50)
+}
+
+func TestStorageEngine_DropCollection(t *testing.T) {
+	tempDir := t.TempDir()
+	engine := NewStorageEngine(WithDataDir(tempDir))
+	_, err := engine.Insert("users", domain.Document{"name": "Alice", "city": "Paris"})
+	require.NoError(t, err)
+	_, err = engine.Insert("users", domain.Document{"name": "Bob", "city": "Rome"})
+	require.NoError(t, err)
+	require.NoError(t, engine.CreateIndex("users", "city"))
+	engine.SetCollectionDefaults("users", domain.Document{"role": "member"})
+	_, err = engine.Insert("orders", domain.Document{"total": 5})
+	require.NoError(t, err)
+	require.FileExists(t, filepath.Join(tempDir, "collections", "users.godb"))
+
+	require.NoError(t, engine.DropCollection("users"))
+	assert.NoFileExists(t, filepath.Join(tempDir, "collections", "users.godb"))
+	_, err = engine.GetCollection("users")
+	assert.ErrorIs(t, err, domain.ErrCollectionNotFound)
+	indexes, err := engine.GetIndexes("users")
+	require.NoError(t, err)
+	assert.Empty(t, indexes)
+	assert.ErrorIs(t, engine.DropCollection("users"), domain.ErrCollectionNotFound)
+
+	// A collection created under the same name starts empty, without the old settings
+	doc, err := engine.Insert("users", domain.Document{"name": "Carol"})
+	require.NoError(t, err)
+	assert.Equal(t, "1", doc["_id"])
+	assert.NotContains(t, doc, "role")
+	indexes, err = engine.GetIndexes("users")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"_id"}, indexes)
+	require.NoError(t, engine.DropCollection("users"))
+	engine.StopBackgroundWorkers()
+
+	// A restart does not bring the collection back
+	restarted := NewStorageEngine(WithDataDir(tempDir))
+	defer restarted.StopBackgroundWorkers()
+	require.NoError(t, restarted.LoadCollectionMetadata(filepath.Join(tempDir, "missing.godb")))
+	_, err = restarted.GetCollection("users")
+	assert.ErrorIs(t, err, domain.ErrCollectionNotFound)
+	orders, err := restarted.GetCollection("orders")
+	require.NoError(t, err)
+	assert.Equal(t, 1, orders.Len())
+}
+
+func TestStorageEngine_DropCollection_DataFiles(t *testing.T) {
+	for _, layout := range []StorageLayout{LayoutPerCollection, LayoutSingleFile} {
+		t.Run(layout.String(), func(t *testing.T) {
+			tempDir := t.TempDir()
+			snapshot := filepath.Join(tempDir, "data.godb")
+			engine := NewStorageEngine(WithDataDir(tempDir), WithStorageLayout(layout))
+			for _, collName := range []string{"users", "orders"} {
+				_, err := engine.Insert(collName, domain.Document{"name": collName})
+				require.NoError(t, err)
+			}
+			require.NoError(t, engine.SaveToFile(snapshot))
+			engine.StopBackgroundWorkers()
+
+			// The dropped collection is removed from the snapshot the engine loaded too
+			engine = NewStorageEngine(WithDataDir(tempDir), WithStorageLayout(layout))
+			require.NoError(t, engine.LoadCollectionMetadata(snapshot))
+			require.NoError(t, engine.DropCollection("users"))
+			engine.StopBackgroundWorkers()
+
+			storageData, err := readStorageFile(snapshot)
+			require.NoError(t, err)
+			assert.NotContains(t, storageData.Collections, "users")
+			assert.Contains(t, storageData.Collections, "orders")
+
+			restarted := NewStorageEngine(WithDataDir(tempDir), WithStorageLayout(layout))
+			defer restarted.StopBackgroundWorkers()
+			require.NoError(t, restarted.LoadCollectionMetadata(snapshot))
+			_, err = restarted.GetCollection("users")
+			assert.ErrorIs(t, err, domain.ErrCollectionNotFound)
+			_, err = restarted.GetById("orders", "1")
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestStorageEngine_DropCollection_BufferedSaves(t *testing.T) {
+	tempDir := t.TempDir()
+	engine := NewStorageEngine(WithDataDir(tempDir), WithWriteCoalescing(time.Hour))
+	_, err := engine.Insert("events", domain.Document{"kind": "click"})
+	require.NoError(t, err)
+
+	// Saves buffered before the drop are discarded rather than written afterwards
+	require.NoError(t, engine.DropCollection("events"))
+	engine.StopBackgroundWorkers()
+	assert.NoFileExists(t, filepath.Join(tempDir, "collections", "events.godb"))
+}
+
+func TestStorageEngine_ListCollections(t *testing.T) {
+	tempDir := t.TempDir()
+	snapshot := filepath.Join(tempDir, "data.godb")
+	engine := NewStorageEngine(WithDataDir(tempDir))
+	for i := 0; i < 3; i++ {
+		_, err := engine.Insert("users", domain.Document{"n": i})
+		require.NoError(t, err)
+	}
+	_, err := engine.Insert("orders", domain.Document{"n": 1})
+	require.NoError(t, err)
+	require.NoError(t, engine.SaveToFile(snapshot))
+	engine.StopBackgroundWorkers()
+
+	// Collections known only from metadata are listed before they are loaded
+	engine = NewStorageEngine(WithDataDir(tempDir))
+	defer engine.StopBackgroundWorkers()
+	require.NoError(t, engine.LoadCollectionMetadata(snapshot))
+	require.NoError(t, engine.CreateCollection("archive"))
+
+	summaries := engine.ListCollections()
+	require.Len(t, summaries, 3)
+	assert.Equal(t, []string{"archive", "orders", "users"}, []string{summaries[0].Name, summaries[1].Name, summaries[2].Name})
+	assert.Equal(t, "loaded", summaries[0].State)
+	assert.Zero(t, summaries[0].DocumentCount)
+	assert.Equal(t, "unloaded", summaries[2].State)
+	assert.EqualValues(t, 3, summaries[2].DocumentCount)
+	assert.Positive(t, summaries[2].SizeOnDisk)
+
+	_, err = engine.GetCollection("users")
+	require.NoError(t, err)
+	assert.Equal(t, "loaded", engine.ListCollections()[2].State)
+}
+
+func TestCollectionInfo_MarkSaved(t *testing.T) {
+	info := &CollectionInfo{Name: "users", State: CollectionStateLoaded}
+
+	info.markDirty()
+	gen := info.dirtyGeneration()
+	dirtySince := info.dirtySince()
+	// A change marked while the save runs keeps the collection dirty
+	info.markDirty()
+	info.markSaved(gen)
+	assert.Equal(t, CollectionStateDirty, info.currentState())
+	assert.Equal(t, dirtySince, info.dirtySince())
+
+	info.markSaved(info.dirtyGeneration())
+	assert.Equal(t, CollectionStateLoaded, info.currentState())
+}
@@ -0,0 +1,75 @@
+package storage
+
+import (
+	"github.com/adfharrison1/go-db/pkg/domain"
+)
+
+// SetCollectionCompact sets whether a collection keeps its documents in memory in
+// the compact encoding of CompactStore rather than as maps. Documents already in
+// memory are converted at once, under the collection write lock; a collection loaded
+// from disk later is decoded straight into the chosen form. Callers see Documents
+// either way. The setting is kept in memory only, like the other collection settings.
+func (se *StorageEngine) SetCollectionCompact(collName string, compact bool) error {
+	return se.withCollectionWriteLock(collName, func() error {
+		se.compactMu.Lock()
+		if compact {
+			se.compact[collName] = true
+		} else {
+			delete(se.compact, collName)
+		}
+		se.compactMu.Unlock()
+
+		if collection, loaded := se.cache.Peek(collName); loaded {
+			convertCollectionStore(collection, compact)
+		}
+		return nil
+	})
+}
+
+// IsCollectionCompact reports whether a collection keeps its documents compactly encoded
+func (se *StorageEngine) IsCollectionCompact(collName string) bool {
+	se.compactMu.RLock()
+	defer se.compactMu.RUnlock()
+	return se.compact[collName]
+}
+
+// newCollection creates an empty collection stored the way its settings ask, for
+// the engine's own use in place of domain.NewCollection
+func (se *StorageEngine) newCollection(collName string) *domain.Collection {
+	collection := domain.NewCollection(collName)
+	if se.IsCollectionCompact(collName) {
+		collection.Documents = nil
+		collection.Store = NewCompactStore()
+	}
+	return collection
+}
+
+// convertCollectionStore moves a collection's documents between the Documents map
+// and a compact store, removing each from the old form as it is added to the new one
+// so both are never held in full (caller must hold collection write lock)
+func convertCollectionStore(collection *domain.Collection, compact bool) {
+	if compact == (collection.Store != nil) {
+		return
+	}
+
+	if compact {
+		store := NewCompactStore()
+		for docID, doc := range collection.Documents {
+			store.Set(docID, doc)
+			delete(collection.Documents, docID)
+		}
+		collection.Documents = nil
+		collection.Store = store
+		return
+	}
+
+	store := collection.Store
+	docs := make(map[string]domain.Document, store.Len())
+	store.Range(func(docID string, doc domain.Document) bool {
+		docs[docID] = doc
+		store.Delete(docID)
+		return true
+	})
+	collection.Documents = docs
+	collection.Store = nil
+}
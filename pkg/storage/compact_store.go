@@ -0,0 +1,397 @@
+package storage
+
+import (
+	"encoding/binary"
+	"math"
+	"sync"
+
+	"github.com/adfharrison1/go-db/pkg/domain"
+)
+
+// Value tags of the compact document encoding
+const (
+	compactNull byte = iota
+	compactFalse
+	compactTrue
+	compactWholeFloat // float64 holding an integer, as a zigzag varint
+	compactFloat      // Any other float64, as its 8 IEEE 754 bytes
+	compactInt        // int, as a zigzag varint
+	compactInt64      // int64, as a zigzag varint
+	compactString     // Length, then bytes
+	compactObject     // map[string]interface{}: field count, then field name ID and value pairs
+	compactDocument   // domain.Document, like compactObject
+	compactArray      // []interface{}: length, then values
+)
+
+// compactIDElided is set in an encoded document's header byte when its _id field was
+// left out because it equals the key the document is stored under
+const compactIDElided byte = 1
+
+// maxWholeFloat bounds the float64 values stored as varints, which must convert to
+// int64 and back without loss
+const maxWholeFloat = 1 << 53
+
+// CompactStore is a domain.DocumentStore keeping each document as a flat binary
+// encoding instead of a map, trading a decode on every read for a fraction of the
+// memory: field names are interned in a dictionary shared by the collection, numbers
+// that are whole are stored as varints and there is no per-document map overhead.
+// Documents holding values the encoding does not cover (anything other than nil,
+// bool, float64, int, int64, string, objects and []interface{}) are kept as they are.
+//
+// Writers in dual-write mode hold only document locks, so the store has its own lock.
+// Range and RangeIDs work on a snapshot of the IDs and encodings, taken under it.
+type CompactStore struct {
+	dict  fieldDictionary
+	mu    sync.RWMutex
+	docs  map[string]string // Document ID -> encoding; a string has a smaller header than a []byte
+	plain map[string]domain.Document
+}
+
+// NewCompactStore creates an empty compact store
+func NewCompactStore() *CompactStore {
+	return &CompactStore{
+		dict:  fieldDictionary{ids: make(map[string]uint64)},
+		docs:  make(map[string]string),
+		plain: make(map[string]domain.Document),
+	}
+}
+
+// fieldDictionary numbers the field names of a compact store
+type fieldDictionary struct {
+	mu    sync.RWMutex
+	names []string
+	ids   map[string]uint64
+}
+
+// id returns the number of a field name, adding the name if it is new
+func (d *fieldDictionary) id(name string) uint64 {
+	d.mu.RLock()
+	id, exists := d.ids[name]
+	d.mu.RUnlock()
+	if exists {
+		return id
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if id, exists := d.ids[name]; exists {
+		return id
+	}
+	id = uint64(len(d.names))
+	d.names = append(d.names, name)
+	d.ids[name] = id
+	return id
+}
+
+// snapshot returns the field names known so far for decoding; names are only ever
+// appended, so the slice stays valid
+func (d *fieldDictionary) snapshot() []string {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.names
+}
+
+// compactBuffers holds scratch space for encoding, as Set may run concurrently
+var compactBuffers = sync.Pool{New: func() interface{} { return new([]byte) }}
+
+// Get implements domain.DocumentStore
+func (cs *CompactStore) Get(id string) (domain.Document, bool) {
+	cs.mu.RLock()
+	encoded, exists := cs.docs[id]
+	doc, plain := cs.plain[id]
+	cs.mu.RUnlock()
+
+	if exists {
+		return cs.decode(id, encoded), true
+	}
+	return doc, plain
+}
+
+// Has implements domain.DocumentStore
+func (cs *CompactStore) Has(id string) bool {
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+	if _, exists := cs.docs[id]; exists {
+		return true
+	}
+	_, exists := cs.plain[id]
+	return exists
+}
+
+// Set implements domain.DocumentStore
+func (cs *CompactStore) Set(id string, doc domain.Document) {
+	bufPtr := compactBuffers.Get().(*[]byte)
+	defer compactBuffers.Put(bufPtr)
+	encoded, ok := cs.encode(id, doc, (*bufPtr)[:0])
+
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	if !ok {
+		delete(cs.docs, id)
+		cs.plain[id] = doc
+		return
+	}
+	*bufPtr = encoded
+	delete(cs.plain, id)
+	cs.docs[id] = string(encoded)
+}
+
+// Delete implements domain.DocumentStore
+func (cs *CompactStore) Delete(id string) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	delete(cs.docs, id)
+	delete(cs.plain, id)
+}
+
+// Len implements domain.DocumentStore
+func (cs *CompactStore) Len() int {
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+	return len(cs.docs) + len(cs.plain)
+}
+
+// compactEntry is a stored document taken into a Range snapshot
+type compactEntry struct {
+	id      string
+	encoded string
+	doc     domain.Document // Set instead of encoded for a document kept as it is
+}
+
+// Range implements domain.DocumentStore. Documents are decoded one at a time as fn
+// is called; the snapshot holds only their IDs and encodings.
+func (cs *CompactStore) Range(fn func(id string, doc domain.Document) bool) {
+	cs.mu.RLock()
+	entries := make([]compactEntry, 0, len(cs.docs)+len(cs.plain))
+	for id, encoded := range cs.docs {
+		entries = append(entries, compactEntry{id: id, encoded: encoded})
+	}
+	for id, doc := range cs.plain {
+		entries = append(entries, compactEntry{id: id, doc: doc})
+	}
+	cs.mu.RUnlock()
+
+	for _, entry := range entries {
+		doc := entry.doc
+		if doc == nil {
+			doc = cs.decode(entry.id, entry.encoded)
+		}
+		if !fn(entry.id, doc) {
+			return
+		}
+	}
+}
+
+// RangeIDs implements domain.DocumentStore
+func (cs *CompactStore) RangeIDs(fn func(id string) bool) {
+	cs.mu.RLock()
+	ids := make([]string, 0, len(cs.docs)+len(cs.plain))
+	for id := range cs.docs {
+		ids = append(ids, id)
+	}
+	for id := range cs.plain {
+		ids = append(ids, id)
+	}
+	cs.mu.RUnlock()
+
+	for _, id := range ids {
+		if !fn(id) {
+			return
+		}
+	}
+}
+
+// Size implements domain.DocumentStore, counting each encoding and its map entry. The
+// shared field dictionary is left out, as it does not grow with the documents.
+func (cs *CompactStore) Size() int64 {
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+	var size int64
+	for _, encoded := range cs.docs {
+		size += mapEntryOverhead + int64(len(encoded))
+	}
+	for _, doc := range cs.plain {
+		size += EstimateDocumentSize(doc)
+	}
+	return size
+}
+
+// encode appends the encoding of doc to buf, reporting false if doc holds a value
+// the encoding does not cover
+func (cs *CompactStore) encode(id string, doc domain.Document, buf []byte) ([]byte, bool) {
+	var header byte
+	fields := len(doc)
+	if docID, ok := doc["_id"].(string); ok && docID == id {
+		header |= compactIDElided
+		fields--
+	}
+	buf = append(buf, header)
+	buf = binary.AppendUvarint(buf, uint64(fields))
+	for key, value := range doc {
+		if key == "_id" && header&compactIDElided != 0 {
+			continue
+		}
+		buf = binary.AppendUvarint(buf, cs.dict.id(key))
+		var ok bool
+		if buf, ok = cs.encodeValue(value, buf); !ok {
+			return nil, false
+		}
+	}
+	return buf, true
+}
+
+func (cs *CompactStore) encodeValue(value interface{}, buf []byte) ([]byte, bool) {
+	switch v := value.(type) {
+	case nil:
+		return append(buf, compactNull), true
+	case bool:
+		if v {
+			return append(buf, compactTrue), true
+		}
+		return append(buf, compactFalse), true
+	case float64:
+		if v == math.Trunc(v) && math.Abs(v) <= maxWholeFloat && !(v == 0 && math.Signbit(v)) {
+			buf = append(buf, compactWholeFloat)
+			return binary.AppendVarint(buf, int64(v)), true
+		}
+		buf = append(buf, compactFloat)
+		return binary.LittleEndian.AppendUint64(buf, math.Float64bits(v)), true
+	case int:
+		buf = append(buf, compactInt)
+		return binary.AppendVarint(buf, int64(v)), true
+	case int64:
+		buf = append(buf, compactInt64)
+		return binary.AppendVarint(buf, v), true
+	case string:
+		buf = append(buf, compactString)
+		buf = binary.AppendUvarint(buf, uint64(len(v)))
+		return append(buf, v...), true
+	case map[string]interface{}:
+		return cs.encodeObject(compactObject, v, buf)
+	case domain.Document:
+		return cs.encodeObject(compactDocument, v, buf)
+	case []interface{}:
+		buf = append(buf, compactArray)
+		buf = binary.AppendUvarint(buf, uint64(len(v)))
+		for _, element := range v {
+			var ok bool
+			if buf, ok = cs.encodeValue(element, buf); !ok {
+				return nil, false
+			}
+		}
+		return buf, true
+	default:
+		return nil, false
+	}
+}
+
+func (cs *CompactStore) encodeObject(tag byte, object map[string]interface{}, buf []byte) ([]byte, bool) {
+	buf = append(buf, tag)
+	buf = binary.AppendUvarint(buf, uint64(len(object)))
+	for key, value := range object {
+		buf = binary.AppendUvarint(buf, cs.dict.id(key))
+		var ok bool
+		if buf, ok = cs.encodeValue(value, buf); !ok {
+			return nil, false
+		}
+	}
+	return buf, true
+}
+
+// compactDecoder reads one encoded document
+type compactDecoder struct {
+	data  string
+	pos   int
+	names []string
+}
+
+// decode rebuilds a document stored under id. The encoding was written by this
+// store, so it is not checked for corruption.
+func (cs *CompactStore) decode(id, encoded string) domain.Document {
+	d := compactDecoder{data: encoded, names: cs.dict.snapshot()}
+	header := d.data[0]
+	d.pos = 1
+	fields := int(d.uvarint())
+
+	doc := make(domain.Document, fields+int(header&compactIDElided))
+	if header&compactIDElided != 0 {
+		doc["_id"] = id
+	}
+	for i := 0; i < fields; i++ {
+		key := d.names[d.uvarint()]
+		doc[key] = d.value()
+	}
+	return doc
+}
+
+func (d *compactDecoder) uvarint() uint64 {
+	var value uint64
+	var shift uint
+	for {
+		b := d.data[d.pos]
+		d.pos++
+		value |= uint64(b&0x7f) << shift
+		if b < 0x80 {
+			return value
+		}
+		shift += 7
+	}
+}
+
+func (d *compactDecoder) varint() int64 {
+	u := d.uvarint()
+	value := int64(u >> 1)
+	if u&1 != 0 {
+		value = ^value
+	}
+	return value
+}
+
+func (d *compactDecoder) value() interface{} {
+	tag := d.data[d.pos]
+	d.pos++
+	switch tag {
+	case compactFalse:
+		return false
+	case compactTrue:
+		return true
+	case compactWholeFloat:
+		return float64(d.varint())
+	case compactFloat:
+		var bits uint64
+		for i := 0; i < 8; i++ {
+			bits |= uint64(d.data[d.pos+i]) << (8 * i)
+		}
+		d.pos += 8
+		return math.Float64frombits(bits)
+	case compactInt:
+		return int(d.varint())
+	case compactInt64:
+		return d.varint()
+	case compactString:
+		length := int(d.uvarint())
+		s := d.data[d.pos : d.pos+length]
+		d.pos += length
+		return s
+	case compactObject, compactDocument:
+		fields := int(d.uvarint())
+		object := make(map[string]interface{}, fields)
+		for i := 0; i < fields; i++ {
+			key := d.names[d.uvarint()]
+			object[key] = d.value()
+		}
+		if tag == compactDocument {
+			return domain.Document(object)
+		}
+		return object
+	case compactArray:
+		length := int(d.uvarint())
+		array := make([]interface{}, length)
+		for i := range array {
+			array[i] = d.value()
+		}
+		return array
+	default:
+		return nil
+	}
+}
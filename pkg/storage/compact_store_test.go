@@ -0,0 +1,157 @@
+package storage
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/adfharrison1/go-db/pkg/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompactStore_RoundTrip(t *testing.T) {
+	store := NewCompactStore()
+	doc := domain.Document{
+		"_id":      "7",
+		"nothing":  nil,
+		"yes":      true,
+		"no":       false,
+		"count":    float64(42),
+		"negative": float64(-3),
+		"zero":     math.Copysign(0, -1),
+		"ratio":    2.5,
+		"huge":     1e300,
+		"int":      7,
+		"int64":    int64(-1) << 40,
+		"name":     "Zoë",
+		"empty":    "",
+		"address":  map[string]interface{}{"city": "Leeds", "zip": 1.5},
+		"nested":   domain.Document{"a": []interface{}{}},
+		"tags":     []interface{}{"go", float64(1), nil, map[string]interface{}{"name": "x"}},
+	}
+	store.Set("7", doc)
+
+	got, exists := store.Get("7")
+	require.True(t, exists)
+	assert.Equal(t, doc, got)
+	assert.IsType(t, float64(0), got["count"], "whole floats stay floats")
+	assert.IsType(t, 0, got["int"])
+	assert.True(t, math.Signbit(got["zero"].(float64)), "negative zero is kept")
+	assert.IsType(t, domain.Document{}, got["nested"])
+
+	// Changing a returned document does not change the stored one
+	got["name"] = "Mallory"
+	got["address"].(map[string]interface{})["city"] = "Nowhere"
+	again, _ := store.Get("7")
+	assert.Equal(t, "Zoë", again["name"])
+	assert.Equal(t, "Leeds", again["address"].(map[string]interface{})["city"])
+
+	// _id is only left out of the encoding when it equals the key
+	for id, stored := range map[string]domain.Document{
+		"a": {"_id": "b", "n": float64(1)},
+		"c": {"_id": float64(3)},
+		"d": {"n": float64(4)},
+	} {
+		store.Set(id, stored)
+		got, _ := store.Get(id)
+		assert.Equal(t, stored, got, id)
+	}
+}
+
+func TestCompactStore_UnsupportedValues(t *testing.T) {
+	store := NewCompactStore()
+	when := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	doc := domain.Document{"_id": "1", "labels": []string{"a"}, "at": when}
+	store.Set("1", doc)
+
+	// Documents the encoding does not cover are kept as they are
+	got, exists := store.Get("1")
+	require.True(t, exists)
+	assert.Equal(t, []string{"a"}, got["labels"])
+	assert.Equal(t, when, got["at"])
+
+	// Storing an encodable version moves the document back to the encoding
+	store.Set("1", domain.Document{"_id": "1", "labels": []interface{}{"a"}})
+	assert.Empty(t, store.plain)
+	assert.Equal(t, 1, store.Len())
+}
+
+func TestCompactStore_Operations(t *testing.T) {
+	store := NewCompactStore()
+	for i := 0; i < 10; i++ {
+		id := fmt.Sprintf("%d", i)
+		store.Set(id, domain.Document{"_id": id, "n": float64(i)})
+	}
+	store.Set("plain", domain.Document{"_id": "plain", "at": time.Now()})
+	assert.Equal(t, 11, store.Len())
+	assert.True(t, store.Has("3"))
+	assert.True(t, store.Has("plain"))
+	assert.False(t, store.Has("99"))
+
+	// Range works on a snapshot, so fn may delete what it is given
+	seen := 0
+	store.Range(func(id string, doc domain.Document) bool {
+		assert.Equal(t, id, doc["_id"])
+		seen++
+		store.Delete(id)
+		return true
+	})
+	assert.Equal(t, 11, seen)
+	assert.Equal(t, 0, store.Len())
+	_, exists := store.Get("3")
+	assert.False(t, exists)
+
+	store.Set("1", domain.Document{"_id": "1"})
+	store.Set("2", domain.Document{"_id": "2"})
+	ids := 0
+	store.RangeIDs(func(string) bool {
+		ids++
+		return false
+	})
+	assert.Equal(t, 1, ids, "returning false stops the range")
+}
+
+func TestCompactStore_Size(t *testing.T) {
+	store := NewCompactStore()
+	var estimated int64
+	for i := 0; i < 100; i++ {
+		id := fmt.Sprintf("%d", i)
+		doc := domain.Document{"_id": id, "user": fmt.Sprintf("user-%d", i%10), "kind": "click", "value": float64(i)}
+		estimated += EstimateDocumentSize(doc)
+		store.Set(id, doc)
+	}
+	assert.Less(t, store.Size(), estimated/3, "the encoding is a fraction of the map estimate")
+}
+
+func TestCompactStore_ConcurrentWrites(t *testing.T) {
+	store := NewCompactStore()
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 200; i++ {
+				id := fmt.Sprintf("%d-%d", w, i)
+				// New field names per writer grow the shared dictionary concurrently
+				store.Set(id, domain.Document{"_id": id, fmt.Sprintf("field%d", i%7+w*7): float64(i)})
+				store.Get(id)
+			}
+		}(w)
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 20; i++ {
+			store.Range(func(string, domain.Document) bool { return true })
+		}
+	}()
+	wg.Wait()
+	assert.Equal(t, 800, store.Len())
+
+	doc, exists := store.Get("3-10")
+	require.True(t, exists)
+	assert.Equal(t, float64(10), doc["field24"])
+}
@@ -0,0 +1,168 @@
+package storage
+
+import (
+	"fmt"
+	"runtime"
+	"testing"
+
+	"github.com/adfharrison1/go-db/pkg/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func cachedCollection(t *testing.T, engine *StorageEngine, collName string) *domain.Collection {
+	t.Helper()
+	collection, _, found := engine.cache.Get(collName)
+	require.True(t, found)
+	return collection
+}
+
+func TestStorageEngine_CompactCollection(t *testing.T) {
+	engine := NewStorageEngine(WithNoSaves(true))
+	defer engine.StopBackgroundWorkers()
+
+	for _, name := range []string{"Alice", "Bob", "Carol"} {
+		_, err := engine.Insert("users", domain.Document{"name": name, "address": map[string]interface{}{"city": "Leeds"}})
+		require.NoError(t, err)
+	}
+	require.NoError(t, engine.CreateIndex("users", "name"))
+
+	// Existing documents are converted at once
+	require.NoError(t, engine.SetCollectionCompact("users", true))
+	assert.True(t, engine.IsCollectionCompact("users"))
+	collection := cachedCollection(t, engine, "users")
+	require.NotNil(t, collection.Store)
+	assert.Nil(t, collection.Documents)
+	assert.Equal(t, 3, collection.Len())
+
+	doc, err := engine.GetById("users", "2")
+	require.NoError(t, err)
+	assert.Equal(t, "Bob", doc["name"])
+	doc["address"].(map[string]interface{})["city"] = "Nowhere"
+	stored, _ := collection.Get("2")
+	assert.Equal(t, "Leeds", stored["address"].(map[string]interface{})["city"], "reads return copies")
+
+	// Writes go through the store, and indexes follow them
+	_, err = engine.Insert("users", domain.Document{"name": "Dave"})
+	require.NoError(t, err)
+	_, err = engine.UpdateById("users", "1", domain.Document{"name": "Alicia"})
+	require.NoError(t, err)
+	_, err = engine.ReplaceById("users", "3", domain.Document{"name": "Caz"})
+	require.NoError(t, err)
+	require.NoError(t, engine.DeleteById("users", "2"))
+
+	updated, err := engine.GetById("users", "1")
+	require.NoError(t, err)
+	assert.Equal(t, "Alicia", updated["name"])
+	assert.Equal(t, "Leeds", updated["address"].(map[string]interface{})["city"])
+
+	result, err := engine.FindAll("users", map[string]interface{}{"name": "Caz"}, nil)
+	require.NoError(t, err)
+	require.Len(t, result.Documents, 1)
+	assert.Equal(t, "3", result.Documents[0]["_id"])
+
+	all, err := engine.FindAll("users", nil, nil)
+	require.NoError(t, err)
+	assert.Len(t, all.Documents, 3)
+
+	usage := engine.CollectionMemoryUsage()
+	require.Len(t, usage, 1)
+	assert.True(t, usage[0].Compact)
+	assert.Equal(t, int64(3), usage[0].Documents)
+	assert.Positive(t, usage[0].EstimatedBytes)
+
+	// Turning it off decodes the documents back into maps
+	require.NoError(t, engine.SetCollectionCompact("users", false))
+	assert.Nil(t, collection.Store)
+	assert.Len(t, collection.Documents, 3)
+	assert.Equal(t, "Alicia", collection.Documents["1"]["name"])
+}
+
+func TestStorageEngine_CompactCollectionLoadedFromDisk(t *testing.T) {
+	tempDir := t.TempDir()
+	engine := NewStorageEngine(WithDataDir(tempDir))
+	require.NoError(t, engine.CreateCollection("events"))
+	for i := 0; i < 5; i++ {
+		_, err := engine.Insert("events", domain.Document{"n": i})
+		require.NoError(t, err)
+	}
+	engine.StopBackgroundWorkers()
+
+	// A collection marked compact before it is loaded is decoded straight into a store
+	reloaded := NewStorageEngine(WithDataDir(tempDir))
+	defer reloaded.StopBackgroundWorkers()
+	require.NoError(t, reloaded.SetCollectionCompact("events", true))
+	reloaded.mu.Lock()
+	reloaded.collections["events"] = &CollectionInfo{Name: "events", State: CollectionStateUnloaded}
+	reloaded.mu.Unlock()
+
+	collection, err := reloaded.GetCollection("events")
+	require.NoError(t, err)
+	require.NotNil(t, collection.Store)
+	assert.Equal(t, 5, collection.Len())
+
+	doc, err := reloaded.Insert("events", domain.Document{"n": 5})
+	require.NoError(t, err)
+	assert.Equal(t, "6", doc["_id"], "the ID counter is restored as usual")
+
+	onDisk, err := reloaded.loadCollectionFromDisk("events")
+	require.NoError(t, err)
+	assert.Equal(t, 6, onDisk.Len(), "compact collections are saved like any other")
+}
+
+func TestStorageEngine_CompactCollectionOptions(t *testing.T) {
+	engine := NewStorageEngine(WithNoSaves(true))
+	defer engine.StopBackgroundWorkers()
+
+	require.NoError(t, engine.CreateCollectionWithOptions("events", domain.CollectionOptions{Compact: true}))
+	assert.True(t, engine.IsCollectionCompact("events"))
+	assert.NotNil(t, cachedCollection(t, engine, "events").Store)
+
+	_, err := engine.Insert("events", domain.Document{"kind": "click"})
+	require.NoError(t, err)
+	ids, err := engine.FindIds("events", map[string]interface{}{"kind": "click"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"1"}, ids)
+}
+
+// BenchmarkCompactMemory compares the heap held by a collection of a million small
+// documents kept as maps and compactly encoded. bytes/doc counts everything the engine
+// holds per document, including the _id index. Run with -benchtime=1x.
+func BenchmarkCompactMemory(b *testing.B) {
+	const docs = 1_000_000
+
+	heapInUse := func() uint64 {
+		runtime.GC()
+		var stats runtime.MemStats
+		runtime.ReadMemStats(&stats)
+		return stats.HeapAlloc
+	}
+
+	run := func(b *testing.B, compact bool) {
+		for i := 0; i < b.N; i++ {
+			b.StopTimer()
+			before := heapInUse()
+			b.StartTimer()
+
+			engine := NewStorageEngine(WithNoSaves(true))
+			require.NoError(b, engine.CreateCollectionWithOptions("events", domain.CollectionOptions{Compact: compact}))
+			for n := 0; n < docs; n++ {
+				_, err := engine.Insert("events", domain.Document{
+					"user":  fmt.Sprintf("user-%d", n%1000),
+					"kind":  "click",
+					"value": float64(n % 500),
+				})
+				require.NoError(b, err)
+			}
+
+			b.StopTimer()
+			b.ReportMetric(float64(heapInUse()-before)/docs, "bytes/doc")
+			runtime.KeepAlive(engine)
+			engine.StopBackgroundWorkers()
+			b.StartTimer()
+		}
+	}
+
+	b.Run("Maps", func(b *testing.B) { run(b, false) })
+	b.Run("Compact", func(b *testing.B) { run(b, true) })
+}
@@ -0,0 +1,198 @@
+package storage
+
+import (
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/adfharrison1/go-db/pkg/domain"
+)
+
+const (
+	// DefaultCompactionRatio is how many times larger than its live data a
+	// collection's files may grow before they are compacted
+	DefaultCompactionRatio = 2.0
+
+	// DefaultCompactionMinBytes is the on-disk size below which collections are never
+	// compacted, so small collections are not rewritten for a few bytes of overhead
+	DefaultCompactionMinBytes = 64 * 1024
+)
+
+// CompactionStats records the compactions of one collection
+type CompactionStats struct {
+	LastCompaction time.Time `json:"last_compaction"`
+	Compactions    int64     `json:"compactions"`
+	BytesReclaimed int64     `json:"bytes_reclaimed"`
+}
+
+// compactionState holds the compaction worker's settings and per-collection stats
+type compactionState struct {
+	interval time.Duration
+	ratio    float64
+	minBytes int64
+
+	mu    sync.Mutex
+	runs  int64
+	stats map[string]*CompactionStats
+}
+
+// compactionEnabled reports whether the compaction worker runs: it needs an interval,
+// the per-collection layout and saves
+func (se *StorageEngine) compactionEnabled() bool {
+	return se.compaction.interval > 0 && se.layout == LayoutPerCollection && !se.noSaves
+}
+
+// collectionDiskSize returns the bytes a collection occupies on disk: its base file
+// and any delta log. Missing files count as empty.
+func (se *StorageEngine) collectionDiskSize(collName string) int64 {
+	var size int64
+	for _, path := range []string{se.collectionFilePath(collName), se.deltaFilePath(collName)} {
+		if info, err := os.Stat(path); err == nil {
+			size += info.Size()
+		}
+	}
+	return size
+}
+
+// compactCollection rewrites a collection's file from its cached documents if its
+// files exceed the live data estimate by the configured ratio, and reports the bytes
+// reclaimed. Collections that are locked, being saved or waiting to be saved are left
+// to the save path, which rewrites the file anyway; the next pass looks at them again.
+func (se *StorageEngine) compactCollection(collName string) (int64, bool, error) {
+	lock := se.getOrCreateCollectionLock(collName)
+	if !lock.counters.TryLock(&lock.mu) {
+		return 0, false, nil
+	}
+	defer lock.counters.Unlock(&lock.mu)
+
+	if lock.saving {
+		return 0, false, nil
+	}
+	collection, found := se.cache.Peek(collName)
+	if !found {
+		return 0, false, nil
+	}
+	se.mu.RLock()
+	info, exists := se.collections[collName]
+	se.mu.RUnlock()
+	if !exists || info.currentState() == CollectionStateDirty {
+		return 0, false, nil
+	}
+
+	before := se.collectionDiskSize(collName)
+	if before < se.compaction.minBytes {
+		return 0, false, nil
+	}
+	var live int64
+	collection.Range(func(_ string, doc domain.Document) bool {
+		live += EstimateDocumentSize(doc)
+		return true
+	})
+	if float64(before) <= se.compaction.ratio*float64(live) {
+		return 0, false, nil
+	}
+
+	info.markDirty()
+	if err := se.saveCollectionToFileUnsafe(collName); err != nil {
+		return 0, false, err
+	}
+
+	reclaimed := before - se.collectionDiskSize(collName)
+	if reclaimed < 0 {
+		reclaimed = 0
+	}
+	se.recordCompaction(collName, reclaimed)
+	log.Printf("INFO: Compacted collection %s (%d bytes on disk, ~%d live, %d reclaimed)", collName, before, live, reclaimed)
+	return reclaimed, true, nil
+}
+
+// compactCollections checks every cached collection and compacts those that are bloated.
+// Collections not in the cache are skipped, as they would have to be loaded first.
+func (se *StorageEngine) compactCollections() {
+	se.mu.RLock()
+	names := make([]string, 0, len(se.collections))
+	for name := range se.collections {
+		names = append(names, name)
+	}
+	se.mu.RUnlock()
+
+	for _, name := range names {
+		if _, _, err := se.compactCollection(name); err != nil {
+			log.Printf("WARN: Failed to compact collection %s: %v", name, err)
+		}
+	}
+
+	se.compaction.mu.Lock()
+	se.compaction.runs++
+	se.compaction.mu.Unlock()
+}
+
+// recordCompaction adds a compaction to a collection's stats
+func (se *StorageEngine) recordCompaction(collName string, reclaimed int64) {
+	se.compaction.mu.Lock()
+	defer se.compaction.mu.Unlock()
+
+	stats, exists := se.compaction.stats[collName]
+	if !exists {
+		stats = &CompactionStats{}
+		se.compaction.stats[collName] = stats
+	}
+	stats.LastCompaction = time.Now()
+	stats.Compactions++
+	stats.BytesReclaimed += reclaimed
+}
+
+// CompactionStats returns a copy of the compaction stats of each collection compacted so far
+func (se *StorageEngine) CompactionStats() map[string]CompactionStats {
+	se.compaction.mu.Lock()
+	defer se.compaction.mu.Unlock()
+
+	stats := make(map[string]CompactionStats, len(se.compaction.stats))
+	for name, collStats := range se.compaction.stats {
+		stats[name] = *collStats
+	}
+	return stats
+}
+
+// getCompactionStats returns the compaction worker's settings and activity for GetMemoryStats
+func (se *StorageEngine) getCompactionStats() map[string]interface{} {
+	collections := se.CompactionStats()
+	var reclaimed int64
+	for _, stats := range collections {
+		reclaimed += stats.BytesReclaimed
+	}
+
+	se.compaction.mu.Lock()
+	runs := se.compaction.runs
+	se.compaction.mu.Unlock()
+
+	return map[string]interface{}{
+		"enabled":         se.compactionEnabled(),
+		"interval":        se.compaction.interval.String(),
+		"ratio":           se.compaction.ratio,
+		"runs":            runs,
+		"bytes_reclaimed": reclaimed,
+		"collections":     collections,
+	}
+}
+
+// startCompaction periodically compacts bloated collections until the engine stops
+func (se *StorageEngine) startCompaction() {
+	se.backgroundWg.Add(1)
+	go func() {
+		defer se.backgroundWg.Done()
+
+		ticker := time.NewTicker(se.compaction.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				se.compactCollections()
+			case <-se.stopChan:
+				return
+			}
+		}
+	}()
+}
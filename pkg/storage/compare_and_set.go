@@ -0,0 +1,49 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"github.com/adfharrison1/go-db/pkg/domain"
+)
+
+// ValidateCompareAndSetField checks that field can be the target of a compare-and-set.
+// Returned errors wrap domain.ErrInvalidField.
+func ValidateCompareAndSetField(field string) error {
+	if field == "" {
+		return fmt.Errorf("%w: field is required", domain.ErrInvalidField)
+	}
+	if field == "_id" {
+		return fmt.Errorf("%w: _id cannot be changed", domain.ErrInvalidField)
+	}
+	return nil
+}
+
+// FieldEquals reports whether a stored field value equals the expected value of a
+// compare-and-set. Numbers compare by value whatever their type, so an int stored by
+// an embedded caller matches the float64 decoded from JSON; everything else, strings
+// included, must match exactly. A missing field has the value nil.
+func FieldEquals(actual, expected interface{}) bool {
+	if actualNum, ok1 := ToFloat64(actual); ok1 {
+		if expectedNum, ok2 := ToFloat64(expected); ok2 {
+			return actualNum == expectedNum
+		}
+	}
+	return reflect.DeepEqual(actual, expected)
+}
+
+// CompareAndSetField sets field to newValue only if its current value equals expected
+// (see FieldEquals). The check and the write happen under the same lock, so concurrent
+// callers cannot both apply a change based on the same expected value. It reports whether
+// the value was set; indexes are updated and the change is persisted like UpdateById.
+func (se *StorageEngine) CompareAndSetField(collName, docId, field string, expected, newValue interface{}) (bool, error) {
+	if err := ValidateCompareAndSetField(field); err != nil {
+		return false, err
+	}
+
+	_, applied, err := se.conditionalUpdateById(context.Background(), collName, docId, domain.Document{field: newValue}, func(current domain.Document) bool {
+		return FieldEquals(current[field], expected)
+	})
+	return applied, err
+}
@@ -0,0 +1,115 @@
+package storage
+
+import (
+	"errors"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/adfharrison1/go-db/pkg/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFieldEquals(t *testing.T) {
+	assert.True(t, FieldEquals(5, float64(5)), "numbers compare by value")
+	assert.True(t, FieldEquals(int64(2), 2))
+	assert.False(t, FieldEquals("Alice", "alice"), "strings are exact")
+	assert.True(t, FieldEquals(nil, nil), "missing field matches nil")
+	assert.False(t, FieldEquals(nil, 0))
+	assert.True(t, FieldEquals([]interface{}{"a"}, []interface{}{"a"}))
+	assert.False(t, FieldEquals("5", 5))
+}
+
+func TestStorageEngine_CompareAndSetField(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "go-db-cas-test-*")
+	require.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	modes := map[string]*StorageEngine{
+		"no-saves":   NewStorageEngine(WithNoSaves(true)),
+		"dual-write": NewStorageEngine(WithDataDir(tempDir)),
+	}
+	for name, engine := range modes {
+		t.Run(name, func(t *testing.T) {
+			defer engine.StopBackgroundWorkers()
+
+			_, err := engine.Insert("jobs", domain.Document{"status": "pending", "attempts": 0})
+			require.NoError(t, err)
+			require.NoError(t, engine.CreateIndex("jobs", "status"))
+
+			applied, err := engine.CompareAndSetField("jobs", "1", "status", "pending", "running")
+			require.NoError(t, err)
+			assert.True(t, applied)
+
+			// The expected value is now stale
+			applied, err = engine.CompareAndSetField("jobs", "1", "status", "pending", "failed")
+			require.NoError(t, err)
+			assert.False(t, applied)
+
+			doc, err := engine.GetById("jobs", "1")
+			require.NoError(t, err)
+			assert.Equal(t, "running", doc["status"])
+
+			// Indexes follow the new value
+			result, err := engine.FindAll("jobs", map[string]interface{}{"status": "running"}, nil)
+			require.NoError(t, err)
+			assert.Len(t, result.Documents, 1)
+			result, err = engine.FindAll("jobs", map[string]interface{}{"status": "pending"}, nil)
+			require.NoError(t, err)
+			assert.Empty(t, result.Documents)
+
+			// JSON numbers arrive as float64 but match stored ints
+			applied, err = engine.CompareAndSetField("jobs", "1", "attempts", float64(0), 1)
+			require.NoError(t, err)
+			assert.True(t, applied)
+
+			// A nil expected value means the field must be absent
+			applied, err = engine.CompareAndSetField("jobs", "1", "owner", nil, "worker-1")
+			require.NoError(t, err)
+			assert.True(t, applied)
+			applied, err = engine.CompareAndSetField("jobs", "1", "owner", nil, "worker-2")
+			require.NoError(t, err)
+			assert.False(t, applied)
+
+			_, err = engine.CompareAndSetField("jobs", "1", "_id", "1", "2")
+			assert.True(t, errors.Is(err, domain.ErrInvalidField), "got %v", err)
+			_, err = engine.CompareAndSetField("jobs", "1", "", nil, 1)
+			assert.True(t, errors.Is(err, domain.ErrInvalidField), "got %v", err)
+
+			_, err = engine.CompareAndSetField("jobs", "missing", "status", "pending", "running")
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestStorageEngine_CompareAndSetField_Concurrent(t *testing.T) {
+	for name, noSaves := range map[string]bool{"no-saves": true, "dual-write": false} {
+		t.Run(name, func(t *testing.T) {
+			engine := NewStorageEngine(WithNoSaves(noSaves), WithDataDir(t.TempDir()))
+			defer engine.StopBackgroundWorkers()
+
+			_, err := engine.Insert("counters", domain.Document{"value": 0})
+			require.NoError(t, err)
+
+			// Every goroutine races to move the counter from 0 to 1; exactly one may win
+			var wins int32
+			var wg sync.WaitGroup
+			for i := 0; i < 20; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					applied, err := engine.CompareAndSetField("counters", "1", "value", 0, 1)
+					assert.NoError(t, err)
+					if applied {
+						atomic.AddInt32(&wins, 1)
+					}
+				}()
+			}
+			wg.Wait()
+
+			assert.Equal(t, int32(1), wins)
+		})
+	}
+}
@@ -0,0 +1,103 @@
+package storage
+
+import (
+	"context"
+	"time"
+
+	"github.com/adfharrison1/go-db/pkg/domain"
+)
+
+// InsertIfNotExists inserts doc unless a document in the collection matches filter.
+// The check and the insert happen under one hold of the collection write lock, so
+// concurrent calls with the same filter create at most one document. It returns the
+// created document and true, or a copy of a matching document and false. The
+// collection's default filter applies, so hidden (e.g. soft-deleted) documents do
+// not prevent the insert; an empty filter matches any document.
+func (se *StorageEngine) InsertIfNotExists(collName string, filter map[string]interface{}, doc domain.Document) (domain.Document, bool, error) {
+	return se.InsertIfNotExistsContext(context.Background(), collName, filter, doc)
+}
+
+// InsertIfNotExistsContext is like InsertIfNotExists; the request ID carried by ctx is
+// attached to any background retry of the disk write. A ctx from
+// domain.WithDurableWrite makes a failed disk write an error.
+func (se *StorageEngine) InsertIfNotExistsContext(ctx context.Context, collName string, filter map[string]interface{}, doc domain.Document) (domain.Document, bool, error) {
+	if err := ValidateFilter(filter); err != nil {
+		return nil, false, err
+	}
+	if err := se.checkDurable(ctx); err != nil {
+		return nil, false, err
+	}
+	filter = se.applyDefaultFilter(ctx, collName, filter)
+
+	release, err := se.writeLimiter.Acquire(ctx, collName)
+	if err != nil {
+		return nil, false, err
+	}
+	defer release()
+
+	// Fill in collection defaults and timestamps before the ID is assigned and indexes are updated
+	se.applyDocumentDefaults(collName, doc)
+	se.stampInsert(doc, time.Now())
+	if err := se.checkStrictSchema(collName, doc); err != nil {
+		return nil, false, err
+	}
+
+	var docID string
+	var result domain.Document
+	var created bool
+	var evicted []string
+	err = se.withCollectionWriteLock(collName, func() error {
+		if existing, found := se.findFirstMatchUnsafe(collName, filter); found {
+			result = CopyDocument(existing)
+			return nil
+		}
+
+		var err error
+		if docID, err = se.prepareInsertUnsafe(collName); err != nil {
+			return err
+		}
+		if result, evicted, err = se.insertLockedUnsafe(collName, docID, doc); err != nil {
+			return err
+		}
+		created = true
+		return nil
+	})
+	if err != nil {
+		return nil, false, err
+	}
+
+	if created {
+		if err := se.persistInsert(ctx, collName, docID, result, evicted); err != nil {
+			return nil, false, err
+		}
+	}
+	return result, created, nil
+}
+
+// findFirstMatchUnsafe returns a document matching filter, using indexes when they
+// apply (caller must hold collection lock). A missing collection has no matches.
+func (se *StorageEngine) findFirstMatchUnsafe(collName string, filter map[string]interface{}) (domain.Document, bool) {
+	collection, err := se.getCollectionInternal(collName)
+	if err != nil {
+		return nil, false
+	}
+
+	if candidateIDs, useIndex := se.optimizeWithIndexes(collName, filter); useIndex {
+		for _, id := range candidateIDs {
+			if doc, exists := collection.Get(id); exists && MatchesFilter(doc, filter) {
+				return doc, true
+			}
+		}
+		return nil, false
+	}
+
+	var match domain.Document
+	collection.Range(func(_ string, doc domain.Document) bool {
+		if MatchesFilter(doc, filter) {
+			match = doc
+			return false
+		}
+		return true
+	})
+	return match, match != nil
+}
@@ -0,0 +1,86 @@
+package storage
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/adfharrison1/go-db/pkg/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStorageEngine_InsertIfNotExists(t *testing.T) {
+	engine := NewStorageEngine(WithNoSaves(true))
+	defer engine.StopBackgroundWorkers()
+
+	filter := map[string]interface{}{"email": "alice@example.com"}
+
+	doc, created, err := engine.InsertIfNotExists("users", filter, domain.Document{"email": "alice@example.com", "name": "Alice"})
+	require.NoError(t, err)
+	assert.True(t, created)
+	assert.Equal(t, "1", doc["_id"])
+
+	doc, created, err = engine.InsertIfNotExists("users", filter, domain.Document{"email": "alice@example.com", "name": "Duplicate"})
+	require.NoError(t, err)
+	assert.False(t, created)
+	assert.Equal(t, "Alice", doc["name"], "the existing document is returned")
+
+	// The returned document is a copy
+	doc["name"] = "Changed"
+	stored, err := engine.GetById("users", "1")
+	require.NoError(t, err)
+	assert.Equal(t, "Alice", stored["name"])
+
+	_, _, err = engine.InsertIfNotExists("users", map[string]interface{}{"age": map[string]interface{}{"$gt": true}}, domain.Document{})
+	assert.True(t, errors.Is(err, domain.ErrInvalidFilter), "got %v", err)
+
+	result, err := engine.FindAll("users", nil, nil)
+	require.NoError(t, err)
+	assert.Len(t, result.Documents, 1)
+}
+
+func TestStorageEngine_InsertIfNotExists_Concurrent(t *testing.T) {
+	engine := NewStorageEngine(WithNoSaves(true))
+	defer engine.StopBackgroundWorkers()
+	require.NoError(t, engine.CreateCollection("users"))
+	require.NoError(t, engine.CreateIndex("users", "email"))
+
+	var createdCount int32
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, created, err := engine.InsertIfNotExists("users",
+				map[string]interface{}{"email": "bob@example.com"},
+				domain.Document{"email": "bob@example.com", "attempt": i})
+			assert.NoError(t, err)
+			if created {
+				atomic.AddInt32(&createdCount, 1)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	assert.Equal(t, int32(1), createdCount)
+	ids, err := engine.FindIds("users", map[string]interface{}{"email": "bob@example.com"})
+	require.NoError(t, err)
+	assert.Len(t, ids, 1)
+}
+
+func TestStorageEngine_InsertIfNotExists_DefaultFilter(t *testing.T) {
+	engine := NewStorageEngine(WithNoSaves(true))
+	defer engine.StopBackgroundWorkers()
+
+	_, err := engine.Insert("users", domain.Document{"email": "carol@example.com", "deleted": true})
+	require.NoError(t, err)
+	engine.SetCollectionDefaultFilter("users", map[string]interface{}{"$expr": "deleted != true"})
+
+	// A soft-deleted document does not block re-creating it
+	doc, created, err := engine.InsertIfNotExists("users", map[string]interface{}{"email": "carol@example.com"}, domain.Document{"email": "carol@example.com"})
+	require.NoError(t, err)
+	assert.True(t, created)
+	assert.Equal(t, "2", doc["_id"])
+}
@@ -0,0 +1,108 @@
+package storage
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/adfharrison1/go-db/pkg/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func insertCopyOnReadUser(t *testing.T, engine *StorageEngine) string {
+	doc, err := engine.Insert("users", domain.Document{
+		"name":    "Alice",
+		"address": map[string]interface{}{"city": "Paris"},
+		"tags":    []interface{}{"admin"},
+	})
+	require.NoError(t, err)
+	return doc["_id"].(string)
+}
+
+// mutateDocument changes top-level and nested values of a returned document
+func mutateDocument(doc domain.Document) {
+	doc["name"] = "Mallory"
+	doc["address"].(map[string]interface{})["city"] = "Nowhere"
+	doc["tags"].([]interface{})[0] = "root"
+}
+
+func assertStoredUnchanged(t *testing.T, engine *StorageEngine, id string) {
+	collection, _, found := engine.cache.Get("users")
+	require.True(t, found)
+	stored := collection.Documents[id]
+	assert.Equal(t, "Alice", stored["name"])
+	assert.Equal(t, "Paris", stored["address"].(map[string]interface{})["city"])
+	assert.Equal(t, "admin", stored["tags"].([]interface{})[0])
+}
+
+func TestStorageEngine_CopyOnRead(t *testing.T) {
+	engine := NewStorageEngine(WithNoSaves(true), WithCopyOnRead(true))
+	defer engine.StopBackgroundWorkers()
+	id := insertCopyOnReadUser(t, engine)
+
+	doc, err := engine.GetById("users", id)
+	require.NoError(t, err)
+	mutateDocument(doc)
+	assertStoredUnchanged(t, engine, id)
+
+	result, err := engine.FindAll("users", nil, nil)
+	require.NoError(t, err)
+	require.Len(t, result.Documents, 1)
+	mutateDocument(result.Documents[0])
+	assertStoredUnchanged(t, engine, id)
+
+	stream, err := engine.FindAllStream("users", nil)
+	require.NoError(t, err)
+	for doc := range stream {
+		mutateDocument(doc)
+	}
+	assertStoredUnchanged(t, engine, id)
+
+	sample, err := engine.Sample("users", 1, nil)
+	require.NoError(t, err)
+	require.Len(t, sample, 1)
+	mutateDocument(sample[0])
+	assertStoredUnchanged(t, engine, id)
+}
+
+func TestStorageEngine_CopyOnReadDisabled(t *testing.T) {
+	engine := NewStorageEngine(WithNoSaves(true))
+	defer engine.StopBackgroundWorkers()
+	id := insertCopyOnReadUser(t, engine)
+
+	// Without the option reads return the stored document itself
+	doc, err := engine.GetById("users", id)
+	require.NoError(t, err)
+	doc["name"] = "Mallory"
+
+	again, err := engine.GetById("users", id)
+	require.NoError(t, err)
+	assert.Equal(t, "Mallory", again["name"])
+}
+
+func BenchmarkFindAllCopyOnRead(b *testing.B) {
+	for _, copyOnRead := range []bool{false, true} {
+		b.Run(fmt.Sprintf("copyOnRead=%v", copyOnRead), func(b *testing.B) {
+			engine := NewStorageEngine(WithNoSaves(true), WithCopyOnRead(copyOnRead))
+			defer engine.StopBackgroundWorkers()
+
+			for i := 0; i < 1000; i++ {
+				_, err := engine.Insert("users", domain.Document{
+					"name":    fmt.Sprintf("user%d", i),
+					"age":     i % 100,
+					"address": map[string]interface{}{"city": fmt.Sprintf("city%d", i%50), "zip": i},
+					"tags":    []interface{}{"a", "b", "c"},
+				})
+				require.NoError(b, err)
+			}
+			options := &domain.PaginationOptions{Limit: 100, MaxLimit: 1000}
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := engine.FindAll("users", nil, options); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,104 @@
+package storage
+
+import (
+	"context"
+
+	"github.com/adfharrison1/go-db/pkg/domain"
+)
+
+// SetCollectionDefaultFilter sets a filter that is ANDed into every FindAll and
+// FindAllStream on the collection, e.g. {"$expr": "deleted != true"} for soft deletes.
+// Passing a nil or empty filter removes the default filter.
+// Default filters are held in memory only and are not persisted.
+// GetById is not affected; callers that need to hide filtered documents
+// from direct lookups should check them with MatchesFilter.
+func (se *StorageEngine) SetCollectionDefaultFilter(collName string, filter map[string]interface{}) {
+	se.defaultFiltersMu.Lock()
+	defer se.defaultFiltersMu.Unlock()
+
+	if len(filter) == 0 {
+		delete(se.defaultFilters, collName)
+		return
+	}
+	se.defaultFilters[collName] = copyFilter(filter)
+}
+
+// GetCollectionDefaultFilter returns a copy of the collection's default filter, or nil if none is set
+func (se *StorageEngine) GetCollectionDefaultFilter(collName string) map[string]interface{} {
+	se.defaultFiltersMu.RLock()
+	defer se.defaultFiltersMu.RUnlock()
+
+	filter, exists := se.defaultFilters[collName]
+	if !exists {
+		return nil
+	}
+	return copyFilter(filter)
+}
+
+// applyDefaultFilter combines the request filter with the collection default
+// filter unless the context opts out via domain.WithoutDefaultFilter, then applies
+// the collection schema and any $collation to the result
+func (se *StorageEngine) applyDefaultFilter(ctx context.Context, collName string, filter map[string]interface{}) map[string]interface{} {
+	if !domain.SkipDefaultFilter(ctx) {
+		filter = CombineFilters(filter, se.GetCollectionDefaultFilter(collName))
+	}
+	return ApplyCollation(ApplySchema(filter, se.GetCollectionSchema(collName)))
+}
+
+// CombineFilters returns a filter that matches documents satisfying both filters.
+// Conflicting equality conditions on the same field yield a filter that matches nothing,
+// two $expr predicates are joined with && and two ranges keep the tighter bounds.
+func CombineFilters(filter, extra map[string]interface{}) map[string]interface{} {
+	if len(extra) == 0 {
+		return filter
+	}
+	if len(filter) == 0 {
+		return extra
+	}
+
+	combined := copyFilter(filter)
+	for key, value := range extra {
+		existing, exists := combined[key]
+		switch {
+		case !exists:
+			combined[key] = value
+		case key == ExprFilterKey:
+			combined[key] = "(" + toExprSource(existing) + ") && (" + toExprSource(value) + ")"
+		case isRangeFilter(existing) && isRangeFilter(value):
+			existingBounds, _ := RangeFilterBounds(existing)
+			bounds, _ := RangeFilterBounds(value)
+			if merged, ok := mergeRangeBounds(existingBounds, bounds); ok {
+				combined[key] = merged
+			} else {
+				combined[ExprFilterKey] = "false"
+			}
+		case !ValuesMatch(existing, value):
+			// A field cannot equal two different values, so nothing can match
+			combined[ExprFilterKey] = "false"
+		}
+	}
+	return combined
+}
+
+// toExprSource returns an $expr value as source text; non-string values are
+// rendered as "false" so that invalid predicates never widen a result set
+func toExprSource(value interface{}) string {
+	if src, ok := value.(string); ok {
+		return src
+	}
+	return "false"
+}
+
+func copyFilter(filter map[string]interface{}) map[string]interface{} {
+	copied := make(map[string]interface{}, len(filter))
+	for key, value := range filter {
+		copied[key] = value
+	}
+	return copied
+}
+
+// isRangeFilter reports whether a filter value is a range condition
+func isRangeFilter(value interface{}) bool {
+	_, ok := RangeFilterBounds(value)
+	return ok
+}
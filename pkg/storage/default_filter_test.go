@@ -0,0 +1,100 @@
+package storage
+
+import (
+	"context"
+	"testing"
+
+	"github.com/adfharrison1/go-db/pkg/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCombineFilters(t *testing.T) {
+	assert.Nil(t, CombineFilters(nil, nil))
+	assert.Equal(t, map[string]interface{}{"a": 1}, CombineFilters(nil, map[string]interface{}{"a": 1}))
+	assert.Equal(t, map[string]interface{}{"a": 1}, CombineFilters(map[string]interface{}{"a": 1}, nil))
+
+	combined := CombineFilters(map[string]interface{}{"a": 1}, map[string]interface{}{"b": 2})
+	assert.Equal(t, map[string]interface{}{"a": 1, "b": 2}, combined)
+
+	combined = CombineFilters(
+		map[string]interface{}{ExprFilterKey: "a > 1"},
+		map[string]interface{}{ExprFilterKey: "b < 2"},
+	)
+	assert.Equal(t, "(a > 1) && (b < 2)", combined[ExprFilterKey])
+
+	doc := domain.Document{"a": 1}
+	combined = CombineFilters(map[string]interface{}{"a": 1}, map[string]interface{}{"a": 2})
+	assert.False(t, MatchesFilter(doc, combined), "conflicting equality must match nothing")
+
+	// The inputs must not be modified
+	original := map[string]interface{}{"a": 1}
+	CombineFilters(original, map[string]interface{}{"b": 2})
+	assert.Equal(t, map[string]interface{}{"a": 1}, original)
+}
+
+func TestStorageEngine_DefaultFilter(t *testing.T) {
+	engine := NewStorageEngine(WithNoSaves(true))
+	defer engine.StopBackgroundWorkers()
+
+	_, err := engine.Insert("users", domain.Document{"name": "Alice"})
+	require.NoError(t, err)
+	_, err = engine.Insert("users", domain.Document{"name": "Bob", "deleted": true})
+	require.NoError(t, err)
+	_, err = engine.Insert("users", domain.Document{"name": "Carol", "deleted": false})
+	require.NoError(t, err)
+
+	assert.Nil(t, engine.GetCollectionDefaultFilter("users"))
+
+	softDelete := map[string]interface{}{ExprFilterKey: "deleted != true"}
+	engine.SetCollectionDefaultFilter("users", softDelete)
+	assert.Equal(t, softDelete, engine.GetCollectionDefaultFilter("users"))
+
+	t.Run("FindAll applies default filter", func(t *testing.T) {
+		result, err := engine.FindAll("users", nil, nil)
+		require.NoError(t, err)
+		assert.Len(t, result.Documents, 2)
+
+		result, err = engine.FindAll("users", map[string]interface{}{"name": "Bob"}, nil)
+		require.NoError(t, err)
+		assert.Len(t, result.Documents, 0)
+	})
+
+	t.Run("Bypass via context", func(t *testing.T) {
+		ctx := domain.WithoutDefaultFilter(context.Background())
+		result, err := engine.FindAllContext(ctx, "users", nil, nil)
+		require.NoError(t, err)
+		assert.Len(t, result.Documents, 3)
+
+		docChan, err := engine.FindAllStreamContext(ctx, "users", nil)
+		require.NoError(t, err)
+		count := 0
+		for range docChan {
+			count++
+		}
+		assert.Equal(t, 3, count)
+	})
+
+	t.Run("FindAllStream applies default filter", func(t *testing.T) {
+		docChan, err := engine.FindAllStream("users", nil)
+		require.NoError(t, err)
+		for doc := range docChan {
+			assert.NotEqual(t, true, doc["deleted"])
+		}
+	})
+
+	t.Run("GetById is not filtered", func(t *testing.T) {
+		doc, err := engine.GetById("users", "2")
+		require.NoError(t, err)
+		assert.Equal(t, "Bob", doc["name"])
+	})
+
+	t.Run("Clearing the default filter", func(t *testing.T) {
+		engine.SetCollectionDefaultFilter("users", nil)
+		assert.Nil(t, engine.GetCollectionDefaultFilter("users"))
+
+		result, err := engine.FindAll("users", nil, nil)
+		require.NoError(t, err)
+		assert.Len(t, result.Documents, 3)
+	})
+}
@@ -0,0 +1,91 @@
+package storage
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/adfharrison1/go-db/pkg/domain"
+)
+
+// CurrentTimestampDefault is a default value that is replaced with the insert
+// time, formatted as RFC 3339 in UTC, e.g. {"created_at": "$$NOW"}
+const CurrentTimestampDefault = "$$NOW"
+
+// SetCollectionDefaults sets field values that Insert and BatchInsert add to
+// documents which do not already contain the field. Client-supplied values are
+// never overridden. Passing nil or empty defaults removes them.
+// Defaults are held in memory only and are not persisted.
+func (se *StorageEngine) SetCollectionDefaults(collName string, defaults domain.Document) {
+	se.documentDefaultsMu.Lock()
+	defer se.documentDefaultsMu.Unlock()
+
+	if len(defaults) == 0 {
+		delete(se.documentDefaults, collName)
+		return
+	}
+	se.documentDefaults[collName] = CopyDocumentDefaults(defaults)
+}
+
+// GetCollectionDefaults returns a copy of the collection's insert defaults, or nil if none are set
+func (se *StorageEngine) GetCollectionDefaults(collName string) domain.Document {
+	se.documentDefaultsMu.RLock()
+	defer se.documentDefaultsMu.RUnlock()
+
+	defaults, exists := se.documentDefaults[collName]
+	if !exists {
+		return nil
+	}
+	return CopyDocumentDefaults(defaults)
+}
+
+// applyDocumentDefaults fills in the collection's insert defaults on a document
+func (se *StorageEngine) applyDocumentDefaults(collName string, doc domain.Document) {
+	se.documentDefaultsMu.RLock()
+	defaults := se.documentDefaults[collName]
+	se.documentDefaultsMu.RUnlock()
+
+	ApplyDocumentDefaults(doc, defaults, time.Now())
+}
+
+// ValidateDocumentDefaults checks that defaults can be applied to inserted documents.
+// The _id field cannot have a default because IDs are assigned by the engine.
+func ValidateDocumentDefaults(defaults domain.Document) error {
+	for field := range defaults {
+		if field == "" {
+			return fmt.Errorf("default field name cannot be empty")
+		}
+		if field == "_id" {
+			return fmt.Errorf("cannot set a default for _id")
+		}
+	}
+	return nil
+}
+
+// ApplyDocumentDefaults sets each default on the document for fields it does
+// not contain. CurrentTimestampDefault values are replaced with now, and
+// nested maps and slices are copied so documents never share default values.
+func ApplyDocumentDefaults(doc domain.Document, defaults domain.Document, now time.Time) {
+	if len(defaults) == 0 {
+		return
+	}
+
+	var timestamp string
+	for field, value := range defaults {
+		if _, exists := doc[field]; exists {
+			continue
+		}
+		if value == CurrentTimestampDefault {
+			if timestamp == "" {
+				timestamp = now.UTC().Format(time.RFC3339Nano)
+			}
+			doc[field] = timestamp
+			continue
+		}
+		doc[field] = copyValue(value)
+	}
+}
+
+// CopyDocumentDefaults returns a deep copy of a set of defaults
+func CopyDocumentDefaults(defaults domain.Document) domain.Document {
+	return CopyDocument(defaults)
+}
@@ -0,0 +1,77 @@
+package storage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/adfharrison1/go-db/pkg/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestApplyDocumentDefaults(t *testing.T) {
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	defaults := domain.Document{
+		"status":     "new",
+		"created_at": CurrentTimestampDefault,
+		"tags":       []interface{}{"a"},
+	}
+
+	doc := domain.Document{"status": "active"}
+	ApplyDocumentDefaults(doc, defaults, now)
+
+	assert.Equal(t, "active", doc["status"], "client values must not be overridden")
+	assert.Equal(t, "2024-01-02T03:04:05Z", doc["created_at"])
+	assert.Equal(t, []interface{}{"a"}, doc["tags"])
+
+	// Defaults are copied, so mutating one document does not leak into others
+	doc["tags"].([]interface{})[0] = "changed"
+	assert.Equal(t, []interface{}{"a"}, defaults["tags"])
+
+	// An explicit null is a client-supplied value
+	doc = domain.Document{"status": nil}
+	ApplyDocumentDefaults(doc, defaults, now)
+	assert.Nil(t, doc["status"])
+}
+
+func TestValidateDocumentDefaults(t *testing.T) {
+	assert.NoError(t, ValidateDocumentDefaults(domain.Document{"status": "new"}))
+	assert.NoError(t, ValidateDocumentDefaults(nil))
+	assert.Error(t, ValidateDocumentDefaults(domain.Document{"_id": "x"}))
+	assert.Error(t, ValidateDocumentDefaults(domain.Document{"": "x"}))
+}
+
+func TestStorageEngine_CollectionDefaults(t *testing.T) {
+	engine := NewStorageEngine(WithNoSaves(true))
+	defer engine.StopBackgroundWorkers()
+
+	engine.SetCollectionDefaults("orders", domain.Document{"status": "new", "created_at": CurrentTimestampDefault})
+	assert.Equal(t, "new", engine.GetCollectionDefaults("orders")["status"])
+	assert.Nil(t, engine.GetCollectionDefaults("users"))
+
+	doc, err := engine.Insert("orders", domain.Document{"item": "pen"})
+	require.NoError(t, err)
+	assert.Equal(t, "new", doc["status"])
+	createdAt, ok := doc["created_at"].(string)
+	require.True(t, ok)
+	_, err = time.Parse(time.RFC3339Nano, createdAt)
+	assert.NoError(t, err)
+
+	docs, err := engine.BatchInsert("orders", []domain.Document{{"item": "desk"}, {"item": "chair", "status": "shipped"}})
+	require.NoError(t, err)
+	assert.Equal(t, "new", docs[0]["status"])
+	assert.Equal(t, "shipped", docs[1]["status"])
+
+	// Defaults are indexed like any other field
+	require.NoError(t, engine.CreateIndex("orders", "status"))
+	result, err := engine.FindAll("orders", map[string]interface{}{"status": "new"}, nil)
+	require.NoError(t, err)
+	assert.Len(t, result.Documents, 2)
+
+	engine.SetCollectionDefaults("orders", nil)
+	assert.Nil(t, engine.GetCollectionDefaults("orders"))
+
+	doc, err = engine.Insert("orders", domain.Document{"item": "lamp"})
+	require.NoError(t, err)
+	assert.NotContains(t, doc, "status")
+}
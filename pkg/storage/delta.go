@@ -0,0 +1,282 @@
+package storage
+
+import (
+	"encoding/binary"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/adfharrison1/go-db/pkg/domain"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+const (
+	// DefaultDeltaCompactionInterval is how often delta logs are folded into their base files
+	DefaultDeltaCompactionInterval = 30 * time.Second
+
+	// DefaultDeltaCompactionThreshold is the number of delta records after which a
+	// collection's log is compacted immediately
+	DefaultDeltaCompactionThreshold = 1000
+)
+
+// deltaRecord is one change appended to a collection's delta log: the fields an
+// update set, or a tombstone marking the document deleted
+type deltaRecord struct {
+	ID      string                 `msgpack:"id"`
+	Set     map[string]interface{} `msgpack:"set"`
+	Deleted bool                   `msgpack:"deleted,omitempty"`
+}
+
+// deltaLogEnabled reports whether updates are persisted as deltas.
+// Deltas are only used with the per-collection layout.
+func (se *StorageEngine) deltaLogEnabled() bool {
+	return se.deltaLog && se.layout == LayoutPerCollection
+}
+
+// tombstonesEnabled reports whether deletes are persisted as tombstones in the
+// delta log. Like deltas, tombstones are only used with the per-collection layout.
+func (se *StorageEngine) tombstonesEnabled() bool {
+	return se.tombstoneDeletes && se.layout == LayoutPerCollection
+}
+
+// deltaFilePath returns the delta log that sits next to a collection's base file
+func (se *StorageEngine) deltaFilePath(collName string) string {
+	return filepath.Join(se.dataDir, "collections", collName+".delta")
+}
+
+// deltaLock returns the mutex serializing writes to a collection's base and delta files
+func (se *StorageEngine) deltaLock(collName string) *sync.Mutex {
+	se.deltaMu.Lock()
+	defer se.deltaMu.Unlock()
+
+	lock, exists := se.deltaLocks[collName]
+	if !exists {
+		lock = &sync.Mutex{}
+		se.deltaLocks[collName] = lock
+	}
+	return lock
+}
+
+// appendDelta appends the fields changed by an update to the collection's delta log,
+// compacting the log once it reaches the configured threshold
+func (se *StorageEngine) appendDelta(collName, docID string, updates domain.Document) error {
+	set := make(map[string]interface{}, len(updates))
+	for key, value := range updates {
+		if key != "_id" {
+			set[key] = value
+		}
+	}
+	return se.appendDeltaRecord(collName, deltaRecord{ID: docID, Set: set})
+}
+
+// appendTombstone appends a tombstone for a deleted document to the collection's
+// delta log. The document stays in the base file until the log is compacted.
+func (se *StorageEngine) appendTombstone(collName, docID string) error {
+	return se.appendDeltaRecord(collName, deltaRecord{ID: docID, Deleted: true})
+}
+
+// appendDeltaRecord appends a record to the collection's delta log, compacting the
+// log once it reaches the configured threshold
+func (se *StorageEngine) appendDeltaRecord(collName string, delta deltaRecord) error {
+	data, err := msgpack.Marshal(delta)
+	if err != nil {
+		return fmt.Errorf("failed to encode delta: %w", err)
+	}
+	record := make([]byte, 4+len(data))
+	binary.LittleEndian.PutUint32(record, uint32(len(data)))
+	copy(record[4:], data)
+
+	lock := se.deltaLock(collName)
+	lock.Lock()
+	if err := se.requireCollection(collName); err != nil {
+		lock.Unlock()
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Join(se.dataDir, "collections"), 0755); err != nil {
+		lock.Unlock()
+		return fmt.Errorf("failed to create collections directory: %w", err)
+	}
+	file, err := os.OpenFile(se.deltaFilePath(collName), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		lock.Unlock()
+		return fmt.Errorf("failed to open delta log: %w", err)
+	}
+	_, err = file.Write(record)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		lock.Unlock()
+		return fmt.Errorf("failed to append delta: %w", err)
+	}
+	se.recordDiskWrite(int64(len(record)))
+
+	se.deltaMu.Lock()
+	se.deltaCounts[collName]++
+	count := se.deltaCounts[collName]
+	se.deltaMu.Unlock()
+	lock.Unlock()
+
+	if se.deltaCompactThreshold > 0 && count >= se.deltaCompactThreshold {
+		if err := se.compactDeltaLog(collName); err != nil {
+			log.Printf("WARN: Failed to compact delta log for collection %s: %v", collName, err)
+		}
+	}
+	return nil
+}
+
+// readDeltaLog reads a collection's delta records in append order. A missing log
+// has no records. A record cut short by a crash ends the log.
+func (se *StorageEngine) readDeltaLog(collName string) ([]deltaRecord, error) {
+	data, err := os.ReadFile(se.deltaFilePath(collName))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read delta log: %w", err)
+	}
+
+	var records []deltaRecord
+	for len(data) > 0 {
+		if len(data) < 4 {
+			log.Printf("WARN: Ignoring truncated delta record in collection %s", collName)
+			break
+		}
+		size := int(binary.LittleEndian.Uint32(data))
+		if len(data) < 4+size {
+			log.Printf("WARN: Ignoring truncated delta record in collection %s", collName)
+			break
+		}
+		var record deltaRecord
+		if err := msgpack.Unmarshal(data[4:4+size], &record); err != nil {
+			return nil, fmt.Errorf("failed to decode delta record: %w", err)
+		}
+		records = append(records, record)
+		data = data[4+size:]
+	}
+	return records, nil
+}
+
+// applyDeltas applies delta records in order to stored documents, removing the
+// documents of tombstones. Records for documents that no longer exist are skipped.
+func applyDeltas(docs map[string]interface{}, records []deltaRecord) {
+	for _, record := range records {
+		if record.Deleted {
+			delete(docs, record.ID)
+			continue
+		}
+		doc, ok := docs[record.ID].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		for key, value := range record.Set {
+			doc[key] = value
+		}
+	}
+}
+
+// loadDeltas applies a collection's delta log to documents read from its base file.
+// Caller must hold the collection's delta lock or otherwise exclude compaction.
+func (se *StorageEngine) loadDeltas(collName string, docs map[string]interface{}) error {
+	records, err := se.readDeltaLog(collName)
+	if err != nil {
+		return err
+	}
+	applyDeltas(docs, records)
+
+	se.deltaMu.Lock()
+	se.deltaCounts[collName] = len(records)
+	se.deltaMu.Unlock()
+	return nil
+}
+
+// clearDeltaLog removes a collection's delta log after its base file has been
+// rewritten with every change. Caller must hold the collection's delta lock.
+func (se *StorageEngine) clearDeltaLog(collName string) {
+	if err := os.Remove(se.deltaFilePath(collName)); err != nil && !os.IsNotExist(err) {
+		log.Printf("WARN: Failed to remove delta log for collection %s: %v", collName, err)
+	}
+	se.deltaMu.Lock()
+	delete(se.deltaCounts, collName)
+	se.deltaMu.Unlock()
+}
+
+// compactDeltaLog folds a collection's delta log into its base file, purging the
+// documents of its tombstones
+func (se *StorageEngine) compactDeltaLog(collName string) error {
+	lock := se.deltaLock(collName)
+	lock.Lock()
+	defer lock.Unlock()
+
+	records, err := se.readDeltaLog(collName)
+	if err != nil || len(records) == 0 {
+		return err
+	}
+
+	filename := se.collectionFilePath(collName)
+	storageData, err := readStorageFile(filename)
+	if err != nil {
+		return fmt.Errorf("failed to read base file: %w", err)
+	}
+	docs, exists := storageData.Collections[collName]
+	if !exists {
+		return fmt.Errorf("collection %s not found in base file", collName)
+	}
+	applyDeltas(docs, records)
+
+	size, err := se.writeStorageFile(filename, storageData)
+	if err != nil {
+		return err
+	}
+	se.recordDiskWrite(size)
+	se.clearDeltaLog(collName)
+
+	log.Printf("DEBUG: Compacted %d deltas into collection %s", len(records), collName)
+	return nil
+}
+
+// compactDeltaLogs compacts the delta log of every collection in the data directory
+func (se *StorageEngine) compactDeltaLogs() {
+	paths, err := filepath.Glob(filepath.Join(se.dataDir, "collections", "*.delta"))
+	if err != nil {
+		log.Printf("ERROR: Failed to list delta logs: %v", err)
+		return
+	}
+	for _, path := range paths {
+		collName := strings.TrimSuffix(filepath.Base(path), ".delta")
+		if err := se.compactDeltaLog(collName); err != nil {
+			log.Printf("WARN: Failed to compact delta log for collection %s: %v", collName, err)
+		}
+	}
+}
+
+// startDeltaCompaction periodically compacts delta logs, with a final pass on shutdown
+func (se *StorageEngine) startDeltaCompaction() {
+	interval := se.deltaCompactInterval
+	if interval <= 0 {
+		interval = DefaultDeltaCompactionInterval
+	}
+
+	se.backgroundWg.Add(1)
+	go func() {
+		defer se.backgroundWg.Done()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				se.compactDeltaLogs()
+			case <-se.stopChan:
+				se.compactDeltaLogs()
+				return
+			}
+		}
+	}()
+}
@@ -0,0 +1,351 @@
+package storage
+
+import (
+	"encoding/hex"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/adfharrison1/go-db/pkg/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newDeltaTestEngine(t *testing.T, dir string) *StorageEngine {
+	// No interval or threshold compaction, so deltas stay in the log until asked
+	engine := NewStorageEngine(WithDataDir(dir), WithDeltaLog(true), WithDeltaCompaction(time.Hour, 0))
+	t.Cleanup(engine.StopBackgroundWorkers)
+	return engine
+}
+
+func TestDeltaLog_UpdatesAppendDeltas(t *testing.T) {
+	tempDir := t.TempDir()
+	engine := newDeltaTestEngine(t, tempDir)
+
+	_, err := engine.Insert("users", domain.Document{"name": "Alice", "age": 30})
+	require.NoError(t, err)
+
+	baseFile := filepath.Join(tempDir, "collections", "users.godb")
+	before, err := os.ReadFile(baseFile)
+	require.NoError(t, err)
+
+	_, err = engine.UpdateById("users", "1", domain.Document{"age": 31})
+	require.NoError(t, err)
+	_, err = engine.UpdateById("users", "1", domain.Document{"city": "Paris"})
+	require.NoError(t, err)
+
+	// The base file is untouched and the updates sit in the delta log
+	after, err := os.ReadFile(baseFile)
+	require.NoError(t, err)
+	assert.Equal(t, before, after)
+
+	records, err := engine.readDeltaLog("users")
+	require.NoError(t, err)
+	require.Len(t, records, 2)
+	assert.Equal(t, "1", records[0].ID)
+
+	// A new engine reconstructs the current state from base file plus deltas
+	reloaded := newDeltaTestEngine(t, tempDir)
+	require.NoError(t, reloaded.LoadCollectionMetadata(filepath.Join(tempDir, "missing.godb")))
+
+	doc, err := reloaded.GetById("users", "1")
+	require.NoError(t, err)
+	assert.Equal(t, "Alice", doc["name"])
+	assert.EqualValues(t, 31, doc["age"])
+	assert.Equal(t, "Paris", doc["city"])
+}
+
+func TestDeltaLog_Compaction(t *testing.T) {
+	tempDir := t.TempDir()
+	engine := newDeltaTestEngine(t, tempDir)
+
+	_, err := engine.Insert("users", domain.Document{"name": "Alice", "age": 30})
+	require.NoError(t, err)
+	_, err = engine.UpdateById("users", "1", domain.Document{"age": 31})
+	require.NoError(t, err)
+
+	require.NoError(t, engine.compactDeltaLog("users"))
+	assert.NoFileExists(t, engine.deltaFilePath("users"))
+
+	storageData, err := readStorageFile(engine.collectionFilePath("users"))
+	require.NoError(t, err)
+	doc := storageData.Collections["users"]["1"].(map[string]interface{})
+	assert.EqualValues(t, 31, doc["age"])
+}
+
+func TestDeltaLog_CompactionThreshold(t *testing.T) {
+	tempDir := t.TempDir()
+	engine := NewStorageEngine(WithDataDir(tempDir), WithDeltaLog(true), WithDeltaCompaction(time.Hour, 3))
+	defer engine.StopBackgroundWorkers()
+
+	_, err := engine.Insert("users", domain.Document{"name": "Alice", "age": 0})
+	require.NoError(t, err)
+
+	for i := 1; i <= 4; i++ {
+		_, err = engine.UpdateById("users", "1", domain.Document{"age": i})
+		require.NoError(t, err)
+	}
+
+	// The third update triggered a compaction, leaving only the fourth in the log
+	records, err := engine.readDeltaLog("users")
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+	assert.EqualValues(t, 4, records[0].Set["age"])
+}
+
+func TestDeltaLog_FullWritesFoldDeltas(t *testing.T) {
+	tempDir := t.TempDir()
+	engine := newDeltaTestEngine(t, tempDir)
+
+	_, err := engine.Insert("users", domain.Document{"name": "Alice", "age": 30})
+	require.NoError(t, err)
+	_, err = engine.UpdateById("users", "1", domain.Document{"age": 31})
+	require.NoError(t, err)
+
+	// Inserting another document rewrites the base file, which must keep the update
+	_, err = engine.Insert("users", domain.Document{"name": "Bob", "age": 40})
+	require.NoError(t, err)
+	assert.NoFileExists(t, engine.deltaFilePath("users"))
+
+	// A replace after an update wins over the earlier delta
+	_, err = engine.UpdateById("users", "2", domain.Document{"age": 41})
+	require.NoError(t, err)
+	_, err = engine.ReplaceById("users", "2", domain.Document{"name": "Robert"})
+	require.NoError(t, err)
+
+	reloaded := newDeltaTestEngine(t, tempDir)
+	require.NoError(t, reloaded.LoadCollectionMetadata(filepath.Join(tempDir, "missing.godb")))
+
+	alice, err := reloaded.GetById("users", "1")
+	require.NoError(t, err)
+	assert.EqualValues(t, 31, alice["age"])
+
+	robert, err := reloaded.GetById("users", "2")
+	require.NoError(t, err)
+	assert.Equal(t, "Robert", robert["name"])
+	assert.NotContains(t, robert, "age")
+}
+
+func TestDeltaLog_TruncatedRecordIgnored(t *testing.T) {
+	tempDir := t.TempDir()
+	engine := newDeltaTestEngine(t, tempDir)
+
+	_, err := engine.Insert("users", domain.Document{"name": "Alice", "age": 30})
+	require.NoError(t, err)
+	_, err = engine.UpdateById("users", "1", domain.Document{"age": 31})
+	require.NoError(t, err)
+
+	// Simulate a crash part way through appending a second delta
+	file, err := os.OpenFile(engine.deltaFilePath("users"), os.O_APPEND|os.O_WRONLY, 0644)
+	require.NoError(t, err)
+	_, err = file.Write([]byte{0x40, 0x00, 0x00, 0x00, 0x81})
+	require.NoError(t, err)
+	require.NoError(t, file.Close())
+
+	reloaded := newDeltaTestEngine(t, tempDir)
+	require.NoError(t, reloaded.LoadCollectionMetadata(filepath.Join(tempDir, "missing.godb")))
+
+	doc, err := reloaded.GetById("users", "1")
+	require.NoError(t, err)
+	assert.EqualValues(t, 31, doc["age"])
+}
+
+func TestDeltaLog_DisabledForSingleFileLayout(t *testing.T) {
+	tempDir := t.TempDir()
+	engine := NewStorageEngine(WithDataDir(tempDir), WithDeltaLog(true), WithStorageLayout(LayoutSingleFile))
+	defer engine.StopBackgroundWorkers()
+
+	_, err := engine.Insert("users", domain.Document{"name": "Alice"})
+	require.NoError(t, err)
+	_, err = engine.UpdateById("users", "1", domain.Document{"name": "Alicia"})
+	require.NoError(t, err)
+
+	assert.NoDirExists(t, filepath.Join(tempDir, "collections"))
+}
+
+// benchmarkSmallUpdates measures bytes written for small updates to a collection of
+// large documents, reported as bytes/op
+func benchmarkSmallUpdates(b *testing.B, options ...StorageOption) {
+	tempDir, err := os.MkdirTemp("", "go-db-benchmark-*")
+	require.NoError(b, err)
+	defer os.RemoveAll(tempDir)
+
+	engine := NewStorageEngine(append([]StorageOption{WithDataDir(tempDir)}, options...)...)
+	defer engine.StopBackgroundWorkers()
+
+	rng := rand.New(rand.NewSource(1))
+	docs := make([]domain.Document, 500)
+	for i := range docs {
+		bio := make([]byte, 128)
+		rng.Read(bio)
+		docs[i] = domain.Document{
+			"name":    fmt.Sprintf("user%d", i),
+			"bio":     hex.EncodeToString(bio),
+			"counter": 0,
+		}
+	}
+	_, err = engine.BatchInsert("users", docs)
+	require.NoError(b, err)
+	require.NoError(b, engine.SaveCollectionAfterTransaction("users"))
+
+	start := atomic.LoadInt64(&engine.diskWriteStats.bytesWritten)
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		docID := fmt.Sprintf("%d", i%len(docs)+1)
+		_, err := engine.UpdateById("users", docID, domain.Document{"counter": i})
+		require.NoError(b, err)
+	}
+
+	b.StopTimer()
+	written := atomic.LoadInt64(&engine.diskWriteStats.bytesWritten) - start
+	b.ReportMetric(float64(written)/float64(b.N), "bytes/op")
+}
+
+func BenchmarkSmallUpdates_FullRewrite(b *testing.B) {
+	benchmarkSmallUpdates(b)
+}
+
+func BenchmarkSmallUpdates_DeltaLog(b *testing.B) {
+	benchmarkSmallUpdates(b, WithDeltaLog(true))
+}
+
+func TestStorageEngine_Compaction(t *testing.T) {
+	dir := t.TempDir()
+	engine := NewStorageEngine(WithDataDir(dir), WithDeltaLog(true), WithDeltaCompaction(time.Hour, 0),
+		WithCompaction(time.Hour, 2))
+	defer engine.StopBackgroundWorkers()
+	engine.compaction.minBytes = 0
+
+	_, err := engine.Insert("events", domain.Document{"count": 0, "note": strings.Repeat("x", 64)})
+	require.NoError(t, err)
+	_, err = engine.Insert("quiet", domain.Document{"count": 0})
+	require.NoError(t, err)
+
+	// A collection close to its live size is left alone
+	engine.compactCollections()
+	assert.Empty(t, engine.CompactionStats())
+
+	// Repeated updates grow the delta log well past the live data
+	for i := 1; i <= 50; i++ {
+		_, err := engine.UpdateById("events", "1", domain.Document{"count": i, "note": strings.Repeat("y", 64)})
+		require.NoError(t, err)
+	}
+	before := engine.collectionDiskSize("events")
+	_, err = os.Stat(engine.deltaFilePath("events"))
+	require.NoError(t, err)
+
+	// A busy collection is skipped until a later pass
+	lock := engine.getOrCreateCollectionLock("events")
+	lock.mu.RLock()
+	engine.compactCollections()
+	lock.mu.RUnlock()
+	assert.Empty(t, engine.CompactionStats())
+
+	engine.compactCollections()
+	stats := engine.CompactionStats()
+	require.Contains(t, stats, "events")
+	assert.NotContains(t, stats, "quiet")
+	assert.Equal(t, int64(1), stats["events"].Compactions)
+	assert.Equal(t, before-engine.collectionDiskSize("events"), stats["events"].BytesReclaimed)
+	assert.Positive(t, stats["events"].BytesReclaimed)
+	assert.False(t, stats["events"].LastCompaction.IsZero())
+	_, err = os.Stat(engine.deltaFilePath("events"))
+	assert.True(t, os.IsNotExist(err), "the delta log is folded into the rewritten file")
+
+	memStats := engine.GetMemoryStats()["compaction"].(map[string]interface{})
+	assert.Equal(t, true, memStats["enabled"])
+	assert.Equal(t, int64(3), memStats["runs"])
+	assert.Equal(t, stats["events"].BytesReclaimed, memStats["bytes_reclaimed"])
+
+	// The rewritten file holds the latest document
+	reloaded := newDeltaTestEngine(t, dir)
+	require.NoError(t, reloaded.LoadCollectionMetadata(filepath.Join(dir, "missing.godb")))
+	doc, err := reloaded.GetById("events", "1")
+	require.NoError(t, err)
+	assert.EqualValues(t, 50, doc["count"])
+}
+
+func TestTombstoneDeletes(t *testing.T) {
+	tempDir := t.TempDir()
+	newEngine := func() *StorageEngine {
+		engine := NewStorageEngine(WithDataDir(tempDir), WithTombstoneDeletes(true), WithDeltaCompaction(time.Hour, 0))
+		t.Cleanup(engine.StopBackgroundWorkers)
+		return engine
+	}
+	engine := newEngine()
+
+	for _, name := range []string{"Alice", "Bob", "Carol"} {
+		_, err := engine.Insert("users", domain.Document{"name": name})
+		require.NoError(t, err)
+	}
+	require.NoError(t, engine.CreateIndex("users", "name"))
+
+	baseFile := filepath.Join(tempDir, "collections", "users.godb")
+	before, err := os.ReadFile(baseFile)
+	require.NoError(t, err)
+
+	require.NoError(t, engine.DeleteById("users", "2"))
+
+	// The base file is untouched and the delete sits in the delta log as a tombstone
+	after, err := os.ReadFile(baseFile)
+	require.NoError(t, err)
+	assert.Equal(t, before, after)
+	records, err := engine.readDeltaLog("users")
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+	assert.Equal(t, "2", records[0].ID)
+	assert.True(t, records[0].Deleted)
+
+	// The document and its index entry are gone at once
+	_, err = engine.GetById("users", "2")
+	assert.ErrorIs(t, err, domain.ErrDocumentNotFound)
+	docs, err := engine.FindByIndex("users", "name", "Bob")
+	require.NoError(t, err)
+	assert.Empty(t, docs)
+	result, err := engine.FindAll("users", nil, nil)
+	require.NoError(t, err)
+	assert.Len(t, result.Documents, 2)
+
+	// A new engine applies the tombstone when counting and loading
+	reloaded := newEngine()
+	require.NoError(t, reloaded.LoadCollectionMetadata(filepath.Join(tempDir, "missing.godb")))
+	reloaded.mu.RLock()
+	assert.Equal(t, int64(2), reloaded.collections["users"].DocumentCount)
+	reloaded.mu.RUnlock()
+	_, err = reloaded.GetById("users", "2")
+	assert.ErrorIs(t, err, domain.ErrDocumentNotFound)
+
+	// Compaction purges the document from the base file
+	require.NoError(t, engine.compactDeltaLog("users"))
+	assert.NoFileExists(t, engine.deltaFilePath("users"))
+	storageData, err := readStorageFile(baseFile)
+	require.NoError(t, err)
+	assert.Len(t, storageData.Collections["users"], 2)
+	assert.NotContains(t, storageData.Collections["users"], "2")
+}
+
+func TestTombstoneDeletes_FullWritesFoldTombstones(t *testing.T) {
+	tempDir := t.TempDir()
+	engine := NewStorageEngine(WithDataDir(tempDir), WithTombstoneDeletes(true), WithDeltaCompaction(time.Hour, 0))
+	defer engine.StopBackgroundWorkers()
+
+	_, err := engine.Insert("users", domain.Document{"name": "Alice"})
+	require.NoError(t, err)
+	require.NoError(t, engine.DeleteById("users", "1"))
+
+	// Inserting another document rewrites the base file without the deleted one
+	_, err = engine.Insert("users", domain.Document{"name": "Bob"})
+	require.NoError(t, err)
+	assert.NoFileExists(t, engine.deltaFilePath("users"))
+
+	storageData, err := readStorageFile(engine.collectionFilePath("users"))
+	require.NoError(t, err)
+	assert.NotContains(t, storageData.Collections["users"], "1")
+	assert.Contains(t, storageData.Collections["users"], "2")
+}
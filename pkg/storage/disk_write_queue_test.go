@@ -0,0 +1,141 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/adfharrison1/go-db/pkg/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiskWriteQueue_CoalescesByCollection(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "go-db-disk-queue-test-*")
+	require.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	engine := NewStorageEngine(WithDataDir(tempDir))
+	engine.diskRetryBaseDelay = 50 * time.Millisecond
+	defer engine.StopBackgroundWorkers()
+
+	var queued []DiskWriteRequest
+	for i := 0; i < 30; i++ {
+		doc, err := engine.Insert("users", domain.Document{"name": fmt.Sprintf("User%d", i)})
+		require.NoError(t, err)
+		queued = append(queued, DiskWriteRequest{Collection: "users", DocumentID: doc["_id"].(string), Document: doc})
+	}
+	for i := 0; i < 10; i++ {
+		doc, err := engine.Insert("orders", domain.Document{"item": fmt.Sprintf("Item%d", i)})
+		require.NoError(t, err)
+		queued = append(queued, DiskWriteRequest{Collection: "orders", DocumentID: doc["_id"].(string), Document: doc})
+	}
+
+	// Simulate a burst of failed immediate writes
+	for _, req := range queued {
+		engine.queueDiskWrite(req.Collection, req.DocumentID, req.Document)
+	}
+
+	require.Eventually(t, func() bool {
+		stats := engine.getDiskWriteStats()
+		return stats["retry_saves"].(int64) == 2 && stats["pending_collections"].(int64) == 0
+	}, 5*time.Second, 10*time.Millisecond)
+
+	stats := engine.GetMemoryStats()["disk_writes"].(map[string]interface{})
+	assert.Equal(t, int64(40), stats["queued"])
+	assert.Equal(t, int64(38), stats["coalesced"])
+	assert.Equal(t, int64(2), stats["retry_saves"])
+	assert.Equal(t, int64(0), stats["dropped"])
+	assert.Equal(t, 0, stats["queue_depth"])
+
+	// Each collection file holds the full collection after a single save
+	for collName, expected := range map[string]int{"users": 30, "orders": 10} {
+		docs := make(map[string]interface{})
+		err := engine.loadCollectionFromFile(filepath.Join(tempDir, "collections", collName+".godb"), docs)
+		require.NoError(t, err)
+		assert.Len(t, docs, expected, collName)
+	}
+}
+
+func TestDiskWriteQueue_GivesUpAfterMaxRetries(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "go-db-disk-queue-test-*")
+	require.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	engine := NewStorageEngine(WithDataDir(tempDir))
+	engine.diskRetryBaseDelay = 5 * time.Millisecond
+	defer engine.StopBackgroundWorkers()
+
+	// A collection that is not loaded cannot be saved, so every retry fails
+	engine.queueDiskWrite("missing", "1", domain.Document{"name": "ghost"})
+
+	require.Eventually(t, func() bool {
+		return engine.getDiskWriteStats()["dropped"].(int64) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+
+	stats := engine.getDiskWriteStats()
+	assert.Equal(t, int64(3), stats["retry_saves"])
+	assert.Equal(t, int64(0), stats["pending_collections"])
+}
+
+func TestDiskWriteQueue_LogsRequestIDs(t *testing.T) {
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+
+	engine := NewStorageEngine(WithDataDir(t.TempDir()))
+	engine.diskRetryBaseDelay = 5 * time.Millisecond
+	defer engine.StopBackgroundWorkers()
+
+	// Both failed writes coalesce into one save, which names the requests behind it
+	engine.queueDiskWriteContext(domain.WithRequestID(context.Background(), "req-1"), "missing", "1", nil)
+	engine.queueDiskWriteContext(domain.WithRequestID(context.Background(), "req-2"), "missing", "2", nil)
+
+	require.Eventually(t, func() bool {
+		return engine.getDiskWriteStats()["dropped"].(int64) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+
+	engine.StopBackgroundWorkers()
+	assert.Contains(t, logs.String(), "Giving up on background save of collection missing")
+	assert.Contains(t, logs.String(), "(requests: req-1, req-2)")
+}
+
+func TestDiskWriteQueue_FlushedOnStop(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "go-db-disk-queue-test-*")
+	require.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	engine := NewStorageEngine(WithDataDir(tempDir))
+	engine.diskRetryBaseDelay = time.Hour // The retry worker never gets there on its own
+
+	for i := 0; i < 5; i++ {
+		_, err := engine.Insert("users", domain.Document{"name": fmt.Sprintf("User%d", i)})
+		require.NoError(t, err)
+	}
+
+	// Simulate the immediate write of the collection having failed
+	collectionFile := filepath.Join(tempDir, "collections", "users.godb")
+	require.NoError(t, os.Remove(collectionFile))
+	engine.mu.Lock()
+	engine.collections["users"].State = CollectionStateDirty
+	engine.mu.Unlock()
+	engine.queueDiskWrite("users", "5", nil)
+	engine.queueDiskWrite("missing", "1", domain.Document{"name": "ghost"})
+
+	engine.StopBackgroundWorkers()
+
+	docs := make(map[string]interface{})
+	require.NoError(t, engine.loadCollectionFromFile(collectionFile, docs))
+	assert.Len(t, docs, 5)
+
+	// The unsaveable collection is retried a bounded number of times, then reported
+	stats := engine.getDiskWriteStats()
+	assert.Equal(t, int64(1+maxDiskWriteRetries), stats["retry_saves"])
+	assert.Equal(t, int64(1), stats["dropped"])
+	assert.Equal(t, int64(0), stats["pending_collections"])
+}
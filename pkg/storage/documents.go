@@ -1,8 +1,11 @@
 package storage
 
 import (
+	"context"
 	"fmt"
+	"log"
 	"sort"
+	"strconv"
 	"sync/atomic"
 	"time"
 
@@ -11,38 +14,35 @@ import (
 
 // Insert inserts a document into a collection and returns the created document with ID
 func (se *StorageEngine) Insert(collName string, doc domain.Document) (domain.Document, error) {
-	// First, ensure collection exists and generate ID (requires collection lock)
-	var docID string
-	err := se.withCollectionWriteLock(collName, func() error {
-		// Get or load collection
-		_, err := se.getCollectionInternal(collName)
-		if err != nil {
-			// Collection doesn't exist, create it
-			collection := domain.NewCollection(collName)
-			collectionInfo := &CollectionInfo{
-				Name:          collName,
-				DocumentCount: 0,
-				State:         CollectionStateDirty,
-				LastModified:  time.Now(),
-			}
-			se.collections[collName] = collectionInfo
-			se.cache.Put(collName, collection, collectionInfo)
+	return se.InsertContext(context.Background(), collName, doc)
+}
 
-			// Initialize indexes for this collection using the index engine
-			se.indexEngine.CreateIndex(collName, "_id")
-		}
+// InsertContext is like Insert; the request ID carried by ctx is attached to any
+// background retry of the disk write. A ctx from domain.WithDurableWrite makes a
+// failed disk write an error.
+func (se *StorageEngine) InsertContext(ctx context.Context, collName string, doc domain.Document) (domain.Document, error) {
+	if err := se.checkDurable(ctx); err != nil {
+		return nil, err
+	}
+	release, err := se.writeLimiter.Acquire(ctx, collName)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
 
-		// Generate unique ID using per-collection atomic counter (thread-safe)
-		se.idCountersMu.Lock()
-		counter, exists := se.idCounters[collName]
-		if !exists {
-			counter = new(int64)
-			se.idCounters[collName] = counter
-		}
-		se.idCountersMu.Unlock()
+	// Fill in collection defaults and timestamps before the ID is assigned and indexes are updated
+	se.applyDocumentDefaults(collName, doc)
+	se.stampInsert(doc, time.Now())
+	if err := se.checkStrictSchema(collName, doc); err != nil {
+		return nil, err
+	}
 
-		docID = fmt.Sprintf("%d", atomic.AddInt64(counter, 1))
-		return nil
+	// First, ensure collection exists and generate ID (requires collection lock)
+	var docID string
+	err = se.withCollectionWriteLock(collName, func() error {
+		var err error
+		docID, err = se.prepareInsertUnsafe(collName)
+		return err
 	})
 
 	if err != nil {
@@ -51,44 +51,145 @@ func (se *StorageEngine) Insert(collName string, doc domain.Document) (domain.Do
 
 	// Now insert the document using document-level lock
 	var result domain.Document
-	var resultErr error
+	var evicted []string
 
 	// Insert operations modify the Documents map, so they need collection write locks
-	// For no-saves mode, use simpler locking to avoid deadlocks under high load
-	if se.noSaves {
-		// Simple collection-level locking for no-saves mode
-		err = se.withCollectionWriteLock(collName, func() error {
-			result, resultErr = se.insertDocumentUnsafe(collName, docID, doc)
-			return resultErr
-		})
-	} else {
-		// Dual-write mode: use document-level locking for fine-grained concurrency
-		err = se.withCollectionWriteLock(collName, func() error {
-			err := se.withDocumentWriteLock(collName, docID, func() error {
-				result, resultErr = se.insertDocumentUnsafe(collName, docID, doc)
-				return resultErr
-			})
+	err = se.withCollectionWriteLock(collName, func() error {
+		var err error
+		result, evicted, err = se.insertLockedUnsafe(collName, docID, doc)
+		return err
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := se.persistInsert(ctx, collName, docID, result, evicted); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// prepareInsertUnsafe creates the collection if it does not exist and returns the
+// next document ID (caller must hold collection write lock)
+func (se *StorageEngine) prepareInsertUnsafe(collName string) (string, error) {
+	if err := se.ensureCollectionUnsafe(collName); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%d", atomic.AddInt64(se.idCounter(collName), 1)), nil
+}
+
+// ensureCollectionUnsafe creates the collection if it does not exist (caller must
+// hold collection write lock)
+func (se *StorageEngine) ensureCollectionUnsafe(collName string) error {
+	// Get or load collection
+	_, err := se.getCollectionInternal(collName)
+	if err != nil {
+		// Collection doesn't exist, create it
+		if err := se.validateNewCollection(collName); err != nil {
 			return err
-		})
+		}
+		collection := se.newCollection(collName)
+		collectionInfo := &CollectionInfo{
+			Name:          collName,
+			DocumentCount: 0,
+			State:         CollectionStateDirty,
+			LastModified:  time.Now(),
+		}
+		se.mu.Lock()
+		se.collections[collName] = collectionInfo
+		se.cache.Put(collName, collection, collectionInfo)
+		se.mu.Unlock()
+
+		// Initialize indexes for this collection using the index engine
+		se.indexEngine.CreateIndex(collName, "_id")
 	}
+	return nil
+}
+
+// idCounter returns the collection's ID counter, creating it if needed
+func (se *StorageEngine) idCounter(collName string) *int64 {
+	se.idCountersMu.Lock()
+	defer se.idCountersMu.Unlock()
 
+	counter, exists := se.idCounters[collName]
+	if !exists {
+		counter = new(int64)
+		se.idCounters[collName] = counter
+	}
+	return counter
+}
+
+// raiseIDCounter raises the collection's ID counter to docID if it is a higher
+// number, so that an ID given by the caller is never assigned to another document
+func (se *StorageEngine) raiseIDCounter(collName, docID string) {
+	id, err := strconv.ParseInt(docID, 10, 64)
 	if err != nil {
-		return nil, err
+		return
 	}
+	counter := se.idCounter(collName)
+	for current := atomic.LoadInt64(counter); id > current; current = atomic.LoadInt64(counter) {
+		if atomic.CompareAndSwapInt64(counter, current, id) {
+			return
+		}
+	}
+}
 
-	// Dual-write: Save document to disk immediately (unless no-saves mode)
-	if !se.noSaves {
-		if err := se.saveDocumentToDisk(collName, docID, result); err != nil {
-			// Queue for background retry if immediate write fails
-			se.queueDiskWrite(collName, docID, result)
+// insertLockedUnsafe inserts a document under its ID and applies the collection cap,
+// returning the IDs of the evicted documents (caller must hold collection write lock)
+func (se *StorageEngine) insertLockedUnsafe(collName, docID string, doc domain.Document) (domain.Document, []string, error) {
+	// For no-saves mode, use simpler locking to avoid deadlocks under high load
+	if se.noSaves {
+		result, err := se.insertDocumentUnsafe(collName, docID, doc)
+		if err != nil {
+			return nil, nil, err
 		}
+		return result, se.trackInsertsUnsafe(collName, docID), nil
 	}
 
-	return result, nil
+	// Dual-write mode: use document-level locking for fine-grained concurrency
+	var result domain.Document
+	err := se.withDocumentWriteLock(collName, docID, func() error {
+		var err error
+		result, err = se.insertDocumentUnsafe(collName, docID, doc)
+		return err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	// Evicted outside the new document's lock so document locks are never nested
+	return result, se.trackInsertsUnsafe(collName, docID), nil
+}
+
+// persistInsert saves an inserted document to disk (unless no-saves mode), with the
+// removal of the documents its insert evicted. The error is that of persistFailed.
+func (se *StorageEngine) persistInsert(ctx context.Context, collName, docID string, doc domain.Document, evicted []string) error {
+	if se.noSaves {
+		return nil
+	}
+	if len(evicted) > 0 && !se.tombstonesEnabled() {
+		// The whole collection is rewritten, so it holds the inserted document too
+		return se.persistEvictions(ctx, collName, evicted)
+	}
+	if err := se.saveDocument(ctx, collName, docID, doc); err != nil {
+		// Queue for background retry if immediate write fails
+		return se.persistFailed(ctx, collName, docID, doc, err)
+	}
+	return se.persistEvictions(ctx, collName, evicted)
 }
 
 // insertDocumentUnsafe performs the actual document insertion (caller must hold document write lock)
 func (se *StorageEngine) insertDocumentUnsafe(collName, docID string, doc domain.Document) (domain.Document, error) {
+	if err := se.indexEngine.CheckUnique(collName, []string{docID}, []domain.Document{doc}); err != nil {
+		return nil, err
+	}
+	se.versionInsert(doc)
+	return se.addDocumentUnsafe(collName, docID, doc)
+}
+
+// addDocumentUnsafe stores a document under docID and indexes it, keeping any _version
+// it holds (caller must hold document write lock and have checked unique indexes)
+func (se *StorageEngine) addDocumentUnsafe(collName, docID string, doc domain.Document) (domain.Document, error) {
 	// Get collection (already exists and loaded)
 	collection, err := se.getCollectionInternal(collName)
 	if err != nil {
@@ -99,17 +200,16 @@ func (se *StorageEngine) insertDocumentUnsafe(collName, docID string, doc domain
 	doc["_id"] = docID
 
 	// Store the document (need collection write lock for map modification)
-	collection.Documents[docID] = doc
+	collection.Set(docID, doc)
 
 	// Update collection metadata
 	if collInfo, exists := se.collections[collName]; exists {
 		collInfo.DocumentCount++
-		collInfo.State = CollectionStateDirty
-		collInfo.LastModified = time.Now()
+		collInfo.markDirty()
 	}
 
 	// Update indexes
-	se.indexEngine.UpdateIndexForDocument(collName, docID, nil, doc)
+	se.updateIndexes(collName, docID, nil, doc)
 
 	return doc, nil
 }
@@ -120,15 +220,20 @@ func (se *StorageEngine) insertUnsafe(collName string, doc domain.Document) (dom
 	collection, err := se.getCollectionInternal(collName)
 	if err != nil {
 		// Collection doesn't exist, create it
-		collection = domain.NewCollection(collName)
+		if err := se.validateNewCollection(collName); err != nil {
+			return nil, err
+		}
+		collection = se.newCollection(collName)
 		collectionInfo := &CollectionInfo{
 			Name:          collName,
 			DocumentCount: 0,
 			State:         CollectionStateDirty,
 			LastModified:  time.Now(),
 		}
+		se.mu.Lock()
 		se.collections[collName] = collectionInfo
 		se.cache.Put(collName, collection, collectionInfo)
+		se.mu.Unlock()
 
 		// Initialize indexes for this collection using the index engine
 		se.indexEngine.CreateIndex(collName, "_id")
@@ -151,13 +256,12 @@ func (se *StorageEngine) insertUnsafe(collName string, doc domain.Document) (dom
 	// Update indexes before inserting (oldDoc is nil for new documents)
 	se.updateIndexes(collName, newID, nil, doc)
 
-	collection.Documents[newID] = doc
+	collection.Set(newID, doc)
 
 	// Mark as dirty
 	if _, collectionInfo, found := se.cache.Get(collName); found {
-		collectionInfo.State = CollectionStateDirty
+		collectionInfo.markDirty()
 		collectionInfo.DocumentCount++
-		collectionInfo.LastModified = time.Now()
 	}
 
 	return doc, nil
@@ -172,6 +276,9 @@ func (se *StorageEngine) GetById(collName, docId string) (domain.Document, error
 	err := se.withCollectionReadLock(collName, func() error {
 		err := se.withDocumentReadLock(collName, docId, func() error {
 			result, resultErr = se.getByIdUnsafe(collName, docId)
+			if resultErr == nil && se.copyOnRead {
+				result = CopyDocument(result)
+			}
 			return resultErr
 		})
 		return err
@@ -180,9 +287,28 @@ func (se *StorageEngine) GetById(collName, docId string) (domain.Document, error
 	if err != nil {
 		return nil, err
 	}
+	se.trackAccess(collName, docId)
 	return result, nil
 }
 
+// DocumentExists reports whether a document exists and, when filter is non-nil,
+// matches it. The document is checked in place rather than copied or serialized.
+func (se *StorageEngine) DocumentExists(collName, docId string, filter map[string]interface{}) bool {
+	exists := false
+	se.withCollectionReadLock(collName, func() error {
+		return se.withDocumentReadLock(collName, docId, func() error {
+			collection, err := se.getCollectionInternal(collName)
+			if err != nil {
+				return err
+			}
+			doc, found := collection.Get(docId)
+			exists = found && (filter == nil || MatchesFilter(doc, filter))
+			return nil
+		})
+	})
+	return exists
+}
+
 // getByIdUnsafe performs the actual get operation (caller must hold collection read lock)
 func (se *StorageEngine) getByIdUnsafe(collName, docId string) (domain.Document, error) {
 	collection, err := se.getCollectionInternal(collName)
@@ -190,9 +316,9 @@ func (se *StorageEngine) getByIdUnsafe(collName, docId string) (domain.Document,
 		return nil, err
 	}
 
-	doc, exists := collection.Documents[docId]
+	doc, exists := collection.Get(docId)
 	if !exists {
-		return nil, fmt.Errorf("document with id %s not found in collection %s", docId, collName)
+		return nil, domain.Errorf(domain.ErrDocumentNotFound, "document with id %s not found in collection %s", docId, collName)
 	}
 
 	return doc, nil
@@ -200,38 +326,120 @@ func (se *StorageEngine) getByIdUnsafe(collName, docId string) (domain.Document,
 
 // UpdateById updates a specific document by its ID and returns the updated document
 func (se *StorageEngine) UpdateById(collName, docId string, updates domain.Document) (domain.Document, error) {
+	return se.UpdateByIdContext(context.Background(), collName, docId, updates)
+}
+
+// UpdateByIdContext is like UpdateById; the request ID carried by ctx is attached to
+// any background retry of the disk write. A ctx from domain.WithDurableWrite makes a
+// failed disk write an error.
+func (se *StorageEngine) UpdateByIdContext(ctx context.Context, collName, docId string, updates domain.Document) (domain.Document, error) {
+	result, _, err := se.conditionalUpdateById(ctx, collName, docId, updates, nil)
+	return result, err
+}
+
+// conditionalUpdateById applies updates if condition accepts the current document,
+// checked under the same lock as the write; a nil condition always applies. It
+// reports whether the update was applied, and only applied updates are persisted.
+func (se *StorageEngine) conditionalUpdateById(ctx context.Context, collName, docId string, updates domain.Document, condition func(domain.Document) bool) (domain.Document, bool, error) {
+	if err := se.checkDurable(ctx); err != nil {
+		return nil, false, err
+	}
+	release, err := se.writeLimiter.Acquire(ctx, collName)
+	if err != nil {
+		return nil, false, err
+	}
+	defer release()
+
 	var result domain.Document
 	var resultErr error
+	updates = se.stampUpdates(updates)
+
+	applied := true
+	var resolved domain.Document
+	update := func() error {
+		if condition != nil {
+			current, err := se.getByIdUnsafe(collName, docId)
+			if err != nil {
+				return err
+			}
+			if !condition(current) {
+				applied = false
+				return nil
+			}
+		}
+		// Operators are resolved under the lock, so the comparison and write are atomic
+		var err error
+		if resolved, err = se.resolveUpdateUnsafe(collName, docId, updates); err != nil {
+			return err
+		}
+		if err := se.checkUniqueUpdateUnsafe(collName, docId, resolved); err != nil {
+			return err
+		}
+		result, resultErr = se.updateByIdUnsafe(collName, docId, resolved)
+		return resultErr
+	}
 
 	// For no-saves mode, use collection-level locking to avoid deadlocks
 	if se.noSaves {
-		err := se.withCollectionWriteLock(collName, func() error {
-			result, resultErr = se.updateByIdUnsafe(collName, docId, updates)
-			return resultErr
-		})
+		err := se.withCollectionWriteLock(collName, update)
 		if err != nil {
-			return nil, err
+			return nil, false, err
 		}
-	} else {
-		// Dual-write mode: use document-level locking for fine-grained concurrency
-		err := se.withDocumentWriteLock(collName, docId, func() error {
-			result, resultErr = se.updateByIdUnsafe(collName, docId, updates)
-			return resultErr
-		})
-		if err != nil {
-			return nil, err
+		return result, applied, nil
+	}
+
+	// Dual-write mode: use document-level locking for fine-grained concurrency
+	var deltaGen uint64
+	var deltaErr error
+	err = se.withUniqueDocumentWriteLock(collName, docId, func() error {
+		if err := update(); err != nil || !applied {
+			return err
 		}
+		if se.deltaLogEnabled() {
+			// Appended under the document lock so deltas for a document stay in update order
+			deltaGen = se.dirtyGeneration(collName)
+			deltaErr = se.appendDelta(collName, docId, resolved)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	if !applied {
+		return nil, false, nil
 	}
 
-	// Dual-write: Save document to disk immediately (unless no-saves mode)
-	if !se.noSaves {
-		if err := se.saveDocumentToDisk(collName, docId, result); err != nil {
-			// Queue for background retry if immediate write fails
-			se.queueDiskWrite(collName, docId, result)
+	if err := se.persistUpdate(ctx, collName, docId, result, deltaGen, deltaErr); err != nil {
+		return nil, false, err
+	}
+	return result, true, nil
+}
+
+// persistUpdate saves an updated document in dual-write mode. With the delta log on,
+// the delta was already appended under the document lock and deltaErr is the outcome;
+// the collection is then clean unless a change was marked after deltaGen, the dirty
+// generation read just before the append. Otherwise the document is saved to disk. A failed write is queued for background
+// retry, which is an error for a durable write.
+func (se *StorageEngine) persistUpdate(ctx context.Context, collName, docId string, doc domain.Document, deltaGen uint64, deltaErr error) error {
+	if se.deltaLogEnabled() {
+		if deltaErr != nil {
+			log.Printf("WARN: Failed to append delta for %s/%s: %v", collName, docId, deltaErr)
+			return se.persistFailed(ctx, collName, docId, doc, deltaErr)
+		}
+		se.mu.RLock()
+		if info, exists := se.collections[collName]; exists {
+			info.markSaved(deltaGen)
 		}
+		se.mu.RUnlock()
+		return nil
 	}
 
-	return result, nil
+	// Dual-write: Save document to disk immediately
+	if err := se.saveDocument(ctx, collName, docId, doc); err != nil {
+		// Queue for background retry if immediate write fails
+		return se.persistFailed(ctx, collName, docId, doc, err)
+	}
+	return nil
 }
 
 // updateByIdUnsafe performs the actual update operation (caller must hold collection write lock)
@@ -242,9 +450,12 @@ func (se *StorageEngine) updateByIdUnsafe(collName, docId string, updates domain
 		return nil, err
 	}
 
-	doc, exists := collection.Documents[docId]
+	doc, exists := collection.Get(docId)
 	if !exists {
-		return nil, fmt.Errorf("document with id %s not found in collection %s", docId, collName)
+		return nil, domain.Errorf(domain.ErrDocumentNotFound, "document with id %s not found in collection %s", docId, collName)
+	}
+	if err := se.checkStrictSchema(collName, doc, updates); err != nil {
+		return nil, err
 	}
 
 	// Create a copy of the old document for index updates
@@ -253,27 +464,50 @@ func (se *StorageEngine) updateByIdUnsafe(collName, docId string, updates domain
 		oldDoc[k] = v
 	}
 
+	// Open snapshots keep the old version
+	se.preserveForSnapshots(collName, docId, oldDoc)
+
 	// Apply updates to the document
 	for key, value := range updates {
 		if key != "_id" { // Prevent updating the document ID
 			doc[key] = value
 		}
 	}
+	if collection.Store != nil {
+		// doc is a decoded copy, so the change is only kept once stored again
+		collection.Store.Set(docId, doc)
+	}
 
 	// Update indexes with the change
 	se.updateIndexes(collName, docId, oldDoc, doc)
 
 	// Mark collection as dirty for persistence
 	if _, collectionInfo, found := se.cache.Get(collName); found {
-		collectionInfo.State = CollectionStateDirty
-		collectionInfo.LastModified = time.Now()
+		collectionInfo.markDirty()
 	}
 
+	se.trackAccess(collName, docId)
 	return doc, nil
 }
 
 // ReplaceById completely replaces a document with new content (PUT operation)
 func (se *StorageEngine) ReplaceById(collName, docId string, newDoc domain.Document) (domain.Document, error) {
+	return se.ReplaceByIdContext(context.Background(), collName, docId, newDoc)
+}
+
+// ReplaceByIdContext is like ReplaceById; the request ID carried by ctx is attached to
+// any background retry of the disk write. A ctx from domain.WithDurableWrite makes a
+// failed disk write an error.
+func (se *StorageEngine) ReplaceByIdContext(ctx context.Context, collName, docId string, newDoc domain.Document) (domain.Document, error) {
+	if err := se.checkDurable(ctx); err != nil {
+		return nil, err
+	}
+	release, err := se.writeLimiter.Acquire(ctx, collName)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
 	var result domain.Document
 	var resultErr error
 
@@ -288,7 +522,7 @@ func (se *StorageEngine) ReplaceById(collName, docId string, newDoc domain.Docum
 		}
 	} else {
 		// Dual-write mode: use document-level locking for fine-grained concurrency
-		err := se.withDocumentWriteLock(collName, docId, func() error {
+		err := se.withUniqueDocumentWriteLock(collName, docId, func() error {
 			result, resultErr = se.replaceByIdUnsafe(collName, docId, newDoc)
 			return resultErr
 		})
@@ -299,9 +533,11 @@ func (se *StorageEngine) ReplaceById(collName, docId string, newDoc domain.Docum
 
 	// Dual-write: Save document to disk immediately (unless no-saves mode)
 	if !se.noSaves {
-		if err := se.saveDocumentToDisk(collName, docId, result); err != nil {
+		if err := se.saveDocument(ctx, collName, docId, result); err != nil {
 			// Queue for background retry if immediate write fails
-			se.queueDiskWrite(collName, docId, result)
+			if err := se.persistFailed(ctx, collName, docId, result, err); err != nil {
+				return nil, err
+			}
 		}
 	}
 
@@ -316,9 +552,15 @@ func (se *StorageEngine) replaceByIdUnsafe(collName, docId string, newDoc domain
 		return nil, err
 	}
 
-	oldDoc, exists := collection.Documents[docId]
+	oldDoc, exists := collection.Get(docId)
 	if !exists {
-		return nil, fmt.Errorf("document with id %s not found in collection %s", docId, collName)
+		return nil, domain.Errorf(domain.ErrDocumentNotFound, "document with id %s not found in collection %s", docId, collName)
+	}
+	if err := se.checkStrictSchema(collName, newDoc); err != nil {
+		return nil, err
+	}
+	if err := se.indexEngine.CheckUnique(collName, []string{docId}, []domain.Document{newDoc}); err != nil {
+		return nil, err
 	}
 
 	// Create a copy of the old document for index updates
@@ -327,79 +569,141 @@ func (se *StorageEngine) replaceByIdUnsafe(collName, docId string, newDoc domain
 		oldDocCopy[k] = v
 	}
 
-	// Ensure the new document has the same _id
+	// Ensure the new document has the same _id and creation time
 	newDoc["_id"] = docId
+	se.stampReplacement(oldDoc, newDoc)
+	se.versionReplacement(oldDoc, newDoc)
 
 	// Replace the entire document
-	collection.Documents[docId] = newDoc
+	collection.Set(docId, newDoc)
 
 	// Update indexes with the change (remove old, add new)
 	se.updateIndexes(collName, docId, oldDocCopy, newDoc)
 
 	// Mark collection as dirty for persistence
 	if _, collectionInfo, found := se.cache.Get(collName); found {
-		collectionInfo.State = CollectionStateDirty
-		collectionInfo.LastModified = time.Now()
+		collectionInfo.markDirty()
 	}
 
+	se.trackAccess(collName, docId)
 	return newDoc, nil
 }
 
 // DeleteById removes a specific document by its ID
 func (se *StorageEngine) DeleteById(collName, docId string) error {
+	return se.DeleteByIdContext(context.Background(), collName, docId)
+}
+
+// DeleteByIdContext is like DeleteById; the request ID carried by ctx is attached to
+// any background retry of the collection save
+func (se *StorageEngine) DeleteByIdContext(ctx context.Context, collName, docId string) error {
+	_, err := se.DeleteByIdReturningContext(ctx, collName, docId)
+	return err
+}
+
+// DeleteByIdReturning removes a specific document by its ID and returns the
+// document as it was when removed, e.g. to publish it in an event or archive it
+func (se *StorageEngine) DeleteByIdReturning(collName, docId string) (domain.Document, error) {
+	return se.DeleteByIdReturningContext(context.Background(), collName, docId)
+}
+
+// DeleteByIdReturningContext is like DeleteByIdReturning; the request ID carried by
+// ctx is attached to any background retry of the collection save. A ctx from
+// domain.WithDurableWrite makes a failed save an error.
+func (se *StorageEngine) DeleteByIdReturningContext(ctx context.Context, collName, docId string) (domain.Document, error) {
+	if err := se.checkDurable(ctx); err != nil {
+		return nil, err
+	}
+	release, err := se.writeLimiter.Acquire(ctx, collName)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
 	// Delete operations modify the Documents map, so they need collection write locks
-	err := se.withCollectionWriteLock(collName, func() error {
+	var deleted domain.Document
+	err = se.withCollectionWriteLock(collName, func() error {
 		return se.withDocumentWriteLock(collName, docId, func() error {
-			return se.deleteByIdUnsafe(collName, docId)
+			var err error
+			deleted, err = se.deleteByIdUnsafe(collName, docId)
+			return err
 		})
 	})
 
 	if err != nil {
-		return err
+		return nil, err
 	}
+	se.trackDelete(collName, docId)
 
 	// Dual-write: Save collection to disk immediately (unless no-saves mode)
 	if !se.noSaves {
-		if err := se.SaveCollectionAfterTransaction(collName); err != nil {
-			// For deletes, we need to save the entire collection since we removed a document
-			// Queue for background retry if immediate write fails
-			se.queueDiskWrite(collName, docId, nil) // nil document indicates delete
+		if err := se.persistDelete(collName, docId); err != nil {
+			// Queue for background retry if immediate write fails; nil document indicates delete
+			if err := se.persistFailed(ctx, collName, docId, nil, err); err != nil {
+				return nil, err
+			}
 		}
 	}
 
+	return deleted, nil
+}
+
+// persistDelete saves a delete to disk: as a tombstone in tombstone mode, otherwise
+// by saving the entire collection since a document was removed
+func (se *StorageEngine) persistDelete(collName, docId string) error {
+	if !se.tombstonesEnabled() {
+		return se.SaveCollectionAfterTransaction(collName)
+	}
+	// A buffered save of the document would be written after its tombstone
+	se.unbufferDocument(collName, docId)
+	gen := se.dirtyGeneration(collName)
+	if err := se.appendTombstone(collName, docId); err != nil {
+		return err
+	}
+	se.mu.RLock()
+	if info, exists := se.collections[collName]; exists {
+		info.markSaved(gen)
+	}
+	se.mu.RUnlock()
 	return nil
 }
 
-// deleteByIdUnsafe performs the actual delete operation (caller must hold collection write lock)
-func (se *StorageEngine) deleteByIdUnsafe(collName, docId string) error {
+// deleteByIdUnsafe performs the actual delete operation and returns the removed
+// document (caller must hold collection write lock)
+func (se *StorageEngine) deleteByIdUnsafe(collName, docId string) (domain.Document, error) {
 	collection, err := se.getCollectionInternal(collName)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	doc, exists := collection.Documents[docId]
+	doc, exists := collection.Get(docId)
 	if !exists {
-		return fmt.Errorf("document with id %s not found in collection %s", docId, collName)
+		return nil, domain.Errorf(domain.ErrDocumentNotFound, "document with id %s not found in collection %s", docId, collName)
 	}
 
 	// Update indexes before deleting (newDoc is nil for deletions)
 	se.updateIndexes(collName, docId, doc, nil)
 
-	delete(collection.Documents, docId)
+	collection.Delete(docId)
 
 	// Mark collection as dirty for persistence
 	if _, collectionInfo, found := se.cache.Get(collName); found {
-		collectionInfo.State = CollectionStateDirty
+		collectionInfo.markDirty()
 		collectionInfo.DocumentCount--
-		collectionInfo.LastModified = time.Now()
 	}
 
-	return nil
+	return doc, nil
 }
 
 // FindAll returns documents that match the given filter criteria
 // If filter is nil or empty, returns all documents
 func (se *StorageEngine) FindAll(collName string, filter map[string]interface{}, options *domain.PaginationOptions) (*domain.PaginationResult, error) {
+	return se.FindAllContext(context.Background(), collName, filter, options)
+}
+
+// FindAllContext is like FindAll but stops scanning and returns the context
+// error once ctx is cancelled or its deadline expires
+func (se *StorageEngine) FindAllContext(ctx context.Context, collName string, filter map[string]interface{}, options *domain.PaginationOptions) (*domain.PaginationResult, error) {
 	if options == nil {
 		options = domain.DefaultPaginationOptions()
 	}
@@ -408,11 +712,20 @@ func (se *StorageEngine) FindAll(collName string, filter map[string]interface{},
 		return nil, fmt.Errorf("invalid pagination options: %w", err)
 	}
 
+	if err := ValidateFilter(filter); err != nil {
+		return nil, err
+	}
+	filter = se.applyDefaultFilter(ctx, collName, filter)
+
 	var result *domain.PaginationResult
 	var resultErr error
 
 	err := se.withCollectionReadLock(collName, func() error {
-		result, resultErr = se.findAllUnsafe(collName, filter, options)
+		result, resultErr = se.findAllUnsafe(ctx, collName, filter, options)
+		if resultErr == nil && se.copyOnRead {
+			// Only the returned page is copied, not every match
+			result.Documents = copyDocuments(result.Documents)
+		}
 		return resultErr
 	})
 
@@ -423,7 +736,7 @@ func (se *StorageEngine) FindAll(collName string, filter map[string]interface{},
 }
 
 // findAllUnsafe performs the actual find operation (caller must hold collection read lock)
-func (se *StorageEngine) findAllUnsafe(collName string, filter map[string]interface{}, options *domain.PaginationOptions) (*domain.PaginationResult, error) {
+func (se *StorageEngine) findAllUnsafe(ctx context.Context, collName string, filter map[string]interface{}, options *domain.PaginationOptions) (*domain.PaginationResult, error) {
 	collection, err := se.getCollectionInternal(collName)
 	if err != nil {
 		return nil, err
@@ -438,76 +751,91 @@ func (se *StorageEngine) findAllUnsafe(collName string, filter map[string]interf
 		candidateIDs, useIndex = se.optimizeWithIndexes(collName, filter)
 	}
 
-	if useIndex {
+	scanned := 0
+	if options.Order == domain.OrderInserted {
+		// Walk the insertion order, keeping only index candidates when there are any
+		ids, err := se.insertionOrder.OrderedCollectionIDs(collName, collection)
+		if err != nil {
+			return nil, err
+		}
+		var candidates map[string]bool
+		if useIndex {
+			candidates = make(map[string]bool, len(candidateIDs))
+			for _, docID := range candidateIDs {
+				candidates[docID] = true
+			}
+		}
+		for _, docID := range ids {
+			if err := checkScanContext(ctx, scanned); err != nil {
+				return nil, err
+			}
+			scanned++
+			if candidates != nil && !candidates[docID] {
+				continue
+			}
+			if doc, exists := collection.Get(docID); exists {
+				if len(filter) == 0 || MatchesFilter(doc, filter) {
+					allDocs = append(allDocs, doc)
+					if err := CheckResultSize(len(allDocs), se.maxResultSize); err != nil {
+						return nil, err
+					}
+				}
+			}
+		}
+	} else if useIndex {
 		// Use index optimization
 		for _, docID := range candidateIDs {
-			if doc, exists := collection.Documents[docID]; exists {
+			if err := checkScanContext(ctx, scanned); err != nil {
+				return nil, err
+			}
+			scanned++
+			if doc, exists := collection.Get(docID); exists {
 				if MatchesFilter(doc, filter) {
 					allDocs = append(allDocs, doc)
+					if err := CheckResultSize(len(allDocs), se.maxResultSize); err != nil {
+						return nil, err
+					}
 				}
 			}
 		}
 	} else {
 		// Full scan
-		for _, doc := range collection.Documents {
+		var scanErr error
+		collection.Range(func(_ string, doc domain.Document) bool {
+			if scanErr = checkScanContext(ctx, scanned); scanErr != nil {
+				return false
+			}
+			scanned++
 			if len(filter) == 0 || MatchesFilter(doc, filter) {
 				allDocs = append(allDocs, doc)
+				if scanErr = CheckResultSize(len(allDocs), se.maxResultSize); scanErr != nil {
+					return false
+				}
 			}
+			return true
+		})
+		if scanErr != nil {
+			return nil, scanErr
 		}
 	}
 
 	return se.applyPagination(allDocs, options)
 }
 
-// docGenerator yields matching documents for a given filter, using index optimization if possible.
-func (se *StorageEngine) docGenerator(collName string, filter map[string]interface{}, paginationOptions *domain.PaginationOptions) (<-chan domain.Document, error) {
-	out := make(chan domain.Document, 100)
-
-	se.mu.RLock()
-	collection, err := se.getCollectionInternal(collName)
-	se.mu.RUnlock()
-	if err != nil {
-		close(out)
-		return nil, err
-	}
-
-	go func() {
-		defer close(out)
-		var candidateIDs []string
-		var useIndex bool
-
-		// Try to use index optimization if filter is present
-		if len(filter) > 0 {
-			candidateIDs, useIndex = se.optimizeWithIndexes(collName, filter)
-		}
-
-		if useIndex {
-			for _, docID := range candidateIDs {
-				if doc, exists := collection.Documents[docID]; exists {
-					if MatchesFilter(doc, filter) {
-						out <- doc
-					}
-				}
-			}
-		} else {
-			for _, doc := range collection.Documents {
-				if len(filter) == 0 || MatchesFilter(doc, filter) {
-					out <- doc
-				}
-			}
-		}
-	}()
-	return out, nil
-}
-
-// applyPagination applies pagination to a slice of documents
+// applyPagination applies pagination to a slice of documents, sorting them by the
+// sort field, or by ID unless they are already in insertion order
 func (se *StorageEngine) applyPagination(docs []domain.Document, options *domain.PaginationOptions) (*domain.PaginationResult, error) {
-	// Sort documents by ID for consistent ordering
-	sort.Slice(docs, func(i, j int) bool {
-		idI, _ := docs[i]["_id"].(string)
-		idJ, _ := docs[j]["_id"].(string)
-		return idI < idJ
-	})
+	switch {
+	case options.SortField != "":
+		SortDocuments(docs, options.SortField, options.SortDesc, options.Collation)
+	case options.Order != domain.OrderInserted:
+		// Sort documents by ID for consistent ordering
+		sort.Slice(docs, func(i, j int) bool {
+			idI, _ := docs[i]["_id"].(string)
+			idJ, _ := docs[j]["_id"].(string)
+			return idI < idJ
+		})
+	}
 
 	// Handle cursor-based pagination
 	if options.After != "" || options.Before != "" {
@@ -642,6 +970,8 @@ func (se *StorageEngine) applyOffsetPagination(docs []domain.Document, options *
 		limit = options.MaxLimit
 	}
 
+	result.SetPage(offset, limit)
+
 	// Calculate indices
 	startIndex := offset
 	endIndex := offset + limit
@@ -689,37 +1019,64 @@ func (se *StorageEngine) applyOffsetPagination(docs []domain.Document, options *
 }
 
 // optimizeWithIndexes attempts to use available indexes to optimize the query
-// Returns candidate document IDs and whether index optimization was used
+// Returns candidate document IDs and whether index optimization was used.
+// An $in filter on an indexed field, such as {"_id": {"$in": [...]}}, queries the
+// index once per value and uses the union in the order of the values. Several indexed
+// fields are intersected most selective first (see indexPlan).
 func (se *StorageEngine) optimizeWithIndexes(collName string, filter map[string]interface{}) ([]string, bool) {
-	var indexResults [][]string
+	plan := &indexPlan{}
 
 	// Find all available indexes for the filter fields
 	for fieldName, expectedValue := range filter {
-		if index, exists := se.getIndex(collName, fieldName); exists {
-			ids := index.Query(expectedValue)
-			indexResults = append(indexResults, ids)
+		if isFieldPath(fieldName) {
+			continue
+		}
+		if index, exists := se.getIndex(collName, fieldName); exists && index.Fields == nil && FilterImplies(filter, index.Condition) && indexAnswers(index, expectedValue) {
+			if values, ok := InFilterValues(expectedValue); ok {
+				// Intersections keep the order of the $in results
+				ids := queryIndexIn(index, values)
+				plan.add(fieldName, ids)
+				plan.lead = ids
+				continue
+			}
+			if plan.addScan(fieldName, index, expectedValue) {
+				continue
+			}
+			if value, ok := ContainsFilterValue(expectedValue); ok {
+				// Candidates are checked against the filter, dropping non-array matches
+				expectedValue = value
+			}
+			if !isComparable(expectedValue) {
+				continue
+			}
+			plan.add(fieldName, index.Query(expectedValue))
+		}
+	}
+	for _, index := range se.indexEngine.CompoundIndexes(collName) {
+		if values, ok := CompoundFilterValues(filter, index.Fields); ok {
+			plan.add(index.Field, index.Query(values))
 		}
 	}
 
 	// If no indexes are available, fall back to full scan
-	if len(indexResults) == 0 {
+	if len(plan.lookups) == 0 {
 		return nil, false
 	}
 
-	// If we have multiple indexes, use intersection (AND logic)
-	if len(indexResults) > 1 {
-		candidateIDs := IntersectStringSlices(indexResults...)
-		return candidateIDs, true
-	}
-
-	// Single index optimization
-	return indexResults[0], true
+	candidateIDs, _ := plan.run()
+	return candidateIDs, true
 }
 
 // BatchInsert inserts multiple documents into a collection atomically
 // All documents are inserted successfully or none are inserted (atomic operation)
 // Returns the created documents with their assigned IDs
 func (se *StorageEngine) BatchInsert(collName string, docs []domain.Document) ([]domain.Document, error) {
+	return se.BatchInsertContext(context.Background(), collName, docs)
+}
+
+// BatchInsertContext is like BatchInsert; the request ID carried by ctx is attached to
+// any background retry of the collection save
+func (se *StorageEngine) BatchInsertContext(ctx context.Context, collName string, docs []domain.Document) ([]domain.Document, error) {
 	if len(docs) == 0 {
 		return nil, fmt.Errorf("no documents provided for batch insert")
 	}
@@ -728,22 +1085,43 @@ func (se *StorageEngine) BatchInsert(collName string, docs []domain.Document) ([
 		return nil, fmt.Errorf("batch insert limited to 1000 documents, got %d", len(docs))
 	}
 
+	release, err := se.writeLimiter.Acquire(ctx, collName)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	// Fill in collection defaults and timestamps before IDs are assigned and indexes are updated
+	now := time.Now()
+	for i, doc := range docs {
+		se.applyDocumentDefaults(collName, doc)
+		se.stampInsert(doc, now)
+		if err := se.checkStrictSchema(collName, doc); err != nil {
+			return nil, fmt.Errorf("document %d: %w", i, err)
+		}
+	}
+
 	// First, ensure collection exists and generate all IDs (requires collection lock)
 	docIDs := make([]string, len(docs))
-	err := se.withCollectionWriteLock(collName, func() error {
+	err = se.withCollectionWriteLock(collName, func() error {
 		// Get or load collection
 		_, err := se.getCollectionInternal(collName)
 		if err != nil {
 			// Collection doesn't exist, create it
-			collection := domain.NewCollection(collName)
+			if err := se.validateNewCollection(collName); err != nil {
+				return err
+			}
+			collection := se.newCollection(collName)
 			collectionInfo := &CollectionInfo{
 				Name:          collName,
 				DocumentCount: 0,
 				State:         CollectionStateDirty,
 				LastModified:  time.Now(),
 			}
+			se.mu.Lock()
 			se.collections[collName] = collectionInfo
 			se.cache.Put(collName, collection, collectionInfo)
+			se.mu.Unlock()
 
 			// Initialize indexes for this collection using the index engine
 			se.indexEngine.CreateIndex(collName, "_id")
@@ -780,10 +1158,13 @@ func (se *StorageEngine) BatchInsert(collName string, docs []domain.Document) ([
 		}
 
 		for _, docID := range docIDs {
-			if _, exists := collection.Documents[docID]; exists {
+			if collection.Has(docID) {
 				return fmt.Errorf("document with id %s already exists in collection %s", docID, collName)
 			}
 		}
+		if err := se.indexEngine.CheckUnique(collName, docIDs, docs); err != nil {
+			return err
+		}
 
 		// All IDs are available, proceed with insertions
 		for i, doc := range docs {
@@ -801,6 +1182,8 @@ func (se *StorageEngine) BatchInsert(collName string, docs []domain.Document) ([
 
 			result = append(result, insertDoc)
 		}
+
+		se.trackInsertsUnsafe(collName, docIDs...)
 		return nil
 	})
 
@@ -813,7 +1196,7 @@ func (se *StorageEngine) BatchInsert(collName string, docs []domain.Document) ([
 		if err := se.SaveCollectionAfterTransaction(collName); err != nil {
 			// For batch inserts, we need to save the entire collection
 			// Queue for background retry if immediate write fails
-			se.queueDiskWrite(collName, "", nil) // Empty docID indicates batch operation
+			se.queueDiskWriteContext(ctx, collName, "", nil) // Empty docID indicates batch operation
 		}
 	}
 
@@ -828,15 +1211,20 @@ func (se *StorageEngine) batchInsertUnsafe(collName string, docs []domain.Docume
 	var collectionCreated bool
 	if err != nil {
 		// Collection doesn't exist, create it
-		collection = domain.NewCollection(collName)
+		if err := se.validateNewCollection(collName); err != nil {
+			return nil, err
+		}
+		collection = se.newCollection(collName)
 		collectionInfo := &CollectionInfo{
 			Name:          collName,
 			DocumentCount: 0,
 			State:         CollectionStateDirty,
 			LastModified:  time.Now(),
 		}
+		se.mu.Lock()
 		se.collections[collName] = collectionInfo
 		se.cache.Put(collName, collection, collectionInfo)
+		se.mu.Unlock()
 
 		// Initialize indexes for this collection using the index engine
 		se.indexEngine.CreateIndex(collName, "_id")
@@ -883,7 +1271,7 @@ func (se *StorageEngine) batchInsertUnsafe(collName string, docs []domain.Docume
 		}
 
 		// Validate that the document ID doesn't already exist
-		if _, exists := collection.Documents[newID]; exists {
+		if collection.Has(newID) {
 			// Rollback: Clean up any created collection
 			if collectionCreated {
 				delete(se.collections, collName)
@@ -912,14 +1300,13 @@ func (se *StorageEngine) batchInsertUnsafe(collName string, docs []domain.Docume
 		se.updateIndexes(collName, docWithID.id, nil, docWithID.doc)
 
 		// Add to collection
-		collection.Documents[docWithID.id] = docWithID.doc
+		collection.Set(docWithID.id, docWithID.doc)
 	}
 
 	// Update collection metadata
 	if collectionInfo != nil {
-		collectionInfo.State = CollectionStateDirty
+		collectionInfo.markDirty()
 		collectionInfo.DocumentCount += int64(len(docs))
-		collectionInfo.LastModified = time.Now()
 	}
 
 	// Return the created documents
@@ -950,14 +1337,27 @@ func (se *StorageEngine) BatchUpdate(collName string, operations []domain.BatchU
 		}
 	}
 
+	release, err := se.writeLimiter.Acquire(context.Background(), collName)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
 	// Process each update operation sequentially with document-level locking
 	var result []domain.Document
 	for _, operation := range operations {
 		var updateDoc domain.Document
 		var updateErr error
 
-		err := se.withDocumentWriteLock(collName, operation.ID, func() error {
-			updateDoc, updateErr = se.updateByIdUnsafe(collName, operation.ID, operation.Updates)
+		err := se.withUniqueDocumentWriteLock(collName, operation.ID, func() error {
+			updates, err := se.resolveUpdateUnsafe(collName, operation.ID, se.stampUpdates(operation.Updates))
+			if err != nil {
+				return err
+			}
+			if err := se.checkUniqueUpdateUnsafe(collName, operation.ID, updates); err != nil {
+				return err
+			}
+			updateDoc, updateErr = se.updateByIdUnsafe(collName, operation.ID, updates)
 			return updateErr
 		})
 
@@ -977,7 +1377,7 @@ func (se *StorageEngine) batchUpdateUnsafe(collName string, operations []domain.
 	// Get collection
 	collection, err := se.getCollectionInternal(collName)
 	if err != nil {
-		return nil, fmt.Errorf("collection %s does not exist", collName)
+		return nil, domain.Errorf(domain.ErrCollectionNotFound, "collection %s does not exist", collName)
 	}
 
 	// Phase 1: Validation and preparation (no mutations yet)
@@ -997,9 +1397,9 @@ func (se *StorageEngine) batchUpdateUnsafe(collName string, operations []domain.
 		}
 
 		// Check if document exists
-		existingDoc, exists := collection.Documents[op.ID]
+		existingDoc, exists := collection.Get(op.ID)
 		if !exists {
-			return nil, fmt.Errorf("operation %d: document with id %s not found", i, op.ID)
+			return nil, domain.Errorf(domain.ErrDocumentNotFound, "operation %d: document with id %s not found", i, op.ID)
 		}
 
 		// Create full copy of the original document for rollback
@@ -1040,7 +1440,7 @@ func (se *StorageEngine) batchUpdateUnsafe(collName string, operations []domain.
 		modifiedDocs[validOp.docID] = validOp.originalDoc
 
 		// Apply the update to the actual collection
-		collection.Documents[validOp.docID] = validOp.updatedDoc
+		collection.Set(validOp.docID, validOp.updatedDoc)
 
 		// Update indexes with the change
 		se.updateIndexes(collName, validOp.docID, validOp.originalDoc, validOp.updatedDoc)
@@ -1050,8 +1450,7 @@ func (se *StorageEngine) batchUpdateUnsafe(collName string, operations []domain.
 
 	// Update collection metadata
 	if _, collectionInfo, found := se.cache.Get(collName); found {
-		collectionInfo.State = CollectionStateDirty
-		collectionInfo.LastModified = time.Now()
+		collectionInfo.markDirty()
 	}
 
 	// Return the updated documents
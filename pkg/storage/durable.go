@@ -0,0 +1,28 @@
+package storage
+
+import (
+	"context"
+
+	"github.com/adfharrison1/go-db/pkg/domain"
+)
+
+// checkDurable rejects a durable write (see domain.WithDurableWrite) before it is
+// applied when the engine runs in no-saves mode, as nothing is saved synchronously
+func (se *StorageEngine) checkDurable(ctx context.Context) error {
+	if se.noSaves && domain.DurableWrite(ctx) {
+		return domain.Errorf(domain.ErrNotDurable, "durable writes need dual-write mode; the engine runs with no-saves")
+	}
+	return nil
+}
+
+// persistFailed queues a failed immediate disk write for background retry. Queued
+// writes are reported as successful, except durable ones: they get an ErrNotDurable
+// error. The write stays applied in memory and queued either way, so disk and memory
+// still converge once a retry succeeds.
+func (se *StorageEngine) persistFailed(ctx context.Context, collName, docID string, doc domain.Document, err error) error {
+	se.queueDiskWriteContext(ctx, collName, docID, doc)
+	if !domain.DurableWrite(ctx) {
+		return nil
+	}
+	return domain.Errorf(domain.ErrNotDurable, "write to collection %s was applied in memory but not persisted: %v", collName, err)
+}
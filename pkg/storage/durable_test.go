@@ -0,0 +1,66 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/adfharrison1/go-db/pkg/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStorageEngine_DurableWrites(t *testing.T) {
+	tempDir := t.TempDir()
+	engine := NewStorageEngine(WithDataDir(tempDir))
+	defer engine.StopBackgroundWorkers()
+	durable := domain.WithDurableWrite(context.Background())
+
+	doc, err := engine.InsertContext(durable, "payments", domain.Document{"amount": 10})
+	require.NoError(t, err)
+	docID := doc["_id"].(string)
+	assert.FileExists(t, filepath.Join(tempDir, "collections", "payments.godb"))
+
+	// A file in place of the collections directory makes every save fail
+	collectionsDir := filepath.Join(tempDir, "collections")
+	require.NoError(t, os.RemoveAll(collectionsDir))
+	require.NoError(t, os.WriteFile(collectionsDir, []byte("blocked"), 0644))
+
+	t.Run("fast path still succeeds", func(t *testing.T) {
+		_, err := engine.Insert("payments", domain.Document{"amount": 20})
+		assert.NoError(t, err)
+	})
+
+	t.Run("durable writes fail", func(t *testing.T) {
+		_, err := engine.InsertContext(durable, "payments", domain.Document{"amount": 30})
+		assert.True(t, errors.Is(err, domain.ErrNotDurable), "insert: %v", err)
+
+		_, err = engine.UpdateByIdContext(durable, "payments", docID, domain.Document{"amount": 11})
+		assert.True(t, errors.Is(err, domain.ErrNotDurable), "update: %v", err)
+
+		_, err = engine.ReplaceByIdContext(durable, "payments", docID, domain.Document{"amount": 12})
+		assert.True(t, errors.Is(err, domain.ErrNotDurable), "replace: %v", err)
+
+		err = engine.DeleteByIdContext(durable, "payments", docID)
+		assert.True(t, errors.Is(err, domain.ErrNotDurable), "delete: %v", err)
+	})
+
+	t.Run("other errors are unchanged", func(t *testing.T) {
+		_, err := engine.UpdateByIdContext(durable, "payments", "missing", domain.Document{"amount": 1})
+		assert.True(t, errors.Is(err, domain.ErrDocumentNotFound))
+	})
+}
+
+func TestStorageEngine_DurableWritesNoSaves(t *testing.T) {
+	engine := NewStorageEngine(WithDataDir(t.TempDir()), WithNoSaves(true))
+	defer engine.StopBackgroundWorkers()
+
+	_, err := engine.InsertContext(domain.WithDurableWrite(context.Background()), "payments", domain.Document{"amount": 10})
+	assert.True(t, errors.Is(err, domain.ErrNotDurable))
+
+	// Rejected before the write is applied
+	_, err = engine.GetById("payments", "1")
+	assert.Error(t, err)
+}
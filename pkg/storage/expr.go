@@ -0,0 +1,667 @@
+package storage
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/adfharrison1/go-db/pkg/domain"
+)
+
+// ExprFilterKey is the filter key used for expression predicates, e.g.
+// {"$expr": "price * quantity > 100"}
+const ExprFilterKey = "$expr"
+
+// maxExprLength bounds the size of an expression to keep parsing cheap
+const maxExprLength = 1024
+
+// maxCachedExprs bounds the compiled expression cache
+const maxCachedExprs = 256
+
+// Expression is a compiled, sandboxed predicate over document fields.
+// Only arithmetic (+ - * / %), comparison (== != < <= > >=) and boolean
+// (&& || !, or the keywords and/or/not) operators are supported. Field names
+// may use dot notation to reach into nested documents. Function calls are rejected.
+type Expression struct {
+	source string
+	root   exprNode
+}
+
+// String returns the original expression source
+func (e *Expression) String() string {
+	return e.source
+}
+
+// Matches evaluates the expression against a document. Runtime type errors
+// (e.g. arithmetic on a missing or non-numeric field) are reported as errors.
+func (e *Expression) Matches(doc domain.Document) (bool, error) {
+	value, err := e.root.eval(doc)
+	if err != nil {
+		return false, err
+	}
+	result, ok := value.(bool)
+	if !ok {
+		return false, fmt.Errorf("expression must evaluate to a boolean, got %s", typeName(value))
+	}
+	return result, nil
+}
+
+var exprCache = struct {
+	sync.RWMutex
+	entries map[string]*Expression
+}{entries: make(map[string]*Expression)}
+
+// CompileExpr parses and type-checks an expression, reusing a cached
+// compilation when the same source has been seen before
+func CompileExpr(source string) (*Expression, error) {
+	exprCache.RLock()
+	cached, ok := exprCache.entries[source]
+	exprCache.RUnlock()
+	if ok {
+		return cached, nil
+	}
+
+	compiled, err := ParseExpr(source)
+	if err != nil {
+		return nil, err
+	}
+
+	exprCache.Lock()
+	if len(exprCache.entries) >= maxCachedExprs {
+		exprCache.entries = make(map[string]*Expression)
+	}
+	exprCache.entries[source] = compiled
+	exprCache.Unlock()
+
+	return compiled, nil
+}
+
+// ParseExpr parses and type-checks an expression without caching
+func ParseExpr(source string) (*Expression, error) {
+	root, kind, err := parseExprNode(source)
+	if err != nil {
+		return nil, err
+	}
+	if kind != kindBool && kind != kindUnknown {
+		return nil, fmt.Errorf("expression must evaluate to a boolean, got %s", kind)
+	}
+
+	return &Expression{source: source, root: root}, nil
+}
+
+// parseExprNode parses and type-checks an expression of any result type
+func parseExprNode(source string) (exprNode, valueKind, error) {
+	if strings.TrimSpace(source) == "" {
+		return nil, kindUnknown, fmt.Errorf("expression is empty")
+	}
+	if len(source) > maxExprLength {
+		return nil, kindUnknown, fmt.Errorf("expression exceeds maximum length of %d characters", maxExprLength)
+	}
+
+	tokens, err := tokenizeExpr(source)
+	if err != nil {
+		return nil, kindUnknown, err
+	}
+
+	p := &exprParser{tokens: tokens}
+	root, err := p.parseExpression(0)
+	if err != nil {
+		return nil, kindUnknown, err
+	}
+	if tok := p.peek(); tok.kind != tokEOF {
+		return nil, kindUnknown, fmt.Errorf("unexpected %s at position %d", tok, tok.pos)
+	}
+
+	kind, err := root.check()
+	if err != nil {
+		return nil, kindUnknown, err
+	}
+
+	return root, kind, nil
+}
+
+// --- Tokenizer ---
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokNumber
+	tokString
+	tokIdent
+	tokOperator
+	tokLParen
+	tokRParen
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	num  float64
+	pos  int
+}
+
+func (t token) String() string {
+	switch t.kind {
+	case tokEOF:
+		return "end of expression"
+	case tokString:
+		return strconv.Quote(t.text)
+	default:
+		return fmt.Sprintf("'%s'", t.text)
+	}
+}
+
+var exprOperators = []string{"==", "!=", "<=", ">=", "&&", "||", "<", ">", "+", "-", "*", "/", "%", "!"}
+
+func tokenizeExpr(source string) ([]token, error) {
+	var tokens []token
+	i := 0
+
+	for i < len(source) {
+		c := rune(source[i])
+
+		switch {
+		case unicode.IsSpace(c):
+			i++
+
+		case c == '(':
+			tokens = append(tokens, token{kind: tokLParen, text: "(", pos: i})
+			i++
+
+		case c == ')':
+			tokens = append(tokens, token{kind: tokRParen, text: ")", pos: i})
+			i++
+
+		case c == '\'' || c == '"':
+			start := i
+			i++
+			var sb strings.Builder
+			closed := false
+			for i < len(source) {
+				if source[i] == '\\' && i+1 < len(source) {
+					sb.WriteByte(source[i+1])
+					i += 2
+					continue
+				}
+				if rune(source[i]) == c {
+					closed = true
+					i++
+					break
+				}
+				sb.WriteByte(source[i])
+				i++
+			}
+			if !closed {
+				return nil, fmt.Errorf("unterminated string starting at position %d", start)
+			}
+			tokens = append(tokens, token{kind: tokString, text: sb.String(), pos: start})
+
+		case unicode.IsDigit(c) || (c == '.' && i+1 < len(source) && unicode.IsDigit(rune(source[i+1]))):
+			start := i
+			for i < len(source) && (unicode.IsDigit(rune(source[i])) || source[i] == '.') {
+				i++
+			}
+			// Optional exponent
+			if i < len(source) && (source[i] == 'e' || source[i] == 'E') {
+				j := i + 1
+				if j < len(source) && (source[j] == '+' || source[j] == '-') {
+					j++
+				}
+				if j < len(source) && unicode.IsDigit(rune(source[j])) {
+					i = j
+					for i < len(source) && unicode.IsDigit(rune(source[i])) {
+						i++
+					}
+				}
+			}
+			text := source[start:i]
+			num, err := strconv.ParseFloat(text, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid number '%s' at position %d", text, start)
+			}
+			tokens = append(tokens, token{kind: tokNumber, text: text, num: num, pos: start})
+
+		case unicode.IsLetter(c) || c == '_' || c == '$':
+			start := i
+			for i < len(source) {
+				r := rune(source[i])
+				if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' || r == '$' || r == '.' {
+					i++
+					continue
+				}
+				break
+			}
+			text := source[start:i]
+			if strings.HasSuffix(text, ".") || strings.Contains(text, "..") {
+				return nil, fmt.Errorf("invalid field name '%s' at position %d", text, start)
+			}
+			tokens = append(tokens, token{kind: tokIdent, text: text, pos: start})
+
+		default:
+			matched := false
+			for _, op := range exprOperators {
+				if strings.HasPrefix(source[i:], op) {
+					tokens = append(tokens, token{kind: tokOperator, text: op, pos: i})
+					i += len(op)
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				return nil, fmt.Errorf("unexpected character '%c' at position %d", c, i)
+			}
+		}
+	}
+
+	tokens = append(tokens, token{kind: tokEOF, pos: len(source)})
+	return tokens, nil
+}
+
+// --- Parser (Pratt / precedence climbing) ---
+
+// binaryPrecedence returns the binding power of a binary operator, higher binds tighter
+func binaryPrecedence(op string) int {
+	switch op {
+	case "||", "or":
+		return 1
+	case "&&", "and":
+		return 2
+	case "==", "!=":
+		return 3
+	case "<", "<=", ">", ">=":
+		return 4
+	case "+", "-":
+		return 5
+	case "*", "/", "%":
+		return 6
+	default:
+		return 0
+	}
+}
+
+// unaryPrecedence binds tighter than any binary operator
+const unaryPrecedence = 7
+
+type exprParser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *exprParser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *exprParser) next() token {
+	tok := p.tokens[p.pos]
+	if tok.kind != tokEOF {
+		p.pos++
+	}
+	return tok
+}
+
+// operatorText returns the operator for a token, treating and/or/not keywords as operators
+func operatorText(tok token) (string, bool) {
+	switch tok.kind {
+	case tokOperator:
+		return tok.text, true
+	case tokIdent:
+		switch strings.ToLower(tok.text) {
+		case "and":
+			return "&&", true
+		case "or":
+			return "||", true
+		case "not":
+			return "!", true
+		}
+	}
+	return "", false
+}
+
+func (p *exprParser) parseExpression(minPrec int) (exprNode, error) {
+	left, err := p.parsePrefix()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		op, ok := operatorText(p.peek())
+		if !ok {
+			return left, nil
+		}
+		prec := binaryPrecedence(op)
+		if prec == 0 || prec <= minPrec {
+			return left, nil
+		}
+		p.next()
+
+		right, err := p.parseExpression(prec)
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryNode{op: op, left: left, right: right}
+	}
+}
+
+func (p *exprParser) parsePrefix() (exprNode, error) {
+	tok := p.next()
+
+	if op, ok := operatorText(tok); ok {
+		if op != "-" && op != "!" {
+			return nil, fmt.Errorf("unexpected %s at position %d", tok, tok.pos)
+		}
+		operand, err := p.parseExpression(unaryPrecedence - 1)
+		if err != nil {
+			return nil, err
+		}
+		return &unaryNode{op: op, operand: operand}, nil
+	}
+
+	switch tok.kind {
+	case tokNumber:
+		return &literalNode{value: tok.num}, nil
+	case tokString:
+		return &literalNode{value: tok.text}, nil
+	case tokLParen:
+		inner, err := p.parseExpression(0)
+		if err != nil {
+			return nil, err
+		}
+		if closing := p.next(); closing.kind != tokRParen {
+			return nil, fmt.Errorf("expected ')' at position %d, got %s", closing.pos, closing)
+		}
+		return inner, nil
+	case tokIdent:
+		switch strings.ToLower(tok.text) {
+		case "true":
+			return &literalNode{value: true}, nil
+		case "false":
+			return &literalNode{value: false}, nil
+		case "null":
+			return &literalNode{value: nil}, nil
+		}
+		if p.peek().kind == tokLParen {
+			return nil, fmt.Errorf("unknown function '%s' at position %d", tok.text, tok.pos)
+		}
+		return &fieldNode{path: strings.Split(tok.text, ".")}, nil
+	default:
+		return nil, fmt.Errorf("unexpected %s at position %d", tok, tok.pos)
+	}
+}
+
+// --- AST and evaluation ---
+
+// valueKind is the static type used during type checking
+type valueKind int
+
+const (
+	kindUnknown valueKind = iota
+	kindNumber
+	kindString
+	kindBool
+	kindNull
+)
+
+func (k valueKind) String() string {
+	switch k {
+	case kindNumber:
+		return "number"
+	case kindString:
+		return "string"
+	case kindBool:
+		return "boolean"
+	case kindNull:
+		return "null"
+	default:
+		return "unknown"
+	}
+}
+
+type exprNode interface {
+	eval(doc domain.Document) (interface{}, error)
+	check() (valueKind, error)
+}
+
+type literalNode struct {
+	value interface{}
+}
+
+func (n *literalNode) eval(doc domain.Document) (interface{}, error) {
+	return n.value, nil
+}
+
+func (n *literalNode) check() (valueKind, error) {
+	return kindOf(n.value), nil
+}
+
+type fieldNode struct {
+	path []string
+}
+
+func (n *fieldNode) eval(doc domain.Document) (interface{}, error) {
+	var current interface{} = map[string]interface{}(doc)
+	for _, part := range n.path {
+		var m map[string]interface{}
+		switch v := current.(type) {
+		case map[string]interface{}:
+			m = v
+		case domain.Document:
+			m = v
+		default:
+			return nil, nil
+		}
+		current = m[part]
+	}
+	return current, nil
+}
+
+func (n *fieldNode) check() (valueKind, error) {
+	return kindUnknown, nil
+}
+
+type unaryNode struct {
+	op      string
+	operand exprNode
+}
+
+func (n *unaryNode) eval(doc domain.Document) (interface{}, error) {
+	value, err := n.operand.eval(doc)
+	if err != nil {
+		return nil, err
+	}
+	switch n.op {
+	case "-":
+		num, ok := ToFloat64(value)
+		if !ok {
+			return nil, fmt.Errorf("cannot negate %s", typeName(value))
+		}
+		return -num, nil
+	default: // "!"
+		b, ok := value.(bool)
+		if !ok {
+			return nil, fmt.Errorf("cannot apply '!' to %s", typeName(value))
+		}
+		return !b, nil
+	}
+}
+
+func (n *unaryNode) check() (valueKind, error) {
+	kind, err := n.operand.check()
+	if err != nil {
+		return kindUnknown, err
+	}
+	if n.op == "-" {
+		if kind != kindNumber && kind != kindUnknown {
+			return kindUnknown, fmt.Errorf("type error: cannot negate %s", kind)
+		}
+		return kindNumber, nil
+	}
+	if kind != kindBool && kind != kindUnknown {
+		return kindUnknown, fmt.Errorf("type error: cannot apply '!' to %s", kind)
+	}
+	return kindBool, nil
+}
+
+type binaryNode struct {
+	op    string
+	left  exprNode
+	right exprNode
+}
+
+func (n *binaryNode) eval(doc domain.Document) (interface{}, error) {
+	left, err := n.left.eval(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	// Short-circuit boolean operators
+	if n.op == "&&" || n.op == "||" {
+		lb, ok := left.(bool)
+		if !ok {
+			return nil, fmt.Errorf("cannot apply '%s' to %s", n.op, typeName(left))
+		}
+		if (n.op == "&&" && !lb) || (n.op == "||" && lb) {
+			return lb, nil
+		}
+		right, err := n.right.eval(doc)
+		if err != nil {
+			return nil, err
+		}
+		rb, ok := right.(bool)
+		if !ok {
+			return nil, fmt.Errorf("cannot apply '%s' to %s", n.op, typeName(right))
+		}
+		return rb, nil
+	}
+
+	right, err := n.right.eval(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	switch n.op {
+	case "==":
+		return ValuesMatch(left, right), nil
+	case "!=":
+		return !ValuesMatch(left, right), nil
+	case "<", "<=", ">", ">=":
+		return compareValues(n.op, left, right)
+	default:
+		return arithmetic(n.op, left, right)
+	}
+}
+
+func (n *binaryNode) check() (valueKind, error) {
+	left, err := n.left.check()
+	if err != nil {
+		return kindUnknown, err
+	}
+	right, err := n.right.check()
+	if err != nil {
+		return kindUnknown, err
+	}
+
+	known := func(k valueKind) bool { return k != kindUnknown }
+
+	switch n.op {
+	case "&&", "||":
+		for _, k := range []valueKind{left, right} {
+			if known(k) && k != kindBool {
+				return kindUnknown, fmt.Errorf("type error: cannot apply '%s' to %s", n.op, k)
+			}
+		}
+		return kindBool, nil
+	case "==", "!=":
+		return kindBool, nil
+	case "<", "<=", ">", ">=":
+		for _, k := range []valueKind{left, right} {
+			if known(k) && k != kindNumber && k != kindString {
+				return kindUnknown, fmt.Errorf("type error: cannot compare %s with '%s'", k, n.op)
+			}
+		}
+		if known(left) && known(right) && left != right {
+			return kindUnknown, fmt.Errorf("type error: cannot compare %s with %s", left, right)
+		}
+		return kindBool, nil
+	default:
+		for _, k := range []valueKind{left, right} {
+			if known(k) && k != kindNumber {
+				return kindUnknown, fmt.Errorf("type error: cannot apply '%s' to %s", n.op, k)
+			}
+		}
+		return kindNumber, nil
+	}
+}
+
+// compareValues applies an ordering operator. Strings that are both RFC 3339 times
+// compare chronologically (see CompareValues).
+func compareValues(op string, left, right interface{}) (bool, error) {
+	cmp, ok := CompareValues(left, right)
+	if !ok {
+		return false, fmt.Errorf("cannot compare %s with %s", typeName(left), typeName(right))
+	}
+	switch op {
+	case "<":
+		return cmp < 0, nil
+	case "<=":
+		return cmp <= 0, nil
+	case ">":
+		return cmp > 0, nil
+	default:
+		return cmp >= 0, nil
+	}
+}
+
+func arithmetic(op string, left, right interface{}) (interface{}, error) {
+	ln, lok := ToFloat64(left)
+	rn, rok := ToFloat64(right)
+	if !lok || !rok {
+		return nil, fmt.Errorf("cannot apply '%s' to %s and %s", op, typeName(left), typeName(right))
+	}
+
+	switch op {
+	case "+":
+		return ln + rn, nil
+	case "-":
+		return ln - rn, nil
+	case "*":
+		return ln * rn, nil
+	case "/":
+		if rn == 0 {
+			return nil, fmt.Errorf("division by zero")
+		}
+		return ln / rn, nil
+	default: // "%"
+		if rn == 0 {
+			return nil, fmt.Errorf("division by zero")
+		}
+		return math.Mod(ln, rn), nil
+	}
+}
+
+func kindOf(value interface{}) valueKind {
+	if value == nil {
+		return kindNull
+	}
+	if _, ok := ToFloat64(value); ok {
+		return kindNumber
+	}
+	switch value.(type) {
+	case string:
+		return kindString
+	case bool:
+		return kindBool
+	default:
+		return kindUnknown
+	}
+}
+
+func typeName(value interface{}) string {
+	if kind := kindOf(value); kind != kindUnknown {
+		return kind.String()
+	}
+	return fmt.Sprintf("%T", value)
+}
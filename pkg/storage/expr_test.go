@@ -0,0 +1,177 @@
+package storage
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/adfharrison1/go-db/pkg/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func evalExpr(t *testing.T, source string, doc domain.Document) interface{} {
+	t.Helper()
+	compiled, err := ParseExpr(source)
+	require.NoError(t, err)
+	value, err := compiled.root.eval(doc)
+	require.NoError(t, err)
+	return value
+}
+
+func TestExpr_OperatorPrecedence(t *testing.T) {
+	doc := domain.Document{"a": 2, "b": 3, "c": 4}
+
+	cases := []struct {
+		expr     string
+		expected interface{}
+	}{
+		{"a + b * c == 14", true},
+		{"(a + b) * c == 20", true},
+		{"a * b + c == 10", true},
+		{"c - b - a == -1", true}, // left associative
+		{"c / a / a == 1", true},  // left associative
+		{"c % b + a == 3", true},
+		{"-a * b == -6", true},
+		{"a < b == true", true}, // comparison binds tighter than equality
+		{"a < b && b < c", true},
+		{"false && false || true", true}, // && binds tighter than ||
+		{"true || false && false", true},
+		{"!(a > b) && c > b", true},
+		{"not (a > b) and c > b", true},
+		{"a > b or c > b", true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.expr, func(t *testing.T) {
+			assert.Equal(t, tc.expected, evalExpr(t, tc.expr, doc))
+		})
+	}
+}
+
+func TestExpr_FieldsAndLiterals(t *testing.T) {
+	doc := domain.Document{
+		"price":    12.5,
+		"quantity": 10,
+		"name":     "Widget",
+		"active":   true,
+		"address":  map[string]interface{}{"city": "Boston"},
+	}
+
+	assert.Equal(t, true, evalExpr(t, "price * quantity > 100", doc))
+	assert.Equal(t, true, evalExpr(t, "name == 'widget'", doc)) // equality follows filter semantics
+	assert.Equal(t, true, evalExpr(t, `address.city == "Boston"`, doc))
+	assert.Equal(t, true, evalExpr(t, "active && name > 'A'", doc))
+	assert.Equal(t, true, evalExpr(t, "missing == null", doc))
+	assert.Equal(t, true, evalExpr(t, "1.5e2 == 150", doc))
+}
+
+func TestExpr_StaticTypeErrors(t *testing.T) {
+	cases := []string{
+		"'a' * 2 > 1",
+		"true + 1 > 0",
+		"-'abc' == 1",
+		"!5",
+		"1 && true",
+		"'a' < 1",
+		"!price > 1", // unary binds tighter than comparison
+		"price * 2",  // not a boolean
+	}
+
+	for _, expr := range cases {
+		t.Run(expr, func(t *testing.T) {
+			_, err := ParseExpr(expr)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestExpr_RuntimeTypeErrors(t *testing.T) {
+	doc := domain.Document{"name": "Widget", "price": 10, "zero": 0}
+
+	cases := []string{
+		"name * 2 > 1",
+		"missing + 1 > 0",
+		"price / zero > 1",
+		"name < price",
+		"price && true",
+	}
+
+	for _, expr := range cases {
+		t.Run(expr, func(t *testing.T) {
+			compiled, err := ParseExpr(expr)
+			require.NoError(t, err)
+			_, err = compiled.Matches(doc)
+			assert.Error(t, err)
+			// A runtime error means the document simply does not match
+			assert.False(t, MatchesFilter(doc, map[string]interface{}{ExprFilterKey: expr}))
+		})
+	}
+}
+
+func TestExpr_SyntaxErrors(t *testing.T) {
+	cases := map[string]string{
+		"":                  "empty",
+		"len(name) > 3":     "unknown function",
+		"os.Exit(1)":        "unknown function",
+		"price >":           "unexpected",
+		"(price > 1":        "expected ')'",
+		"price > 1)":        "unexpected",
+		"name == 'unclosed": "unterminated string",
+		"price ; 1":         "unexpected character",
+		"price = 1":         "unexpected character",
+		"price. > 1":        "invalid field name",
+		"* 2 > 1":           "unexpected",
+	}
+
+	for expr, message := range cases {
+		t.Run(expr, func(t *testing.T) {
+			_, err := ParseExpr(expr)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), message)
+		})
+	}
+}
+
+func TestExpr_MatchesFilter(t *testing.T) {
+	doc := domain.Document{"name": "Widget", "price": 12.5, "quantity": 10}
+
+	assert.True(t, MatchesFilter(doc, map[string]interface{}{ExprFilterKey: "price * quantity > 100"}))
+	assert.False(t, MatchesFilter(doc, map[string]interface{}{ExprFilterKey: "price * quantity > 200"}))
+	assert.True(t, MatchesFilter(doc, map[string]interface{}{"name": "widget", ExprFilterKey: "quantity >= 10"}))
+	assert.False(t, MatchesFilter(doc, map[string]interface{}{"name": "gadget", ExprFilterKey: "quantity >= 10"}))
+}
+
+func TestValidateFilter_Expr(t *testing.T) {
+	assert.NoError(t, ValidateFilter(nil))
+	assert.NoError(t, ValidateFilter(map[string]interface{}{"name": "x"}))
+	assert.NoError(t, ValidateFilter(map[string]interface{}{ExprFilterKey: "a > 1"}))
+
+	err := ValidateFilter(map[string]interface{}{ExprFilterKey: "a >"})
+	assert.True(t, errors.Is(err, domain.ErrInvalidFilter))
+
+	err = ValidateFilter(map[string]interface{}{ExprFilterKey: 42})
+	assert.True(t, errors.Is(err, domain.ErrInvalidFilter))
+}
+
+func TestFindAll_ExprFilter(t *testing.T) {
+	engine := NewStorageEngine(WithNoSaves(true))
+	defer engine.StopBackgroundWorkers()
+
+	_, err := engine.Insert("orders", domain.Document{"price": 5, "quantity": 10})
+	require.NoError(t, err)
+	_, err = engine.Insert("orders", domain.Document{"price": 20, "quantity": 10})
+	require.NoError(t, err)
+	_, err = engine.Insert("orders", domain.Document{"price": "n/a", "quantity": 10})
+	require.NoError(t, err)
+
+	result, err := engine.FindAll("orders", map[string]interface{}{ExprFilterKey: "price * quantity > 100"}, nil)
+	require.NoError(t, err)
+	require.Len(t, result.Documents, 1)
+	assert.Equal(t, 20, result.Documents[0]["price"])
+
+	_, err = engine.FindAll("orders", map[string]interface{}{ExprFilterKey: "sqrt(price) > 1"}, nil)
+	assert.True(t, errors.Is(err, domain.ErrInvalidFilter))
+
+	_, err = engine.FindAllStream("orders", map[string]interface{}{ExprFilterKey: "price >"})
+	assert.True(t, errors.Is(err, domain.ErrInvalidFilter))
+}
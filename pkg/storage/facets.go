@@ -0,0 +1,135 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/adfharrison1/go-db/pkg/domain"
+)
+
+// MaxFacetFields bounds the number of fields tallied in a single facets request
+const MaxFacetFields = 32
+
+// Facets counts the documents matching filter for each value of each requested field
+func (se *StorageEngine) Facets(collName string, filter map[string]interface{}, fields []string) (map[string]map[interface{}]int64, error) {
+	return se.FacetsContext(context.Background(), collName, filter, fields)
+}
+
+// FacetsContext counts the documents matching filter for each value of each requested
+// field in a single scan. When the effective filter is empty, fields with a full
+// (not partial) index are counted from the index key sets without touching documents.
+func (se *StorageEngine) FacetsContext(ctx context.Context, collName string, filter map[string]interface{}, fields []string) (map[string]map[interface{}]int64, error) {
+	if err := ValidateFacetFields(fields); err != nil {
+		return nil, err
+	}
+	if err := ValidateFilter(filter); err != nil {
+		return nil, err
+	}
+	filter = se.applyDefaultFilter(ctx, collName, filter)
+
+	var result map[string]map[interface{}]int64
+	err := se.withCollectionReadLock(collName, func() error {
+		collection, err := se.getCollectionInternal(collName)
+		if err != nil {
+			return err
+		}
+
+		result = NewFacetCounts(fields)
+		scanFields := fields
+		if len(filter) == 0 {
+			scanFields = nil
+			for _, field := range fields {
+				if index, exists := se.indexEngine.GetIndex(collName, field); exists && index.Fields == nil && index.Condition == nil && index.Collation == "" && !index.Multikey() {
+					AddIndexFacetCounts(result[field], index.ValueCounts())
+				} else {
+					scanFields = append(scanFields, field)
+				}
+			}
+			if len(scanFields) == 0 {
+				return nil
+			}
+		}
+
+		scanned := 0
+		return rangeDocuments(collection, func(_ string, doc domain.Document) error {
+			if err := checkScanContext(ctx, scanned); err != nil {
+				return err
+			}
+			scanned++
+			if len(filter) == 0 || MatchesFilter(doc, filter) {
+				AddFacetCounts(result, doc, scanFields)
+			}
+			return nil
+		})
+	})
+
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// ValidateFacetFields checks the field list of a facets request
+func ValidateFacetFields(fields []string) error {
+	if len(fields) == 0 {
+		return fmt.Errorf("at least one facet field is required")
+	}
+	if len(fields) > MaxFacetFields {
+		return fmt.Errorf("facets limited to %d fields, got %d", MaxFacetFields, len(fields))
+	}
+	for _, field := range fields {
+		if field == "" {
+			return fmt.Errorf("facet field name cannot be empty")
+		}
+	}
+	return nil
+}
+
+// NewFacetCounts creates an empty tally for each field
+func NewFacetCounts(fields []string) map[string]map[interface{}]int64 {
+	counts := make(map[string]map[interface{}]int64, len(fields))
+	for _, field := range fields {
+		counts[field] = make(map[interface{}]int64)
+	}
+	return counts
+}
+
+// AddFacetCounts tallies a document's values for the given fields. Fields may use
+// dot notation. Missing fields, objects and arrays are not counted.
+func AddFacetCounts(counts map[string]map[interface{}]int64, doc domain.Document, fields []string) {
+	for _, field := range fields {
+		value, exists := lookupFieldPath(doc, strings.Split(field, "."))
+		if !exists {
+			continue
+		}
+		if key, ok := FacetKey(value); ok {
+			counts[field][key]++
+		}
+	}
+}
+
+// AddIndexFacetCounts merges index value counts into a field's tally
+func AddIndexFacetCounts(counts map[interface{}]int64, indexCounts map[interface{}]int64) {
+	for value, count := range indexCounts {
+		if key, ok := FacetKey(value); ok {
+			counts[key] += count
+		}
+	}
+}
+
+// FacetKey normalizes a value for tallying: numbers are counted as float64 so
+// that 1 and 1.0 share a bucket, and values that cannot be map keys are rejected
+func FacetKey(value interface{}) (interface{}, bool) {
+	if value == nil {
+		return nil, true
+	}
+	if num, ok := ToFloat64(value); ok {
+		return num, true
+	}
+	if !reflect.TypeOf(value).Comparable() {
+		return nil, false
+	}
+	return value, true
+}
@@ -0,0 +1,103 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/adfharrison1/go-db/pkg/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func insertFacetProducts(t *testing.T, engine *StorageEngine) {
+	products := []domain.Document{
+		{"brand": "acme", "color": "red", "price": 10, "meta": map[string]interface{}{"origin": "us"}},
+		{"brand": "acme", "color": "blue", "price": 20, "meta": map[string]interface{}{"origin": "us"}},
+		{"brand": "globex", "color": "red", "price": 10.0, "tags": []interface{}{"sale"}},
+		{"brand": "initech", "price": 30},
+	}
+	_, err := engine.BatchInsert("products", products)
+	require.NoError(t, err)
+}
+
+func TestStorageEngine_Facets(t *testing.T) {
+	engine := NewStorageEngine(WithNoSaves(true))
+	defer engine.StopBackgroundWorkers()
+	insertFacetProducts(t, engine)
+
+	facets, err := engine.Facets("products", nil, []string{"brand", "color", "price", "meta.origin", "tags"})
+	require.NoError(t, err)
+
+	assert.Equal(t, map[interface{}]int64{"acme": 2, "globex": 1, "initech": 1}, facets["brand"])
+	assert.Equal(t, map[interface{}]int64{"red": 2, "blue": 1}, facets["color"])
+	assert.Equal(t, map[interface{}]int64{float64(10): 2, float64(20): 1, float64(30): 1}, facets["price"])
+	assert.Equal(t, map[interface{}]int64{"us": 2}, facets["meta.origin"])
+	assert.Empty(t, facets["tags"], "arrays are not counted")
+
+	facets, err = engine.Facets("products", map[string]interface{}{"color": "red"}, []string{"brand"})
+	require.NoError(t, err)
+	assert.Equal(t, map[interface{}]int64{"acme": 1, "globex": 1}, facets["brand"])
+}
+
+func TestStorageEngine_Facets_UsesIndex(t *testing.T) {
+	engine := NewStorageEngine(WithNoSaves(true))
+	defer engine.StopBackgroundWorkers()
+	insertFacetProducts(t, engine)
+	require.NoError(t, engine.CreateIndex("products", "brand"))
+
+	facets, err := engine.Facets("products", nil, []string{"brand", "color"})
+	require.NoError(t, err)
+	assert.Equal(t, map[interface{}]int64{"acme": 2, "globex": 1, "initech": 1}, facets["brand"])
+	assert.Equal(t, map[interface{}]int64{"red": 2, "blue": 1}, facets["color"])
+
+	// Index counts follow updates and deletes
+	result, err := engine.FindAll("products", map[string]interface{}{"brand": "globex"}, nil)
+	require.NoError(t, err)
+	require.Len(t, result.Documents, 1)
+	require.NoError(t, engine.DeleteById("products", result.Documents[0]["_id"].(string)))
+
+	facets, err = engine.Facets("products", nil, []string{"brand"})
+	require.NoError(t, err)
+	assert.Equal(t, map[interface{}]int64{"acme": 2, "initech": 1}, facets["brand"])
+}
+
+func TestStorageEngine_Facets_DefaultFilter(t *testing.T) {
+	engine := NewStorageEngine(WithNoSaves(true))
+	defer engine.StopBackgroundWorkers()
+	insertFacetProducts(t, engine)
+	require.NoError(t, engine.CreateIndex("products", "brand"))
+
+	engine.SetCollectionDefaultFilter("products", map[string]interface{}{"color": "red"})
+
+	facets, err := engine.Facets("products", nil, []string{"brand"})
+	require.NoError(t, err)
+	assert.Equal(t, map[interface{}]int64{"acme": 1, "globex": 1}, facets["brand"])
+
+	facets, err = engine.FacetsContext(domain.WithoutDefaultFilter(context.Background()), "products", nil, []string{"brand"})
+	require.NoError(t, err)
+	assert.Equal(t, map[interface{}]int64{"acme": 2, "globex": 1, "initech": 1}, facets["brand"])
+}
+
+func TestStorageEngine_Facets_Errors(t *testing.T) {
+	engine := NewStorageEngine(WithNoSaves(true))
+	defer engine.StopBackgroundWorkers()
+	insertFacetProducts(t, engine)
+
+	_, err := engine.Facets("products", nil, nil)
+	assert.Error(t, err)
+
+	_, err = engine.Facets("products", nil, []string{""})
+	assert.Error(t, err)
+
+	_, err = engine.Facets("missing", nil, []string{"brand"})
+	assert.Error(t, err)
+
+	_, err = engine.Facets("products", map[string]interface{}{ExprFilterKey: "price +"}, []string{"brand"})
+	assert.True(t, errors.Is(err, domain.ErrInvalidFilter))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = engine.FacetsContext(ctx, "products", nil, []string{"brand"})
+	assert.True(t, errors.Is(err, context.Canceled))
+}
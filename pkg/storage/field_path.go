@@ -0,0 +1,76 @@
+package storage
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/adfharrison1/go-db/pkg/domain"
+	"github.com/adfharrison1/go-db/pkg/indexing"
+)
+
+// isFieldPath reports whether a filter field is a dotted path into nested values,
+// such as items.0.sku. Indexes hold top-level fields only, so paths are always
+// matched by scanning documents.
+func isFieldPath(field string) bool {
+	return strings.Contains(field, ".")
+}
+
+// fieldPathValues resolves a dotted field path to the values it names in a document.
+// Each segment names a field of an object. On an array, a numeric segment picks the
+// element at that position (items.0.sku is the first item's sku) and any other
+// segment is applied to every object element (items.sku is the sku of each item).
+// It returns nil when the path names nothing.
+func fieldPathValues(doc domain.Document, path string) []interface{} {
+	values := []interface{}{map[string]interface{}(doc)}
+	for _, segment := range strings.Split(path, ".") {
+		var next []interface{}
+		for _, value := range values {
+			next = appendSegmentValues(next, value, segment)
+		}
+		if len(next) == 0 {
+			return nil
+		}
+		values = next
+	}
+	return values
+}
+
+// appendSegmentValues appends the values one path segment names in value
+func appendSegmentValues(values []interface{}, value interface{}, segment string) []interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		if field, exists := v[segment]; exists {
+			values = append(values, field)
+		}
+		return values
+	case domain.Document:
+		if field, exists := v[segment]; exists {
+			values = append(values, field)
+		}
+		return values
+	}
+
+	elements, isArray := indexing.ArrayElements(value)
+	if !isArray {
+		return values
+	}
+	if position, err := strconv.Atoi(segment); err == nil {
+		if position >= 0 && position < len(elements) {
+			values = append(values, elements[position])
+		}
+		return values
+	}
+	for _, element := range elements {
+		switch fields := element.(type) {
+		case map[string]interface{}:
+			if field, exists := fields[segment]; exists {
+				values = append(values, field)
+			}
+		case domain.Document:
+			if field, exists := fields[segment]; exists {
+				values = append(values, field)
+			}
+		}
+	}
+	return values
+}
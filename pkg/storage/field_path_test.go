@@ -0,0 +1,58 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/adfharrison1/go-db/pkg/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFieldPath_MatchesFilter(t *testing.T) {
+	doc := domain.Document{
+		"customer": map[string]interface{}{"name": "Ann", "tags": []interface{}{"vip"}},
+		"items": []interface{}{
+			map[string]interface{}{"sku": "A", "qty": 1},
+			map[string]interface{}{"sku": "B", "qty": 5},
+		},
+		"a.b": "literal",
+	}
+
+	assert.True(t, MatchesFilter(doc, map[string]interface{}{"items.0.sku": "A"}))
+	assert.False(t, MatchesFilter(doc, map[string]interface{}{"items.0.sku": "B"}), "position 0 is the first item only")
+	assert.True(t, MatchesFilter(doc, map[string]interface{}{"items.1.sku": "B"}))
+	assert.False(t, MatchesFilter(doc, map[string]interface{}{"items.2.sku": "A"}), "position past the end")
+
+	assert.True(t, MatchesFilter(doc, map[string]interface{}{"items.sku": "B"}), "any item's sku")
+	assert.False(t, MatchesFilter(doc, map[string]interface{}{"items.sku": "C"}))
+	assert.True(t, MatchesFilter(doc, map[string]interface{}{"items.qty": map[string]interface{}{"$gt": 3}}))
+	assert.False(t, MatchesFilter(doc, map[string]interface{}{"items.qty": map[string]interface{}{"$gt": 5}}))
+
+	assert.True(t, MatchesFilter(doc, map[string]interface{}{"customer.name": "Ann"}))
+	assert.True(t, MatchesFilter(doc, map[string]interface{}{"customer.tags": map[string]interface{}{"$contains": "vip"}}))
+	assert.False(t, MatchesFilter(doc, map[string]interface{}{"customer.email": "ann@example.com"}))
+
+	// A field holding the dotted name wins over the path
+	assert.True(t, MatchesFilter(doc, map[string]interface{}{"a.b": "literal"}))
+}
+
+func TestFieldPath_FindSkipsIndex(t *testing.T) {
+	engine := NewStorageEngine(WithNoSaves(true))
+	t.Cleanup(engine.StopBackgroundWorkers)
+
+	_, err := engine.Insert("orders", domain.Document{"status": "open", "items": []interface{}{map[string]interface{}{"sku": "A"}}})
+	require.NoError(t, err)
+	_, err = engine.Insert("orders", domain.Document{"status": "open", "items": []interface{}{
+		map[string]interface{}{"sku": "B"}, map[string]interface{}{"sku": "A"},
+	}})
+	require.NoError(t, err)
+	require.NoError(t, engine.CreateIndex("orders", "status"))
+
+	ids, err := engine.FindIds("orders", map[string]interface{}{"status": "open", "items.0.sku": "A"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"1"}, ids)
+
+	result, err := engine.FindAll("orders", map[string]interface{}{"items.sku": "A"}, nil)
+	require.NoError(t, err)
+	assert.Len(t, result.Documents, 2)
+}
@@ -0,0 +1,196 @@
+package storage
+
+import (
+	"container/heap"
+	"context"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/adfharrison1/go-db/pkg/domain"
+)
+
+// CollectionFieldKey is the field FindAcross adds to each result, naming the
+// collection the document came from
+const CollectionFieldKey = "_collection"
+
+// collectionPatternChars are the glob metacharacters marking a collection pattern
+const collectionPatternChars = "*?["
+
+// IsCollectionPattern reports whether name is a glob pattern over collection names,
+// such as logs_2024_01_*, rather than the name of one collection
+func IsCollectionPattern(name string) bool {
+	return strings.ContainsAny(name, collectionPatternChars)
+}
+
+// MatchCollections returns the names matching a glob pattern (path.Match syntax, so *
+// matches any run of characters and a trailing * makes the pattern a prefix), sorted
+// so that date-suffixed collections come out in date order
+func MatchCollections(pattern string, names []string) ([]string, error) {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, domain.Errorf(domain.ErrInvalidCollectionName, "invalid collection pattern %q: %v", pattern, err)
+	}
+
+	var matched []string
+	for _, name := range names {
+		if ok, _ := path.Match(pattern, name); ok {
+			matched = append(matched, name)
+		}
+	}
+	sort.Strings(matched)
+	return matched, nil
+}
+
+// FindAcross pages through the documents streamed from each collection in turn,
+// with each collection's documents in _id order. Only limit/offset pagination is
+// supported, as a cursor cannot name a position across collections. Each returned
+// document is a shallow copy with CollectionFieldKey set. Results are merged without
+// holding every match: at most offset+limit+1 documents of one collection are kept
+// at a time, and collections after the last page are not read. Total, and so
+// TotalPages, is not set, since counting every match would mean reading every
+// collection.
+func FindAcross(ctx context.Context, collections []string, stream func(ctx context.Context, collName string) (<-chan domain.Document, error), options *domain.PaginationOptions) (*domain.PaginationResult, error) {
+	if options == nil {
+		options = domain.DefaultPaginationOptions()
+	}
+	if err := options.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid pagination options: %w", err)
+	}
+	if options.After != "" || options.Before != "" {
+		return nil, fmt.Errorf("%w: cursors are not supported across collections; use offset", domain.ErrInvalidCursor)
+	}
+	if options.Order == domain.OrderInserted {
+		return nil, fmt.Errorf("order %s is not supported across collections", domain.OrderInserted)
+	}
+	if options.SortField != "" {
+		return nil, fmt.Errorf("sorting by field %s is not supported across collections", options.SortField)
+	}
+
+	limit := options.Limit
+	if limit <= 0 {
+		limit = 50
+	}
+	if options.MaxLimit > 0 && limit > options.MaxLimit {
+		limit = options.MaxLimit
+	}
+
+	result := &domain.PaginationResult{Documents: []domain.Document{}, HasPrev: options.Offset > 0}
+	result.SetPage(options.Offset, limit)
+	skip := options.Offset
+	// One document past the page tells whether there is a next page
+	want := options.Offset + limit + 1
+
+	for _, collName := range collections {
+		docs, err := firstDocumentsByID(ctx, collName, stream, want)
+		if err != nil {
+			return nil, err
+		}
+		want -= len(docs)
+
+		for _, doc := range docs {
+			if skip > 0 {
+				skip--
+				continue
+			}
+			if len(result.Documents) == limit {
+				result.HasNext = true
+				return result, nil
+			}
+			tagged := make(domain.Document, len(doc)+1)
+			for key, value := range doc {
+				tagged[key] = value
+			}
+			tagged[CollectionFieldKey] = collName
+			result.Documents = append(result.Documents, tagged)
+		}
+		if want == 0 {
+			break
+		}
+	}
+	return result, nil
+}
+
+// firstDocumentsByID drains a collection's stream and returns its first n documents
+// in _id order, never holding more than n
+func firstDocumentsByID(ctx context.Context, collName string, stream func(ctx context.Context, collName string) (<-chan domain.Document, error), n int) ([]domain.Document, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	docs, err := stream(ctx, collName)
+	if err != nil {
+		return nil, err
+	}
+
+	kept := &documentMaxHeap{}
+	for doc := range docs {
+		if kept.Len() < n {
+			heap.Push(kept, doc)
+		} else if lessDocumentID(documentID(doc), documentID((*kept)[0])) {
+			(*kept)[0] = doc
+			heap.Fix(kept, 0)
+		}
+	}
+	// A stream closed by the deadline is partial
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	sorted := make([]domain.Document, kept.Len())
+	for i := len(sorted) - 1; i >= 0; i-- {
+		sorted[i] = heap.Pop(kept).(domain.Document)
+	}
+	return sorted, nil
+}
+
+// documentID returns a document's _id, or "" if it has none
+func documentID(doc domain.Document) string {
+	id, _ := doc["_id"].(string)
+	return id
+}
+
+// documentMaxHeap is a heap of documents with the greatest _id on top
+type documentMaxHeap []domain.Document
+
+func (h documentMaxHeap) Len() int { return len(h) }
+func (h documentMaxHeap) Less(i, j int) bool {
+	return lessDocumentID(documentID(h[j]), documentID(h[i]))
+}
+func (h documentMaxHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *documentMaxHeap) Push(x interface{}) { *h = append(*h, x.(domain.Document)) }
+func (h *documentMaxHeap) Pop() interface{} {
+	old := *h
+	doc := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return doc
+}
+
+// FindAcrossCollections returns a page of the documents matching filter in every
+// collection whose name matches a glob pattern, such as logs_2024_01_*, in collection
+// name order and then _id order. See FindAcross for the pagination rules.
+func (se *StorageEngine) FindAcrossCollections(pattern string, filter map[string]interface{}, options *domain.PaginationOptions) (*domain.PaginationResult, error) {
+	return se.FindAcrossCollectionsContext(context.Background(), pattern, filter, options)
+}
+
+// FindAcrossCollectionsContext is like FindAcrossCollections but stops and returns the
+// context error once ctx is cancelled or its deadline expires
+func (se *StorageEngine) FindAcrossCollectionsContext(ctx context.Context, pattern string, filter map[string]interface{}, options *domain.PaginationOptions) (*domain.PaginationResult, error) {
+	if err := ValidateFilter(filter); err != nil {
+		return nil, err
+	}
+
+	se.mu.RLock()
+	names := make([]string, 0, len(se.collections))
+	for name := range se.collections {
+		names = append(names, name)
+	}
+	se.mu.RUnlock()
+
+	collections, err := MatchCollections(pattern, names)
+	if err != nil {
+		return nil, err
+	}
+	return FindAcross(ctx, collections, func(ctx context.Context, collName string) (<-chan domain.Document, error) {
+		return se.FindAllStreamContext(ctx, collName, filter)
+	}, options)
+}
@@ -0,0 +1,111 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/adfharrison1/go-db/pkg/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMatchCollections(t *testing.T) {
+	names := []string{"logs_2024_01_02", "users", "logs_2024_01_01", "logs_2024_02_01"}
+
+	matched, err := MatchCollections("logs_2024_01_*", names)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"logs_2024_01_01", "logs_2024_01_02"}, matched)
+
+	matched, err = MatchCollections("logs_2024_0?_01", names)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"logs_2024_01_01", "logs_2024_02_01"}, matched)
+
+	matched, err = MatchCollections("metrics_*", names)
+	require.NoError(t, err)
+	assert.Empty(t, matched)
+
+	_, err = MatchCollections("logs_[", names)
+	assert.True(t, errors.Is(err, domain.ErrInvalidCollectionName))
+
+	assert.True(t, IsCollectionPattern("logs_*"))
+	assert.False(t, IsCollectionPattern("logs_2024_01_01"))
+}
+
+func TestStorageEngine_FindAcrossCollections(t *testing.T) {
+	engine := NewStorageEngine(WithNoSaves(true))
+	defer engine.StopBackgroundWorkers()
+
+	// Three days of logs, 12 entries a day, every third an error
+	days := []string{"logs_2024_01_03", "logs_2024_01_01", "logs_2024_01_02"}
+	for _, day := range days {
+		for i := 1; i <= 12; i++ {
+			_, err := engine.Insert(day, domain.Document{"n": i, "level": map[bool]string{true: "error", false: "info"}[i%3 == 0]})
+			require.NoError(t, err)
+		}
+	}
+	_, err := engine.Insert("users", domain.Document{"level": "error"})
+	require.NoError(t, err)
+
+	page := func(limit, offset int) *domain.PaginationOptions {
+		options := domain.DefaultPaginationOptions()
+		options.Limit = limit
+		options.Offset = offset
+		return options
+	}
+	positions := func(result *domain.PaginationResult) []string {
+		var positions []string
+		for _, doc := range result.Documents {
+			positions = append(positions, fmt.Sprintf("%s/%s", doc[CollectionFieldKey], doc["_id"]))
+		}
+		return positions
+	}
+
+	// Collections in name order, each in _id order with numeric IDs by value
+	filter := map[string]interface{}{"level": "error"}
+	result, err := engine.FindAcrossCollections("logs_2024_01_*", filter, page(5, 0))
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"logs_2024_01_01/3", "logs_2024_01_01/6", "logs_2024_01_01/9", "logs_2024_01_01/12",
+		"logs_2024_01_02/3",
+	}, positions(result))
+	assert.True(t, result.HasNext)
+	assert.False(t, result.HasPrev)
+
+	result, err = engine.FindAcrossCollections("logs_2024_01_*", filter, page(5, 10))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"logs_2024_01_03/9", "logs_2024_01_03/12"}, positions(result))
+	assert.False(t, result.HasNext)
+	assert.True(t, result.HasPrev)
+
+	// A page ending exactly at the last match has no next page
+	result, err = engine.FindAcrossCollections("logs_*", nil, page(36, 0))
+	require.NoError(t, err)
+	assert.Len(t, result.Documents, 36)
+	assert.False(t, result.HasNext)
+
+	// Results are tagged copies; the stored documents are untouched
+	stored, err := engine.GetById("logs_2024_01_01", "3")
+	require.NoError(t, err)
+	assert.NotContains(t, stored, CollectionFieldKey)
+
+	options := page(5, 0)
+	options.After = "cursor"
+	_, err = engine.FindAcrossCollections("logs_*", nil, options)
+	assert.True(t, errors.Is(err, domain.ErrInvalidCursor))
+
+	_, err = engine.FindAcrossCollections("logs_*", map[string]interface{}{"n": map[string]interface{}{"$contains": []interface{}{1}}}, nil)
+	assert.True(t, errors.Is(err, domain.ErrInvalidFilter))
+
+	result, err = engine.FindAcrossCollections("metrics_*", nil, nil)
+	require.NoError(t, err)
+	assert.Empty(t, result.Documents)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Nanosecond)
+	defer cancel()
+	time.Sleep(time.Millisecond)
+	_, err = engine.FindAcrossCollectionsContext(ctx, "logs_*", nil, nil)
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+}
@@ -0,0 +1,130 @@
+package storage
+
+import (
+	"context"
+	"sort"
+
+	"github.com/adfharrison1/go-db/pkg/domain"
+	"github.com/adfharrison1/go-db/pkg/indexing"
+)
+
+// FindIds returns the IDs of documents matching a filter, sorted
+func (se *StorageEngine) FindIds(collName string, filter map[string]interface{}) ([]string, error) {
+	return se.FindIdsContext(context.Background(), collName, filter)
+}
+
+// FindIdsContext returns the sorted IDs of documents matching a filter without
+// copying their contents. When every filter field is indexed the IDs come straight
+// from the index key sets and no document is read.
+func (se *StorageEngine) FindIdsContext(ctx context.Context, collName string, filter map[string]interface{}) ([]string, error) {
+	if err := ValidateFilter(filter); err != nil {
+		return nil, err
+	}
+	filter = se.applyDefaultFilter(ctx, collName, filter)
+
+	var ids []string
+	err := se.withCollectionReadLock(collName, func() error {
+		var err error
+		ids, err = se.findIdsUnsafe(ctx, collName, filter)
+		return err
+	})
+
+	if err != nil {
+		return nil, err
+	}
+	if ids == nil {
+		ids = []string{}
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+// findIdsUnsafe returns the IDs of the documents matching filter, unsorted, using
+// indexes when they apply (caller must hold collection lock)
+func (se *StorageEngine) findIdsUnsafe(ctx context.Context, collName string, filter map[string]interface{}) ([]string, error) {
+	collection, err := se.getCollectionInternal(collName)
+	if err != nil {
+		return nil, err
+	}
+
+	if indexed, ok := IndexOnlyIDs(filter, func(field string) (*indexing.Index, bool) {
+		return se.getIndex(collName, field)
+	}); ok {
+		return indexed, nil
+	}
+
+	var ids []string
+	if candidateIDs, useIndex := se.optimizeWithIndexes(collName, filter); useIndex {
+		for i, id := range candidateIDs {
+			if err := checkScanContext(ctx, i); err != nil {
+				return nil, err
+			}
+			if doc, exists := collection.Get(id); exists && MatchesFilter(doc, filter) {
+				ids = append(ids, id)
+			}
+		}
+		return ids, nil
+	}
+
+	scanned := 0
+	err = rangeDocuments(collection, func(id string, doc domain.Document) error {
+		if err := checkScanContext(ctx, scanned); err != nil {
+			return err
+		}
+		scanned++
+		if len(filter) == 0 || MatchesFilter(doc, filter) {
+			ids = append(ids, id)
+		}
+		return nil
+	})
+	return ids, err
+}
+
+// IndexOnlyIDs answers a filter from index key sets alone. The returned slice is
+// not shared with the index, so callers may sort it. It reports false for an empty
+// filter, an $expr predicate, a $contains, $elemMatch, $ne or $nin condition, a
+// dotted field path or any field without an index the filter may use (see
+// FilterImplies); those must read documents.
+func IndexOnlyIDs(filter map[string]interface{}, getIndex func(field string) (*indexing.Index, bool)) ([]string, bool) {
+	if len(filter) == 0 {
+		return nil, false
+	}
+
+	plan := &indexPlan{}
+	for field, expectedValue := range filter {
+		if field == ExprFilterKey || isFieldPath(field) {
+			return nil, false
+		}
+		index, exists := getIndex(field)
+		if !exists || index.Fields != nil || !FilterImplies(filter, index.Condition) || !indexAnswers(index, expectedValue) {
+			return nil, false
+		}
+		if _, ok := ContainsFilterValue(expectedValue); ok {
+			// The index also holds fields that equal the value without being arrays
+			return nil, false
+		}
+		if _, ok := ElemMatchFilter(expectedValue); ok {
+			return nil, false
+		}
+		if _, _, ok := NeFilterValue(expectedValue); ok {
+			return nil, false
+		}
+		if _, ok := NinFilterValues(expectedValue); ok {
+			return nil, false
+		}
+		if _, ok, _ := RegexFilterPattern(expectedValue); ok {
+			return nil, false
+		}
+		if plan.addScan(field, index, expectedValue) {
+			continue
+		}
+		values, ok := InFilterValues(expectedValue)
+		if !ok {
+			values = []interface{}{expectedValue}
+		}
+		plan.add(field, queryIndexIn(index, values))
+	}
+
+	ids, _ := plan.run()
+	return ids, true
+}
@@ -0,0 +1,117 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/adfharrison1/go-db/pkg/domain"
+	"github.com/adfharrison1/go-db/pkg/indexing"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newFindIdsTestEngine(t *testing.T) *StorageEngine {
+	engine := NewStorageEngine(WithNoSaves(true))
+	t.Cleanup(engine.StopBackgroundWorkers)
+
+	docs := []domain.Document{
+		{"name": "Alice", "team": "core", "age": 30},
+		{"name": "Bob", "team": "web", "age": 25},
+		{"name": "Carol", "team": "core", "age": 35},
+		{"name": "Dave", "team": "core", "age": 25},
+	}
+	for _, doc := range docs {
+		_, err := engine.Insert("users", doc)
+		require.NoError(t, err)
+	}
+	return engine
+}
+
+func TestFindIds_Filters(t *testing.T) {
+	engine := newFindIdsTestEngine(t)
+
+	ids, err := engine.FindIds("users", nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"1", "2", "3", "4"}, ids)
+
+	// Unindexed field falls back to a scan
+	ids, err = engine.FindIds("users", map[string]interface{}{"team": "core"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"1", "3", "4"}, ids)
+
+	// Indexed field narrowed by an unindexed one
+	require.NoError(t, engine.CreateIndex("users", "team"))
+	ids, err = engine.FindIds("users", map[string]interface{}{"team": "core", "age": 25})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"4"}, ids)
+
+	ids, err = engine.FindIds("users", map[string]interface{}{"$expr": "age > 28"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"1", "3"}, ids)
+
+	ids, err = engine.FindIds("users", map[string]interface{}{"team": "ops"})
+	require.NoError(t, err)
+	assert.Empty(t, ids)
+	assert.NotNil(t, ids)
+
+	_, err = engine.FindIds("users", map[string]interface{}{"$expr": "age >"})
+	assert.ErrorIs(t, err, domain.ErrInvalidFilter)
+
+	_, err = engine.FindIds("missing", nil)
+	assert.Error(t, err)
+}
+
+func TestFindIds_FullyIndexed(t *testing.T) {
+	engine := newFindIdsTestEngine(t)
+	require.NoError(t, engine.CreateIndex("users", "team"))
+
+	filter := map[string]interface{}{
+		"team": "core",
+		"_id":  map[string]interface{}{"$in": []interface{}{"4", "2", "1"}},
+	}
+	ids, err := engine.FindIds("users", filter)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"1", "4"}, ids)
+
+	// Sorting the result must not reorder the index's own ID lists
+	index, exists := engine.getIndex("users", "team")
+	require.True(t, exists)
+	before := append([]string(nil), index.Query("core")...)
+	_, err = engine.FindIds("users", map[string]interface{}{"team": "core"})
+	require.NoError(t, err)
+	assert.Equal(t, before, index.Query("core"))
+
+	// Default filters on unindexed fields still read the documents
+	engine.SetCollectionDefaultFilter("users", map[string]interface{}{"age": 25})
+	ids, err = engine.FindIds("users", map[string]interface{}{"team": "core"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"4"}, ids)
+}
+
+func TestIndexOnlyIDs(t *testing.T) {
+	index := indexing.NewIndex("team")
+	index.UpdateIndex("1", nil, domain.Document{"team": "core"})
+	index.UpdateIndex("2", nil, domain.Document{"team": "web"})
+	getIndex := func(field string) (*indexing.Index, bool) {
+		return index, field == "team"
+	}
+
+	ids, ok := IndexOnlyIDs(map[string]interface{}{"team": "core"}, getIndex)
+	assert.True(t, ok)
+	assert.Equal(t, []string{"1"}, ids)
+
+	ids, ok = IndexOnlyIDs(map[string]interface{}{"team": map[string]interface{}{"$in": []interface{}{"web", "core"}}}, getIndex)
+	assert.True(t, ok)
+	assert.Equal(t, []string{"2", "1"}, ids)
+
+	// Unhashable values match nothing instead of panicking
+	ids, ok = IndexOnlyIDs(map[string]interface{}{"team": map[string]interface{}{"a": 1}}, getIndex)
+	assert.True(t, ok)
+	assert.Empty(t, ids)
+
+	_, ok = IndexOnlyIDs(map[string]interface{}{"team": "core", "age": 30}, getIndex)
+	assert.False(t, ok)
+	_, ok = IndexOnlyIDs(map[string]interface{}{"team": "core", "$expr": "true"}, getIndex)
+	assert.False(t, ok)
+	_, ok = IndexOnlyIDs(nil, getIndex)
+	assert.False(t, ok)
+}
@@ -4,6 +4,8 @@ import (
 	"encoding/binary"
 	"fmt"
 	"io"
+
+	"github.com/adfharrison1/go-db/pkg/indexing"
 )
 
 const (
@@ -57,9 +59,10 @@ func ReadHeader(r io.Reader) (*FileHeader, error) {
 
 // StorageData represents the actual data structure we store
 type StorageData struct {
-	Collections map[string]map[string]interface{} `msgpack:"collections"`
-	Indexes     map[string]map[string][]string    `msgpack:"indexes,omitempty"`
-	Metadata    map[string]interface{}            `msgpack:"metadata,omitempty"`
+	Collections      map[string]map[string]interface{}     `msgpack:"collections"`
+	Indexes          map[string]map[string][]string        `msgpack:"indexes,omitempty"` // Written by older versions; only the fields are read
+	IndexDefinitions map[string][]indexing.IndexDefinition `msgpack:"index_definitions,omitempty"`
+	Metadata         map[string]interface{}                `msgpack:"metadata,omitempty"`
 }
 
 // NewStorageData creates a new empty storage data structure
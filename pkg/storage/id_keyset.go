@@ -0,0 +1,223 @@
+package storage
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/adfharrison1/go-db/pkg/domain"
+)
+
+// IDKeyset holds a collection's document IDs sorted in _id order (numeric IDs by
+// value), so the document before or after any ID is found by binary search instead
+// of sorting the collection. Inserts of increasing generated IDs append; other
+// inserts and deletes shift the slice.
+type IDKeyset struct {
+	mu  sync.RWMutex
+	ids []string
+}
+
+// NewIDKeyset creates a keyset holding ids, which it takes ownership of
+func NewIDKeyset(ids []string) *IDKeyset {
+	sort.Slice(ids, func(i, j int) bool {
+		return lessDocumentID(ids[i], ids[j])
+	})
+	return &IDKeyset{ids: ids}
+}
+
+// Len returns the number of IDs in the keyset
+func (k *IDKeyset) Len() int {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return len(k.ids)
+}
+
+// search returns the position of the first ID not ordered before id.
+// Caller must hold k.mu.
+func (k *IDKeyset) search(id string) int {
+	return sort.Search(len(k.ids), func(i int) bool {
+		return !lessDocumentID(k.ids[i], id)
+	})
+}
+
+// Add inserts an ID, keeping the keyset sorted
+func (k *IDKeyset) Add(id string) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	i := k.search(id)
+	if i < len(k.ids) && k.ids[i] == id {
+		return
+	}
+	k.ids = append(k.ids, "")
+	copy(k.ids[i+1:], k.ids[i:])
+	k.ids[i] = id
+}
+
+// Remove deletes an ID if present
+func (k *IDKeyset) Remove(id string) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	i := k.search(id)
+	if i < len(k.ids) && k.ids[i] == id {
+		k.ids = append(k.ids[:i], k.ids[i+1:]...)
+	}
+}
+
+// Next returns the first ID ordered after id, which need not be in the keyset
+func (k *IDKeyset) Next(id string) (string, bool) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	i := k.search(id)
+	if i < len(k.ids) && k.ids[i] == id {
+		i++
+	}
+	if i >= len(k.ids) {
+		return "", false
+	}
+	return k.ids[i], true
+}
+
+// Prev returns the last ID ordered before id, which need not be in the keyset
+func (k *IDKeyset) Prev(id string) (string, bool) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	i := k.search(id)
+	if i == 0 {
+		return "", false
+	}
+	return k.ids[i-1], true
+}
+
+// IDKeysets holds the keysets of an engine's collections. A keyset is only built the
+// first time a collection is navigated by ID, and after that is kept up to date by
+// DocumentChanged.
+type IDKeysets struct {
+	mu   sync.Mutex
+	sets map[string]*IDKeyset
+}
+
+// NewIDKeysets creates an empty set of keysets
+func NewIDKeysets() *IDKeysets {
+	return &IDKeysets{sets: make(map[string]*IDKeyset)}
+}
+
+// Get returns a collection's keyset, building it from listIDs if there is none yet or
+// the keyset's size differs from count, the collection's current document count, which
+// catches documents loaded or removed without DocumentChanged. Caller must keep the
+// collection's documents from changing while listIDs runs.
+func (ks *IDKeysets) Get(collName string, count int, listIDs func() []string) *IDKeyset {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	if keyset, exists := ks.sets[collName]; exists && keyset.Len() == count {
+		return keyset
+	}
+	keyset := NewIDKeyset(listIDs())
+	ks.sets[collName] = keyset
+	return keyset
+}
+
+// Invalidate discards a collection's keyset, so that the next Get rebuilds it
+func (ks *IDKeysets) Invalidate(collName string) {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	delete(ks.sets, collName)
+}
+
+// DocumentChanged records an insert (nil oldDoc) or delete (nil newDoc) in the
+// collection's keyset, if it has been built. Updates leave the keyset unchanged.
+func (ks *IDKeysets) DocumentChanged(collName, docID string, oldDoc, newDoc domain.Document) {
+	if (oldDoc == nil) == (newDoc == nil) {
+		return
+	}
+
+	ks.mu.Lock()
+	keyset, exists := ks.sets[collName]
+	ks.mu.Unlock()
+	if !exists {
+		return
+	}
+
+	if oldDoc == nil {
+		keyset.Add(docID)
+	} else {
+		keyset.Remove(docID)
+	}
+}
+
+// AdjacentID returns the ID after (next) or before id in keyset, or an error naming
+// the collection when there is none
+func AdjacentID(keyset *IDKeyset, collName, id string, next bool) (string, error) {
+	if next {
+		if adjacent, ok := keyset.Next(id); ok {
+			return adjacent, nil
+		}
+		return "", fmt.Errorf("no document after id %s in collection %s", id, collName)
+	}
+	if adjacent, ok := keyset.Prev(id); ok {
+		return adjacent, nil
+	}
+	return "", fmt.Errorf("no document before id %s in collection %s", id, collName)
+}
+
+// GetNextById returns the document following afterId in _id order, with numeric IDs
+// ordered by value. afterId need not exist, so navigation can continue from a deleted
+// document.
+func (se *StorageEngine) GetNextById(collName, afterId string) (domain.Document, error) {
+	return se.getAdjacentById(collName, afterId, true)
+}
+
+// GetPrevById returns the document preceding beforeId in _id order, with numeric IDs
+// ordered by value. beforeId need not exist.
+func (se *StorageEngine) GetPrevById(collName, beforeId string) (domain.Document, error) {
+	return se.getAdjacentById(collName, beforeId, false)
+}
+
+// getAdjacentById looks up the neighbour of id in the collection's keyset and reads it
+// as GetById does
+func (se *StorageEngine) getAdjacentById(collName, id string, next bool) (domain.Document, error) {
+	var result domain.Document
+	var adjacentID string
+
+	err := se.withCollectionReadLock(collName, func() error {
+		collection, err := se.getCollectionInternal(collName)
+		if err != nil {
+			return err
+		}
+		listIDs := collection.IDs
+
+		// A keyset missing a change made without DocumentChanged can name a deleted
+		// document; it is rebuilt once in that case
+		for attempt := 0; attempt < 2; attempt++ {
+			keyset := se.idKeysets.Get(collName, collection.Len(), listIDs)
+			adjacentID, err = AdjacentID(keyset, collName, id, next)
+			if err != nil {
+				return err
+			}
+
+			var exists bool
+			se.withDocumentReadLock(collName, adjacentID, func() error {
+				result, exists = collection.Get(adjacentID)
+				if exists && se.copyOnRead {
+					result = CopyDocument(result)
+				}
+				return nil
+			})
+			if exists {
+				return nil
+			}
+			se.idKeysets.Invalidate(collName)
+		}
+		return domain.Errorf(domain.ErrDocumentNotFound, "document with id %s not found in collection %s", adjacentID, collName)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	se.trackAccess(collName, adjacentID)
+	return result, nil
+}
@@ -0,0 +1,119 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/adfharrison1/go-db/pkg/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIDKeyset(t *testing.T) {
+	keyset := NewIDKeyset([]string{"10", "b", "2", "a", "1"})
+
+	next, ok := keyset.Next("2")
+	assert.True(t, ok)
+	assert.Equal(t, "10", next, "numeric IDs are ordered by value")
+
+	next, _ = keyset.Next("10")
+	assert.Equal(t, "a", next, "other IDs follow the numeric ones")
+
+	prev, _ := keyset.Prev("a")
+	assert.Equal(t, "10", prev)
+
+	// The starting ID need not be in the keyset
+	next, _ = keyset.Next("5")
+	assert.Equal(t, "10", next)
+	prev, _ = keyset.Prev("5")
+	assert.Equal(t, "2", prev)
+
+	_, ok = keyset.Next("b")
+	assert.False(t, ok)
+	_, ok = keyset.Prev("1")
+	assert.False(t, ok)
+
+	keyset.Add("3")
+	keyset.Add("3")
+	keyset.Remove("10")
+	keyset.Remove("missing")
+	assert.Equal(t, 5, keyset.Len())
+	next, _ = keyset.Next("2")
+	assert.Equal(t, "3", next)
+	next, _ = keyset.Next("3")
+	assert.Equal(t, "a", next)
+}
+
+func TestStorageEngine_GetNextPrevById(t *testing.T) {
+	for name, noSaves := range map[string]bool{"no-saves": true, "dual-write": false} {
+		t.Run(name, func(t *testing.T) {
+			engine := NewStorageEngine(WithNoSaves(noSaves), WithDataDir(t.TempDir()))
+			defer engine.StopBackgroundWorkers()
+
+			for i := 1; i <= 12; i++ {
+				_, err := engine.Insert("items", domain.Document{"n": i})
+				require.NoError(t, err)
+			}
+
+			doc, err := engine.GetNextById("items", "9")
+			require.NoError(t, err)
+			assert.Equal(t, "10", doc["_id"], "IDs are ordered numerically, not as strings")
+
+			doc, err = engine.GetPrevById("items", "10")
+			require.NoError(t, err)
+			assert.Equal(t, "9", doc["_id"])
+
+			_, err = engine.GetNextById("items", "12")
+			assert.Error(t, err)
+			_, err = engine.GetPrevById("items", "1")
+			assert.Error(t, err)
+
+			// Writes after the keyset is built are reflected
+			require.NoError(t, engine.DeleteById("items", "10"))
+			doc, err = engine.GetNextById("items", "9")
+			require.NoError(t, err)
+			assert.Equal(t, "11", doc["_id"])
+
+			// Navigation continues from a deleted document
+			doc, err = engine.GetPrevById("items", "10")
+			require.NoError(t, err)
+			assert.Equal(t, "9", doc["_id"])
+
+			_, err = engine.Insert("items", domain.Document{"n": 13})
+			require.NoError(t, err)
+			doc, err = engine.GetNextById("items", "12")
+			require.NoError(t, err)
+			assert.Equal(t, "13", doc["_id"])
+
+			_, err = engine.GetNextById("missing", "1")
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestStorageEngine_GetNextById_StaleKeyset(t *testing.T) {
+	engine := NewStorageEngine(WithNoSaves(true))
+	defer engine.StopBackgroundWorkers()
+
+	for i := 0; i < 3; i++ {
+		_, err := engine.Insert("items", domain.Document{"n": i})
+		require.NoError(t, err)
+	}
+	_, err := engine.GetNextById("items", "1")
+	require.NoError(t, err)
+
+	// Replace a document behind the keyset's back, keeping the count the same
+	require.NoError(t, engine.withCollectionWriteLock("items", func() error {
+		collection, err := engine.getCollectionInternal("items")
+		if err != nil {
+			return err
+		}
+		doc := collection.Documents["2"]
+		delete(collection.Documents, "2")
+		collection.Documents["7"] = doc
+		return nil
+	}))
+
+	doc, err := engine.GetNextById("items", "1")
+	require.NoError(t, err)
+	assert.Equal(t, "3", doc["_id"])
+}
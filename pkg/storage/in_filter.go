@@ -0,0 +1,121 @@
+package storage
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/adfharrison1/go-db/pkg/domain"
+	"github.com/adfharrison1/go-db/pkg/indexing"
+)
+
+// InFilterKey is the operator matching a field against a list of values, e.g.
+// {"_id": {"$in": ["1", "5", "9"]}}
+const InFilterKey = "$in"
+
+// NinFilterKey is the inverse of $in, matching documents whose field equals none of
+// the values, e.g. {"city": {"$nin": ["Boston", "Chicago"]}}. Documents without the
+// field match, and an array matches when none of its elements is listed. Documents
+// are always scanned; indexes are not used.
+const NinFilterKey = "$nin"
+
+// InFilterValues returns the values of an {"$in": [...]} filter value.
+// The second result is false when the filter value is not an $in operator.
+func InFilterValues(expected interface{}) ([]interface{}, bool) {
+	return operatorValues(expected, InFilterKey)
+}
+
+// NinFilterValues returns the values of a {"$nin": [...]} filter value.
+// The second result is false when the filter value is not a $nin operator.
+func NinFilterValues(expected interface{}) ([]interface{}, bool) {
+	return operatorValues(expected, NinFilterKey)
+}
+
+// operatorValues returns the value list of a filter value holding only the given
+// list operator
+func operatorValues(expected interface{}, key string) ([]interface{}, bool) {
+	operator, ok := expected.(map[string]interface{})
+	if !ok || len(operator) != 1 {
+		return nil, false
+	}
+	switch values := operator[key].(type) {
+	case []interface{}:
+		return values, true
+	case []string:
+		converted := make([]interface{}, len(values))
+		for i, value := range values {
+			converted[i] = value
+		}
+		return converted, true
+	default:
+		return nil, false
+	}
+}
+
+// validateInFilter checks that an $in or $nin operator holds an array of values
+func validateInFilter(field string, expected interface{}) error {
+	operator, ok := expected.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	for _, key := range []string{InFilterKey, NinFilterKey} {
+		if _, exists := operator[key]; !exists {
+			continue
+		}
+		if _, ok := operatorValues(expected, key); !ok {
+			return fmt.Errorf("%w: %s on field %s must be the only operator and hold an array", domain.ErrInvalidFilter, key, field)
+		}
+	}
+	return nil
+}
+
+// matchesAny reports whether actual matches any of the given values
+func matchesAny(actual interface{}, values []interface{}) bool {
+	for _, value := range values {
+		if ValuesMatch(actual, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesNin reports whether none of the values, nor any of their array elements,
+// matches one of the excluded values
+func matchesNin(values, excluded []interface{}) bool {
+	for _, value := range values {
+		if matchesAny(value, excluded) {
+			return false
+		}
+		if elements, isArray := indexing.ArrayElements(value); isArray && matchesAnyElement(elements, func(element interface{}) bool {
+			return matchesAny(element, excluded)
+		}) {
+			return false
+		}
+	}
+	return true
+}
+
+// queryIndexIn queries an index once per $in value and returns the union of
+// matching document IDs, in the order of the values and without duplicates.
+// Values that cannot be index keys (arrays, objects) match nothing.
+func queryIndexIn(index *indexing.Index, values []interface{}) []string {
+	var ids []string
+	seen := make(map[string]bool)
+	for _, value := range values {
+		if !isComparable(value) {
+			continue
+		}
+		for _, id := range index.Query(value) {
+			if !seen[id] {
+				seen[id] = true
+				ids = append(ids, id)
+			}
+		}
+	}
+	return ids
+}
+
+// isComparable reports whether a filter value can be compared with == (and so used
+// as an index key); arrays and objects cannot
+func isComparable(value interface{}) bool {
+	return value == nil || reflect.TypeOf(value).Comparable()
+}
@@ -0,0 +1,140 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/adfharrison1/go-db/pkg/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newInFilterTestEngine(t *testing.T) *StorageEngine {
+	engine := NewStorageEngine(WithNoSaves(true))
+	t.Cleanup(engine.StopBackgroundWorkers)
+
+	for _, name := range []string{"Alice", "Bob", "Carol", "Dave", "Eve"} {
+		_, err := engine.Insert("users", domain.Document{"name": name, "team": "core"})
+		require.NoError(t, err)
+	}
+	return engine
+}
+
+func TestInFilter_MatchesFilter(t *testing.T) {
+	doc := domain.Document{"name": "Alice", "age": 30}
+	assert.True(t, MatchesFilter(doc, map[string]interface{}{"age": map[string]interface{}{"$in": []interface{}{25, 30.0}}}))
+	assert.True(t, MatchesFilter(doc, map[string]interface{}{"name": map[string]interface{}{"$in": []string{"Bob", "Alice"}}}))
+	assert.False(t, MatchesFilter(doc, map[string]interface{}{"name": map[string]interface{}{"$in": []interface{}{}}}))
+	assert.False(t, MatchesFilter(doc, map[string]interface{}{"city": map[string]interface{}{"$in": []interface{}{"Paris"}}}))
+}
+
+func TestInFilter_IDUsesIndex(t *testing.T) {
+	engine := newInFilterTestEngine(t)
+	filter := map[string]interface{}{"_id": map[string]interface{}{"$in": []interface{}{"4", "2", "99", "4"}}}
+
+	// One index lookup per value, in value order, without duplicates or missing IDs
+	ids, useIndex := engine.optimizeWithIndexes("users", filter)
+	assert.True(t, useIndex)
+	assert.Equal(t, []string{"4", "2"}, ids)
+
+	result, err := engine.FindAll("users", filter, nil)
+	require.NoError(t, err)
+	require.Len(t, result.Documents, 2)
+	assert.Equal(t, "2", result.Documents[0]["_id"])
+	assert.Equal(t, "4", result.Documents[1]["_id"])
+
+	// Streams return documents in the order of the $in values, every time
+	for i := 0; i < 3; i++ {
+		stream, err := engine.FindAllStream("users", filter)
+		require.NoError(t, err)
+		var streamed []interface{}
+		for doc := range stream {
+			streamed = append(streamed, doc["_id"])
+		}
+		assert.Equal(t, []interface{}{"4", "2"}, streamed)
+	}
+}
+
+func TestInFilter_CombinedWithOtherIndex(t *testing.T) {
+	engine := newInFilterTestEngine(t)
+	require.NoError(t, engine.CreateIndex("users", "team"))
+	_, err := engine.UpdateById("users", "3", domain.Document{"team": "web"})
+	require.NoError(t, err)
+
+	filter := map[string]interface{}{
+		"_id":  map[string]interface{}{"$in": []interface{}{"5", "3", "1"}},
+		"team": "core",
+	}
+	ids, useIndex := engine.optimizeWithIndexes("users", filter)
+	assert.True(t, useIndex)
+	assert.Equal(t, []string{"5", "1"}, ids)
+}
+
+func TestInFilter_UnindexedFieldScans(t *testing.T) {
+	engine := newInFilterTestEngine(t)
+
+	result, err := engine.FindAll("users", map[string]interface{}{
+		"name": map[string]interface{}{"$in": []interface{}{"Bob", "Eve", "Zed"}},
+	}, nil)
+	require.NoError(t, err)
+	require.Len(t, result.Documents, 2)
+	assert.Equal(t, "Bob", result.Documents[0]["name"])
+	assert.Equal(t, "Eve", result.Documents[1]["name"])
+}
+
+func TestInFilter_Invalid(t *testing.T) {
+	engine := newInFilterTestEngine(t)
+
+	_, err := engine.FindAll("users", map[string]interface{}{"_id": map[string]interface{}{"$in": "1"}}, nil)
+	assert.ErrorIs(t, err, domain.ErrInvalidFilter)
+
+	_, err = engine.FindAll("users", map[string]interface{}{
+		"_id": map[string]interface{}{"$in": []interface{}{"1"}, "$nin": []interface{}{"2"}},
+	}, nil)
+	assert.ErrorIs(t, err, domain.ErrInvalidFilter)
+
+	// Array and object values cannot be index keys and match nothing
+	result, err := engine.FindAll("users", map[string]interface{}{
+		"_id": map[string]interface{}{"$in": []interface{}{[]interface{}{"1"}, map[string]interface{}{"a": 1}, "1"}},
+	}, nil)
+	require.NoError(t, err)
+	assert.Len(t, result.Documents, 1)
+}
+
+func TestNinFilter_MatchesFilter(t *testing.T) {
+	doc := domain.Document{"city": "New York", "age": 30, "tags": []interface{}{"a", "b"}}
+	nin := func(values ...interface{}) map[string]interface{} {
+		return map[string]interface{}{"$nin": values}
+	}
+
+	assert.False(t, MatchesFilter(doc, map[string]interface{}{"city": nin("Boston", "new york")}), "strings compare case-insensitively")
+	assert.True(t, MatchesFilter(doc, map[string]interface{}{"city": nin("Boston", "Chicago")}))
+	assert.False(t, MatchesFilter(doc, map[string]interface{}{"age": nin(30.0)}))
+	assert.True(t, MatchesFilter(doc, map[string]interface{}{"country": nin("US")}), "a missing field matches")
+	assert.False(t, MatchesFilter(doc, map[string]interface{}{"tags": nin("b", "c")}), "an array holding a listed value does not match")
+	assert.True(t, MatchesFilter(doc, map[string]interface{}{"tags": nin("c")}))
+	assert.True(t, MatchesFilter(doc, map[string]interface{}{"city": nin()}))
+
+	assert.NoError(t, ValidateFilter(map[string]interface{}{"city": nin("Boston")}))
+	assert.ErrorIs(t, ValidateFilter(map[string]interface{}{"city": map[string]interface{}{"$nin": "Boston"}}), domain.ErrInvalidFilter)
+	assert.ErrorIs(t, ValidateFilter(map[string]interface{}{"city": map[string]interface{}{"$nin": []interface{}{"Boston"}, "$ne": "Chicago"}}), domain.ErrInvalidFilter)
+}
+
+func TestNinFilter_IndexedField(t *testing.T) {
+	engine := newInFilterTestEngine(t)
+	require.NoError(t, engine.CreateIndex("users", "name"))
+
+	// The index cannot answer a $nin, so the documents are scanned
+	ids, err := engine.FindIds("users", map[string]interface{}{"name": map[string]interface{}{"$nin": []interface{}{"alice", "Eve"}}})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"2", "3", "4"}, ids)
+
+	// $nin on one field combines with an index lookup on another
+	result, err := engine.FindAll("users", map[string]interface{}{
+		"name": map[string]interface{}{"$in": []interface{}{"Bob", "Carol", "Dave"}},
+		"_id":  map[string]interface{}{"$nin": []interface{}{"3"}},
+	}, nil)
+	require.NoError(t, err)
+	require.Len(t, result.Documents, 2)
+	assert.Equal(t, "Bob", result.Documents[0]["name"])
+	assert.Equal(t, "Dave", result.Documents[1]["name"])
+}
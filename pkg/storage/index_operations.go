@@ -1,6 +1,8 @@
 package storage
 
 import (
+	"context"
+
 	"github.com/adfharrison1/go-db/pkg/domain"
 	"github.com/adfharrison1/go-db/pkg/indexing"
 )
@@ -15,17 +17,41 @@ func (se *StorageEngine) CreateIndex(collName, fieldName string) error {
 		if err := se.indexEngine.CreateIndex(collName, fieldName); err != nil {
 			return err
 		}
-		return se.indexEngine.BuildIndexForCollection(collName, fieldName, collection)
+		if err := se.indexEngine.BuildIndexForCollection(collName, fieldName, collection); err != nil {
+			return err
+		}
+		se.persistIndexChange(collName)
+		return nil
 	})
 }
 
 // DropIndex removes an index from a collection
 func (se *StorageEngine) DropIndex(collName, fieldName string) error {
 	return se.withCollectionWriteLock(collName, func() error {
-		return se.indexEngine.DropIndex(collName, fieldName)
+		if err := se.indexEngine.DropIndex(collName, fieldName); err != nil {
+			return err
+		}
+		se.persistIndexChange(collName)
+		return nil
 	})
 }
 
+// DropAllIndexes removes every secondary index from a collection and returns how many
+// were dropped. The primary _id index is always kept.
+func (se *StorageEngine) DropAllIndexes(collName string) (int, error) {
+	var dropped int
+	err := se.withCollectionWriteLock(collName, func() error {
+		if _, err := se.getCollectionInternal(collName); err != nil {
+			return err
+		}
+		if dropped = se.indexEngine.DropAllIndexes(collName, "_id"); dropped > 0 {
+			se.persistIndexChange(collName)
+		}
+		return nil
+	})
+	return dropped, err
+}
+
 // FindByIndex finds documents using an index
 func (se *StorageEngine) FindByIndex(collName, fieldName string, value interface{}) ([]domain.Document, error) {
 	var results []domain.Document
@@ -43,7 +69,7 @@ func (se *StorageEngine) FindByIndex(collName, fieldName string, value interface
 		}
 		ids := index.Query(value)
 		for _, id := range ids {
-			if doc, ok := collection.Documents[id]; ok {
+			if doc, ok := collection.Get(id); ok {
 				results = append(results, doc)
 			}
 		}
@@ -83,12 +109,34 @@ func (se *StorageEngine) UpdateIndex(collName, fieldName string) error {
 	})
 }
 
+// RebuildIndexes rebuilds every index of a collection from its documents
+func (se *StorageEngine) RebuildIndexes(collName string) error {
+	return se.RebuildIndexesContext(context.Background(), collName, nil)
+}
+
+// RebuildIndexesContext is like RebuildIndexes but reports progress to progress (which
+// may be nil) and stops early once ctx is cancelled, leaving the existing indexes
+// unchanged. Writes to the collection wait until the rebuild finishes.
+func (se *StorageEngine) RebuildIndexesContext(ctx context.Context, collName string, progress func(processed, total int)) error {
+	return se.withCollectionWriteLock(collName, func() error {
+		collection, err := se.getCollectionInternal(collName)
+		if err != nil {
+			return err
+		}
+		return se.indexEngine.RebuildIndexes(ctx, collName, collection, progress)
+	})
+}
+
 // getIndex returns an index for a specific field in a collection
 func (se *StorageEngine) getIndex(collName, fieldName string) (*indexing.Index, bool) {
 	return se.indexEngine.GetIndex(collName, fieldName)
 }
 
-// updateIndexes updates all indexes for a collection when a document changes
+// updateIndexes updates all indexes for a collection, its ID keyset, its insertion
+// order and its change log when a document changes
 func (se *StorageEngine) updateIndexes(collName, docID string, oldDoc, newDoc domain.Document) {
 	se.indexEngine.UpdateIndexForDocument(collName, docID, oldDoc, newDoc)
+	se.idKeysets.DocumentChanged(collName, docID, oldDoc, newDoc)
+	se.insertionOrder.DocumentChanged(collName, docID, oldDoc, newDoc)
+	se.changeLog.DocumentChanged(collName, docID, oldDoc, newDoc)
 }
@@ -0,0 +1,52 @@
+package storage
+
+import (
+	"log"
+
+	"github.com/adfharrison1/go-db/pkg/indexing"
+)
+
+// setIndexDefinitions stores the index definitions of every collection in
+// storageData, for the snapshot and the single-file layout
+func (se *StorageEngine) setIndexDefinitions(storageData *StorageData) {
+	storageData.Indexes = nil
+	storageData.IndexDefinitions = se.indexEngine.ExportAllIndexDefinitions()
+}
+
+// setCollectionIndexDefinitions stores one collection's index definitions in
+// storageData, for its per-collection file
+func (se *StorageEngine) setCollectionIndexDefinitions(storageData *StorageData, collName string) {
+	if definitions := se.indexEngine.ExportIndexDefinitions(collName); definitions != nil {
+		storageData.IndexDefinitions = map[string][]indexing.IndexDefinition{collName: definitions}
+	}
+}
+
+// importIndexDefinitions registers the indexes defined in storageData, empty until
+// their collection is loaded and newLoadedCollection rebuilds them. Files written by
+// older versions list each index's documents instead; only their fields are used.
+func (se *StorageEngine) importIndexDefinitions(storageData *StorageData) {
+	for collName, definitions := range storageData.IndexDefinitions {
+		se.indexEngine.ImportIndexDefinitions(collName, definitions, PartialIndexMatcher)
+	}
+	if len(storageData.IndexDefinitions) == 0 && len(storageData.Indexes) > 0 {
+		se.indexEngine.ImportIndexes(storageData.Indexes)
+	}
+}
+
+// persistIndexChange saves a collection after one of its indexes was created or
+// dropped, so that its file holds the new index definitions. In no-saves mode the
+// collection is only marked dirty. Caller must hold the collection write lock.
+func (se *StorageEngine) persistIndexChange(collName string) {
+	_, info, found := se.cache.Get(collName)
+	if !found {
+		return
+	}
+	info.markDirty()
+	if se.noSaves {
+		return
+	}
+	if err := se.saveCollectionToFileUnsafe(collName); err != nil {
+		// Still dirty, so the next save of the collection writes the definitions
+		log.Printf("WARN: Failed to save index definitions of collection %s: %v", collName, err)
+	}
+}
@@ -0,0 +1,94 @@
+package storage
+
+import (
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/adfharrison1/go-db/pkg/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func sortedIndexes(t *testing.T, engine *StorageEngine, collName string) []string {
+	t.Helper()
+	indexes, err := engine.GetIndexes(collName)
+	require.NoError(t, err)
+	sort.Strings(indexes)
+	return indexes
+}
+
+func TestIndexDefinitions_RestoredFromCollectionFiles(t *testing.T) {
+	tempDir := t.TempDir()
+	engine := NewStorageEngine(WithDataDir(tempDir))
+	for _, doc := range []domain.Document{{"status": "open", "total": 5}, {"status": "closed", "total": 7}, {"status": "open", "total": 9}} {
+		_, err := engine.Insert("orders", doc)
+		require.NoError(t, err)
+	}
+	require.NoError(t, engine.CreateIndex("orders", "status"))
+	require.NoError(t, engine.CreatePartialIndex("orders", "total", map[string]interface{}{"status": "open"}))
+	require.NoError(t, engine.CreateIndex("orders", "dropped"))
+	require.NoError(t, engine.DropIndex("orders", "dropped"))
+	engine.StopBackgroundWorkers()
+
+	// No snapshot was saved: the definitions come from the collection's own file
+	restarted := NewStorageEngine(WithDataDir(tempDir))
+	defer restarted.StopBackgroundWorkers()
+	require.NoError(t, restarted.LoadCollectionMetadata(filepath.Join(tempDir, "missing.godb")))
+	assert.Equal(t, []string{"_id", "status", "total"}, sortedIndexes(t, restarted, "orders"))
+
+	// Loading the collection rebuilds the indexes, keeping the partial one partial
+	result, err := restarted.FindAll("orders", map[string]interface{}{"status": "open"}, nil)
+	require.NoError(t, err)
+	assert.Len(t, result.Documents, 2)
+	index, exists := restarted.getIndex("orders", "total")
+	require.True(t, exists)
+	assert.Equal(t, map[string]interface{}{"status": "open"}, index.Condition)
+	assert.Empty(t, index.Query(7), "documents outside the condition are not indexed")
+	assert.Equal(t, []string{"3"}, index.Query(9))
+}
+
+func TestIndexDefinitions_Snapshot(t *testing.T) {
+	tempDir := t.TempDir()
+	snapshot := filepath.Join(tempDir, "snapshot.godb")
+	engine := NewStorageEngine(WithDataDir(tempDir), WithStorageLayout(LayoutSingleFile))
+	_, err := engine.Insert("users", domain.Document{"name": "Alice"})
+	require.NoError(t, err)
+	require.NoError(t, engine.CreateIndex("users", "name"))
+	require.NoError(t, engine.SaveToFile(snapshot))
+	engine.StopBackgroundWorkers()
+
+	// Only definitions are written, not the documents of each index
+	storageData, err := readStorageFile(snapshot)
+	require.NoError(t, err)
+	assert.Empty(t, storageData.Indexes)
+	assert.Len(t, storageData.IndexDefinitions["users"], 2)
+
+	restarted := NewStorageEngine(WithDataDir(tempDir), WithStorageLayout(LayoutSingleFile))
+	defer restarted.StopBackgroundWorkers()
+	require.NoError(t, restarted.LoadCollectionMetadata(snapshot))
+	assert.Equal(t, []string{"_id", "name"}, sortedIndexes(t, restarted, "users"))
+	docs, err := restarted.FindByIndex("users", "name", "Alice")
+	require.NoError(t, err)
+	assert.Len(t, docs, 1)
+}
+
+func TestIndexDefinitions_LegacyFile(t *testing.T) {
+	tempDir := t.TempDir()
+	legacy := filepath.Join(tempDir, "legacy.godb")
+	engine := NewStorageEngine(WithDataDir(tempDir), WithStorageLayout(LayoutSingleFile))
+	defer engine.StopBackgroundWorkers()
+
+	// Older versions stored each index's document IDs
+	storageData := NewStorageData()
+	storageData.Collections["users"] = map[string]interface{}{"1": map[string]interface{}{"_id": "1", "name": "Alice"}}
+	storageData.Indexes["users"] = map[string][]string{"_id": {"1"}, "name": {"1"}}
+	_, err := engine.writeStorageFile(legacy, storageData)
+	require.NoError(t, err)
+
+	require.NoError(t, engine.LoadCollectionMetadata(legacy))
+	assert.Equal(t, []string{"_id", "name"}, sortedIndexes(t, engine, "users"))
+	docs, err := engine.FindByIndex("users", "name", "Alice")
+	require.NoError(t, err)
+	assert.Len(t, docs, 1)
+}
@@ -0,0 +1,120 @@
+package storage
+
+import (
+	"sort"
+
+	"github.com/adfharrison1/go-db/pkg/indexing"
+)
+
+// indexLookup is one condition of a filter answered by an index
+type indexLookup struct {
+	field string
+	ids   []string        // IDs of an equality or $in lookup, run while planning
+	scan  func() []string // Range condition, run only if candidates remain
+}
+
+// indexPlan intersects the index lookups of a filter, most selective first.
+// Equality and $in lookups are cheap hash lookups whose exact sizes are known once
+// they are run, so they are intersected smallest first. Range conditions test every
+// key of their index, so they are scanned last and skipped once the candidates run
+// out. Intersecting stops as soon as no candidate is left.
+type indexPlan struct {
+	lookups []indexLookup
+	lead    []string // $in results; the candidates keep their order
+}
+
+// add records an equality or $in lookup
+func (p *indexPlan) add(field string, ids []string) {
+	p.lookups = append(p.lookups, indexLookup{field: field, ids: ids})
+}
+
+// addScan records a range, time-typed or collated condition
+func (p *indexPlan) addScan(field string, index *indexing.Index, expected interface{}) bool {
+	if _, ok := RangeFilterBounds(expected); !ok {
+		_, isTime := expected.(*timeCondition)
+		_, isCollated := expected.(*collatedCondition)
+		if !isTime && !isCollated {
+			return false
+		}
+	}
+	p.lookups = append(p.lookups, indexLookup{field: field, scan: func() []string {
+		ids, _ := queryIndexCondition(index, expected)
+		return ids
+	}})
+	return true
+}
+
+// run returns the IDs in every lookup and the fields in the order they were
+// intersected. A single lookup's IDs are returned as they are.
+func (p *indexPlan) run() ([]string, []string) {
+	sort.SliceStable(p.lookups, func(i, j int) bool {
+		a, b := p.lookups[i], p.lookups[j]
+		if (a.scan == nil) != (b.scan == nil) {
+			return a.scan == nil
+		}
+		return len(a.ids) < len(b.ids)
+	})
+
+	var ids []string
+	order := make([]string, 0, len(p.lookups))
+	for i, lookup := range p.lookups {
+		if i > 0 && len(ids) == 0 {
+			break
+		}
+		next := lookup.ids
+		if lookup.scan != nil {
+			next = lookup.scan()
+		}
+		order = append(order, lookup.field)
+		if i == 0 {
+			ids = next
+		} else {
+			ids = intersectIDs(ids, next)
+		}
+	}
+
+	if p.lead != nil && len(order) > 1 && len(ids) > 0 {
+		ids = intersectIDs(ids, p.lead)
+	}
+	return ids, order
+}
+
+// CompoundFilterValues returns the values a filter requires of a compound index's
+// fields, in field order, reporting false unless it compares each field for equality
+// with a string, number or boolean
+func CompoundFilterValues(filter map[string]interface{}, fields []string) ([]interface{}, bool) {
+	values := make([]interface{}, len(fields))
+	for i, field := range fields {
+		value, exists := filter[field]
+		if !exists {
+			return nil, false
+		}
+		switch value.(type) {
+		case string, bool:
+		default:
+			if _, isNumber := indexing.NormalizeKey(value).(float64); !isNumber {
+				return nil, false
+			}
+		}
+		values[i] = value
+	}
+	return values, true
+}
+
+// intersectIDs returns the IDs of small that are also in large, once each and in
+// the order of large. Only small is put in a set.
+func intersectIDs(small, large []string) []string {
+	remaining := make(map[string]bool, len(small))
+	for _, id := range small {
+		remaining[id] = true
+	}
+
+	result := make([]string, 0, len(small))
+	for _, id := range large {
+		if remaining[id] {
+			delete(remaining, id)
+			result = append(result, id)
+		}
+	}
+	return result
+}
@@ -0,0 +1,85 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/adfharrison1/go-db/pkg/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIndexPlan_MostSelectiveFirst(t *testing.T) {
+	plan := &indexPlan{}
+	plan.add("status", []string{"1", "2", "3", "4", "5"})
+	plan.add("userId", []string{"4", "2"})
+	scanned := false
+	plan.lookups = append(plan.lookups, indexLookup{field: "age", scan: func() []string {
+		scanned = true
+		return []string{"2", "3", "4"}
+	}})
+
+	ids, order := plan.run()
+	assert.Equal(t, []string{"userId", "status", "age"}, order)
+	assert.ElementsMatch(t, []string{"2", "4"}, ids)
+	assert.True(t, scanned)
+}
+
+func TestIndexPlan_ShortCircuits(t *testing.T) {
+	plan := &indexPlan{}
+	plan.add("status", []string{"1", "2", "3"})
+	plan.add("userId", []string{})
+	plan.add("region", []string{"1"})
+	plan.lookups = append(plan.lookups, indexLookup{field: "age", scan: func() []string {
+		t.Error("range scan run after the candidates ran out")
+		return nil
+	}})
+
+	ids, order := plan.run()
+	assert.Empty(t, ids)
+	assert.Equal(t, []string{"userId"}, order)
+}
+
+func TestIndexPlan_KeepsInOrder(t *testing.T) {
+	plan := &indexPlan{}
+	in := []string{"9", "3", "5", "1"}
+	plan.add("_id", in)
+	plan.lead = in
+	plan.add("status", []string{"1", "5", "9"})
+
+	ids, _ := plan.run()
+	assert.Equal(t, []string{"9", "5", "1"}, ids)
+}
+
+func TestIntersectIDs(t *testing.T) {
+	// Duplicates in the larger slice, as from a multikey range scan, appear once
+	assert.Equal(t, []string{"3", "1"}, intersectIDs([]string{"1", "3"}, []string{"3", "2", "3", "1"}))
+	assert.Empty(t, intersectIDs(nil, []string{"1"}))
+}
+
+func TestStorageEngine_SelectiveIndexIntersection(t *testing.T) {
+	engine := NewStorageEngine(WithNoSaves(true))
+	defer engine.StopBackgroundWorkers()
+
+	for i := 0; i < 50; i++ {
+		_, err := engine.Insert("orders", domain.Document{"status": "active", "userId": i % 10, "total": i})
+		require.NoError(t, err)
+	}
+	require.NoError(t, engine.CreateIndex("orders", "status"))
+	require.NoError(t, engine.CreateIndex("orders", "userId"))
+	require.NoError(t, engine.CreateIndex("orders", "total"))
+
+	result, err := engine.FindAll("orders", map[string]interface{}{
+		"status": "active",
+		"userId": 3,
+		"total":  map[string]interface{}{"$gte": 20},
+	}, nil)
+	require.NoError(t, err)
+	require.Len(t, result.Documents, 3)
+	for _, doc := range result.Documents {
+		assert.Equal(t, 3, doc["userId"])
+	}
+
+	ids, err := engine.FindIds("orders", map[string]interface{}{"status": "archived", "total": map[string]interface{}{"$lt": 5}})
+	require.NoError(t, err)
+	assert.Empty(t, ids)
+}
@@ -0,0 +1,106 @@
+package storage
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/adfharrison1/go-db/pkg/domain"
+)
+
+// CreateIndexWithTypeCheck creates an index like CreateIndex after scanning the
+// collection for the types stored in fieldName. With reject set, an index whose field
+// holds more than one type is not created and the error wraps
+// domain.ErrInconsistentFieldTypes. The report is returned either way.
+func (se *StorageEngine) CreateIndexWithTypeCheck(collName, fieldName string, reject bool) (*domain.FieldTypeReport, error) {
+	var report *domain.FieldTypeReport
+	err := se.withCollectionWriteLock(collName, func() error {
+		collection, err := se.getCollectionInternal(collName)
+		if err != nil {
+			return err
+		}
+
+		report = NewFieldTypeReport(fieldName)
+		collection.Range(func(_ string, doc domain.Document) bool {
+			CountFieldType(report, doc)
+			return true
+		})
+		if err := CheckFieldTypes(report, reject); err != nil {
+			return err
+		}
+
+		if err := se.indexEngine.CreateIndex(collName, fieldName); err != nil {
+			return err
+		}
+		if err := se.indexEngine.BuildIndexForCollection(collName, fieldName, collection); err != nil {
+			return err
+		}
+		se.persistIndexChange(collName)
+		return nil
+	})
+	return report, err
+}
+
+// NewFieldTypeReport returns an empty type report for field
+func NewFieldTypeReport(field string) *domain.FieldTypeReport {
+	return &domain.FieldTypeReport{Field: field, Types: make(map[string]int64)}
+}
+
+// CountFieldType adds the type doc stores in the report's field
+func CountFieldType(report *domain.FieldTypeReport, doc domain.Document) {
+	value, exists := doc[report.Field]
+	if !exists {
+		report.Missing++
+		return
+	}
+	report.Types[FieldTypeName(value)]++
+}
+
+// CheckFieldTypes sets report.Consistent, which holds when at most one type other
+// than null was counted; nulls and missing fields are reported but never make a
+// field inconsistent. With reject set, an inconsistent report is returned as an
+// error wrapping domain.ErrInconsistentFieldTypes.
+func CheckFieldTypes(report *domain.FieldTypeReport, reject bool) error {
+	types := make([]string, 0, len(report.Types))
+	for name := range report.Types {
+		if name != "null" {
+			types = append(types, name)
+		}
+	}
+	report.Consistent = len(types) <= 1
+
+	if reject && !report.Consistent {
+		sort.Strings(types)
+		counts := make([]string, len(types))
+		for i, name := range types {
+			counts[i] = fmt.Sprintf("%s: %d", name, report.Types[name])
+		}
+		return fmt.Errorf("%w: field %q holds %s", domain.ErrInconsistentFieldTypes, report.Field, strings.Join(counts, ", "))
+	}
+	return nil
+}
+
+// FieldTypeName returns the JSON type name of a stored value. All Go numeric types are
+// "number", since filters and indexes compare numbers by value.
+func FieldTypeName(value interface{}) string {
+	if value == nil {
+		return "null"
+	}
+	if _, ok := ToFloat64(value); ok {
+		return "number"
+	}
+	switch value.(type) {
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	}
+	switch reflect.ValueOf(value).Kind() {
+	case reflect.Map, reflect.Struct:
+		return "object"
+	case reflect.Slice, reflect.Array:
+		return "array"
+	}
+	return fmt.Sprintf("%T", value)
+}
@@ -0,0 +1,75 @@
+package storage
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/adfharrison1/go-db/pkg/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFieldTypeName(t *testing.T) {
+	assert.Equal(t, "null", FieldTypeName(nil))
+	assert.Equal(t, "number", FieldTypeName(3))
+	assert.Equal(t, "number", FieldTypeName(float64(3.5)))
+	assert.Equal(t, "string", FieldTypeName("3"))
+	assert.Equal(t, "boolean", FieldTypeName(true))
+	assert.Equal(t, "object", FieldTypeName(map[string]interface{}{"a": 1}))
+	assert.Equal(t, "object", FieldTypeName(domain.Document{"a": 1}))
+	assert.Equal(t, "array", FieldTypeName([]interface{}{1}))
+	assert.Equal(t, "array", FieldTypeName([]string{"a"}))
+}
+
+func TestStorageEngine_CreateIndexWithTypeCheck(t *testing.T) {
+	engine := NewStorageEngine(WithNoSaves(true))
+	defer engine.StopBackgroundWorkers()
+
+	docs := []domain.Document{
+		{"age": 30, "zip": "02134"},
+		{"age": 41.5, "zip": 2134},
+		{"age": nil, "zip": "90210"},
+		{"name": "no age or zip"},
+	}
+	for _, doc := range docs {
+		_, err := engine.Insert("users", doc)
+		require.NoError(t, err)
+	}
+
+	t.Run("Consistent", func(t *testing.T) {
+		report, err := engine.CreateIndexWithTypeCheck("users", "age", true)
+		require.NoError(t, err)
+		assert.True(t, report.Consistent, "ints, floats and nulls are one type")
+		assert.Equal(t, map[string]int64{"number": 2, "null": 1}, report.Types)
+		assert.Equal(t, int64(1), report.Missing)
+
+		indexes, err := engine.GetIndexes("users")
+		require.NoError(t, err)
+		assert.Contains(t, indexes, "age")
+	})
+
+	t.Run("Reject", func(t *testing.T) {
+		report, err := engine.CreateIndexWithTypeCheck("users", "zip", true)
+		assert.True(t, errors.Is(err, domain.ErrInconsistentFieldTypes), "got %v", err)
+		require.NotNil(t, report)
+		assert.False(t, report.Consistent)
+		assert.Equal(t, map[string]int64{"string": 2, "number": 1}, report.Types)
+
+		indexes, err := engine.GetIndexes("users")
+		require.NoError(t, err)
+		assert.NotContains(t, indexes, "zip")
+	})
+
+	t.Run("Report", func(t *testing.T) {
+		report, err := engine.CreateIndexWithTypeCheck("users", "zip", false)
+		require.NoError(t, err)
+		assert.False(t, report.Consistent)
+
+		indexes, err := engine.GetIndexes("users")
+		require.NoError(t, err)
+		assert.Contains(t, indexes, "zip")
+	})
+
+	_, err := engine.CreateIndexWithTypeCheck("missing", "zip", false)
+	assert.Error(t, err)
+}
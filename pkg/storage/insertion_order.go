@@ -0,0 +1,134 @@
+package storage
+
+import (
+	"container/list"
+	"sort"
+	"sync"
+
+	"github.com/adfharrison1/go-db/pkg/domain"
+)
+
+// InsertionOrder holds each collection's document IDs in the order they were
+// inserted, so documents can be listed in that order without sorting. Inserts append
+// and deletes unlink in constant time; updates and replaces keep a document where it
+// is. The order lives in memory only. A nil InsertionOrder tracks nothing.
+type InsertionOrder struct {
+	mu    sync.Mutex
+	colls map[string]*insertionList
+}
+
+// insertionList is one collection's IDs, oldest insert at the front
+type insertionList struct {
+	order    *list.List
+	elements map[string]*list.Element
+}
+
+// NewInsertionOrder creates an empty insertion order
+func NewInsertionOrder() *InsertionOrder {
+	return &InsertionOrder{colls: make(map[string]*insertionList)}
+}
+
+// collection returns a collection's list, creating it if needed.
+// Caller must hold o.mu.
+func (o *InsertionOrder) collection(collName string) *insertionList {
+	ids, exists := o.colls[collName]
+	if !exists {
+		ids = &insertionList{order: list.New(), elements: make(map[string]*list.Element)}
+		o.colls[collName] = ids
+	}
+	return ids
+}
+
+// Invalidate discards a collection's order, for a collection that has been dropped
+func (o *InsertionOrder) Invalidate(collName string) {
+	if o == nil {
+		return
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	delete(o.colls, collName)
+}
+
+// DocumentChanged appends an insert (nil oldDoc) and unlinks a delete (nil newDoc).
+// Updates leave the order unchanged.
+func (o *InsertionOrder) DocumentChanged(collName, docID string, oldDoc, newDoc domain.Document) {
+	if o == nil || (oldDoc == nil) == (newDoc == nil) {
+		return
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	ids := o.collection(collName)
+	element, exists := ids.elements[docID]
+	switch {
+	case newDoc == nil && exists:
+		ids.order.Remove(element)
+		delete(ids.elements, docID)
+	case oldDoc == nil && !exists:
+		ids.elements[docID] = ids.order.PushBack(docID)
+	}
+}
+
+// ids returns a collection's document IDs in insertion order. When the number of
+// tracked IDs differs from count, the collection's current document count, the order is
+// first reconciled with listIDs: IDs no longer listed are dropped, and documents never
+// seen inserted, such as those loaded from disk, go first in _id order. Caller must keep
+// the collection's documents from changing while ids runs.
+func (o *InsertionOrder) ids(collName string, count int, listIDs func() []string) []string {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	ids := o.collection(collName)
+	if ids.order.Len() != count {
+		ids.reconcile(listIDs())
+	}
+
+	result := make([]string, 0, ids.order.Len())
+	for element := ids.order.Front(); element != nil; element = element.Next() {
+		result = append(result, element.Value.(string))
+	}
+	return result
+}
+
+// reconcile makes the list hold exactly current, keeping the order of the IDs it
+// already holds and putting the others first, sorted by ID
+func (ids *insertionList) reconcile(current []string) {
+	present := make(map[string]bool, len(current))
+	var untracked []string
+	for _, id := range current {
+		present[id] = true
+		if _, exists := ids.elements[id]; !exists {
+			untracked = append(untracked, id)
+		}
+	}
+	for id, element := range ids.elements {
+		if !present[id] {
+			ids.order.Remove(element)
+			delete(ids.elements, id)
+		}
+	}
+
+	sort.Slice(untracked, func(i, j int) bool {
+		return lessDocumentID(untracked[i], untracked[j])
+	})
+	for i := len(untracked) - 1; i >= 0; i-- {
+		ids.elements[untracked[i]] = ids.order.PushFront(untracked[i])
+	}
+}
+
+// OrderedIDs returns the IDs of docs, a collection's documents, in insertion order,
+// or an ErrInsertionOrderDisabled error if o is nil. Caller must keep docs from
+// changing while OrderedIDs runs.
+func (o *InsertionOrder) OrderedIDs(collName string, docs map[string]domain.Document) ([]string, error) {
+	return o.OrderedCollectionIDs(collName, &domain.Collection{Name: collName, Documents: docs})
+}
+
+// OrderedCollectionIDs is like OrderedIDs for the documents of collection, however
+// they are stored
+func (o *InsertionOrder) OrderedCollectionIDs(collName string, collection *domain.Collection) ([]string, error) {
+	if o == nil {
+		return nil, domain.Errorf(domain.ErrInsertionOrderDisabled, "insertion order is not tracked")
+	}
+	return o.ids(collName, collection.Len(), collection.IDs), nil
+}
@@ -0,0 +1,111 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/adfharrison1/go-db/pkg/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInsertionOrder(t *testing.T) {
+	var disabled *InsertionOrder
+	disabled.DocumentChanged("c", "zeta", nil, domain.Document{})
+	_, err := disabled.OrderedIDs("c", nil)
+	assert.True(t, errors.Is(err, domain.ErrInsertionOrderDisabled))
+
+	order := NewInsertionOrder()
+	docs := map[string]domain.Document{}
+	insert := func(id string) {
+		docs[id] = domain.Document{"_id": id}
+		order.DocumentChanged("c", id, nil, docs[id])
+	}
+	for _, id := range []string{"zeta", "alpha", "mid"} {
+		insert(id)
+	}
+
+	// Updates keep their position; deletes leave no gap
+	order.DocumentChanged("c", "zeta", docs["zeta"], domain.Document{"_id": "zeta", "n": 1})
+	order.DocumentChanged("c", "alpha", docs["alpha"], nil)
+	delete(docs, "alpha")
+	insert("beta")
+	ids, err := order.OrderedIDs("c", docs)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"zeta", "mid", "beta"}, ids)
+
+	// Documents it never saw inserted go first in _id order, and IDs that are gone are dropped
+	docs["10"] = domain.Document{}
+	docs["9"] = domain.Document{}
+	delete(docs, "mid")
+	ids, err = order.OrderedIDs("c", docs)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"9", "10", "zeta", "beta"}, ids)
+}
+
+func TestStorageEngine_FindAllInsertionOrder(t *testing.T) {
+	engine := NewStorageEngine(WithNoSaves(true), WithInsertionOrder(true))
+	defer engine.StopBackgroundWorkers()
+
+	for i := 1; i <= 12; i++ {
+		_, err := engine.Insert("events", domain.Document{"seq": i, "even": i%2 == 0})
+		require.NoError(t, err)
+	}
+	_, err := engine.UpdateById("events", "1", domain.Document{"touched": true})
+	require.NoError(t, err)
+	require.NoError(t, engine.DeleteById("events", "3"))
+
+	ids := func(result *domain.PaginationResult) []string {
+		var ids []string
+		for _, doc := range result.Documents {
+			ids = append(ids, doc["_id"].(string))
+		}
+		return ids
+	}
+	inserted := func(limit, offset int) *domain.PaginationOptions {
+		options := domain.DefaultPaginationOptions()
+		options.Order = domain.OrderInserted
+		options.Limit = limit
+		options.Offset = offset
+		return options
+	}
+
+	// _id order sorts the IDs as strings; insertion order does not sort
+	result, err := engine.FindAll("events", nil, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"1", "10", "11", "12", "2"}, ids(result)[:5])
+
+	result, err = engine.FindAll("events", nil, inserted(5, 0))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"1", "2", "4", "5", "6"}, ids(result))
+	assert.True(t, result.HasNext)
+
+	result, err = engine.FindAll("events", nil, inserted(5, 5))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"7", "8", "9", "10", "11"}, ids(result))
+
+	// Cursors continue in insertion order
+	options := inserted(3, 0)
+	options.After = result.NextCursor
+	result, err = engine.FindAll("events", nil, options)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"12"}, ids(result))
+
+	// Index candidates are returned in insertion order too
+	require.NoError(t, engine.CreateIndex("events", "even"))
+	result, err = engine.FindAll("events", map[string]interface{}{"even": true}, inserted(10, 0))
+	require.NoError(t, err)
+	var want []string
+	for i := 2; i <= 12; i += 2 {
+		want = append(want, fmt.Sprint(i))
+	}
+	assert.Equal(t, want, ids(result))
+
+	untracked := NewStorageEngine(WithNoSaves(true))
+	defer untracked.StopBackgroundWorkers()
+	_, err = untracked.Insert("events", domain.Document{"seq": 1})
+	require.NoError(t, err)
+	_, err = untracked.FindAll("events", nil, inserted(10, 0))
+	assert.True(t, errors.Is(err, domain.ErrInsertionOrderDisabled))
+}
@@ -0,0 +1,317 @@
+package storage
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/adfharrison1/go-db/pkg/domain"
+	"github.com/pierrec/lz4/v4"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// StorageLayout selects how collections are stored on disk
+type StorageLayout int
+
+const (
+	// LayoutPerCollection stores each collection in <dataDir>/collections/<name>.godb.
+	// SaveToFile additionally writes a snapshot of every collection to a single file.
+	LayoutPerCollection StorageLayout = iota
+
+	// LayoutSingleFile stores every collection in one data file. Incremental saves
+	// rewrite the collection's slice of that file and lazy loads read it back.
+	LayoutSingleFile
+)
+
+// DefaultDataFileName is the single-file data file, relative to the data directory,
+// used when no data file has been loaded with LoadCollectionMetadata
+const DefaultDataFileName = "go-db_data.godb"
+
+// String returns the layout name accepted by ParseStorageLayout
+func (l StorageLayout) String() string {
+	switch l {
+	case LayoutPerCollection:
+		return "per-collection"
+	case LayoutSingleFile:
+		return "single-file"
+	default:
+		return fmt.Sprintf("StorageLayout(%d)", int(l))
+	}
+}
+
+// ParseStorageLayout parses a layout name ("per-collection" or "single-file")
+func ParseStorageLayout(name string) (StorageLayout, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "per-collection", "percollection":
+		return LayoutPerCollection, nil
+	case "single-file", "singlefile":
+		return LayoutSingleFile, nil
+	default:
+		return 0, fmt.Errorf("unknown storage layout '%s' (expected per-collection or single-file)", name)
+	}
+}
+
+// singleFilePath returns the data file used by the single-file layout
+func (se *StorageEngine) singleFilePath() string {
+	if se.dataFile != "" {
+		return se.dataFile
+	}
+	return filepath.Join(se.dataDir, DefaultDataFileName)
+}
+
+// collectionFilePath returns the per-collection file for a collection
+func (se *StorageEngine) collectionFilePath(collName string) string {
+	return filepath.Join(se.dataDir, "collections", collName+".godb")
+}
+
+// loadCollection loads a collection from disk according to the storage layout.
+// With the per-collection layout, a collection without its own file falls back to
+// the snapshot loaded by LoadCollectionMetadata.
+func (se *StorageEngine) loadCollection(collName string) (*domain.Collection, error) {
+	if se.layout == LayoutSingleFile {
+		return se.loadCollectionFromSingleFile(collName, se.singleFilePath())
+	}
+
+	collection, err := se.loadCollectionFromDisk(collName)
+	if os.IsNotExist(err) && se.dataFile != "" {
+		return se.loadCollectionFromSingleFile(collName, se.dataFile)
+	}
+	return collection, err
+}
+
+// readCollectionDocuments reads a collection's stored documents without caching them
+func (se *StorageEngine) readCollectionDocuments(collName string) (map[string]interface{}, error) {
+	if se.layout == LayoutPerCollection {
+		lock := se.deltaLock(collName)
+		lock.Lock()
+		storageData, err := readStorageFile(se.collectionFilePath(collName))
+		if err == nil {
+			if docs, exists := storageData.Collections[collName]; exists {
+				records, err := se.readDeltaLog(collName)
+				lock.Unlock()
+				if err != nil {
+					return nil, err
+				}
+				applyDeltas(docs, records)
+				return docs, nil
+			}
+		}
+		lock.Unlock()
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+
+	filename := se.singleFilePath()
+	if se.layout == LayoutPerCollection {
+		if se.dataFile == "" {
+			return nil, fmt.Errorf("collection %s not found on disk", collName)
+		}
+		filename = se.dataFile
+	}
+
+	storageData, err := readStorageFile(filename)
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("collection %s not found on disk", collName)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if docs, exists := storageData.Collections[collName]; exists {
+		return docs, nil
+	}
+	return nil, fmt.Errorf("collection %s not found on disk", collName)
+}
+
+// newLoadedCollection builds a collection from stored documents, restores its ID
+// counter to the highest numeric ID and rebuilds its indexes
+func (se *StorageEngine) newLoadedCollection(collName string, docs map[string]interface{}) *domain.Collection {
+	collection := se.newCollection(collName)
+
+	// Track the highest numeric ID to restore the counter properly
+	maxID := int64(0)
+
+	for docID, docData := range docs {
+		if doc, ok := docData.(map[string]interface{}); ok {
+			collection.Set(docID, domain.Document(doc))
+
+			// Try to parse the document ID as a number to find the highest one
+			if id, err := strconv.ParseInt(docID, 10, 64); err == nil {
+				if id > maxID {
+					maxID = id
+				}
+			}
+		}
+	}
+
+	// Restore the ID counter for this collection to the highest existing ID
+	// This ensures new documents get unique IDs that don't conflict with existing ones
+	se.idCountersMu.Lock()
+	se.idCounters[collName] = &maxID
+	se.idCountersMu.Unlock()
+
+	// Rebuild indexes for this collection after loading
+	se.indexEngine.RebuildIndexForCollection(collName, collection)
+
+	log.Printf("INFO: Loaded collection '%s' with %d documents, restored ID counter to %d",
+		collName, collection.Len(), maxID)
+
+	return collection
+}
+
+// registerCollectionFiles adds metadata for every per-collection file in the data directory.
+// Caller must hold se.mu write lock.
+func (se *StorageEngine) registerCollectionFiles() error {
+	paths, err := filepath.Glob(filepath.Join(se.dataDir, "collections", "*.godb"))
+	if err != nil {
+		return fmt.Errorf("failed to list collection files: %w", err)
+	}
+
+	for _, path := range paths {
+		collName := strings.TrimSuffix(filepath.Base(path), ".godb")
+		storageData, err := readStorageFile(path)
+		if err != nil {
+			log.Printf("WARN: Skipping unreadable collection file %s: %v", path, err)
+			continue
+		}
+		docs, exists := storageData.Collections[collName]
+		if !exists {
+			continue
+		}
+		// Tombstoned documents not yet purged from the base file are not counted
+		if records, err := se.readDeltaLog(collName); err == nil {
+			applyDeltas(docs, records)
+		}
+
+		info := &CollectionInfo{
+			Name:          collName,
+			DocumentCount: int64(len(docs)),
+			State:         CollectionStateUnloaded,
+			LastModified:  time.Now(),
+		}
+		if stat, err := os.Stat(path); err == nil {
+			info.SizeOnDisk = stat.Size()
+			info.LastModified = stat.ModTime()
+		}
+		se.collections[collName] = info
+
+		// A collection file's index definitions are newer than the snapshot's
+		if _, exists := storageData.IndexDefinitions[collName]; exists {
+			se.importIndexDefinitions(storageData)
+		}
+	}
+	return nil
+}
+
+// writeCollectionToSingleFile replaces one collection's documents in the single-file
+// data file, keeping every other collection, and writes the current index definitions.
+// The whole file is rewritten atomically. Returns the compressed size written.
+func (se *StorageEngine) writeCollectionToSingleFile(collName string, docs map[string]interface{}) (int64, error) {
+	se.singleFileMu.Lock()
+	defer se.singleFileMu.Unlock()
+
+	filename := se.singleFilePath()
+	storageData, err := readStorageFile(filename)
+	if os.IsNotExist(err) {
+		storageData = NewStorageData()
+	} else if err != nil {
+		return 0, fmt.Errorf("failed to read data file: %w", err)
+	}
+
+	storageData.Collections[collName] = docs
+	se.setIndexDefinitions(storageData)
+
+	return se.writeStorageFile(filename, storageData)
+}
+
+// saveDocumentToSingleFile writes a single document into its collection's slice of the data file
+func (se *StorageEngine) saveDocumentToSingleFile(collName, docID string, doc domain.Document) (int64, error) {
+	se.singleFileMu.Lock()
+	defer se.singleFileMu.Unlock()
+
+	filename := se.singleFilePath()
+	storageData, err := readStorageFile(filename)
+	if os.IsNotExist(err) {
+		storageData = NewStorageData()
+	} else if err != nil {
+		return 0, fmt.Errorf("failed to read data file: %w", err)
+	}
+
+	if storageData.Collections[collName] == nil {
+		storageData.Collections[collName] = make(map[string]interface{})
+	}
+	storageData.Collections[collName][docID] = map[string]interface{}(doc)
+	se.setIndexDefinitions(storageData)
+
+	return se.writeStorageFile(filename, storageData)
+}
+
+// readStorageFile reads and decodes a GODB file
+func readStorageFile(filename string) (*StorageData, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	reader := bytes.NewReader(data)
+	if _, err := ReadHeader(reader); err != nil {
+		return nil, fmt.Errorf("invalid file header: %w", err)
+	}
+
+	compressedData := data[len(data)-reader.Len():]
+	decompressedData := make([]byte, len(compressedData)*10)
+	n, err := lz4.UncompressBlock(compressedData, decompressedData)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress data: %w", err)
+	}
+	decompressedData = decompressedData[:n]
+
+	var storageData StorageData
+	if err := msgpack.Unmarshal(decompressedData, &storageData); err != nil {
+		return nil, fmt.Errorf("failed to decode MessagePack: %w", err)
+	}
+	if storageData.Collections == nil {
+		storageData.Collections = make(map[string]map[string]interface{})
+	}
+	return &storageData, nil
+}
+
+// writeStorageFile encodes a GODB file, writing to a temporary file first and
+// renaming it over the target. Returns the compressed size written.
+func (se *StorageEngine) writeStorageFile(filename string, storageData *StorageData) (int64, error) {
+	msgpackData, err := msgpack.Marshal(storageData)
+	if err != nil {
+		return 0, fmt.Errorf("failed to encode MessagePack: %w", err)
+	}
+
+	compressedData := make([]byte, lz4.CompressBlockBound(len(msgpackData)))
+	var hashTable [1 << 16]int
+	n, err := lz4.CompressBlock(msgpackData, compressedData, hashTable[:])
+	if err != nil {
+		return 0, fmt.Errorf("failed to compress data: %w", err)
+	}
+	compressedData = compressedData[:n]
+
+	var buf bytes.Buffer
+	if err := WriteHeader(&buf); err != nil {
+		return 0, fmt.Errorf("failed to write header: %w", err)
+	}
+	buf.Write(compressedData)
+
+	if dir := filepath.Dir(filename); dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return 0, fmt.Errorf("failed to create data directory: %w", err)
+		}
+	}
+
+	if err := se.writeFileAtomic(filename, buf.Bytes()); err != nil {
+		return 0, fmt.Errorf("failed to write data file: %w", err)
+	}
+
+	return int64(len(compressedData)), nil
+}
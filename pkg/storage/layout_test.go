@@ -0,0 +1,147 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/adfharrison1/go-db/pkg/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseStorageLayout(t *testing.T) {
+	layout, err := ParseStorageLayout("single-file")
+	require.NoError(t, err)
+	assert.Equal(t, LayoutSingleFile, layout)
+
+	layout, err = ParseStorageLayout("Per-Collection")
+	require.NoError(t, err)
+	assert.Equal(t, LayoutPerCollection, layout)
+	assert.Equal(t, "per-collection", layout.String())
+
+	_, err = ParseStorageLayout("sharded")
+	assert.Error(t, err)
+}
+
+func TestStorageLayout_SingleFileIncrementalSaves(t *testing.T) {
+	tempDir := t.TempDir()
+	dataFile := filepath.Join(tempDir, DefaultDataFileName)
+
+	engine := NewStorageEngine(WithDataDir(tempDir), WithStorageLayout(LayoutSingleFile))
+	defer engine.StopBackgroundWorkers()
+
+	_, err := engine.Insert("users", domain.Document{"name": "Alice"})
+	require.NoError(t, err)
+	_, err = engine.Insert("users", domain.Document{"name": "Bob"})
+	require.NoError(t, err)
+	_, err = engine.Insert("products", domain.Document{"name": "Laptop"})
+	require.NoError(t, err)
+
+	// Every collection is written to the data file, never to per-collection files
+	assert.FileExists(t, dataFile)
+	assert.NoDirExists(t, filepath.Join(tempDir, "collections"))
+
+	reloaded := NewStorageEngine(WithDataDir(tempDir), WithStorageLayout(LayoutSingleFile))
+	defer reloaded.StopBackgroundWorkers()
+	require.NoError(t, reloaded.LoadCollectionMetadata(dataFile))
+
+	result, err := reloaded.FindAll("users", nil, nil)
+	require.NoError(t, err)
+	assert.Len(t, result.Documents, 2)
+
+	result, err = reloaded.FindAll("products", nil, nil)
+	require.NoError(t, err)
+	assert.Len(t, result.Documents, 1)
+
+	// The ID counter is restored so new documents do not overwrite loaded ones
+	doc, err := reloaded.Insert("users", domain.Document{"name": "Carol"})
+	require.NoError(t, err)
+	assert.Equal(t, "3", doc["_id"])
+
+	third := NewStorageEngine(WithDataDir(tempDir), WithStorageLayout(LayoutSingleFile))
+	defer third.StopBackgroundWorkers()
+	require.NoError(t, third.LoadCollectionMetadata(dataFile))
+
+	result, err = third.FindAll("users", nil, nil)
+	require.NoError(t, err)
+	assert.Len(t, result.Documents, 3)
+}
+
+func TestStorageLayout_SingleFileSaveToFile(t *testing.T) {
+	tempDir := t.TempDir()
+	dataFile := filepath.Join(tempDir, "data.godb")
+
+	engine := NewStorageEngine(WithDataDir(tempDir), WithStorageLayout(LayoutSingleFile), WithNoSaves(true))
+	defer engine.StopBackgroundWorkers()
+
+	_, err := engine.Insert("users", domain.Document{"name": "Alice", "city": "Paris"})
+	require.NoError(t, err)
+	require.NoError(t, engine.CreateIndex("users", "city"))
+	require.NoError(t, engine.SaveToFile(dataFile))
+
+	reloaded := NewStorageEngine(WithDataDir(tempDir), WithStorageLayout(LayoutSingleFile))
+	defer reloaded.StopBackgroundWorkers()
+	require.NoError(t, reloaded.LoadCollectionMetadata(dataFile))
+
+	result, err := reloaded.FindAll("users", map[string]interface{}{"city": "Paris"}, nil)
+	require.NoError(t, err)
+	assert.Len(t, result.Documents, 1)
+
+	// Incremental saves after loading go back into the same file
+	_, err = reloaded.Insert("users", domain.Document{"name": "Bob", "city": "Paris"})
+	require.NoError(t, err)
+	assert.NoDirExists(t, filepath.Join(tempDir, "collections"))
+
+	storageData, err := readStorageFile(dataFile)
+	require.NoError(t, err)
+	assert.Len(t, storageData.Collections["users"], 2)
+}
+
+func TestStorageLayout_PerCollectionRoundTrip(t *testing.T) {
+	tempDir := t.TempDir()
+	snapshot := filepath.Join(tempDir, "snapshot.godb")
+
+	engine := NewStorageEngine(WithDataDir(tempDir), WithNoSaves(true))
+	defer engine.StopBackgroundWorkers()
+
+	_, err := engine.Insert("users", domain.Document{"name": "Alice"})
+	require.NoError(t, err)
+	require.NoError(t, engine.SaveToFile(snapshot))
+
+	// The snapshot and the per-collection file are written together
+	assert.FileExists(t, filepath.Join(tempDir, "collections", "users.godb"))
+
+	// A collection whose only copy is its per-collection file is still registered and loads
+	require.NoError(t, os.Remove(snapshot))
+
+	reloaded := NewStorageEngine(WithDataDir(tempDir))
+	defer reloaded.StopBackgroundWorkers()
+	require.NoError(t, reloaded.LoadCollectionMetadata(snapshot))
+
+	result, err := reloaded.FindAll("users", nil, nil)
+	require.NoError(t, err)
+	assert.Len(t, result.Documents, 1)
+}
+
+func TestStorageLayout_SaveToFileIncludesUncachedCollections(t *testing.T) {
+	tempDir := t.TempDir()
+	first := filepath.Join(tempDir, "first.godb")
+	second := filepath.Join(tempDir, "second.godb")
+
+	engine := NewStorageEngine(WithDataDir(tempDir), WithStorageLayout(LayoutSingleFile), WithNoSaves(true))
+	defer engine.StopBackgroundWorkers()
+	_, err := engine.Insert("users", domain.Document{"name": "Alice"})
+	require.NoError(t, err)
+	require.NoError(t, engine.SaveToFile(first))
+
+	// Only metadata is loaded, so the collection is not in the cache when saving
+	reloaded := NewStorageEngine(WithDataDir(tempDir), WithStorageLayout(LayoutSingleFile))
+	defer reloaded.StopBackgroundWorkers()
+	require.NoError(t, reloaded.LoadCollectionMetadata(first))
+	require.NoError(t, reloaded.SaveToFile(second))
+
+	storageData, err := readStorageFile(second)
+	require.NoError(t, err)
+	assert.Len(t, storageData.Collections["users"], 1)
+}
@@ -0,0 +1,90 @@
+package storage
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	"github.com/adfharrison1/go-db/pkg/domain"
+)
+
+// LockCounters counts the holders of and waiters for one or more locks, for
+// diagnosing contention and deadlocks. Locks are taken through its methods, which
+// cost a few atomic adds each. The zero value is ready to use.
+type LockCounters struct {
+	readHolders  atomic.Int64
+	readWaiters  atomic.Int64
+	writeHolders atomic.Int64
+	writeWaiters atomic.Int64
+}
+
+// RLock read-locks mu, counting the caller as a waiter until it holds the lock
+func (c *LockCounters) RLock(mu *sync.RWMutex) {
+	c.readWaiters.Add(1)
+	mu.RLock()
+	c.readWaiters.Add(-1)
+	c.readHolders.Add(1)
+}
+
+// RUnlock read-unlocks mu
+func (c *LockCounters) RUnlock(mu *sync.RWMutex) {
+	c.readHolders.Add(-1)
+	mu.RUnlock()
+}
+
+// Lock locks l, counting the caller as a waiter until it holds the lock
+func (c *LockCounters) Lock(l sync.Locker) {
+	c.writeWaiters.Add(1)
+	l.Lock()
+	c.writeWaiters.Add(-1)
+	c.writeHolders.Add(1)
+}
+
+// TryLock write-locks mu if it is free and reports whether it did
+func (c *LockCounters) TryLock(mu *sync.RWMutex) bool {
+	if !mu.TryLock() {
+		return false
+	}
+	c.writeHolders.Add(1)
+	return true
+}
+
+// Unlock unlocks l
+func (c *LockCounters) Unlock(l sync.Locker) {
+	c.writeHolders.Add(-1)
+	l.Unlock()
+}
+
+// Stats returns the current counts. Each count is read separately, so under load
+// they may not all be from the same instant.
+func (c *LockCounters) Stats() domain.LockStats {
+	return domain.LockStats{
+		ReadHolders:  c.readHolders.Load(),
+		ReadWaiters:  c.readWaiters.Load(),
+		WriteHolders: c.writeHolders.Load(),
+		WriteWaiters: c.writeWaiters.Load(),
+	}
+}
+
+// SortLockStats sorts lock stats by collection name
+func SortLockStats(stats []domain.CollectionLockStats) {
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Name < stats[j].Name })
+}
+
+// LockStats returns the lock activity of every collection whose locks have been used,
+// sorted by name
+func (se *StorageEngine) LockStats() []domain.CollectionLockStats {
+	se.locksMu.RLock()
+	stats := make([]domain.CollectionLockStats, 0, len(se.collectionLocks))
+	for name, lock := range se.collectionLocks {
+		stats = append(stats, domain.CollectionLockStats{
+			Name:       name,
+			Collection: lock.counters.Stats(),
+			Documents:  lock.documents.Stats(),
+		})
+	}
+	se.locksMu.RUnlock()
+
+	SortLockStats(stats)
+	return stats
+}
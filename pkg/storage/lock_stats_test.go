@@ -0,0 +1,64 @@
+package storage
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/adfharrison1/go-db/pkg/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLockStats(t *testing.T) {
+	engine := NewStorageEngine(WithNoSaves(true))
+	defer engine.StopBackgroundWorkers()
+
+	_, err := engine.Insert("users", domain.Document{"name": "Alice"})
+	require.NoError(t, err)
+
+	statsFor := func(name string) domain.CollectionLockStats {
+		for _, stats := range engine.LockStats() {
+			if stats.Name == name {
+				return stats
+			}
+		}
+		t.Fatalf("no lock stats for %s", name)
+		return domain.CollectionLockStats{}
+	}
+	assert.Equal(t, domain.CollectionLockStats{Name: "users"}, statsFor("users"))
+
+	// Hold the write lock while a reader and a document writer wait for it
+	held := make(chan struct{})
+	release := make(chan struct{})
+	go engine.withCollectionWriteLock("users", func() error {
+		close(held)
+		<-release
+		return nil
+	})
+	<-held
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		engine.withCollectionReadLock("users", func() error { return nil })
+	}()
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		engine.withDocumentWriteLock("users", "1", func() error {
+			return engine.withCollectionReadLock("users", func() error { return nil })
+		})
+	}()
+
+	require.Eventually(t, func() bool {
+		stats := statsFor("users")
+		return stats.Collection.ReadWaiters == 2 && stats.Documents.WriteHolders == 1
+	}, time.Second, time.Millisecond)
+	assert.Equal(t, int64(1), statsFor("users").Collection.WriteHolders)
+
+	close(release)
+	wg.Wait()
+	assert.Equal(t, domain.CollectionLockStats{Name: "users"}, statsFor("users"))
+}
@@ -0,0 +1,154 @@
+package storage
+
+import (
+	"errors"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/adfharrison1/go-db/pkg/domain"
+)
+
+// DefaultLookupMaxMatches bounds the foreign documents embedded per document by a
+// lookup that does not set MaxMatches
+const DefaultLookupMaxMatches = 100
+
+// MaxLookupMatches is the largest MaxMatches a lookup may set
+const MaxLookupMatches = 1000
+
+// LookupSpec describes a lookup: each document's LocalField is matched against
+// ForeignField in the From collection and the matches are embedded under As. Matching
+// on _id embeds the one referenced document; any other foreign field must be indexed
+// and embeds an array of at most MaxMatches documents in _id order. Either way As is
+// null when nothing matches or the document has no LocalField.
+type LookupSpec struct {
+	LocalField   string `json:"localField"`
+	From         string `json:"from"`
+	ForeignField string `json:"foreignField"`
+	As           string `json:"as"`
+	MaxMatches   int    `json:"maxMatches,omitempty"`
+}
+
+// ValidateLookupSpec checks a lookup before any documents are read
+func ValidateLookupSpec(spec LookupSpec) error {
+	for name, value := range map[string]string{"localField": spec.LocalField, "from": spec.From, "foreignField": spec.ForeignField, "as": spec.As} {
+		if value == "" {
+			return domain.Errorf(domain.ErrInvalidField, "lookup %s cannot be empty", name)
+		}
+	}
+	if spec.As == "_id" || strings.Contains(spec.As, ".") {
+		return domain.Errorf(domain.ErrInvalidField, "lookup as must be a top-level field other than _id, got %q", spec.As)
+	}
+	if spec.MaxMatches < 0 || spec.MaxMatches > MaxLookupMatches {
+		return domain.Errorf(domain.ErrInvalidField, "lookup maxMatches must be between 0 and %d, got %d", MaxLookupMatches, spec.MaxMatches)
+	}
+	return nil
+}
+
+// Lookup embeds the documents of one collection into documents read from another
+// with one foreign query per document, so the local side can be streamed
+type Lookup struct {
+	spec       LookupSpec
+	localPath  []string
+	maxMatches int
+	find       func(value interface{}) ([]domain.Document, error)
+}
+
+// NewLookup validates spec and returns a lookup answering each foreign query with
+// find, which returns the From documents whose ForeignField equals value (typically
+// FindByIndex, or GetById when ForeignField is _id)
+func NewLookup(spec LookupSpec, find func(value interface{}) ([]domain.Document, error)) (*Lookup, error) {
+	if err := ValidateLookupSpec(spec); err != nil {
+		return nil, err
+	}
+	maxMatches := spec.MaxMatches
+	if maxMatches == 0 {
+		maxMatches = DefaultLookupMaxMatches
+	}
+	return &Lookup{
+		spec:       spec,
+		localPath:  strings.Split(spec.LocalField, "."),
+		maxMatches: maxMatches,
+		find:       find,
+	}, nil
+}
+
+// Apply returns a shallow copy of doc with the matching foreign documents under the
+// lookup's As field, and whether matches were left out to respect MaxMatches
+func (l *Lookup) Apply(doc domain.Document) (domain.Document, bool, error) {
+	joined := make(domain.Document, len(doc)+1)
+	for key, value := range doc {
+		joined[key] = value
+	}
+	joined[l.spec.As] = nil
+
+	value, exists := lookupFieldPath(doc, l.localPath)
+	if !exists || value == nil {
+		return joined, false, nil
+	}
+
+	if l.spec.ForeignField == "_id" {
+		id, ok := LookupID(value)
+		if !ok {
+			return joined, false, nil
+		}
+		matches, err := l.find(id)
+		if err != nil {
+			return nil, false, err
+		}
+		if len(matches) > 0 {
+			joined[l.spec.As] = matches[0]
+		}
+		return joined, false, nil
+	}
+
+	matches, err := l.find(value)
+	if err != nil {
+		return nil, false, err
+	}
+	if len(matches) == 0 {
+		return joined, false, nil
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		return lessDocumentID(documentID(matches[i]), documentID(matches[j]))
+	})
+	truncated := len(matches) > l.maxMatches
+	if truncated {
+		matches = matches[:l.maxMatches]
+	}
+	joined[l.spec.As] = matches
+	return joined, truncated, nil
+}
+
+// LookupID converts a reference to a document ID. IDs are strings, but references are
+// often stored as numbers, so whole numbers are converted as well.
+func LookupID(value interface{}) (string, bool) {
+	switch v := value.(type) {
+	case string:
+		return v, true
+	case float64:
+		if v == math.Trunc(v) && !math.IsInf(v, 0) {
+			return strconv.FormatFloat(v, 'f', -1, 64), true
+		}
+	case int:
+		return strconv.Itoa(v), true
+	case int64:
+		return strconv.FormatInt(v, 10), true
+	}
+	return "", false
+}
+
+// FindByID adapts GetById to a lookup's find function: a missing document is no match
+func FindByID(getById func(docId string) (domain.Document, error)) func(value interface{}) ([]domain.Document, error) {
+	return func(value interface{}) ([]domain.Document, error) {
+		doc, err := getById(value.(string))
+		if errors.Is(err, domain.ErrDocumentNotFound) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		return []domain.Document{doc}, nil
+	}
+}
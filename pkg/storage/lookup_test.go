@@ -0,0 +1,100 @@
+package storage
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/adfharrison1/go-db/pkg/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateLookupSpec(t *testing.T) {
+	valid := LookupSpec{LocalField: "userId", From: "users", ForeignField: "_id", As: "user"}
+	assert.NoError(t, ValidateLookupSpec(valid))
+
+	for name, spec := range map[string]LookupSpec{
+		"no local field":   {From: "users", ForeignField: "_id", As: "user"},
+		"no from":          {LocalField: "userId", ForeignField: "_id", As: "user"},
+		"no foreign field": {LocalField: "userId", From: "users", As: "user"},
+		"no as":            {LocalField: "userId", From: "users", ForeignField: "_id"},
+		"as _id":           {LocalField: "userId", From: "users", ForeignField: "_id", As: "_id"},
+		"dotted as":        {LocalField: "userId", From: "users", ForeignField: "_id", As: "user.profile"},
+		"negative matches": {LocalField: "userId", From: "users", ForeignField: "_id", As: "user", MaxMatches: -1},
+		"too many matches": {LocalField: "userId", From: "users", ForeignField: "_id", As: "user", MaxMatches: MaxLookupMatches + 1},
+	} {
+		err := ValidateLookupSpec(spec)
+		assert.ErrorIs(t, err, domain.ErrInvalidField, name)
+	}
+}
+
+func TestLookup_ByID(t *testing.T) {
+	engine := NewStorageEngine(WithNoSaves(true))
+	defer engine.StopBackgroundWorkers()
+	for _, name := range []string{"Alice", "Bob"} {
+		_, err := engine.Insert("users", domain.Document{"name": name})
+		require.NoError(t, err)
+	}
+
+	lookup, err := NewLookup(LookupSpec{LocalField: "buyer.id", From: "users", ForeignField: "_id", As: "user"}, FindByID(func(docId string) (domain.Document, error) {
+		return engine.GetById("users", docId)
+	}))
+	require.NoError(t, err)
+
+	order := domain.Document{"_id": "o1", "buyer": map[string]interface{}{"id": "2"}}
+	joined, truncated, err := lookup.Apply(order)
+	require.NoError(t, err)
+	assert.False(t, truncated)
+	assert.Equal(t, "Bob", joined["user"].(domain.Document)["name"])
+	assert.NotContains(t, order, "user", "the streamed document is not modified")
+
+	// References stored as whole numbers match string IDs
+	joined, _, err = lookup.Apply(domain.Document{"_id": "o2", "buyer": map[string]interface{}{"id": float64(1)}})
+	require.NoError(t, err)
+	assert.Equal(t, "Alice", joined["user"].(domain.Document)["name"])
+
+	for name, doc := range map[string]domain.Document{
+		"missing document":  {"_id": "o3", "buyer": map[string]interface{}{"id": "99"}},
+		"missing reference": {"_id": "o4"},
+		"null reference":    {"_id": "o5", "buyer": map[string]interface{}{"id": nil}},
+		"fractional id":     {"_id": "o6", "buyer": map[string]interface{}{"id": 1.5}},
+	} {
+		joined, _, err := lookup.Apply(doc)
+		require.NoError(t, err, name)
+		assert.Contains(t, joined, "user", name)
+		assert.Nil(t, joined["user"], name)
+	}
+}
+
+func TestLookup_ByIndex(t *testing.T) {
+	matches := []domain.Document{{"_id": "10", "team": "core"}, {"_id": "2", "team": "core"}, {"_id": "3", "team": "core"}}
+	find := func(value interface{}) ([]domain.Document, error) {
+		if value == "core" {
+			return append([]domain.Document(nil), matches...), nil
+		}
+		return nil, nil
+	}
+
+	lookup, err := NewLookup(LookupSpec{LocalField: "team", From: "users", ForeignField: "team", As: "members", MaxMatches: 2}, find)
+	require.NoError(t, err)
+
+	joined, truncated, err := lookup.Apply(domain.Document{"_id": "t1", "team": "core"})
+	require.NoError(t, err)
+	assert.True(t, truncated)
+	members := joined["members"].([]domain.Document)
+	require.Len(t, members, 2)
+	assert.Equal(t, "2", members[0]["_id"], "matches are kept in _id order")
+	assert.Equal(t, "3", members[1]["_id"])
+
+	joined, truncated, err = lookup.Apply(domain.Document{"_id": "t2", "team": "web"})
+	require.NoError(t, err)
+	assert.False(t, truncated)
+	assert.Nil(t, joined["members"])
+
+	failing, err := NewLookup(LookupSpec{LocalField: "team", From: "users", ForeignField: "team", As: "members"}, func(interface{}) ([]domain.Document, error) {
+		return nil, errors.New("boom")
+	})
+	require.NoError(t, err)
+	_, _, err = failing.Apply(domain.Document{"_id": "t1", "team": "core"})
+	assert.Error(t, err)
+}
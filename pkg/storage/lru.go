@@ -13,6 +13,7 @@ type LRUCache struct {
 	capacity int
 	list     *list.List
 	cache    map[string]*list.Element
+	pinned   map[string]bool // Keys never evicted, cached or not
 }
 
 type cacheEntry struct {
@@ -26,6 +27,7 @@ func NewLRUCache(capacity int) *LRUCache {
 		capacity: capacity,
 		list:     list.New(),
 		cache:    make(map[string]*list.Element),
+		pinned:   make(map[string]bool),
 	}
 }
 
@@ -59,20 +61,57 @@ func (lru *LRUCache) Put(key string, collection *domain.Collection, info *Collec
 	element := lru.list.PushFront(entry)
 	lru.cache[key] = element
 
-	if lru.list.Len() > lru.capacity {
+	if lru.list.Len()-lru.cachedPinned() > lru.capacity {
 		lru.evictOldest()
 	}
 }
 
+// cachedPinned counts the cached entries that are pinned. They do not count toward
+// the capacity, so pinned entries cannot crowd the others out of the cache.
+func (lru *LRUCache) cachedPinned() int {
+	count := 0
+	for key := range lru.pinned {
+		if _, exists := lru.cache[key]; exists {
+			count++
+		}
+	}
+	return count
+}
+
+// evictOldest removes the least recently used entry that is not pinned
 func (lru *LRUCache) evictOldest() {
-	element := lru.list.Back()
-	if element != nil {
+	for element := lru.list.Back(); element != nil; element = element.Prev() {
 		entry := element.Value.(*cacheEntry)
+		if lru.pinned[entry.key] {
+			continue
+		}
 		delete(lru.cache, entry.key)
 		lru.list.Remove(element)
+		return
 	}
 }
 
+// Pin keeps key from being evicted, whether or not it is cached yet
+func (lru *LRUCache) Pin(key string) {
+	lru.mu.Lock()
+	defer lru.mu.Unlock()
+	lru.pinned[key] = true
+}
+
+// Unpin lets key be evicted again
+func (lru *LRUCache) Unpin(key string) {
+	lru.mu.Lock()
+	defer lru.mu.Unlock()
+	delete(lru.pinned, key)
+}
+
+// IsPinned reports whether key is pinned
+func (lru *LRUCache) IsPinned(key string) bool {
+	lru.mu.RLock()
+	defer lru.mu.RUnlock()
+	return lru.pinned[key]
+}
+
 func (lru *LRUCache) Remove(key string) {
 	lru.mu.Lock()
 	defer lru.mu.Unlock()
@@ -83,7 +122,27 @@ func (lru *LRUCache) Remove(key string) {
 	}
 }
 
+// Peek returns a cached collection without marking it as recently used
+func (lru *LRUCache) Peek(key string) (*domain.Collection, bool) {
+	lru.mu.RLock()
+	defer lru.mu.RUnlock()
+
+	if element, exists := lru.cache[key]; exists {
+		return element.Value.(*cacheEntry).value, true
+	}
+	return nil, false
+}
+
+// SetCapacity changes the number of collections the cache holds before evicting
+func (lru *LRUCache) SetCapacity(capacity int) {
+	lru.mu.Lock()
+	defer lru.mu.Unlock()
+	lru.capacity = capacity
+}
+
 func (lru *LRUCache) Capacity() int {
+	lru.mu.RLock()
+	defer lru.mu.RUnlock()
 	return lru.capacity
 }
 
@@ -74,6 +74,37 @@ func TestLRUCache_CapacityAndEviction(t *testing.T) {
 	assert.True(t, found3)
 }
 
+func TestLRUCache_Pinned(t *testing.T) {
+	cache := NewLRUCache(2)
+	put := func(key string) {
+		cache.Put(key, domain.NewCollection(key), &CollectionInfo{Name: key})
+	}
+	cached := func(key string) bool {
+		_, found := cache.Peek(key)
+		return found
+	}
+
+	// Pinned before it is cached; pinned entries do not count toward the capacity
+	cache.Pin("ref")
+	put("ref")
+	put("a")
+	put("b")
+	assert.Equal(t, 3, cache.Len())
+
+	// ref is the least recently used, but a is evicted instead
+	put("c")
+	assert.True(t, cached("ref"))
+	assert.False(t, cached("a"))
+	assert.True(t, cached("b"))
+	assert.True(t, cached("c"))
+
+	cache.Unpin("ref")
+	assert.False(t, cache.IsPinned("ref"))
+	put("d")
+	assert.False(t, cached("ref"))
+	assert.Equal(t, 3, cache.Len())
+}
+
 func TestLRUCache_UpdateExisting(t *testing.T) {
 	cache := NewLRUCache(10)
 
@@ -0,0 +1,147 @@
+package storage
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/adfharrison1/go-db/pkg/domain"
+)
+
+// Rough per-value overheads used by EstimateDocumentSize
+const (
+	mapEntryOverhead = 48 // Bucket slot, key header and interface header
+	stringOverhead   = 16
+	scalarSize       = 8
+)
+
+// EstimateDocumentSize returns a rough estimate of the bytes a document holds in
+// memory, counting field names, values and map overheads. It is meant for comparing
+// collections, not for exact accounting.
+func EstimateDocumentSize(doc domain.Document) int64 {
+	return estimateValueSize(map[string]interface{}(doc))
+}
+
+func estimateValueSize(value interface{}) int64 {
+	switch v := value.(type) {
+	case nil:
+		return 0
+	case string:
+		return stringOverhead + int64(len(v))
+	case time.Time:
+		return 24
+	case map[string]interface{}:
+		size := int64(mapEntryOverhead)
+		for key, nested := range v {
+			size += mapEntryOverhead + int64(len(key)) + estimateValueSize(nested)
+		}
+		return size
+	case domain.Document:
+		return estimateValueSize(map[string]interface{}(v))
+	case []interface{}:
+		size := int64(24)
+		for _, nested := range v {
+			size += stringOverhead + estimateValueSize(nested)
+		}
+		return size
+	default:
+		return scalarSize
+	}
+}
+
+// MaxMemoryCacheCapacity converts a memory limit to a cache capacity, assuming
+// roughly 100MB per cached entry. The cache always holds at least one entry.
+func MaxMemoryCacheCapacity(mb int) int {
+	if mb < 100 {
+		return 1
+	}
+	return mb / 100
+}
+
+// ValidateMaxMemory checks a memory limit given at runtime
+func ValidateMaxMemory(mb int) error {
+	if mb <= 0 {
+		return fmt.Errorf("max memory must be positive, got %d MB", mb)
+	}
+	return nil
+}
+
+// CollectionMemoryUsage estimates the memory each collection holds, sorted by name.
+// Collections that are not in the cache are reported with their document count only.
+func (se *StorageEngine) CollectionMemoryUsage() []domain.CollectionMemoryUsage {
+	se.mu.RLock()
+	usage := make([]domain.CollectionMemoryUsage, 0, len(se.collections))
+	resident := make(map[string]*domain.Collection, len(se.collections))
+	for name, info := range se.collections {
+		usage = append(usage, domain.CollectionMemoryUsage{Name: name, Documents: info.DocumentCount, Pinned: se.cache.IsPinned(name)})
+		if collection, ok := se.cache.Peek(name); ok {
+			resident[name] = collection
+		}
+	}
+	se.mu.RUnlock()
+
+	for i := range usage {
+		collection, ok := resident[usage[i].Name]
+		if !ok {
+			continue
+		}
+		se.withCollectionReadLock(usage[i].Name, func() error {
+			usage[i].Resident = true
+			usage[i].Documents = int64(collection.Len())
+			usage[i].CachedDocs = collection.Len()
+			if collection.Store != nil {
+				usage[i].Compact = true
+				usage[i].EstimatedBytes = collection.Store.Size()
+				return nil
+			}
+			for _, doc := range collection.Documents {
+				usage[i].EstimatedBytes += EstimateDocumentSize(doc)
+			}
+			return nil
+		})
+	}
+
+	sort.Slice(usage, func(i, j int) bool { return usage[i].Name < usage[j].Name })
+	return usage
+}
+
+// SetMaxMemory changes the memory limit at runtime. The collection cache capacity
+// follows it; a smaller cache evicts its least recently used collections as further
+// collections are loaded, as with a limit set at startup.
+func (se *StorageEngine) SetMaxMemory(mb int) error {
+	if err := ValidateMaxMemory(mb); err != nil {
+		return err
+	}
+
+	se.mu.Lock()
+	defer se.mu.Unlock()
+
+	se.maxMemoryMB = mb
+	se.cache.SetCapacity(MaxMemoryCacheCapacity(mb))
+	return nil
+}
+
+// PinCollection keeps a collection in the cache whatever the access pattern, so a
+// burst of reads on other collections cannot evict it. A collection that is not
+// loaded stays unloaded until its first use, and is then kept. Pinned collections do
+// not count toward the cache capacity, so they cannot crowd the others out.
+func (se *StorageEngine) PinCollection(collName string) {
+	se.cache.Pin(collName)
+}
+
+// UnpinCollection lets a pinned collection be evicted again
+func (se *StorageEngine) UnpinCollection(collName string) {
+	se.cache.Unpin(collName)
+}
+
+// IsCollectionPinned reports whether a collection is pinned in the cache
+func (se *StorageEngine) IsCollectionPinned(collName string) bool {
+	return se.cache.IsPinned(collName)
+}
+
+// getMaxMemoryMB returns the current memory limit
+func (se *StorageEngine) getMaxMemoryMB() int {
+	se.mu.RLock()
+	defer se.mu.RUnlock()
+	return se.maxMemoryMB
+}
@@ -0,0 +1,87 @@
+package storage
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/adfharrison1/go-db/pkg/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEstimateDocumentSize(t *testing.T) {
+	small := EstimateDocumentSize(domain.Document{"name": "a"})
+	large := EstimateDocumentSize(domain.Document{"name": strings.Repeat("a", 1000)})
+	nested := EstimateDocumentSize(domain.Document{"name": "a", "tags": []interface{}{"x", "y"}, "address": map[string]interface{}{"city": "Rome"}})
+
+	assert.Greater(t, small, int64(0))
+	assert.Greater(t, large, small+900)
+	assert.Greater(t, nested, small)
+}
+
+func TestMaxMemoryCacheCapacity(t *testing.T) {
+	assert.Equal(t, 10, MaxMemoryCacheCapacity(1024))
+	assert.Equal(t, 1, MaxMemoryCacheCapacity(50), "the cache always holds one collection")
+}
+
+func TestStorageEngine_CollectionMemoryUsage(t *testing.T) {
+	engine := NewStorageEngine(WithNoSaves(true))
+	defer engine.StopBackgroundWorkers()
+
+	_, err := engine.Insert("small", domain.Document{"n": 1})
+	require.NoError(t, err)
+	for i := 0; i < 10; i++ {
+		_, err := engine.Insert("large", domain.Document{"n": i, "text": strings.Repeat("x", 100)})
+		require.NoError(t, err)
+	}
+
+	usage := engine.CollectionMemoryUsage()
+	require.Len(t, usage, 2)
+	assert.Equal(t, "large", usage[0].Name)
+	assert.Equal(t, "small", usage[1].Name)
+	for _, collection := range usage {
+		assert.True(t, collection.Resident, collection.Name)
+		assert.Equal(t, collection.Documents, int64(collection.CachedDocs), collection.Name)
+	}
+	assert.Equal(t, int64(10), usage[0].Documents)
+	assert.Greater(t, usage[0].EstimatedBytes, usage[1].EstimatedBytes*5)
+}
+
+func TestStorageEngine_SetMaxMemory(t *testing.T) {
+	engine := NewStorageEngine(WithNoSaves(true))
+	defer engine.StopBackgroundWorkers()
+
+	assert.Error(t, engine.SetMaxMemory(0))
+	assert.Error(t, engine.SetMaxMemory(-1))
+
+	require.NoError(t, engine.SetMaxMemory(300))
+	stats := engine.GetMemoryStats()
+	assert.Equal(t, 300, stats["max_memory_mb"])
+	assert.Equal(t, 3, stats["cache_capacity"])
+}
+
+func TestStorageEngine_PinCollection(t *testing.T) {
+	engine := NewStorageEngine(WithNoSaves(true), WithMaxMemory(100), WithPinnedCollections([]string{"countries"}))
+	defer engine.StopBackgroundWorkers()
+
+	_, err := engine.Insert("countries", domain.Document{"code": "FR"})
+	require.NoError(t, err)
+	assert.True(t, engine.IsCollectionPinned("countries"))
+
+	// The cache holds one collection, yet later collections never evict the pinned one
+	for _, collName := range []string{"events_1", "events_2", "events_3"} {
+		_, err := engine.Insert(collName, domain.Document{"kind": "click"})
+		require.NoError(t, err)
+	}
+	_, cached := engine.cache.Peek("countries")
+	assert.True(t, cached)
+
+	for _, usage := range engine.CollectionMemoryUsage() {
+		assert.Equal(t, usage.Name == "countries", usage.Pinned, usage.Name)
+	}
+
+	engine.PinCollection("events_3")
+	assert.True(t, engine.IsCollectionPinned("events_3"))
+	engine.UnpinCollection("countries")
+	assert.False(t, engine.IsCollectionPinned("countries"))
+}
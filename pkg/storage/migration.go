@@ -0,0 +1,256 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/adfharrison1/go-db/pkg/domain"
+)
+
+// MaxMigrationFields is the maximum number of renames, adds and removes in one migration spec
+const MaxMigrationFields = 100
+
+// MigrationSpec is a declarative per-document transform for schema changes. Each
+// document is rewritten in three steps:
+//
+//	{"rename": {"fullName": "name"}}             move a field, replacing any existing target
+//	{"add": {"tier": "free", "first": "$name"}}  set fields the document does not have yet
+//	{"remove": ["legacyId"]}                     delete fields
+//
+// Add values use projection syntax and are evaluated after the renames: a literal,
+// a "$field" reference, an arithmetic operator or {"$expr": "..."}. Every step leaves
+// a document it was already applied to unchanged, so a migration that was cancelled
+// or failed can simply be run again.
+type MigrationSpec struct {
+	Rename map[string]string      `json:"rename,omitempty"` // Old field name -> new field name
+	Add    map[string]interface{} `json:"add,omitempty"`
+	Remove []string               `json:"remove,omitempty"`
+}
+
+// Migration is a compiled MigrationSpec
+type Migration struct {
+	renames []migrationRename
+	adds    []migrationAdd
+	removes []string
+}
+
+// migrationRename moves one field
+type migrationRename struct {
+	from, to string
+}
+
+// migrationAdd sets one field when it is absent
+type migrationAdd struct {
+	field string
+	node  exprNode
+}
+
+// CompileMigration validates a migration spec and compiles its add expressions.
+// Fields are top-level names; _id cannot be renamed, added or removed.
+func CompileMigration(spec MigrationSpec) (*Migration, error) {
+	total := len(spec.Rename) + len(spec.Add) + len(spec.Remove)
+	if total == 0 {
+		return nil, fmt.Errorf("migration must rename, add or remove at least one field")
+	}
+	if total > MaxMigrationFields {
+		return nil, fmt.Errorf("migration changes %d fields, the maximum is %d", total, MaxMigrationFields)
+	}
+
+	m := &Migration{}
+
+	targets := make(map[string]bool, len(spec.Rename))
+	for from, to := range spec.Rename {
+		if err := validateMigrationField(from); err != nil {
+			return nil, fmt.Errorf("rename: %w", err)
+		}
+		if err := validateMigrationField(to); err != nil {
+			return nil, fmt.Errorf("rename '%s': %w", from, err)
+		}
+		if from == to {
+			return nil, fmt.Errorf("rename '%s': source and target are the same", from)
+		}
+		if targets[to] {
+			return nil, fmt.Errorf("rename: more than one field is renamed to '%s'", to)
+		}
+		targets[to] = true
+		m.renames = append(m.renames, migrationRename{from: from, to: to})
+	}
+	// Chains (a -> b, b -> c) and re-adding a renamed field would change documents
+	// again on every run, so they are rejected to keep migrations repeatable
+	for _, rename := range m.renames {
+		if targets[rename.from] {
+			return nil, fmt.Errorf("rename '%s': field is also a rename target", rename.from)
+		}
+		if _, added := spec.Add[rename.from]; added {
+			return nil, fmt.Errorf("rename '%s': field is also added", rename.from)
+		}
+	}
+
+	for field, value := range spec.Add {
+		if err := validateMigrationField(field); err != nil {
+			return nil, fmt.Errorf("add: %w", err)
+		}
+		node, err := projectionNode(value)
+		if err != nil {
+			return nil, fmt.Errorf("add '%s': %w", field, err)
+		}
+		if _, err := node.check(); err != nil {
+			return nil, fmt.Errorf("add '%s': %w", field, err)
+		}
+		m.adds = append(m.adds, migrationAdd{field: field, node: node})
+	}
+
+	for _, field := range spec.Remove {
+		if err := validateMigrationField(field); err != nil {
+			return nil, fmt.Errorf("remove: %w", err)
+		}
+		m.removes = append(m.removes, field)
+	}
+
+	// Sorted so migrations are applied and reported deterministically
+	sort.Slice(m.renames, func(i, j int) bool { return m.renames[i].from < m.renames[j].from })
+	sort.Slice(m.adds, func(i, j int) bool { return m.adds[i].field < m.adds[j].field })
+	return m, nil
+}
+
+// validateMigrationField checks a field named by a migration
+func validateMigrationField(field string) error {
+	switch {
+	case field == "":
+		return fmt.Errorf("field name cannot be empty")
+	case field == "_id":
+		return fmt.Errorf("_id cannot be changed")
+	case strings.Contains(field, "."):
+		return fmt.Errorf("nested field '%s' is not supported", field)
+	}
+	return nil
+}
+
+// Apply returns the migrated form of doc and whether it differs from doc. The input
+// document is not modified. An add expression that fails to evaluate sets null, as in
+// projections.
+func (m *Migration) Apply(doc domain.Document) (domain.Document, bool) {
+	result := make(domain.Document, len(doc))
+	for key, value := range doc {
+		result[key] = value
+	}
+	changed := false
+
+	for _, rename := range m.renames {
+		if value, exists := result[rename.from]; exists {
+			result[rename.to] = value
+			delete(result, rename.from)
+			changed = true
+		}
+	}
+
+	for _, add := range m.adds {
+		if _, exists := result[add.field]; exists {
+			continue
+		}
+		value, err := add.node.eval(result)
+		if err != nil {
+			value = nil
+		}
+		result[add.field] = value
+		changed = true
+	}
+
+	for _, field := range m.removes {
+		if _, exists := result[field]; exists {
+			delete(result, field)
+			changed = true
+		}
+	}
+
+	return result, changed
+}
+
+// TransformDocumentsContext rewrites every document of a collection with transform,
+// which is given a copy of the document and returns its replacement and whether it
+// changed. Documents are processed in batches; each batch holds the collection write
+// lock, so writers are only paused briefly, and is saved once it is done in dual-write
+// mode. Documents inserted after the transform starts are not visited. progress is
+// called after each batch. It returns the number of documents changed, which is also
+// accurate when ctx is cancelled part way through.
+func (se *StorageEngine) TransformDocumentsContext(ctx context.Context, collName string, transform func(domain.Document) (domain.Document, bool), progress func(processed, total int)) (int, error) {
+	var docIDs []string
+	err := se.withCollectionReadLock(collName, func() error {
+		collection, err := se.getCollectionInternal(collName)
+		if err != nil {
+			return err
+		}
+		docIDs = collection.IDs()
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	changed := 0
+	for start := 0; start < len(docIDs); start += streamBatchSize {
+		if err := ctx.Err(); err != nil {
+			return changed, err
+		}
+		end := start + streamBatchSize
+		if end > len(docIDs) {
+			end = len(docIDs)
+		}
+
+		batchChanged, err := se.transformBatch(collName, docIDs[start:end], transform)
+		changed += batchChanged
+		if err != nil {
+			return changed, err
+		}
+
+		if batchChanged > 0 && !se.noSaves {
+			if err := se.SaveCollectionAfterTransaction(collName); err != nil {
+				// Queue for background retry if immediate write fails
+				se.queueDiskWriteContext(ctx, collName, "", nil) // Empty docID indicates batch operation
+			}
+		}
+
+		if progress != nil {
+			progress(end, len(docIDs))
+		}
+	}
+
+	return changed, nil
+}
+
+// transformBatch applies transform to the given documents under the collection write
+// lock, skipping documents deleted since they were listed
+func (se *StorageEngine) transformBatch(collName string, docIDs []string, transform func(domain.Document) (domain.Document, bool)) (int, error) {
+	changed := 0
+	err := se.withCollectionWriteLock(collName, func() error {
+		collection, err := se.getCollectionInternal(collName)
+		if err != nil {
+			return err
+		}
+
+		for _, docID := range docIDs {
+			err := se.withDocumentWriteLock(collName, docID, func() error {
+				doc, exists := collection.Get(docID)
+				if !exists {
+					return nil
+				}
+				newDoc, docChanged := transform(CopyDocument(doc))
+				if !docChanged {
+					return nil
+				}
+				if _, err := se.replaceByIdUnsafe(collName, docID, newDoc); err != nil {
+					return err
+				}
+				changed++
+				return nil
+			})
+			if err != nil {
+				return fmt.Errorf("failed to transform document %s: %w", docID, err)
+			}
+		}
+		return nil
+	})
+	return changed, err
+}
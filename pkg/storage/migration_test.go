@@ -0,0 +1,127 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/adfharrison1/go-db/pkg/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompileMigration_Invalid(t *testing.T) {
+	specs := map[string]MigrationSpec{
+		"empty":          {},
+		"rename _id":     {Rename: map[string]string{"_id": "id"}},
+		"remove _id":     {Remove: []string{"_id"}},
+		"add _id":        {Add: map[string]interface{}{"_id": "x"}},
+		"nested":         {Remove: []string{"address.zip"}},
+		"same name":      {Rename: map[string]string{"a": "a"}},
+		"shared target":  {Rename: map[string]string{"a": "c", "b": "c"}},
+		"chain":          {Rename: map[string]string{"a": "b", "b": "c"}},
+		"readd source":   {Rename: map[string]string{"a": "b"}, Add: map[string]interface{}{"a": 1}},
+		"bad expression": {Add: map[string]interface{}{"a": map[string]interface{}{"$pow": []interface{}{1, 2}}}},
+	}
+	for name, spec := range specs {
+		_, err := CompileMigration(spec)
+		assert.Error(t, err, name)
+	}
+}
+
+func TestMigration_Apply(t *testing.T) {
+	m, err := CompileMigration(MigrationSpec{
+		Rename: map[string]string{"fullName": "name"},
+		Add: map[string]interface{}{
+			"tier":     "free",
+			"greeting": "$name",
+			"total":    map[string]interface{}{"$expr": "price * qty"},
+		},
+		Remove: []string{"legacyId"},
+	})
+	require.NoError(t, err)
+
+	doc := domain.Document{"_id": "1", "fullName": "Alice", "legacyId": 7, "price": 2, "qty": 3, "tier": "pro"}
+	migrated, changed := m.Apply(doc)
+	assert.True(t, changed)
+	assert.Equal(t, domain.Document{
+		"_id": "1", "name": "Alice", "greeting": "Alice", "total": float64(6), "price": 2, "qty": 3, "tier": "pro",
+	}, migrated)
+	assert.Contains(t, doc, "fullName", "input document is not modified")
+
+	// Applying the migration again changes nothing
+	again, changed := m.Apply(migrated)
+	assert.False(t, changed)
+	assert.Equal(t, migrated, again)
+}
+
+func TestStorageEngine_TransformDocumentsContext(t *testing.T) {
+	migration, err := CompileMigration(MigrationSpec{
+		Rename: map[string]string{"city": "town"},
+		Add:    map[string]interface{}{"migrated": true},
+	})
+	require.NoError(t, err)
+
+	for name, noSaves := range map[string]bool{"no-saves": true, "dual-write": false} {
+		t.Run(name, func(t *testing.T) {
+			engine := NewStorageEngine(WithNoSaves(noSaves), WithDataDir(t.TempDir()))
+			defer engine.StopBackgroundWorkers()
+
+			// More than one batch, so progress is reported several times
+			docs := make([]domain.Document, streamBatchSize+10)
+			for i := range docs {
+				docs[i] = domain.Document{"n": i, "city": "Paris"}
+			}
+			_, err := engine.BatchInsert("users", docs)
+			require.NoError(t, err)
+			require.NoError(t, engine.CreateIndex("users", "town"))
+
+			var reports [][2]int
+			changed, err := engine.TransformDocumentsContext(context.Background(), "users", migration.Apply, func(processed, total int) {
+				reports = append(reports, [2]int{processed, total})
+			})
+			require.NoError(t, err)
+			assert.Equal(t, len(docs), changed)
+			assert.Equal(t, [][2]int{{streamBatchSize, len(docs)}, {len(docs), len(docs)}}, reports)
+
+			// Indexes on the new field were updated
+			result, err := engine.FindAll("users", map[string]interface{}{"town": "Paris"}, &domain.PaginationOptions{Limit: 1, MaxLimit: 1000})
+			require.NoError(t, err)
+			assert.Equal(t, int64(len(docs)), result.Total)
+
+			doc, err := engine.GetById("users", "1")
+			require.NoError(t, err)
+			assert.NotContains(t, doc, "city")
+			assert.Equal(t, true, doc["migrated"])
+
+			changed, err = engine.TransformDocumentsContext(context.Background(), "users", migration.Apply, nil)
+			require.NoError(t, err)
+			assert.Zero(t, changed, "rerunning a migration is a no-op")
+		})
+	}
+}
+
+func TestStorageEngine_TransformDocumentsContext_Cancelled(t *testing.T) {
+	engine := NewStorageEngine(WithNoSaves(true))
+	defer engine.StopBackgroundWorkers()
+
+	for i := 0; i < 3; i++ {
+		_, err := engine.Insert("users", domain.Document{"name": fmt.Sprintf("user%d", i)})
+		require.NoError(t, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	changed, err := engine.TransformDocumentsContext(ctx, "users", func(doc domain.Document) (domain.Document, bool) {
+		doc["touched"] = true
+		return doc, true
+	}, nil)
+	assert.True(t, errors.Is(err, context.Canceled), "got %v", err)
+	assert.Zero(t, changed)
+
+	_, err = engine.TransformDocumentsContext(context.Background(), "missing", func(doc domain.Document) (domain.Document, bool) {
+		return doc, false
+	}, nil)
+	assert.Error(t, err)
+}
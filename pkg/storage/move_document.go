@@ -0,0 +1,123 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+
+	"github.com/adfharrison1/go-db/pkg/domain"
+)
+
+// MoveDocument removes a document from srcColl and inserts it into dstColl, creating
+// dstColl if needed, and returns the moved document. With keepID the document keeps
+// its _id, and the move fails with domain.ErrDocumentExists if dstColl already holds
+// that ID; otherwise dstColl assigns a new one. A move rejected by dstColl's strict
+// schema or unique indexes changes neither collection, and the document keeps its
+// _version. Both collections are write-locked in name order for the whole move, and
+// the document too, so no reader sees it in both or neither and no update of it is
+// lost. Both collection files are saved before returning, the destination first, so a
+// crash between the two saves leaves a duplicate rather than losing the document.
+func (se *StorageEngine) MoveDocument(srcColl, docId, dstColl string, keepID bool) (domain.Document, error) {
+	if srcColl == dstColl {
+		return nil, fmt.Errorf("cannot move document %s within collection %s", docId, srcColl)
+	}
+
+	first, second := srcColl, dstColl
+	if second < first {
+		first, second = second, first
+	}
+	for _, collName := range []string{first, second} {
+		release, err := se.writeLimiter.Acquire(context.Background(), collName)
+		if err != nil {
+			return nil, err
+		}
+		defer release()
+	}
+
+	var moved domain.Document
+	err := se.withCollectionWriteLock(first, func() error {
+		return se.withCollectionWriteLock(second, func() error {
+			// Per-document writers change the document in place holding only its lock
+			err := se.withDocumentWriteLock(srcColl, docId, func() error {
+				var err error
+				moved, err = se.moveDocumentUnsafe(srcColl, docId, dstColl, keepID)
+				return err
+			})
+			if err != nil || se.noSaves {
+				return err
+			}
+			for _, collName := range []string{dstColl, srcColl} {
+				if err := se.saveCollectionToFileUnsafe(collName); err != nil {
+					// The move has happened in memory; retry the save in the background
+					se.queueDiskWriteContext(context.Background(), collName, "", nil)
+				}
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	se.trackDelete(srcColl, docId)
+	return moved, nil
+}
+
+// moveDocumentUnsafe performs the move in memory. Every check on the destination runs
+// before the source changes, so a move that fails leaves both collections as they
+// were (caller must hold both collection write locks and the document write lock).
+func (se *StorageEngine) moveDocumentUnsafe(srcColl, docId, dstColl string, keepID bool) (domain.Document, error) {
+	src, err := se.getCollectionInternal(srcColl)
+	if err != nil {
+		return nil, err
+	}
+	doc, exists := src.Get(docId)
+	if !exists {
+		return nil, domain.Errorf(domain.ErrDocumentNotFound, "document with id %s not found in collection %s", docId, srcColl)
+	}
+
+	moved := CopyDocument(doc)
+	if err := se.checkStrictSchema(dstColl, moved); err != nil {
+		return nil, err
+	}
+	dst, err := se.getCollectionInternal(dstColl)
+	if err != nil {
+		if !errors.Is(err, domain.ErrCollectionNotFound) {
+			return nil, err
+		}
+		// The destination is created once every other check has passed
+		if err := se.validateNewCollection(dstColl); err != nil {
+			return nil, err
+		}
+	}
+
+	newID := docId
+	if keepID {
+		if dst != nil && dst.Has(docId) {
+			return nil, domain.Errorf(domain.ErrDocumentExists, "document with id %s already exists in collection %s", docId, dstColl)
+		}
+	} else {
+		newID = fmt.Sprintf("%d", atomic.AddInt64(se.idCounter(dstColl), 1))
+	}
+	if err := se.indexEngine.CheckUnique(dstColl, []string{newID}, []domain.Document{moved}); err != nil {
+		return nil, err
+	}
+
+	// The move cannot fail from here on
+	if err := se.ensureCollectionUnsafe(dstColl); err != nil {
+		return nil, err
+	}
+	if keepID {
+		// Never hand out the kept ID again in the destination
+		se.raiseIDCounter(dstColl, docId)
+	}
+	if _, err := se.deleteByIdUnsafe(srcColl, docId); err != nil {
+		return nil, err
+	}
+	// The document keeps its _version, as the move is not a write of its fields
+	if _, err := se.addDocumentUnsafe(dstColl, newID, moved); err != nil {
+		return nil, err
+	}
+	se.trackInsertsUnsafe(dstColl, newID)
+	return moved, nil
+}
@@ -0,0 +1,186 @@
+package storage
+
+import (
+	"errors"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/adfharrison1/go-db/pkg/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStorageEngine_MoveDocument(t *testing.T) {
+	tempDir := t.TempDir()
+	engine := NewStorageEngine(WithDataDir(tempDir))
+	defer engine.StopBackgroundWorkers()
+
+	for _, task := range []string{"build", "test", "deploy"} {
+		_, err := engine.Insert("pending", domain.Document{"task": task})
+		require.NoError(t, err)
+	}
+	_, err := engine.Insert("completed", domain.Document{"task": "plan"})
+	require.NoError(t, err)
+	require.NoError(t, engine.CreateIndex("completed", "task"))
+
+	t.Run("new id in the destination", func(t *testing.T) {
+		moved, err := engine.MoveDocument("pending", "1", "completed", false)
+		require.NoError(t, err)
+		assert.Equal(t, "2", moved["_id"])
+		assert.Equal(t, "build", moved["task"])
+
+		_, err = engine.GetById("pending", "1")
+		assert.True(t, errors.Is(err, domain.ErrDocumentNotFound))
+		doc, err := engine.GetById("completed", "2")
+		require.NoError(t, err)
+		assert.Equal(t, "build", doc["task"])
+
+		docs, err := engine.FindByIndex("completed", "task", "build")
+		require.NoError(t, err)
+		assert.Len(t, docs, 1)
+
+		engine.mu.RLock()
+		assert.Equal(t, int64(2), engine.collections["pending"].DocumentCount)
+		assert.Equal(t, int64(2), engine.collections["completed"].DocumentCount)
+		engine.mu.RUnlock()
+	})
+
+	t.Run("kept id", func(t *testing.T) {
+		moved, err := engine.MoveDocument("pending", "3", "completed", true)
+		require.NoError(t, err)
+		assert.Equal(t, "3", moved["_id"])
+
+		// The kept ID is not handed out again
+		doc, err := engine.Insert("completed", domain.Document{"task": "review"})
+		require.NoError(t, err)
+		assert.Equal(t, "4", doc["_id"])
+	})
+
+	t.Run("kept id already taken", func(t *testing.T) {
+		_, err := engine.MoveDocument("pending", "2", "completed", true)
+		assert.True(t, errors.Is(err, domain.ErrDocumentExists))
+
+		// Nothing moved
+		doc, err := engine.GetById("pending", "2")
+		require.NoError(t, err)
+		assert.Equal(t, "test", doc["task"])
+	})
+
+	t.Run("missing document", func(t *testing.T) {
+		_, err := engine.MoveDocument("pending", "99", "completed", false)
+		assert.True(t, errors.Is(err, domain.ErrDocumentNotFound))
+	})
+
+	t.Run("creates the destination", func(t *testing.T) {
+		_, err := engine.MoveDocument("pending", "2", "archived", true)
+		require.NoError(t, err)
+		doc, err := engine.GetById("archived", "2")
+		require.NoError(t, err)
+		assert.Equal(t, "test", doc["task"])
+	})
+
+	t.Run("same collection", func(t *testing.T) {
+		_, err := engine.MoveDocument("completed", "2", "completed", false)
+		assert.Error(t, err)
+	})
+
+	t.Run("both collections are saved", func(t *testing.T) {
+		assert.FileExists(t, filepath.Join(tempDir, "collections", "archived.godb"))
+		engine.mu.RLock()
+		assert.NotEqual(t, CollectionStateDirty, engine.collections["pending"].State)
+		assert.NotEqual(t, CollectionStateDirty, engine.collections["archived"].State)
+		engine.mu.RUnlock()
+	})
+}
+
+func TestStorageEngine_MoveDocumentStrictSchema(t *testing.T) {
+	engine := NewStorageEngine(WithDataDir(t.TempDir()), WithNoSaves(true))
+	defer engine.StopBackgroundWorkers()
+
+	_, err := engine.Insert("pending", domain.Document{"task": "build", "owner": "ann"})
+	require.NoError(t, err)
+	require.NoError(t, engine.CreateCollection("completed"))
+	engine.SetCollectionSchema("completed", map[string]domain.FieldType{"task": domain.FieldTypeAny})
+	engine.SetCollectionSchemaStrict("completed", true)
+
+	_, err = engine.MoveDocument("pending", "1", "completed", false)
+	assert.True(t, errors.Is(err, domain.ErrFieldNotInSchema))
+	_, err = engine.GetById("pending", "1")
+	assert.NoError(t, err, "a rejected move leaves the document in place")
+}
+
+func TestStorageEngine_MoveDocumentAllOrNothing(t *testing.T) {
+	engine := NewStorageEngine(WithNoSaves(true), WithDocumentVersions(true))
+	defer engine.StopBackgroundWorkers()
+
+	_, err := engine.Insert("pending", domain.Document{"email": "a@x"})
+	require.NoError(t, err)
+	_, err = engine.UpdateById("pending", "1", domain.Document{"name": "Ann"})
+	require.NoError(t, err)
+	_, err = engine.Insert("completed", domain.Document{"email": "a@x"})
+	require.NoError(t, err)
+	require.NoError(t, engine.CreateUniqueIndex("completed", "email"))
+
+	// A unique key taken in the destination leaves both collections as they were
+	_, err = engine.MoveDocument("pending", "1", "completed", false)
+	assert.ErrorIs(t, err, domain.ErrDuplicateKey)
+	_, err = engine.GetById("pending", "1")
+	assert.NoError(t, err)
+	ids, err := engine.FindIds("completed", map[string]interface{}{})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"1"}, ids)
+
+	// A collection that cannot be created is not created, and nothing moves
+	_, err = engine.MoveDocument("pending", "1", "bad/name", false)
+	assert.ErrorIs(t, err, domain.ErrInvalidCollectionName)
+	_, err = engine.GetById("pending", "1")
+	assert.NoError(t, err)
+
+	_, err = engine.UpdateById("completed", "1", domain.Document{"email": "b@x"})
+	require.NoError(t, err)
+	moved, err := engine.MoveDocument("pending", "1", "completed", false)
+	require.NoError(t, err)
+	assert.EqualValues(t, 2, moved[VersionField], "the move keeps the version")
+}
+
+func TestStorageEngine_MoveDocumentConcurrentUpdates(t *testing.T) {
+	engine := NewStorageEngine(WithDataDir(t.TempDir()))
+	defer engine.StopBackgroundWorkers()
+
+	const docs = 10
+	for i := 0; i < docs; i++ {
+		_, err := engine.Insert("pending", domain.Document{"count": 0})
+		require.NoError(t, err)
+	}
+
+	// Updates of a document either land before its move or find it gone
+	var wg sync.WaitGroup
+	for i := 1; i <= docs; i++ {
+		docID := strconv.Itoa(i)
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 5; j++ {
+				_, err := engine.UpdateById("pending", docID, domain.Document{IncKey: map[string]interface{}{"count": 1}})
+				if err != nil {
+					assert.ErrorIs(t, err, domain.ErrDocumentNotFound)
+				}
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			_, err := engine.MoveDocument("pending", docID, "completed", true)
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+
+	ids, err := engine.FindIds("completed", map[string]interface{}{})
+	require.NoError(t, err)
+	assert.Len(t, ids, docs)
+	ids, err = engine.FindIds("pending", map[string]interface{}{})
+	require.NoError(t, err)
+	assert.Empty(t, ids)
+}
@@ -0,0 +1,74 @@
+package storage
+
+import (
+	"fmt"
+
+	"github.com/adfharrison1/go-db/pkg/domain"
+)
+
+// NeFilterKey is the operator matching documents whose field does not equal a value,
+// e.g. {"deleted": {"$ne": true}}. Documents without the field match, and an array
+// matches when none of its elements equals the value. It can be combined with range
+// operators on the same field, e.g. {"age": {"$gt": 30, "$ne": 40}}. Values are
+// compared like equality (see ValuesMatch). Documents are always scanned; indexes
+// are not used.
+const NeFilterKey = "$ne"
+
+// NeFilterValue splits a $ne filter value into the excluded value and the range
+// operators given with it, nil when there are none. The last result is false when
+// the filter value holds no $ne.
+func NeFilterValue(expected interface{}) (interface{}, map[string]interface{}, bool) {
+	operator, ok := expected.(map[string]interface{})
+	if !ok {
+		return nil, nil, false
+	}
+	excluded, exists := operator[NeFilterKey]
+	if !exists {
+		return nil, nil, false
+	}
+	if len(operator) == 1 {
+		return excluded, nil, true
+	}
+	bounds := make(map[string]interface{}, len(operator)-1)
+	for key, bound := range operator {
+		if key != NeFilterKey {
+			bounds[key] = bound
+		}
+	}
+	return excluded, bounds, true
+}
+
+// validateNeFilter checks that a $ne operator holds a plain value and is combined
+// with range operators only
+func validateNeFilter(field string, expected interface{}) error {
+	excluded, bounds, ok := NeFilterValue(expected)
+	if !ok {
+		return nil
+	}
+	if IsFilterCondition(excluded) {
+		return fmt.Errorf("%w: %s on field %s must hold a value, not an operator", domain.ErrInvalidFilter, NeFilterKey, field)
+	}
+	if bounds == nil {
+		return nil
+	}
+	if _, ok := RangeFilterBounds(bounds); !ok {
+		return fmt.Errorf("%w: %s on field %s can only be combined with range operators", domain.ErrInvalidFilter, NeFilterKey, field)
+	}
+	return nil
+}
+
+// matchesNe reports whether none of the values equals excluded, directly or as an
+// array element, and any of them satisfies the range bounds given with the $ne
+func matchesNe(values []interface{}, excluded interface{}, bounds map[string]interface{}) bool {
+	for _, value := range values {
+		if matchesFieldValue(value, excluded) {
+			return false
+		}
+	}
+	if bounds == nil {
+		return true
+	}
+	return matchesAnyElement(values, func(value interface{}) bool {
+		return matchesFieldValue(value, bounds)
+	})
+}
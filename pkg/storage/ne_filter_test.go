@@ -0,0 +1,90 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/adfharrison1/go-db/pkg/domain"
+	"github.com/adfharrison1/go-db/pkg/indexing"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func ne(value interface{}) map[string]interface{} {
+	return map[string]interface{}{"$ne": value}
+}
+
+func TestNeFilter_MatchesFilter(t *testing.T) {
+	doc := domain.Document{"name": "Alice", "age": 30, "tags": []interface{}{"a", "b"}, "profile": map[string]interface{}{"city": "Paris"}}
+
+	assert.True(t, MatchesFilter(doc, map[string]interface{}{"age": ne(31)}))
+	assert.False(t, MatchesFilter(doc, map[string]interface{}{"age": ne(30.0)}), "numbers compare like equality")
+	assert.False(t, MatchesFilter(doc, map[string]interface{}{"name": ne("alice")}), "strings compare like equality")
+	assert.True(t, MatchesFilter(doc, map[string]interface{}{"deleted": ne(true)}), "a missing field matches")
+	assert.True(t, MatchesFilter(doc, map[string]interface{}{"profile.zip": ne("75001")}))
+	assert.False(t, MatchesFilter(doc, map[string]interface{}{"profile.city": ne("Paris")}))
+	assert.False(t, MatchesFilter(doc, map[string]interface{}{"tags": ne("b")}), "an array holding the value does not match")
+	assert.True(t, MatchesFilter(doc, map[string]interface{}{"tags": ne("c")}))
+
+	// Combined with range operators, every operator must hold
+	between := map[string]interface{}{"$gt": 18, "$lte": 65, "$ne": 40}
+	assert.True(t, MatchesFilter(doc, map[string]interface{}{"age": between}))
+	assert.False(t, MatchesFilter(domain.Document{"age": 40}, map[string]interface{}{"age": between}))
+	assert.False(t, MatchesFilter(domain.Document{"age": 70}, map[string]interface{}{"age": between}))
+	assert.False(t, MatchesFilter(domain.Document{}, map[string]interface{}{"age": between}), "a missing field has no value in range")
+}
+
+func TestNeFilter_Validate(t *testing.T) {
+	assert.NoError(t, ValidateFilter(map[string]interface{}{"deleted": ne(true)}))
+	assert.NoError(t, ValidateFilter(map[string]interface{}{"deleted": ne(nil)}))
+	assert.NoError(t, ValidateFilter(map[string]interface{}{"age": map[string]interface{}{"$gte": 1, "$ne": 3}}))
+
+	for _, filter := range []map[string]interface{}{
+		{"age": ne(map[string]interface{}{"$gt": 1})},
+		{"age": map[string]interface{}{"$ne": 1, "$in": []interface{}{2}}},
+		{"age": map[string]interface{}{"$ne": 1, "$gt": nil}},
+	} {
+		assert.ErrorIs(t, ValidateFilter(filter), domain.ErrInvalidFilter, "filter %v", filter)
+	}
+}
+
+func TestNeFilter_IndexedField(t *testing.T) {
+	engine := NewStorageEngine(WithNoSaves(true))
+	defer engine.StopBackgroundWorkers()
+	for _, status := range []interface{}{"open", "closed", "open", nil} {
+		doc := domain.Document{}
+		if status != nil {
+			doc["status"] = status
+		}
+		_, err := engine.Insert("orders", doc)
+		require.NoError(t, err)
+	}
+	require.NoError(t, engine.CreateIndex("orders", "status"))
+
+	// The index cannot answer a $ne, so the documents are scanned
+	filter := map[string]interface{}{"status": ne("open")}
+	_, ok := IndexOnlyIDs(filter, func(field string) (*indexing.Index, bool) { return engine.getIndex("orders", field) })
+	assert.False(t, ok)
+
+	ids, err := engine.FindIds("orders", filter)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"2", "4"}, ids)
+
+	result, err := engine.FindAll("orders", map[string]interface{}{"_id": ne("2"), "status": map[string]interface{}{"$gte": "open"}}, nil)
+	require.NoError(t, err)
+	require.Len(t, result.Documents, 2)
+}
+
+func TestNeFilter_DefaultFilter(t *testing.T) {
+	engine := NewStorageEngine(WithNoSaves(true))
+	defer engine.StopBackgroundWorkers()
+	for _, doc := range []domain.Document{{"name": "kept"}, {"name": "removed", "deleted": true}, {"name": "restored", "deleted": false}} {
+		_, err := engine.Insert("items", doc)
+		require.NoError(t, err)
+	}
+
+	// Soft-deleted documents are hidden, including from documents that never had the flag
+	engine.SetCollectionDefaultFilter("items", map[string]interface{}{"deleted": ne(true)})
+	result, err := engine.FindAll("items", nil, nil)
+	require.NoError(t, err)
+	assert.Len(t, result.Documents, 2)
+}
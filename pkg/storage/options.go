@@ -1,5 +1,10 @@
 package storage
 
+import (
+	"regexp"
+	"time"
+)
+
 type StorageOption func(*StorageEngine)
 
 func WithMaxMemory(mb int) StorageOption {
@@ -20,3 +25,199 @@ func WithNoSaves(enabled bool) StorageOption {
 		engine.noSaves = enabled
 	}
 }
+
+// WithStorageLayout selects how collections are stored on disk (default LayoutPerCollection).
+// A database must be loaded with the same layout it was saved with.
+func WithStorageLayout(layout StorageLayout) StorageOption {
+	return func(engine *StorageEngine) {
+		engine.layout = layout
+	}
+}
+
+// WithCollectionNamePattern sets the allowed-character pattern for collection names.
+// Path separators, null bytes and reserved filesystem characters are always rejected.
+func WithCollectionNamePattern(pattern *regexp.Regexp) StorageOption {
+	return func(engine *StorageEngine) {
+		engine.collectionNamePattern = pattern
+	}
+}
+
+// WithMaxCollections limits how many collections can exist, including collections
+// created implicitly by inserts. Zero means unlimited.
+func WithMaxCollections(n int) StorageOption {
+	return func(engine *StorageEngine) {
+		engine.maxCollections = n
+	}
+}
+
+// WithMaxResultSize limits how many documents a FindAll may match before pagination
+// is applied, bounding the memory used to collect and sort the matches. Queries
+// matching more fail with domain.ErrResultTooLarge. Zero means unlimited.
+func WithMaxResultSize(n int) StorageOption {
+	return func(engine *StorageEngine) {
+		engine.maxResultSize = n
+	}
+}
+
+// WithDeltaLog makes updates append their changed fields to a per-collection delta
+// log instead of rewriting the collection file. Deltas are folded into the base file
+// periodically and on shutdown. Only applies to the per-collection layout.
+func WithDeltaLog(enabled bool) StorageOption {
+	return func(engine *StorageEngine) {
+		engine.deltaLog = enabled
+	}
+}
+
+// WithTombstoneDeletes makes deletes append a small tombstone to the collection's delta
+// log instead of rewriting the collection file. The document leaves memory and its
+// indexes at once and is purged from the base file when the delta log is compacted,
+// periodically and on shutdown. Only applies to the per-collection layout.
+func WithTombstoneDeletes(enabled bool) StorageOption {
+	return func(engine *StorageEngine) {
+		engine.tombstoneDeletes = enabled
+	}
+}
+
+// WithDeltaCompaction sets how often delta logs are compacted and how many deltas a
+// collection may accumulate before it is compacted immediately (0 = no threshold)
+func WithDeltaCompaction(interval time.Duration, threshold int) StorageOption {
+	return func(engine *StorageEngine) {
+		engine.deltaCompactInterval = interval
+		engine.deltaCompactThreshold = threshold
+	}
+}
+
+// WithCompaction enables a background worker that checks cached collections every
+// interval and rewrites the file of any collection whose base file and delta log
+// together exceed ratio times the estimated size of its live documents
+// (ratio <= 0 uses DefaultCompactionRatio). The worker skips collections that are
+// busy or have a save pending rather than waiting for them. Only applies to the
+// per-collection layout; an interval of zero disables it.
+func WithCompaction(interval time.Duration, ratio float64) StorageOption {
+	return func(engine *StorageEngine) {
+		if ratio <= 0 {
+			ratio = DefaultCompactionRatio
+		}
+		engine.compaction.interval = interval
+		engine.compaction.ratio = ratio
+	}
+}
+
+// WithTempDir sets the directory for the temporary files that saves are written to
+// before being renamed over their target (default: the target's own directory).
+// A directory on another filesystem works but costs an extra copy per save, since
+// only renames within a filesystem are atomic.
+func WithTempDir(dir string) StorageOption {
+	return func(engine *StorageEngine) {
+		engine.tempDir = dir
+	}
+}
+
+// WithAutoTimestamps makes the engine maintain _created_at and _updated_at on every
+// document. Inserts set both, updates and replaces bump _updated_at, and client
+// values for either field are ignored. Disabled by default.
+func WithAutoTimestamps(enabled bool) StorageOption {
+	return func(engine *StorageEngine) {
+		engine.autoTimestamps = enabled
+	}
+}
+
+// WithDocumentVersions makes the engine maintain a _version on every document for
+// optimistic concurrency (see UpdateByIdIfVersion). Inserts set it to 1, updates and
+// replaces add 1, and client values are ignored. Disabled by default.
+func WithDocumentVersions(enabled bool) StorageOption {
+	return func(engine *StorageEngine) {
+		engine.documentVersions = enabled
+	}
+}
+
+// WithCopyOnRead makes GetById, FindAll, FindAllStream and Sample return deep copies
+// of stored documents, so callers embedding the engine can modify results without
+// corrupting stored data or racing with writers. Off by default: the HTTP API only
+// serializes results, and copying costs an allocation per nested map and slice of
+// every returned document.
+func WithCopyOnRead(enabled bool) StorageOption {
+	return func(engine *StorageEngine) {
+		engine.copyOnRead = enabled
+	}
+}
+
+// WithSnapshotRead makes FindAllStream, and so the streaming and aggregate endpoints,
+// read from a snapshot taken when the stream starts: the result reflects a single
+// moment however long the consumer takes, ignoring inserts, updates and deletes made
+// meanwhile. Opening a snapshot copies the stream's candidate entries of the Documents
+// map (every document unless an index narrows them down), roughly 50 bytes per
+// document held until the stream ends, and the snapshot also keeps the old version of
+// each document updated while it is open. Off by default: streams then see some
+// concurrent writes and not others.
+func WithSnapshotRead(enabled bool) StorageOption {
+	return func(engine *StorageEngine) {
+		engine.snapshotRead = enabled
+	}
+}
+
+// WithMaxConcurrentWrites bounds how many inserts, updates, replaces, deletes and
+// batches run at once on a single collection; further writers queue until one
+// finishes. This smooths latency and bounds lock and memory use when thousands of
+// requests hit one collection. Current in-flight and queued counts are reported in
+// concurrent_writes of the memory stats. Zero means unlimited.
+func WithMaxConcurrentWrites(n int) StorageOption {
+	return func(engine *StorageEngine) {
+		engine.writeLimiter = NewWriteLimiter(n)
+	}
+}
+
+// WithPreloadCollections loads the named collections and rebuilds their indexes when
+// PreloadCollections is called at startup, several in parallel, so the first request
+// to each does not pay for loading it. Until every listed collection has been
+// attempted, PreloadProgress reports the preload as not done. Preloaded collections
+// are cached like any other and may be evicted when the cache (see WithMaxMemory)
+// is smaller than the list.
+func WithPreloadCollections(collections []string) StorageOption {
+	return func(engine *StorageEngine) {
+		engine.preloader = NewPreloader(collections)
+	}
+}
+
+// WithPinnedCollections pins the named collections in the cache (see PinCollection),
+// so loading other collections never evicts them. Combine it with
+// WithPreloadCollections to have them resident from startup.
+func WithPinnedCollections(collections []string) StorageOption {
+	return func(engine *StorageEngine) {
+		engine.pinnedCollections = append(engine.pinnedCollections, collections...)
+	}
+}
+
+// WithChangeLogSize sets how many recent changes each collection's change log retains
+// for GetChanges (default DefaultChangeLogSize). Every write stores a copy of the
+// written document in the log, so the cost is up to n documents per collection. Zero
+// turns the change log off.
+func WithChangeLogSize(n int) StorageOption {
+	return func(engine *StorageEngine) {
+		engine.changeLog = NewChangeLog(n)
+	}
+}
+
+// WithInsertionOrder tracks the order documents are inserted into each collection, so
+// FindAll can return them in that order (domain.OrderInserted) without sorting. Each
+// document costs one list entry; updates keep its position and deletes unlink it.
+// The order is kept in memory: collections loaded from disk start in _id order.
+func WithInsertionOrder(enabled bool) StorageOption {
+	return func(engine *StorageEngine) {
+		engine.insertionOrder = nil
+		if enabled {
+			engine.insertionOrder = NewInsertionOrder()
+		}
+	}
+}
+
+// WithSaveConcurrency bounds how many collection files background saves write at once
+// (default DefaultSaveConcurrency; zero or less uses the default). Saving the dirty
+// collections starts with the one dirty longest, and retries of failed writes wait
+// for a saver too. Queue depth and active savers are reported in background_saves of
+// the memory stats.
+func WithSaveConcurrency(n int) StorageOption {
+	return func(engine *StorageEngine) {
+		engine.savePool = newSavePool(n)
+	}
+}
@@ -314,3 +314,79 @@ func TestPagination_MaxLimit(t *testing.T) {
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "limit 2000 exceeds maximum 1000")
 }
+
+func TestPagination_PageNumbers(t *testing.T) {
+	engine := NewStorageEngine(WithNoSaves(true))
+	defer engine.StopBackgroundWorkers()
+
+	for i := 1; i <= 10; i++ {
+		_, err := engine.Insert("users", domain.Document{"name": fmt.Sprintf("user%d", i)})
+		require.NoError(t, err)
+	}
+
+	for _, tc := range []struct {
+		limit, offset, page, totalPages int
+	}{
+		{limit: 3, offset: 0, page: 1, totalPages: 4},
+		{limit: 3, offset: 3, page: 2, totalPages: 4},
+		{limit: 3, offset: 9, page: 4, totalPages: 4},
+		{limit: 3, offset: 4, page: 2, totalPages: 4},  // Within the second page
+		{limit: 5, offset: 20, page: 5, totalPages: 2}, // Past the last page
+		{limit: 10, offset: 0, page: 1, totalPages: 1},
+	} {
+		result, err := engine.FindAll("users", nil, &domain.PaginationOptions{Limit: tc.limit, Offset: tc.offset, MaxLimit: 1000})
+		require.NoError(t, err)
+		assert.Equal(t, tc.page, result.Page, "limit %d offset %d", tc.limit, tc.offset)
+		assert.Equal(t, tc.totalPages, result.TotalPages, "limit %d offset %d", tc.limit, tc.offset)
+	}
+
+	// Cursor pages have no page numbers
+	first, err := engine.FindAll("users", nil, &domain.PaginationOptions{Limit: 3, MaxLimit: 1000})
+	require.NoError(t, err)
+	next, err := engine.FindAll("users", nil, &domain.PaginationOptions{Limit: 3, MaxLimit: 1000, After: first.NextCursor})
+	require.NoError(t, err)
+	assert.Zero(t, next.Page)
+	assert.Zero(t, next.TotalPages)
+}
+
+func TestPagination_SortField(t *testing.T) {
+	engine := NewStorageEngine(WithNoSaves(true))
+	defer engine.StopBackgroundWorkers()
+
+	for _, doc := range []domain.Document{
+		{"name": "Carol", "age": 35},
+		{"name": "alice", "age": 9.5},
+		{"name": "Bob"},
+		{"name": "Dave", "age": 100},
+		{"name": "Eve", "age": 35},
+		{"name": "Frank", "age": nil},
+	} {
+		_, err := engine.Insert("users", doc)
+		require.NoError(t, err)
+	}
+
+	names := func(options *domain.PaginationOptions) []interface{} {
+		result, err := engine.FindAll("users", nil, options)
+		require.NoError(t, err)
+		var names []interface{}
+		for _, doc := range result.Documents {
+			names = append(names, doc["name"])
+		}
+		return names
+	}
+
+	// Numbers sort numerically, ties by _id, documents without a value last
+	assert.Equal(t, []interface{}{"alice", "Carol", "Eve", "Dave", "Bob", "Frank"}, names(&domain.PaginationOptions{SortField: "age"}))
+	assert.Equal(t, []interface{}{"Dave", "Carol", "Eve", "alice", "Bob", "Frank"}, names(&domain.PaginationOptions{SortField: "age", SortDesc: true}))
+	assert.Equal(t, []interface{}{"Bob", "Carol", "Dave", "Eve", "Frank", "alice"}, names(&domain.PaginationOptions{SortField: "name"}))
+
+	// Pages, by offset or cursor, follow the sort
+	assert.Equal(t, []interface{}{"Eve", "Dave"}, names(&domain.PaginationOptions{SortField: "age", Limit: 2, Offset: 2}))
+	first, err := engine.FindAll("users", nil, &domain.PaginationOptions{SortField: "age", Limit: 2, MaxLimit: 10})
+	require.NoError(t, err)
+	require.True(t, first.HasNext)
+	assert.Equal(t, []interface{}{"Eve", "Dave"}, names(&domain.PaginationOptions{SortField: "age", Limit: 2, MaxLimit: 10, After: first.NextCursor}))
+
+	_, err = engine.FindAll("users", nil, &domain.PaginationOptions{SortField: "age", Order: domain.OrderInserted})
+	assert.Error(t, err)
+}
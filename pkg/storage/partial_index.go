@@ -0,0 +1,85 @@
+package storage
+
+import (
+	"fmt"
+
+	"github.com/adfharrison1/go-db/pkg/domain"
+)
+
+// CreatePartialIndex creates an index on a field that only holds documents matching
+// condition, e.g. {"status": "active"} to leave archived documents out of the index.
+// Queries use the index only when their filter implies the condition.
+func (se *StorageEngine) CreatePartialIndex(collName, fieldName string, condition map[string]interface{}) error {
+	if err := ValidateIndexCondition(condition); err != nil {
+		return err
+	}
+	condition = CopyDocument(condition)
+
+	return se.withCollectionWriteLock(collName, func() error {
+		collection, err := se.getCollectionInternal(collName)
+		if err != nil {
+			return err
+		}
+		if err := se.indexEngine.CreatePartialIndex(collName, fieldName, condition, PartialIndexMatcher(condition)); err != nil {
+			return err
+		}
+		if err := se.indexEngine.BuildIndexForCollection(collName, fieldName, collection); err != nil {
+			return err
+		}
+		se.persistIndexChange(collName)
+		return nil
+	})
+}
+
+// ValidateIndexCondition checks the condition of a partial index
+func ValidateIndexCondition(condition map[string]interface{}) error {
+	if len(condition) == 0 {
+		return fmt.Errorf("%w: partial index condition must not be empty", domain.ErrInvalidFilter)
+	}
+	return ValidateFilter(condition)
+}
+
+// PartialIndexMatcher returns the membership test for a partial index with the given condition
+func PartialIndexMatcher(condition map[string]interface{}) func(domain.Document) bool {
+	return func(doc domain.Document) bool {
+		return MatchesFilter(doc, condition)
+	}
+}
+
+// FilterImplies reports whether every document matching filter also matches condition,
+// and so whether a partial index with that condition can answer the filter. Each
+// condition field must be constrained by the filter to values the condition accepts
+// (equality or $in on either side); an $expr condition is only implied by the
+// identical expression. A nil condition, as on a full index, is implied by any filter.
+func FilterImplies(filter, condition map[string]interface{}) bool {
+	for field, accepted := range condition {
+		required, exists := filter[field]
+		if !exists {
+			return false
+		}
+
+		if field == ExprFilterKey {
+			requiredExpr, ok1 := required.(string)
+			acceptedExpr, ok2 := accepted.(string)
+			if !ok1 || !ok2 || requiredExpr != acceptedExpr {
+				return false
+			}
+			continue
+		}
+
+		acceptedValues, ok := InFilterValues(accepted)
+		if !ok {
+			acceptedValues = []interface{}{accepted}
+		}
+		requiredValues, ok := InFilterValues(required)
+		if !ok {
+			requiredValues = []interface{}{required}
+		}
+		for _, value := range requiredValues {
+			if !isComparable(value) || !matchesAny(value, acceptedValues) {
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,40 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFilterImplies(t *testing.T) {
+	in := func(values ...interface{}) map[string]interface{} {
+		return map[string]interface{}{InFilterKey: values}
+	}
+
+	tests := []struct {
+		name      string
+		filter    map[string]interface{}
+		condition map[string]interface{}
+		implies   bool
+	}{
+		{"full index", map[string]interface{}{"a": 1}, nil, true},
+		{"same equality", map[string]interface{}{"status": "active", "a": 1}, map[string]interface{}{"status": "active"}, true},
+		{"case-insensitive equality", map[string]interface{}{"status": "Active"}, map[string]interface{}{"status": "active"}, true},
+		{"numeric types", map[string]interface{}{"n": 2.0}, map[string]interface{}{"n": 2}, true},
+		{"different value", map[string]interface{}{"status": "archived"}, map[string]interface{}{"status": "active"}, false},
+		{"field missing", map[string]interface{}{"a": 1}, map[string]interface{}{"status": "active"}, false},
+		{"equality within $in", map[string]interface{}{"status": "pending"}, map[string]interface{}{"status": in("active", "pending")}, true},
+		{"$in subset", map[string]interface{}{"status": in("active")}, map[string]interface{}{"status": in("active", "pending")}, true},
+		{"$in not a subset", map[string]interface{}{"status": in("active", "archived")}, map[string]interface{}{"status": in("active", "pending")}, false},
+		{"$in against equality", map[string]interface{}{"status": in("active", "pending")}, map[string]interface{}{"status": "active"}, false},
+		{"object value", map[string]interface{}{"status": map[string]interface{}{"a": 1}}, map[string]interface{}{"status": "active"}, false},
+		{"same $expr", map[string]interface{}{ExprFilterKey: "age > 1"}, map[string]interface{}{ExprFilterKey: "age > 1"}, true},
+		{"different $expr", map[string]interface{}{ExprFilterKey: "age > 2"}, map[string]interface{}{ExprFilterKey: "age > 1"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.implies, FilterImplies(tt.filter, tt.condition))
+		})
+	}
+}
@@ -223,6 +223,9 @@ func TestMemoryUsageForLargeDatasets(t *testing.T) {
 
 // TestStreamingPerformance measures streaming throughput
 func TestStreamingPerformance(t *testing.T) {
+	if raceEnabled {
+		t.Skip("throughput thresholds do not hold under the race detector")
+	}
 	engine := createIsolatedEngine(t)
 
 	// Create collection and insert large dataset
@@ -349,6 +352,80 @@ func BenchmarkIndexedQueries(b *testing.B) {
 	})
 }
 
+func BenchmarkBulkLoadIndexes(b *testing.B) {
+	indexes := []string{"age", "city"}
+
+	// load inserts the dataset in batches of 1000 and runs one indexed query
+	load := func(b *testing.B, engine *StorageEngine) {
+		batch := make([]domain.Document, 0, 1000)
+		for i := 0; i < LargeDatasetSize; i++ {
+			batch = append(batch, domain.Document{
+				"name": fmt.Sprintf("user%d", i),
+				"age":  i % 100,
+				"city": fmt.Sprintf("city%d", i%50),
+			})
+			if len(batch) == cap(batch) {
+				_, err := engine.BatchInsert("users", batch)
+				require.NoError(b, err)
+				batch = batch[:0]
+			}
+		}
+	}
+	query := func(b *testing.B, engine *StorageEngine) {
+		result, err := engine.FindAll("users", map[string]interface{}{"age": 25, "city": "city25"}, nil)
+		require.NoError(b, err)
+		require.NotEmpty(b, result.Documents)
+	}
+
+	b.Run("DeclaredBeforeLoad", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			engine := NewStorageEngine(WithNoSaves(true))
+			opts := domain.CollectionOptions{}
+			for _, field := range indexes {
+				opts.Indexes = append(opts.Indexes, domain.CollectionIndex{Field: field})
+			}
+			require.NoError(b, engine.CreateCollectionWithOptions("users", opts))
+			load(b, engine)
+			query(b, engine)
+			engine.StopBackgroundWorkers()
+		}
+	})
+
+	b.Run("CreatedAfterLoad", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			engine := NewStorageEngine(WithNoSaves(true))
+			require.NoError(b, engine.CreateCollection("users"))
+			load(b, engine)
+			for _, field := range indexes {
+				require.NoError(b, engine.CreateIndex("users", field))
+			}
+			query(b, engine)
+			engine.StopBackgroundWorkers()
+		}
+	})
+}
+
+func BenchmarkSequentialInserts(b *testing.B) {
+	const inserts = 200
+
+	// run inserts one document at a time in dual-write mode, counting the final flush
+	run := func(b *testing.B, opts ...StorageOption) {
+		for i := 0; i < b.N; i++ {
+			engine := NewStorageEngine(append([]StorageOption{WithDataDir(b.TempDir())}, opts...)...)
+			require.NoError(b, engine.CreateCollection("events"))
+			for n := 0; n < inserts; n++ {
+				_, err := engine.Insert("events", domain.Document{"n": n, "kind": "click"})
+				require.NoError(b, err)
+			}
+			engine.StopBackgroundWorkers()
+		}
+		b.ReportMetric(float64(b.Elapsed().Nanoseconds())/float64(b.N*inserts), "ns/insert")
+	}
+
+	b.Run("Immediate", func(b *testing.B) { run(b) })
+	b.Run("Coalesced5ms", func(b *testing.B) { run(b, WithWriteCoalescing(5*time.Millisecond)) })
+}
+
 func BenchmarkStreaming(b *testing.B) {
 	// Create temporary directory for this benchmark
 	tempDir, err := os.MkdirTemp("", "go-db-benchmark-*")
@@ -4,11 +4,9 @@ import (
 	"bytes"
 	"encoding/binary"
 	"fmt"
-	"io"
 	"log"
 	"os"
 	"path/filepath"
-	"strconv"
 	"time"
 
 	"github.com/adfharrison1/go-db/pkg/domain"
@@ -16,7 +14,10 @@ import (
 	"github.com/vmihailenco/msgpack/v5"
 )
 
-// SaveToFile saves all collections to a single file (for backward compatibility)
+// SaveToFile saves all collections to a single file. Collections that are not
+// currently cached are read from disk so the file always holds every collection.
+// With the per-collection layout, each cached collection's own file is rewritten
+// as well so the two never disagree when the database is loaded again.
 func (se *StorageEngine) SaveToFile(filename string) error {
 	se.mu.RLock()
 	defer se.mu.RUnlock()
@@ -24,13 +25,29 @@ func (se *StorageEngine) SaveToFile(filename string) error {
 	for collName, collection := range se.cache.cache {
 		entry := collection.Value.(*cacheEntry)
 		storageData.Collections[collName] = make(map[string]interface{})
-		for docID, doc := range entry.value.Documents {
+		entry.value.Range(func(docID string, doc domain.Document) bool {
 			storageData.Collections[collName][docID] = map[string]interface{}(doc)
+			return true
+		})
+	}
+	cached := make(map[string]bool, len(storageData.Collections))
+	for collName := range storageData.Collections {
+		cached[collName] = true
+	}
+	for collName := range se.collections {
+		if cached[collName] {
+			continue
 		}
+		docs, err := se.readCollectionDocuments(collName)
+		if err != nil {
+			log.Printf("WARN: Collection %s is not cached and could not be read from disk: %v", collName, err)
+			continue
+		}
+		storageData.Collections[collName] = docs
 	}
 
-	// Export indexes for persistence
-	storageData.Indexes = se.indexEngine.ExportIndexes()
+	// Only the index definitions are stored; indexes are rebuilt when collections load
+	se.setIndexDefinitions(storageData)
 	msgpackData, err := msgpack.Marshal(storageData)
 	if err != nil {
 		return fmt.Errorf("failed to encode MessagePack: %w", err)
@@ -42,230 +59,155 @@ func (se *StorageEngine) SaveToFile(filename string) error {
 		return fmt.Errorf("failed to compress data: %w", err)
 	}
 	compressedData = compressedData[:n]
-	file, err := os.Create(filename)
-	if err != nil {
-		return fmt.Errorf("failed to create file: %w", err)
-	}
-	defer file.Close()
-	if err := WriteHeader(file); err != nil {
+	var buf bytes.Buffer
+	if err := WriteHeader(&buf); err != nil {
 		return fmt.Errorf("failed to write header: %w", err)
 	}
-	if _, err := file.Write(compressedData); err != nil {
-		return fmt.Errorf("failed to write compressed data: %w", err)
+	buf.Write(compressedData)
+	if err := se.writeFileAtomic(filename, buf.Bytes()); err != nil {
+		return fmt.Errorf("failed to create file: %w", err)
+	}
+
+	if se.layout == LayoutPerCollection {
+		for collName := range cached {
+			collData := NewStorageData()
+			collData.Collections[collName] = storageData.Collections[collName]
+			se.setCollectionIndexDefinitions(collData, collName)
+			lock := se.deltaLock(collName)
+			lock.Lock()
+			size, err := se.writeStorageFile(se.collectionFilePath(collName), collData)
+			if err == nil {
+				se.clearDeltaLog(collName)
+			}
+			lock.Unlock()
+			if err != nil {
+				return fmt.Errorf("failed to save collection %s: %w", collName, err)
+			}
+			se.recordDiskWrite(size)
+		}
 	}
 	return nil
 }
 
-// LoadCollectionMetadata loads only collection metadata from disk
+// LoadCollectionMetadata loads only collection metadata from disk.
+// With the single-file layout the file is the data file used for all later loads
+// and saves. With the per-collection layout the file is a snapshot, and any
+// per-collection files in the data directory are registered as well; their
+// contents take precedence when a collection is loaded.
 func (se *StorageEngine) LoadCollectionMetadata(filename string) error {
 	// Store the filename for later use in collection loading
 	se.dataFile = filename
-	file, err := os.Open(filename)
-	if err != nil {
-		if os.IsNotExist(err) {
-			return nil
-		}
-		return fmt.Errorf("failed to open file: %w", err)
-	}
-	defer file.Close()
-	_, err = ReadHeader(file)
-	if err != nil {
-		return fmt.Errorf("invalid file header: %w", err)
-	}
-	compressedData, err := io.ReadAll(file)
-	if err != nil {
-		return fmt.Errorf("failed to read compressed data: %w", err)
-	}
-	decompressedData := make([]byte, len(compressedData)*10)
-	n, err := lz4.UncompressBlock(compressedData, decompressedData)
-	if err != nil {
-		return fmt.Errorf("failed to decompress data: %w", err)
-	}
-	decompressedData = decompressedData[:n]
-	var storageData StorageData
-	if err := msgpack.Unmarshal(decompressedData, &storageData); err != nil {
-		return fmt.Errorf("failed to decode MessagePack: %w", err)
+	storageData, err := readStorageFile(filename)
+	if err != nil && !os.IsNotExist(err) {
+		return err
 	}
+
 	se.mu.Lock()
 	defer se.mu.Unlock()
-	for collName := range storageData.Collections {
-		se.collections[collName] = &CollectionInfo{
-			Name:          collName,
-			DocumentCount: int64(len(storageData.Collections[collName])),
-			State:         CollectionStateUnloaded,
-			LastModified:  time.Now(),
+	if storageData != nil {
+		for collName := range storageData.Collections {
+			se.collections[collName] = &CollectionInfo{
+				Name:          collName,
+				DocumentCount: int64(len(storageData.Collections[collName])),
+				State:         CollectionStateUnloaded,
+				LastModified:  time.Now(),
+			}
 		}
-	}
 
-	// Import indexes if they exist
-	if len(storageData.Indexes) > 0 {
-		se.indexEngine.ImportIndexes(storageData.Indexes)
+		se.importIndexDefinitions(storageData)
 	}
 
+	if se.layout == LayoutPerCollection {
+		return se.registerCollectionFiles()
+	}
 	return nil
 }
 
 // loadCollectionFromSingleFile loads a collection from the single file format
 func (se *StorageEngine) loadCollectionFromSingleFile(collName, filename string) (*domain.Collection, error) {
-	file, err := os.Open(filename)
+	storageData, err := readStorageFile(filename)
 	if err != nil {
 		return nil, err
 	}
-	defer file.Close()
-
-	_, err = ReadHeader(file)
-	if err != nil {
-		return nil, err
-	}
-
-	compressedData, err := io.ReadAll(file)
-	if err != nil {
-		return nil, err
-	}
-
-	decompressedData := make([]byte, len(compressedData)*10)
-	n, err := lz4.UncompressBlock(compressedData, decompressedData)
-	if err != nil {
-		return nil, err
-	}
-	decompressedData = decompressedData[:n]
-
-	var storageData StorageData
-	if err := msgpack.Unmarshal(decompressedData, &storageData); err != nil {
-		return nil, err
-	}
 
 	docs, exists := storageData.Collections[collName]
 	if !exists {
 		return nil, fmt.Errorf("collection %s not found in file", collName)
 	}
 
-	collection := domain.NewCollection(collName)
-	for docID, docData := range docs {
-		doc := domain.Document{}
-		for key, value := range docData.(map[string]interface{}) {
-			doc[key] = value
-		}
-		collection.Documents[docID] = doc
-	}
-
-	// Rebuild indexes for this collection after loading
-	se.indexEngine.RebuildIndexForCollection(collName, collection)
-
-	return collection, nil
+	return se.newLoadedCollection(collName, docs), nil
 }
 
-// loadCollectionFromDisk loads a single collection from disk
+// loadCollectionFromDisk loads a single collection from its per-collection file,
+// applying any updates recorded in its delta log
 func (se *StorageEngine) loadCollectionFromDisk(collName string) (*domain.Collection, error) {
-	filename := fmt.Sprintf("%s/collections/%s.godb", se.dataDir, collName)
-	file, err := os.Open(filename)
-	if err != nil {
-		return nil, err
-	}
-	defer file.Close()
-	_, err = ReadHeader(file)
-	if err != nil {
-		return nil, err
-	}
-	compressedData, err := io.ReadAll(file)
-	if err != nil {
-		return nil, err
-	}
-	decompressedData := make([]byte, len(compressedData)*10)
-	n, err := lz4.UncompressBlock(compressedData, decompressedData)
+	lock := se.deltaLock(collName)
+	lock.Lock()
+	defer lock.Unlock()
+
+	storageData, err := readStorageFile(se.collectionFilePath(collName))
 	if err != nil {
 		return nil, err
 	}
-	decompressedData = decompressedData[:n]
-	var storageData StorageData
-	if err := msgpack.Unmarshal(decompressedData, &storageData); err != nil {
-		return nil, err
-	}
 	docs, exists := storageData.Collections[collName]
 	if !exists {
 		return nil, fmt.Errorf("collection %s not found in file", collName)
 	}
-	collection := domain.NewCollection(collName)
-
-	// Track the highest numeric ID to restore the counter properly
-	maxID := int64(0)
-
-	for docID, docData := range docs {
-		if doc, ok := docData.(map[string]interface{}); ok {
-			collection.Documents[docID] = domain.Document(doc)
-
-			// Try to parse the document ID as a number to find the highest one
-			if id, err := strconv.ParseInt(docID, 10, 64); err == nil {
-				if id > maxID {
-					maxID = id
-				}
-			}
-		}
+	if err := se.loadDeltas(collName, docs); err != nil {
+		return nil, err
 	}
 
-	// Restore the ID counter for this collection to the highest existing ID
-	// This ensures new documents get unique IDs that don't conflict with existing ones
-	se.idCountersMu.Lock()
-	se.idCounters[collName] = &maxID
-	se.idCountersMu.Unlock()
-
-	log.Printf("INFO: Loaded collection '%s' with %d documents, restored ID counter to %d",
-		collName, len(collection.Documents), maxID)
+	return se.newLoadedCollection(collName, docs), nil
+}
 
-	return collection, nil
+// CheckpointNow saves every dirty collection to disk, even in no-saves mode, and
+// returns an error if any could not be saved. It is a checkpoint, not a mode change:
+// saved collections are clean until their next write marks them dirty again, and
+// no-saves mode still skips saves on writes afterwards.
+func (se *StorageEngine) CheckpointNow() error {
+	return se.saveDirtyCollections()
 }
 
-// saveDirtyCollections saves all dirty collections to individual files
-func (se *StorageEngine) saveDirtyCollections() {
+// saveDirtyCollections saves all dirty collections according to the storage layout,
+// at most the save concurrency at once, and returns an error if any could not be saved
+func (se *StorageEngine) saveDirtyCollections() error {
 	start := time.Now()
-	savedCount := 0
-	errorCount := 0
 
 	// Get list of dirty collections (read-only operation)
-	se.mu.RLock()
-	var dirtyCollections []string
-	for collName, info := range se.collections {
-		if info.State == CollectionStateDirty {
-			dirtyCollections = append(dirtyCollections, collName)
-		}
-	}
-	se.mu.RUnlock()
+	dirtyCollections := se.dirtyCollectionsOldestFirst()
 
 	if len(dirtyCollections) == 0 {
 		log.Printf("DEBUG: No dirty collections to save")
-		return
+		return nil
 	}
 
 	log.Printf("INFO: Background save starting - %d dirty collections to save", len(dirtyCollections))
 
 	// Ensure collections directory exists
-	collectionsDir := filepath.Join(se.dataDir, "collections")
-	if err := os.MkdirAll(collectionsDir, 0755); err != nil {
-		log.Printf("ERROR: Failed to create collections directory: %v", err)
-		return
-	}
-
-	// Save each dirty collection
-	for _, collName := range dirtyCollections {
-		if err := se.saveCollectionToFile(collName); err != nil {
-			log.Printf("ERROR: Failed to save collection %s: %v", collName, err)
-			errorCount++
-		} else {
-			savedCount++
+	if se.layout == LayoutPerCollection {
+		collectionsDir := filepath.Join(se.dataDir, "collections")
+		if err := os.MkdirAll(collectionsDir, 0755); err != nil {
+			log.Printf("ERROR: Failed to create collections directory: %v", err)
+			return fmt.Errorf("failed to create collections directory: %w", err)
 		}
 	}
 
+	// Save the dirty collections, a few at a time and longest dirty first
+	savedCount, errorCount := se.saveCollections(dirtyCollections)
+
 	elapsed := time.Since(start)
 	if errorCount > 0 {
 		log.Printf("WARN: Background save completed with errors - saved: %d, errors: %d, time: %v",
 			savedCount, errorCount, elapsed)
-	} else {
-		log.Printf("INFO: Background save completed successfully - saved: %d collections in %v",
-			savedCount, elapsed)
+		return fmt.Errorf("failed to save %d of %d dirty collections", errorCount, len(dirtyCollections))
 	}
+	log.Printf("INFO: Background save completed successfully - saved: %d collections in %v",
+		savedCount, elapsed)
+	return nil
 }
 
-// saveCollectionToFile saves a single collection to its individual file
+// saveCollectionToFile saves a single collection to its individual file, or to its
+// slice of the data file with the single-file layout
 func (se *StorageEngine) saveCollectionToFile(collName string) error {
 	// Use write lock for this collection to prevent modifications during save
 	return se.withCollectionWriteLock(collName, func() error {
@@ -287,13 +229,16 @@ func (se *StorageEngine) saveCollectionToFileUnsafe(collName string) error {
 	}
 
 	// Check if still dirty (might have been saved by another goroutine)
-	if collectionInfo.State != CollectionStateDirty {
+	if collectionInfo.currentState() != CollectionStateDirty {
 		return nil // Already saved, skip
 	}
+	// Changes marked after this may be missing from the snapshot
+	gen := collectionInfo.dirtyGeneration()
 
 	// Prepare storage data
 	storageData := NewStorageData()
 	storageData.Collections[collName] = make(map[string]interface{})
+	se.setCollectionIndexDefinitions(storageData, collName)
 
 	// Take a safe snapshot of the documents map
 	// The collection write lock we're already holding should protect against structural changes
@@ -302,19 +247,41 @@ func (se *StorageEngine) saveCollectionToFileUnsafe(collName string) error {
 
 	// Since we're holding a collection write lock, no new documents should be added/removed
 	// But individual documents might still be modified - we'll take a safe snapshot
-	for docID, doc := range cachedCollection.Documents {
+	cachedCollection.Range(func(docID string, doc domain.Document) bool {
+		// Updates change a document in place holding only its lock
+		if lock := se.existingDocumentLock(collName, docID); lock != nil {
+			lock.RLock()
+			defer lock.RUnlock()
+		}
 		// Create a deep copy of each document to avoid races on document content
 		docCopy := make(domain.Document)
 		for k, v := range doc {
 			docCopy[k] = v
 		}
 		documentsCopy[docID] = docCopy
-	}
+		return true
+	})
 
 	for docID, doc := range documentsCopy {
 		storageData.Collections[collName][docID] = map[string]interface{}(doc)
 	}
 
+	if se.layout == LayoutSingleFile {
+		size, err := se.writeCollectionToSingleFile(collName, storageData.Collections[collName])
+		if err != nil {
+			return err
+		}
+		se.recordDiskWrite(size)
+		se.mu.Lock()
+		if info, exists := se.collections[collName]; exists {
+			info.markSaved(gen) // Mark as clean
+			info.SizeOnDisk = size
+		}
+		se.mu.Unlock()
+		log.Printf("DEBUG: Saved collection %s to %s (%d bytes compressed)", collName, se.singleFilePath(), size)
+		return nil
+	}
+
 	// Serialize and compress
 	msgpackData, err := msgpack.Marshal(storageData)
 	if err != nil {
@@ -335,27 +302,33 @@ func (se *StorageEngine) saveCollectionToFileUnsafe(collName string) error {
 		return fmt.Errorf("failed to create collections directory: %w", err)
 	}
 
+	// The rewritten file holds every update, so the delta log is cleared with it
+	deltaLock := se.deltaLock(collName)
+	deltaLock.Lock()
+	defer deltaLock.Unlock()
+	// and buffered document saves are written with it
+	se.discardWriteBatch(collName)
+
 	// Write to file
 	filename := filepath.Join(collectionsDir, collName+".godb")
-	file, err := os.Create(filename)
-	if err != nil {
-		return fmt.Errorf("failed to create file: %w", err)
-	}
-	defer file.Close()
-
-	if err := WriteHeader(file); err != nil {
+	var buf bytes.Buffer
+	if err := WriteHeader(&buf); err != nil {
 		return fmt.Errorf("failed to write header: %w", err)
 	}
-
-	if _, err := file.Write(compressedData); err != nil {
-		return fmt.Errorf("failed to write compressed data: %w", err)
+	buf.Write(compressedData)
+	if err := se.writeFileAtomic(filename, buf.Bytes()); err != nil {
+		return fmt.Errorf("failed to write collection file: %w", err)
 	}
+	se.clearDeltaLog(collName)
+	se.recordDiskWrite(int64(len(compressedData)))
 
 	// Update collection state to clean (already holding collection write lock)
+	se.mu.Lock()
 	if info, exists := se.collections[collName]; exists {
-		info.State = CollectionStateLoaded // Mark as clean
+		info.markSaved(gen) // Mark as clean
 		info.SizeOnDisk = int64(len(compressedData))
 	}
+	se.mu.Unlock()
 
 	log.Printf("DEBUG: Saved collection %s (%d bytes compressed)", collName, len(compressedData))
 	return nil
@@ -363,21 +336,53 @@ func (se *StorageEngine) saveCollectionToFileUnsafe(collName string) error {
 
 // saveDocumentToDisk saves a single document to disk immediately
 func (se *StorageEngine) saveDocumentToDisk(collection, docID string, doc domain.Document) error {
-	// Ensure collection directory exists
-	collectionsDir := filepath.Join(se.dataDir, "collections")
-	if err := os.MkdirAll(collectionsDir, 0755); err != nil {
-		return fmt.Errorf("failed to create collections directory: %w", err)
-	}
-
 	// Get the collection to check if it exists
 	se.mu.RLock()
 	_, exists := se.collections[collection]
 	if !exists {
 		se.mu.RUnlock()
-		return fmt.Errorf("collection %s does not exist", collection)
+		return domain.Errorf(domain.ErrCollectionNotFound, "collection %s does not exist", collection)
 	}
 	se.mu.RUnlock()
 
+	if se.layout == LayoutSingleFile {
+		gen := se.dirtyGeneration(collection)
+		size, err := se.saveDocumentToSingleFile(collection, docID, doc)
+		if err != nil {
+			return err
+		}
+		se.recordDiskWrite(size)
+		se.mu.Lock()
+		if info, exists := se.collections[collection]; exists {
+			info.markSaved(gen)
+			info.SizeOnDisk = size
+		}
+		se.mu.Unlock()
+		return nil
+	}
+
+	// Serialize with delta log appends and compaction of this collection
+	deltaLock := se.deltaLock(collection)
+	deltaLock.Lock()
+	defer deltaLock.Unlock()
+	if err := se.requireCollection(collection); err != nil {
+		return err
+	}
+
+	return se.saveDocumentsToDiskLocked(collection, map[string]domain.Document{docID: doc})
+}
+
+// saveDocumentsToDiskLocked writes documents into their collection's file in one
+// rewrite with the per-collection layout (caller must hold the collection's delta lock)
+func (se *StorageEngine) saveDocumentsToDiskLocked(collection string, docs map[string]domain.Document) error {
+	gen := se.dirtyGeneration(collection)
+
+	// Ensure collection directory exists
+	collectionsDir := filepath.Join(se.dataDir, "collections")
+	if err := os.MkdirAll(collectionsDir, 0755); err != nil {
+		return fmt.Errorf("failed to create collections directory: %w", err)
+	}
+
 	// Load existing collection data from disk
 	collectionFile := filepath.Join(collectionsDir, collection+".godb")
 	existingData := make(map[string]interface{})
@@ -390,12 +395,22 @@ func (se *StorageEngine) saveDocumentToDisk(collection, docID string, doc domain
 		}
 	}
 
-	// Add/update the document in the existing data
-	existingData[docID] = map[string]interface{}(doc)
+	// Fold pending deltas into the rewritten file so clearing the log loses nothing
+	records, err := se.readDeltaLog(collection)
+	if err != nil {
+		return err
+	}
+	applyDeltas(existingData, records)
+
+	// Add/update the documents in the existing data
+	for docID, doc := range docs {
+		existingData[docID] = map[string]interface{}(doc)
+	}
 
 	// Create storage data structure
 	storageData := NewStorageData()
 	storageData.Collections[collection] = existingData
+	se.setCollectionIndexDefinitions(storageData, collection)
 
 	// collectionFile is already defined above
 
@@ -432,20 +447,16 @@ func (se *StorageEngine) saveDocumentToDisk(collection, docID string, doc domain
 	}
 
 	// Write to temporary file first, then rename (atomic operation)
-	tempFile := collectionFile + ".tmp"
-	if err := os.WriteFile(tempFile, buf.Bytes(), 0644); err != nil {
+	if err := se.writeFileAtomic(collectionFile, buf.Bytes()); err != nil {
 		return fmt.Errorf("failed to write collection file: %w", err)
 	}
-
-	if err := os.Rename(tempFile, collectionFile); err != nil {
-		os.Remove(tempFile) // Clean up temp file
-		return fmt.Errorf("failed to rename collection file: %w", err)
-	}
+	se.clearDeltaLog(collection)
+	se.recordDiskWrite(int64(buf.Len()))
 
 	// Update collection metadata
 	se.mu.Lock()
 	if info, exists := se.collections[collection]; exists {
-		info.State = CollectionStateLoaded
+		info.markSaved(gen)
 		info.SizeOnDisk = int64(len(compressedData))
 	}
 	se.mu.Unlock()
@@ -453,6 +464,18 @@ func (se *StorageEngine) saveDocumentToDisk(collection, docID string, doc domain
 	return nil
 }
 
+// dirtyGeneration returns the dirty generation of a collection, or 0 if it does not
+// exist. A save that rewrites only some documents reads it first and marks the
+// collection clean only if no change was marked while it ran.
+func (se *StorageEngine) dirtyGeneration(collName string) uint64 {
+	se.mu.RLock()
+	defer se.mu.RUnlock()
+	if info, exists := se.collections[collName]; exists {
+		return info.dirtyGeneration()
+	}
+	return 0
+}
+
 // loadCollectionFromFile loads collection data from a file
 func (se *StorageEngine) loadCollectionFromFile(filename string, target map[string]interface{}) error {
 	data, err := os.ReadFile(filename)
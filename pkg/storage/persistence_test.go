@@ -244,10 +244,11 @@ func TestStorageEngine_LoadCollectionFromDisk(t *testing.T) {
 	err = engine1.SaveToFile(tempFile)
 	require.NoError(t, err)
 
-	// Test loading collection from disk - should fail because SaveToFile creates a monolithic file
-	// but loadCollectionFromDisk expects per-collection files in tempDir/collections/users.godb
-	_, err = engine1.loadCollectionFromDisk("users")
-	assert.Error(t, err, "loadCollectionFromDisk should fail when trying to load from collections/users.godb after SaveToFile creates a monolithic file")
+	// With the per-collection layout SaveToFile also writes tempDir/collections/users.godb,
+	// so the collection loads the same way it was saved
+	collection, err := engine1.loadCollectionFromDisk("users")
+	require.NoError(t, err)
+	assert.Len(t, collection.Documents, 2)
 }
 
 func TestStorageEngine_SaveToFile_ConcurrentAccess(t *testing.T) {
@@ -955,3 +956,59 @@ func TestStorageEngine_IDCounterRestoration_BatchOperations(t *testing.T) {
 		assert.Equal(t, fmt.Sprintf("Batch Doc %d", i), doc["name"])
 	}
 }
+
+func TestStorageEngine_CheckpointNow(t *testing.T) {
+	tempDir := t.TempDir()
+	engine := NewStorageEngine(WithDataDir(tempDir), WithNoSaves(true))
+	defer engine.StopBackgroundWorkers()
+
+	for i := 1; i <= 3; i++ {
+		_, err := engine.Insert("events", domain.Document{"seq": i})
+		require.NoError(t, err)
+	}
+	fileName := filepath.Join(tempDir, "collections", "events.godb")
+	assert.NoFileExists(t, fileName, "no-saves mode does not write on insert")
+
+	require.NoError(t, engine.CheckpointNow())
+	assert.FileExists(t, fileName)
+	engine.mu.RLock()
+	assert.Equal(t, CollectionStateLoaded, engine.collections["events"].State)
+	engine.mu.RUnlock()
+
+	// The engine stays in no-saves mode and tracks later writes as dirty again
+	assert.True(t, engine.IsNoSavesEnabled())
+	_, err := engine.Insert("events", domain.Document{"seq": 4})
+	require.NoError(t, err)
+	engine.mu.RLock()
+	assert.Equal(t, CollectionStateDirty, engine.collections["events"].State)
+	engine.mu.RUnlock()
+
+	// The checkpoint holds the documents written before it
+	reloaded := NewStorageEngine(WithDataDir(tempDir), WithNoSaves(true))
+	defer reloaded.StopBackgroundWorkers()
+	reloaded.mu.Lock()
+	reloaded.collections["events"] = &CollectionInfo{Name: "events", State: CollectionStateUnloaded}
+	reloaded.mu.Unlock()
+	collection, err := reloaded.GetCollection("events")
+	require.NoError(t, err)
+	assert.Len(t, collection.Documents, 3)
+
+	// Nothing dirty is a no-op
+	require.NoError(t, reloaded.CheckpointNow())
+}
+
+func TestStorageEngine_AppliedOffset(t *testing.T) {
+	engine := NewStorageEngine(WithDataDir(t.TempDir()), WithNoSaves(true))
+	defer engine.StopBackgroundWorkers()
+
+	_, err := engine.Insert("events", domain.Document{"seq": 1})
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), engine.AppliedOffset(), "unsaved writes do not move the offset")
+
+	require.NoError(t, engine.CheckpointNow())
+	assert.Equal(t, int64(1), engine.AppliedOffset())
+
+	// A checkpoint with nothing dirty saves nothing
+	require.NoError(t, engine.CheckpointNow())
+	assert.Equal(t, int64(1), engine.AppliedOffset())
+}
@@ -0,0 +1,177 @@
+package storage
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"os"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/adfharrison1/go-db/pkg/domain"
+)
+
+// Preloader loads a fixed list of collections once at startup, several at a time,
+// and tracks its progress so readiness checks can wait for it. A nil preloader has
+// nothing to load and is always done.
+type Preloader struct {
+	collections []string
+	once        sync.Once
+	err         error
+
+	mu       sync.Mutex
+	progress domain.PreloadProgress
+}
+
+// NewPreloader creates a preloader for the named collections, ignoring blanks and
+// duplicates, or returns nil if there are none
+func NewPreloader(collections []string) *Preloader {
+	seen := make(map[string]bool, len(collections))
+	var names []string
+	for _, name := range collections {
+		name = strings.TrimSpace(name)
+		if name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+		names = append(names, name)
+	}
+	if len(names) == 0 {
+		return nil
+	}
+	return &Preloader{
+		collections: names,
+		progress:    domain.PreloadProgress{Total: len(names)},
+	}
+}
+
+// Run calls load for every collection, up to GOMAXPROCS at a time, and returns once
+// all have been attempted. Only the first call loads; later calls wait for it and
+// return its result. The error names every collection that failed to load.
+func (p *Preloader) Run(load func(collName string) error) error {
+	if p == nil {
+		return nil
+	}
+	p.once.Do(func() { p.err = p.run(load) })
+	return p.err
+}
+
+// run loads the collections in parallel, recording each outcome
+func (p *Preloader) run(load func(collName string) error) error {
+	start := time.Now()
+	workers := runtime.GOMAXPROCS(0)
+	if workers > len(p.collections) {
+		workers = len(p.collections)
+	}
+
+	names := make(chan string)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for name := range names {
+				p.record(name, load(name))
+			}
+		}()
+	}
+	for _, name := range p.collections {
+		names <- name
+	}
+	close(names)
+	wg.Wait()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.progress.Done = true
+	log.Printf("INFO: Preloaded %d of %d collections in %s", p.progress.Loaded, p.progress.Total, time.Since(start))
+
+	if p.progress.Failed == 0 {
+		return nil
+	}
+	failed := make([]string, 0, len(p.progress.Errors))
+	for name := range p.progress.Errors {
+		failed = append(failed, name)
+	}
+	sort.Strings(failed)
+	return fmt.Errorf("failed to preload collections: %s", strings.Join(failed, ", "))
+}
+
+// record counts one collection's outcome
+func (p *Preloader) record(collName string, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if err != nil {
+		log.Printf("WARN: Failed to preload collection '%s': %v", collName, err)
+		if p.progress.Errors == nil {
+			p.progress.Errors = make(map[string]string)
+		}
+		p.progress.Errors[collName] = err.Error()
+		p.progress.Failed++
+		return
+	}
+	p.progress.Loaded++
+}
+
+// Progress returns a copy of the preload's progress
+func (p *Preloader) Progress() domain.PreloadProgress {
+	if p == nil {
+		return domain.PreloadProgress{Done: true}
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	progress := p.progress
+	if p.progress.Errors != nil {
+		progress.Errors = make(map[string]string, len(p.progress.Errors))
+		for name, msg := range p.progress.Errors {
+			progress.Errors[name] = msg
+		}
+	}
+	return progress
+}
+
+// ReadPreloadManifest reads the collection names listed in a preload manifest: one
+// name per line, with blank lines and lines starting with # ignored
+func ReadPreloadManifest(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open preload manifest: %w", err)
+	}
+	defer file.Close()
+
+	var names []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		names = append(names, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read preload manifest: %w", err)
+	}
+	return names, nil
+}
+
+// PreloadCollections loads the collections given to WithPreloadCollections from disk
+// into the cache, rebuilding their indexes, several at a time. Collections already
+// in the cache are left as they are. Call it after LoadCollectionMetadata.
+func (se *StorageEngine) PreloadCollections() error {
+	return se.preloader.Run(func(collName string) error {
+		return se.withCollectionWriteLock(collName, func() error {
+			_, err := se.getCollectionInternal(collName)
+			return err
+		})
+	})
+}
+
+// PreloadProgress reports how far PreloadCollections has got
+func (se *StorageEngine) PreloadProgress() domain.PreloadProgress {
+	return se.preloader.Progress()
+}
@@ -0,0 +1,98 @@
+package storage
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"github.com/adfharrison1/go-db/pkg/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPreloader(t *testing.T) {
+	var nilPreloader *Preloader
+	assert.Nil(t, NewPreloader([]string{" ", ""}))
+	assert.NoError(t, nilPreloader.Run(func(string) error { return errors.New("not called") }))
+	assert.True(t, nilPreloader.Progress().Done, "nothing to preload is always done")
+
+	preloader := NewPreloader([]string{"users", " orders ", "users", "broken"})
+	assert.Equal(t, domain.PreloadProgress{Total: 3}, preloader.Progress())
+
+	var calls int64
+	load := func(collName string) error {
+		atomic.AddInt64(&calls, 1)
+		if collName == "broken" {
+			return errors.New("corrupt file")
+		}
+		return nil
+	}
+	err := preloader.Run(load)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "broken")
+
+	progress := preloader.Progress()
+	assert.True(t, progress.Done)
+	assert.Equal(t, 2, progress.Loaded)
+	assert.Equal(t, 1, progress.Failed)
+	assert.Equal(t, map[string]string{"broken": "corrupt file"}, progress.Errors)
+
+	// Later runs return the first result without loading again
+	assert.Equal(t, err, preloader.Run(load))
+	assert.Equal(t, int64(3), atomic.LoadInt64(&calls))
+}
+
+func TestReadPreloadManifest(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "preload.txt")
+	require.NoError(t, os.WriteFile(path, []byte("# hot collections\nusers\n\n  orders  \n"), 0644))
+
+	names, err := ReadPreloadManifest(path)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"users", "orders"}, names)
+
+	_, err = ReadPreloadManifest(filepath.Join(t.TempDir(), "missing.txt"))
+	assert.Error(t, err)
+}
+
+func TestStorageEngine_PreloadCollections(t *testing.T) {
+	tempDir := t.TempDir()
+	dataFile := filepath.Join(tempDir, DefaultDataFileName)
+
+	engine := NewStorageEngine(WithDataDir(tempDir), WithStorageLayout(LayoutSingleFile))
+	defer engine.StopBackgroundWorkers()
+	for _, name := range []string{"users", "orders", "cold"} {
+		_, err := engine.Insert(name, domain.Document{"city": "Paris"})
+		require.NoError(t, err)
+	}
+	require.NoError(t, engine.CreateIndex("users", "city"))
+	require.NoError(t, engine.SaveToFile(dataFile))
+
+	reloaded := NewStorageEngine(WithDataDir(tempDir), WithStorageLayout(LayoutSingleFile),
+		WithPreloadCollections([]string{"users", "orders", "missing"}))
+	defer reloaded.StopBackgroundWorkers()
+	require.NoError(t, reloaded.LoadCollectionMetadata(dataFile))
+	assert.False(t, reloaded.PreloadProgress().Done)
+
+	err := reloaded.PreloadCollections()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "missing")
+
+	progress := reloaded.PreloadProgress()
+	assert.True(t, progress.Done)
+	assert.Equal(t, 2, progress.Loaded)
+	assert.Equal(t, 1, progress.Failed)
+
+	// Listed collections are cached with their indexes rebuilt; others stay on disk
+	_, cached := reloaded.cache.Peek("users")
+	assert.True(t, cached)
+	_, cached = reloaded.cache.Peek("orders")
+	assert.True(t, cached)
+	_, cached = reloaded.cache.Peek("cold")
+	assert.False(t, cached)
+
+	index, exists := reloaded.getIndex("users", "city")
+	require.True(t, exists)
+	assert.Equal(t, []string{"1"}, index.Query("Paris"))
+}
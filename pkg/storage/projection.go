@@ -0,0 +1,268 @@
+package storage
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/adfharrison1/go-db/pkg/domain"
+)
+
+// projectionOperators maps projection operators to expression operators
+var projectionOperators = map[string]string{
+	"$add":      "+",
+	"$subtract": "-",
+	"$multiply": "*",
+	"$divide":   "/",
+	"$mod":      "%",
+}
+
+// Projection is a compiled projection spec that reshapes result documents.
+//
+// Each key in the spec names an output field and its value decides what is written:
+//
+//	{"name": 1}                               include the field as is
+//	{"secret": 0}                             exclude the field
+//	{"fullName": "$name"}                     rename (reference another field)
+//	{"ageNextYear": {"$add": ["$age", 1]}}    computed with $add, $subtract, $multiply, $divide or $mod
+//	{"total": {"$expr": "price * quantity"}}  computed with an expression
+//
+// Include, rename and computed fields cannot be mixed with exclusions, apart
+// from "_id": 0. The _id field is kept unless explicitly excluded.
+type Projection struct {
+	fields  []projectedField
+	exclude map[string]bool
+	keepID  bool
+}
+
+// projectedField is one output field of an inclusion projection
+type projectedField struct {
+	name string
+	ref  []string // Field path for includes and renames
+	node exprNode // Expression for computed fields
+}
+
+// ParseProjection compiles a projection spec. A nil or empty spec returns a nil Projection.
+func ParseProjection(spec map[string]interface{}) (*Projection, error) {
+	if len(spec) == 0 {
+		return nil, nil
+	}
+
+	p := &Projection{exclude: make(map[string]bool), keepID: true}
+
+	// Sort keys so output field order and error messages are deterministic
+	names := make([]string, 0, len(spec))
+	for name := range spec {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if name == "" {
+			return nil, fmt.Errorf("projection field name cannot be empty")
+		}
+
+		value := spec[name]
+		if include, ok := projectionFlag(value); ok {
+			switch {
+			case name == "_id":
+				p.keepID = include
+			case include:
+				p.fields = append(p.fields, projectedField{name: name, ref: strings.Split(name, ".")})
+			default:
+				p.exclude[name] = true
+			}
+			continue
+		}
+
+		if ref, ok := value.(string); ok && strings.HasPrefix(ref, "$") {
+			path := strings.TrimPrefix(ref, "$")
+			if path == "" {
+				return nil, fmt.Errorf("projection field '%s': empty field reference", name)
+			}
+			p.fields = append(p.fields, projectedField{name: name, ref: strings.Split(path, ".")})
+			continue
+		}
+
+		node, err := projectionNode(value)
+		if err != nil {
+			return nil, fmt.Errorf("projection field '%s': %w", name, err)
+		}
+		if _, err := node.check(); err != nil {
+			return nil, fmt.Errorf("projection field '%s': %w", name, err)
+		}
+		p.fields = append(p.fields, projectedField{name: name, node: node})
+	}
+
+	if len(p.fields) > 0 && len(p.exclude) > 0 {
+		return nil, fmt.Errorf("projection cannot mix exclusions with included or computed fields (except _id)")
+	}
+
+	return p, nil
+}
+
+// Apply returns the projected form of a document. The input document is not modified.
+// A computed field that fails to evaluate (e.g. arithmetic on a missing field) is set to null,
+// and an included or renamed field that does not exist is omitted.
+func (p *Projection) Apply(doc domain.Document) domain.Document {
+	if p == nil {
+		return doc
+	}
+
+	result := make(domain.Document)
+
+	// Exclusion projection: copy everything except the excluded fields
+	if len(p.fields) == 0 {
+		for key, value := range doc {
+			if p.exclude[key] || (key == "_id" && !p.keepID) {
+				continue
+			}
+			result[key] = value
+		}
+		return result
+	}
+
+	if p.keepID {
+		if id, exists := doc["_id"]; exists {
+			result["_id"] = id
+		}
+	}
+
+	for _, field := range p.fields {
+		if field.node == nil {
+			if value, exists := lookupFieldPath(doc, field.ref); exists {
+				result[field.name] = value
+			}
+			continue
+		}
+
+		value, err := field.node.eval(doc)
+		if err != nil {
+			value = nil
+		}
+		result[field.name] = value
+	}
+
+	return result
+}
+
+// ApplyAll projects every document in a slice
+func (p *Projection) ApplyAll(docs []domain.Document) []domain.Document {
+	if p == nil {
+		return docs
+	}
+	projected := make([]domain.Document, len(docs))
+	for i, doc := range docs {
+		projected[i] = p.Apply(doc)
+	}
+	return projected
+}
+
+// projectionFlag reports whether a spec value is an include/exclude flag (1, 0, true or false)
+func projectionFlag(value interface{}) (include bool, ok bool) {
+	if b, isBool := value.(bool); isBool {
+		return b, true
+	}
+	if num, isNum := ToFloat64(value); isNum {
+		if num == 0 || num == 1 {
+			return num == 1, true
+		}
+	}
+	return false, false
+}
+
+// projectionNode builds an expression node from a projection value: a "$field"
+// reference, a literal, an {"$expr": "..."} expression or an arithmetic operator
+func projectionNode(value interface{}) (exprNode, error) {
+	switch v := value.(type) {
+	case nil, bool:
+		return &literalNode{value: v}, nil
+	case string:
+		if strings.HasPrefix(v, "$") {
+			path := strings.TrimPrefix(v, "$")
+			if path == "" {
+				return nil, fmt.Errorf("empty field reference")
+			}
+			return &fieldNode{path: strings.Split(path, ".")}, nil
+		}
+		return &literalNode{value: v}, nil
+	case map[string]interface{}:
+		return projectionOperatorNode(v)
+	}
+
+	if num, ok := ToFloat64(value); ok {
+		return &literalNode{value: num}, nil
+	}
+	return nil, fmt.Errorf("unsupported projection value of type %T", value)
+}
+
+// projectionOperatorNode builds an expression node from a single-key operator object
+func projectionOperatorNode(spec map[string]interface{}) (exprNode, error) {
+	if len(spec) != 1 {
+		return nil, fmt.Errorf("operator object must have exactly one key, got %d", len(spec))
+	}
+
+	for op, args := range spec {
+		if op == ExprFilterKey {
+			source, ok := args.(string)
+			if !ok {
+				return nil, fmt.Errorf("%s value must be a string", ExprFilterKey)
+			}
+			node, _, err := parseExprNode(source)
+			return node, err
+		}
+
+		exprOp, ok := projectionOperators[op]
+		if !ok {
+			return nil, fmt.Errorf("unknown operator '%s'", op)
+		}
+
+		operands, ok := args.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("%s expects an array of operands", op)
+		}
+		if len(operands) < 2 {
+			return nil, fmt.Errorf("%s expects at least 2 operands, got %d", op, len(operands))
+		}
+		if exprOp != "+" && exprOp != "*" && len(operands) != 2 {
+			return nil, fmt.Errorf("%s expects exactly 2 operands, got %d", op, len(operands))
+		}
+
+		node, err := projectionNode(operands[0])
+		if err != nil {
+			return nil, err
+		}
+		for _, operand := range operands[1:] {
+			right, err := projectionNode(operand)
+			if err != nil {
+				return nil, err
+			}
+			node = &binaryNode{op: exprOp, left: node, right: right}
+		}
+		return node, nil
+	}
+
+	return nil, fmt.Errorf("empty operator object")
+}
+
+// lookupFieldPath resolves a dotted field path, reporting whether it exists
+func lookupFieldPath(doc domain.Document, path []string) (interface{}, bool) {
+	var current interface{} = map[string]interface{}(doc)
+	for _, part := range path {
+		var m map[string]interface{}
+		switch v := current.(type) {
+		case map[string]interface{}:
+			m = v
+		case domain.Document:
+			m = v
+		default:
+			return nil, false
+		}
+		value, exists := m[part]
+		if !exists {
+			return nil, false
+		}
+		current = value
+	}
+	return current, true
+}
@@ -0,0 +1,123 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/adfharrison1/go-db/pkg/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseProjection_Computed(t *testing.T) {
+	projection, err := ParseProjection(map[string]interface{}{
+		"fullName":    "$name",
+		"ageNextYear": map[string]interface{}{"$add": []interface{}{"$age", 1}},
+		"city":        "$address.city",
+		"total":       map[string]interface{}{"$expr": "price * quantity"},
+		"email":       1,
+	})
+	require.NoError(t, err)
+
+	doc := domain.Document{
+		"_id":      "1",
+		"name":     "Alice",
+		"age":      30,
+		"email":    "alice@example.com",
+		"address":  map[string]interface{}{"city": "Boston"},
+		"price":    2.5,
+		"quantity": 4,
+		"secret":   "hidden",
+	}
+
+	result := projection.Apply(doc)
+	assert.Equal(t, domain.Document{
+		"_id":         "1",
+		"fullName":    "Alice",
+		"ageNextYear": float64(31),
+		"city":        "Boston",
+		"total":       float64(10),
+		"email":       "alice@example.com",
+	}, result)
+
+	// The source document is left untouched
+	assert.Equal(t, "hidden", doc["secret"])
+}
+
+func TestParseProjection_MissingFields(t *testing.T) {
+	projection, err := ParseProjection(map[string]interface{}{
+		"fullName":    "$name",
+		"ageNextYear": map[string]interface{}{"$add": []interface{}{"$age", 1}},
+	})
+	require.NoError(t, err)
+
+	result := projection.Apply(domain.Document{"_id": "1"})
+	_, hasName := result["fullName"]
+	assert.False(t, hasName, "missing references are omitted")
+	assert.Contains(t, result, "ageNextYear")
+	assert.Nil(t, result["ageNextYear"], "computed fields that fail to evaluate are null")
+}
+
+func TestParseProjection_Exclusion(t *testing.T) {
+	projection, err := ParseProjection(map[string]interface{}{"secret": 0, "_id": false})
+	require.NoError(t, err)
+
+	result := projection.Apply(domain.Document{"_id": "1", "name": "Alice", "secret": "x"})
+	assert.Equal(t, domain.Document{"name": "Alice"}, result)
+
+	projection, err = ParseProjection(map[string]interface{}{"fullName": "$name", "_id": 0})
+	require.NoError(t, err)
+	assert.Equal(t, domain.Document{"fullName": "Alice"}, projection.Apply(domain.Document{"_id": "1", "name": "Alice"}))
+}
+
+func TestParseProjection_Operators(t *testing.T) {
+	doc := domain.Document{"a": 10, "b": 4}
+	cases := map[string]float64{
+		"$add":      14,
+		"$subtract": 6,
+		"$multiply": 40,
+		"$divide":   2.5,
+		"$mod":      2,
+	}
+	for op, expected := range cases {
+		projection, err := ParseProjection(map[string]interface{}{
+			"out": map[string]interface{}{op: []interface{}{"$a", "$b"}},
+		})
+		require.NoError(t, err, op)
+		assert.Equal(t, expected, projection.Apply(doc)["out"], op)
+	}
+
+	// Nested operators
+	projection, err := ParseProjection(map[string]interface{}{
+		"out": map[string]interface{}{"$multiply": []interface{}{
+			map[string]interface{}{"$add": []interface{}{"$a", "$b", 1}},
+			2,
+		}},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, float64(30), projection.Apply(doc)["out"])
+}
+
+func TestParseProjection_Invalid(t *testing.T) {
+	invalid := []map[string]interface{}{
+		{"name": 1, "secret": 0},
+		{"out": map[string]interface{}{"$pow": []interface{}{"$a", 2}}},
+		{"out": map[string]interface{}{"$add": []interface{}{"$a"}}},
+		{"out": map[string]interface{}{"$subtract": []interface{}{"$a", 1, 2}}},
+		{"out": map[string]interface{}{"$add": "$a"}},
+		{"out": map[string]interface{}{"$add": []interface{}{"$a", "text"}}},
+		{"out": map[string]interface{}{"$expr": "len(name)"}},
+		{"out": map[string]interface{}{"$add": []interface{}{"$a", 1}, "$mod": []interface{}{"$a", 1}}},
+		{"out": "$"},
+		{"": 1},
+	}
+	for _, spec := range invalid {
+		_, err := ParseProjection(spec)
+		assert.Error(t, err, "%v should be rejected", spec)
+	}
+
+	projection, err := ParseProjection(nil)
+	require.NoError(t, err)
+	assert.Nil(t, projection)
+	doc := domain.Document{"a": 1}
+	assert.Equal(t, doc, projection.Apply(doc))
+}
@@ -0,0 +1,7 @@
+//go:build race
+
+package storage
+
+// raceEnabled reports whether the tests run under the race detector, whose overhead
+// throughput thresholds do not allow for
+const raceEnabled = true
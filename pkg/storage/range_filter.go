@@ -0,0 +1,150 @@
+package storage
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/adfharrison1/go-db/pkg/domain"
+	"github.com/adfharrison1/go-db/pkg/indexing"
+)
+
+// Range operators matching a field against bounds, combinable on one field, e.g.
+// {"created_at": {"$gte": "2024-01-01T00:00:00Z", "$lt": "2024-02-01T00:00:00Z"}}.
+// Values are ordered by CompareValues.
+const (
+	GtFilterKey  = "$gt"
+	GteFilterKey = "$gte"
+	LtFilterKey  = "$lt"
+	LteFilterKey = "$lte"
+)
+
+// rangeFilterKeys lists the range operators
+var rangeFilterKeys = []string{GtFilterKey, GteFilterKey, LtFilterKey, LteFilterKey}
+
+// RangeFilterBounds returns the operator -> bound map of a range filter value. The
+// second result is false when the value is not a map of range operators only.
+func RangeFilterBounds(expected interface{}) (map[string]interface{}, bool) {
+	operator, ok := expected.(map[string]interface{})
+	if !ok || len(operator) == 0 {
+		return nil, false
+	}
+	for key := range operator {
+		if !isRangeFilterKey(key) {
+			return nil, false
+		}
+	}
+	return operator, true
+}
+
+// isRangeFilterKey reports whether key is a range operator
+func isRangeFilterKey(key string) bool {
+	for _, rangeKey := range rangeFilterKeys {
+		if key == rangeKey {
+			return true
+		}
+	}
+	return false
+}
+
+// validateRangeFilter checks that range operators are not mixed with other operators
+// than $ne and bound the field by numbers, strings or times
+func validateRangeFilter(field string, expected interface{}) error {
+	operator, ok := expected.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	if _, bounds, ok := NeFilterValue(expected); ok {
+		operator = bounds // The operators given with the $ne
+	}
+	hasRange := false
+	for key := range operator {
+		if isRangeFilterKey(key) {
+			hasRange = true
+		}
+	}
+	if !hasRange {
+		return nil
+	}
+	if _, ok := RangeFilterBounds(operator); !ok {
+		return fmt.Errorf("%w: range operators on field %s cannot be combined with other operators", domain.ErrInvalidFilter, field)
+	}
+	for key, bound := range operator {
+		if _, isNum := ToFloat64(bound); !isNum {
+			switch bound.(type) {
+			case string, time.Time:
+			default:
+				return fmt.Errorf("%w: %s on field %s must be a number, string or time, got %s", domain.ErrInvalidFilter, key, field, FieldTypeName(bound))
+			}
+		}
+	}
+	return nil
+}
+
+// matchesRange reports whether actual satisfies every bound, ordering values with
+// compare. Values that cannot be ordered against a bound do not match.
+func matchesRange(actual interface{}, bounds map[string]interface{}, compare func(a, b interface{}) (int, bool)) bool {
+	for key, bound := range bounds {
+		cmp, ok := compare(actual, bound)
+		if !ok {
+			return false
+		}
+		switch key {
+		case GtFilterKey:
+			ok = cmp > 0
+		case GteFilterKey:
+			ok = cmp >= 0
+		case LtFilterKey:
+			ok = cmp < 0
+		case LteFilterKey:
+			ok = cmp <= 0
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// mergeRangeBounds ANDs two range filter values on one field, keeping the tighter
+// bound when both use the same operator. The second result is false when the
+// bounds cannot be ordered against each other.
+func mergeRangeBounds(a, b map[string]interface{}) (map[string]interface{}, bool) {
+	merged := make(map[string]interface{}, len(a)+len(b))
+	for key, bound := range a {
+		merged[key] = bound
+	}
+	for key, bound := range b {
+		existing, exists := merged[key]
+		if !exists {
+			merged[key] = bound
+			continue
+		}
+		cmp, ok := CompareValues(bound, existing)
+		if !ok {
+			return nil, false
+		}
+		lower := key == GtFilterKey || key == GteFilterKey
+		if (lower && cmp > 0) || (!lower && cmp < 0) {
+			merged[key] = bound
+		}
+	}
+	return merged, true
+}
+
+// queryIndexCondition answers a range, time-typed or collated filter condition from
+// an index, testing each distinct indexed value (see queryIndexCollated for collated
+// ones). The second result is false for other conditions.
+func queryIndexCondition(index *indexing.Index, expected interface{}) ([]string, bool) {
+	if condition, ok := expected.(*timeCondition); ok {
+		return index.QueryMatching(condition.matches), true
+	}
+	if condition, ok := expected.(*collatedCondition); ok {
+		return queryIndexCollated(index, condition), true
+	}
+	if bounds, ok := RangeFilterBounds(expected); ok {
+		return index.QueryMatching(func(value interface{}) bool {
+			return matchesRange(value, bounds, CompareValues)
+		}), true
+	}
+	return nil, false
+}
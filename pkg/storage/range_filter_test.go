@@ -0,0 +1,108 @@
+package storage
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/adfharrison1/go-db/pkg/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompareValues(t *testing.T) {
+	cmp, ok := CompareValues(2, 10.5)
+	assert.True(t, ok)
+	assert.Equal(t, -1, cmp)
+
+	// Times compare by instant, not by their strings: ".5" is later than ".25", and
+	// 09:30Z is later than 10:00+01:00
+	cmp, ok = CompareValues("2024-01-01T10:00:00.5Z", "2024-01-01T10:00:00.25Z")
+	assert.True(t, ok)
+	assert.Equal(t, 1, cmp)
+	cmp, ok = CompareValues("2024-01-01T09:30:00Z", "2024-01-01T10:00:00+01:00")
+	assert.True(t, ok)
+	assert.Equal(t, 1, cmp)
+	cmp, ok = CompareValues("2024-01-01T09:00:00Z", time.Date(2024, 1, 1, 10, 0, 0, 0, time.FixedZone("", 3600)))
+	assert.True(t, ok)
+	assert.Equal(t, 0, cmp)
+
+	cmp, ok = CompareValues("apple", "banana")
+	assert.True(t, ok)
+	assert.Equal(t, -1, cmp)
+
+	_, ok = CompareValues("apple", 3)
+	assert.False(t, ok)
+	_, ok = CompareValues(nil, 3)
+	assert.False(t, ok)
+}
+
+func TestRangeFilter_MatchesFilter(t *testing.T) {
+	doc := domain.Document{"age": 30, "name": "Alice", "created_at": "2024-01-01T10:00:00.5Z"}
+
+	assert.True(t, MatchesFilter(doc, map[string]interface{}{"age": map[string]interface{}{"$gte": 30, "$lt": 40}}))
+	assert.False(t, MatchesFilter(doc, map[string]interface{}{"age": map[string]interface{}{"$gt": 30}}))
+	assert.True(t, MatchesFilter(doc, map[string]interface{}{"name": map[string]interface{}{"$lte": "Bob"}}))
+	assert.False(t, MatchesFilter(doc, map[string]interface{}{"age": map[string]interface{}{"$gt": "20"}}), "numbers and strings are not ordered")
+	assert.False(t, MatchesFilter(doc, map[string]interface{}{"missing": map[string]interface{}{"$gt": 0}}))
+
+	// RFC 3339 strings compare as times without a schema
+	assert.True(t, MatchesFilter(doc, map[string]interface{}{"created_at": map[string]interface{}{"$gt": "2024-01-01T10:00:00.25Z"}}))
+	assert.False(t, MatchesFilter(doc, map[string]interface{}{"created_at": map[string]interface{}{"$lt": "2024-01-01T11:00:00+01:00"}}))
+}
+
+func TestRangeFilter_Validate(t *testing.T) {
+	assert.NoError(t, ValidateFilter(map[string]interface{}{"age": map[string]interface{}{"$gt": 1, "$lte": 5}}))
+
+	for _, filter := range []map[string]interface{}{
+		{"age": map[string]interface{}{"$gt": 1, "$in": []interface{}{2}}},
+		{"age": map[string]interface{}{"$gt": 1, "$between": 2}},
+		{"age": map[string]interface{}{"$gt": nil}},
+		{"age": map[string]interface{}{"$lt": []interface{}{1}}},
+	} {
+		err := ValidateFilter(filter)
+		assert.True(t, errors.Is(err, domain.ErrInvalidFilter), "filter %v: got %v", filter, err)
+	}
+}
+
+func TestRangeFilter_CombineFilters(t *testing.T) {
+	combined := CombineFilters(
+		map[string]interface{}{"age": map[string]interface{}{"$gt": 18, "$lt": 65}},
+		map[string]interface{}{"age": map[string]interface{}{"$gt": 21}},
+	)
+	assert.Equal(t, map[string]interface{}{"$gt": 21, "$lt": 65}, combined["age"])
+
+	combined = CombineFilters(
+		map[string]interface{}{"age": map[string]interface{}{"$gt": 18}},
+		map[string]interface{}{"age": map[string]interface{}{"$gt": "x"}},
+	)
+	assert.Equal(t, "false", combined[ExprFilterKey])
+}
+
+func TestStorageEngine_RangeFilter(t *testing.T) {
+	engine := NewStorageEngine(WithNoSaves(true))
+	defer engine.StopBackgroundWorkers()
+
+	for _, age := range []int{15, 25, 35, 45} {
+		_, err := engine.Insert("users", domain.Document{"age": age})
+		require.NoError(t, err)
+	}
+	filter := map[string]interface{}{"age": map[string]interface{}{"$gte": 25, "$lt": 45}}
+
+	result, err := engine.FindAll("users", filter, nil)
+	require.NoError(t, err)
+	assert.Len(t, result.Documents, 2)
+
+	// An index answers the range from its distinct values
+	require.NoError(t, engine.CreateIndex("users", "age"))
+	ids, useIndex := engine.optimizeWithIndexes("users", filter)
+	assert.True(t, useIndex)
+	assert.ElementsMatch(t, []string{"2", "3"}, ids)
+
+	result, err = engine.FindAll("users", filter, nil)
+	require.NoError(t, err)
+	assert.Len(t, result.Documents, 2)
+
+	_, err = engine.FindAll("users", map[string]interface{}{"age": map[string]interface{}{"$gt": true}}, nil)
+	assert.True(t, errors.Is(err, domain.ErrInvalidFilter), "got %v", err)
+}
@@ -0,0 +1,124 @@
+package storage
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/adfharrison1/go-db/pkg/domain"
+)
+
+// RegexFilterKey is the operator matching string fields against a Go regular
+// expression (see regexp/syntax), e.g. {"name": {"$regex": "^Al"}}. The pattern is
+// unanchored, so it matches anywhere in the value unless anchored with ^ or $. An
+// array matches when any of its string elements does; values that are not strings
+// never match. Documents are always scanned; indexes are not used for the field.
+const RegexFilterKey = "$regex"
+
+// RegexOptionsKey is the sibling of $regex holding flags for the pattern:
+// "i" ignores case, "m" makes ^ and $ match at line breaks and "s" lets . match \n,
+// e.g. {"name": {"$regex": "^al", "$options": "i"}}
+const RegexOptionsKey = "$options"
+
+// regexOptions lists the accepted $options flags
+const regexOptions = "ims"
+
+// maxCachedRegexes bounds the compiled pattern cache
+const maxCachedRegexes = 256
+
+var regexCache = struct {
+	sync.RWMutex
+	entries map[string]*regexp.Regexp
+}{entries: make(map[string]*regexp.Regexp)}
+
+// RegexFilterPattern returns the compiled pattern of a $regex filter value. The
+// second result is false when the filter value holds no $regex; the error reports a
+// malformed operator or pattern.
+func RegexFilterPattern(expected interface{}) (*regexp.Regexp, bool, error) {
+	operator, ok := expected.(map[string]interface{})
+	if !ok {
+		return nil, false, nil
+	}
+	source, exists := operator[RegexFilterKey]
+	if !exists {
+		return nil, false, nil
+	}
+
+	pattern, ok := source.(string)
+	if !ok {
+		return nil, true, fmt.Errorf("%s must be a string pattern, got %s", RegexFilterKey, FieldTypeName(source))
+	}
+	options := ""
+	for key, value := range operator {
+		switch key {
+		case RegexFilterKey:
+		case RegexOptionsKey:
+			if options, ok = value.(string); !ok {
+				return nil, true, fmt.Errorf("%s must be a string of flags, got %s", RegexOptionsKey, FieldTypeName(value))
+			}
+		default:
+			return nil, true, fmt.Errorf("%s can only be combined with %s, not %s", RegexFilterKey, RegexOptionsKey, key)
+		}
+	}
+	compiled, err := compileRegex(pattern, options)
+	return compiled, true, err
+}
+
+// compileRegex compiles a pattern with $options flags, reusing a cached compilation
+// when the same pattern and flags have been seen before
+func compileRegex(pattern, options string) (*regexp.Regexp, error) {
+	for _, flag := range options {
+		if !strings.ContainsRune(regexOptions, flag) {
+			return nil, fmt.Errorf("unsupported %s flag %q (supported: %s)", RegexOptionsKey, flag, regexOptions)
+		}
+	}
+	source := pattern
+	if options != "" {
+		source = "(?" + options + ")" + pattern
+	}
+
+	regexCache.RLock()
+	cached, ok := regexCache.entries[source]
+	regexCache.RUnlock()
+	if ok {
+		return cached, nil
+	}
+
+	compiled, err := regexp.Compile(source)
+	if err != nil {
+		return nil, err
+	}
+
+	regexCache.Lock()
+	if len(regexCache.entries) >= maxCachedRegexes {
+		regexCache.entries = make(map[string]*regexp.Regexp)
+	}
+	regexCache.entries[source] = compiled
+	regexCache.Unlock()
+
+	return compiled, nil
+}
+
+// validateRegexFilter checks that a $regex operator holds a valid pattern and flags
+// and that $options is not given without it
+func validateRegexFilter(field string, expected interface{}) error {
+	operator, ok := expected.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	_, isRegex, err := RegexFilterPattern(expected)
+	if err != nil {
+		return fmt.Errorf("%w: field %s: %v", domain.ErrInvalidFilter, field, err)
+	}
+	if _, exists := operator[RegexOptionsKey]; exists && !isRegex {
+		return fmt.Errorf("%w: %s on field %s requires %s", domain.ErrInvalidFilter, RegexOptionsKey, field, RegexFilterKey)
+	}
+	return nil
+}
+
+// matchesRegex reports whether a value is a string the pattern matches
+func matchesRegex(actual interface{}, pattern *regexp.Regexp) bool {
+	s, ok := actual.(string)
+	return ok && pattern.MatchString(s)
+}
@@ -0,0 +1,86 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/adfharrison1/go-db/pkg/domain"
+	"github.com/adfharrison1/go-db/pkg/indexing"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func regex(pattern string, options ...string) map[string]interface{} {
+	operator := map[string]interface{}{"$regex": pattern}
+	if len(options) > 0 {
+		operator["$options"] = options[0]
+	}
+	return operator
+}
+
+func TestRegexFilter_MatchesFilter(t *testing.T) {
+	doc := domain.Document{"name": "Alice", "age": 30, "tags": []interface{}{"golang", "db"}, "bio": "line one\nline two"}
+
+	assert.True(t, MatchesFilter(doc, map[string]interface{}{"name": regex("^Al")}))
+	assert.True(t, MatchesFilter(doc, map[string]interface{}{"name": regex("ic")}), "patterns are unanchored")
+	assert.False(t, MatchesFilter(doc, map[string]interface{}{"name": regex("^al")}), "patterns are case-sensitive")
+	assert.True(t, MatchesFilter(doc, map[string]interface{}{"name": regex("^al", "i")}))
+	assert.True(t, MatchesFilter(doc, map[string]interface{}{"tags": regex("^go")}), "any array element can match")
+	assert.False(t, MatchesFilter(doc, map[string]interface{}{"age": regex("30")}), "non-string values never match")
+	assert.False(t, MatchesFilter(doc, map[string]interface{}{"missing": regex(".*")}))
+	assert.False(t, MatchesFilter(doc, map[string]interface{}{"bio": regex("^line two$")}))
+	assert.True(t, MatchesFilter(doc, map[string]interface{}{"bio": regex("^line two$", "m")}))
+}
+
+func TestRegexFilter_Validate(t *testing.T) {
+	assert.NoError(t, ValidateFilter(map[string]interface{}{"name": regex("^a", "ims")}))
+
+	for _, filter := range []map[string]interface{}{
+		{"name": regex("(")},
+		{"name": regex("a", "x")},
+		{"name": map[string]interface{}{"$regex": 1}},
+		{"name": map[string]interface{}{"$regex": "a", "$options": true}},
+		{"name": map[string]interface{}{"$regex": "a", "$gt": "b"}},
+		{"name": map[string]interface{}{"$options": "i"}},
+	} {
+		assert.ErrorIs(t, ValidateFilter(filter), domain.ErrInvalidFilter, "filter %v", filter)
+	}
+
+	engine := NewStorageEngine(WithNoSaves(true))
+	defer engine.StopBackgroundWorkers()
+	_, err := engine.Insert("users", domain.Document{"name": "Alice"})
+	require.NoError(t, err)
+	_, err = engine.FindAll("users", map[string]interface{}{"name": regex("[a-")}, nil)
+	assert.ErrorIs(t, err, domain.ErrInvalidFilter)
+}
+
+func TestRegexFilter_IndexedFields(t *testing.T) {
+	engine := NewStorageEngine(WithNoSaves(true))
+	defer engine.StopBackgroundWorkers()
+	for _, doc := range []domain.Document{
+		{"name": "Alice", "city": "Paris"},
+		{"name": "Alan", "city": "Rome"},
+		{"name": "Bob", "city": "Paris"},
+	} {
+		_, err := engine.Insert("users", doc)
+		require.NoError(t, err)
+	}
+	require.NoError(t, engine.CreateIndex("users", "name"))
+	require.NoError(t, engine.CreateIndex("users", "city"))
+	getIndex := func(field string) (*indexing.Index, bool) { return engine.getIndex("users", field) }
+
+	// The regex field is scanned, while the equality on city still narrows by index
+	filter := map[string]interface{}{"name": regex("^al", "i"), "city": "Paris"}
+	_, ok := IndexOnlyIDs(filter, getIndex)
+	assert.False(t, ok)
+	candidates, useIndex := engine.optimizeWithIndexes("users", filter)
+	assert.True(t, useIndex)
+	assert.ElementsMatch(t, []string{"1", "3"}, candidates)
+
+	ids, err := engine.FindIds("users", filter)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"1"}, ids)
+
+	result, err := engine.FindAll("users", map[string]interface{}{"name": regex("^Al")}, nil)
+	require.NoError(t, err)
+	assert.Len(t, result.Documents, 2)
+}
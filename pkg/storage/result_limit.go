@@ -0,0 +1,17 @@
+package storage
+
+import (
+	"fmt"
+
+	"github.com/adfharrison1/go-db/pkg/domain"
+)
+
+// CheckResultSize reports whether a query may keep collecting matches once count
+// documents have matched. A max of 0 or less means no limit. Returned errors wrap
+// domain.ErrResultTooLarge.
+func CheckResultSize(count, max int) error {
+	if max > 0 && count > max {
+		return fmt.Errorf("%w: more than %d documents matched, use a narrower filter", domain.ErrResultTooLarge, max)
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/adfharrison1/go-db/pkg/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckResultSize(t *testing.T) {
+	assert.NoError(t, CheckResultSize(1000, 0), "zero means unlimited")
+	assert.NoError(t, CheckResultSize(2, 2))
+
+	err := CheckResultSize(3, 2)
+	require.Error(t, err)
+	assert.True(t, errors.Is(err, domain.ErrResultTooLarge))
+}
+
+func TestStorageEngine_MaxResultSize(t *testing.T) {
+	engine := NewStorageEngine(WithNoSaves(true), WithMaxResultSize(3))
+	defer engine.StopBackgroundWorkers()
+
+	for i := 0; i < 5; i++ {
+		city := "Paris"
+		if i >= 3 {
+			city = "Rome"
+		}
+		_, err := engine.Insert("users", domain.Document{"name": fmt.Sprintf("user%d", i), "city": city})
+		require.NoError(t, err)
+	}
+
+	// The limit applies to matches before pagination, not to the page size
+	_, err := engine.FindAll("users", nil, &domain.PaginationOptions{Limit: 1, MaxLimit: 1000})
+	assert.True(t, errors.Is(err, domain.ErrResultTooLarge), "got %v", err)
+
+	result, err := engine.FindAll("users", map[string]interface{}{"city": "Paris"}, nil)
+	require.NoError(t, err)
+	assert.Len(t, result.Documents, 3)
+
+	// Index lookups are limited too
+	require.NoError(t, engine.CreateIndex("users", "city"))
+	result, err = engine.FindAll("users", map[string]interface{}{"city": "Rome"}, nil)
+	require.NoError(t, err)
+	assert.Len(t, result.Documents, 2)
+
+	_, err = engine.FindAll("users", map[string]interface{}{"city": map[string]interface{}{"$in": []interface{}{"Paris", "Rome"}}}, nil)
+	assert.True(t, errors.Is(err, domain.ErrResultTooLarge), "got %v", err)
+}
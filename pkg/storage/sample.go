@@ -0,0 +1,117 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+
+	"github.com/adfharrison1/go-db/pkg/domain"
+)
+
+const (
+	// DefaultSampleSize is the number of documents returned when no size is given
+	DefaultSampleSize = 10
+
+	// MaxSampleSize bounds the number of documents returned by a single sample
+	MaxSampleSize = 1000
+)
+
+// Sample returns up to size documents from a collection for quick inspection
+func (se *StorageEngine) Sample(collName string, size int, seed *int64) ([]domain.Document, error) {
+	return se.SampleContext(context.Background(), collName, size, seed)
+}
+
+// SampleContext returns up to size documents from a collection without sorting.
+// Without a seed the first documents in map iteration order are returned and the
+// scan stops as soon as enough are found. With a seed every document is
+// considered and a uniform random sample is kept. Results are non-deterministic
+// either way; map iteration order differs between calls.
+func (se *StorageEngine) SampleContext(ctx context.Context, collName string, size int, seed *int64) ([]domain.Document, error) {
+	if err := ValidateSampleSize(size); err != nil {
+		return nil, err
+	}
+	filter := se.applyDefaultFilter(ctx, collName, nil)
+
+	var result []domain.Document
+	err := se.withCollectionReadLock(collName, func() error {
+		collection, err := se.getCollectionInternal(collName)
+		if err != nil {
+			return err
+		}
+
+		sampler := NewSampler(size, seed)
+		scanned := 0
+		var scanErr error
+		collection.Range(func(_ string, doc domain.Document) bool {
+			if scanErr = checkScanContext(ctx, scanned); scanErr != nil {
+				return false
+			}
+			scanned++
+			if len(filter) > 0 && !MatchesFilter(doc, filter) {
+				return true
+			}
+			return sampler.Add(doc)
+		})
+		if scanErr != nil {
+			return scanErr
+		}
+		result = sampler.Documents()
+		if se.copyOnRead {
+			result = copyDocuments(result)
+		}
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// ValidateSampleSize checks the requested number of sample documents
+func ValidateSampleSize(size int) error {
+	if size < 1 || size > MaxSampleSize {
+		return fmt.Errorf("sample size must be between 1 and %d, got %d", MaxSampleSize, size)
+	}
+	return nil
+}
+
+// Sampler collects up to a fixed number of documents from a scan. Without a
+// random source it keeps the first documents offered; with one it keeps a
+// uniform random sample of everything offered (reservoir sampling).
+type Sampler struct {
+	size int
+	rng  *rand.Rand
+	seen int
+	docs []domain.Document
+}
+
+// NewSampler creates a sampler for size documents, randomized when seed is non-nil
+func NewSampler(size int, seed *int64) *Sampler {
+	s := &Sampler{size: size, docs: make([]domain.Document, 0, size)}
+	if seed != nil {
+		s.rng = rand.New(rand.NewSource(*seed))
+	}
+	return s
+}
+
+// Add offers a document to the sampler and reports whether the scan should continue
+func (s *Sampler) Add(doc domain.Document) bool {
+	s.seen++
+	if len(s.docs) < s.size {
+		s.docs = append(s.docs, doc)
+		return s.rng != nil || len(s.docs) < s.size
+	}
+	if s.rng == nil {
+		return false
+	}
+	if j := s.rng.Intn(s.seen); j < s.size {
+		s.docs[j] = doc
+	}
+	return true
+}
+
+// Documents returns the sampled documents
+func (s *Sampler) Documents() []domain.Document {
+	return s.docs
+}
@@ -0,0 +1,83 @@
+package storage
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/adfharrison1/go-db/pkg/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSampler_FirstN(t *testing.T) {
+	sampler := NewSampler(2, nil)
+
+	assert.True(t, sampler.Add(domain.Document{"n": 1}))
+	assert.False(t, sampler.Add(domain.Document{"n": 2}), "scan should stop once the sample is full")
+	assert.Len(t, sampler.Documents(), 2)
+}
+
+func TestSampler_Random(t *testing.T) {
+	seed := int64(42)
+	sampler := NewSampler(3, &seed)
+
+	for i := 0; i < 100; i++ {
+		assert.True(t, sampler.Add(domain.Document{"n": i}), "random sampling considers every document")
+	}
+
+	docs := sampler.Documents()
+	require.Len(t, docs, 3)
+	seen := make(map[interface{}]bool)
+	for _, doc := range docs {
+		assert.False(t, seen[doc["n"]], "sample should not contain duplicates")
+		seen[doc["n"]] = true
+	}
+}
+
+func TestValidateSampleSize(t *testing.T) {
+	assert.NoError(t, ValidateSampleSize(1))
+	assert.NoError(t, ValidateSampleSize(MaxSampleSize))
+	assert.Error(t, ValidateSampleSize(0))
+	assert.Error(t, ValidateSampleSize(MaxSampleSize+1))
+}
+
+func TestStorageEngine_Sample(t *testing.T) {
+	engine := NewStorageEngine(WithDataDir(t.TempDir()), WithNoSaves(true))
+	defer engine.StopBackgroundWorkers()
+
+	for i := 0; i < 20; i++ {
+		_, err := engine.Insert("events", domain.Document{"name": fmt.Sprintf("event-%d", i), "deleted": i%2 == 0})
+		require.NoError(t, err)
+	}
+
+	docs, err := engine.Sample("events", 5, nil)
+	require.NoError(t, err)
+	assert.Len(t, docs, 5)
+
+	seed := int64(7)
+	docs, err = engine.Sample("events", 50, &seed)
+	require.NoError(t, err)
+	assert.Len(t, docs, 20, "sample is capped by the collection size")
+
+	t.Run("default filter applies", func(t *testing.T) {
+		engine.SetCollectionDefaultFilter("events", map[string]interface{}{"deleted": false})
+		defer engine.SetCollectionDefaultFilter("events", nil)
+
+		docs, err := engine.Sample("events", 50, nil)
+		require.NoError(t, err)
+		assert.Len(t, docs, 10)
+		for _, doc := range docs {
+			assert.Equal(t, false, doc["deleted"])
+		}
+	})
+
+	t.Run("missing collection", func(t *testing.T) {
+		_, err := engine.Sample("missing", 5, nil)
+		assert.Error(t, err)
+	})
+
+	t.Run("invalid size", func(t *testing.T) {
+		_, err := engine.Sample("events", 0, nil)
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,113 @@
+package storage
+
+import (
+	"log"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// DefaultSaveConcurrency is how many collections background saves write at once
+const DefaultSaveConcurrency = 4
+
+// savePool bounds how many collections background saves write at once, so a burst of
+// dirty collections does not open and write every file together. Savers beyond the
+// limit wait their turn in the order they asked.
+type savePool struct {
+	slots  chan struct{} // Holds a token per collection being written
+	queued int64         // Collections waiting for a saver
+	saved  int64
+	failed int64
+}
+
+// newSavePool creates a pool of n savers, or DefaultSaveConcurrency if n is not positive
+func newSavePool(n int) *savePool {
+	if n <= 0 {
+		n = DefaultSaveConcurrency
+	}
+	return &savePool{slots: make(chan struct{}, n)}
+}
+
+// acquire waits for a free saver
+func (p *savePool) acquire() {
+	atomic.AddInt64(&p.queued, 1)
+	p.slots <- struct{}{}
+	atomic.AddInt64(&p.queued, -1)
+}
+
+// release frees a saver, counting the outcome of its save
+func (p *savePool) release(err error) {
+	if err != nil {
+		atomic.AddInt64(&p.failed, 1)
+	} else {
+		atomic.AddInt64(&p.saved, 1)
+	}
+	<-p.slots
+}
+
+// stats returns the pool's concurrency, current queue depth and active savers, and
+// the saves completed so far
+func (p *savePool) stats() map[string]interface{} {
+	return map[string]interface{}{
+		"concurrency":   cap(p.slots),
+		"queue_depth":   atomic.LoadInt64(&p.queued),
+		"active_savers": len(p.slots),
+		"saved":         atomic.LoadInt64(&p.saved),
+		"failed":        atomic.LoadInt64(&p.failed),
+	}
+}
+
+// saveThrottled saves a collection once a saver is free
+func (se *StorageEngine) saveThrottled(collName string) error {
+	se.savePool.acquire()
+	err := se.saveCollectionToFile(collName)
+	se.savePool.release(err)
+	return err
+}
+
+// saveCollections saves the collections through the save pool, starting them in the
+// order given, and returns how many were saved and how many failed
+func (se *StorageEngine) saveCollections(collNames []string) (int, int) {
+	var saved, failed int64
+	var wg sync.WaitGroup
+	for _, collName := range collNames {
+		// Taking the saver here rather than in the goroutine keeps the start order
+		se.savePool.acquire()
+		wg.Add(1)
+		go func(collName string) {
+			defer wg.Done()
+			err := se.saveCollectionToFile(collName)
+			se.savePool.release(err)
+			if err != nil {
+				log.Printf("ERROR: Failed to save collection %s: %v", collName, err)
+				atomic.AddInt64(&failed, 1)
+				return
+			}
+			atomic.AddInt64(&saved, 1)
+		}(collName)
+	}
+	wg.Wait()
+	return int(saved), int(failed)
+}
+
+// dirtyCollectionsOldestFirst lists the dirty collections, longest dirty first, so a
+// collection written continuously cannot keep the others waiting
+func (se *StorageEngine) dirtyCollectionsOldestFirst() []string {
+	se.mu.RLock()
+	defer se.mu.RUnlock()
+
+	var names []string
+	for collName, info := range se.collections {
+		if info.currentState() == CollectionStateDirty {
+			names = append(names, collName)
+		}
+	}
+	sort.Slice(names, func(i, j int) bool {
+		a, b := se.collections[names[i]].dirtySince(), se.collections[names[j]].dirtySince()
+		if !a.Equal(b) {
+			return a.Before(b)
+		}
+		return names[i] < names[j]
+	})
+	return names
+}
@@ -0,0 +1,79 @@
+package storage
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/adfharrison1/go-db/pkg/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSavePool(t *testing.T) {
+	assert.Equal(t, DefaultSaveConcurrency, newSavePool(0).stats()["concurrency"])
+
+	pool := newSavePool(2)
+	pool.acquire()
+	pool.acquire()
+
+	acquired := make(chan struct{})
+	go func() {
+		pool.acquire()
+		close(acquired)
+	}()
+	assert.Eventually(t, func() bool { return pool.stats()["queue_depth"] == int64(1) }, time.Second, time.Millisecond)
+	assert.Equal(t, 2, pool.stats()["active_savers"])
+
+	pool.release(nil)
+	<-acquired
+	pool.release(errors.New("disk full"))
+	pool.release(nil)
+
+	stats := pool.stats()
+	assert.Equal(t, int64(0), stats["queue_depth"])
+	assert.Equal(t, 0, stats["active_savers"])
+	assert.Equal(t, int64(2), stats["saved"])
+	assert.Equal(t, int64(1), stats["failed"])
+}
+
+func TestStorageEngine_SaveDirtyCollections_OldestFirst(t *testing.T) {
+	engine := NewStorageEngine(WithDataDir(t.TempDir()), WithNoSaves(true), WithSaveConcurrency(1))
+	defer engine.StopBackgroundWorkers()
+
+	for _, name := range []string{"busy", "orders", "users"} {
+		_, err := engine.Insert(name, domain.Document{"n": 1})
+		require.NoError(t, err)
+	}
+	// Further writes keep the collection's place in the queue
+	for i := 0; i < 3; i++ {
+		_, err := engine.Insert("busy", domain.Document{"n": i})
+		require.NoError(t, err)
+	}
+	assert.Equal(t, []string{"busy", "orders", "users"}, engine.dirtyCollectionsOldestFirst())
+
+	// With every saver busy the save waits its turn
+	engine.savePool.acquire()
+	done := make(chan struct{})
+	go func() {
+		engine.saveDirtyCollections()
+		close(done)
+	}()
+	assert.Eventually(t, func() bool {
+		return engine.GetMemoryStats()["background_saves"].(map[string]interface{})["queue_depth"] == int64(1)
+	}, time.Second, time.Millisecond)
+	select {
+	case <-done:
+		t.Fatal("Expected the save to wait for a free saver")
+	default:
+	}
+
+	engine.savePool.release(nil)
+	<-done
+	assert.Empty(t, engine.dirtyCollectionsOldestFirst())
+
+	stats := engine.GetMemoryStats()["background_saves"].(map[string]interface{})
+	assert.Equal(t, 1, stats["concurrency"])
+	assert.Equal(t, 0, stats["active_savers"])
+	assert.Equal(t, int64(4), stats["saved"], "three collections plus the manual release")
+}
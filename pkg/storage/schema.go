@@ -0,0 +1,267 @@
+package storage
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/adfharrison1/go-db/pkg/domain"
+	"github.com/adfharrison1/go-db/pkg/indexing"
+)
+
+// SetCollectionSchema sets the collection's field type hints, e.g.
+// {"created_at": domain.FieldTypeTime}. Filters on a time field compare values as
+// instants, so "2024-01-01T10:00:00+02:00" equals "2024-01-01T08:00:00Z" and range
+// operators order by time whatever the precision or offset. Documents are stored
+// unchanged. Passing a nil or empty schema removes it.
+// Schemas are held in memory only and are not persisted.
+func (se *StorageEngine) SetCollectionSchema(collName string, schema map[string]domain.FieldType) {
+	se.schemasMu.Lock()
+	defer se.schemasMu.Unlock()
+
+	if len(schema) == 0 {
+		delete(se.schemas, collName)
+		delete(se.strictSchemas, collName)
+		return
+	}
+	se.schemas[collName] = CopySchema(schema)
+}
+
+// GetCollectionSchema returns a copy of the collection's field type hints, or nil if none are set
+func (se *StorageEngine) GetCollectionSchema(collName string) map[string]domain.FieldType {
+	se.schemasMu.RLock()
+	defer se.schemasMu.RUnlock()
+
+	schema, exists := se.schemas[collName]
+	if !exists {
+		return nil
+	}
+	return CopySchema(schema)
+}
+
+// SetCollectionSchemaStrict turns strict mode on or off for the collection's schema.
+// In strict mode inserts, replaces and updates fail with domain.ErrFieldNotInSchema
+// when the document they would store has fields the schema does not declare. It has
+// no effect while the collection has no schema, and removing the schema turns it off.
+func (se *StorageEngine) SetCollectionSchemaStrict(collName string, strict bool) {
+	se.schemasMu.Lock()
+	defer se.schemasMu.Unlock()
+
+	if !strict {
+		delete(se.strictSchemas, collName)
+		return
+	}
+	se.strictSchemas[collName] = true
+}
+
+// IsCollectionSchemaStrict reports whether strict mode is on for the collection's schema
+func (se *StorageEngine) IsCollectionSchemaStrict(collName string) bool {
+	se.schemasMu.RLock()
+	defer se.schemasMu.RUnlock()
+	return se.strictSchemas[collName]
+}
+
+// checkStrictSchema rejects a write whose stored document would have the fields of
+// docs when the collection's schema is strict and does not declare them all
+func (se *StorageEngine) checkStrictSchema(collName string, docs ...domain.Document) error {
+	se.schemasMu.RLock()
+	var schema map[string]domain.FieldType
+	if se.strictSchemas[collName] {
+		schema = se.schemas[collName]
+	}
+	se.schemasMu.RUnlock()
+
+	return CheckSchemaFields(schema, docs...)
+}
+
+// CheckSchemaFields returns an error matching domain.ErrFieldNotInSchema that lists
+// the top-level fields of docs not declared in schema. A field is declared if the
+// schema names it or a path inside it, such as "address" for "address.city". _id and
+// the auto timestamp and version fields are always allowed. An empty schema allows any field.
+func CheckSchemaFields(schema map[string]domain.FieldType, docs ...domain.Document) error {
+	if len(schema) == 0 {
+		return nil
+	}
+
+	var unknown []string
+	seen := make(map[string]bool)
+	for _, doc := range docs {
+		for field := range doc {
+			if seen[field] || field == "_id" || IsTimestampField(field) || field == VersionField || schemaDeclares(schema, field) {
+				continue
+			}
+			seen[field] = true
+			unknown = append(unknown, field)
+		}
+	}
+	if len(unknown) == 0 {
+		return nil
+	}
+	sort.Strings(unknown)
+	return domain.Errorf(domain.ErrFieldNotInSchema, "field not in schema: %s", strings.Join(unknown, ", "))
+}
+
+// SchemaViolations returns why doc does not conform to schema, or nil if it does:
+// each top-level field the schema does not declare (see CheckSchemaFields), which a
+// strict schema would reject, and each time-typed field holding a value that is not a
+// time, or an array with such an element. Fields the document lacks are not
+// violations. Reasons are sorted.
+func SchemaViolations(schema map[string]domain.FieldType, doc domain.Document) []string {
+	if len(schema) == 0 {
+		return nil
+	}
+
+	var reasons []string
+	for field := range doc {
+		if field == "_id" || IsTimestampField(field) || field == VersionField || schemaDeclares(schema, field) {
+			continue
+		}
+		reasons = append(reasons, "field not in schema: "+field)
+	}
+	for field, fieldType := range schema {
+		if fieldType != domain.FieldTypeTime {
+			continue
+		}
+		value, exists := lookupFieldPath(doc, strings.Split(field, "."))
+		if exists && !isTimeValue(value) {
+			reasons = append(reasons, fmt.Sprintf("field %s is not a time", field))
+		}
+	}
+	sort.Strings(reasons)
+	return reasons
+}
+
+// isTimeValue reports whether value is a time, or an array of times
+func isTimeValue(value interface{}) bool {
+	if elements, isArray := indexing.ArrayElements(value); isArray {
+		for _, element := range elements {
+			if _, ok := parseTimeField(element); !ok {
+				return false
+			}
+		}
+		return true
+	}
+	_, ok := parseTimeField(value)
+	return ok
+}
+
+// schemaDeclares reports whether schema names field or a path inside it
+func schemaDeclares(schema map[string]domain.FieldType, field string) bool {
+	if _, declared := schema[field]; declared {
+		return true
+	}
+	for name := range schema {
+		if strings.HasPrefix(name, field+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateCollectionSchema checks that every field has a known type. _id cannot be
+// typed because IDs are assigned by the engine and always compared as strings.
+func ValidateCollectionSchema(schema map[string]domain.FieldType) error {
+	for field, fieldType := range schema {
+		if field == "" || strings.HasPrefix(field, "$") {
+			return fmt.Errorf("invalid schema field name %q", field)
+		}
+		if field == "_id" {
+			return fmt.Errorf("cannot set a type for _id")
+		}
+		if fieldType != domain.FieldTypeTime && fieldType != domain.FieldTypeAny {
+			return fmt.Errorf("unknown type %q for field %s (use %s or %s)", fieldType, field, domain.FieldTypeTime, domain.FieldTypeAny)
+		}
+	}
+	return nil
+}
+
+// CopySchema returns a copy of a set of field type hints
+func CopySchema(schema map[string]domain.FieldType) map[string]domain.FieldType {
+	copied := make(map[string]domain.FieldType, len(schema))
+	for field, fieldType := range schema {
+		copied[field] = fieldType
+	}
+	return copied
+}
+
+// timeCondition is a filter condition on a time-typed field, compared as instants
+type timeCondition struct {
+	equals []time.Time            // Equality or $in: matches any of these instants
+	bounds map[string]interface{} // Range operators, bounds parsed to time.Time
+}
+
+// matches reports whether a stored value satisfies the condition. Values that are
+// not times never match.
+func (c *timeCondition) matches(actual interface{}) bool {
+	t, ok := parseTimeField(actual)
+	if !ok {
+		return false
+	}
+	if c.bounds != nil {
+		return matchesRange(t, c.bounds, CompareValues)
+	}
+	for _, value := range c.equals {
+		if t.Equal(value) {
+			return true
+		}
+	}
+	return false
+}
+
+// ApplySchema returns filter with the conditions on time-typed fields replaced by
+// conditions that compare instants. Conditions whose values are not all times are
+// left as they are, so they compare as before. filter itself is not modified.
+func ApplySchema(filter map[string]interface{}, schema map[string]domain.FieldType) map[string]interface{} {
+	if len(filter) == 0 || len(schema) == 0 {
+		return filter
+	}
+
+	var typed map[string]interface{}
+	for field, expected := range filter {
+		if schema[field] != domain.FieldTypeTime {
+			continue
+		}
+		condition, ok := newTimeCondition(expected)
+		if !ok {
+			continue
+		}
+		if typed == nil {
+			typed = copyFilter(filter)
+		}
+		typed[field] = condition
+	}
+	if typed == nil {
+		return filter
+	}
+	return typed
+}
+
+// newTimeCondition parses an equality, $in or range filter value as times
+func newTimeCondition(expected interface{}) (*timeCondition, bool) {
+	if bounds, ok := RangeFilterBounds(expected); ok {
+		parsed := make(map[string]interface{}, len(bounds))
+		for key, bound := range bounds {
+			t, ok := parseTimeField(bound)
+			if !ok {
+				return nil, false
+			}
+			parsed[key] = t
+		}
+		return &timeCondition{bounds: parsed}, true
+	}
+
+	values, ok := InFilterValues(expected)
+	if !ok {
+		values = []interface{}{expected}
+	}
+	equals := make([]time.Time, len(values))
+	for i, value := range values {
+		t, ok := parseTimeField(value)
+		if !ok {
+			return nil, false
+		}
+		equals[i] = t
+	}
+	return &timeCondition{equals: equals}, true
+}
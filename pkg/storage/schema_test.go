@@ -0,0 +1,187 @@
+package storage
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/adfharrison1/go-db/pkg/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateCollectionSchema(t *testing.T) {
+	assert.NoError(t, ValidateCollectionSchema(map[string]domain.FieldType{"created_at": domain.FieldTypeTime}))
+	assert.NoError(t, ValidateCollectionSchema(map[string]domain.FieldType{"name": domain.FieldTypeAny}))
+	assert.Error(t, ValidateCollectionSchema(map[string]domain.FieldType{"created_at": "date"}))
+	assert.Error(t, ValidateCollectionSchema(map[string]domain.FieldType{"_id": domain.FieldTypeTime}))
+	assert.Error(t, ValidateCollectionSchema(map[string]domain.FieldType{"$expr": domain.FieldTypeTime}))
+	assert.Error(t, ValidateCollectionSchema(map[string]domain.FieldType{"": domain.FieldTypeTime}))
+}
+
+func TestCheckSchemaFields(t *testing.T) {
+	schema := map[string]domain.FieldType{"name": domain.FieldTypeAny, "address.city": domain.FieldTypeAny}
+
+	assert.NoError(t, CheckSchemaFields(nil, domain.Document{"anything": 1}))
+	assert.NoError(t, CheckSchemaFields(schema, domain.Document{"_id": "1", "name": "Alice", "address": map[string]interface{}{"city": "Paris"}, UpdatedAtField: "now"}))
+
+	err := CheckSchemaFields(schema, domain.Document{"naem": "Alice", "name": "Alice"}, domain.Document{"age": 30, "naem": "Bob"})
+	assert.True(t, errors.Is(err, domain.ErrFieldNotInSchema), "got %v", err)
+	assert.Equal(t, "field not in schema: age, naem", err.Error())
+}
+
+func TestApplySchema(t *testing.T) {
+	schema := map[string]domain.FieldType{"at": domain.FieldTypeTime}
+	doc := domain.Document{"at": "2024-01-01T10:00:00+02:00", "n": 1}
+
+	// Equality and $in compare instants, not strings
+	filter := map[string]interface{}{"at": "2024-01-01T08:00:00.000Z"}
+	assert.False(t, MatchesFilter(doc, filter))
+	assert.True(t, MatchesFilter(doc, ApplySchema(filter, schema)))
+	assert.Equal(t, "2024-01-01T08:00:00.000Z", filter["at"], "the filter passed in is not modified")
+
+	inFilter := map[string]interface{}{"at": map[string]interface{}{"$in": []interface{}{"2020-01-01T00:00:00Z", "2024-01-01T08:00:00Z"}}}
+	assert.True(t, MatchesFilter(doc, ApplySchema(inFilter, schema)))
+
+	// Numbers are Unix seconds on either side
+	unix := time.Date(2024, 1, 1, 8, 0, 0, 0, time.UTC).Unix()
+	assert.True(t, MatchesFilter(doc, ApplySchema(map[string]interface{}{"at": float64(unix)}, schema)))
+	assert.True(t, MatchesFilter(domain.Document{"at": unix}, ApplySchema(map[string]interface{}{
+		"at": map[string]interface{}{"$gte": "2024-01-01T08:00:00Z", "$lt": "2024-01-01T08:00:01Z"},
+	}, schema)))
+
+	// Values that are not times compare as before
+	plain := map[string]interface{}{"at": "yesterday", "n": 1}
+	assert.Equal(t, plain, ApplySchema(plain, schema))
+	assert.False(t, MatchesFilter(domain.Document{"at": "not a time"}, ApplySchema(filter, schema)))
+}
+
+func TestStorageEngine_CollectionSchema(t *testing.T) {
+	engine := NewStorageEngine(WithNoSaves(true))
+	defer engine.StopBackgroundWorkers()
+
+	// Mixed precisions and offsets, as written by different clients
+	for _, at := range []string{
+		"2024-01-01T09:59:59.9Z",
+		"2024-01-01T12:30:00+02:00", // 10:30Z
+		"2024-01-01T10:00:00.25Z",
+		"2024-01-01T11:00:00Z",
+	} {
+		_, err := engine.Insert("events", domain.Document{"at": at})
+		require.NoError(t, err)
+	}
+	lastHalfHour := map[string]interface{}{"at": map[string]interface{}{"$gt": "2024-01-01T10:00:00Z", "$lte": "2024-01-01T10:30:00Z"}}
+
+	findIDs := func() []string {
+		ids, err := engine.FindIds("events", lastHalfHour)
+		require.NoError(t, err)
+		return ids
+	}
+
+	// With the schema every value, including numbers, is compared as an instant
+	engine.SetCollectionSchema("events", map[string]domain.FieldType{"at": domain.FieldTypeTime})
+	assert.Equal(t, map[string]domain.FieldType{"at": domain.FieldTypeTime}, engine.GetCollectionSchema("events"))
+	assert.ElementsMatch(t, []string{"2", "3"}, findIDs())
+
+	require.NoError(t, engine.CreateIndex("events", "at"))
+	assert.ElementsMatch(t, []string{"2", "3"}, findIDs())
+
+	result, err := engine.FindAll("events", map[string]interface{}{"at": "2024-01-01T10:30:00Z"}, nil)
+	require.NoError(t, err)
+	require.Len(t, result.Documents, 1)
+	assert.Equal(t, "2", result.Documents[0]["_id"])
+
+	// $expr comparisons order RFC 3339 strings as times too
+	result, err = engine.FindAll("events", map[string]interface{}{"$expr": `at > "2024-01-01T10:00:00Z"`}, nil)
+	require.NoError(t, err)
+	assert.Len(t, result.Documents, 3)
+
+	engine.SetCollectionSchema("events", nil)
+	assert.Nil(t, engine.GetCollectionSchema("events"))
+	result, err = engine.FindAll("events", map[string]interface{}{"at": "2024-01-01T10:30:00Z"}, nil)
+	require.NoError(t, err)
+	assert.Empty(t, result.Documents)
+}
+
+func TestStorageEngine_StrictSchema(t *testing.T) {
+	engine := NewStorageEngine(WithNoSaves(true))
+	defer engine.StopBackgroundWorkers()
+
+	_, err := engine.Insert("users", domain.Document{"name": "Alice", "nickname": "Al"})
+	require.NoError(t, err)
+
+	// Strict mode only applies while there is a schema
+	engine.SetCollectionSchemaStrict("users", true)
+	assert.True(t, engine.IsCollectionSchemaStrict("users"))
+	_, err = engine.Insert("users", domain.Document{"naem": "Bob"})
+	require.NoError(t, err)
+
+	engine.SetCollectionSchema("users", map[string]domain.FieldType{"name": domain.FieldTypeAny, "age": domain.FieldTypeAny})
+
+	_, err = engine.Insert("users", domain.Document{"name": "Carol", "age": 41})
+	require.NoError(t, err)
+	_, err = engine.Insert("users", domain.Document{"naem": "Dave"})
+	assert.True(t, errors.Is(err, domain.ErrFieldNotInSchema), "got %v", err)
+	assert.Contains(t, err.Error(), "naem")
+	_, err = engine.BatchInsert("users", []domain.Document{{"name": "Erin"}, {"agee": 3}})
+	assert.True(t, errors.Is(err, domain.ErrFieldNotInSchema), "got %v", err)
+
+	// Updates are checked on the merged document, so existing junk fields block them
+	_, err = engine.UpdateById("users", "3", domain.Document{"age": 42})
+	require.NoError(t, err)
+	_, err = engine.UpdateById("users", "3", domain.Document{"agee": 42})
+	assert.True(t, errors.Is(err, domain.ErrFieldNotInSchema), "got %v", err)
+	_, err = engine.UpdateById("users", "1", domain.Document{"age": 30})
+	assert.True(t, errors.Is(err, domain.ErrFieldNotInSchema), "got %v", err)
+
+	_, err = engine.ReplaceById("users", "1", domain.Document{"name": "Alice", "age": 30})
+	require.NoError(t, err)
+	_, err = engine.ReplaceById("users", "1", domain.Document{"name": "Alice", "nickname": "Al"})
+	assert.True(t, errors.Is(err, domain.ErrFieldNotInSchema), "got %v", err)
+
+	doc, err := engine.GetById("users", "1")
+	require.NoError(t, err)
+	assert.Equal(t, domain.Document{"_id": "1", "name": "Alice", "age": 30}, doc, "rejected writes change nothing")
+	result, err := engine.FindAll("users", nil, nil)
+	require.NoError(t, err)
+	assert.Len(t, result.Documents, 3)
+
+	// Removing the schema turns strict mode off
+	engine.SetCollectionSchema("users", nil)
+	assert.False(t, engine.IsCollectionSchemaStrict("users"))
+	_, err = engine.UpdateById("users", "1", domain.Document{"agee": 42})
+	assert.NoError(t, err)
+}
+
+func TestSchemaViolations(t *testing.T) {
+	schema := map[string]domain.FieldType{
+		"name":          domain.FieldTypeAny,
+		"created_at":    domain.FieldTypeTime,
+		"address.since": domain.FieldTypeTime,
+		"seen":          domain.FieldTypeTime,
+	}
+
+	assert.Nil(t, SchemaViolations(schema, domain.Document{
+		"_id":        "1",
+		"name":       "Alice",
+		"created_at": "2024-01-01T00:00:00Z",
+		"address":    map[string]interface{}{"since": 1704067200},
+		"seen":       []interface{}{"2024-01-01T00:00:00Z", "2024-02-01T00:00:00Z"},
+	}))
+	assert.Nil(t, SchemaViolations(schema, domain.Document{"_id": "2"}), "missing fields are allowed")
+
+	assert.Equal(t, []string{
+		"field address.since is not a time",
+		"field created_at is not a time",
+		"field not in schema: naem",
+		"field seen is not a time",
+	}, SchemaViolations(schema, domain.Document{
+		"_id":        "3",
+		"naem":       "Bob",
+		"created_at": "yesterday",
+		"address":    map[string]interface{}{"since": "a while"},
+		"seen":       []interface{}{"2024-01-01T00:00:00Z", "never"},
+	}))
+
+	assert.Nil(t, SchemaViolations(nil, domain.Document{"anything": true}))
+}
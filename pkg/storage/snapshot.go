@@ -0,0 +1,119 @@
+package storage
+
+import (
+	"sync"
+
+	"github.com/adfharrison1/go-db/pkg/domain"
+)
+
+// collectionSnapshot is a copy-on-write view of a collection's documents as they were
+// when a stream started. It starts as a shallow copy of the Documents map entries the
+// stream will read; a document is only copied when a write is about to modify it in
+// place, so the snapshot keeps the old version.
+type collectionSnapshot struct {
+	mu        sync.Mutex
+	docs      map[string]domain.Document
+	preserved map[string]bool // Documents the snapshot holds a private copy of
+}
+
+// openSnapshot registers a snapshot of the given documents of collection. Caller must
+// hold the collection read lock, so that no-saves writers are excluded while the
+// entries are copied; dual-write updates that start afterwards see the snapshot and
+// preserve documents before modifying them.
+func (se *StorageEngine) openSnapshot(collName string, collection *domain.Collection, docIDs []string) *collectionSnapshot {
+	snapshot := &collectionSnapshot{
+		docs:      make(map[string]domain.Document, len(docIDs)),
+		preserved: make(map[string]bool),
+	}
+
+	// Held while copying so writers that find the snapshot wait for its entries
+	snapshot.mu.Lock()
+	defer snapshot.mu.Unlock()
+
+	se.snapshotsMu.Lock()
+	if se.snapshots[collName] == nil {
+		se.snapshots[collName] = make(map[*collectionSnapshot]struct{})
+	}
+	se.snapshots[collName][snapshot] = struct{}{}
+	se.snapshotsMu.Unlock()
+
+	for _, docID := range docIDs {
+		if doc, exists := collection.Get(docID); exists {
+			snapshot.docs[docID] = doc
+		}
+	}
+	return snapshot
+}
+
+// closeSnapshot unregisters a snapshot so writers stop preserving documents for it
+func (se *StorageEngine) closeSnapshot(collName string, snapshot *collectionSnapshot) {
+	se.snapshotsMu.Lock()
+	defer se.snapshotsMu.Unlock()
+	delete(se.snapshots[collName], snapshot)
+	if len(se.snapshots[collName]) == 0 {
+		delete(se.snapshots, collName)
+	}
+}
+
+// preserveForSnapshots is called before a stored document is modified in place, with a
+// copy of its current version that the caller will not modify, and makes every open
+// snapshot holding the document keep that copy. Writes that replace or delete the
+// Documents map entry leave the old document untouched and need not call it. Caller
+// must hold the lock that serializes writes to the document.
+func (se *StorageEngine) preserveForSnapshots(collName, docID string, oldDoc domain.Document) {
+	se.snapshotsMu.RLock()
+	if len(se.snapshots[collName]) == 0 {
+		se.snapshotsMu.RUnlock()
+		return
+	}
+	snapshots := make([]*collectionSnapshot, 0, len(se.snapshots[collName]))
+	for snapshot := range se.snapshots[collName] {
+		snapshots = append(snapshots, snapshot)
+	}
+	se.snapshotsMu.RUnlock()
+
+	for _, snapshot := range snapshots {
+		snapshot.mu.Lock()
+		if _, exists := snapshot.docs[docID]; exists && !snapshot.preserved[docID] {
+			snapshot.docs[docID] = oldDoc
+			snapshot.preserved[docID] = true
+		}
+		snapshot.mu.Unlock()
+	}
+}
+
+// document returns a copy of the snapshot's version of a document. The copy is shallow
+// unless deep is set, which is enough for the caller to own it: the stored document may
+// be modified in place once the snapshot has moved on to other documents.
+func (s *collectionSnapshot) document(docID string, deep bool) (domain.Document, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	doc, exists := s.docs[docID]
+	if !exists {
+		return nil, false
+	}
+	if deep {
+		return CopyDocument(doc), true
+	}
+	return shallowCopyDocument(doc), true
+}
+
+// shallowCopyDocument copies a document's top-level fields
+func shallowCopyDocument(doc domain.Document) domain.Document {
+	copied := make(domain.Document, len(doc))
+	for key, value := range doc {
+		copied[key] = value
+	}
+	return copied
+}
+
+// openSnapshots returns the number of snapshots currently open, for memory stats
+func (se *StorageEngine) openSnapshots() int {
+	se.snapshotsMu.RLock()
+	defer se.snapshotsMu.RUnlock()
+	count := 0
+	for _, snapshots := range se.snapshots {
+		count += len(snapshots)
+	}
+	return count
+}
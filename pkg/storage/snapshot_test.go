@@ -0,0 +1,80 @@
+package storage
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/adfharrison1/go-db/pkg/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStorageEngine_SnapshotRead(t *testing.T) {
+	for name, noSaves := range map[string]bool{"no-saves": true, "dual-write": false} {
+		t.Run(name, func(t *testing.T) {
+			engine := NewStorageEngine(WithNoSaves(noSaves), WithDataDir(t.TempDir()), WithSnapshotRead(true))
+			defer engine.StopBackgroundWorkers()
+
+			// Several stream batches, so most documents are read after the writes below
+			docs := make([]domain.Document, 3*streamBatchSize)
+			for i := range docs {
+				docs[i] = domain.Document{"n": i, "version": 1}
+			}
+			inserted, err := engine.BatchInsert("items", docs)
+			require.NoError(t, err)
+
+			stream, err := engine.FindAllStream("items", nil)
+			require.NoError(t, err)
+			<-stream
+			assert.Equal(t, 1, engine.GetMemoryStats()["open_snapshots"])
+
+			for _, doc := range inserted {
+				_, err := engine.UpdateById("items", doc["_id"].(string), domain.Document{"version": 2})
+				require.NoError(t, err)
+			}
+			require.NoError(t, engine.DeleteById("items", inserted[len(inserted)-1]["_id"].(string)))
+			_, err = engine.Insert("items", domain.Document{"version": 2})
+			require.NoError(t, err)
+
+			count := 1
+			for doc := range stream {
+				assert.Equal(t, 1, doc["version"], "document %v read after the snapshot was taken", doc["_id"])
+				count++
+			}
+			assert.Equal(t, len(docs), count)
+			assert.Equal(t, 0, engine.GetMemoryStats()["open_snapshots"])
+
+			// The collection itself has the new versions
+			doc, err := engine.GetById("items", inserted[0]["_id"].(string))
+			require.NoError(t, err)
+			assert.Equal(t, 2, doc["version"])
+		})
+	}
+}
+
+func TestStorageEngine_SnapshotReadFilter(t *testing.T) {
+	engine := NewStorageEngine(WithNoSaves(true), WithSnapshotRead(true))
+	defer engine.StopBackgroundWorkers()
+
+	for i := 0; i < 600; i++ {
+		_, err := engine.Insert("users", domain.Document{"name": fmt.Sprintf("user%d", i), "active": true})
+		require.NoError(t, err)
+	}
+	require.NoError(t, engine.CreateIndex("users", "active"))
+
+	stream, err := engine.FindAllStream("users", map[string]interface{}{"active": true})
+	require.NoError(t, err)
+	<-stream
+
+	// Deactivating documents does not drop them from a snapshot that matched them
+	for i := 1; i <= 600; i++ {
+		_, err := engine.UpdateById("users", fmt.Sprint(i), domain.Document{"active": false})
+		require.NoError(t, err)
+	}
+
+	count := 1
+	for range stream {
+		count++
+	}
+	assert.Equal(t, 600, count)
+}
@@ -0,0 +1,54 @@
+package storage
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/adfharrison1/go-db/pkg/domain"
+)
+
+// sortEntry is a document with the value it is sorted by
+type sortEntry struct {
+	doc     domain.Document
+	id      string
+	value   interface{}
+	present bool
+}
+
+// SortDocuments sorts documents by a field, ascending unless desc. Values are ordered
+// by CompareValuesCollated: numbers numerically, times chronologically and other
+// strings lexically under collation. A dotted field path sorts by the first value it names. Documents
+// without the field, or holding null, come last in either direction. Values that
+// cannot be ordered against each other, such as a number and a string, are grouped
+// by type, and ties keep _id order, so pages of a sorted result are stable.
+func SortDocuments(docs []domain.Document, field string, desc bool, collation string) {
+	entries := make([]sortEntry, len(docs))
+	for i, doc := range docs {
+		entry := sortEntry{doc: doc, id: documentID(doc)}
+		if values := presentFieldValues(doc, field); len(values) > 0 && values[0] != nil {
+			entry.value, entry.present = values[0], true
+		}
+		entries[i] = entry
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+		if a.present != b.present {
+			return a.present
+		}
+		if a.present {
+			cmp, ok := CompareValuesCollated(a.value, b.value, collation)
+			if !ok {
+				cmp = strings.Compare(FieldTypeName(a.value), FieldTypeName(b.value))
+			}
+			if cmp != 0 {
+				return (cmp < 0) != desc
+			}
+		}
+		return a.id < b.id
+	})
+
+	for i, entry := range entries {
+		docs[i] = entry.doc
+	}
+}
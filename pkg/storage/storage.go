@@ -1,7 +1,13 @@
 package storage
 
 import (
+	"context"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/adfharrison1/go-db/pkg/domain"
@@ -10,8 +16,25 @@ import (
 
 // CollectionLock provides per-collection concurrency control
 type CollectionLock struct {
-	mu     sync.RWMutex
-	saving bool // Track if collection is being saved
+	mu        sync.RWMutex
+	saving    bool         // Track if collection is being saved
+	counters  LockCounters // Holders of and waiters for mu
+	documents LockCounters // Holders of and waiters for the collection's document locks
+
+	// uniqueIndexes is read-locked by writers holding only a document lock while they
+	// check for unique indexes, and write-locked while one is created
+	uniqueIndexes sync.RWMutex
+}
+
+// diskWriteStats tracks background disk write queue activity
+type diskWriteStats struct {
+	queued             int64 // Writes added to the queue
+	coalesced          int64 // Writes merged into an already pending collection save
+	retrySaves         int64 // Collection saves attempted by the retry worker
+	dropped            int64 // Writes given up on (queue full or retries exhausted)
+	pendingCollections int64 // Collections currently awaiting a retry save
+	bytesWritten       int64 // Bytes written to collection files and delta logs
+	saves              int64 // Completed writes to collection files and delta logs
 }
 
 // DiskWriteRequest represents a failed disk write that needs retry
@@ -21,6 +44,7 @@ type DiskWriteRequest struct {
 	Document   domain.Document
 	RetryCount int
 	Timestamp  time.Time
+	RequestID  string // ID of the API request that made the write, if any
 }
 
 // StorageEngine provides memory management with LRU caching and lazy loading
@@ -42,37 +66,148 @@ type StorageEngine struct {
 	// Configuration
 	maxMemoryMB int
 	dataDir     string
-	dataFile    string // Current data file for single-file persistence
-	noSaves     bool   // If true, only save on shutdown
+	dataFile    string        // Current data file for single-file persistence
+	layout      StorageLayout // On-disk layout used by saves and lazy loads
+	noSaves     bool          // If true, only save on shutdown
+	tempDir     string        // Where saves stage temporary files ("" = next to the target)
+
+	// Maintain _created_at and _updated_at on inserts, updates and replaces
+	autoTimestamps bool
+
+	// Maintain _version on inserts, updates and replaces
+	documentVersions bool
+
+	// Return deep copies of stored documents from reads
+	copyOnRead bool
+
+	// Streams read from a copy-on-write snapshot taken when they start
+	snapshotRead bool
+	snapshots    map[string]map[*collectionSnapshot]struct{} // Open snapshots per collection
+	snapshotsMu  sync.RWMutex
+
+	// Serializes read-modify-write cycles of the single-file data file
+	singleFileMu sync.Mutex
+
+	// Allowed-character pattern for collection names (nil = DefaultCollectionNamePattern)
+	collectionNamePattern *regexp.Regexp
+
+	// Maximum number of collections (0 = unlimited)
+	maxCollections int
+
+	// Maximum number of documents a FindAll may match before pagination (0 = unlimited)
+	maxResultSize int
+
+	// Delta log: updates append changed fields instead of rewriting collection files
+	deltaLog              bool
+	deltaCompactInterval  time.Duration
+	deltaCompactThreshold int
+	deltaLocks            map[string]*sync.Mutex // Serializes base and delta file writes per collection
+	deltaCounts           map[string]int         // Delta records not yet compacted
+	deltaMu               sync.Mutex             // protects deltaLocks and deltaCounts
+
+	// Tombstone deletes: deletes append a tombstone to the delta log instead of rewriting collection files
+	tombstoneDeletes bool
+
+	// Periodic compaction of collections whose files outgrow their live data
+	compaction compactionState
 
 	// Background workers
 	backgroundWg sync.WaitGroup
 	stopChan     chan struct{}
 	stopOnce     sync.Once
 
+	// Bounds the collections written at once by background saves
+	savePool *savePool
+
+	// Coalesces immediate document saves of the dual-write path (window 0 = off)
+	writeBuffer writeBuffer
+
 	// Disk write queue for failed immediate writes
-	diskWriteQueue chan DiskWriteRequest
-	diskWriteWg    sync.WaitGroup
+	diskWriteQueue     chan DiskWriteRequest
+	diskWriteWg        sync.WaitGroup
+	diskWriteStats     diskWriteStats
+	diskRetryBaseDelay time.Duration
 
 	// Per-collection ID counters for thread-safe ID generation
 	idCounters   map[string]*int64
 	idCountersMu sync.RWMutex
+
+	// Per-collection default filters ANDed into queries (e.g. soft deletes)
+	defaultFilters   map[string]map[string]interface{}
+	defaultFiltersMu sync.RWMutex
+
+	// Per-collection field defaults applied on insert
+	documentDefaults   map[string]domain.Document
+	documentDefaultsMu sync.RWMutex
+
+	// Per-collection field type hints used by filters, and which of them are strict
+	schemas       map[string]map[string]domain.FieldType
+	strictSchemas map[string]bool
+	schemasMu     sync.RWMutex
+
+	// Per-collection caps with their eviction order
+	capped   map[string]*CappedTracker
+	cappedMu sync.RWMutex
+
+	// Collections whose documents are kept in a CompactStore
+	compact   map[string]bool
+	compactMu sync.RWMutex
+
+	// Sorted document IDs for next/previous navigation, built on first use
+	idKeysets *IDKeysets
+
+	// Per-collection bound on concurrent writes (nil = unlimited)
+	writeLimiter *WriteLimiter
+
+	// Collections loaded eagerly at startup (nil = none)
+	preloader *Preloader
+
+	// Collections pinned in the cache by WithPinnedCollections
+	pinnedCollections []string
+
+	// Recent writes per collection for polling clients (nil = disabled)
+	changeLog *ChangeLog
+
+	// Document IDs per collection in insertion order (nil = not tracked)
+	insertionOrder *InsertionOrder
 }
 
 // NewStorageEngine creates a new storage engine
 func NewStorageEngine(options ...StorageOption) *StorageEngine {
 	engine := &StorageEngine{
-		collections:     make(map[string]*CollectionInfo),
-		indexEngine:     indexing.NewIndexEngine(),
-		metadata:        make(map[string]interface{}),
-		collectionLocks: make(map[string]*CollectionLock),
-		documentLocks:   make(map[string]*sync.RWMutex),
-		idCounters:      make(map[string]*int64),
-		maxMemoryMB:     1024, // 1GB default
-		dataDir:         ".",
-		noSaves:         false, // Default to dual-write mode
-		stopChan:        make(chan struct{}),
-		diskWriteQueue:  make(chan DiskWriteRequest, 1000), // Buffer for failed writes
+		collections:        make(map[string]*CollectionInfo),
+		indexEngine:        indexing.NewIndexEngine(),
+		metadata:           make(map[string]interface{}),
+		collectionLocks:    make(map[string]*CollectionLock),
+		documentLocks:      make(map[string]*sync.RWMutex),
+		idCounters:         make(map[string]*int64),
+		defaultFilters:     make(map[string]map[string]interface{}),
+		documentDefaults:   make(map[string]domain.Document),
+		schemas:            make(map[string]map[string]domain.FieldType),
+		strictSchemas:      make(map[string]bool),
+		capped:             make(map[string]*CappedTracker),
+		compact:            make(map[string]bool),
+		snapshots:          make(map[string]map[*collectionSnapshot]struct{}),
+		idKeysets:          NewIDKeysets(),
+		changeLog:          NewChangeLog(DefaultChangeLogSize),
+		deltaLocks:         make(map[string]*sync.Mutex),
+		deltaCounts:        make(map[string]int),
+		maxMemoryMB:        1024, // 1GB default
+		dataDir:            ".",
+		noSaves:            false, // Default to dual-write mode
+		stopChan:           make(chan struct{}),
+		diskWriteQueue:     make(chan DiskWriteRequest, 1000), // Buffer for failed writes
+		diskRetryBaseDelay: time.Second,
+		savePool:           newSavePool(DefaultSaveConcurrency),
+
+		deltaCompactInterval:  DefaultDeltaCompactionInterval,
+		deltaCompactThreshold: DefaultDeltaCompactionThreshold,
+
+		compaction: compactionState{
+			ratio:    DefaultCompactionRatio,
+			minBytes: DefaultCompactionMinBytes,
+			stats:    make(map[string]*CompactionStats),
+		},
 	}
 
 	// Apply options
@@ -81,11 +216,24 @@ func NewStorageEngine(options ...StorageOption) *StorageEngine {
 	}
 
 	// Initialize cache with capacity based on max memory
-	engine.cache = NewLRUCache(engine.maxMemoryMB / 100) // Rough estimate: 100MB per collection
+	engine.cache = NewLRUCache(MaxMemoryCacheCapacity(engine.maxMemoryMB))
+	for _, collName := range engine.pinnedCollections {
+		engine.cache.Pin(collName)
+	}
 
 	// Start disk write queue processing
 	engine.startDiskWriteQueue()
 
+	// Start delta log compaction, which also purges tombstoned documents
+	if (engine.deltaLogEnabled() || engine.tombstonesEnabled()) && !engine.noSaves {
+		engine.startDeltaCompaction()
+	}
+
+	// Start compaction of bloated collection files
+	if engine.compactionEnabled() {
+		engine.startCompaction()
+	}
+
 	return engine
 }
 
@@ -115,16 +263,16 @@ func (se *StorageEngine) getOrCreateCollectionLock(collName string) *CollectionL
 // withCollectionReadLock executes a function with a read lock on the specified collection
 func (se *StorageEngine) withCollectionReadLock(collName string, fn func() error) error {
 	lock := se.getOrCreateCollectionLock(collName)
-	lock.mu.RLock()
-	defer lock.mu.RUnlock()
+	lock.counters.RLock(&lock.mu)
+	defer lock.counters.RUnlock(&lock.mu)
 	return fn()
 }
 
 // withCollectionWriteLock executes a function with a write lock on the specified collection
 func (se *StorageEngine) withCollectionWriteLock(collName string, fn func() error) error {
 	lock := se.getOrCreateCollectionLock(collName)
-	lock.mu.Lock()
-	defer lock.mu.Unlock()
+	lock.counters.Lock(&lock.mu)
+	defer lock.counters.Unlock(&lock.mu)
 	return fn()
 }
 
@@ -153,19 +301,30 @@ func (se *StorageEngine) getOrCreateDocumentLock(collName, docID string) *sync.R
 	return lock
 }
 
+// existingDocumentLock returns the lock of the specified document, or nil if none was
+// created. A document is only written holding its lock, so a document without one
+// has no writer to wait for.
+func (se *StorageEngine) existingDocumentLock(collName, docID string) *sync.RWMutex {
+	se.docLocksMu.RLock()
+	defer se.docLocksMu.RUnlock()
+	return se.documentLocks[collName+":"+docID]
+}
+
 // withDocumentReadLock executes a function with a read lock on the specified document
 func (se *StorageEngine) withDocumentReadLock(collName, docID string, fn func() error) error {
 	lock := se.getOrCreateDocumentLock(collName, docID)
-	lock.RLock()
-	defer lock.RUnlock()
+	counters := &se.getOrCreateCollectionLock(collName).documents
+	counters.RLock(lock)
+	defer counters.RUnlock(lock)
 	return fn()
 }
 
 // withDocumentWriteLock executes a function with a write lock on the specified document
 func (se *StorageEngine) withDocumentWriteLock(collName, docID string, fn func() error) error {
 	lock := se.getOrCreateDocumentLock(collName, docID)
-	lock.Lock()
-	defer lock.Unlock()
+	counters := &se.getOrCreateCollectionLock(collName).documents
+	counters.Lock(lock)
+	defer counters.Unlock(lock)
 	return fn()
 }
 
@@ -178,8 +337,10 @@ func (se *StorageEngine) SaveCollectionAfterTransaction(collName string) error {
 	// Use collection write lock to prevent concurrent modifications during save
 	return se.withCollectionWriteLock(collName, func() error {
 		// Only save if the collection is dirty
+		se.mu.RLock()
 		collInfo, exists := se.collections[collName]
-		if !exists || collInfo.State != CollectionStateDirty {
+		se.mu.RUnlock()
+		if !exists || collInfo.currentState() != CollectionStateDirty {
 			return nil // Collection doesn't exist or isn't dirty
 		}
 
@@ -187,75 +348,235 @@ func (se *StorageEngine) SaveCollectionAfterTransaction(collName string) error {
 	})
 }
 
-// startDiskWriteQueue starts the background goroutine to process failed disk writes
+const (
+	// maxDiskWriteRetries is the number of save attempts made for a queued collection
+	maxDiskWriteRetries = 3
+
+	// shutdownRetryDelay is the pause between save attempts when flushing on shutdown
+	shutdownRetryDelay = 100 * time.Millisecond
+
+	// maxPendingRequestIDs bounds the request IDs remembered per pending collection for logging
+	maxPendingRequestIDs = 8
+)
+
+// pendingDiskWrite is a collection awaiting a retry save
+type pendingDiskWrite struct {
+	retries    int
+	requestIDs []string // Requests whose writes the save covers, for log correlation
+}
+
+// startDiskWriteQueue starts the background goroutine to process failed disk writes.
+// Queued writes are coalesced by collection: each retry cycle performs a single
+// collection save per collection instead of replaying every queued document write.
 func (se *StorageEngine) startDiskWriteQueue() {
 	se.diskWriteWg.Add(1)
 	go func() {
 		defer se.diskWriteWg.Done()
-		for req := range se.diskWriteQueue {
-			se.processDiskWriteRequest(req)
+
+		// Collections awaiting a retry save, keyed by name
+		pending := make(map[string]*pendingDiskWrite)
+
+		for {
+			if len(pending) == 0 {
+				req, ok := <-se.diskWriteQueue
+				if !ok {
+					se.flushDiskWrites(pending)
+					return
+				}
+				se.addPendingDiskWrite(pending, req)
+			}
+
+			if !se.waitForDiskRetry(pending) {
+				se.flushDiskWrites(pending)
+				return
+			}
+
+			// Collect everything queued during the backoff so bursts collapse into one save
+			if !se.drainDiskWriteQueue(pending) {
+				se.flushDiskWrites(pending)
+				return
+			}
+
+			se.retryPendingDiskWrites(pending)
 		}
 	}()
 }
 
-// processDiskWriteRequest processes a failed disk write with retry logic
-func (se *StorageEngine) processDiskWriteRequest(req DiskWriteRequest) {
-	maxRetries := 3
-	baseDelay := time.Second
-
-	if req.RetryCount >= maxRetries {
-		// Log final failure and give up
-		// In a real implementation, you might want to persist this to a dead letter queue
+// flushDiskWrites synchronously saves every pending and still-queued collection when
+// the engine stops, so queued writes are not lost on shutdown. Each collection gets up to
+// maxDiskWriteRetries attempts, a short fixed pause apart rather than the usual backoff;
+// any that still fail are logged. The queue must already be closed.
+func (se *StorageEngine) flushDiskWrites(pending map[string]*pendingDiskWrite) {
+	for req := range se.diskWriteQueue {
+		se.addPendingDiskWrite(pending, req)
+	}
+	if len(pending) == 0 {
 		return
 	}
 
+	log.Printf("INFO: Flushing %d pending disk writes before shutdown", len(pending))
+	for collName, write := range pending {
+		var err error
+		for attempt := 1; attempt <= maxDiskWriteRetries; attempt++ {
+			atomic.AddInt64(&se.diskWriteStats.retrySaves, 1)
+			if err = se.saveCollectionToFile(collName); err == nil {
+				break
+			}
+			if attempt < maxDiskWriteRetries {
+				time.Sleep(shutdownRetryDelay)
+			}
+		}
+		if err != nil {
+			log.Printf("ERROR: Collection %s could not be persisted at shutdown after %d attempts: %v%s", collName, maxDiskWriteRetries, err, requestIDsSuffix(write.requestIDs))
+			atomic.AddInt64(&se.diskWriteStats.dropped, 1)
+		}
+		delete(pending, collName)
+	}
+
+	atomic.StoreInt64(&se.diskWriteStats.pendingCollections, 0)
+}
+
+// addPendingDiskWrite records a queued write against its collection
+func (se *StorageEngine) addPendingDiskWrite(pending map[string]*pendingDiskWrite, req DiskWriteRequest) {
+	write, exists := pending[req.Collection]
+	if exists {
+		atomic.AddInt64(&se.diskWriteStats.coalesced, 1)
+		if req.RetryCount < write.retries {
+			write.retries = req.RetryCount
+		}
+	} else {
+		write = &pendingDiskWrite{retries: req.RetryCount}
+		pending[req.Collection] = write
+	}
+	if req.RequestID != "" && len(write.requestIDs) < maxPendingRequestIDs {
+		write.requestIDs = append(write.requestIDs, req.RequestID)
+	}
+	atomic.StoreInt64(&se.diskWriteStats.pendingCollections, int64(len(pending)))
+}
+
+// drainDiskWriteQueue moves all currently queued writes into pending without blocking.
+// Returns false if the queue has been closed.
+func (se *StorageEngine) drainDiskWriteQueue(pending map[string]*pendingDiskWrite) bool {
+	for {
+		select {
+		case req, ok := <-se.diskWriteQueue:
+			if !ok {
+				return false
+			}
+			se.addPendingDiskWrite(pending, req)
+		default:
+			return true
+		}
+	}
+}
+
+// waitForDiskRetry sleeps for the backoff of the least-retried pending collection.
+// Returns false if the engine is stopping.
+func (se *StorageEngine) waitForDiskRetry(pending map[string]*pendingDiskWrite) bool {
+	minRetries := -1
+	for _, write := range pending {
+		if minRetries < 0 || write.retries < minRetries {
+			minRetries = write.retries
+		}
+	}
+
 	// Exponential backoff with interruptible sleep
-	delay := time.Duration(req.RetryCount+1) * baseDelay
+	delay := time.Duration(minRetries+1) * se.diskRetryBaseDelay
 	select {
 	case <-time.After(delay):
-		// Delay completed
+		return true
 	case <-se.stopChan:
-		// Stop requested, exit
-		return
+		return false
 	}
+}
 
-	// Retry the disk write
-	if err := se.saveDocumentToDisk(req.Collection, req.DocumentID, req.Document); err != nil {
-		// Still failed, increment retry count and requeue
-		req.RetryCount++
-		select {
-		case se.diskWriteQueue <- req:
-			// Successfully requeued
-		case <-se.stopChan:
-			// Stop requested, exit
-			return
-		default:
-			// Queue is full, log error
-			// In a real implementation, you might want to persist this to a dead letter queue
+// retryPendingDiskWrites saves each pending collection once, keeping failures for the next cycle
+func (se *StorageEngine) retryPendingDiskWrites(pending map[string]*pendingDiskWrite) {
+	for collName, write := range pending {
+		atomic.AddInt64(&se.diskWriteStats.retrySaves, 1)
+
+		if err := se.saveThrottled(collName); err != nil {
+			write.retries++
+			if write.retries >= maxDiskWriteRetries {
+				// Give up on this collection; it stays dirty for the next full save
+				log.Printf("ERROR: Giving up on background save of collection %s after %d attempts: %v%s", collName, write.retries, err, requestIDsSuffix(write.requestIDs))
+				atomic.AddInt64(&se.diskWriteStats.dropped, 1)
+				delete(pending, collName)
+				continue
+			}
+			continue
 		}
+
+		log.Printf("DEBUG: Background save of collection %s succeeded after %d failed attempts%s", collName, write.retries+1, requestIDsSuffix(write.requestIDs))
+		delete(pending, collName)
 	}
-	// If successful, the request is automatically removed from the queue
+
+	atomic.StoreInt64(&se.diskWriteStats.pendingCollections, int64(len(pending)))
 }
 
 // queueDiskWrite queues a failed disk write for background retry
 func (se *StorageEngine) queueDiskWrite(collection, docID string, doc domain.Document) {
+	se.queueDiskWriteContext(context.Background(), collection, docID, doc)
+}
+
+// queueDiskWriteContext queues a failed disk write for background retry, tagged with
+// the request ID carried by ctx so retry logs can name the originating request
+func (se *StorageEngine) queueDiskWriteContext(ctx context.Context, collection, docID string, doc domain.Document) {
 	req := DiskWriteRequest{
 		Collection: collection,
 		DocumentID: docID,
 		Document:   doc,
 		RetryCount: 0,
 		Timestamp:  time.Now(),
+		RequestID:  domain.RequestID(ctx),
 	}
 
 	select {
 	case se.diskWriteQueue <- req:
-		// Successfully queued
+		atomic.AddInt64(&se.diskWriteStats.queued, 1)
 	default:
-		// Queue is full, log error
-		// In a real implementation, you might want to persist this to a dead letter queue
+		// Queue is full; the collection stays dirty and is persisted by the next full save
+		atomic.AddInt64(&se.diskWriteStats.dropped, 1)
 	}
 }
 
+// requestIDsSuffix formats request IDs for appending to a log line
+func requestIDsSuffix(requestIDs []string) string {
+	if len(requestIDs) == 0 {
+		return ""
+	}
+	return fmt.Sprintf(" (requests: %s)", strings.Join(requestIDs, ", "))
+}
+
+// getDiskWriteStats returns background disk write queue statistics
+func (se *StorageEngine) getDiskWriteStats() map[string]interface{} {
+	return map[string]interface{}{
+		"queue_depth":         len(se.diskWriteQueue),
+		"queue_capacity":      cap(se.diskWriteQueue),
+		"pending_collections": atomic.LoadInt64(&se.diskWriteStats.pendingCollections),
+		"queued":              atomic.LoadInt64(&se.diskWriteStats.queued),
+		"coalesced":           atomic.LoadInt64(&se.diskWriteStats.coalesced),
+		"retry_saves":         atomic.LoadInt64(&se.diskWriteStats.retrySaves),
+		"dropped":             atomic.LoadInt64(&se.diskWriteStats.dropped),
+		"bytes_written":       atomic.LoadInt64(&se.diskWriteStats.bytesWritten),
+		"saves":               atomic.LoadInt64(&se.diskWriteStats.saves),
+	}
+}
+
+// recordDiskWrite counts a completed write of size bytes to a collection file or delta log
+func (se *StorageEngine) recordDiskWrite(size int64) {
+	atomic.AddInt64(&se.diskWriteStats.bytesWritten, size)
+	atomic.AddInt64(&se.diskWriteStats.saves, 1)
+}
+
+// AppliedOffset returns the save generation: the number of writes to collection files
+// and delta logs completed so far. It only grows, so a client holding the value from
+// one response can require a later server state to include everything saved by then.
+// In no-saves mode it only moves on checkpoints and shutdown.
+func (se *StorageEngine) AppliedOffset() int64 {
+	return atomic.LoadInt64(&se.diskWriteStats.saves)
+}
+
 // IsNoSavesEnabled returns whether no-saves mode is enabled
 func (se *StorageEngine) IsNoSavesEnabled() bool {
 	se.mu.RLock()
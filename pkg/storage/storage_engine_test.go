@@ -1,6 +1,7 @@
 package storage
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -419,6 +420,30 @@ func TestStorageEngine_DeleteById(t *testing.T) {
 	assert.Contains(t, err.Error(), "does not exist")
 }
 
+func TestStorageEngine_DeleteByIdReturning(t *testing.T) {
+	engine := NewStorageEngine(WithNoSaves(true))
+	defer engine.StopBackgroundWorkers()
+
+	_, err := engine.Insert("users", domain.Document{"name": "Alice", "city": "Paris"})
+	require.NoError(t, err)
+	require.NoError(t, engine.CreateIndex("users", "city"))
+
+	deleted, err := engine.DeleteByIdReturning("users", "1")
+	require.NoError(t, err)
+	assert.Equal(t, domain.Document{"_id": "1", "name": "Alice", "city": "Paris"}, deleted)
+
+	_, err = engine.GetById("users", "1")
+	assert.Error(t, err)
+	ids, err := engine.FindIds("users", map[string]interface{}{"city": "Paris"})
+	require.NoError(t, err)
+	assert.Empty(t, ids, "the document is removed from indexes")
+
+	_, err = engine.DeleteByIdReturning("users", "1")
+	assert.True(t, errors.Is(err, domain.ErrDocumentNotFound), "got %v", err)
+	_, err = engine.DeleteByIdReturning("nonexistent", "1")
+	assert.True(t, errors.Is(err, domain.ErrCollectionNotFound), "got %v", err)
+}
+
 func TestStorageEngine_FindAll(t *testing.T) {
 	engine := NewStorageEngine()
 	defer engine.StopBackgroundWorkers()
@@ -3485,10 +3510,12 @@ func TestStorageEngine_IndexPersistence(t *testing.T) {
 	ageIndex, exists := engine2.indexEngine.GetIndex("users", "age")
 	require.True(t, exists)
 
-	// Query by age (use int8 to match the stored type)
-	docIDs := ageIndex.Query(int8(30))
+	// Query by age; numeric keys are normalized, so the stored int8 matches any numeric type
+	docIDs := ageIndex.Query(30)
 	assert.Len(t, docIDs, 1)
 	assert.Equal(t, "1", docIDs[0])
+	assert.Equal(t, docIDs, ageIndex.Query(int8(30)))
+	assert.Equal(t, docIDs, ageIndex.Query(30.0))
 
 	docIDs = ageIndex.Query(int8(25))
 	assert.Len(t, docIDs, 1)
@@ -3506,3 +3533,19 @@ func TestStorageEngine_IndexPersistence(t *testing.T) {
 	assert.Len(t, docIDs, 1)
 	assert.Equal(t, "2", docIDs[0])
 }
+
+func TestStorageEngine_DocumentExists(t *testing.T) {
+	engine := NewStorageEngine(WithNoSaves(true))
+	defer engine.StopBackgroundWorkers()
+
+	doc, err := engine.Insert("users", domain.Document{"name": "Alice", "deleted": true})
+	require.NoError(t, err)
+	docID := doc["_id"].(string)
+
+	assert.True(t, engine.DocumentExists("users", docID, nil))
+	assert.False(t, engine.DocumentExists("users", "missing", nil))
+	assert.False(t, engine.DocumentExists("missing", docID, nil))
+
+	assert.True(t, engine.DocumentExists("users", docID, map[string]interface{}{"name": "Alice"}))
+	assert.False(t, engine.DocumentExists("users", docID, map[string]interface{}{ExprFilterKey: "deleted != true"}))
+}
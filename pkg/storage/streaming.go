@@ -1,6 +1,8 @@
 package storage
 
 import (
+	"context"
+
 	"github.com/adfharrison1/go-db/pkg/domain"
 )
 
@@ -10,12 +12,57 @@ import (
 // NOTE: This method does NOT apply pagination - it streams ALL matching documents.
 // Use FindAll for paginated queries, or handle pagination at the API/client level.
 func (se *StorageEngine) FindAllStream(collName string, filter map[string]interface{}) (<-chan domain.Document, error) {
-	// First, check if the collection exists before starting the goroutine
+	return se.FindAllStreamContext(context.Background(), collName, filter)
+}
+
+// FindAllStreamContext is like FindAllStream but stops the scan and closes the
+// channel early once ctx is cancelled or its deadline expires. Callers can check
+// ctx.Err() after the channel closes to tell whether the results are partial.
+func (se *StorageEngine) FindAllStreamContext(ctx context.Context, collName string, filter map[string]interface{}) (<-chan domain.Document, error) {
+	if err := ValidateFilter(filter); err != nil {
+		return nil, err
+	}
+	filter = se.applyDefaultFilter(ctx, collName, filter)
+	return se.docGenerator(ctx, collName, filter)
+}
+
+// docGenerator yields matching documents for a given filter, using index optimization if possible.
+// Long streams must not hold the collection lock while a slow consumer drains them, so the
+// candidate IDs are snapshotted under the collection read lock first. Each document is then
+// looked up and matched in small batches under brief locks, so the stream never
+// iterates a map that writers are changing. Documents inserted after the snapshot are not
+// streamed; documents deleted or changed so that they no longer match are skipped.
+// With WithSnapshotRead the candidates are instead read from a snapshot opened with the
+// ID list, so the stream reflects the collection at that moment.
+func (se *StorageEngine) docGenerator(ctx context.Context, collName string, filter map[string]interface{}) (<-chan domain.Document, error) {
+	var collection *domain.Collection
+	var candidateIDs []string
+	var snapshot *collectionSnapshot
 	err := se.withCollectionReadLock(collName, func() error {
-		_, err := se.getCollectionInternal(collName)
-		return err
-	})
+		var err error
+		collection, err = se.getCollectionInternal(collName)
+		if err != nil {
+			return err
+		}
+
+		// Try to use index optimization if filter is present
+		useIndex := false
+		if len(filter) > 0 {
+			var ids []string
+			if ids, useIndex = se.optimizeWithIndexes(collName, filter); useIndex {
+				// Copied because index ID lists are modified in place by later writes
+				candidateIDs = append([]string(nil), ids...)
+			}
+		}
 
+		if !useIndex {
+			candidateIDs = collection.IDs()
+		}
+		if se.snapshotRead {
+			snapshot = se.openSnapshot(collName, collection, candidateIDs)
+		}
+		return nil
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -24,136 +71,98 @@ func (se *StorageEngine) FindAllStream(collName string, filter map[string]interf
 
 	go func() {
 		defer close(out)
+		if snapshot != nil {
+			defer se.closeSnapshot(collName, snapshot)
+		}
 
-		// Use collection read lock to safely collect all matching documents
-		err := se.withCollectionReadLock(collName, func() error {
-			collection, err := se.getCollectionInternal(collName)
-			if err != nil {
-				return err
+		for start := 0; start < len(candidateIDs); start += streamBatchSize {
+			if err := ctx.Err(); err != nil {
+				return
 			}
-
-			var candidateIDs []string
-			var useIndex bool
-
-			// Try to use index optimization if filter is present
-			if len(filter) > 0 {
-				candidateIDs, useIndex = se.optimizeWithIndexes(collName, filter)
+			end := start + streamBatchSize
+			if end > len(candidateIDs) {
+				end = len(candidateIDs)
 			}
 
-			if useIndex {
-				// Stream documents using index optimization
-				for _, docID := range candidateIDs {
-					if doc, exists := collection.Documents[docID]; exists {
-						if MatchesFilter(doc, filter) {
-							out <- doc
-						}
-					}
-				}
+			// Documents are sent outside the locks so a slow consumer never holds them
+			var docs []domain.Document
+			if snapshot != nil {
+				docs = se.snapshotReadDocuments(snapshot, collName, candidateIDs[start:end], filter)
 			} else {
-				// Stream documents using full scan
-				for _, doc := range collection.Documents {
-					if len(filter) == 0 || MatchesFilter(doc, filter) {
-						out <- doc
-					}
+				docs = se.snapshotMatchingDocuments(collection, collName, candidateIDs[start:end], filter)
+			}
+			for _, doc := range docs {
+				select {
+				case out <- doc:
+				case <-ctx.Done():
+					return
 				}
 			}
-			return nil
-		})
-
-		if err != nil {
-			// If there's an error, we can't send it through the channel
-			// The channel will be closed and the error will be lost
-			// This is a limitation of the streaming interface
 		}
 	}()
 
 	return out, nil
 }
 
-// streamGeneratorUnsafe yields matching documents for a given filter, using index optimization if possible.
-// This is the core streaming implementation that yields documents one at a time.
-// NOTE: This function assumes the caller holds the appropriate collection lock.
-func (se *StorageEngine) streamGeneratorUnsafe(collName string, filter map[string]interface{}) (<-chan domain.Document, error) {
-	out := make(chan domain.Document, 100)
-
-	collection, err := se.getCollectionInternal(collName)
-	if err != nil {
-		close(out)
-		return nil, err
-	}
-
-	go func() {
-		defer close(out)
-		var candidateIDs []string
-		var useIndex bool
-
-		// Try to use index optimization if filter is present
-		if len(filter) > 0 {
-			candidateIDs, useIndex = se.optimizeWithIndexes(collName, filter)
+// streamBatchSize is the number of documents a stream snapshots per collection lock acquisition
+const streamBatchSize = 256
+
+// snapshotMatchingDocuments returns the documents that still exist and match filter.
+// In no-saves mode every write takes the collection write lock, so the collection read lock
+// held for the batch is enough; in dual-write mode updates modify documents under their
+// document lock only, so each document is also read under its document read lock.
+func (se *StorageEngine) snapshotMatchingDocuments(collection *domain.Collection, collName string, docIDs []string, filter map[string]interface{}) []domain.Document {
+	snapshots := make([]domain.Document, 0, len(docIDs))
+	snapshot := func(docID string) error {
+		doc, exists := collection.Get(docID)
+		if exists && (len(filter) == 0 || MatchesFilter(doc, filter)) {
+			if se.copyOnRead {
+				doc = CopyDocument(doc)
+			}
+			snapshots = append(snapshots, doc)
 		}
+		return nil
+	}
 
-		if useIndex {
-			// Stream documents using index optimization
-			for _, docID := range candidateIDs {
-				if doc, exists := collection.Documents[docID]; exists {
-					if MatchesFilter(doc, filter) {
-						out <- doc
-					}
-				}
-			}
-		} else {
-			// Stream documents using full scan
-			for _, doc := range collection.Documents {
-				if len(filter) == 0 || MatchesFilter(doc, filter) {
-					out <- doc
-				}
+	se.withCollectionReadLock(collName, func() error {
+		for _, docID := range docIDs {
+			if se.noSaves {
+				snapshot(docID)
+			} else {
+				se.withDocumentReadLock(collName, docID, func() error {
+					return snapshot(docID)
+				})
 			}
 		}
-	}()
-	return out, nil
+		return nil
+	})
+	return snapshots
 }
 
-// streamGenerator yields matching documents for a given filter, using index optimization if possible.
-// This is the core streaming implementation that yields documents one at a time.
-// DEPRECATED: Use streamGeneratorUnsafe with proper locking instead.
-func (se *StorageEngine) streamGenerator(collName string, filter map[string]interface{}) (<-chan domain.Document, error) {
-	out := make(chan domain.Document, 100)
-
-	se.mu.RLock()
-	collection, err := se.getCollectionInternal(collName)
-	se.mu.RUnlock()
-	if err != nil {
-		close(out)
-		return nil, err
-	}
-
-	go func() {
-		defer close(out)
-		var candidateIDs []string
-		var useIndex bool
-
-		// Try to use index optimization if filter is present
-		if len(filter) > 0 {
-			candidateIDs, useIndex = se.optimizeWithIndexes(collName, filter)
+// snapshotReadDocuments returns copies of the snapshot's versions of docIDs that match
+// filter. Until a document is preserved the snapshot shares it with the collection, so
+// it is read under the same locks as in snapshotMatchingDocuments.
+func (se *StorageEngine) snapshotReadDocuments(snapshot *collectionSnapshot, collName string, docIDs []string, filter map[string]interface{}) []domain.Document {
+	docs := make([]domain.Document, 0, len(docIDs))
+	read := func(docID string) error {
+		doc, exists := snapshot.document(docID, se.copyOnRead)
+		if exists && (len(filter) == 0 || MatchesFilter(doc, filter)) {
+			docs = append(docs, doc)
 		}
+		return nil
+	}
 
-		if useIndex {
-			// Stream documents using index optimization
-			for _, docID := range candidateIDs {
-				if doc, exists := collection.Documents[docID]; exists {
-					if MatchesFilter(doc, filter) {
-						out <- doc
-					}
-				}
-			}
-		} else {
-			// Stream documents using full scan
-			for _, doc := range collection.Documents {
-				if len(filter) == 0 || MatchesFilter(doc, filter) {
-					out <- doc
-				}
+	se.withCollectionReadLock(collName, func() error {
+		for _, docID := range docIDs {
+			if se.noSaves {
+				read(docID)
+			} else {
+				se.withDocumentReadLock(collName, docID, func() error {
+					return read(docID)
+				})
 			}
 		}
-	}()
-	return out, nil
+		return nil
+	})
+	return docs
 }
@@ -1,6 +1,8 @@
 package storage
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"sync"
 	"testing"
@@ -304,6 +306,61 @@ func TestStorageEngine_FindAllStream_DocumentModification(t *testing.T) {
 	assert.True(t, names["Bob"])
 }
 
+func TestStorageEngine_FindAllStream_ConcurrentWrites(t *testing.T) {
+	engine := NewStorageEngine(WithNoSaves(true))
+	defer engine.StopBackgroundWorkers()
+
+	for i := 0; i < 500; i++ {
+		_, err := engine.Insert("users", domain.Document{"name": fmt.Sprintf("User%d", i), "n": i})
+		require.NoError(t, err)
+	}
+
+	docChan, err := engine.FindAllStream("users", nil)
+	require.NoError(t, err)
+	first := <-docChan
+
+	// A stalled consumer must not block writers
+	written := make(chan error, 1)
+	go func() {
+		_, err := engine.Insert("users", domain.Document{"name": "Late"})
+		written <- err
+	}()
+	select {
+	case err := <-written:
+		require.NoError(t, err)
+	case <-time.After(2 * time.Second):
+		t.Fatal("insert blocked behind an open stream")
+	}
+
+	// Documents deleted before their batch is fetched are skipped
+	for i := 2; i <= 500; i += 2 {
+		if docID := fmt.Sprintf("%d", i); docID != first["_id"] {
+			require.NoError(t, engine.DeleteById("users", docID))
+		}
+	}
+
+	// Update documents while the stream is being read
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 1; i <= 500; i += 2 {
+			_, _ = engine.UpdateById("users", fmt.Sprintf("%d", i), domain.Document{"n": -i})
+		}
+	}()
+
+	streamed := []domain.Document{first}
+	for doc := range docChan {
+		streamed = append(streamed, doc)
+	}
+	wg.Wait()
+
+	assert.Less(t, len(streamed), 500)
+	for _, doc := range streamed {
+		assert.NotEqual(t, "Late", doc["name"], "documents inserted after the snapshot are not streamed")
+	}
+}
+
 func TestStorageEngine_FindAllStream_Performance(t *testing.T) {
 	// Disable automatic saves for performance testing
 	engine := NewStorageEngine(WithNoSaves(true))
@@ -346,3 +403,58 @@ func TestStorageEngine_FindAllStream_Performance(t *testing.T) {
 	t.Logf("Streaming throughput: %.0f documents/second", throughput)
 	assert.Greater(t, throughput, 100000.0, "Throughput should be over 100k docs/sec")
 }
+
+func TestStorageEngine_FindAllStreamContext_Cancellation(t *testing.T) {
+	engine := NewStorageEngine(WithNoSaves(true))
+	defer engine.StopBackgroundWorkers()
+
+	for i := 0; i < 500; i++ {
+		_, err := engine.Insert("users", domain.Document{"name": fmt.Sprintf("User%d", i)})
+		require.NoError(t, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	docChan, err := engine.FindAllStreamContext(ctx, "users", nil)
+	require.NoError(t, err)
+
+	// Read a single document, then abandon the stream
+	<-docChan
+	cancel()
+
+	// The producer must stop and close the channel even though nobody is reading
+	done := make(chan struct{})
+	go func() {
+		for range docChan {
+		}
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("stream did not stop after context cancellation")
+	}
+
+	// The collection lock must have been released
+	_, err = engine.Insert("users", domain.Document{"name": "After"})
+	assert.NoError(t, err)
+}
+
+func TestStorageEngine_FindAllContext_Cancelled(t *testing.T) {
+	engine := NewStorageEngine(WithNoSaves(true))
+	defer engine.StopBackgroundWorkers()
+
+	_, err := engine.Insert("users", domain.Document{"name": "Alice"})
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err = engine.FindAllContext(ctx, "users", nil, nil)
+	require.Error(t, err)
+	assert.True(t, errors.Is(err, context.Canceled))
+
+	result, err := engine.FindAllContext(context.Background(), "users", nil, nil)
+	require.NoError(t, err)
+	assert.Len(t, result.Documents, 1)
+}
@@ -0,0 +1,80 @@
+package storage
+
+import (
+	"math"
+	"strings"
+	"time"
+
+	"github.com/adfharrison1/go-db/pkg/domain"
+)
+
+// ParseTime returns the instant a value holds: a time.Time, or a string in RFC 3339
+// format with any fractional-second precision and time zone offset
+func ParseTime(value interface{}) (time.Time, bool) {
+	switch v := value.(type) {
+	case time.Time:
+		return v, true
+	case string:
+		// Cheap rejection of strings that cannot be RFC 3339 before parsing
+		if len(v) < len("2006-01-02T15:04:05Z") || v[4] != '-' || (v[10] != 'T' && v[10] != 't') {
+			return time.Time{}, false
+		}
+		t, err := time.Parse(time.RFC3339Nano, v)
+		return t, err == nil
+	default:
+		return time.Time{}, false
+	}
+}
+
+// parseTimeField returns the instant a value of a time-typed field holds. Besides
+// what ParseTime accepts, numbers are read as Unix seconds.
+func parseTimeField(value interface{}) (time.Time, bool) {
+	if seconds, ok := ToFloat64(value); ok {
+		if math.IsNaN(seconds) || math.IsInf(seconds, 0) {
+			return time.Time{}, false
+		}
+		whole, frac := math.Modf(seconds)
+		return time.Unix(int64(whole), int64(frac*1e9)), true
+	}
+	return ParseTime(value)
+}
+
+// CompareValues orders two values for range comparisons, returning -1, 0 or 1. Numbers
+// compare numerically, times (see ParseTime) chronologically and other strings
+// lexically, so RFC 3339 strings with different precisions or offsets still compare by
+// the instant they name. The second result is false when the values cannot be ordered.
+func CompareValues(a, b interface{}) (int, bool) {
+	return CompareValuesCollated(a, b, "")
+}
+
+// CompareValuesCollated orders two values as CompareValues does, comparing strings
+// that are not times under a collation (see domain.PaginationOptions.Collation): by
+// byte when it is empty, or by their domain.CollationKey.
+func CompareValuesCollated(a, b interface{}, collation string) (int, bool) {
+	if an, ok := ToFloat64(a); ok {
+		if bn, ok := ToFloat64(b); ok {
+			switch {
+			case an < bn:
+				return -1, true
+			case an > bn:
+				return 1, true
+			default:
+				return 0, an == bn
+			}
+		}
+		return 0, false
+	}
+
+	if at, ok := ParseTime(a); ok {
+		if bt, ok := ParseTime(b); ok {
+			return at.Compare(bt), true
+		}
+	}
+
+	if as, ok := a.(string); ok {
+		if bs, ok := b.(string); ok {
+			return strings.Compare(domain.CollationKey(as, collation), domain.CollationKey(bs, collation)), true
+		}
+	}
+	return 0, false
+}
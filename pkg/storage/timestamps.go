@@ -0,0 +1,90 @@
+package storage
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/adfharrison1/go-db/pkg/domain"
+)
+
+// Server-managed timestamp fields maintained when auto timestamps are enabled
+const (
+	CreatedAtField = "_created_at"
+	UpdatedAtField = "_updated_at"
+)
+
+// TimestampLayout is a fixed-width RFC 3339 layout, so that auto timestamps
+// order correctly when compared as strings, e.g. in $expr filters
+const TimestampLayout = "2006-01-02T15:04:05.000000000Z07:00"
+
+// FormatTimestamp formats t in UTC using TimestampLayout
+func FormatTimestamp(t time.Time) string {
+	return t.UTC().Format(TimestampLayout)
+}
+
+// IsTimestampField reports whether field is one of the server-managed timestamp fields
+func IsTimestampField(field string) bool {
+	return field == CreatedAtField || field == UpdatedAtField
+}
+
+// stampInsert sets both timestamps on a new document, overwriting client-supplied values
+func (se *StorageEngine) stampInsert(doc domain.Document, now time.Time) {
+	if !se.autoTimestamps {
+		return
+	}
+	timestamp := FormatTimestamp(now)
+	doc[CreatedAtField] = timestamp
+	doc[UpdatedAtField] = timestamp
+}
+
+// stampUpdates returns a copy of a partial update with client-supplied timestamps
+// removed and _updated_at set to now. The stamped updates are what gets persisted,
+// so delta log replays restore the same _updated_at.
+func (se *StorageEngine) stampUpdates(updates domain.Document) domain.Document {
+	if !se.autoTimestamps {
+		return updates
+	}
+	stamped := make(domain.Document, len(updates)+1)
+	for field, value := range updates {
+		if !IsTimestampField(field) {
+			stamped[field] = value
+		}
+	}
+	stamped[UpdatedAtField] = FormatTimestamp(time.Now())
+	return stamped
+}
+
+// stampReplacement carries _created_at over from the replaced document and sets
+// _updated_at to now. Documents written before auto timestamps were enabled keep
+// no _created_at.
+func (se *StorageEngine) stampReplacement(oldDoc, newDoc domain.Document) {
+	if !se.autoTimestamps {
+		return
+	}
+	delete(newDoc, CreatedAtField)
+	if createdAt, exists := oldDoc[CreatedAtField]; exists {
+		newDoc[CreatedAtField] = createdAt
+	}
+	newDoc[UpdatedAtField] = FormatTimestamp(time.Now())
+}
+
+// AutoTimestampsEnabled reports whether the engine maintains _created_at and _updated_at
+func (se *StorageEngine) AutoTimestampsEnabled() bool {
+	return se.autoTimestamps
+}
+
+// ModifiedSince returns a copy of filter that also keeps only documents whose field,
+// an RFC 3339 modification time such as UpdatedAtField, is after since. The condition
+// is an ordinary $gt range, so an index on field answers it like any range filter.
+// A filter that already constrains field is rejected.
+func ModifiedSince(filter map[string]interface{}, field string, since time.Time) (map[string]interface{}, error) {
+	if _, exists := filter[field]; exists {
+		return nil, fmt.Errorf("%w: %s is already filtered; modification times cannot be combined with another condition on it", domain.ErrInvalidFilter, field)
+	}
+	combined := make(map[string]interface{}, len(filter)+1)
+	for key, value := range filter {
+		combined[key] = value
+	}
+	combined[field] = map[string]interface{}{GtFilterKey: FormatTimestamp(since)}
+	return combined, nil
+}
@@ -0,0 +1,117 @@
+package storage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/adfharrison1/go-db/pkg/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFormatTimestamp(t *testing.T) {
+	whole := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	fractional := whole.Add(500 * time.Millisecond)
+
+	assert.Equal(t, "2024-01-02T03:04:05.000000000Z", FormatTimestamp(whole))
+	assert.Equal(t, "2024-01-02T03:04:05.500000000Z", FormatTimestamp(fractional))
+	assert.Less(t, FormatTimestamp(whole), FormatTimestamp(fractional), "timestamps must order as strings")
+	assert.Equal(t, FormatTimestamp(whole), FormatTimestamp(whole.In(time.FixedZone("UTC+2", 2*60*60))))
+}
+
+func TestStorageEngine_AutoTimestamps(t *testing.T) {
+	engine := NewStorageEngine(WithNoSaves(true), WithAutoTimestamps(true))
+	defer engine.StopBackgroundWorkers()
+
+	// Client-supplied timestamps are ignored on insert
+	doc, err := engine.Insert("users", domain.Document{"name": "Alice", CreatedAtField: "forged"})
+	require.NoError(t, err)
+	docID := doc["_id"].(string)
+	createdAt := doc[CreatedAtField]
+	assert.NotEqual(t, "forged", createdAt)
+	assert.Equal(t, createdAt, doc[UpdatedAtField])
+
+	time.Sleep(time.Millisecond)
+	updated, err := engine.UpdateById("users", docID, domain.Document{"age": 30, CreatedAtField: "forged", UpdatedAtField: "forged"})
+	require.NoError(t, err)
+	assert.Equal(t, createdAt, updated[CreatedAtField])
+	assert.Greater(t, updated[UpdatedAtField], createdAt)
+	lastUpdate := updated[UpdatedAtField]
+
+	time.Sleep(time.Millisecond)
+	replaced, err := engine.ReplaceById("users", docID, domain.Document{"name": "Alicia", CreatedAtField: "forged"})
+	require.NoError(t, err)
+	assert.Equal(t, createdAt, replaced[CreatedAtField])
+	assert.Greater(t, replaced[UpdatedAtField], lastUpdate)
+	assert.NotContains(t, replaced, "age")
+
+	batch, err := engine.BatchInsert("users", []domain.Document{{"name": "Bob"}, {"name": "Carol", UpdatedAtField: "forged"}})
+	require.NoError(t, err)
+	for _, doc := range batch {
+		assert.NotEmpty(t, doc[CreatedAtField])
+		assert.Equal(t, doc[CreatedAtField], doc[UpdatedAtField])
+	}
+
+	time.Sleep(time.Millisecond)
+	batchUpdated, err := engine.BatchUpdate("users", []domain.BatchUpdateOperation{
+		{ID: batch[0]["_id"].(string), Updates: domain.Document{"age": 40, UpdatedAtField: "forged"}},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, batch[0][CreatedAtField], batchUpdated[0][CreatedAtField])
+	assert.Greater(t, batchUpdated[0][UpdatedAtField], batch[0][CreatedAtField])
+
+	// Recently changed documents can be found by comparing timestamps as strings
+	recent, err := engine.FindAll("users", map[string]interface{}{
+		ExprFilterKey: `_updated_at > "` + batch[1][UpdatedAtField].(string) + `"`,
+	}, nil)
+	require.NoError(t, err)
+	require.Len(t, recent.Documents, 1)
+	assert.Equal(t, batch[0]["_id"], recent.Documents[0]["_id"])
+}
+
+func TestStorageEngine_AutoTimestampsDisabledByDefault(t *testing.T) {
+	engine := NewStorageEngine(WithNoSaves(true))
+	defer engine.StopBackgroundWorkers()
+
+	doc, err := engine.Insert("users", domain.Document{"name": "Alice"})
+	require.NoError(t, err)
+	assert.NotContains(t, doc, CreatedAtField)
+	assert.NotContains(t, doc, UpdatedAtField)
+
+	updated, err := engine.UpdateById("users", doc["_id"].(string), domain.Document{UpdatedAtField: "client"})
+	require.NoError(t, err)
+	assert.Equal(t, "client", updated[UpdatedAtField])
+}
+
+func TestModifiedSince(t *testing.T) {
+	engine := NewStorageEngine(WithNoSaves(true), WithAutoTimestamps(true))
+	defer engine.StopBackgroundWorkers()
+	assert.True(t, engine.AutoTimestampsEnabled())
+
+	_, err := engine.Insert("users", domain.Document{"name": "Alice"})
+	require.NoError(t, err)
+	time.Sleep(time.Millisecond)
+	since := time.Now()
+	time.Sleep(time.Millisecond)
+	_, err = engine.Insert("users", domain.Document{"name": "Bob"})
+	require.NoError(t, err)
+
+	filter := map[string]interface{}{"name": map[string]interface{}{"$in": []interface{}{"Alice", "Bob"}}}
+	modified, err := ModifiedSince(filter, UpdatedAtField, since)
+	require.NoError(t, err)
+	assert.Len(t, filter, 1, "the caller's filter is not modified")
+
+	// The same condition is answered by a scan and by an index on the field
+	for _, indexed := range []bool{false, true} {
+		if indexed {
+			require.NoError(t, engine.CreateIndex("users", UpdatedAtField))
+		}
+		result, err := engine.FindAll("users", modified, nil)
+		require.NoError(t, err)
+		require.Len(t, result.Documents, 1)
+		assert.Equal(t, "Bob", result.Documents[0]["name"])
+	}
+
+	_, err = ModifiedSince(map[string]interface{}{UpdatedAtField: "x"}, UpdatedAtField, since)
+	assert.ErrorIs(t, err, domain.ErrInvalidFilter)
+}
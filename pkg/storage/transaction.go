@@ -0,0 +1,420 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/adfharrison1/go-db/pkg/domain"
+)
+
+// txnOpKind is the kind of write a transaction operation performs
+type txnOpKind int
+
+const (
+	txnInsert txnOpKind = iota
+	txnUpdate
+	txnDelete
+)
+
+// txnOp is one write enqueued on a transaction
+type txnOp struct {
+	kind     txnOpKind
+	collName string
+	docID    string          // Target of an update or delete
+	doc      domain.Document // Document to insert, or the partial update
+}
+
+// txnKey identifies a document across collections
+type txnKey struct {
+	collName string
+	docID    string
+}
+
+// txnUndo records how to revert one applied operation
+type txnUndo struct {
+	key      txnKey
+	original domain.Document // Version before the operation; nil for an insert
+}
+
+// Txn groups inserts, updates and deletes across collections so they are applied
+// together. Operations are only enqueued until Commit, which applies all of them or
+// none; Rollback discards them. A Txn is finished by either call and cannot be
+// reused.
+type Txn struct {
+	se   *StorageEngine
+	mu   sync.Mutex
+	ops  []txnOp
+	done bool
+}
+
+// Begin starts a transaction
+func (se *StorageEngine) Begin() *Txn {
+	return &Txn{se: se}
+}
+
+// Insert enqueues the insert of a document into a collection, creating the collection
+// if needed. The document is assigned its _id when the transaction commits.
+func (t *Txn) Insert(collName string, doc domain.Document) error {
+	return t.enqueue(txnOp{kind: txnInsert, collName: collName, doc: CopyDocument(doc)})
+}
+
+// Update enqueues a partial update of a document, as with UpdateById. Operators are
+// resolved against the document as left by the operations enqueued before it.
+func (t *Txn) Update(collName, docId string, updates domain.Document) error {
+	return t.enqueue(txnOp{kind: txnUpdate, collName: collName, docID: docId, doc: CopyDocument(updates)})
+}
+
+// Delete enqueues the delete of a document
+func (t *Txn) Delete(collName, docId string) error {
+	return t.enqueue(txnOp{kind: txnDelete, collName: collName, docID: docId})
+}
+
+// enqueue adds an operation unless the transaction has finished
+func (t *Txn) enqueue(op txnOp) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.done {
+		return domain.ErrTxnDone
+	}
+	t.ops = append(t.ops, op)
+	return nil
+}
+
+// Rollback discards the enqueued operations. It returns domain.ErrTxnDone if the
+// transaction was already committed or rolled back.
+func (t *Txn) Rollback() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.done {
+		return domain.ErrTxnDone
+	}
+	t.done = true
+	t.ops = nil
+	return nil
+}
+
+// Commit applies the enqueued operations in order and returns one document per
+// operation: the inserted or updated document, or the deleted one. See CommitContext.
+func (t *Txn) Commit() ([]domain.Document, error) {
+	return t.CommitContext(context.Background())
+}
+
+// CommitContext is like Commit; the request ID carried by ctx is attached to any
+// background retry of the collection saves. A ctx from domain.WithDurableWrite makes
+// a failed save an error.
+//
+// Every collection the transaction touches is write-locked in name order, and every
+// document it updates or deletes is write-locked in collection and ID order, so
+// concurrent commits cannot deadlock. Under those locks each operation is validated
+// against the state the operations before it leave, and nothing is applied unless
+// all of them are valid; should applying one still fail, the operations already
+// applied are reverted. Each affected collection is saved once afterwards. The
+// transaction is finished even when the commit fails.
+func (t *Txn) CommitContext(ctx context.Context) ([]domain.Document, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.done {
+		return nil, domain.ErrTxnDone
+	}
+	t.done = true
+	ops := t.ops
+	t.ops = nil
+	if len(ops) == 0 {
+		return nil, nil
+	}
+	return t.se.commitTxn(ctx, ops)
+}
+
+// commitTxn locks everything the operations touch, applies them and saves the
+// affected collections
+func (se *StorageEngine) commitTxn(ctx context.Context, ops []txnOp) ([]domain.Document, error) {
+	if err := se.checkDurable(ctx); err != nil {
+		return nil, err
+	}
+
+	collSet := make(map[string]bool)
+	docSet := make(map[txnKey]bool)
+	for _, op := range ops {
+		collSet[op.collName] = true
+		if op.kind != txnInsert {
+			docSet[txnKey{op.collName, op.docID}] = true
+		}
+	}
+	collNames := make([]string, 0, len(collSet))
+	for collName := range collSet {
+		collNames = append(collNames, collName)
+	}
+	sort.Strings(collNames)
+	docKeys := make([]txnKey, 0, len(docSet))
+	for key := range docSet {
+		docKeys = append(docKeys, key)
+	}
+	sort.Slice(docKeys, func(i, j int) bool {
+		if docKeys[i].collName != docKeys[j].collName {
+			return docKeys[i].collName < docKeys[j].collName
+		}
+		return docKeys[i].docID < docKeys[j].docID
+	})
+
+	for _, collName := range collNames {
+		release, err := se.writeLimiter.Acquire(ctx, collName)
+		if err != nil {
+			return nil, err
+		}
+		defer release()
+	}
+
+	// Defaults and timestamps are filled in outside the locks, as for single writes
+	now := time.Now()
+	for i := range ops {
+		switch ops[i].kind {
+		case txnInsert:
+			se.applyDocumentDefaults(ops[i].collName, ops[i].doc)
+			se.stampInsert(ops[i].doc, now)
+		case txnUpdate:
+			ops[i].doc = se.stampUpdates(ops[i].doc)
+		}
+	}
+
+	var results []domain.Document
+	err := se.withCollectionWriteLocks(collNames, func() error {
+		return se.withDocumentWriteLocks(docKeys, func() error {
+			resolved, err := se.validateTxnUnsafe(ops)
+			if err != nil {
+				return err
+			}
+			results, err = se.applyTxnUnsafe(ops, resolved)
+			return err
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, op := range ops {
+		if op.kind == txnDelete {
+			se.trackDelete(op.collName, op.docID)
+		}
+	}
+
+	if !se.noSaves {
+		// Several documents may have changed, so each collection is rewritten once
+		for _, collName := range collNames {
+			if saveErr := se.SaveCollectionAfterTransaction(collName); saveErr != nil {
+				if saveErr := se.persistFailed(ctx, collName, "", nil, saveErr); saveErr != nil && err == nil {
+					err = saveErr
+				}
+			}
+		}
+	}
+	return results, err
+}
+
+// validateTxnUnsafe checks every operation against the state the operations before it
+// leave, without applying any, and returns the resolved partial update of each update
+// operation (caller must hold the transaction's collection and document write locks)
+func (se *StorageEngine) validateTxnUnsafe(ops []txnOp) ([]domain.Document, error) {
+	resolved := make([]domain.Document, len(ops))
+	pending := make(map[txnKey]domain.Document) // Documents as left by earlier operations; nil once deleted
+	created := make(map[string]bool)            // Collections the transaction creates
+
+	current := func(key txnKey) (domain.Document, error) {
+		if doc, exists := pending[key]; exists {
+			if doc == nil {
+				return nil, domain.Errorf(domain.ErrDocumentNotFound, "document with id %s not found in collection %s", key.docID, key.collName)
+			}
+			return doc, nil
+		}
+		return se.getByIdUnsafe(key.collName, key.docID)
+	}
+
+	for i, op := range ops {
+		key := txnKey{op.collName, op.docID}
+		switch op.kind {
+		case txnInsert:
+			if err := se.checkStrictSchema(op.collName, op.doc); err != nil {
+				return nil, fmt.Errorf("operation %d: %w", i, err)
+			}
+			if created[op.collName] {
+				continue
+			}
+			// se.collections is guarded by se.mu, which the collection locks do not cover
+			se.mu.RLock()
+			_, err := se.getCollectionInternal(op.collName)
+			existing := len(se.collections)
+			se.mu.RUnlock()
+			if err != nil {
+				if !errors.Is(err, domain.ErrCollectionNotFound) {
+					return nil, fmt.Errorf("operation %d: %w", i, err)
+				}
+				if err := se.validateCollectionName(op.collName); err != nil {
+					return nil, fmt.Errorf("operation %d: %w", i, err)
+				}
+				if err := CheckCollectionLimit(existing+len(created), se.maxCollections); err != nil {
+					return nil, fmt.Errorf("operation %d: %w", i, err)
+				}
+				created[op.collName] = true
+			}
+
+		case txnUpdate:
+			if len(op.doc) == 0 {
+				return nil, fmt.Errorf("operation %d: no updates provided", i)
+			}
+			doc, err := current(key)
+			if err != nil {
+				return nil, fmt.Errorf("operation %d: %w", i, err)
+			}
+			update, err := se.resolveDocumentUpdate(op.docID, doc, op.doc)
+			if err != nil {
+				return nil, fmt.Errorf("operation %d: %w", i, err)
+			}
+			if err := se.checkStrictSchema(op.collName, doc, update); err != nil {
+				return nil, fmt.Errorf("operation %d: %w", i, err)
+			}
+			pending[key] = updatedDocument(doc, update)
+			resolved[i] = update
+
+		case txnDelete:
+			if _, err := current(key); err != nil {
+				return nil, fmt.Errorf("operation %d: %w", i, err)
+			}
+			pending[key] = nil
+		}
+	}
+	if err := se.checkTxnUniqueUnsafe(ops, pending); err != nil {
+		return nil, err
+	}
+	return resolved, nil
+}
+
+// checkTxnUniqueUnsafe checks the unique indexes of each collection a transaction
+// writes against the documents it leaves, pending holding those it updates or deletes
+func (se *StorageEngine) checkTxnUniqueUnsafe(ops []txnOp, pending map[txnKey]domain.Document) error {
+	ids := make(map[string][]string)
+	docs := make(map[string][]domain.Document)
+	for key, doc := range pending {
+		ids[key.collName] = append(ids[key.collName], key.docID)
+		docs[key.collName] = append(docs[key.collName], doc)
+	}
+	for i, op := range ops {
+		if op.kind == txnInsert {
+			// Inserted documents get their IDs when applied, so they stand under ones no stored document has
+			ids[op.collName] = append(ids[op.collName], fmt.Sprintf("\x00insert %d", i))
+			docs[op.collName] = append(docs[op.collName], op.doc)
+		}
+	}
+	for collName := range ids {
+		if err := se.indexEngine.CheckUnique(collName, ids[collName], docs[collName]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// applyTxnUnsafe applies validated operations, reverting the applied ones if one
+// fails (caller must hold the transaction's collection and document write locks)
+func (se *StorageEngine) applyTxnUnsafe(ops []txnOp, resolved []domain.Document) ([]domain.Document, error) {
+	results := make([]domain.Document, len(ops))
+	undo := make([]txnUndo, 0, len(ops))
+	inserted := make(map[string][]string)
+
+	for i, op := range ops {
+		var err error
+		switch op.kind {
+		case txnInsert:
+			if err = se.ensureCollectionUnsafe(op.collName); err != nil {
+				break
+			}
+			docID := fmt.Sprintf("%d", atomic.AddInt64(se.idCounter(op.collName), 1))
+			if results[i], err = se.insertDocumentUnsafe(op.collName, docID, op.doc); err != nil {
+				break
+			}
+			undo = append(undo, txnUndo{key: txnKey{op.collName, docID}})
+			inserted[op.collName] = append(inserted[op.collName], docID)
+
+		case txnUpdate:
+			var original domain.Document
+			if original, err = se.getByIdUnsafe(op.collName, op.docID); err != nil {
+				break
+			}
+			// updateByIdUnsafe modifies the stored document in place
+			original = shallowCopyDocument(original)
+			if results[i], err = se.updateByIdUnsafe(op.collName, op.docID, resolved[i]); err != nil {
+				break
+			}
+			undo = append(undo, txnUndo{key: txnKey{op.collName, op.docID}, original: original})
+
+		case txnDelete:
+			if results[i], err = se.deleteByIdUnsafe(op.collName, op.docID); err != nil {
+				break
+			}
+			undo = append(undo, txnUndo{key: txnKey{op.collName, op.docID}, original: results[i]})
+		}
+
+		if err != nil {
+			for j := len(undo) - 1; j >= 0; j-- {
+				se.revertTxnUnsafe(undo[j])
+			}
+			return nil, fmt.Errorf("operation %d: %w", i, err)
+		}
+	}
+
+	// Capped collections evict only once the whole transaction has applied
+	for collName, docIDs := range inserted {
+		se.trackInsertsUnsafe(collName, docIDs...)
+	}
+	return results, nil
+}
+
+// revertTxnUnsafe reverts one applied operation: an inserted document is deleted, and
+// an updated or deleted one is stored again as it was (caller must hold the
+// transaction's collection and document write locks)
+func (se *StorageEngine) revertTxnUnsafe(undo txnUndo) {
+	if undo.original == nil {
+		se.deleteByIdUnsafe(undo.key.collName, undo.key.docID)
+		return
+	}
+	collection, err := se.getCollectionInternal(undo.key.collName)
+	if err != nil {
+		return
+	}
+	current, exists := collection.Get(undo.key.docID)
+	if !exists {
+		current = nil
+	}
+	collection.Set(undo.key.docID, undo.original)
+	se.updateIndexes(undo.key.collName, undo.key.docID, current, undo.original)
+
+	if _, collectionInfo, found := se.cache.Get(undo.key.collName); found {
+		collectionInfo.markDirty()
+		if !exists {
+			collectionInfo.DocumentCount++
+		}
+	}
+}
+
+// withCollectionWriteLocks executes a function holding the write locks of the given
+// collections, acquired in the order given
+func (se *StorageEngine) withCollectionWriteLocks(collNames []string, fn func() error) error {
+	if len(collNames) == 0 {
+		return fn()
+	}
+	return se.withCollectionWriteLock(collNames[0], func() error {
+		return se.withCollectionWriteLocks(collNames[1:], fn)
+	})
+}
+
+// withDocumentWriteLocks executes a function holding the write locks of the given
+// documents, acquired in the order given
+func (se *StorageEngine) withDocumentWriteLocks(keys []txnKey, fn func() error) error {
+	if len(keys) == 0 {
+		return fn()
+	}
+	return se.withDocumentWriteLock(keys[0].collName, keys[0].docID, func() error {
+		return se.withDocumentWriteLocks(keys[1:], fn)
+	})
+}
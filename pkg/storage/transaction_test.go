@@ -0,0 +1,259 @@
+package storage
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/adfharrison1/go-db/pkg/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// seedAccounts inserts accounts 1 and 2 with a balance of 100 each and an index on owner
+func seedAccounts(t *testing.T, engine *StorageEngine) {
+	t.Helper()
+	for _, owner := range []string{"alice", "bob"} {
+		_, err := engine.Insert("accounts", domain.Document{"owner": owner, "balance": 100})
+		require.NoError(t, err)
+	}
+	require.NoError(t, engine.CreateIndex("accounts", "owner"))
+}
+
+func TestTxn_Commit(t *testing.T) {
+	engine := NewStorageEngine(WithNoSaves(true))
+	defer engine.StopBackgroundWorkers()
+	seedAccounts(t, engine)
+	_, err := engine.Insert("accounts", domain.Document{"owner": "carol", "balance": 0})
+	require.NoError(t, err)
+
+	txn := engine.Begin()
+	require.NoError(t, txn.Update("accounts", "1", domain.Document{IncKey: map[string]interface{}{"balance": -30}}))
+	require.NoError(t, txn.Update("accounts", "2", domain.Document{IncKey: map[string]interface{}{"balance": 30}}))
+	require.NoError(t, txn.Insert("transfers", domain.Document{"from": "1", "to": "2", "amount": 30}))
+	require.NoError(t, txn.Delete("accounts", "3"))
+	results, err := txn.Commit()
+	require.NoError(t, err)
+	require.Len(t, results, 4)
+	assert.EqualValues(t, 70, results[0]["balance"])
+	assert.EqualValues(t, 130, results[1]["balance"])
+	assert.Equal(t, "1", results[2]["_id"])
+	assert.Equal(t, "carol", results[3]["owner"])
+
+	doc, err := engine.GetById("accounts", "1")
+	require.NoError(t, err)
+	assert.EqualValues(t, 70, doc["balance"])
+	doc, err = engine.GetById("transfers", "1")
+	require.NoError(t, err)
+	assert.EqualValues(t, 30, doc["amount"])
+	_, err = engine.GetById("accounts", "3")
+	assert.ErrorIs(t, err, domain.ErrDocumentNotFound)
+
+	docs, err := engine.FindByIndex("accounts", "owner", "carol")
+	require.NoError(t, err)
+	assert.Empty(t, docs)
+
+	engine.mu.RLock()
+	assert.Equal(t, int64(2), engine.collections["accounts"].DocumentCount)
+	assert.Equal(t, int64(1), engine.collections["transfers"].DocumentCount)
+	engine.mu.RUnlock()
+}
+
+func TestTxn_OperationsSeeEarlierOperations(t *testing.T) {
+	engine := NewStorageEngine(WithNoSaves(true))
+	defer engine.StopBackgroundWorkers()
+	seedAccounts(t, engine)
+
+	txn := engine.Begin()
+	for i := 0; i < 3; i++ {
+		require.NoError(t, txn.Update("accounts", "1", domain.Document{IncKey: map[string]interface{}{"balance": 10}}))
+	}
+	require.NoError(t, txn.Update("accounts", "2", domain.Document{"owner": "robert"}))
+	require.NoError(t, txn.Delete("accounts", "2"))
+	results, err := txn.Commit()
+	require.NoError(t, err)
+	assert.EqualValues(t, 130, results[2]["balance"])
+	assert.Equal(t, "robert", results[4]["owner"])
+
+	docs, err := engine.FindByIndex("accounts", "owner", "robert")
+	require.NoError(t, err)
+	assert.Empty(t, docs)
+
+	// A document deleted earlier in the transaction cannot be updated
+	txn = engine.Begin()
+	require.NoError(t, txn.Delete("accounts", "1"))
+	require.NoError(t, txn.Update("accounts", "1", domain.Document{"balance": 0}))
+	_, err = txn.Commit()
+	assert.ErrorIs(t, err, domain.ErrDocumentNotFound)
+	_, err = engine.GetById("accounts", "1")
+	assert.NoError(t, err)
+}
+
+func TestTxn_AllOrNothing(t *testing.T) {
+	engine := NewStorageEngine(WithNoSaves(true))
+	defer engine.StopBackgroundWorkers()
+	seedAccounts(t, engine)
+
+	for name, bad := range map[string]func(txn *Txn) error{
+		"missing document": func(txn *Txn) error { return txn.Delete("accounts", "9") },
+		"invalid operator": func(txn *Txn) error {
+			return txn.Update("accounts", "2", domain.Document{IncKey: map[string]interface{}{"balance": "ten"}})
+		},
+		"invalid collection name": func(txn *Txn) error { return txn.Insert("bad/name", domain.Document{"x": 1}) },
+	} {
+		t.Run(name, func(t *testing.T) {
+			txn := engine.Begin()
+			require.NoError(t, txn.Update("accounts", "1", domain.Document{"owner": "mallory"}))
+			require.NoError(t, txn.Insert("transfers", domain.Document{"amount": 30}))
+			require.NoError(t, txn.Delete("accounts", "2"))
+			require.NoError(t, bad(txn))
+			_, err := txn.Commit()
+			require.Error(t, err)
+
+			doc, err := engine.GetById("accounts", "1")
+			require.NoError(t, err)
+			assert.Equal(t, "alice", doc["owner"])
+			_, err = engine.GetById("accounts", "2")
+			assert.NoError(t, err)
+			_, err = engine.GetById("transfers", "1")
+			assert.ErrorIs(t, err, domain.ErrCollectionNotFound)
+			docs, err := engine.FindByIndex("accounts", "owner", "mallory")
+			require.NoError(t, err)
+			assert.Empty(t, docs)
+		})
+	}
+}
+
+func TestTxn_RevertsAppliedOperations(t *testing.T) {
+	engine := NewStorageEngine(WithNoSaves(true))
+	defer engine.StopBackgroundWorkers()
+	seedAccounts(t, engine)
+
+	// Applying fails at the last operation, which validation would have rejected
+	ops := []txnOp{
+		{kind: txnUpdate, collName: "accounts", docID: "1", doc: domain.Document{"owner": "mallory"}},
+		{kind: txnDelete, collName: "accounts", docID: "2"},
+		{kind: txnInsert, collName: "accounts", doc: domain.Document{"owner": "dave"}},
+		{kind: txnDelete, collName: "accounts", docID: "9"},
+	}
+	resolved := []domain.Document{ops[0].doc, nil, nil, nil}
+	var err error
+	engine.withCollectionWriteLock("accounts", func() error {
+		_, err = engine.applyTxnUnsafe(ops, resolved)
+		return nil
+	})
+	assert.ErrorIs(t, err, domain.ErrDocumentNotFound)
+
+	ids, err := engine.FindIds("accounts", map[string]interface{}{})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"1", "2"}, ids)
+	for owner, want := range map[string]int{"alice": 1, "bob": 1, "mallory": 0, "dave": 0} {
+		docs, err := engine.FindByIndex("accounts", "owner", owner)
+		require.NoError(t, err)
+		assert.Len(t, docs, want, owner)
+	}
+	engine.mu.RLock()
+	assert.Equal(t, int64(2), engine.collections["accounts"].DocumentCount)
+	engine.mu.RUnlock()
+}
+
+func TestTxn_Finished(t *testing.T) {
+	engine := NewStorageEngine(WithNoSaves(true))
+	defer engine.StopBackgroundWorkers()
+	seedAccounts(t, engine)
+
+	txn := engine.Begin()
+	require.NoError(t, txn.Delete("accounts", "1"))
+	require.NoError(t, txn.Rollback())
+	_, err := engine.GetById("accounts", "1")
+	assert.NoError(t, err)
+
+	assert.ErrorIs(t, txn.Rollback(), domain.ErrTxnDone)
+	assert.ErrorIs(t, txn.Delete("accounts", "1"), domain.ErrTxnDone)
+	_, err = txn.Commit()
+	assert.ErrorIs(t, err, domain.ErrTxnDone)
+
+	// Committing finishes the transaction too, whether or not it succeeds
+	txn = engine.Begin()
+	results, err := txn.Commit()
+	require.NoError(t, err)
+	assert.Empty(t, results)
+	_, err = txn.Commit()
+	assert.ErrorIs(t, err, domain.ErrTxnDone)
+}
+
+func TestTxn_ConcurrentCommits(t *testing.T) {
+	engine := NewStorageEngine(WithNoSaves(true))
+	defer engine.StopBackgroundWorkers()
+	for _, collName := range []string{"checking", "savings"} {
+		_, err := engine.Insert(collName, domain.Document{"balance": 1000})
+		require.NoError(t, err)
+	}
+
+	// Transfers in both directions lock the same collections, named in either order
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		from, to := "checking", "savings"
+		if i%2 == 1 {
+			from, to = to, from
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			txn := engine.Begin()
+			assert.NoError(t, txn.Update(from, "1", domain.Document{IncKey: map[string]interface{}{"balance": -10}}))
+			assert.NoError(t, txn.Update(to, "1", domain.Document{IncKey: map[string]interface{}{"balance": 10}}))
+			_, err := txn.Commit()
+			assert.NoError(t, err)
+		}()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := engine.UpdateById(from, "1", domain.Document{"touched": true})
+			assert.NoError(t, err)
+		}()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("transactions deadlocked")
+	}
+
+	var total int64
+	for _, collName := range []string{"checking", "savings"} {
+		doc, err := engine.GetById(collName, "1")
+		require.NoError(t, err)
+		balance, ok := integerValue(doc["balance"])
+		require.True(t, ok, fmt.Sprintf("balance %v", doc["balance"]))
+		total += balance
+	}
+	assert.EqualValues(t, 2000, total)
+}
+
+func TestTxn_SavesCollections(t *testing.T) {
+	tempDir := t.TempDir()
+	engine := NewStorageEngine(WithDataDir(tempDir))
+	defer engine.StopBackgroundWorkers()
+	seedAccounts(t, engine)
+
+	txn := engine.Begin()
+	require.NoError(t, txn.Update("accounts", "1", domain.Document{"balance": 0}))
+	require.NoError(t, txn.Delete("accounts", "2"))
+	require.NoError(t, txn.Insert("transfers", domain.Document{"amount": 100}))
+	_, err := txn.Commit()
+	require.NoError(t, err)
+
+	accounts := readCollectionFile(t, engine, tempDir, "accounts")
+	require.Len(t, accounts, 1)
+	assert.EqualValues(t, 0, accounts["1"].(map[string]interface{})["balance"])
+	transfers := readCollectionFile(t, engine, tempDir, "transfers")
+	require.Len(t, transfers, 1)
+	assert.EqualValues(t, 100, transfers["1"].(map[string]interface{})["amount"])
+}
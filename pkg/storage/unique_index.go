@@ -0,0 +1,155 @@
+package storage
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/adfharrison1/go-db/pkg/domain"
+	"github.com/adfharrison1/go-db/pkg/indexing"
+)
+
+// CreateUniqueIndex creates an index on a field that no two documents may share a value
+// of. Writes that would store a taken value fail with domain.ErrDuplicateKey, as does
+// creating the index when existing documents already share one. Documents lacking the
+// field are not indexed, so any number of them may lack it.
+func (se *StorageEngine) CreateUniqueIndex(collName, fieldName string) error {
+	return se.createKeyedIndex(collName, fieldName, true, func() error {
+		return se.indexEngine.CreateUniqueIndex(collName, fieldName)
+	})
+}
+
+// CreateCompoundIndex creates an index on the combination of several fields, named by
+// indexing.CompoundIndexName (e.g. "city,age"). Queries whose filter gives each field an
+// equality value use it. A unique compound index rejects two documents with the same
+// values in all of the fields, as CreateUniqueIndex does for one field.
+func (se *StorageEngine) CreateCompoundIndex(collName string, fieldNames []string, unique bool) error {
+	if err := ValidateCompoundIndexFields(fieldNames); err != nil {
+		return err
+	}
+	return se.createKeyedIndex(collName, indexing.CompoundIndexName(fieldNames), unique, func() error {
+		return se.indexEngine.CreateCompoundIndex(collName, fieldNames, unique)
+	})
+}
+
+// CreateCollatedIndex creates an index on a field whose strings are keyed by their
+// domain.CollationKey under collation. Filters with the same $collation look their
+// strings up in it, and a unique collated index rejects two values equal under the
+// collation, such as emails differing only in case with domain.CollationCaseInsensitive.
+// Other conditions on the field scan the documents.
+func (se *StorageEngine) CreateCollatedIndex(collName, fieldName, collation string, unique bool) error {
+	if collation == "" {
+		return fmt.Errorf("a collated index needs a collation")
+	}
+	return se.createKeyedIndex(collName, fieldName, unique, func() error {
+		return se.indexEngine.CreateCollatedIndex(collName, fieldName, collation, unique)
+	})
+}
+
+// createKeyedIndex registers an index named name with create and builds it. A unique
+// index is dropped again when existing documents already share one of its keys.
+func (se *StorageEngine) createKeyedIndex(collName, name string, unique bool, create func() error) error {
+	lock := se.getOrCreateCollectionLock(collName)
+	return se.withCollectionWriteLock(collName, func() error {
+		collection, err := se.getCollectionInternal(collName)
+		if err != nil {
+			return err
+		}
+		if unique {
+			// Writers holding only a document lock finish first; later ones see the index
+			lock.uniqueIndexes.Lock()
+			defer lock.uniqueIndexes.Unlock()
+		}
+
+		if err := create(); err != nil {
+			return err
+		}
+		if err := se.indexEngine.BuildIndexForCollection(collName, name, collection); err != nil {
+			return err
+		}
+		if index, exists := se.indexEngine.GetIndex(collName, name); unique && exists {
+			if err := CheckUniqueIndexKeys(collName, index); err != nil {
+				se.indexEngine.DropIndex(collName, name)
+				return err
+			}
+		}
+		se.persistIndexChange(collName)
+		return nil
+	})
+}
+
+// ValidateCompoundIndexFields checks the fields of a compound index: at least two,
+// none empty and none repeated
+func ValidateCompoundIndexFields(fieldNames []string) error {
+	if len(fieldNames) < 2 {
+		return fmt.Errorf("a compound index needs at least two fields, got %d", len(fieldNames))
+	}
+	seen := make(map[string]bool, len(fieldNames))
+	for _, fieldName := range fieldNames {
+		if fieldName == "" {
+			return fmt.Errorf("compound index field names must not be empty")
+		}
+		if seen[fieldName] {
+			return fmt.Errorf("field %s is listed more than once in the compound index", fieldName)
+		}
+		seen[fieldName] = true
+	}
+	return nil
+}
+
+// CheckUniqueIndexKeys returns a domain.ErrDuplicateKey error if a newly built unique
+// index holds more than one document under a key, as it then cannot be created
+func CheckUniqueIndexKeys(collName string, index *indexing.Index) error {
+	key, docIDs, found := index.Duplicate()
+	if !found {
+		return nil
+	}
+	sort.Strings(docIDs)
+	return domain.Errorf(domain.ErrDuplicateKey, "cannot create unique index %s in collection %s: documents %s share key %v", index.Field, collName, strings.Join(docIDs, ", "), key)
+}
+
+// withUniqueDocumentWriteLock executes a function with a write lock on the specified
+// document, for writers that otherwise take no collection lock. While the collection
+// has a unique index the collection write lock is held as well, since checking a key
+// needs every other document's keys to stay put.
+func (se *StorageEngine) withUniqueDocumentWriteLock(collName, docID string, fn func() error) error {
+	lock := se.getOrCreateCollectionLock(collName)
+	lock.uniqueIndexes.RLock()
+	if !se.indexEngine.HasUniqueIndex(collName) {
+		defer lock.uniqueIndexes.RUnlock()
+		return se.withDocumentWriteLock(collName, docID, fn)
+	}
+	lock.uniqueIndexes.RUnlock()
+
+	return se.withCollectionWriteLock(collName, func() error {
+		return se.withDocumentWriteLock(collName, docID, fn)
+	})
+}
+
+// checkUniqueUpdateUnsafe returns a domain.ErrDuplicateKey error if applying updates to a
+// document would break one of the collection's unique indexes. updateByIdUnsafe leaves
+// this check to its callers so that writes of several documents can check them all at
+// once (caller must hold the collection write lock, or the document write lock taken
+// by withUniqueDocumentWriteLock).
+func (se *StorageEngine) checkUniqueUpdateUnsafe(collName, docID string, updates domain.Document) error {
+	if !se.indexEngine.HasUniqueIndex(collName) {
+		return nil
+	}
+	doc, err := se.getByIdUnsafe(collName, docID)
+	if err != nil {
+		return err
+	}
+	return se.indexEngine.CheckUnique(collName, []string{docID}, []domain.Document{updatedDocument(doc, updates)})
+}
+
+// updatedDocument returns a copy of doc with updates applied as updateByIdUnsafe
+// applies them
+func updatedDocument(doc, updates domain.Document) domain.Document {
+	updated := shallowCopyDocument(doc)
+	for field, value := range updates {
+		if field != "_id" {
+			updated[field] = value
+		}
+	}
+	return updated
+}
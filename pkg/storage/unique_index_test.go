@@ -0,0 +1,201 @@
+package storage
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/adfharrison1/go-db/pkg/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// seedEmails inserts users 1 and 2 with emails a@x and b@x and a unique index on email
+func seedEmails(t *testing.T, engine *StorageEngine) {
+	t.Helper()
+	for _, email := range []string{"a@x", "b@x"} {
+		_, err := engine.Insert("users", domain.Document{"email": email})
+		require.NoError(t, err)
+	}
+	require.NoError(t, engine.CreateUniqueIndex("users", "email"))
+}
+
+func TestUniqueIndex_RejectsDuplicates(t *testing.T) {
+	for name, opts := range map[string][]StorageOption{
+		"no-saves":   {WithNoSaves(true)},
+		"dual-write": {WithDataDir(t.TempDir())},
+	} {
+		t.Run(name, func(t *testing.T) {
+			engine := NewStorageEngine(opts...)
+			defer engine.StopBackgroundWorkers()
+			seedEmails(t, engine)
+
+			_, err := engine.Insert("users", domain.Document{"email": "a@x"})
+			assert.ErrorIs(t, err, domain.ErrDuplicateKey)
+			_, err = engine.UpdateById("users", "2", domain.Document{"email": "a@x"})
+			assert.ErrorIs(t, err, domain.ErrDuplicateKey)
+			_, err = engine.ReplaceById("users", "2", domain.Document{"email": "a@x"})
+			assert.ErrorIs(t, err, domain.ErrDuplicateKey)
+			_, err = engine.BatchInsert("users", []domain.Document{{"email": "c@x"}, {"email": "c@x"}})
+			assert.ErrorIs(t, err, domain.ErrDuplicateKey)
+			_, err = engine.BatchUpdate("users", []domain.BatchUpdateOperation{{ID: "1", Updates: domain.Document{"email": "b@x"}}})
+			assert.ErrorIs(t, err, domain.ErrDuplicateKey)
+
+			// Rewriting a document with its own key, or without the field, is allowed
+			_, err = engine.UpdateById("users", "1", domain.Document{"email": "a@x", "name": "Ann"})
+			assert.NoError(t, err)
+			for i := 0; i < 2; i++ {
+				_, err = engine.Insert("users", domain.Document{"name": "anonymous"})
+				assert.NoError(t, err)
+			}
+
+			ids, err := engine.FindIds("users", map[string]interface{}{"email": "a@x"})
+			require.NoError(t, err)
+			assert.Len(t, ids, 1)
+			ids, err = engine.FindIds("users", map[string]interface{}{"email": "c@x"})
+			require.NoError(t, err)
+			assert.Empty(t, ids)
+		})
+	}
+}
+
+func TestUniqueIndex_ChecksWholeWrites(t *testing.T) {
+	engine := NewStorageEngine(WithNoSaves(true))
+	defer engine.StopBackgroundWorkers()
+	seedEmails(t, engine)
+	require.NoError(t, engine.CreateUniqueIndex("users", "rank"))
+	_, err := engine.UpdateById("users", "1", domain.Document{"rank": 1})
+	require.NoError(t, err)
+	_, err = engine.UpdateById("users", "2", domain.Document{"rank": 2})
+	require.NoError(t, err)
+
+	// Shifting every rank up frees each key before it is taken again
+	modified, err := engine.UpdateMany("users", map[string]interface{}{}, domain.Document{IncKey: map[string]interface{}{"rank": 1}})
+	require.NoError(t, err)
+	assert.EqualValues(t, 2, modified)
+
+	// Setting every email to one value fails before any document changes
+	_, err = engine.UpdateMany("users", map[string]interface{}{}, domain.Document{"email": "same@x"})
+	assert.ErrorIs(t, err, domain.ErrDuplicateKey)
+	ids, err := engine.FindIds("users", map[string]interface{}{"email": "same@x"})
+	require.NoError(t, err)
+	assert.Empty(t, ids)
+
+	// A transaction may hand a key from one document to another
+	txn := engine.Begin()
+	require.NoError(t, txn.Update("users", "1", domain.Document{"email": "old@x"}))
+	require.NoError(t, txn.Insert("users", domain.Document{"email": "a@x"}))
+	_, err = txn.Commit()
+	require.NoError(t, err)
+
+	txn = engine.Begin()
+	require.NoError(t, txn.Insert("users", domain.Document{"email": "d@x"}))
+	require.NoError(t, txn.Insert("users", domain.Document{"email": "d@x"}))
+	_, err = txn.Commit()
+	assert.ErrorIs(t, err, domain.ErrDuplicateKey)
+	ids, err = engine.FindIds("users", map[string]interface{}{"email": "d@x"})
+	require.NoError(t, err)
+	assert.Empty(t, ids)
+}
+
+func TestUniqueIndex_CreateWithDuplicates(t *testing.T) {
+	engine := NewStorageEngine(WithNoSaves(true))
+	defer engine.StopBackgroundWorkers()
+	for _, email := range []string{"a@x", "b@x", "a@x"} {
+		_, err := engine.Insert("users", domain.Document{"email": email})
+		require.NoError(t, err)
+	}
+
+	err := engine.CreateUniqueIndex("users", "email")
+	assert.ErrorIs(t, err, domain.ErrDuplicateKey)
+	assert.Contains(t, err.Error(), "documents 1, 3")
+	indexes, err := engine.GetIndexes("users")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"_id"}, indexes)
+
+	require.NoError(t, engine.DeleteById("users", "3"))
+	assert.NoError(t, engine.CreateUniqueIndex("users", "email"))
+}
+
+func TestUniqueIndex_ConcurrentInserts(t *testing.T) {
+	engine := NewStorageEngine(WithDataDir(t.TempDir()))
+	defer engine.StopBackgroundWorkers()
+	seedEmails(t, engine)
+	for i := 0; i < 10; i++ {
+		_, err := engine.Insert("users", domain.Document{"name": "anonymous"})
+		require.NoError(t, err)
+	}
+
+	// Inserts and updates of distinct documents racing for one key leave exactly one owner
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			var err error
+			if i%2 == 0 {
+				_, err = engine.Insert("users", domain.Document{"email": "race@x"})
+			} else {
+				_, err = engine.UpdateById("users", strconv.Itoa(i/2+3), domain.Document{"email": "race@x"})
+			}
+			if err != nil {
+				assert.ErrorIs(t, err, domain.ErrDuplicateKey)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	ids, err := engine.FindIds("users", map[string]interface{}{"email": "race@x"})
+	require.NoError(t, err)
+	assert.Len(t, ids, 1)
+}
+
+func TestCompoundIndex(t *testing.T) {
+	engine := NewStorageEngine(WithNoSaves(true))
+	defer engine.StopBackgroundWorkers()
+	for _, doc := range []domain.Document{
+		{"city": "Boston", "age": 30},
+		{"city": "Boston", "age": 25},
+		{"city": "Chicago", "age": 30},
+		{"city": "Boston"},
+	} {
+		_, err := engine.Insert("people", doc)
+		require.NoError(t, err)
+	}
+
+	require.NoError(t, engine.CreateCompoundIndex("people", []string{"city", "age"}, false))
+	assert.Error(t, engine.CreateCompoundIndex("people", []string{"city"}, false))
+	assert.Error(t, engine.CreateCompoundIndex("people", []string{"city", "city"}, false))
+	indexes, err := engine.GetIndexes("people")
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"_id", "city,age"}, indexes)
+
+	// Filters naming every field are answered by the compound index
+	candidates, used := engine.optimizeWithIndexes("people", map[string]interface{}{"city": "Boston", "age": 30.0})
+	assert.True(t, used)
+	assert.Equal(t, []string{"1"}, candidates)
+	_, used = engine.optimizeWithIndexes("people", map[string]interface{}{"city": "Boston"})
+	assert.False(t, used)
+	_, used = engine.optimizeWithIndexes("people", map[string]interface{}{"city": "Boston", "age": map[string]interface{}{GtFilterKey: 20}})
+	assert.False(t, used)
+
+	docs, err := engine.FindByIndex("people", "city,age", []interface{}{"Chicago", 30})
+	require.NoError(t, err)
+	require.Len(t, docs, 1)
+	assert.Equal(t, "3", docs[0]["_id"])
+
+	_, err = engine.UpdateById("people", "2", domain.Document{"age": 30})
+	require.NoError(t, err)
+	ids, err := engine.FindIds("people", map[string]interface{}{"city": "Boston", "age": 30})
+	require.NoError(t, err)
+	assert.Len(t, ids, 2)
+
+	// A unique compound index rejects a repeated combination only
+	require.NoError(t, engine.CreateCompoundIndex("people", []string{"city", "name"}, true))
+	_, err = engine.Insert("people", domain.Document{"city": "Boston", "name": "Ann"})
+	require.NoError(t, err)
+	_, err = engine.Insert("people", domain.Document{"city": "Denver", "name": "Ann"})
+	require.NoError(t, err)
+	_, err = engine.Insert("people", domain.Document{"city": "Boston", "name": "Ann"})
+	assert.ErrorIs(t, err, domain.ErrDuplicateKey)
+}
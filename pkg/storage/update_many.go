@@ -0,0 +1,108 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/adfharrison1/go-db/pkg/domain"
+)
+
+// UpdateMany applies updates to every document matching filter and returns how many
+// were updated. Updates are partial, as with UpdateById: operators are resolved per
+// document and _id is never changed. The collection's default filter applies, and an
+// empty filter matches every document.
+func (se *StorageEngine) UpdateMany(collName string, filter map[string]interface{}, updates domain.Document) (int64, error) {
+	return se.UpdateManyContext(context.Background(), collName, filter, updates)
+}
+
+// UpdateManyContext is like UpdateMany; the request ID carried by ctx is attached to
+// any background retry of the collection save. A ctx from domain.WithDurableWrite
+// makes a failed save an error.
+//
+// Matching and updating happen under one hold of the collection write lock, and
+// every matched document's write lock is held, in ID order, from resolving its update
+// until it is applied. Every update is resolved and checked against the schema before
+// any is applied, so an invalid update leaves the collection unchanged. The
+// collection is saved once afterwards.
+func (se *StorageEngine) UpdateManyContext(ctx context.Context, collName string, filter map[string]interface{}, updates domain.Document) (int64, error) {
+	if len(updates) == 0 {
+		return 0, fmt.Errorf("no updates provided")
+	}
+	if err := ValidateFilter(filter); err != nil {
+		return 0, err
+	}
+	if err := se.checkDurable(ctx); err != nil {
+		return 0, err
+	}
+	filter = se.applyDefaultFilter(ctx, collName, filter)
+
+	release, err := se.writeLimiter.Acquire(ctx, collName)
+	if err != nil {
+		return 0, err
+	}
+	defer release()
+
+	updates = se.stampUpdates(updates)
+
+	var modified int64
+	err = se.withCollectionWriteLock(collName, func() error {
+		ids, err := se.findIdsUnsafe(ctx, collName, filter)
+		if err != nil {
+			return err
+		}
+		sort.Strings(ids)
+		keys := make([]txnKey, len(ids))
+		for i, docID := range ids {
+			keys[i] = txnKey{collName: collName, docID: docID}
+		}
+
+		// Single-document updates hold only document locks, so every matched document
+		// stays locked from resolving its update until it is applied
+		return se.withDocumentWriteLocks(keys, func() error {
+			resolved := make([]domain.Document, len(ids))
+			var updated []domain.Document // Documents as the update leaves them, for unique indexes
+			if se.indexEngine.HasUniqueIndex(collName) {
+				updated = make([]domain.Document, len(ids))
+			}
+			for i, docID := range ids {
+				var err error
+				if resolved[i], err = se.resolveUpdateUnsafe(collName, docID, updates); err != nil {
+					return fmt.Errorf("failed to update document %s: %w", docID, err)
+				}
+				doc, err := se.getByIdUnsafe(collName, docID)
+				if err != nil {
+					return fmt.Errorf("failed to update document %s: %w", docID, err)
+				}
+				if err := se.checkStrictSchema(collName, doc, resolved[i]); err != nil {
+					return fmt.Errorf("failed to update document %s: %w", docID, err)
+				}
+				if updated != nil {
+					updated[i] = updatedDocument(doc, resolved[i])
+				}
+			}
+			if updated != nil {
+				if err := se.indexEngine.CheckUnique(collName, ids, updated); err != nil {
+					return err
+				}
+			}
+			for i, docID := range ids {
+				if _, err := se.updateByIdUnsafe(collName, docID, resolved[i]); err != nil {
+					return fmt.Errorf("failed to update document %s: %w", docID, err)
+				}
+				modified++
+			}
+			return nil
+		})
+	})
+
+	if modified > 0 && !se.noSaves {
+		// Many documents changed, so the whole collection is rewritten once
+		if saveErr := se.SaveCollectionAfterTransaction(collName); saveErr != nil {
+			if saveErr := se.persistFailed(ctx, collName, "", nil, saveErr); saveErr != nil && err == nil {
+				err = saveErr
+			}
+		}
+	}
+	return modified, err
+}
@@ -0,0 +1,159 @@
+package storage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/adfharrison1/go-db/pkg/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// seedUsers inserts users in two cities with an index on city and active
+func seedUsers(t *testing.T, engine *StorageEngine) {
+	t.Helper()
+	for _, city := range []string{"Paris", "Berlin", "Paris", "Rome", "Paris"} {
+		_, err := engine.Insert("users", domain.Document{"city": city, "active": true})
+		require.NoError(t, err)
+	}
+	require.NoError(t, engine.CreateIndex("users", "city"))
+	require.NoError(t, engine.CreateIndex("users", "active"))
+}
+
+func TestUpdateMany(t *testing.T) {
+	engine := NewStorageEngine(WithNoSaves(true))
+	defer engine.StopBackgroundWorkers()
+	seedUsers(t, engine)
+
+	modified, err := engine.UpdateMany("users", map[string]interface{}{"city": "Paris"}, domain.Document{"active": false, "_id": "x"})
+	require.NoError(t, err)
+	assert.EqualValues(t, 3, modified)
+
+	// _id is never changed, as with UpdateById
+	doc, err := engine.GetById("users", "1")
+	require.NoError(t, err)
+	assert.Equal(t, "1", doc["_id"])
+	assert.Equal(t, false, doc["active"])
+
+	// The indexes match what one UpdateById per document would leave
+	expected := NewStorageEngine(WithNoSaves(true))
+	defer expected.StopBackgroundWorkers()
+	seedUsers(t, expected)
+	for _, docID := range []string{"1", "3", "5"} {
+		_, err := expected.UpdateById("users", docID, domain.Document{"active": false})
+		require.NoError(t, err)
+	}
+	for _, filter := range []map[string]interface{}{{"active": false}, {"active": true}, {"city": "Paris"}, {"city": "Paris", "active": true}} {
+		want, err := expected.FindIds("users", filter)
+		require.NoError(t, err)
+		got, err := engine.FindIds("users", filter)
+		require.NoError(t, err)
+		assert.Equal(t, want, got, "filter %v", filter)
+	}
+
+	modified, err = engine.UpdateMany("users", map[string]interface{}{"city": "Oslo"}, domain.Document{"active": false})
+	require.NoError(t, err)
+	assert.Zero(t, modified)
+
+	_, err = engine.UpdateMany("missing", map[string]interface{}{}, domain.Document{"active": false})
+	assert.ErrorIs(t, err, domain.ErrCollectionNotFound)
+	_, err = engine.UpdateMany("users", map[string]interface{}{}, domain.Document{})
+	assert.Error(t, err)
+	_, err = engine.UpdateMany("users", map[string]interface{}{"city": map[string]interface{}{RegexFilterKey: "("}}, domain.Document{"active": false})
+	assert.ErrorIs(t, err, domain.ErrInvalidFilter)
+}
+
+func TestUpdateMany_Operators(t *testing.T) {
+	engine := NewStorageEngine(WithNoSaves(true))
+	defer engine.StopBackgroundWorkers()
+	for _, score := range []interface{}{5.0, 20.0, "high"} {
+		_, err := engine.Insert("scores", domain.Document{"score": score})
+		require.NoError(t, err)
+	}
+
+	// Operators are resolved per document
+	modified, err := engine.UpdateMany("scores", map[string]interface{}{"score": map[string]interface{}{"$lt": 100}}, domain.Document{MaxKey: map[string]interface{}{"score": 10.0}})
+	require.NoError(t, err)
+	assert.EqualValues(t, 2, modified)
+	for docID, want := range map[string]float64{"1": 10, "2": 20} {
+		doc, err := engine.GetById("scores", docID)
+		require.NoError(t, err)
+		assert.Equal(t, want, doc["score"])
+	}
+
+	// An update that fails for one document leaves every document unchanged
+	_, err = engine.UpdateMany("scores", map[string]interface{}{}, domain.Document{"checked": true, MaxKey: map[string]interface{}{"score": 15.0}})
+	assert.ErrorIs(t, err, domain.ErrInvalidField)
+	ids, err := engine.FindIds("scores", map[string]interface{}{"checked": true})
+	require.NoError(t, err)
+	assert.Empty(t, ids)
+}
+
+func TestUpdateMany_SavesCollection(t *testing.T) {
+	tempDir := t.TempDir()
+	engine := NewStorageEngine(WithDataDir(tempDir))
+	defer engine.StopBackgroundWorkers()
+	seedUsers(t, engine)
+
+	modified, err := engine.UpdateMany("users", map[string]interface{}{"city": "Paris"}, domain.Document{"active": false})
+	require.NoError(t, err)
+	assert.EqualValues(t, 3, modified)
+
+	docs := readCollectionFile(t, engine, tempDir, "users")
+	require.Len(t, docs, 5)
+	assert.Equal(t, false, docs["3"].(map[string]interface{})["active"])
+	assert.Equal(t, true, docs["2"].(map[string]interface{})["active"])
+}
+
+func TestUpdateMany_ConcurrentUpdateById(t *testing.T) {
+	engine := NewStorageEngine(WithDataDir(t.TempDir()))
+	defer engine.StopBackgroundWorkers()
+	docs := make([]domain.Document, 100)
+	for i := range docs {
+		docs[i] = domain.Document{"score": i}
+	}
+	_, err := engine.BatchInsert("scores", docs)
+	require.NoError(t, err)
+	documentLocks := &engine.getOrCreateCollectionLock("scores").documents
+	waiters := func(n int64) func() bool {
+		return func() bool { return documentLocks.Stats().WriteWaiters == n }
+	}
+
+	// Hold document 99, the last in ID order, until the UpdateMany waits for it
+	locked, release := make(chan struct{}), make(chan struct{})
+	go engine.withDocumentWriteLock("scores", "99", func() error {
+		close(locked)
+		<-release
+		return nil
+	})
+	<-locked
+	var modified int64
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		modified, err = engine.UpdateMany("scores", map[string]interface{}{}, domain.Document{"checked": true, IncKey: map[string]interface{}{"score": 1}})
+	}()
+	require.Eventually(t, waiters(1), 5*time.Second, time.Millisecond)
+
+	// Document 1 was already resolved, so an UpdateById making its $inc invalid
+	// waits for the UpdateMany
+	updated := make(chan struct{})
+	go func() {
+		defer close(updated)
+		_, err := engine.UpdateById("scores", "1", domain.Document{"score": "high"})
+		assert.NoError(t, err)
+	}()
+	require.Eventually(t, waiters(2), 5*time.Second, time.Millisecond)
+	close(release)
+	<-done
+	<-updated
+
+	require.NoError(t, err)
+	assert.EqualValues(t, len(docs), modified)
+	ids, err := engine.FindIds("scores", map[string]interface{}{"checked": true})
+	require.NoError(t, err)
+	assert.Len(t, ids, len(docs))
+	doc, err := engine.GetById("scores", "1")
+	require.NoError(t, err)
+	assert.Equal(t, "high", doc["score"])
+}
@@ -0,0 +1,183 @@
+package storage
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/adfharrison1/go-db/pkg/domain"
+)
+
+// Operators a partial update may hold alongside plain fields, each an object of fields
+const (
+	MaxKey = "$max" // Sets a field only if the value is greater than the stored one
+	MinKey = "$min" // Sets a field only if the value is less than the stored one
+	IncKey = "$inc" // Adds the value to the stored number
+)
+
+// HasUpdateOperators reports whether a partial update holds operator sections
+func HasUpdateOperators(updates domain.Document) bool {
+	for key := range updates {
+		if strings.HasPrefix(key, "$") {
+			return true
+		}
+	}
+	return false
+}
+
+// ResolveUpdate turns the operator sections of a partial update into plain fields
+// against doc, the stored document, so the result can be applied and persisted like
+// any partial update. $set fields are kept as they are. A $max field is kept if doc
+// lacks it or the value is greater than the stored one, and a $min field if the value
+// is less; values are ordered by CompareValues. An $inc field is set to the stored
+// number plus the value, a missing field counting as 0; see incrementValue. A field
+// may appear only once in an update, and updates without operators are returned as
+// they are.
+func ResolveUpdate(doc, updates domain.Document) (domain.Document, error) {
+	if !HasUpdateOperators(updates) {
+		return updates, nil
+	}
+
+	resolved := make(domain.Document, len(updates))
+	seen := make(map[string]bool, len(updates))
+	for key, value := range updates {
+		if !strings.HasPrefix(key, "$") {
+			resolved[key] = value
+			seen[key] = true
+		}
+	}
+
+	for key, section := range updates {
+		var keep func(cmp int) bool
+		switch key {
+		case SetKey:
+			keep = func(int) bool { return true }
+		case MaxKey:
+			keep = func(cmp int) bool { return cmp > 0 }
+		case MinKey:
+			keep = func(cmp int) bool { return cmp < 0 }
+		case IncKey:
+		default:
+			if !strings.HasPrefix(key, "$") {
+				continue
+			}
+			return nil, domain.Errorf(domain.ErrInvalidField, "unknown update operator %s (use %s, %s, %s or %s)", key, SetKey, MaxKey, MinKey, IncKey)
+		}
+
+		fields, ok := documentFields(section)
+		if !ok {
+			return nil, domain.Errorf(domain.ErrInvalidField, "%s must be an object of fields", key)
+		}
+		for field, value := range fields {
+			if field == "_id" {
+				return nil, domain.Errorf(domain.ErrInvalidField, "%s cannot set _id", key)
+			}
+			if seen[field] {
+				return nil, domain.Errorf(domain.ErrInvalidField, "field %s is updated twice", field)
+			}
+			seen[field] = true
+
+			stored, exists := doc[field]
+			if key == IncKey {
+				if _, ok := ToFloat64(value); !ok {
+					return nil, domain.Errorf(domain.ErrInvalidField, "%s: %s must be incremented by a number, got %s", key, field, FieldTypeName(value))
+				}
+				if !exists {
+					stored = 0
+				}
+				sum, ok := incrementValue(stored, value)
+				if !ok {
+					return nil, domain.Errorf(domain.ErrInvalidField, "%s: %s cannot be incremented, the stored value is %s, not a number", key, field, FieldTypeName(stored))
+				}
+				resolved[field] = sum
+				continue
+			}
+			if !exists || key == SetKey {
+				resolved[field] = value
+				continue
+			}
+			cmp, ok := CompareValues(value, stored)
+			if !ok {
+				return nil, domain.Errorf(domain.ErrInvalidField, "%s: %s cannot be compared with the stored value %v", key, field, stored)
+			}
+			if keep(cmp) {
+				resolved[field] = value
+			}
+		}
+	}
+	return resolved, nil
+}
+
+// incrementValue adds two numbers of any Go numeric type. Two integers add exactly
+// as an int64; otherwise, or if that would overflow, both are converted with
+// ToFloat64, as filters compare them, and the sum is a float64. The second result is
+// false when either value is not a number.
+func incrementValue(stored, by interface{}) (interface{}, bool) {
+	if a, ok := integerValue(stored); ok {
+		if b, ok := integerValue(by); ok {
+			if (b > 0 && a <= math.MaxInt64-b) || (b <= 0 && a >= math.MinInt64-b) {
+				return a + b, true
+			}
+		}
+	}
+	a, ok := ToFloat64(stored)
+	if !ok {
+		return nil, false
+	}
+	b, ok := ToFloat64(by)
+	if !ok {
+		return nil, false
+	}
+	return a + b, true
+}
+
+// integerValue returns an integer of any Go integer type as an int64
+func integerValue(value interface{}) (int64, bool) {
+	switch v := value.(type) {
+	case int:
+		return int64(v), true
+	case int8:
+		return int64(v), true
+	case int16:
+		return int64(v), true
+	case int32:
+		return int64(v), true
+	case int64:
+		return v, true
+	case uint:
+		return int64(v), uint64(v) <= math.MaxInt64
+	case uint8:
+		return int64(v), true
+	case uint16:
+		return int64(v), true
+	case uint32:
+		return int64(v), true
+	case uint64:
+		return int64(v), v <= math.MaxInt64
+	}
+	return 0, false
+}
+
+// resolveUpdateUnsafe resolves the operators of a partial update against the stored
+// document and sets its next version when versions are enabled (caller must hold the
+// document's write lock)
+func (se *StorageEngine) resolveUpdateUnsafe(collName, docId string, updates domain.Document) (domain.Document, error) {
+	if !HasUpdateOperators(updates) && !se.documentVersions {
+		return updates, nil
+	}
+	doc, err := se.getByIdUnsafe(collName, docId)
+	if err != nil {
+		return nil, err
+	}
+	return se.resolveDocumentUpdate(docId, doc, updates)
+}
+
+// resolveDocumentUpdate resolves a partial update against doc, the current version
+// of document docId, and sets its next version when versions are enabled
+func (se *StorageEngine) resolveDocumentUpdate(docId string, doc, updates domain.Document) (domain.Document, error) {
+	resolved, err := ResolveUpdate(doc, updates)
+	if err != nil {
+		return nil, fmt.Errorf("document %s: %w", docId, err)
+	}
+	return se.versionUpdates(doc, resolved), nil
+}
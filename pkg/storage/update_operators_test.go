@@ -0,0 +1,208 @@
+package storage
+
+import (
+	"errors"
+	"math"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/adfharrison1/go-db/pkg/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResolveUpdate(t *testing.T) {
+	doc := domain.Document{"_id": "1", "high": 100, "low": 10, "seen": "2024-05-01T00:00:00Z"}
+
+	tests := []struct {
+		name     string
+		updates  domain.Document
+		expected domain.Document
+	}{
+		{"No Operators", domain.Document{"name": "Alice"}, domain.Document{"name": "Alice"}},
+		{"Max Greater", domain.Document{MaxKey: map[string]interface{}{"high": 150}}, domain.Document{"high": 150}},
+		{"Max Not Greater", domain.Document{MaxKey: map[string]interface{}{"high": 100.0}}, domain.Document{}},
+		{"Min Less", domain.Document{MinKey: map[string]interface{}{"low": 5}}, domain.Document{"low": 5}},
+		{"Min Not Less", domain.Document{MinKey: map[string]interface{}{"low": 50}}, domain.Document{}},
+		{"Missing Field", domain.Document{MaxKey: map[string]interface{}{"new": 1}}, domain.Document{"new": 1}},
+		{"Times", domain.Document{MaxKey: map[string]interface{}{"seen": "2024-05-01T02:00:00+01:00"}}, domain.Document{"seen": "2024-05-01T02:00:00+01:00"}},
+		{"Inc Integer", domain.Document{IncKey: map[string]interface{}{"high": 5}}, domain.Document{"high": int64(105)}},
+		{"Inc Float", domain.Document{IncKey: map[string]interface{}{"high": 0.5}}, domain.Document{"high": 100.5}},
+		{"Inc Negative", domain.Document{IncKey: map[string]interface{}{"low": -15.0}}, domain.Document{"low": -5.0}},
+		{"Inc Missing", domain.Document{IncKey: map[string]interface{}{"views": 1}}, domain.Document{"views": int64(1)}},
+		{"Mixed", domain.Document{"name": "Alice", SetKey: map[string]interface{}{"team": "core"}, MaxKey: map[string]interface{}{"high": 50}},
+			domain.Document{"name": "Alice", "team": "core"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resolved, err := ResolveUpdate(doc, tt.updates)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, resolved)
+		})
+	}
+
+	for name, updates := range map[string]domain.Document{
+		"Unknown Operator": {"$push": map[string]interface{}{"high": 1}},
+		"Not An Object":    {MaxKey: 5},
+		"ID":               {MaxKey: map[string]interface{}{"_id": "9"}},
+		"Updated Twice":    {"high": 1, MaxKey: map[string]interface{}{"high": 2}},
+		"Not Comparable":   {MaxKey: map[string]interface{}{"high": "lots"}},
+		"Inc By String":    {IncKey: map[string]interface{}{"high": "1"}},
+		"Inc Not A Number": {IncKey: map[string]interface{}{"seen": 1}},
+		"Inc ID":           {IncKey: map[string]interface{}{"_id": 1}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := ResolveUpdate(doc, updates)
+			assert.True(t, errors.Is(err, domain.ErrInvalidField), "got %v", err)
+		})
+	}
+}
+
+func TestStorageEngine_UpdateById_MaxMin(t *testing.T) {
+	engine := NewStorageEngine(WithNoSaves(true))
+	defer engine.StopBackgroundWorkers()
+
+	_, err := engine.Insert("players", domain.Document{"name": "Alice", "highScore": 300, "bestLap": 62.5})
+	require.NoError(t, err)
+	require.NoError(t, engine.CreateIndex("players", "highScore"))
+
+	doc, err := engine.UpdateById("players", "1", domain.Document{MaxKey: map[string]interface{}{"highScore": 500}, MinKey: map[string]interface{}{"bestLap": 70}})
+	require.NoError(t, err)
+	assert.Equal(t, 500, doc["highScore"])
+	assert.Equal(t, 62.5, doc["bestLap"])
+
+	// The index follows the change
+	docs, err := engine.FindByIndex("players", "highScore", 500)
+	require.NoError(t, err)
+	assert.Len(t, docs, 1)
+	docs, err = engine.FindByIndex("players", "highScore", 300)
+	require.NoError(t, err)
+	assert.Empty(t, docs)
+
+	_, err = engine.BatchUpdate("players", []domain.BatchUpdateOperation{
+		{ID: "1", Updates: domain.Document{MaxKey: map[string]interface{}{"highScore": 400}, MinKey: map[string]interface{}{"bestLap": 61}}},
+	})
+	require.NoError(t, err)
+	doc, err = engine.GetById("players", "1")
+	require.NoError(t, err)
+	assert.Equal(t, 500, doc["highScore"])
+	assert.Equal(t, 61, doc["bestLap"])
+
+	_, err = engine.UpdateById("players", "1", domain.Document{"$push": map[string]interface{}{"highScore": 1}})
+	assert.True(t, errors.Is(err, domain.ErrInvalidField), "got %v", err)
+}
+
+func TestStorageEngine_UpdateById_MaxConcurrent(t *testing.T) {
+	engine := NewStorageEngine(WithDataDir(t.TempDir()), WithDeltaLog(true))
+	defer engine.StopBackgroundWorkers()
+
+	_, err := engine.Insert("players", domain.Document{"highScore": 0})
+	require.NoError(t, err)
+
+	// Each submitted score is compared and written under the document lock
+	var wg sync.WaitGroup
+	for score := 1; score <= 50; score++ {
+		wg.Add(1)
+		go func(score int) {
+			defer wg.Done()
+			_, err := engine.UpdateById("players", "1", domain.Document{MaxKey: map[string]interface{}{"highScore": score}})
+			assert.NoError(t, err)
+		}(score)
+	}
+	wg.Wait()
+
+	doc, err := engine.GetById("players", "1")
+	require.NoError(t, err)
+	assert.Equal(t, 50, doc["highScore"])
+	// The last delta appended is the last change marked, so the collection ends clean
+	assert.Equal(t, CollectionStateLoaded, engine.collections["players"].currentState())
+
+	// The delta log holds the resolved fields
+	reloaded := NewStorageEngine(WithDataDir(engine.dataDir), WithDeltaLog(true))
+	defer reloaded.StopBackgroundWorkers()
+	require.NoError(t, reloaded.LoadCollectionMetadata(filepath.Join(engine.dataDir, "missing.godb")))
+	doc, err = reloaded.GetById("players", "1")
+	require.NoError(t, err)
+	assert.EqualValues(t, 50, doc["highScore"])
+}
+
+func TestIncrementValue(t *testing.T) {
+	sum, ok := incrementValue(int32(7), uint8(3))
+	assert.True(t, ok)
+	assert.Equal(t, int64(10), sum)
+
+	// An integer sum beyond int64 becomes a float
+	sum, ok = incrementValue(int64(math.MaxInt64), 1)
+	assert.True(t, ok)
+	assert.Equal(t, float64(math.MaxInt64)+1, sum)
+
+	_, ok = incrementValue(nil, 1)
+	assert.False(t, ok)
+}
+
+func TestStorageEngine_UpdateById_IncConcurrent(t *testing.T) {
+	engine := NewStorageEngine(WithDataDir(t.TempDir()), WithDeltaLog(true))
+	defer engine.StopBackgroundWorkers()
+
+	_, err := engine.Insert("pages", domain.Document{"title": "Home", "views": 0})
+	require.NoError(t, err)
+	require.NoError(t, engine.CreateIndex("pages", "views"))
+
+	// Each increment reads and writes under the document lock, so none is lost
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := engine.UpdateById("pages", "1", domain.Document{IncKey: map[string]interface{}{"views": 1}})
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+
+	doc, err := engine.GetById("pages", "1")
+	require.NoError(t, err)
+	assert.EqualValues(t, 50, doc["views"])
+	docs, err := engine.FindByIndex("pages", "views", int64(50))
+	require.NoError(t, err)
+	assert.Len(t, docs, 1)
+	assert.Equal(t, CollectionStateLoaded, engine.collections["pages"].currentState(), "every increment is in the delta log")
+
+	// The delta log holds the resolved sums
+	reloaded := NewStorageEngine(WithDataDir(engine.dataDir), WithDeltaLog(true))
+	defer reloaded.StopBackgroundWorkers()
+	require.NoError(t, reloaded.LoadCollectionMetadata(filepath.Join(engine.dataDir, "missing.godb")))
+	doc, err = reloaded.GetById("pages", "1")
+	require.NoError(t, err)
+	assert.EqualValues(t, 50, doc["views"])
+
+	_, err = engine.UpdateById("pages", "1", domain.Document{IncKey: map[string]interface{}{"title": 1}})
+	assert.True(t, errors.Is(err, domain.ErrInvalidField), "got %v", err)
+}
+
+func TestStorageEngine_BatchUpdate_Inc(t *testing.T) {
+	engine := NewStorageEngine(WithNoSaves(true))
+	defer engine.StopBackgroundWorkers()
+
+	_, err := engine.Insert("pages", domain.Document{"views": 10, "likes": 2.5})
+	require.NoError(t, err)
+	_, err = engine.Insert("pages", domain.Document{"views": 3})
+	require.NoError(t, err)
+
+	_, err = engine.BatchUpdate("pages", []domain.BatchUpdateOperation{
+		{ID: "1", Updates: domain.Document{IncKey: map[string]interface{}{"views": 1, "likes": 1}}},
+		{ID: "2", Updates: domain.Document{IncKey: map[string]interface{}{"views": -3, "shares": 1}}},
+		{ID: "1", Updates: domain.Document{IncKey: map[string]interface{}{"views": 1}}},
+	})
+	require.NoError(t, err)
+
+	doc, err := engine.GetById("pages", "1")
+	require.NoError(t, err)
+	assert.EqualValues(t, 12, doc["views"])
+	assert.Equal(t, 3.5, doc["likes"])
+	doc, err = engine.GetById("pages", "2")
+	require.NoError(t, err)
+	assert.EqualValues(t, 0, doc["views"])
+	assert.EqualValues(t, 1, doc["shares"])
+}
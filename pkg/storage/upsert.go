@@ -0,0 +1,301 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/adfharrison1/go-db/pkg/domain"
+)
+
+// Upsert update sections: $set fields are written whether the upsert creates or
+// updates a document, $setOnInsert fields only when it creates one
+const (
+	SetKey         = "$set"
+	SetOnInsertKey = "$setOnInsert"
+)
+
+// ParseUpsertUpdate splits an upsert update into the fields to set on every upsert
+// and those to set only on insert. Fields outside a section are set on every upsert,
+// so {"name": "Alice"} means {"$set": {"name": "Alice"}}. A field may appear in only
+// one section and _id in none, since the engine assigns it.
+func ParseUpsertUpdate(update domain.Document) (set, setOnInsert domain.Document, err error) {
+	set, setOnInsert = domain.Document{}, domain.Document{}
+	add := func(section domain.Document, field string, value interface{}) error {
+		if field == "_id" {
+			return domain.Errorf(domain.ErrInvalidField, "upsert cannot set _id")
+		}
+		if _, exists := set[field]; exists {
+			return domain.Errorf(domain.ErrInvalidField, "field %s is set more than once", field)
+		}
+		if _, exists := setOnInsert[field]; exists {
+			return domain.Errorf(domain.ErrInvalidField, "field %s is set more than once", field)
+		}
+		section[field] = value
+		return nil
+	}
+
+	for key, value := range update {
+		if !strings.HasPrefix(key, "$") {
+			if err := add(set, key, value); err != nil {
+				return nil, nil, err
+			}
+			continue
+		}
+
+		var section domain.Document
+		switch key {
+		case SetKey:
+			section = set
+		case SetOnInsertKey:
+			section = setOnInsert
+		default:
+			return nil, nil, fmt.Errorf("unknown upsert operator %s (use %s or %s)", key, SetKey, SetOnInsertKey)
+		}
+		fields, ok := documentFields(value)
+		if !ok {
+			return nil, nil, fmt.Errorf("%s must be an object of fields", key)
+		}
+		for field, fieldValue := range fields {
+			if err := add(section, field, fieldValue); err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+	return set, setOnInsert, nil
+}
+
+// documentFields returns the fields of an object value
+func documentFields(value interface{}) (map[string]interface{}, bool) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return v, true
+	case domain.Document:
+		return v, true
+	}
+	return nil, false
+}
+
+// UpsertInsertDocument builds the document an upsert creates: the filter's plain
+// top-level equality fields, so the new document matches a filter such as
+// {"email": "a@b.c"}, then the $setOnInsert and $set fields
+func UpsertInsertDocument(filter map[string]interface{}, set, setOnInsert domain.Document) domain.Document {
+	doc := make(domain.Document, len(filter)+len(set)+len(setOnInsert))
+	for field, value := range filter {
+		if strings.HasPrefix(field, "$") || isFieldPath(field) || field == "_id" {
+			continue
+		}
+		if _, isCondition := value.(map[string]interface{}); isCondition {
+			continue
+		}
+		doc[field] = value
+	}
+	for field, value := range setOnInsert {
+		doc[field] = value
+	}
+	for field, value := range set {
+		doc[field] = value
+	}
+	return doc
+}
+
+// Upsert updates the first document matching filter with the $set fields of update,
+// or inserts a document built by UpsertInsertDocument if none matches (see
+// ParseUpsertUpdate). It returns the document as stored and whether it was created.
+// Like InsertIfNotExists, the check and the write happen under one hold of the
+// collection write lock, so concurrent upserts with the same filter create at most
+// one document, and the collection's default filter applies. An update with no $set
+// fields leaves a matching document unchanged.
+func (se *StorageEngine) Upsert(collName string, filter map[string]interface{}, update domain.Document) (domain.Document, bool, error) {
+	return se.UpsertContext(context.Background(), collName, filter, update)
+}
+
+// UpsertContext is like Upsert; the request ID carried by ctx is attached to any
+// background retry of the disk write. A ctx from domain.WithDurableWrite makes a
+// failed disk write an error.
+func (se *StorageEngine) UpsertContext(ctx context.Context, collName string, filter map[string]interface{}, update domain.Document) (domain.Document, bool, error) {
+	set, setOnInsert, err := ParseUpsertUpdate(update)
+	if err != nil {
+		return nil, false, err
+	}
+	if err := ValidateFilter(filter); err != nil {
+		return nil, false, err
+	}
+	if err := se.checkDurable(ctx); err != nil {
+		return nil, false, err
+	}
+	doc := UpsertInsertDocument(filter, set, setOnInsert)
+	filter = se.applyDefaultFilter(ctx, collName, filter)
+
+	release, err := se.writeLimiter.Acquire(ctx, collName)
+	if err != nil {
+		return nil, false, err
+	}
+	defer release()
+
+	// Fill in collection defaults and timestamps before the ID is assigned and indexes are updated
+	se.applyDocumentDefaults(collName, doc)
+	se.stampInsert(doc, time.Now())
+	updates := se.stampUpdates(set)
+
+	var docID string
+	var result domain.Document
+	var created, updated bool
+	var evicted []string
+	var deltaGen uint64
+	var deltaErr error
+	err = se.withCollectionWriteLock(collName, func() error {
+		if existing, found := se.findFirstMatchUnsafe(collName, filter); found {
+			docID, _ = existing["_id"].(string)
+			if len(set) == 0 {
+				result = CopyDocument(existing)
+				return nil
+			}
+			resolved, err := se.resolveUpdateUnsafe(collName, docID, updates)
+			if err != nil {
+				return err
+			}
+			if err := se.checkUniqueUpdateUnsafe(collName, docID, resolved); err != nil {
+				return err
+			}
+			if result, err = se.updateByIdUnsafe(collName, docID, resolved); err != nil {
+				return err
+			}
+			updated = true
+			if !se.noSaves && se.deltaLogEnabled() {
+				// Appended under the collection lock so deltas for a document stay in update order
+				deltaGen = se.dirtyGeneration(collName)
+				deltaErr = se.appendDelta(collName, docID, resolved)
+			}
+			return nil
+		}
+
+		if err := se.checkStrictSchema(collName, doc); err != nil {
+			return err
+		}
+		var err error
+		if docID, err = se.prepareInsertUnsafe(collName); err != nil {
+			return err
+		}
+		if result, evicted, err = se.insertLockedUnsafe(collName, docID, doc); err != nil {
+			return err
+		}
+		created = true
+		return nil
+	})
+	if err != nil {
+		return nil, false, err
+	}
+
+	switch {
+	case created:
+		if err := se.persistInsert(ctx, collName, docID, result, evicted); err != nil {
+			return nil, false, err
+		}
+	case updated && !se.noSaves:
+		if err := se.persistUpdate(ctx, collName, docID, result, deltaGen, deltaErr); err != nil {
+			return nil, false, err
+		}
+	}
+	return result, created, nil
+}
+
+// UpsertById applies doc as a partial update to the document with ID docId, or
+// inserts doc under that ID if there is none, creating the collection if needed. It
+// returns the document as stored and whether it was created. The check and the write
+// happen under one hold of the collection write lock. A created document gets the
+// collection defaults and any $max or $min fields as plain values; a numeric ID above
+// the collection's ID counter raises it, so the ID is never assigned again.
+func (se *StorageEngine) UpsertById(collName, docId string, doc domain.Document) (domain.Document, bool, error) {
+	return se.UpsertByIdContext(context.Background(), collName, docId, doc)
+}
+
+// UpsertByIdContext is like UpsertById; the request ID carried by ctx is attached to
+// any background retry of the disk write. A ctx from domain.WithDurableWrite makes a
+// failed disk write an error.
+func (se *StorageEngine) UpsertByIdContext(ctx context.Context, collName, docId string, doc domain.Document) (domain.Document, bool, error) {
+	if docId == "" {
+		return nil, false, domain.Errorf(domain.ErrInvalidField, "document ID cannot be empty")
+	}
+	if err := se.checkDurable(ctx); err != nil {
+		return nil, false, err
+	}
+	// Operators resolve against an empty document when the upsert creates one
+	insertDoc, err := ResolveUpdate(domain.Document{}, doc)
+	if err != nil {
+		return nil, false, err
+	}
+	insertDoc = CopyDocument(insertDoc)
+
+	release, err := se.writeLimiter.Acquire(ctx, collName)
+	if err != nil {
+		return nil, false, err
+	}
+	defer release()
+
+	// Fill in collection defaults and timestamps before indexes are updated
+	se.applyDocumentDefaults(collName, insertDoc)
+	se.stampInsert(insertDoc, time.Now())
+	updates := se.stampUpdates(doc)
+
+	var result domain.Document
+	var created bool
+	var evicted []string
+	var deltaGen uint64
+	var deltaErr error
+	err = se.withCollectionWriteLock(collName, func() error {
+		if err := se.ensureCollectionUnsafe(collName); err != nil {
+			return err
+		}
+		collection, err := se.getCollectionInternal(collName)
+		if err != nil {
+			return err
+		}
+
+		if collection.Has(docId) {
+			return se.withDocumentWriteLock(collName, docId, func() error {
+				resolved, err := se.resolveUpdateUnsafe(collName, docId, updates)
+				if err != nil {
+					return err
+				}
+				if err := se.checkUniqueUpdateUnsafe(collName, docId, resolved); err != nil {
+					return err
+				}
+				if result, err = se.updateByIdUnsafe(collName, docId, resolved); err != nil {
+					return err
+				}
+				if !se.noSaves && se.deltaLogEnabled() {
+					deltaGen = se.dirtyGeneration(collName)
+					deltaErr = se.appendDelta(collName, docId, resolved)
+				}
+				return nil
+			})
+		}
+
+		if err := se.checkStrictSchema(collName, insertDoc); err != nil {
+			return err
+		}
+		se.raiseIDCounter(collName, docId)
+		if result, evicted, err = se.insertLockedUnsafe(collName, docId, insertDoc); err != nil {
+			return err
+		}
+		created = true
+		return nil
+	})
+	if err != nil {
+		return nil, false, err
+	}
+
+	switch {
+	case created:
+		if err := se.persistInsert(ctx, collName, docId, result, evicted); err != nil {
+			return nil, false, err
+		}
+	case !se.noSaves:
+		if err := se.persistUpdate(ctx, collName, docId, result, deltaGen, deltaErr); err != nil {
+			return nil, false, err
+		}
+	}
+	return result, created, nil
+}
@@ -0,0 +1,219 @@
+package storage
+
+import (
+	"errors"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/adfharrison1/go-db/pkg/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStorageEngine_Upsert(t *testing.T) {
+	engine := NewStorageEngine(WithNoSaves(true))
+	defer engine.StopBackgroundWorkers()
+
+	filter := map[string]interface{}{"email": "alice@example.com", "age": map[string]interface{}{"$gte": 18}}
+	update := domain.Document{
+		"$set":         map[string]interface{}{"name": "Alice"},
+		"$setOnInsert": map[string]interface{}{"created_at": "2024-01-01T00:00:00Z", "age": 30},
+	}
+
+	doc, created, err := engine.Upsert("users", filter, update)
+	require.NoError(t, err)
+	assert.True(t, created)
+	assert.Equal(t, domain.Document{
+		"_id": "1", "email": "alice@example.com", "name": "Alice", "created_at": "2024-01-01T00:00:00Z", "age": 30,
+	}, doc, "the new document gets the filter's equality fields")
+
+	update["$set"] = map[string]interface{}{"name": "Alice Smith"}
+	update["$setOnInsert"] = map[string]interface{}{"created_at": "2025-06-01T00:00:00Z"}
+	doc, created, err = engine.Upsert("users", filter, update)
+	require.NoError(t, err)
+	assert.False(t, created)
+	assert.Equal(t, "Alice Smith", doc["name"])
+	assert.Equal(t, "2024-01-01T00:00:00Z", doc["created_at"], "$setOnInsert is skipped on update")
+
+	// Without $set fields a match is left unchanged; plain fields mean $set
+	doc, created, err = engine.Upsert("users", filter, domain.Document{"$setOnInsert": map[string]interface{}{"name": "Other"}})
+	require.NoError(t, err)
+	assert.False(t, created)
+	assert.Equal(t, "Alice Smith", doc["name"])
+
+	doc, created, err = engine.Upsert("users", map[string]interface{}{"email": "bob@example.com"}, domain.Document{"name": "Bob"})
+	require.NoError(t, err)
+	assert.True(t, created)
+	assert.Equal(t, domain.Document{"_id": "2", "email": "bob@example.com", "name": "Bob"}, doc)
+
+	result, err := engine.FindAll("users", nil, nil)
+	require.NoError(t, err)
+	assert.Len(t, result.Documents, 2)
+}
+
+func TestStorageEngine_Upsert_InvalidUpdate(t *testing.T) {
+	engine := NewStorageEngine(WithNoSaves(true))
+	defer engine.StopBackgroundWorkers()
+
+	filter := map[string]interface{}{"email": "alice@example.com"}
+	for _, update := range []domain.Document{
+		{"$setOnInsert": map[string]interface{}{"_id": "x"}},
+		{"$set": map[string]interface{}{"name": "A"}, "$setOnInsert": map[string]interface{}{"name": "B"}},
+		{"$set": map[string]interface{}{"name": "A"}, "name": "B"},
+	} {
+		_, _, err := engine.Upsert("users", filter, update)
+		assert.True(t, errors.Is(err, domain.ErrInvalidField), "update %v: %v", update, err)
+	}
+
+	_, _, err := engine.Upsert("users", filter, domain.Document{"$inc": map[string]interface{}{"n": 1}})
+	assert.ErrorContains(t, err, "unknown upsert operator $inc")
+	_, _, err = engine.Upsert("users", filter, domain.Document{"$set": "name"})
+	assert.ErrorContains(t, err, "$set must be an object")
+	_, _, err = engine.Upsert("users", map[string]interface{}{"age": map[string]interface{}{"$gt": true}}, domain.Document{})
+	assert.True(t, errors.Is(err, domain.ErrInvalidFilter), "got %v", err)
+
+	_, err = engine.GetCollection("users")
+	assert.Error(t, err, "nothing was created")
+}
+
+func TestStorageEngine_Upsert_Concurrent(t *testing.T) {
+	engine := NewStorageEngine(WithNoSaves(true))
+	defer engine.StopBackgroundWorkers()
+
+	var createdCount int32
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, created, err := engine.Upsert("users",
+				map[string]interface{}{"email": "bob@example.com"},
+				domain.Document{"$set": map[string]interface{}{"attempt": i}, "$setOnInsert": map[string]interface{}{"first": i}})
+			assert.NoError(t, err)
+			if created {
+				atomic.AddInt32(&createdCount, 1)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	assert.Equal(t, int32(1), createdCount)
+	ids, err := engine.FindIds("users", map[string]interface{}{"email": "bob@example.com"})
+	require.NoError(t, err)
+	assert.Len(t, ids, 1)
+}
+
+func TestStorageEngine_Upsert_Persists(t *testing.T) {
+	for name, options := range map[string][]StorageOption{
+		"DocumentSaves": nil,
+		"DeltaLog":      {WithDeltaLog(true)},
+	} {
+		t.Run(name, func(t *testing.T) {
+			tempDir := t.TempDir()
+			engine := NewStorageEngine(append([]StorageOption{WithDataDir(tempDir)}, options...)...)
+			defer engine.StopBackgroundWorkers()
+
+			filter := map[string]interface{}{"email": "alice@example.com"}
+			_, _, err := engine.Upsert("users", filter, domain.Document{"$set": map[string]interface{}{"visits": 1}, "$setOnInsert": map[string]interface{}{"first_visit": "monday"}})
+			require.NoError(t, err)
+			_, _, err = engine.Upsert("users", filter, domain.Document{"$set": map[string]interface{}{"visits": 2}, "$setOnInsert": map[string]interface{}{"first_visit": "tuesday"}})
+			require.NoError(t, err)
+
+			reloaded := NewStorageEngine(append([]StorageOption{WithDataDir(tempDir)}, options...)...)
+			defer reloaded.StopBackgroundWorkers()
+			require.NoError(t, reloaded.LoadCollectionMetadata(filepath.Join(tempDir, "missing.godb")))
+
+			doc, err := reloaded.GetById("users", "1")
+			require.NoError(t, err)
+			assert.EqualValues(t, 2, doc["visits"])
+			assert.Equal(t, "monday", doc["first_visit"])
+		})
+	}
+}
+
+func TestStorageEngine_UpsertById(t *testing.T) {
+	engine := NewStorageEngine(WithNoSaves(true))
+	defer engine.StopBackgroundWorkers()
+	_, err := engine.Insert("users", domain.Document{"name": "Alice"})
+	require.NoError(t, err)
+	require.NoError(t, engine.CreateIndex("users", "name"))
+
+	// A missing ID is inserted under that ID and indexed
+	doc, created, err := engine.UpsertById("users", "10", domain.Document{"name": "Bob", MaxKey: map[string]interface{}{"score": 5.0}})
+	require.NoError(t, err)
+	assert.True(t, created)
+	assert.Equal(t, "10", doc["_id"])
+	assert.Equal(t, 5.0, doc["score"])
+	ids, err := engine.FindIds("users", map[string]interface{}{"name": "Bob"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"10"}, ids)
+
+	// The counter skips past the caller's ID
+	next, err := engine.Insert("users", domain.Document{"name": "Carol"})
+	require.NoError(t, err)
+	assert.Equal(t, "11", next["_id"])
+
+	// An existing ID is updated, never changing _id
+	doc, created, err = engine.UpsertById("users", "10", domain.Document{"name": "Robert", "_id": "x", MaxKey: map[string]interface{}{"score": 3.0}})
+	require.NoError(t, err)
+	assert.False(t, created)
+	assert.Equal(t, "10", doc["_id"])
+	assert.Equal(t, "Robert", doc["name"])
+	assert.Equal(t, 5.0, doc["score"])
+	ids, err = engine.FindIds("users", map[string]interface{}{"name": "Bob"})
+	require.NoError(t, err)
+	assert.Empty(t, ids)
+
+	// A lower or non-numeric ID leaves the counter alone
+	_, _, err = engine.UpsertById("users", "5", domain.Document{"name": "Dave"})
+	require.NoError(t, err)
+	_, _, err = engine.UpsertById("users", "custom", domain.Document{"name": "Eve"})
+	require.NoError(t, err)
+	next, err = engine.Insert("users", domain.Document{"name": "Frank"})
+	require.NoError(t, err)
+	assert.Equal(t, "12", next["_id"])
+
+	// The upsert creates the collection
+	_, created, err = engine.UpsertById("archive", "1", domain.Document{"name": "Gina"})
+	require.NoError(t, err)
+	assert.True(t, created)
+
+	_, _, err = engine.UpsertById("users", "", domain.Document{"name": "Nobody"})
+	assert.ErrorIs(t, err, domain.ErrInvalidField)
+}
+
+func TestStorageEngine_UpsertById_Persists(t *testing.T) {
+	for name, options := range map[string][]StorageOption{
+		"DocumentSaves": nil,
+		"DeltaLog":      {WithDeltaLog(true)},
+	} {
+		t.Run(name, func(t *testing.T) {
+			tempDir := t.TempDir()
+			engine := NewStorageEngine(append([]StorageOption{WithDataDir(tempDir)}, options...)...)
+			defer engine.StopBackgroundWorkers()
+
+			_, err := engine.Insert("users", domain.Document{"name": "Alice"})
+			require.NoError(t, err)
+			_, _, err = engine.UpsertById("users", "20", domain.Document{"name": "Bob", "visits": 1})
+			require.NoError(t, err)
+			_, _, err = engine.UpsertById("users", "20", domain.Document{"visits": 2})
+			require.NoError(t, err)
+
+			reloaded := NewStorageEngine(append([]StorageOption{WithDataDir(tempDir)}, options...)...)
+			defer reloaded.StopBackgroundWorkers()
+			require.NoError(t, reloaded.LoadCollectionMetadata(filepath.Join(tempDir, "missing.godb")))
+
+			doc, err := reloaded.GetById("users", "20")
+			require.NoError(t, err)
+			assert.Equal(t, "Bob", doc["name"])
+			assert.EqualValues(t, 2, doc["visits"])
+
+			// The restored counter still skips past the caller's ID
+			next, err := reloaded.Insert("users", domain.Document{"name": "Carol"})
+			require.NoError(t, err)
+			assert.Equal(t, "21", next["_id"])
+		})
+	}
+}
@@ -1,26 +1,185 @@
 package storage
 
 import (
+	"context"
+	"fmt"
 	"strings"
 
 	"github.com/adfharrison1/go-db/pkg/domain"
 )
 
-// MatchesFilter checks if a document matches the given filter criteria
+// MatchesFilter checks if a document matches the given filter criteria. A field
+// the document does not hold under its exact name is resolved as a dotted path (see
+// fieldPathValues) and matches when any value the path names satisfies the
+// condition, so {"items.0.sku": "A"} tests the first item and {"items.sku": "A"}
+// any item.
 func MatchesFilter(doc domain.Document, filter map[string]interface{}) bool {
+	filter = ApplyCollation(filter)
 	for field, expectedValue := range filter {
+		if field == ExprFilterKey {
+			if !matchesExpr(doc, expectedValue) {
+				return false
+			}
+			continue
+		}
+
 		actualValue, exists := doc[field]
+		// A missing field never equals an excluded value, so it matches $ne and $nin
+		if excluded, bounds, ok := NeFilterValue(expectedValue); ok {
+			if !matchesNe(presentFieldValues(doc, field), excluded, bounds) {
+				return false
+			}
+			continue
+		}
+		if excluded, ok := NinFilterValues(expectedValue); ok {
+			if !matchesNin(presentFieldValues(doc, field), excluded) {
+				return false
+			}
+			continue
+		}
 		if !exists {
-			return false // Field doesn't exist in document
+			if !isFieldPath(field) {
+				return false // Field doesn't exist in document
+			}
+			if !matchesAnyElement(fieldPathValues(doc, field), func(value interface{}) bool {
+				return matchesValue(value, expectedValue)
+			}) {
+				return false // No value on the path matches
+			}
+			continue
 		}
 
-		if !ValuesMatch(actualValue, expectedValue) {
-			return false // Values don't match
+		if !matchesValue(actualValue, expectedValue) {
+			return false
 		}
 	}
 	return true // All filter criteria match
 }
 
+// presentFieldValues returns the values a filter field names in a document: the
+// field's value, the values of a dotted path, or none when the document lacks it
+func presentFieldValues(doc domain.Document, field string) []interface{} {
+	if value, exists := doc[field]; exists {
+		return []interface{}{value}
+	}
+	if isFieldPath(field) {
+		return fieldPathValues(doc, field)
+	}
+	return nil
+}
+
+// matchesValue reports whether a field value satisfies one filter value: a
+// $contains or $elemMatch operator, or a condition the value or any of its array
+// elements must meet
+func matchesValue(actualValue, expectedValue interface{}) bool {
+	if value, ok := ContainsFilterValue(expectedValue); ok {
+		return matchesContains(actualValue, value) // An array holding the value
+	}
+	if elementFilter, ok := ElemMatchFilter(expectedValue); ok {
+		return matchesElemMatch(actualValue, elementFilter) // An array element matching every condition
+	}
+	return matchesFieldValue(actualValue, expectedValue) // The value or any array element
+}
+
+// matchesCondition reports whether a single value satisfies a filter condition:
+// a schema time condition, a collated condition, a range, an $in list, a $regex or
+// equality
+func matchesCondition(actual, expected interface{}) bool {
+	if condition, ok := expected.(*timeCondition); ok {
+		return condition.matches(actual)
+	}
+	if condition, ok := expected.(*collatedCondition); ok {
+		return condition.matches(actual)
+	}
+	if pattern, ok, err := RegexFilterPattern(expected); ok {
+		return err == nil && matchesRegex(actual, pattern)
+	}
+	if bounds, ok := RangeFilterBounds(expected); ok {
+		return matchesRange(actual, bounds, CompareValues)
+	}
+	if values, ok := InFilterValues(expected); ok {
+		return matchesAny(actual, values)
+	}
+	return ValuesMatch(actual, expected)
+}
+
+// IsFilterCondition reports whether a filter value is a condition, such as $in, a
+// range or a condition built by ApplySchema or ApplyCollation, rather than a value
+// to test equality with
+func IsFilterCondition(value interface{}) bool {
+	if _, ok := value.(*timeCondition); ok {
+		return true
+	}
+	if _, ok := value.(*collatedCondition); ok {
+		return true
+	}
+	_, ok := value.(map[string]interface{})
+	return ok
+}
+
+// matchesExpr evaluates an $expr predicate against a document.
+// Documents that trigger a runtime type error (e.g. a missing field) do not match.
+func matchesExpr(doc domain.Document, source interface{}) bool {
+	src, ok := source.(string)
+	if !ok {
+		return false
+	}
+	compiled, err := CompileExpr(src)
+	if err != nil {
+		return false
+	}
+	matched, err := compiled.Matches(doc)
+	return err == nil && matched
+}
+
+// ValidateFilter checks that any special filter operators are well formed
+// so that malformed queries are rejected rather than silently matching nothing
+func ValidateFilter(filter map[string]interface{}) error {
+	for field, expectedValue := range filter {
+		if err := validateInFilter(field, expectedValue); err != nil {
+			return err
+		}
+		if err := validateNeFilter(field, expectedValue); err != nil {
+			return err
+		}
+		if err := validateRangeFilter(field, expectedValue); err != nil {
+			return err
+		}
+		if err := validateContainsFilter(field, expectedValue); err != nil {
+			return err
+		}
+		if err := validateElemMatchFilter(field, expectedValue); err != nil {
+			return err
+		}
+		if err := validateRegexFilter(field, expectedValue); err != nil {
+			return err
+		}
+	}
+
+	if err := validateCollationFilter(filter); err != nil {
+		return err
+	}
+
+	source, exists := filter[ExprFilterKey]
+	if !exists {
+		return nil
+	}
+	src, ok := source.(string)
+	if !ok {
+		return fmt.Errorf("%w: %s must be a string expression", domain.ErrInvalidFilter, ExprFilterKey)
+	}
+	if _, err := CompileExpr(src); err != nil {
+		return fmt.Errorf("%w: %s: %v", domain.ErrInvalidFilter, ExprFilterKey, err)
+	}
+	return nil
+}
+
+// SupportedFilterOperators lists the special operators accepted in filters
+// alongside plain field equality
+func SupportedFilterOperators() []string {
+	return []string{InFilterKey, GtFilterKey, GteFilterKey, LtFilterKey, LteFilterKey, NeFilterKey, NinFilterKey, RegexFilterKey, ContainsFilterKey, ElemMatchFilterKey, ExprFilterKey, CollationFilterKey}
+}
+
 // ValuesMatch compares two values for equality, handling different types
 func ValuesMatch(actual, expected interface{}) bool {
 	// Handle nil values
@@ -45,7 +204,10 @@ func ValuesMatch(actual, expected interface{}) bool {
 		}
 	}
 
-	// Default to direct comparison
+	// Default to direct comparison; maps and slices never equal each other
+	if !isComparable(actual) || !isComparable(expected) {
+		return false
+	}
 	return actual == expected
 }
 
@@ -58,12 +220,20 @@ func ToFloat64(value interface{}) (float64, bool) {
 		return float64(v), true
 	case int:
 		return float64(v), true
+	case int8:
+		return float64(v), true
+	case int16:
+		return float64(v), true
 	case int32:
 		return float64(v), true
 	case int64:
 		return float64(v), true
 	case uint:
 		return float64(v), true
+	case uint8:
+		return float64(v), true
+	case uint16:
+		return float64(v), true
 	case uint32:
 		return float64(v), true
 	case uint64:
@@ -73,8 +243,23 @@ func ToFloat64(value interface{}) (float64, bool) {
 	}
 }
 
-// IntersectStringSlices returns the intersection of multiple string slices
-// This is used for index intersection in multi-field queries
+// scanContextCheckInterval controls how often long scans poll their context
+const scanContextCheckInterval = 256
+
+// checkScanContext returns the context error every scanContextCheckInterval
+// documents so that long scans can be abandoned without polling on every document
+func checkScanContext(ctx context.Context, scanned int) error {
+	if scanned%scanContextCheckInterval != 0 {
+		return nil
+	}
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("query aborted: %w", err)
+	}
+	return nil
+}
+
+// IntersectStringSlices returns the intersection of multiple string slices, in the
+// order of the first slice. This is used for index intersection in multi-field queries
 func IntersectStringSlices(slices ...[]string) []string {
 	if len(slices) == 0 {
 		return nil
@@ -96,11 +281,51 @@ func IntersectStringSlices(slices ...[]string) []string {
 	// Find IDs that appear in all slices (count equals number of slices)
 	var result []string
 	expectedCount := len(slices)
-	for id, count := range countMap {
-		if count == expectedCount {
+	for _, id := range slices[0] {
+		if countMap[id] == expectedCount {
 			result = append(result, id)
+			delete(countMap, id)
 		}
 	}
 
 	return result
 }
+
+// CopyDocument returns a deep copy of a document; nested maps and slices are copied
+func CopyDocument(doc domain.Document) domain.Document {
+	copied := make(domain.Document, len(doc))
+	for field, value := range doc {
+		copied[field] = copyValue(value)
+	}
+	return copied
+}
+
+// copyDocuments deep copies each document of a result
+func copyDocuments(docs []domain.Document) []domain.Document {
+	copied := make([]domain.Document, len(docs))
+	for i, doc := range docs {
+		copied[i] = CopyDocument(doc)
+	}
+	return copied
+}
+
+func copyValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		copied := make(map[string]interface{}, len(v))
+		for key, inner := range v {
+			copied[key] = copyValue(inner)
+		}
+		return copied
+	case domain.Document:
+		return CopyDocument(v)
+	case []interface{}:
+		copied := make([]interface{}, len(v))
+		for i, inner := range v {
+			copied[i] = copyValue(inner)
+		}
+		return copied
+	default:
+		return value
+	}
+}
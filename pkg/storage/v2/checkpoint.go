@@ -6,6 +6,7 @@ import (
 	"os"
 	"path/filepath"
 	"sort"
+	"sync/atomic"
 	"time"
 )
 
@@ -17,10 +18,13 @@ func NewCheckpointManager(engine *StorageEngine) *CheckpointManager {
 		threshold:      engine.checkpointThreshold,
 		maxWALSize:     engine.maxWALSize,
 		lastCheckpoint: time.Now(),
+		trigger:        make(chan struct{}, 1),
 	}
 }
 
-// Run starts the checkpoint manager background worker
+// Run starts the checkpoint manager background worker. A checkpoint is taken on
+// whichever comes first: the interval elapsing with writes pending, the WAL entry
+// threshold, or maxWALSize bytes appended since the last checkpoint.
 func (cm *CheckpointManager) Run() {
 	defer cm.engine.backgroundWg.Done()
 
@@ -34,6 +38,12 @@ func (cm *CheckpointManager) Run() {
 				// Log error but continue running
 				fmt.Printf("Checkpoint failed: %v\n", err)
 			}
+		case <-cm.trigger:
+			if err := cm.Checkpoint(); err != nil {
+				fmt.Printf("Checkpoint failed: %v\n", err)
+			}
+			// The interval counts from the latest checkpoint, whatever triggered it
+			ticker.Reset(cm.interval)
 		case <-cm.engine.stopChan:
 			// Perform final checkpoint before shutdown
 			if err := cm.Checkpoint(); err != nil {
@@ -44,7 +54,7 @@ func (cm *CheckpointManager) Run() {
 	}
 }
 
-// Checkpoint performs a checkpoint operation
+// Checkpoint performs a checkpoint operation if one is due
 func (cm *CheckpointManager) Checkpoint() error {
 	cm.mu.Lock()
 	defer cm.mu.Unlock()
@@ -53,17 +63,38 @@ func (cm *CheckpointManager) Checkpoint() error {
 	if !cm.shouldCheckpoint() {
 		return nil
 	}
+	return cm.checkpointLocked()
+}
 
+// ForceCheckpoint performs a checkpoint operation whether or not one is due
+func (cm *CheckpointManager) ForceCheckpoint() error {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	return cm.checkpointLocked()
+}
+
+// checkpointLocked writes a checkpoint and cleans up the WAL files it covers.
+// Caller must hold cm.mu.
+func (cm *CheckpointManager) checkpointLocked() error {
 	start := time.Now()
+	// Taken before the collections are exported, so writes racing with the export
+	// count toward the next checkpoint rather than being forgotten, and are replayed
+	// on recovery rather than lost. Writes between their WAL append and memory update
+	// are waited for first, so every entry before lsn is in the export.
+	cm.engine.applyMu.Lock()
+	walBytes := cm.engine.walEngine.GetBytesWritten()
+	lsn := cm.engine.walEngine.GetCurrentLSN()
+	cm.engine.applyMu.Unlock()
 	defer func() {
 		cm.lastCheckpoint = time.Now()
+		atomic.StoreInt64(&cm.lastCheckpointBytes, walBytes)
 		cm.engine.updateStats(func(s *StorageStats) {
 			s.CheckpointsPerformed++
 			s.LastCheckpoint = cm.lastCheckpoint
 		})
 	}()
 
-	// Get all collections to checkpoint
+	// Get the current state of every collection
 	collections := cm.getCollectionsToCheckpoint()
 
 	// Export indexes
@@ -74,13 +105,18 @@ func (cm *CheckpointManager) Checkpoint() error {
 		Timestamp:   time.Now(),
 		Collections: collections,
 		Indexes:     indexes,
-		LSN:         cm.engine.walEngine.GetCurrentLSN(),
+		LSN:         lsn,
 	}
 
 	// Write checkpoint to disk
-	if err := cm.writeCheckpoint(checkpointData); err != nil {
+	written, err := cm.writeCheckpoint(checkpointData)
+	if err != nil {
 		return fmt.Errorf("failed to write checkpoint: %w", err)
 	}
+	cm.engine.updateStats(func(s *StorageStats) {
+		s.LastCheckpointBytes = written
+	})
+	atomic.StoreInt64(&cm.lastCheckpointLSN, checkpointData.LSN)
 
 	// Clean up old WAL files
 	if err := cm.cleanupOldWALFiles(); err != nil {
@@ -125,35 +161,100 @@ type CollectionData struct {
 // Private methods
 
 func (cm *CheckpointManager) shouldCheckpoint() bool {
-	// Check time-based checkpoint
-	if time.Since(cm.lastCheckpoint) >= cm.interval {
-		return true
-	}
+	return cm.dueTrigger() != ""
+}
 
-	// Check WAL size-based checkpoint
-	walFiles, err := cm.engine.walEngine.GetWALFiles()
-	if err != nil {
-		return false
+// Checkpoint triggers reported by NextCheckpoint
+const (
+	CheckpointTriggerNone       = "none"
+	CheckpointTriggerInterval   = "interval"
+	CheckpointTriggerWALEntries = "wal_entries"
+	CheckpointTriggerWALSize    = "wal_size"
+)
+
+// walSinceCheckpoint returns the WAL entries and bytes appended since the last checkpoint
+func (cm *CheckpointManager) walSinceCheckpoint() (entries, bytes int64) {
+	entries = cm.engine.walEngine.GetCurrentLSN() - atomic.LoadInt64(&cm.lastCheckpointLSN)
+	bytes = cm.engine.walEngine.GetBytesWritten() - atomic.LoadInt64(&cm.lastCheckpointBytes)
+	return entries, bytes
+}
+
+// volumeTrigger returns the WAL volume trigger that has been reached, if any
+func (cm *CheckpointManager) volumeTrigger() string {
+	entries, bytes := cm.walSinceCheckpoint()
+	if cm.threshold > 0 && entries >= int64(cm.threshold) {
+		return CheckpointTriggerWALEntries
+	}
+	if cm.maxWALSize > 0 && bytes >= cm.maxWALSize {
+		return CheckpointTriggerWALSize
 	}
+	return ""
+}
 
-	totalSize := int64(0)
-	for _, file := range walFiles {
-		if info, err := os.Stat(file); err == nil {
-			totalSize += info.Size()
+// dueTrigger returns the reason a checkpoint is due, or "" if none is. The interval
+// only counts while there is something to checkpoint, so an idle engine stays quiet.
+// The caller must hold cm.mu.
+func (cm *CheckpointManager) dueTrigger() string {
+	if trigger := cm.volumeTrigger(); trigger != "" {
+		return trigger
+	}
+	if time.Since(cm.lastCheckpoint) >= cm.interval {
+		if entries, _ := cm.walSinceCheckpoint(); entries > 0 || cm.getDirtyCollectionCount() > 0 {
+			return CheckpointTriggerInterval
 		}
 	}
+	return ""
+}
 
-	if totalSize >= cm.maxWALSize {
-		return true
+// noteWALAppend is called by the WAL after every append. It wakes Run once a volume
+// trigger is reached, so checkpoints keep up with write bursts between ticks.
+func (cm *CheckpointManager) noteWALAppend() {
+	if cm.volumeTrigger() == "" {
+		return
 	}
+	select {
+	case cm.trigger <- struct{}{}:
+	default:
+		// A checkpoint is already pending
+	}
+}
 
-	// Check dirty collections threshold
-	dirtyCount := cm.getDirtyCollectionCount()
-	if dirtyCount >= cm.threshold {
-		return true
+// NextCheckpoint reports progress toward each checkpoint trigger and which one is
+// expected to fire next: the volume trigger closest to its limit if that is nearer,
+// proportionally, than the interval; otherwise the interval. With nothing written
+// since the last checkpoint the trigger is "none".
+func (cm *CheckpointManager) NextCheckpoint() map[string]interface{} {
+	cm.mu.RLock()
+	lastCheckpoint := cm.lastCheckpoint
+	cm.mu.RUnlock()
+
+	entries, bytes := cm.walSinceCheckpoint()
+	dueAt := lastCheckpoint.Add(cm.interval)
+
+	trigger := CheckpointTriggerInterval
+	if entries == 0 {
+		trigger = CheckpointTriggerNone
+	}
+	progress := float64(time.Since(lastCheckpoint)) / float64(cm.interval)
+	if cm.threshold > 0 {
+		if p := float64(entries) / float64(cm.threshold); p > progress {
+			trigger, progress = CheckpointTriggerWALEntries, p
+		}
+	}
+	if cm.maxWALSize > 0 {
+		if p := float64(bytes) / float64(cm.maxWALSize); p > progress {
+			trigger = CheckpointTriggerWALSize
+		}
 	}
 
-	return false
+	return map[string]interface{}{
+		"trigger":               trigger,
+		"interval_due_at":       dueAt,
+		"wal_entries_since":     entries,
+		"wal_entries_threshold": cm.threshold,
+		"wal_bytes_since":       bytes,
+		"wal_bytes_threshold":   cm.maxWALSize,
+	}
 }
 
 func (cm *CheckpointManager) getDirtyCollectionCount() int {
@@ -169,6 +270,10 @@ func (cm *CheckpointManager) getDirtyCollectionCount() int {
 	return count
 }
 
+// getCollectionsToCheckpoint returns the documents of every collection, not just those
+// written since the last checkpoint: recovery restores the latest checkpoint alone and
+// skips the WAL before its LSN, so a document's update history collapses into its
+// current value and clean collections must be carried forward too
 func (cm *CheckpointManager) getCollectionsToCheckpoint() map[string]*CollectionData {
 	cm.engine.collectionsMu.RLock()
 	defer cm.engine.collectionsMu.RUnlock()
@@ -176,11 +281,6 @@ func (cm *CheckpointManager) getCollectionsToCheckpoint() map[string]*Collection
 	collections := make(map[string]*CollectionData)
 
 	for name, collInfo := range cm.engine.collections {
-		// Only checkpoint dirty collections
-		if collInfo.State != CollectionStateDirty {
-			continue
-		}
-
 		// Get documents from memory manager
 		documents, err := cm.engine.memoryMgr.GetAllDocuments(name)
 		if err != nil {
@@ -203,7 +303,9 @@ func (cm *CheckpointManager) getCollectionsToCheckpoint() map[string]*Collection
 	return collections
 }
 
-func (cm *CheckpointManager) writeCheckpoint(data *CheckpointData) error {
+// writeCheckpoint writes a checkpoint file and points latest_checkpoint.json at it,
+// returning the size of the file
+func (cm *CheckpointManager) writeCheckpoint(data *CheckpointData) (int64, error) {
 	// Create checkpoint filename
 	filename := fmt.Sprintf("checkpoint_%d.json", data.Timestamp.Unix())
 	filePath := filepath.Join(cm.engine.checkpointDir, filename)
@@ -211,18 +313,27 @@ func (cm *CheckpointManager) writeCheckpoint(data *CheckpointData) error {
 	// Serialize checkpoint data
 	jsonData, err := json.MarshalIndent(data, "", "  ")
 	if err != nil {
-		return fmt.Errorf("failed to marshal checkpoint data: %w", err)
+		return 0, fmt.Errorf("failed to marshal checkpoint data: %w", err)
 	}
 
+	// With full durability the checkpoint reaches disk before the WAL files it covers
+	// are deleted, as WAL entries do before they are applied
+	sync := cm.engine.durabilityLevel == DurabilityFull
+
 	// Write to temporary file first
 	tempFile := filePath + ".tmp"
-	if err := os.WriteFile(tempFile, jsonData, 0644); err != nil {
-		return fmt.Errorf("failed to write temporary checkpoint file: %w", err)
+	if err := writeCheckpointFile(tempFile, jsonData, sync); err != nil {
+		return 0, fmt.Errorf("failed to write temporary checkpoint file: %w", err)
 	}
 
 	// Atomic rename
 	if err := os.Rename(tempFile, filePath); err != nil {
-		return fmt.Errorf("failed to rename checkpoint file: %w", err)
+		return 0, fmt.Errorf("failed to rename checkpoint file: %w", err)
+	}
+	if sync {
+		if err := syncDir(cm.engine.checkpointDir); err != nil {
+			return 0, fmt.Errorf("failed to sync checkpoint directory: %w", err)
+		}
 	}
 
 	// Update latest checkpoint symlink
@@ -233,7 +344,33 @@ func (cm *CheckpointManager) writeCheckpoint(data *CheckpointData) error {
 		fmt.Printf("Failed to create latest checkpoint symlink: %v\n", err)
 	}
 
-	return nil
+	return int64(len(jsonData)), nil
+}
+
+// writeCheckpointFile writes data to filename, fsyncing it before closing when sync is set
+func writeCheckpointFile(filename string, data []byte, sync bool) error {
+	file, err := os.OpenFile(filename, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(data)
+	if err == nil && sync {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// syncDir fsyncs a directory so the renames and removals in it are on disk
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
 }
 
 func (cm *CheckpointManager) cleanupOldWALFiles() error {
@@ -303,8 +440,9 @@ func (cm *CheckpointManager) isWALFileSafeToDelete(walFile string, checkpointLSN
 		}
 	}
 
-	// WAL file is safe to delete if its max LSN is less than or equal to checkpoint LSN
-	return maxLSN <= checkpointLSN
+	// WAL file is safe to delete if all its entries are before the checkpoint LSN, the
+	// first entry recovery replays
+	return maxLSN < checkpointLSN
 }
 
 // LoadCheckpoint loads the latest checkpoint
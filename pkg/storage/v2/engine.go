@@ -1,21 +1,37 @@
 package v2
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"log"
 	"os"
+	"sort"
+	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/adfharrison1/go-db/pkg/domain"
 	"github.com/adfharrison1/go-db/pkg/indexing"
+	"github.com/adfharrison1/go-db/pkg/storage"
 )
 
 // NewStorageEngine creates a new v2 storage engine with WAL
 func NewStorageEngine(options ...StorageOption) *StorageEngine {
 	engine := &StorageEngine{
 		collections:              make(map[string]*CollectionInfo),
+		defaultFilters:           make(map[string]map[string]interface{}),
+		documentDefaults:         make(map[string]domain.Document),
+		schemas:                  make(map[string]map[string]domain.FieldType),
+		strictSchemas:            make(map[string]bool),
+		capped:                   make(map[string]*storage.CappedTracker),
+		idKeysets:                storage.NewIDKeysets(),
+		changeLog:                storage.NewChangeLog(storage.DefaultChangeLogSize),
+		documentLocks:            make(map[string]*documentLock),
+		conditionalInsertLocks:   make(map[string]*sync.Mutex),
+		uniqueKeyLocks:           make(map[string]*sync.RWMutex),
+		lockStats:                make(map[string]*collectionLockCounters),
+		pinned:                   make(map[string]bool),
 		indexEngine:              indexing.NewIndexEngine(),
 		walDir:                   "./wal",
 		dataDir:                  ".",
@@ -40,7 +56,9 @@ func NewStorageEngine(options ...StorageOption) *StorageEngine {
 
 	// Initialize components
 	engine.walEngine = NewWALEngine(engine.walDir, engine.durabilityLevel, engine.compressionEnabled)
+	engine.walEngine.perCollection = engine.perCollectionWAL
 	engine.checkpointMgr = NewCheckpointManager(engine)
+	engine.walEngine.onAppend = engine.checkpointMgr.noteWALAppend
 	engine.recoveryMgr = NewRecoveryManager(engine)
 	engine.memoryMgr = NewMemoryManager(engine)
 
@@ -63,8 +81,28 @@ func NewStorageEngine(options ...StorageOption) *StorageEngine {
 	return engine
 }
 
+// InsertContext implements domain.StorageEngine. Writes are made durable through
+// the WAL before returning, so there is no background retry to tag with the request ID.
+// A ctx from domain.WithDurableWrite fsyncs the WAL entry whatever the durability level,
+// and one from WithWriteDurability applies its level in place of the engine's.
+func (se *StorageEngine) InsertContext(ctx context.Context, collName string, doc domain.Document) (domain.Document, error) {
+	return se.insert(collName, doc, durabilityOf(ctx))
+}
+
 // Insert implements domain.StorageEngine
 func (se *StorageEngine) Insert(collName string, doc domain.Document) (domain.Document, error) {
+	return se.insert(collName, doc, writeDurability{})
+}
+
+// insert writes a new document through the WAL, memory and indexes, applying
+// durability to its WAL entry
+func (se *StorageEngine) insert(collName string, doc domain.Document, durability writeDurability) (domain.Document, error) {
+	release, err := se.writeLimiter.Acquire(context.Background(), collName)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
 	se.collectionsMu.RLock()
 	_, exists := se.collections[collName]
 	se.collectionsMu.RUnlock()
@@ -75,11 +113,22 @@ func (se *StorageEngine) Insert(collName string, doc domain.Document) (domain.Do
 		}
 	}
 
+	// Fill in collection defaults before the ID is assigned and indexes are updated
+	se.applyDocumentDefaults(collName, doc)
+	if err := se.checkStrictSchema(collName, doc); err != nil {
+		return nil, err
+	}
+
 	// Generate ID if not provided
 	if doc["_id"] == nil {
 		doc["_id"] = se.generateDocumentID(collName)
 	}
 
+	defer se.lockUniqueKeys(collName)()
+	if err := se.indexEngine.CheckUnique(collName, []string{doc["_id"].(string)}, []domain.Document{doc}); err != nil {
+		return nil, err
+	}
+
 	// Create WAL entry
 	entry := &WALEntry{
 		Type:       WALEntryInsert,
@@ -87,21 +136,21 @@ func (se *StorageEngine) Insert(collName string, doc domain.Document) (domain.Do
 		Collection: collName,
 		DocumentID: doc["_id"].(string),
 		Document:   doc,
+		durability: durability,
 	}
 
-	// Write to WAL
-	if err := se.walEngine.WriteEntry(entry); err != nil {
-		return nil, fmt.Errorf("failed to write WAL entry: %w", err)
-	}
-
-	// Update in-memory collection
-	if err := se.memoryMgr.InsertDocument(collName, doc); err != nil {
-		return nil, fmt.Errorf("failed to insert document in memory: %w", err)
+	// Write to WAL, then update the in-memory collection and indexes
+	err = se.logAndApply(entry, func() error {
+		if err := se.memoryMgr.InsertDocument(collName, doc); err != nil {
+			return fmt.Errorf("failed to insert document in memory: %w", err)
+		}
+		se.updateIndexesForDocument(collName, doc["_id"].(string), nil, doc)
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	// Update indexes
-	se.updateIndexesForDocument(collName, doc["_id"].(string), nil, doc)
-
 	// Update collection metadata
 	se.updateCollectionMetadata(collName, 1)
 
@@ -110,11 +159,267 @@ func (se *StorageEngine) Insert(collName string, doc domain.Document) (domain.Do
 		s.WALBytesWritten += int64(len(fmt.Sprintf("%+v", doc)))
 	})
 
+	se.trackInserts(collName, doc)
 	return doc, nil
 }
 
+// logAndApply writes entry to the WAL and then runs apply, which brings memory and
+// indexes up to date with it. A checkpoint waits for calls in progress before it reads
+// the WAL position, so every entry before the checkpoint's LSN is in the checkpoint.
+// A nil entry writes nothing to the WAL. apply must not write to the WAL.
+func (se *StorageEngine) logAndApply(entry *WALEntry, apply func() error) error {
+	se.applyMu.RLock()
+	defer se.applyMu.RUnlock()
+
+	if entry != nil {
+		if err := se.walEngine.WriteEntry(entry); err != nil {
+			return fmt.Errorf("failed to write WAL entry: %w", err)
+		}
+	}
+	return apply()
+}
+
+// InsertIfNotExists implements domain.StorageEngine
+func (se *StorageEngine) InsertIfNotExists(collName string, filter map[string]interface{}, doc domain.Document) (domain.Document, bool, error) {
+	return se.InsertIfNotExistsContext(context.Background(), collName, filter, doc)
+}
+
+// InsertIfNotExistsContext implements domain.StorageEngine. Conditional inserts into
+// a collection are serialized with each other, so concurrent calls with the same
+// filter create at most one document; plain inserts are not held back by them.
+func (se *StorageEngine) InsertIfNotExistsContext(ctx context.Context, collName string, filter map[string]interface{}, doc domain.Document) (domain.Document, bool, error) {
+	if err := storage.ValidateFilter(filter); err != nil {
+		return nil, false, err
+	}
+
+	defer se.lockConditionalInsert(collName)()
+
+	se.collectionsMu.RLock()
+	_, exists := se.collections[collName]
+	se.collectionsMu.RUnlock()
+
+	if exists {
+		ids, err := se.FindIdsContext(ctx, collName, filter)
+		if err != nil {
+			return nil, false, err
+		}
+		if len(ids) > 0 {
+			existing, err := se.GetById(collName, ids[0])
+			if err != nil {
+				return nil, false, err
+			}
+			return storage.CopyDocument(existing), false, nil
+		}
+	}
+
+	created, err := se.insert(collName, doc, durabilityOf(ctx))
+	if err != nil {
+		return nil, false, err
+	}
+	return created, true, nil
+}
+
+// lockConditionalInsert takes the lock serializing a collection's conditional
+// inserts and upserts, creating it if needed, and returns the matching unlock function
+func (se *StorageEngine) lockConditionalInsert(collName string) func() {
+	se.conditionalInsertMu.Lock()
+	lock, exists := se.conditionalInsertLocks[collName]
+	if !exists {
+		lock = &sync.Mutex{}
+		se.conditionalInsertLocks[collName] = lock
+	}
+	se.conditionalInsertMu.Unlock()
+
+	counters := se.lockCounters(collName)
+	counters.collection.Lock(lock)
+	return func() { counters.collection.Unlock(lock) }
+}
+
+// uniqueKeyLock returns the lock guarding a collection's unique index keys, creating
+// it if needed
+func (se *StorageEngine) uniqueKeyLock(collName string) *sync.RWMutex {
+	se.uniqueKeyMu.Lock()
+	defer se.uniqueKeyMu.Unlock()
+
+	lock, exists := se.uniqueKeyLocks[collName]
+	if !exists {
+		lock = &sync.RWMutex{}
+		se.uniqueKeyLocks[collName] = lock
+	}
+	return lock
+}
+
+// lockUniqueKeys takes the lock a write holds from checking its unique index keys
+// until it is applied, and returns the matching unlock function. Writes share it while
+// the collection has no unique index; otherwise they hold it one at a time, so two
+// cannot both claim a key. Creating a unique index holds it exclusively too.
+func (se *StorageEngine) lockUniqueKeys(collName string) func() {
+	lock := se.uniqueKeyLock(collName)
+	lock.RLock()
+	if !se.indexEngine.HasUniqueIndex(collName) {
+		return lock.RUnlock
+	}
+	lock.RUnlock()
+	lock.Lock()
+	return lock.Unlock
+}
+
+// collectionLockCounters counts the holders of and waiters for a collection's locks
+type collectionLockCounters struct {
+	collection storage.LockCounters // Conditional insert lock
+	documents  storage.LockCounters
+}
+
+// lockCounters returns a collection's lock counters, creating them if needed
+func (se *StorageEngine) lockCounters(collName string) *collectionLockCounters {
+	se.lockCountersMu.Lock()
+	defer se.lockCountersMu.Unlock()
+
+	counters, exists := se.lockStats[collName]
+	if !exists {
+		counters = &collectionLockCounters{}
+		se.lockStats[collName] = counters
+	}
+	return counters
+}
+
+// LockStats implements domain.StorageEngine. The collection counts cover the lock
+// serializing conditional inserts and upserts, as v2 has no other collection-wide
+// lock; reads take document locks only with ConsistencyLinearizable.
+func (se *StorageEngine) LockStats() []domain.CollectionLockStats {
+	se.lockCountersMu.Lock()
+	stats := make([]domain.CollectionLockStats, 0, len(se.lockStats))
+	for name, counters := range se.lockStats {
+		stats = append(stats, domain.CollectionLockStats{
+			Name:       name,
+			Collection: counters.collection.Stats(),
+			Documents:  counters.documents.Stats(),
+		})
+	}
+	se.lockCountersMu.Unlock()
+
+	storage.SortLockStats(stats)
+	return stats
+}
+
+// Upsert implements domain.StorageEngine
+func (se *StorageEngine) Upsert(collName string, filter map[string]interface{}, update domain.Document) (domain.Document, bool, error) {
+	return se.UpsertContext(context.Background(), collName, filter, update)
+}
+
+// UpsertContext implements domain.StorageEngine. Upserts are serialized with the
+// collection's conditional inserts, so concurrent upserts with the same filter create
+// at most one document. A ctx from domain.WithDurableWrite fsyncs the WAL entry
+// whatever the durability level.
+func (se *StorageEngine) UpsertContext(ctx context.Context, collName string, filter map[string]interface{}, update domain.Document) (domain.Document, bool, error) {
+	set, setOnInsert, err := storage.ParseUpsertUpdate(update)
+	if err != nil {
+		return nil, false, err
+	}
+	if err := storage.ValidateFilter(filter); err != nil {
+		return nil, false, err
+	}
+
+	defer se.lockConditionalInsert(collName)()
+
+	se.collectionsMu.RLock()
+	_, exists := se.collections[collName]
+	se.collectionsMu.RUnlock()
+
+	if exists {
+		ids, err := se.FindIdsContext(ctx, collName, filter)
+		if err != nil {
+			return nil, false, err
+		}
+		if len(ids) > 0 {
+			if len(set) == 0 {
+				existing, err := se.GetById(collName, ids[0])
+				if err != nil {
+					return nil, false, err
+				}
+				return storage.CopyDocument(existing), false, nil
+			}
+			updated, err := se.updateById(collName, ids[0], set, durabilityOf(ctx))
+			if err != nil {
+				return nil, false, err
+			}
+			return updated, false, nil
+		}
+	}
+
+	created, err := se.insert(collName, storage.UpsertInsertDocument(filter, set, setOnInsert), durabilityOf(ctx))
+	if err != nil {
+		return nil, false, err
+	}
+	return created, true, nil
+}
+
+// UpsertById implements domain.StorageEngine
+func (se *StorageEngine) UpsertById(collName, docId string, doc domain.Document) (domain.Document, bool, error) {
+	return se.UpsertByIdContext(context.Background(), collName, docId, doc)
+}
+
+// UpsertByIdContext implements domain.StorageEngine. Generated IDs are not numeric,
+// so a caller's ID never collides with a later generated one.
+func (se *StorageEngine) UpsertByIdContext(ctx context.Context, collName, docId string, doc domain.Document) (domain.Document, bool, error) {
+	if docId == "" {
+		return nil, false, domain.Errorf(domain.ErrInvalidField, "document ID cannot be empty")
+	}
+
+	defer se.lockConditionalInsert(collName)()
+
+	se.collectionsMu.RLock()
+	_, exists := se.collections[collName]
+	se.collectionsMu.RUnlock()
+
+	if exists && se.DocumentExists(collName, docId, nil) {
+		updates := doc
+		if _, exists := updates["_id"]; exists {
+			updates = storage.CopyDocument(updates)
+			delete(updates, "_id")
+		}
+		updated, err := se.updateById(collName, docId, updates, durabilityOf(ctx))
+		if err != nil {
+			return nil, false, err
+		}
+		return updated, false, nil
+	}
+
+	// Operators resolve against an empty document when the upsert creates one
+	insertDoc, err := storage.ResolveUpdate(domain.Document{}, doc)
+	if err != nil {
+		return nil, false, err
+	}
+	insertDoc = storage.CopyDocument(insertDoc)
+	insertDoc["_id"] = docId
+	created, err := se.insert(collName, insertDoc, durabilityOf(ctx))
+	if err != nil {
+		return nil, false, err
+	}
+	return created, true, nil
+}
+
+// BatchInsertContext implements domain.StorageEngine. The batch is one WAL entry: a
+// ctx from domain.WithDurableWrite fsyncs it whatever the durability level, and one
+// from WithWriteDurability applies its level in place of the engine's.
+func (se *StorageEngine) BatchInsertContext(ctx context.Context, collName string, docs []domain.Document) ([]domain.Document, error) {
+	return se.batchInsert(collName, docs, durabilityOf(ctx))
+}
+
 // BatchInsert implements domain.StorageEngine
 func (se *StorageEngine) BatchInsert(collName string, docs []domain.Document) ([]domain.Document, error) {
+	return se.batchInsert(collName, docs, writeDurability{})
+}
+
+// batchInsert writes documents through one WAL entry, memory and indexes, applying
+// durability to the entry
+func (se *StorageEngine) batchInsert(collName string, docs []domain.Document, durability writeDurability) ([]domain.Document, error) {
+	release, err := se.writeLimiter.Acquire(context.Background(), collName)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
 	se.collectionsMu.RLock()
 	_, exists := se.collections[collName]
 	se.collectionsMu.RUnlock()
@@ -125,11 +430,26 @@ func (se *StorageEngine) BatchInsert(collName string, docs []domain.Document) ([
 		}
 	}
 
+	// Fill in collection defaults before IDs are assigned and indexes are updated
+	for i, doc := range docs {
+		se.applyDocumentDefaults(collName, doc)
+		if err := se.checkStrictSchema(collName, doc); err != nil {
+			return nil, fmt.Errorf("document %d: %w", i, err)
+		}
+	}
+
 	// Generate IDs for documents that don't have them
+	ids := make([]string, len(docs))
 	for i, doc := range docs {
 		if doc["_id"] == nil {
 			docs[i]["_id"] = se.generateDocumentID(collName)
 		}
+		ids[i] = docs[i]["_id"].(string)
+	}
+
+	defer se.lockUniqueKeys(collName)()
+	if err := se.indexEngine.CheckUnique(collName, ids, docs); err != nil {
+		return nil, err
 	}
 
 	// Create WAL entry for batch
@@ -138,21 +458,21 @@ func (se *StorageEngine) BatchInsert(collName string, docs []domain.Document) ([
 		Timestamp:  time.Now().UnixNano(),
 		Collection: collName,
 		Document:   domain.Document{"_batch": docs},
+		durability: durability,
 	}
 
-	// Write to WAL
-	if err := se.walEngine.WriteEntry(entry); err != nil {
-		return nil, fmt.Errorf("failed to write WAL entry: %w", err)
-	}
-
-	// Update in-memory collection
-	if err := se.memoryMgr.BatchInsertDocuments(collName, docs); err != nil {
-		return nil, fmt.Errorf("failed to batch insert documents in memory: %w", err)
-	}
-
-	// Update indexes for each document
-	for _, doc := range docs {
-		se.updateIndexesForDocument(collName, doc["_id"].(string), nil, doc)
+	// Write to WAL, then update the in-memory collection and the indexes of each document
+	err = se.logAndApply(entry, func() error {
+		if err := se.memoryMgr.BatchInsertDocuments(collName, docs); err != nil {
+			return fmt.Errorf("failed to batch insert documents in memory: %w", err)
+		}
+		for _, doc := range docs {
+			se.updateIndexesForDocument(collName, doc["_id"].(string), nil, doc)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
 	// Update collection metadata
@@ -163,187 +483,915 @@ func (se *StorageEngine) BatchInsert(collName string, docs []domain.Document) ([
 		s.WALBytesWritten += int64(len(fmt.Sprintf("%+v", docs)))
 	})
 
+	se.trackInserts(collName, docs...)
 	return docs, nil
 }
 
 // FindAll implements domain.StorageEngine
 func (se *StorageEngine) FindAll(collName string, filter map[string]interface{}, options *domain.PaginationOptions) (*domain.PaginationResult, error) {
-	return se.memoryMgr.FindAll(collName, filter, options)
+	return se.FindAllContext(context.Background(), collName, filter, options)
 }
 
-// FindAllStream implements domain.StorageEngine
-func (se *StorageEngine) FindAllStream(collName string, filter map[string]interface{}) (<-chan domain.Document, error) {
-	return se.memoryMgr.FindAllStream(collName, filter)
+// FindAllContext implements domain.StorageEngine
+func (se *StorageEngine) FindAllContext(ctx context.Context, collName string, filter map[string]interface{}, options *domain.PaginationOptions) (*domain.PaginationResult, error) {
+	if err := storage.ValidateFilter(filter); err != nil {
+		return nil, err
+	}
+	filter = se.applyDefaultFilter(ctx, collName, filter)
+	result, err := se.memoryMgr.FindAll(ctx, collName, filter, options)
+	if err != nil {
+		return nil, err
+	}
+	if se.copyOnRead {
+		for i, doc := range result.Documents {
+			result.Documents[i] = storage.CopyDocument(doc)
+		}
+	}
+	return result, nil
 }
 
-// GetById implements domain.StorageEngine
-func (se *StorageEngine) GetById(collName, docId string) (domain.Document, error) {
-	return se.memoryMgr.GetById(collName, docId)
+// FindAllStream implements domain.StorageEngine
+func (se *StorageEngine) FindAllStream(collName string, filter map[string]interface{}) (<-chan domain.Document, error) {
+	return se.FindAllStreamContext(context.Background(), collName, filter)
 }
 
-// UpdateById implements domain.StorageEngine
-func (se *StorageEngine) UpdateById(collName, docId string, updates domain.Document) (domain.Document, error) {
-	// Get existing document
-	existing, err := se.memoryMgr.GetById(collName, docId)
-	if err != nil {
+// FindAllStreamContext implements domain.StorageEngine
+func (se *StorageEngine) FindAllStreamContext(ctx context.Context, collName string, filter map[string]interface{}) (<-chan domain.Document, error) {
+	if err := storage.ValidateFilter(filter); err != nil {
 		return nil, err
 	}
+	filter = se.applyDefaultFilter(ctx, collName, filter)
+	docs, err := se.memoryMgr.FindAllStream(ctx, collName, filter)
+	if err != nil || !se.copyOnRead {
+		return docs, err
+	}
+	return copyStream(ctx, docs), nil
+}
 
-	// Merge updates
-	updated := se.mergeDocuments(existing, updates)
+// FindAcrossCollections implements domain.StorageEngine
+func (se *StorageEngine) FindAcrossCollections(pattern string, filter map[string]interface{}, options *domain.PaginationOptions) (*domain.PaginationResult, error) {
+	return se.FindAcrossCollectionsContext(context.Background(), pattern, filter, options)
+}
 
-	// Create WAL entry
-	entry := &WALEntry{
-		Type:       WALEntryUpdate,
-		Timestamp:  time.Now().UnixNano(),
-		Collection: collName,
-		DocumentID: docId,
-		Updates:    updates,
+// FindAcrossCollectionsContext implements domain.StorageEngine
+func (se *StorageEngine) FindAcrossCollectionsContext(ctx context.Context, pattern string, filter map[string]interface{}, options *domain.PaginationOptions) (*domain.PaginationResult, error) {
+	if err := storage.ValidateFilter(filter); err != nil {
+		return nil, err
 	}
 
-	// Write to WAL
-	if err := se.walEngine.WriteEntry(entry); err != nil {
-		return nil, fmt.Errorf("failed to write WAL entry: %w", err)
+	se.collectionsMu.RLock()
+	names := make([]string, 0, len(se.collections))
+	for name := range se.collections {
+		names = append(names, name)
 	}
+	se.collectionsMu.RUnlock()
 
-	// Update in-memory collection
-	if err := se.memoryMgr.UpdateDocument(collName, docId, updated); err != nil {
-		return nil, fmt.Errorf("failed to update document in memory: %w", err)
+	collections, err := storage.MatchCollections(pattern, names)
+	if err != nil {
+		return nil, err
 	}
+	return storage.FindAcross(ctx, collections, func(ctx context.Context, collName string) (<-chan domain.Document, error) {
+		return se.FindAllStreamContext(ctx, collName, filter)
+	}, options)
+}
 
-	// Update indexes
-	se.updateIndexesForDocument(collName, docId, existing, updated)
-
-	se.updateStats(func(s *StorageStats) {
-		s.WALEntriesWritten++
-		s.WALBytesWritten += int64(len(fmt.Sprintf("%+v", updates)))
-	})
+// copyStream forwards a document stream as deep copies until it ends or ctx is done
+func copyStream(ctx context.Context, in <-chan domain.Document) <-chan domain.Document {
+	out := make(chan domain.Document, cap(in))
+	go func() {
+		defer close(out)
+		for doc := range in {
+			select {
+			case out <- storage.CopyDocument(doc):
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out
+}
 
-	return updated, nil
+// Facets implements domain.StorageEngine
+func (se *StorageEngine) Facets(collName string, filter map[string]interface{}, fields []string) (map[string]map[interface{}]int64, error) {
+	return se.FacetsContext(context.Background(), collName, filter, fields)
 }
 
-// ReplaceById implements domain.StorageEngine
-func (se *StorageEngine) ReplaceById(collName, docId string, newDoc domain.Document) (domain.Document, error) {
-	// Ensure the document has the correct ID
-	newDoc["_id"] = docId
+// FacetsContext implements domain.StorageEngine
+func (se *StorageEngine) FacetsContext(ctx context.Context, collName string, filter map[string]interface{}, fields []string) (map[string]map[interface{}]int64, error) {
+	if err := storage.ValidateFacetFields(fields); err != nil {
+		return nil, err
+	}
+	if err := storage.ValidateFilter(filter); err != nil {
+		return nil, err
+	}
 
-	// Create WAL entry
-	entry := &WALEntry{
-		Type:       WALEntryReplace,
-		Timestamp:  time.Now().UnixNano(),
-		Collection: collName,
-		DocumentID: docId,
-		Document:   newDoc,
+	se.collectionsMu.RLock()
+	_, exists := se.collections[collName]
+	se.collectionsMu.RUnlock()
+	if !exists {
+		return nil, domain.Errorf(domain.ErrCollectionNotFound, "collection %s not found", collName)
 	}
 
-	// Write to WAL
-	if err := se.walEngine.WriteEntry(entry); err != nil {
-		return nil, fmt.Errorf("failed to write WAL entry: %w", err)
+	filter = se.applyDefaultFilter(ctx, collName, filter)
+
+	// With no filter, fields with a full, single-valued index are counted straight from the index key sets
+	counts := storage.NewFacetCounts(fields)
+	scanFields := fields
+	if len(filter) == 0 {
+		scanFields = nil
+		for _, field := range fields {
+			if index, exists := se.indexEngine.GetIndex(collName, field); exists && index.Fields == nil && index.Condition == nil && index.Collation == "" && !index.Multikey() {
+				storage.AddIndexFacetCounts(counts[field], index.ValueCounts())
+			} else {
+				scanFields = append(scanFields, field)
+			}
+		}
+		if len(scanFields) == 0 {
+			return counts, nil
+		}
 	}
 
-	// Get existing document for index updates
-	existing, _ := se.memoryMgr.GetById(collName, docId)
+	if err := se.memoryMgr.Facets(ctx, collName, filter, scanFields, counts); err != nil {
+		return nil, err
+	}
+	return counts, nil
+}
 
-	// Update in-memory collection
-	if err := se.memoryMgr.ReplaceDocument(collName, docId, newDoc); err != nil {
-		return nil, fmt.Errorf("failed to replace document in memory: %w", err)
+// Sample implements domain.StorageEngine
+func (se *StorageEngine) Sample(collName string, size int, seed *int64) ([]domain.Document, error) {
+	return se.SampleContext(context.Background(), collName, size, seed)
+}
+
+// SampleContext implements domain.StorageEngine
+func (se *StorageEngine) SampleContext(ctx context.Context, collName string, size int, seed *int64) ([]domain.Document, error) {
+	if err := storage.ValidateSampleSize(size); err != nil {
+		return nil, err
 	}
 
-	// Update indexes
-	se.updateIndexesForDocument(collName, docId, existing, newDoc)
+	se.collectionsMu.RLock()
+	_, exists := se.collections[collName]
+	se.collectionsMu.RUnlock()
+	if !exists {
+		return nil, domain.Errorf(domain.ErrCollectionNotFound, "collection %s not found", collName)
+	}
 
-	se.updateStats(func(s *StorageStats) {
-		s.WALEntriesWritten++
-		s.WALBytesWritten += int64(len(fmt.Sprintf("%+v", newDoc)))
-	})
+	filter := se.applyDefaultFilter(ctx, collName, nil)
+	sampler := storage.NewSampler(size, seed)
+	if err := se.memoryMgr.Sample(ctx, collName, filter, sampler); err != nil {
+		return nil, err
+	}
+	docs := sampler.Documents()
+	if se.copyOnRead {
+		for i, doc := range docs {
+			docs[i] = storage.CopyDocument(doc)
+		}
+	}
+	return docs, nil
+}
 
-	return newDoc, nil
+// FindIds implements domain.StorageEngine
+func (se *StorageEngine) FindIds(collName string, filter map[string]interface{}) ([]string, error) {
+	return se.FindIdsContext(context.Background(), collName, filter)
 }
 
-// BatchUpdate implements domain.StorageEngine
-func (se *StorageEngine) BatchUpdate(collName string, updates []domain.BatchUpdateOperation) ([]domain.Document, error) {
-	// Create WAL entry for batch
-	entry := &WALEntry{
-		Type:       WALEntryBatchUpdate,
-		Timestamp:  time.Now().UnixNano(),
-		Collection: collName,
-		BatchOps:   updates,
+// FindIdsContext implements domain.StorageEngine
+func (se *StorageEngine) FindIdsContext(ctx context.Context, collName string, filter map[string]interface{}) ([]string, error) {
+	if err := storage.ValidateFilter(filter); err != nil {
+		return nil, err
 	}
 
-	// Write to WAL
-	if err := se.walEngine.WriteEntry(entry); err != nil {
-		return nil, fmt.Errorf("failed to write WAL entry: %w", err)
+	se.collectionsMu.RLock()
+	_, exists := se.collections[collName]
+	se.collectionsMu.RUnlock()
+	if !exists {
+		return nil, domain.Errorf(domain.ErrCollectionNotFound, "collection %s not found", collName)
 	}
 
-	// Process batch updates in memory
-	results, err := se.memoryMgr.BatchUpdateDocuments(collName, updates)
+	filter = se.applyDefaultFilter(ctx, collName, filter)
+
+	ids, err := se.findIds(ctx, collName, filter)
 	if err != nil {
-		return nil, fmt.Errorf("failed to batch update documents in memory: %w", err)
+		return nil, err
 	}
+	if ids == nil {
+		ids = []string{}
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
 
-	// Update indexes for each updated document
-	for i, result := range results {
-		se.updateIndexesForDocument(collName, updates[i].ID, nil, result)
+// findIds returns the IDs of the documents matching filter, unsorted. The default
+// filter must already be applied.
+func (se *StorageEngine) findIds(ctx context.Context, collName string, filter map[string]interface{}) ([]string, error) {
+	// Fully indexed filters are answered from the index key sets without reading documents
+	if ids, ok := storage.IndexOnlyIDs(filter, func(field string) (*indexing.Index, bool) {
+		return se.indexEngine.GetIndex(collName, field)
+	}); ok {
+		return ids, nil
 	}
+	return se.memoryMgr.FindIds(ctx, collName, filter)
+}
 
-	se.updateStats(func(s *StorageStats) {
-		s.WALEntriesWritten++
-		s.WALBytesWritten += int64(len(fmt.Sprintf("%+v", updates)))
-	})
+// GetChanges implements domain.StorageEngine. Changes are recorded as writes update
+// the indexes, after they are in the WAL.
+func (se *StorageEngine) GetChanges(ctx context.Context, collName string, since int64, limit int, wait time.Duration) (*domain.ChangeFeed, error) {
+	if se.changeLog == nil {
+		return nil, domain.Errorf(domain.ErrChangeFeedDisabled, "change feed is disabled")
+	}
 
-	return results, nil
+	se.collectionsMu.RLock()
+	_, exists := se.collections[collName]
+	se.collectionsMu.RUnlock()
+	if !exists {
+		return nil, domain.Errorf(domain.ErrCollectionNotFound, "collection %s not found", collName)
+	}
+	return se.changeLog.Changes(ctx, collName, since, limit, wait), nil
 }
 
-// DeleteById implements domain.StorageEngine
-func (se *StorageEngine) DeleteById(collName, docId string) error {
+// GetById implements domain.StorageEngine
+func (se *StorageEngine) GetById(collName, docId string) (domain.Document, error) {
+	unlock := se.lockDocumentRead(collName, docId)
+	defer unlock()
+
+	doc, err := se.memoryMgr.GetById(collName, docId)
+	if err != nil {
+		return nil, err
+	}
+	se.trackAccess(collName, docId)
+	if se.copyOnRead {
+		doc = storage.CopyDocument(doc)
+	}
+	return doc, nil
+}
+
+// DocumentExists implements domain.StorageEngine
+func (se *StorageEngine) DocumentExists(collName, docId string, filter map[string]interface{}) bool {
+	unlock := se.lockDocumentRead(collName, docId)
+	defer unlock()
+
+	doc, err := se.memoryMgr.GetById(collName, docId)
+	return err == nil && (filter == nil || storage.MatchesFilter(doc, filter))
+}
+
+// GetArraySlice implements domain.StorageEngine
+func (se *StorageEngine) GetArraySlice(collName, docId, field string, offset, limit int) (*domain.ArraySlice, error) {
+	unlock := se.lockDocumentRead(collName, docId)
+	defer unlock()
+
+	doc, err := se.memoryMgr.GetById(collName, docId)
+	if err != nil {
+		return nil, err
+	}
+	slice, err := storage.SliceArrayField(doc, field, offset, limit)
+	if err != nil {
+		return nil, err
+	}
+	se.trackAccess(collName, docId)
+	return slice, nil
+}
+
+// GetNextById implements domain.StorageEngine
+func (se *StorageEngine) GetNextById(collName, afterId string) (domain.Document, error) {
+	return se.getAdjacentById(collName, afterId, true)
+}
+
+// GetPrevById implements domain.StorageEngine
+func (se *StorageEngine) GetPrevById(collName, beforeId string) (domain.Document, error) {
+	return se.getAdjacentById(collName, beforeId, false)
+}
+
+// getAdjacentById looks up the neighbour of id in the collection's ID keyset and reads
+// it as GetById does. A keyset naming a document deleted without updating it is
+// rebuilt once.
+func (se *StorageEngine) getAdjacentById(collName, id string, next bool) (domain.Document, error) {
+	var adjacentID string
+	for attempt := 0; attempt < 2; attempt++ {
+		count, err := se.memoryMgr.documentCount(collName)
+		if err != nil {
+			return nil, err
+		}
+		keyset := se.idKeysets.Get(collName, count, func() []string {
+			return se.memoryMgr.documentIDs(collName)
+		})
+		adjacentID, err = storage.AdjacentID(keyset, collName, id, next)
+		if err != nil {
+			return nil, err
+		}
+
+		if doc, err := se.GetById(collName, adjacentID); err == nil {
+			return doc, nil
+		}
+		se.idKeysets.Invalidate(collName)
+	}
+	return nil, domain.Errorf(domain.ErrDocumentNotFound, "document %s not found in collection %s", adjacentID, collName)
+}
+
+// lockDocument serializes writes to a single document and returns the matching unlock
+// function, so read-modify-write operations such as $max, $inc and compare-and-set
+// cannot interleave at any consistency level. The lock is dropped once no writer holds
+// or waits for it, so locks do not accumulate for every document ever written.
+func (se *StorageEngine) lockDocument(collName, docId string) func() {
+	lockKey := collName + ":" + docId
+
+	se.docLocksMu.Lock()
+	lock, exists := se.documentLocks[lockKey]
+	if !exists {
+		lock = &documentLock{}
+		se.documentLocks[lockKey] = lock
+	}
+	lock.refs++
+	se.docLocksMu.Unlock()
+
+	counters := &se.lockCounters(collName).documents
+	counters.Lock(lock)
+	return func() {
+		counters.Unlock(lock)
+
+		se.docLocksMu.Lock()
+		lock.refs--
+		if lock.refs == 0 {
+			delete(se.documentLocks, lockKey)
+		}
+		se.docLocksMu.Unlock()
+	}
+}
+
+// lockDocumentRead serializes a read of a single document with its writes when running
+// with ConsistencyLinearizable and returns the matching unlock function. With
+// ConsistencyReadYourWrites it is a no-op: writes are still applied to memory
+// synchronously, so callers always observe their own writes.
+func (se *StorageEngine) lockDocumentRead(collName, docId string) func() {
+	if se.consistencyLevel != ConsistencyLinearizable {
+		return func() {}
+	}
+	return se.lockDocument(collName, docId)
+}
+
+// UpdateById implements domain.StorageEngine.
+// The WAL entry is written and the in-memory document and cache are updated
+// before returning, so an immediate GetById reflects the update.
+func (se *StorageEngine) UpdateById(collName, docId string, updates domain.Document) (domain.Document, error) {
+	return se.updateById(collName, docId, updates, writeDurability{})
+}
+
+// updateById applies updates to a document under its lock, applying durability to
+// its WAL entry
+func (se *StorageEngine) updateById(collName, docId string, updates domain.Document, durability writeDurability) (domain.Document, error) {
+	release, err := se.writeLimiter.Acquire(context.Background(), collName)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	unlock := se.lockDocument(collName, docId)
+	defer unlock()
+
+	// Get existing document
+	existing, err := se.memoryMgr.GetById(collName, docId)
+	if err != nil {
+		return nil, err
+	}
+
+	return se.applyUpdate(collName, docId, existing, updates, durability)
+}
+
+// applyUpdate merges updates into existing and writes the result through the WAL,
+// memory and indexes. The caller must hold the document lock.
+func (se *StorageEngine) applyUpdate(collName, docId string, existing, updates domain.Document, durability writeDurability) (domain.Document, error) {
+	// The WAL records the resolved fields, so replays do not compare again
+	updates, err := storage.ResolveUpdate(existing, updates)
+	if err != nil {
+		return nil, err
+	}
+	if err := se.checkStrictSchema(collName, existing, updates); err != nil {
+		return nil, err
+	}
+
+	// Merge updates
+	updated := se.mergeDocuments(existing, updates)
+	defer se.lockUniqueKeys(collName)()
+	if err := se.indexEngine.CheckUnique(collName, []string{docId}, []domain.Document{updated}); err != nil {
+		return nil, err
+	}
+
 	// Create WAL entry
 	entry := &WALEntry{
-		Type:       WALEntryDelete,
+		Type:       WALEntryUpdate,
 		Timestamp:  time.Now().UnixNano(),
 		Collection: collName,
 		DocumentID: docId,
+		Updates:    updates,
+		durability: durability,
 	}
 
-	// Write to WAL
-	if err := se.walEngine.WriteEntry(entry); err != nil {
-		return fmt.Errorf("failed to write WAL entry: %w", err)
+	// Write to WAL, then update the in-memory collection and indexes
+	err = se.logAndApply(entry, func() error {
+		if err := se.memoryMgr.UpdateDocument(collName, docId, updated); err != nil {
+			return fmt.Errorf("failed to update document in memory: %w", err)
+		}
+		se.updateIndexesForDocument(collName, docId, existing, updated)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	se.updateStats(func(s *StorageStats) {
+		s.WALEntriesWritten++
+		s.WALBytesWritten += int64(len(fmt.Sprintf("%+v", updates)))
+	})
+
+	se.trackAccess(collName, docId)
+	return updated, nil
+}
+
+// CompareAndSetField implements domain.StorageEngine
+func (se *StorageEngine) CompareAndSetField(collName, docId, field string, expected, newValue interface{}) (bool, error) {
+	if err := storage.ValidateCompareAndSetField(field); err != nil {
+		return false, err
+	}
+
+	release, err := se.writeLimiter.Acquire(context.Background(), collName)
+	if err != nil {
+		return false, err
+	}
+	defer release()
+
+	unlock := se.lockDocument(collName, docId)
+	defer unlock()
+
+	existing, err := se.memoryMgr.GetById(collName, docId)
+	if err != nil {
+		return false, err
+	}
+	if !storage.FieldEquals(existing[field], expected) {
+		return false, nil
+	}
+
+	if _, err := se.applyUpdate(collName, docId, existing, domain.Document{field: newValue}, writeDurability{}); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// UpdateByIdContext implements domain.StorageEngine. A ctx from
+// domain.WithDurableWrite fsyncs the WAL entry whatever the durability level, and one
+// from WithWriteDurability applies its level in place of the engine's.
+func (se *StorageEngine) UpdateByIdContext(ctx context.Context, collName, docId string, updates domain.Document) (domain.Document, error) {
+	return se.updateById(collName, docId, updates, durabilityOf(ctx))
+}
+
+// ReplaceByIdContext implements domain.StorageEngine. A ctx from
+// domain.WithDurableWrite fsyncs the WAL entry whatever the durability level.
+func (se *StorageEngine) ReplaceByIdContext(ctx context.Context, collName, docId string, newDoc domain.Document) (domain.Document, error) {
+	return se.replaceById(collName, docId, newDoc, durabilityOf(ctx))
+}
+
+// ReplaceById implements domain.StorageEngine
+func (se *StorageEngine) ReplaceById(collName, docId string, newDoc domain.Document) (domain.Document, error) {
+	return se.replaceById(collName, docId, newDoc, writeDurability{})
+}
+
+// replaceById replaces a document under its lock, applying durability to its WAL
+// entry
+func (se *StorageEngine) replaceById(collName, docId string, newDoc domain.Document, durability writeDurability) (domain.Document, error) {
+	release, err := se.writeLimiter.Acquire(context.Background(), collName)
+	if err != nil {
+		return nil, err
 	}
+	defer release()
+
+	unlock := se.lockDocument(collName, docId)
+	defer unlock()
 
 	// Get existing document for index updates
 	existing, _ := se.memoryMgr.GetById(collName, docId)
 
-	// Delete from in-memory collection
-	if err := se.memoryMgr.DeleteDocument(collName, docId); err != nil {
-		return fmt.Errorf("failed to delete document in memory: %w", err)
+	return se.applyReplace(collName, docId, existing, newDoc, durability)
+}
+
+// applyReplace writes newDoc in place of existing through the WAL, memory and indexes.
+// The caller must hold the document lock.
+func (se *StorageEngine) applyReplace(collName, docId string, existing, newDoc domain.Document, durability writeDurability) (domain.Document, error) {
+	if err := se.checkStrictSchema(collName, newDoc); err != nil {
+		return nil, err
+	}
+
+	// Ensure the document has the correct ID
+	newDoc["_id"] = docId
+
+	defer se.lockUniqueKeys(collName)()
+	if err := se.indexEngine.CheckUnique(collName, []string{docId}, []domain.Document{newDoc}); err != nil {
+		return nil, err
+	}
+
+	// Create WAL entry
+	entry := &WALEntry{
+		Type:       WALEntryReplace,
+		Timestamp:  time.Now().UnixNano(),
+		Collection: collName,
+		DocumentID: docId,
+		Document:   newDoc,
+		durability: durability,
+	}
+
+	// Write to WAL, then update the in-memory collection and indexes
+	err := se.logAndApply(entry, func() error {
+		if err := se.memoryMgr.ReplaceDocument(collName, docId, newDoc); err != nil {
+			return fmt.Errorf("failed to replace document in memory: %w", err)
+		}
+		se.updateIndexesForDocument(collName, docId, existing, newDoc)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	se.updateStats(func(s *StorageStats) {
+		s.WALEntriesWritten++
+		s.WALBytesWritten += int64(len(fmt.Sprintf("%+v", newDoc)))
+	})
+
+	se.trackAccess(collName, docId)
+	return newDoc, nil
+}
+
+// BatchUpdate implements domain.StorageEngine
+func (se *StorageEngine) BatchUpdate(collName string, updates []domain.BatchUpdateOperation) ([]domain.Document, error) {
+	release, err := se.writeLimiter.Acquire(context.Background(), collName)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	// Lock the documents in ID order so concurrent batches cannot deadlock
+	ids := make([]string, 0, len(updates))
+	for _, update := range updates {
+		ids = append(ids, update.ID)
+	}
+	sort.Strings(ids)
+	for i, docID := range ids {
+		if i == 0 || docID != ids[i-1] {
+			defer se.lockDocument(collName, docID)()
+		}
+	}
+
+	// Operators are resolved before the WAL entry, each against the document as the
+	// earlier operations in the batch leave it, so repeated $inc fields add up
+	resolved := make([]domain.BatchUpdateOperation, len(updates))
+	previous := make([]domain.Document, len(updates))
+	pending := make(map[string]domain.Document)
+	for i, update := range updates {
+		resolved[i] = update
+		existing, ok := pending[update.ID]
+		if !ok {
+			if existing, err = se.memoryMgr.GetById(collName, update.ID); err != nil {
+				continue // Reported by the batch update itself
+			}
+		}
+		if resolved[i].Updates, err = storage.ResolveUpdate(existing, update.Updates); err != nil {
+			return nil, fmt.Errorf("failed to update document %s: %w", update.ID, err)
+		}
+		if err := se.checkStrictSchema(collName, existing, resolved[i].Updates); err != nil {
+			return nil, fmt.Errorf("failed to update document %s: %w", update.ID, err)
+		}
+		previous[i] = existing
+		pending[update.ID] = se.mergeDocuments(existing, resolved[i].Updates)
+	}
+	updates = resolved
+
+	defer se.lockUniqueKeys(collName)()
+	if se.indexEngine.HasUniqueIndex(collName) {
+		pendingIDs := make([]string, 0, len(pending))
+		pendingDocs := make([]domain.Document, 0, len(pending))
+		for docID, doc := range pending {
+			pendingIDs = append(pendingIDs, docID)
+			pendingDocs = append(pendingDocs, doc)
+		}
+		if err := se.indexEngine.CheckUnique(collName, pendingIDs, pendingDocs); err != nil {
+			return nil, err
+		}
+	}
+
+	// Create WAL entry for batch
+	entry := &WALEntry{
+		Type:       WALEntryBatchUpdate,
+		Timestamp:  time.Now().UnixNano(),
+		Collection: collName,
+		BatchOps:   updates,
+	}
+
+	// Write to WAL, then process the batch updates in memory and update the indexes of
+	// each updated document
+	var results []domain.Document
+	err = se.logAndApply(entry, func() error {
+		var err error
+		results, err = se.memoryMgr.BatchUpdateDocuments(collName, updates)
+		if err != nil {
+			return fmt.Errorf("failed to batch update documents in memory: %w", err)
+		}
+		for i, result := range results {
+			se.updateIndexesForDocument(collName, updates[i].ID, previous[i], result)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, update := range updates {
+		se.trackAccess(collName, update.ID)
+	}
+
+	se.updateStats(func(s *StorageStats) {
+		s.WALEntriesWritten++
+		s.WALBytesWritten += int64(len(fmt.Sprintf("%+v", updates)))
+	})
+
+	return results, nil
+}
+
+// UpdateMany implements domain.StorageEngine
+func (se *StorageEngine) UpdateMany(collName string, filter map[string]interface{}, updates domain.Document) (int64, error) {
+	return se.UpdateManyContext(context.Background(), collName, filter, updates)
+}
+
+// UpdateManyContext implements domain.StorageEngine. The matching documents are locked
+// in ID order and their updates written to the WAL as one batch entry, so recovery
+// replays all of them or none; a document changed so that it no longer matches before
+// its lock is taken is left alone. A ctx from domain.WithDurableWrite fsyncs the WAL
+// entry whatever the durability level.
+func (se *StorageEngine) UpdateManyContext(ctx context.Context, collName string, filter map[string]interface{}, updates domain.Document) (int64, error) {
+	if len(updates) == 0 {
+		return 0, fmt.Errorf("no updates provided")
+	}
+	if err := storage.ValidateFilter(filter); err != nil {
+		return 0, err
+	}
+
+	se.collectionsMu.RLock()
+	_, exists := se.collections[collName]
+	se.collectionsMu.RUnlock()
+	if !exists {
+		return 0, domain.Errorf(domain.ErrCollectionNotFound, "collection %s not found", collName)
+	}
+
+	filter = se.applyDefaultFilter(ctx, collName, filter)
+	if _, exists := updates["_id"]; exists {
+		updates = storage.CopyDocument(updates)
+		delete(updates, "_id")
+	}
+
+	release, err := se.writeLimiter.Acquire(ctx, collName)
+	if err != nil {
+		return 0, err
+	}
+	defer release()
+
+	ids, err := se.findIds(ctx, collName, filter)
+	if err != nil {
+		return 0, err
+	}
+	sort.Strings(ids)
+	for _, docID := range ids {
+		defer se.lockDocument(collName, docID)()
+	}
+
+	// Operators are resolved against the locked documents before the WAL entry
+	ops := make([]domain.BatchUpdateOperation, 0, len(ids))
+	existing := make([]domain.Document, 0, len(ids))
+	for _, docID := range ids {
+		doc, err := se.memoryMgr.GetById(collName, docID)
+		if err != nil || !storage.MatchesFilter(doc, filter) {
+			continue
+		}
+		resolved, err := storage.ResolveUpdate(doc, updates)
+		if err != nil {
+			return 0, fmt.Errorf("failed to update document %s: %w", docID, err)
+		}
+		if err := se.checkStrictSchema(collName, doc, resolved); err != nil {
+			return 0, fmt.Errorf("failed to update document %s: %w", docID, err)
+		}
+		ops = append(ops, domain.BatchUpdateOperation{ID: docID, Updates: resolved})
+		existing = append(existing, doc)
+	}
+	if len(ops) == 0 {
+		return 0, nil
+	}
+
+	defer se.lockUniqueKeys(collName)()
+	if se.indexEngine.HasUniqueIndex(collName) {
+		opIDs := make([]string, len(ops))
+		updated := make([]domain.Document, len(ops))
+		for i, op := range ops {
+			opIDs[i] = op.ID
+			updated[i] = se.mergeDocuments(existing[i], op.Updates)
+		}
+		if err := se.indexEngine.CheckUnique(collName, opIDs, updated); err != nil {
+			return 0, err
+		}
+	}
+
+	entry := &WALEntry{
+		Type:       WALEntryBatchUpdate,
+		Timestamp:  time.Now().UnixNano(),
+		Collection: collName,
+		BatchOps:   ops,
+		durability: durabilityOf(ctx),
+	}
+	var results []domain.Document
+	err = se.logAndApply(entry, func() error {
+		var err error
+		results, err = se.memoryMgr.BatchUpdateDocuments(collName, ops)
+		if err != nil {
+			return fmt.Errorf("failed to batch update documents in memory: %w", err)
+		}
+		for i, result := range results {
+			se.updateIndexesForDocument(collName, ops[i].ID, existing[i], result)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	for _, op := range ops {
+		se.trackAccess(collName, op.ID)
+	}
+
+	se.updateStats(func(s *StorageStats) {
+		s.WALEntriesWritten++
+		s.WALBytesWritten += int64(len(fmt.Sprintf("%+v", ops)))
+	})
+
+	return int64(len(results)), nil
+}
+
+// DeleteByIdContext implements domain.StorageEngine. A ctx from
+// domain.WithDurableWrite fsyncs the WAL entry whatever the durability level.
+func (se *StorageEngine) DeleteByIdContext(ctx context.Context, collName, docId string) error {
+	release, err := se.writeLimiter.Acquire(ctx, collName)
+	if err != nil {
+		return err
 	}
+	defer release()
+
+	_, err = se.deleteDocument(collName, docId, false, durabilityOf(ctx))
+	return err
+}
+
+// DeleteById implements domain.StorageEngine
+func (se *StorageEngine) DeleteById(collName, docId string) error {
+	return se.DeleteByIdContext(context.Background(), collName, docId)
+}
+
+// DeleteByIdReturning implements domain.StorageEngine
+func (se *StorageEngine) DeleteByIdReturning(collName, docId string) (domain.Document, error) {
+	return se.DeleteByIdReturningContext(context.Background(), collName, docId)
+}
+
+// DeleteByIdReturningContext implements domain.StorageEngine. Unlike DeleteById, a
+// missing document is an error, as there is nothing to return. A ctx from
+// domain.WithDurableWrite fsyncs the WAL entry whatever the durability level.
+func (se *StorageEngine) DeleteByIdReturningContext(ctx context.Context, collName, docId string) (domain.Document, error) {
+	release, err := se.writeLimiter.Acquire(ctx, collName)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	return se.deleteDocument(collName, docId, true, durabilityOf(ctx))
+}
+
+// deleteById deletes a document through the WAL, memory and indexes. Capped eviction
+// calls it directly, as the insert that caused the eviction already holds a write slot.
+func (se *StorageEngine) deleteById(collName, docId string) error {
+	_, err := se.deleteDocument(collName, docId, false, writeDurability{})
+	return err
+}
 
-	// Update indexes (remove document from all indexes)
-	se.updateIndexesForDocument(collName, docId, existing, nil)
+// deleteDocument deletes a document and returns it, or nil if it did not exist. With
+// mustExist a missing document is an error and nothing is written to the WAL.
+// durability is applied to the WAL entry.
+func (se *StorageEngine) deleteDocument(collName, docId string, mustExist bool, durability writeDurability) (domain.Document, error) {
+	unlock := se.lockDocument(collName, docId)
+	defer unlock()
+
+	// Get existing document for index updates
+	existing, err := se.memoryMgr.GetById(collName, docId)
+	if err != nil && mustExist {
+		return nil, err
+	}
+
+	// Create WAL entry
+	entry := &WALEntry{
+		Type:       WALEntryDelete,
+		Timestamp:  time.Now().UnixNano(),
+		Collection: collName,
+		DocumentID: docId,
+		durability: durability,
+	}
+
+	// Write to WAL, then delete from the in-memory collection and all indexes
+	err = se.logAndApply(entry, func() error {
+		if err := se.memoryMgr.DeleteDocument(collName, docId); err != nil {
+			return fmt.Errorf("failed to delete document in memory: %w", err)
+		}
+		se.updateIndexesForDocument(collName, docId, existing, nil)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
 
 	// Update collection metadata
 	se.updateCollectionMetadata(collName, -1)
+	if tracker := se.cappedTracker(collName); tracker != nil {
+		tracker.Removed(docId)
+	}
 
 	se.updateStats(func(s *StorageStats) {
 		s.WALEntriesWritten++
 		s.WALBytesWritten += int64(len(docId))
 	})
 
-	return nil
+	return existing, nil
 }
 
 // CreateCollection implements domain.StorageEngine
 func (se *StorageEngine) CreateCollection(collName string) error {
+	if err := storage.ValidateCollectionName(collName, se.collectionNamePattern); err != nil {
+		return err
+	}
+	return se.createCollection(collName, true)
+}
+
+// CreateCollectionWithOptions implements domain.StorageEngine.
+// Unlike CreateCollection it fails if the collection exists, since an existing
+// collection would otherwise be reconfigured and, on failure, discarded.
+func (se *StorageEngine) CreateCollectionWithOptions(collName string, opts domain.CollectionOptions) error {
+	if err := storage.ValidateCollectionName(collName, se.collectionNamePattern); err != nil {
+		return err
+	}
+	if err := storage.ValidateCollectionOptions(opts); err != nil {
+		return err
+	}
+	created, err := se.addCollection(collName, true)
+	if err != nil {
+		return err
+	}
+	if !created {
+		return domain.Errorf(domain.ErrCollectionExists, "collection %s already exists", collName)
+	}
+	if err := storage.ConfigureCollection(se, collName, opts); err != nil {
+		se.discardCollection(collName)
+		return fmt.Errorf("failed to configure collection %s: %w", collName, err)
+	}
+	return nil
+}
+
+// discardCollection removes a collection that CreateCollectionWithOptions could not
+// configure, along with its settings and indexes
+func (se *StorageEngine) discardCollection(collName string) {
+	storage.ResetCollectionSettings(se, collName)
+
+	se.collectionsMu.Lock()
+	delete(se.collections, collName)
+	se.collectionsMu.Unlock()
+
+	se.memoryMgr.mu.Lock()
+	delete(se.memoryMgr.collections, collName)
+	se.memoryMgr.mu.Unlock()
+
+	se.indexEngine.DropAllIndexes(collName)
+}
+
+// createCollection registers a collection without validating its name.
+// Recovery uses it, without the collection limit, so collections persisted under
+// an older naming policy or a lower limit still load.
+func (se *StorageEngine) createCollection(collName string, checkLimit bool) error {
+	_, err := se.addCollection(collName, checkLimit)
+	return err
+}
+
+// addCollection registers a collection unless it already exists and reports whether
+// it did
+func (se *StorageEngine) addCollection(collName string, checkLimit bool) (bool, error) {
 	se.collectionsMu.Lock()
 	defer se.collectionsMu.Unlock()
 
 	if _, exists := se.collections[collName]; exists {
-		return nil // Collection already exists
+		return false, nil
+	}
+
+	if checkLimit {
+		if err := storage.CheckCollectionLimit(len(se.collections), se.maxCollections); err != nil {
+			return false, err
+		}
 	}
 
 	// Create _id index automatically (like v1 engine) - only if it doesn't exist
 	if _, exists := se.indexEngine.GetIndex(collName, "_id"); !exists {
 		if err := se.indexEngine.CreateIndex(collName, "_id"); err != nil {
-			return fmt.Errorf("failed to create _id index: %w", err)
+			return false, fmt.Errorf("failed to create _id index: %w", err)
 		}
 	}
 
@@ -355,19 +1403,290 @@ func (se *StorageEngine) CreateCollection(collName string) error {
 		Indexes:       []string{"_id"}, // Include _id index
 	}
 
-	// Also create the collection in the memory manager
-	se.memoryMgr.mu.Lock()
-	defer se.memoryMgr.mu.Unlock()
+	// Also create the collection in the memory manager
+	se.memoryMgr.mu.Lock()
+	defer se.memoryMgr.mu.Unlock()
+
+	if _, exists := se.memoryMgr.collections[collName]; !exists {
+		se.memoryMgr.collections[collName] = &Collection{
+			Name:      collName,
+			Documents: make(map[string]domain.Document),
+			CreatedAt: time.Now(),
+		}
+	}
+
+	return true, nil
+}
+
+// CopyCollection implements domain.StorageEngine.
+// Documents are deep-copied under the memory manager's read lock and written to the
+// WAL as one batch insert with the same _ids, so the copy survives recovery. Index
+// definitions are replicated. Document IDs are engine-wide in v2, so there is no
+// per-collection ID counter to carry over. A failed copy removes dst again.
+func (se *StorageEngine) CopyCollection(src, dst string) (err error) {
+	if err := storage.ValidateCollectionName(dst, se.collectionNamePattern); err != nil {
+		return err
+	}
+
+	se.collectionsMu.Lock()
+	_, exists := se.collections[src]
+	if !exists {
+		se.collectionsMu.Unlock()
+		return domain.Errorf(domain.ErrCollectionNotFound, "collection %s not found", src)
+	}
+	if _, exists := se.collections[dst]; exists {
+		se.collectionsMu.Unlock()
+		return fmt.Errorf("%w: %s", domain.ErrCollectionExists, dst)
+	}
+	if err := storage.CheckCollectionLimit(len(se.collections), se.maxCollections); err != nil {
+		se.collectionsMu.Unlock()
+		return err
+	}
+	definitions := se.indexEngine.ExportIndexDefinitions(src)
+	se.collections[dst] = &CollectionInfo{
+		Name:         dst,
+		State:        CollectionStateLoaded,
+		LastModified: time.Now(),
+		Indexes:      []string{"_id"},
+	}
+	se.collectionsMu.Unlock()
+
+	var entry *WALEntry
+	defer func() {
+		if err == nil {
+			return
+		}
+		// Once the documents may be in the WAL the drop is logged too, so recovery
+		// does not bring the partial copy back
+		if entry == nil || se.DropCollection(dst) != nil {
+			se.dropCollection(dst)
+		}
+	}()
+
+	if _, exists := se.indexEngine.GetIndex(dst, "_id"); !exists {
+		if err := se.indexEngine.CreateIndex(dst, "_id"); err != nil {
+			return fmt.Errorf("failed to create _id index: %w", err)
+		}
+	}
+
+	docs := se.memoryMgr.CopyDocuments(src)
+	if len(docs) > 0 {
+		entry = &WALEntry{
+			Type:       WALEntryBatchInsert,
+			Timestamp:  time.Now().UnixNano(),
+			Collection: dst,
+			Document:   domain.Document{"_batch": docs},
+		}
+	}
+	err = se.logAndApply(entry, func() error {
+		if err := se.memoryMgr.BatchInsertDocuments(dst, docs); err != nil {
+			return fmt.Errorf("failed to copy documents in memory: %w", err)
+		}
+		for _, doc := range docs {
+			se.updateIndexesForDocument(dst, doc["_id"].(string), nil, doc)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	se.updateCollectionMetadata(dst, int64(len(docs)))
+
+	for _, definition := range definitions {
+		var err error
+		switch {
+		case definition.Field == "_id":
+			continue
+		case len(definition.Fields) > 0:
+			err = se.CreateCompoundIndex(dst, definition.Fields, definition.Unique)
+		case definition.Collation != "":
+			err = se.CreateCollatedIndex(dst, definition.Field, definition.Collation, definition.Unique)
+		case definition.Unique:
+			err = se.CreateUniqueIndex(dst, definition.Field)
+		case definition.Condition != nil:
+			err = se.CreatePartialIndex(dst, definition.Field, definition.Condition)
+		default:
+			err = se.CreateIndex(dst, definition.Field)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	se.updateStats(func(s *StorageStats) {
+		s.WALEntriesWritten++
+	})
+
+	return nil
+}
+
+// DropCollection implements domain.StorageEngine. The drop is written to the WAL, so
+// recovery removes the collection again even when the checkpoint it starts from still
+// holds its documents.
+func (se *StorageEngine) DropCollection(collName string) error {
+	se.collectionsMu.RLock()
+	_, exists := se.collections[collName]
+	se.collectionsMu.RUnlock()
+	if !exists {
+		return domain.Errorf(domain.ErrCollectionNotFound, "collection %s not found", collName)
+	}
+
+	entry := &WALEntry{
+		Type:       WALEntryDropCollection,
+		Timestamp:  time.Now().UnixNano(),
+		Collection: collName,
+	}
+	err := se.logAndApply(entry, func() error {
+		se.dropCollection(collName)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	storage.ResetCollectionSettings(se, collName)
+
+	se.updateStats(func(s *StorageStats) {
+		s.WALEntriesWritten++
+	})
+	return nil
+}
+
+// dropCollection removes a collection with its documents and indexes from memory.
+// Recovery uses it to replay a drop.
+func (se *StorageEngine) dropCollection(collName string) {
+	se.collectionsMu.Lock()
+	delete(se.collections, collName)
+	se.collectionsMu.Unlock()
+
+	se.memoryMgr.DropCollection(collName)
+	se.indexEngine.DropCollection(collName)
+	se.idKeysets.Invalidate(collName)
+	se.insertionOrder.Invalidate(collName)
+}
+
+// ListCollections implements domain.StorageEngine. Every collection is loaded after
+// recovery, so none is reported as unloaded; documents are saved in the shared WAL and
+// checkpoints rather than per collection, so SizeOnDisk is always 0.
+func (se *StorageEngine) ListCollections() []domain.CollectionInfoSummary {
+	se.collectionsMu.RLock()
+	summaries := make([]domain.CollectionInfoSummary, 0, len(se.collections))
+	for name, collInfo := range se.collections {
+		summaries = append(summaries, domain.CollectionInfoSummary{
+			Name:          name,
+			DocumentCount: collInfo.DocumentCount,
+			State:         collInfo.State.String(),
+		})
+	}
+	se.collectionsMu.RUnlock()
+
+	sort.Slice(summaries, func(i, j int) bool { return summaries[i].Name < summaries[j].Name })
+	return summaries
+}
+
+// MoveDocument implements domain.StorageEngine.
+// The move is written to the WAL as one entry, so recovery replays all of it or none,
+// and applied to memory under one lock. Moves are serialized with each other and, by
+// the document locks, with other writes to the document.
+// Moves need the shared WAL: recovery replays per-collection WAL files one collection
+// at a time, which could reorder a move with the destination's later writes.
+func (se *StorageEngine) MoveDocument(srcColl, docId, dstColl string, keepID bool) (domain.Document, error) {
+	if srcColl == dstColl {
+		return nil, fmt.Errorf("cannot move document %s within collection %s", docId, srcColl)
+	}
+	if se.walEngine.perCollection {
+		return nil, fmt.Errorf("moving documents is not supported with a per-collection WAL")
+	}
+
+	first, second := srcColl, dstColl
+	if second < first {
+		first, second = second, first
+	}
+	for _, collName := range []string{first, second} {
+		release, err := se.writeLimiter.Acquire(context.Background(), collName)
+		if err != nil {
+			return nil, err
+		}
+		defer release()
+	}
+
+	se.moveMu.Lock()
+	defer se.moveMu.Unlock()
+
+	newID := docId
+	if !keepID {
+		newID = se.generateDocumentID(dstColl)
+	}
+
+	// Document locks are taken in collection name order, like the write slots
+	locks := [][2]string{{srcColl, docId}, {dstColl, newID}}
+	if dstColl < srcColl {
+		locks[0], locks[1] = locks[1], locks[0]
+	}
+	for _, lock := range locks {
+		defer se.lockDocument(lock[0], lock[1])()
+	}
+
+	existing, err := se.memoryMgr.GetById(srcColl, docId)
+	if err != nil {
+		return nil, err
+	}
+	moved := storage.CopyDocument(existing)
+	moved["_id"] = newID
+	if err := se.checkStrictSchema(dstColl, moved); err != nil {
+		return nil, err
+	}
+	if keepID {
+		if _, err := se.memoryMgr.GetById(dstColl, docId); err == nil {
+			return nil, domain.Errorf(domain.ErrDocumentExists, "document %s already exists in collection %s", docId, dstColl)
+		}
+	}
+
+	se.collectionsMu.RLock()
+	_, exists := se.collections[dstColl]
+	se.collectionsMu.RUnlock()
+	if !exists {
+		if err := se.CreateCollection(dstColl); err != nil {
+			return nil, err
+		}
+	}
+
+	defer se.lockUniqueKeys(dstColl)()
+	if err := se.indexEngine.CheckUnique(dstColl, []string{newID}, []domain.Document{moved}); err != nil {
+		return nil, err
+	}
 
-	if _, exists := se.memoryMgr.collections[collName]; !exists {
-		se.memoryMgr.collections[collName] = &Collection{
-			Name:      collName,
-			Documents: make(map[string]domain.Document),
-			CreatedAt: time.Now(),
+	entry := &WALEntry{
+		Type:       WALEntryMove,
+		Timestamp:  time.Now().UnixNano(),
+		Collection: srcColl,
+		DocumentID: docId,
+		Target:     dstColl,
+		Document:   moved,
+	}
+	err = se.logAndApply(entry, func() error {
+		if err := se.memoryMgr.MoveDocument(srcColl, docId, dstColl, moved); err != nil {
+			return fmt.Errorf("failed to move document in memory: %w", err)
 		}
+		se.updateIndexesForDocument(srcColl, docId, existing, nil)
+		se.updateIndexesForDocument(dstColl, newID, nil, moved)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	se.updateCollectionMetadata(srcColl, -1)
+	se.updateCollectionMetadata(dstColl, 1)
+	if tracker := se.cappedTracker(srcColl); tracker != nil {
+		tracker.Removed(docId)
 	}
 
-	return nil
+	se.updateStats(func(s *StorageStats) {
+		s.WALEntriesWritten++
+		s.WALBytesWritten += int64(len(fmt.Sprintf("%+v", moved)))
+	})
+
+	se.trackInserts(dstColl, moved)
+	return moved, nil
 }
 
 // GetCollection implements domain.StorageEngine
@@ -377,7 +1696,7 @@ func (se *StorageEngine) GetCollection(collName string) (*domain.Collection, err
 	se.collectionsMu.RUnlock()
 
 	if !exists {
-		return nil, fmt.Errorf("collection %s not found", collName)
+		return nil, domain.Errorf(domain.ErrCollectionNotFound, "collection %s not found", collName)
 	}
 
 	return &domain.Collection{
@@ -398,6 +1717,23 @@ func (se *StorageEngine) SaveToFile(filename string) error {
 	return se.saveToSpecificFile(filename)
 }
 
+// AppliedOffset implements domain.StorageEngine. It is the WAL offset: every entry
+// with a lower LSN has been written, and the offset carries on from the replayed
+// entries after recovery.
+func (se *StorageEngine) AppliedOffset() int64 {
+	return se.walEngine.GetCurrentLSN()
+}
+
+// CheckpointNow implements domain.StorageEngine. It writes a checkpoint whether or
+// not the checkpoint triggers are due, and may be called while writes are in flight:
+// once it returns nil, every write that completed before the call is in the checkpoint
+// file, so recovery no longer needs the WAL for it, and WAL files holding only such
+// writes beyond the retention count are deleted. With DurabilityFull the checkpoint
+// file is fsynced first; otherwise it is as durable as an OS-buffered WAL write.
+func (se *StorageEngine) CheckpointNow() error {
+	return se.checkpointMgr.ForceCheckpoint()
+}
+
 // loadFromCheckpoint loads data from a checkpoint file
 func (se *StorageEngine) loadFromCheckpoint(filename string) error {
 	// Read checkpoint file
@@ -508,6 +1844,9 @@ func (se *StorageEngine) saveToSpecificFile(filename string) error {
 
 // GetMemoryStats implements domain.StorageEngine
 func (se *StorageEngine) GetMemoryStats() map[string]interface{} {
+	// Read before statsMu: checkpoints update the stats while holding the checkpoint lock
+	nextCheckpoint := se.checkpointMgr.NextCheckpoint()
+
 	se.statsMu.RLock()
 	defer se.statsMu.RUnlock()
 
@@ -516,10 +1855,71 @@ func (se *StorageEngine) GetMemoryStats() map[string]interface{} {
 		"wal_bytes_written":     se.stats.WALBytesWritten,
 		"checkpoints_performed": se.stats.CheckpointsPerformed,
 		"recovery_time_ms":      se.stats.RecoveryTime.Milliseconds(),
+		"wal_entries_replayed":  se.stats.WALEntriesReplayed,
 		"memory_usage_mb":       se.stats.MemoryUsageMB,
 		"collection_count":      se.stats.CollectionCount,
 		"last_checkpoint":       se.stats.LastCheckpoint,
+		"last_checkpoint_bytes": se.stats.LastCheckpointBytes,
+		"next_checkpoint":       nextCheckpoint,
+		"concurrent_writes":     se.writeLimiter.Stats(),
+		"max_memory_mb":         se.memoryMgr.getMaxMemoryMB(),
+		"cache_size":            se.memoryMgr.cache.Size(),
+	}
+}
+
+// CollectionMemoryUsage implements domain.StorageEngine. Every collection is resident;
+// CachedDocs counts its documents in the read cache.
+func (se *StorageEngine) CollectionMemoryUsage() []domain.CollectionMemoryUsage {
+	usage := se.memoryMgr.collectionMemoryUsage()
+	for i := range usage {
+		usage[i].Pinned = se.IsCollectionPinned(usage[i].Name)
+	}
+	return usage
+}
+
+// PinCollection implements domain.StorageEngine. Every document is kept in memory,
+// so pinning only records the collection, for CollectionMemoryUsage.
+func (se *StorageEngine) PinCollection(collName string) {
+	se.pinnedMu.Lock()
+	defer se.pinnedMu.Unlock()
+	se.pinned[collName] = true
+}
+
+// UnpinCollection implements domain.StorageEngine
+func (se *StorageEngine) UnpinCollection(collName string) {
+	se.pinnedMu.Lock()
+	defer se.pinnedMu.Unlock()
+	delete(se.pinned, collName)
+}
+
+// IsCollectionPinned implements domain.StorageEngine
+func (se *StorageEngine) IsCollectionPinned(collName string) bool {
+	se.pinnedMu.RLock()
+	defer se.pinnedMu.RUnlock()
+	return se.pinned[collName]
+}
+
+// SetMaxMemory implements domain.StorageEngine. The document read cache is resized
+// to match and shrinks immediately; documents themselves stay in memory.
+func (se *StorageEngine) SetMaxMemory(mb int) error {
+	if err := storage.ValidateMaxMemory(mb); err != nil {
+		return err
 	}
+	se.memoryMgr.setMaxMemory(mb)
+	return nil
+}
+
+// PreloadCollections implements domain.StorageEngine. Documents are already in
+// memory after recovery, so only the listed collections' indexes are rebuilt.
+func (se *StorageEngine) PreloadCollections() error {
+	return se.preloader.Run(func(collName string) error {
+		return se.RebuildIndexesContext(context.Background(), collName, nil)
+	})
+}
+
+// PreloadProgress implements domain.StorageEngine
+func (se *StorageEngine) PreloadProgress() domain.PreloadProgress {
+	return se.preloader.Progress()
 }
 
 // StartBackgroundWorkers implements domain.StorageEngine
@@ -552,12 +1952,250 @@ func (se *StorageEngine) GetIndexes(collName string) ([]string, error) {
 	return se.indexEngine.GetIndexes(collName)
 }
 
+// SetCollectionDefaultFilter implements domain.StorageEngine
+func (se *StorageEngine) SetCollectionDefaultFilter(collName string, filter map[string]interface{}) {
+	se.defaultFiltersMu.Lock()
+	defer se.defaultFiltersMu.Unlock()
+
+	if len(filter) == 0 {
+		delete(se.defaultFilters, collName)
+		return
+	}
+	copied := make(map[string]interface{}, len(filter))
+	for key, value := range filter {
+		copied[key] = value
+	}
+	se.defaultFilters[collName] = copied
+}
+
+// GetCollectionDefaultFilter implements domain.StorageEngine
+func (se *StorageEngine) GetCollectionDefaultFilter(collName string) map[string]interface{} {
+	se.defaultFiltersMu.RLock()
+	defer se.defaultFiltersMu.RUnlock()
+
+	filter, exists := se.defaultFilters[collName]
+	if !exists {
+		return nil
+	}
+	copied := make(map[string]interface{}, len(filter))
+	for key, value := range filter {
+		copied[key] = value
+	}
+	return copied
+}
+
+// applyDefaultFilter combines the request filter with the collection default filter
+// and applies the collection schema and any $collation
+func (se *StorageEngine) applyDefaultFilter(ctx context.Context, collName string, filter map[string]interface{}) map[string]interface{} {
+	if !domain.SkipDefaultFilter(ctx) {
+		filter = storage.CombineFilters(filter, se.GetCollectionDefaultFilter(collName))
+	}
+	return storage.ApplyCollation(storage.ApplySchema(filter, se.GetCollectionSchema(collName)))
+}
+
+// SetCollectionDefaults implements domain.StorageEngine
+func (se *StorageEngine) SetCollectionDefaults(collName string, defaults domain.Document) {
+	se.documentDefaultsMu.Lock()
+	defer se.documentDefaultsMu.Unlock()
+
+	if len(defaults) == 0 {
+		delete(se.documentDefaults, collName)
+		return
+	}
+	se.documentDefaults[collName] = storage.CopyDocumentDefaults(defaults)
+}
+
+// GetCollectionDefaults implements domain.StorageEngine
+func (se *StorageEngine) GetCollectionDefaults(collName string) domain.Document {
+	se.documentDefaultsMu.RLock()
+	defer se.documentDefaultsMu.RUnlock()
+
+	defaults, exists := se.documentDefaults[collName]
+	if !exists {
+		return nil
+	}
+	return storage.CopyDocumentDefaults(defaults)
+}
+
+// applyDocumentDefaults fills in the collection's insert defaults on a document
+func (se *StorageEngine) applyDocumentDefaults(collName string, doc domain.Document) {
+	se.documentDefaultsMu.RLock()
+	defaults := se.documentDefaults[collName]
+	se.documentDefaultsMu.RUnlock()
+
+	storage.ApplyDocumentDefaults(doc, defaults, time.Now())
+}
+
+// SetCollectionSchema implements domain.StorageEngine
+func (se *StorageEngine) SetCollectionSchema(collName string, schema map[string]domain.FieldType) {
+	se.schemasMu.Lock()
+	defer se.schemasMu.Unlock()
+
+	if len(schema) == 0 {
+		delete(se.schemas, collName)
+		delete(se.strictSchemas, collName)
+		return
+	}
+	se.schemas[collName] = storage.CopySchema(schema)
+}
+
+// GetCollectionSchema implements domain.StorageEngine
+func (se *StorageEngine) GetCollectionSchema(collName string) map[string]domain.FieldType {
+	se.schemasMu.RLock()
+	defer se.schemasMu.RUnlock()
+
+	schema, exists := se.schemas[collName]
+	if !exists {
+		return nil
+	}
+	return storage.CopySchema(schema)
+}
+
+// SetCollectionSchemaStrict implements domain.StorageEngine
+func (se *StorageEngine) SetCollectionSchemaStrict(collName string, strict bool) {
+	se.schemasMu.Lock()
+	defer se.schemasMu.Unlock()
+
+	if !strict {
+		delete(se.strictSchemas, collName)
+		return
+	}
+	se.strictSchemas[collName] = true
+}
+
+// IsCollectionSchemaStrict implements domain.StorageEngine
+func (se *StorageEngine) IsCollectionSchemaStrict(collName string) bool {
+	se.schemasMu.RLock()
+	defer se.schemasMu.RUnlock()
+	return se.strictSchemas[collName]
+}
+
+// checkStrictSchema rejects a write whose stored document would have the fields of
+// docs when the collection's schema is strict and does not declare them all
+func (se *StorageEngine) checkStrictSchema(collName string, docs ...domain.Document) error {
+	se.schemasMu.RLock()
+	var schema map[string]domain.FieldType
+	if se.strictSchemas[collName] {
+		schema = se.schemas[collName]
+	}
+	se.schemasMu.RUnlock()
+
+	return storage.CheckSchemaFields(schema, docs...)
+}
+
+// SetCollectionCapped implements domain.StorageEngine
+func (se *StorageEngine) SetCollectionCapped(collName string, maxDocs int64, policy domain.EvictPolicy) error {
+	if err := storage.ValidateCappedConfig(maxDocs, policy); err != nil {
+		return err
+	}
+
+	if maxDocs == 0 {
+		se.cappedMu.Lock()
+		delete(se.capped, collName)
+		se.cappedMu.Unlock()
+		return nil
+	}
+
+	existingIDs, _ := se.memoryMgr.FindIds(context.Background(), collName, nil)
+	tracker := storage.NewCappedTracker(maxDocs, policy, existingIDs)
+	se.cappedMu.Lock()
+	se.capped[collName] = tracker
+	se.cappedMu.Unlock()
+
+	se.evict(collName, tracker.Victims())
+	return nil
+}
+
+// GetCollectionCapped implements domain.StorageEngine
+func (se *StorageEngine) GetCollectionCapped(collName string) *domain.CappedConfig {
+	tracker := se.cappedTracker(collName)
+	if tracker == nil {
+		return nil
+	}
+	return tracker.Config()
+}
+
+// SetCollectionCompact implements domain.StorageEngine. The v2 engine keeps its
+// documents as maps, so marking a collection compact fails; clearing it is a no-op.
+func (se *StorageEngine) SetCollectionCompact(collName string, compact bool) error {
+	if compact {
+		return domain.Errorf(domain.ErrCompactUnsupported, "the v2 engine does not support compact collections")
+	}
+	return nil
+}
+
+// IsCollectionCompact implements domain.StorageEngine
+func (se *StorageEngine) IsCollectionCompact(collName string) bool {
+	return false
+}
+
+// cappedTracker returns the collection's tracker, or nil if it is not capped
+func (se *StorageEngine) cappedTracker(collName string) *storage.CappedTracker {
+	se.cappedMu.RLock()
+	defer se.cappedMu.RUnlock()
+	return se.capped[collName]
+}
+
+// trackInserts records inserted documents of a capped collection and evicts the
+// documents over its cap
+func (se *StorageEngine) trackInserts(collName string, docs ...domain.Document) {
+	tracker := se.cappedTracker(collName)
+	if tracker == nil {
+		return
+	}
+
+	var victims []string
+	for _, doc := range docs {
+		victims = append(victims, tracker.Added(doc["_id"].(string))...)
+	}
+	se.evict(collName, victims)
+}
+
+// trackAccess records a read or write of a document in a capped collection
+func (se *StorageEngine) trackAccess(collName, docID string) {
+	if tracker := se.cappedTracker(collName); tracker != nil {
+		tracker.Touched(docID)
+	}
+}
+
+// evict deletes evicted documents through the WAL like any other delete
+func (se *StorageEngine) evict(collName string, docIDs []string) {
+	for _, docID := range docIDs {
+		if err := se.deleteById(collName, docID); err != nil {
+			log.Printf("WARN: Failed to evict %s/%s from capped collection: %v", collName, docID, err)
+		}
+	}
+}
+
 // IsNoSavesEnabled implements domain.StorageEngine (for compatibility)
 func (se *StorageEngine) IsNoSavesEnabled() bool {
 	// v2 storage engine doesn't have no-saves mode, always returns false
 	return false
 }
 
+// AutoTimestampsEnabled implements domain.StorageEngine. The v2 engine does not
+// maintain _created_at and _updated_at.
+func (se *StorageEngine) AutoTimestampsEnabled() bool {
+	return false
+}
+
+// DocumentVersionsEnabled implements domain.StorageEngine. The v2 engine does not
+// maintain _version.
+func (se *StorageEngine) DocumentVersionsEnabled() bool {
+	return false
+}
+
+// UpdateByIdIfVersion implements domain.StorageEngine. Documents are not versioned,
+// so it always fails with domain.ErrVersionsDisabled.
+func (se *StorageEngine) UpdateByIdIfVersion(collName, docId string, expectedVersion int, updates domain.Document) (domain.Document, error) {
+	return se.UpdateByIdIfVersionContext(context.Background(), collName, docId, expectedVersion, updates)
+}
+
+// UpdateByIdIfVersionContext implements domain.StorageEngine
+func (se *StorageEngine) UpdateByIdIfVersionContext(ctx context.Context, collName, docId string, expectedVersion int, updates domain.Document) (domain.Document, error) {
+	return nil, domain.Errorf(domain.ErrVersionsDisabled, "the v2 engine does not version documents")
+}
+
 // GetIndexEngine returns the index engine instance
 func (se *StorageEngine) GetIndexEngine() domain.IndexEngine {
 	return se.indexEngine
@@ -587,6 +2225,109 @@ func (se *StorageEngine) CreateIndex(collName, fieldName string) error {
 	return nil
 }
 
+// CreateUniqueIndex implements domain.StorageEngine
+func (se *StorageEngine) CreateUniqueIndex(collName, fieldName string) error {
+	return se.createKeyedIndex(collName, fieldName, true, func() error {
+		return se.indexEngine.CreateUniqueIndex(collName, fieldName)
+	})
+}
+
+// CreateCompoundIndex implements domain.StorageEngine
+func (se *StorageEngine) CreateCompoundIndex(collName string, fieldNames []string, unique bool) error {
+	if err := storage.ValidateCompoundIndexFields(fieldNames); err != nil {
+		return err
+	}
+	return se.createKeyedIndex(collName, indexing.CompoundIndexName(fieldNames), unique, func() error {
+		return se.indexEngine.CreateCompoundIndex(collName, fieldNames, unique)
+	})
+}
+
+// CreateCollatedIndex implements domain.StorageEngine
+func (se *StorageEngine) CreateCollatedIndex(collName, fieldName, collation string, unique bool) error {
+	if collation == "" {
+		return fmt.Errorf("a collated index needs a collation")
+	}
+	return se.createKeyedIndex(collName, fieldName, unique, func() error {
+		return se.indexEngine.CreateCollatedIndex(collName, fieldName, collation, unique)
+	})
+}
+
+// createKeyedIndex registers an index named name with create and builds it. While a
+// unique index is built no write can check or store keys, and it is dropped again
+// when existing documents already share one of its keys.
+func (se *StorageEngine) createKeyedIndex(collName, name string, unique bool, create func() error) error {
+	if unique {
+		lock := se.uniqueKeyLock(collName)
+		lock.Lock()
+		defer lock.Unlock()
+	}
+
+	if err := create(); err != nil {
+		return fmt.Errorf("failed to create index: %w", err)
+	}
+	if err := se.buildIndexForCollection(collName, name); err != nil {
+		se.indexEngine.DropIndex(collName, name)
+		return fmt.Errorf("failed to build index: %w", err)
+	}
+	if index, exists := se.indexEngine.GetIndex(collName, name); unique && exists {
+		if err := storage.CheckUniqueIndexKeys(collName, index); err != nil {
+			se.indexEngine.DropIndex(collName, name)
+			return err
+		}
+	}
+
+	se.collectionsMu.Lock()
+	if collInfo, exists := se.collections[collName]; exists {
+		collInfo.Indexes = append(collInfo.Indexes, name)
+	}
+	se.collectionsMu.Unlock()
+
+	return nil
+}
+
+// CreateIndexWithTypeCheck implements domain.StorageEngine
+func (se *StorageEngine) CreateIndexWithTypeCheck(collName, fieldName string, reject bool) (*domain.FieldTypeReport, error) {
+	collection, err := se.indexableCollection(collName)
+	if err != nil {
+		return nil, err
+	}
+
+	report := storage.NewFieldTypeReport(fieldName)
+	for _, doc := range collection.Documents {
+		storage.CountFieldType(report, doc)
+	}
+	if err := storage.CheckFieldTypes(report, reject); err != nil {
+		return report, err
+	}
+
+	return report, se.CreateIndex(collName, fieldName)
+}
+
+// CreatePartialIndex implements domain.StorageEngine
+func (se *StorageEngine) CreatePartialIndex(collName, fieldName string, condition map[string]interface{}) error {
+	if err := storage.ValidateIndexCondition(condition); err != nil {
+		return err
+	}
+	condition = storage.CopyDocument(condition)
+
+	if err := se.indexEngine.CreatePartialIndex(collName, fieldName, condition, storage.PartialIndexMatcher(condition)); err != nil {
+		return fmt.Errorf("failed to create index: %w", err)
+	}
+
+	if err := se.buildIndexForCollection(collName, fieldName); err != nil {
+		se.indexEngine.DropIndex(collName, fieldName)
+		return fmt.Errorf("failed to build index: %w", err)
+	}
+
+	se.collectionsMu.Lock()
+	if collInfo, exists := se.collections[collName]; exists {
+		collInfo.Indexes = append(collInfo.Indexes, fieldName)
+	}
+	se.collectionsMu.Unlock()
+
+	return nil
+}
+
 // DropIndex removes an index from a collection
 func (se *StorageEngine) DropIndex(collName, fieldName string) error {
 	// Drop index from index engine
@@ -610,12 +2351,37 @@ func (se *StorageEngine) DropIndex(collName, fieldName string) error {
 	return nil
 }
 
+// DropAllIndexes implements domain.StorageEngine.
+// The primary _id index is always kept.
+func (se *StorageEngine) DropAllIndexes(collName string) (int, error) {
+	se.collectionsMu.Lock()
+	defer se.collectionsMu.Unlock()
+
+	collInfo, exists := se.collections[collName]
+	if !exists {
+		return 0, domain.Errorf(domain.ErrCollectionNotFound, "collection %s not found", collName)
+	}
+
+	dropped := se.indexEngine.DropAllIndexes(collName, "_id")
+
+	// Update collection metadata
+	remaining := collInfo.Indexes[:0]
+	for _, idx := range collInfo.Indexes {
+		if idx == "_id" {
+			remaining = append(remaining, idx)
+		}
+	}
+	collInfo.Indexes = remaining
+
+	return dropped, nil
+}
+
 // FindByIndex finds documents using an index
 func (se *StorageEngine) FindByIndex(collName, fieldName string, value interface{}) ([]domain.Document, error) {
 	// Get the index
 	index, exists := se.indexEngine.GetIndex(collName, fieldName)
 	if !exists {
-		return nil, fmt.Errorf("index on field %s does not exist in collection %s", fieldName, collName)
+		return nil, domain.Errorf(domain.ErrIndexNotFound, "index on field %s does not exist in collection %s", fieldName, collName)
 	}
 
 	// Query the index to get document IDs
@@ -643,13 +2409,98 @@ func (se *StorageEngine) UpdateIndex(collName, fieldName string) error {
 	// Check if index exists
 	_, exists := se.indexEngine.GetIndex(collName, fieldName)
 	if !exists {
-		return fmt.Errorf("index on field %s does not exist in collection %s", fieldName, collName)
+		return domain.Errorf(domain.ErrIndexNotFound, "index on field %s does not exist in collection %s", fieldName, collName)
 	}
 
 	// Rebuild the index
 	return se.buildIndexForCollection(collName, fieldName)
 }
 
+// RebuildIndexes implements domain.StorageEngine
+func (se *StorageEngine) RebuildIndexes(collName string) error {
+	return se.RebuildIndexesContext(context.Background(), collName, nil)
+}
+
+// RebuildIndexesContext implements domain.StorageEngine. The rebuild works from a snapshot
+// of the collection's documents, so writes made while it runs may need another rebuild.
+func (se *StorageEngine) RebuildIndexesContext(ctx context.Context, collName string, progress func(processed, total int)) error {
+	se.collectionsMu.RLock()
+	_, exists := se.collections[collName]
+	se.collectionsMu.RUnlock()
+	if !exists {
+		return domain.Errorf(domain.ErrCollectionNotFound, "collection %s not found", collName)
+	}
+
+	collection, err := se.indexableCollection(collName)
+	if err != nil {
+		return err
+	}
+	return se.indexEngine.RebuildIndexes(ctx, collName, collection, progress)
+}
+
+// TransformDocumentsContext implements domain.StorageEngine. Each changed document is
+// written to the WAL as a replacement under its document lock.
+func (se *StorageEngine) TransformDocumentsContext(ctx context.Context, collName string, transform func(domain.Document) (domain.Document, bool), progress func(processed, total int)) (int, error) {
+	se.collectionsMu.RLock()
+	_, exists := se.collections[collName]
+	se.collectionsMu.RUnlock()
+	if !exists {
+		return 0, domain.Errorf(domain.ErrCollectionNotFound, "collection %s not found", collName)
+	}
+
+	documents, err := se.memoryMgr.GetAllDocuments(collName)
+	if err != nil {
+		return 0, err
+	}
+	docIDs := make([]string, 0, len(documents))
+	for docID := range documents {
+		docIDs = append(docIDs, docID)
+	}
+
+	changed := 0
+	for i, docID := range docIDs {
+		if i%transformProgressInterval == 0 {
+			if err := ctx.Err(); err != nil {
+				return changed, err
+			}
+		}
+		docChanged, err := se.transformDocument(collName, docID, transform)
+		if err != nil {
+			return changed, fmt.Errorf("failed to transform document %s: %w", docID, err)
+		}
+		if docChanged {
+			changed++
+		}
+		if progress != nil && ((i+1)%transformProgressInterval == 0 || i+1 == len(docIDs)) {
+			progress(i+1, len(docIDs))
+		}
+	}
+	return changed, nil
+}
+
+// transformProgressInterval is how many documents TransformDocumentsContext processes
+// between progress reports and cancellation checks
+const transformProgressInterval = 256
+
+// transformDocument applies transform to one document, skipping it if it was deleted
+func (se *StorageEngine) transformDocument(collName, docID string, transform func(domain.Document) (domain.Document, bool)) (bool, error) {
+	unlock := se.lockDocument(collName, docID)
+	defer unlock()
+
+	existing, err := se.memoryMgr.GetById(collName, docID)
+	if err != nil {
+		return false, nil
+	}
+	newDoc, changed := transform(storage.CopyDocument(existing))
+	if !changed {
+		return false, nil
+	}
+	if _, err := se.applyReplace(collName, docID, existing, newDoc, writeDurability{}); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
 // Helper methods
 
 func (se *StorageEngine) generateDocumentID(collName string) string {
@@ -696,10 +2547,21 @@ func (se *StorageEngine) updateStats(updater func(*StorageStats)) {
 
 // buildIndexForCollection builds an index for all documents in a collection
 func (se *StorageEngine) buildIndexForCollection(collName, fieldName string) error {
+	collection, err := se.indexableCollection(collName)
+	if err != nil {
+		return err
+	}
+
+	// Build the index
+	return se.indexEngine.BuildIndexForCollection(collName, fieldName, collection)
+}
+
+// indexableCollection gathers a collection's documents into a domain.Collection for the index engine
+func (se *StorageEngine) indexableCollection(collName string) (*domain.Collection, error) {
 	// Get all documents from memory manager
 	documents, err := se.memoryMgr.GetAllDocuments(collName)
 	if err != nil {
-		return fmt.Errorf("failed to get documents: %w", err)
+		return nil, fmt.Errorf("failed to get documents: %w", err)
 	}
 
 	// Create a domain.Collection for the index engine
@@ -715,11 +2577,10 @@ func (se *StorageEngine) buildIndexForCollection(collName, fieldName string) err
 		}
 	}
 
-	// Build the index
-	return se.indexEngine.BuildIndexForCollection(collName, fieldName, collection)
+	return collection, nil
 }
 
-// updateIndexesForDocument updates all indexes when a document changes
+// updateIndexesForDocument updates all indexes, and records the change, when a document changes
 func (se *StorageEngine) updateIndexesForDocument(collName, docID string, oldDoc, newDoc domain.Document) {
 	// Ensure _id index exists
 	if _, exists := se.indexEngine.GetIndex(collName, "_id"); !exists {
@@ -731,4 +2592,7 @@ func (se *StorageEngine) updateIndexesForDocument(collName, docID string, oldDoc
 
 	// Update all indexes
 	se.indexEngine.UpdateIndexForDocument(collName, docID, oldDoc, newDoc)
+	se.idKeysets.DocumentChanged(collName, docID, oldDoc, newDoc)
+	se.insertionOrder.DocumentChanged(collName, docID, oldDoc, newDoc)
+	se.changeLog.DocumentChanged(collName, docID, oldDoc, newDoc)
 }
@@ -1,12 +1,21 @@
 package v2
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/adfharrison1/go-db/pkg/domain"
+	"github.com/adfharrison1/go-db/pkg/storage"
 )
 
 // createTestDirs creates unique test directories for each test
@@ -28,7 +37,7 @@ func createTestDirs(t *testing.T) (string, string, string) {
 
 func TestNewStorageEngine(t *testing.T) {
 	// Test basic creation
-	engine := NewStorageEngine()
+	engine := NewStorageEngine(WithWALDir(t.TempDir()), WithDataDir(t.TempDir()), WithCheckpointDir(t.TempDir()))
 	if engine == nil {
 		t.Fatal("Expected engine to be created")
 	}
@@ -261,7 +270,7 @@ func TestStorageEngine_FindAll(t *testing.T) {
 	}
 }
 
-func TestStorageEngine_GetMemoryStats(t *testing.T) {
+func TestStorageEngine_FindAllContext_Cancelled(t *testing.T) {
 	walDir, dataDir, checkpointDir := createTestDirs(t)
 	engine := NewStorageEngine(
 		WithWALDir(walDir),
@@ -269,156 +278,2850 @@ func TestStorageEngine_GetMemoryStats(t *testing.T) {
 		WithCheckpointDir(checkpointDir),
 	)
 
-	stats := engine.GetMemoryStats()
-	if stats == nil {
-		t.Fatal("Expected stats to be returned")
+	if _, err := engine.Insert("test_collection", domain.Document{"name": "Alice"}); err != nil {
+		t.Fatalf("Failed to insert document: %v", err)
 	}
 
-	// Insert a document to generate some stats
-	doc := domain.Document{"_id": "stats-test", "name": "Test"}
-	_, err := engine.Insert("test_collection", doc)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := engine.FindAllContext(ctx, "test_collection", nil, nil); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+
+	docChan, err := engine.FindAllStreamContext(ctx, "test_collection", nil)
 	if err != nil {
-		t.Fatalf("Failed to insert document: %v", err)
+		t.Fatalf("Failed to start stream: %v", err)
 	}
+	for doc := range docChan {
+		t.Errorf("Expected no documents from a cancelled stream, got %v", doc)
+	}
+}
 
-	stats = engine.GetMemoryStats()
-	if stats["collection_count"] == nil {
-		t.Error("Expected collection_count in stats")
+func TestStorageEngine_ReadYourWrites(t *testing.T) {
+	for _, level := range []ConsistencyLevel{ConsistencyReadYourWrites, ConsistencyLinearizable} {
+		walDir, dataDir, checkpointDir := createTestDirs(t)
+		engine := NewStorageEngine(
+			WithWALDir(walDir),
+			WithDataDir(dataDir),
+			WithCheckpointDir(checkpointDir),
+			WithDurabilityLevel(DurabilityMemory),
+			WithConsistencyLevel(level),
+		)
+
+		if _, err := engine.Insert("counters", domain.Document{"_id": "c1", "value": 0}); err != nil {
+			t.Fatalf("Failed to insert document: %v", err)
+		}
+
+		for i := 1; i <= 500; i++ {
+			if _, err := engine.UpdateById("counters", "c1", domain.Document{"value": i}); err != nil {
+				t.Fatalf("Failed to update document: %v", err)
+			}
+
+			doc, err := engine.GetById("counters", "c1")
+			if err != nil {
+				t.Fatalf("Failed to get document: %v", err)
+			}
+			if doc["value"] != i {
+				t.Fatalf("consistency level %d: expected value %d immediately after update, got %v", level, i, doc["value"])
+			}
+		}
+
+		engine.StopBackgroundWorkers()
 	}
 }
 
-func TestStorageEngine_CreateIndex(t *testing.T) {
+func TestStorageEngine_CollectionNameValidation(t *testing.T) {
 	walDir, dataDir, checkpointDir := createTestDirs(t)
 	engine := NewStorageEngine(
 		WithWALDir(walDir),
 		WithDataDir(dataDir),
 		WithCheckpointDir(checkpointDir),
+		WithDurabilityLevel(DurabilityMemory),
 	)
+	defer engine.StopBackgroundWorkers()
 
-	// Create collection first
-	if err := engine.CreateCollection("test_collection"); err != nil {
-		t.Fatalf("Failed to create collection: %v", err)
+	if err := engine.CreateCollection("../outside"); !errors.Is(err, domain.ErrInvalidCollectionName) {
+		t.Fatalf("Expected invalid collection name error, got %v", err)
+	}
+	if _, err := engine.Insert("bad/name", domain.Document{"name": "Alice"}); !errors.Is(err, domain.ErrInvalidCollectionName) {
+		t.Fatalf("Expected invalid collection name error from Insert, got %v", err)
+	}
+	if _, err := engine.BatchInsert("bad name", []domain.Document{{"name": "Alice"}}); !errors.Is(err, domain.ErrInvalidCollectionName) {
+		t.Fatalf("Expected invalid collection name error from BatchInsert, got %v", err)
 	}
+	if _, err := engine.GetCollection("bad/name"); err == nil {
+		t.Fatal("Rejected collection should not have been created")
+	}
+	if _, err := engine.Insert("good_name", domain.Document{"name": "Alice"}); err != nil {
+		t.Fatalf("Failed to insert into valid collection: %v", err)
+	}
+}
 
-	// Insert some test documents
-	docs := []domain.Document{
-		{"_id": "doc1", "name": "Alice", "age": 30},
-		{"_id": "doc2", "name": "Bob", "age": 25},
-		{"_id": "doc3", "name": "Charlie", "age": 35},
+func TestStorageEngine_CollectionDefaults(t *testing.T) {
+	walDir, dataDir, checkpointDir := createTestDirs(t)
+	engine := NewStorageEngine(
+		WithWALDir(walDir),
+		WithDataDir(dataDir),
+		WithCheckpointDir(checkpointDir),
+		WithDurabilityLevel(DurabilityMemory),
+	)
+	defer engine.StopBackgroundWorkers()
+
+	engine.SetCollectionDefaults("orders", domain.Document{"status": "new", "created_at": "$$NOW"})
+
+	doc, err := engine.Insert("orders", domain.Document{"item": "pen"})
+	if err != nil {
+		t.Fatalf("Failed to insert document: %v", err)
+	}
+	if doc["status"] != "new" {
+		t.Errorf("Expected default status 'new', got %v", doc["status"])
+	}
+	if _, ok := doc["created_at"].(string); !ok {
+		t.Errorf("Expected created_at timestamp, got %v", doc["created_at"])
 	}
 
-	for _, doc := range docs {
-		_, err := engine.Insert("test_collection", doc)
-		if err != nil {
+	docs, err := engine.BatchInsert("orders", []domain.Document{{"item": "desk", "status": "shipped"}})
+	if err != nil {
+		t.Fatalf("Failed to batch insert documents: %v", err)
+	}
+	if docs[0]["status"] != "shipped" {
+		t.Errorf("Client-supplied status was overridden: %v", docs[0]["status"])
+	}
+
+	engine.SetCollectionDefaults("orders", nil)
+	if defaults := engine.GetCollectionDefaults("orders"); defaults != nil {
+		t.Errorf("Expected defaults to be cleared, got %v", defaults)
+	}
+}
+
+func TestStorageEngine_CappedCollection(t *testing.T) {
+	walDir, dataDir, checkpointDir := createTestDirs(t)
+	engine := NewStorageEngine(
+		WithWALDir(walDir),
+		WithDataDir(dataDir),
+		WithCheckpointDir(checkpointDir),
+		WithDurabilityLevel(DurabilityMemory),
+	)
+	defer engine.StopBackgroundWorkers()
+
+	if err := engine.SetCollectionCapped("sessions", 2, "newest"); err == nil {
+		t.Fatal("Expected unknown evict policy to be rejected")
+	}
+	if err := engine.SetCollectionCapped("sessions", 2, domain.EvictLRU); err != nil {
+		t.Fatalf("Failed to cap collection: %v", err)
+	}
+
+	for _, id := range []string{"a", "b"} {
+		if _, err := engine.Insert("sessions", domain.Document{"_id": id}); err != nil {
 			t.Fatalf("Failed to insert document: %v", err)
 		}
 	}
-
-	// Create index on name field
-	if err := engine.CreateIndex("test_collection", "name"); err != nil {
-		t.Fatalf("Failed to create index: %v", err)
+	// Reading "a" makes "b" the least recently used document
+	if _, err := engine.GetById("sessions", "a"); err != nil {
+		t.Fatalf("Failed to get document: %v", err)
+	}
+	if _, err := engine.Insert("sessions", domain.Document{"_id": "c"}); err != nil {
+		t.Fatalf("Failed to insert document: %v", err)
 	}
 
-	// Test finding documents by index
-	results, err := engine.FindByIndex("test_collection", "name", "Alice")
+	ids, err := engine.FindIds("sessions", nil)
 	if err != nil {
-		t.Fatalf("Failed to find by index: %v", err)
+		t.Fatalf("Failed to find ids: %v", err)
 	}
-
-	if len(results) != 1 {
-		t.Errorf("Expected 1 result, got %d", len(results))
+	if len(ids) != 2 || ids[0] != "a" || ids[1] != "c" {
+		t.Errorf("Expected [a c] after eviction, got %v", ids)
 	}
 
-	if results[0]["name"] != "Alice" {
-		t.Errorf("Expected Alice, got %v", results[0]["name"])
+	if capped := engine.GetCollectionCapped("sessions"); capped == nil || capped.MaxDocs != 2 || capped.Policy != domain.EvictLRU {
+		t.Errorf("Unexpected cap %+v", capped)
+	}
+	if err := engine.SetCollectionCapped("sessions", 0, ""); err != nil {
+		t.Fatalf("Failed to remove cap: %v", err)
+	}
+	if capped := engine.GetCollectionCapped("sessions"); capped != nil {
+		t.Errorf("Expected cap to be removed, got %+v", capped)
 	}
 }
 
-func TestStorageEngine_IndexUpdates(t *testing.T) {
+func TestStorageEngine_CopyCollection(t *testing.T) {
 	walDir, dataDir, checkpointDir := createTestDirs(t)
 	engine := NewStorageEngine(
 		WithWALDir(walDir),
 		WithDataDir(dataDir),
 		WithCheckpointDir(checkpointDir),
+		WithDurabilityLevel(DurabilityMemory),
 	)
+	defer engine.StopBackgroundWorkers()
 
-	// Create collection and insert document
-	doc := domain.Document{"_id": "doc1", "name": "Alice", "age": 30}
-	_, err := engine.Insert("test_collection", doc)
+	alice, err := engine.Insert("users", domain.Document{"name": "Alice", "city": "Paris"})
 	if err != nil {
 		t.Fatalf("Failed to insert document: %v", err)
 	}
+	if _, err := engine.Insert("users", domain.Document{"name": "Bob", "city": "Rome"}); err != nil {
+		t.Fatalf("Failed to insert document: %v", err)
+	}
+	if err := engine.CreateIndex("users", "city"); err != nil {
+		t.Fatalf("Failed to create index: %v", err)
+	}
 
-	// Create index on name field
-	if err := engine.CreateIndex("test_collection", "name"); err != nil {
+	if err := engine.CopyCollection("users", "users_v2"); err != nil {
+		t.Fatalf("Failed to copy collection: %v", err)
+	}
+
+	aliceID := alice["_id"].(string)
+	doc, err := engine.GetById("users_v2", aliceID)
+	if err != nil {
+		t.Fatalf("Copied document %s not found: %v", aliceID, err)
+	}
+	if doc["name"] != "Alice" {
+		t.Errorf("Expected copied name 'Alice', got %v", doc["name"])
+	}
+
+	docs, err := engine.FindByIndex("users_v2", "city", "Rome")
+	if err != nil {
+		t.Fatalf("Expected city index on copy: %v", err)
+	}
+	if len(docs) != 1 {
+		t.Errorf("Expected 1 document in Rome, got %d", len(docs))
+	}
+
+	if _, err := engine.UpdateById("users", aliceID, domain.Document{"name": "Alicia"}); err != nil {
+		t.Fatalf("Failed to update source: %v", err)
+	}
+	doc, _ = engine.GetById("users_v2", aliceID)
+	if doc["name"] != "Alice" {
+		t.Errorf("Copy changed with the source: %v", doc["name"])
+	}
+
+	if err := engine.CopyCollection("users", "users_v2"); !errors.Is(err, domain.ErrCollectionExists) {
+		t.Errorf("Expected ErrCollectionExists, got %v", err)
+	}
+	if err := engine.CopyCollection("missing", "missing_copy"); err == nil {
+		t.Error("Expected error copying a missing collection")
+	}
+
+	// A copy that cannot be written leaves no destination behind
+	engine.walEngine.Close()
+	if err := engine.CopyCollection("users", "users_v3"); err == nil {
+		t.Fatal("Expected error copying with a closed WAL")
+	}
+	if _, err := engine.GetCollection("users_v3"); !errors.Is(err, domain.ErrCollectionNotFound) {
+		t.Errorf("Expected ErrCollectionNotFound after a failed copy, got %v", err)
+	}
+	if indexes, _ := engine.GetIndexes("users_v3"); len(indexes) != 0 {
+		t.Errorf("Expected no indexes after a failed copy, got %v", indexes)
+	}
+}
+
+func TestStorageEngine_DropCollection(t *testing.T) {
+	walDir, dataDir, checkpointDir := createTestDirs(t)
+	options := []StorageOption{
+		WithWALDir(walDir),
+		WithDataDir(dataDir),
+		WithCheckpointDir(checkpointDir),
+		WithDurabilityLevel(DurabilityMemory),
+		WithCheckpointInterval(time.Hour),
+	}
+	engine := NewStorageEngine(options...)
+
+	if _, err := engine.Insert("users", domain.Document{"name": "Alice", "city": "Paris"}); err != nil {
+		t.Fatalf("Failed to insert document: %v", err)
+	}
+	if _, err := engine.Insert("orders", domain.Document{"total": 5}); err != nil {
+		t.Fatalf("Failed to insert document: %v", err)
+	}
+	if err := engine.CreateIndex("users", "city"); err != nil {
 		t.Fatalf("Failed to create index: %v", err)
 	}
+	// The checkpoint still holds the collection, so recovery must replay the drop
+	if err := engine.checkpointMgr.Checkpoint(); err != nil {
+		t.Fatalf("Checkpoint failed: %v", err)
+	}
 
-	// Update document
-	updates := domain.Document{"name": "Alice Updated"}
-	_, err = engine.UpdateById("test_collection", "doc1", updates)
+	if err := engine.DropCollection("users"); err != nil {
+		t.Fatalf("DropCollection failed: %v", err)
+	}
+	if _, err := engine.GetCollection("users"); !errors.Is(err, domain.ErrCollectionNotFound) {
+		t.Errorf("Expected ErrCollectionNotFound after the drop, got %v", err)
+	}
+	if indexes, _ := engine.GetIndexes("users"); len(indexes) != 0 {
+		t.Errorf("Expected no indexes after the drop, got %v", indexes)
+	}
+	if err := engine.DropCollection("users"); !errors.Is(err, domain.ErrCollectionNotFound) {
+		t.Errorf("Expected ErrCollectionNotFound dropping a missing collection, got %v", err)
+	}
+
+	engine.walEngine.Close()
+	recovered := NewStorageEngine(options...)
+	defer recovered.StopBackgroundWorkers()
+	if _, err := recovered.GetCollection("users"); !errors.Is(err, domain.ErrCollectionNotFound) {
+		t.Errorf("Expected the dropped collection to stay dropped after recovery, got %v", err)
+	}
+	result, err := recovered.FindAll("orders", nil, nil)
 	if err != nil {
-		t.Fatalf("Failed to update document: %v", err)
+		t.Fatalf("FindAll failed: %v", err)
+	}
+	if len(result.Documents) != 1 {
+		t.Errorf("Expected 1 order after recovery, got %d", len(result.Documents))
 	}
+}
 
-	// Test that index was updated
-	results, err := engine.FindByIndex("test_collection", "name", "Alice Updated")
+func TestStorageEngine_MaxCollections(t *testing.T) {
+	walDir, dataDir, checkpointDir := createTestDirs(t)
+	engine := NewStorageEngine(
+		WithWALDir(walDir),
+		WithDataDir(dataDir),
+		WithCheckpointDir(checkpointDir),
+		WithDurabilityLevel(DurabilityMemory),
+		WithMaxCollections(1),
+	)
+	defer engine.StopBackgroundWorkers()
+
+	if _, err := engine.Insert("first", domain.Document{"name": "Alice"}); err != nil {
+		t.Fatalf("Failed to insert into first collection: %v", err)
+	}
+	if _, err := engine.Insert("first", domain.Document{"name": "Bob"}); err != nil {
+		t.Errorf("Insert into an existing collection failed at the limit: %v", err)
+	}
+
+	if _, err := engine.Insert("second", domain.Document{"name": "Carol"}); !errors.Is(err, domain.ErrCollectionLimitReached) {
+		t.Errorf("Expected ErrCollectionLimitReached from Insert, got %v", err)
+	}
+	if _, err := engine.BatchInsert("second", []domain.Document{{"name": "Carol"}}); !errors.Is(err, domain.ErrCollectionLimitReached) {
+		t.Errorf("Expected ErrCollectionLimitReached from BatchInsert, got %v", err)
+	}
+	if err := engine.CreateCollection("second"); !errors.Is(err, domain.ErrCollectionLimitReached) {
+		t.Errorf("Expected ErrCollectionLimitReached from CreateCollection, got %v", err)
+	}
+}
+
+func TestStorageEngine_MaxResultSize(t *testing.T) {
+	walDir, dataDir, checkpointDir := createTestDirs(t)
+	engine := NewStorageEngine(
+		WithWALDir(walDir),
+		WithDataDir(dataDir),
+		WithCheckpointDir(checkpointDir),
+		WithDurabilityLevel(DurabilityMemory),
+		WithMaxResultSize(2),
+	)
+	defer engine.StopBackgroundWorkers()
+
+	docs := []domain.Document{{"city": "Paris"}, {"city": "Paris"}, {"city": "Rome"}}
+	if _, err := engine.BatchInsert("users", docs); err != nil {
+		t.Fatalf("Failed to insert documents: %v", err)
+	}
+
+	if _, err := engine.FindAll("users", nil, &domain.PaginationOptions{Limit: 1}); !errors.Is(err, domain.ErrResultTooLarge) {
+		t.Errorf("Expected ErrResultTooLarge for an unfiltered find, got %v", err)
+	}
+	result, err := engine.FindAll("users", map[string]interface{}{"city": "Paris"}, nil)
 	if err != nil {
-		t.Fatalf("Failed to find by index: %v", err)
+		t.Fatalf("FindAll within the limit failed: %v", err)
+	}
+	if len(result.Documents) != 2 {
+		t.Errorf("Expected 2 documents, got %d", len(result.Documents))
 	}
+}
 
-	if len(results) != 1 {
-		t.Errorf("Expected 1 result, got %d", len(results))
+func TestStorageEngine_CompareAndSetField(t *testing.T) {
+	walDir, dataDir, checkpointDir := createTestDirs(t)
+	engine := NewStorageEngine(
+		WithWALDir(walDir),
+		WithDataDir(dataDir),
+		WithCheckpointDir(checkpointDir),
+		WithDurabilityLevel(DurabilityMemory),
+	)
+	defer engine.StopBackgroundWorkers()
+
+	inserted, err := engine.Insert("jobs", domain.Document{"status": "pending", "attempts": 0})
+	if err != nil {
+		t.Fatalf("Failed to insert document: %v", err)
 	}
+	id := inserted["_id"].(string)
 
-	if results[0]["name"] != "Alice Updated" {
-		t.Errorf("Expected Alice Updated, got %v", results[0]["name"])
+	applied, err := engine.CompareAndSetField("jobs", id, "status", "pending", "running")
+	if err != nil || !applied {
+		t.Fatalf("Expected compare-and-set to apply, got applied=%t err=%v", applied, err)
+	}
+	applied, err = engine.CompareAndSetField("jobs", id, "status", "pending", "failed")
+	if err != nil || applied {
+		t.Errorf("Expected a stale compare-and-set not to apply, got applied=%t err=%v", applied, err)
+	}
+	applied, err = engine.CompareAndSetField("jobs", id, "attempts", float64(0), 1)
+	if err != nil || !applied {
+		t.Errorf("Expected numeric compare-and-set to apply, got applied=%t err=%v", applied, err)
 	}
 
-	// Test that old value is no longer indexed
-	oldResults, err := engine.FindByIndex("test_collection", "name", "Alice")
+	doc, err := engine.GetById("jobs", id)
 	if err != nil {
-		t.Fatalf("Failed to find by index: %v", err)
+		t.Fatalf("Failed to get document: %v", err)
+	}
+	if doc["status"] != "running" {
+		t.Errorf("Expected status running, got %v", doc["status"])
 	}
 
-	if len(oldResults) != 0 {
-		t.Errorf("Expected 0 results for old value, got %d", len(oldResults))
+	if _, err := engine.CompareAndSetField("jobs", id, "_id", "1", "2"); !errors.Is(err, domain.ErrInvalidField) {
+		t.Errorf("Expected ErrInvalidField for _id, got %v", err)
+	}
+	if _, err := engine.CompareAndSetField("jobs", "missing", "status", "pending", "running"); err == nil {
+		t.Error("Expected an error for a missing document")
 	}
 }
 
-func TestStorageEngine_IndexDeletion(t *testing.T) {
+func TestStorageEngine_CompareAndSetFieldConcurrent(t *testing.T) {
 	walDir, dataDir, checkpointDir := createTestDirs(t)
 	engine := NewStorageEngine(
 		WithWALDir(walDir),
 		WithDataDir(dataDir),
 		WithCheckpointDir(checkpointDir),
+		WithDurabilityLevel(DurabilityMemory),
 	)
+	defer engine.StopBackgroundWorkers()
 
-	// Create collection and insert document
-	doc := domain.Document{"_id": "doc1", "name": "Alice", "age": 30}
-	_, err := engine.Insert("test_collection", doc)
+	inserted, err := engine.Insert("jobs", domain.Document{"status": "pending"})
 	if err != nil {
 		t.Fatalf("Failed to insert document: %v", err)
 	}
+	id := inserted["_id"].(string)
+
+	// Only one of the callers racing from the same expected value may win,
+	// without ConsistencyLinearizable too
+	const rounds, callers = 200, 8
+	for round := 0; round < rounds; round++ {
+		var wins int32
+		var wg sync.WaitGroup
+		start := make(chan struct{})
+		for i := 0; i < callers; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				<-start
+				applied, err := engine.CompareAndSetField("jobs", id, "status", "pending", fmt.Sprintf("worker%d", i))
+				if err != nil {
+					t.Errorf("Compare-and-set failed: %v", err)
+				}
+				if applied {
+					atomic.AddInt32(&wins, 1)
+				}
+			}(i)
+		}
+		close(start)
+		wg.Wait()
+		if wins != 1 {
+			t.Fatalf("Round %d: expected exactly one compare-and-set to apply, got %d", round, wins)
+		}
+		if _, err := engine.UpdateById("jobs", id, domain.Document{"status": "pending"}); err != nil {
+			t.Fatalf("Failed to reset document: %v", err)
+		}
+	}
+}
 
-	// Create index on name field
-	if err := engine.CreateIndex("test_collection", "name"); err != nil {
+func TestStorageEngine_CreateIndexWithTypeCheck(t *testing.T) {
+	walDir, dataDir, checkpointDir := createTestDirs(t)
+	engine := NewStorageEngine(
+		WithWALDir(walDir),
+		WithDataDir(dataDir),
+		WithCheckpointDir(checkpointDir),
+		WithDurabilityLevel(DurabilityMemory),
+	)
+	defer engine.StopBackgroundWorkers()
+
+	docs := []domain.Document{{"zip": "02134", "age": 30}, {"zip": 2134, "age": 41}}
+	if _, err := engine.BatchInsert("users", docs); err != nil {
+		t.Fatalf("Failed to insert documents: %v", err)
+	}
+
+	hasIndex := func(field string) bool {
+		indexes, _ := engine.GetIndexes("users")
+		for _, index := range indexes {
+			if index == field {
+				return true
+			}
+		}
+		return false
+	}
+
+	report, err := engine.CreateIndexWithTypeCheck("users", "zip", true)
+	if !errors.Is(err, domain.ErrInconsistentFieldTypes) {
+		t.Fatalf("Expected ErrInconsistentFieldTypes, got %v", err)
+	}
+	if report == nil || report.Consistent || report.Types["string"] != 1 || report.Types["number"] != 1 {
+		t.Errorf("Unexpected type report: %+v", report)
+	}
+	if hasIndex("zip") {
+		t.Error("Expected a rejected index not to be created")
+	}
+
+	report, err = engine.CreateIndexWithTypeCheck("users", "age", true)
+	if err != nil {
+		t.Fatalf("CreateIndexWithTypeCheck failed: %v", err)
+	}
+	if !report.Consistent {
+		t.Errorf("Expected age to be consistent, got %+v", report)
+	}
+	if !hasIndex("age") {
+		t.Error("Expected the age index to be created")
+	}
+}
+
+func TestStorageEngine_TransformDocuments(t *testing.T) {
+	walDir, dataDir, checkpointDir := createTestDirs(t)
+	engine := NewStorageEngine(
+		WithWALDir(walDir),
+		WithDataDir(dataDir),
+		WithCheckpointDir(checkpointDir),
+		WithDurabilityLevel(DurabilityMemory),
+	)
+	defer engine.StopBackgroundWorkers()
+
+	docs := []domain.Document{{"city": "Paris"}, {"city": "Lyon"}, {"town": "Nice"}}
+	if _, err := engine.BatchInsert("users", docs); err != nil {
+		t.Fatalf("Failed to insert documents: %v", err)
+	}
+	if err := engine.CreateIndex("users", "town"); err != nil {
 		t.Fatalf("Failed to create index: %v", err)
 	}
 
-	// Delete document
-	err = engine.DeleteById("test_collection", "doc1")
+	rename := func(doc domain.Document) (domain.Document, bool) {
+		city, exists := doc["city"]
+		if !exists {
+			return doc, false
+		}
+		doc["town"] = city
+		delete(doc, "city")
+		return doc, true
+	}
+
+	var processed, total int
+	changed, err := engine.TransformDocumentsContext(context.Background(), "users", rename, func(p, n int) {
+		processed, total = p, n
+	})
 	if err != nil {
-		t.Fatalf("Failed to delete document: %v", err)
+		t.Fatalf("TransformDocumentsContext failed: %v", err)
+	}
+	if changed != 2 {
+		t.Errorf("Expected 2 documents changed, got %d", changed)
+	}
+	if processed != 3 || total != 3 {
+		t.Errorf("Expected final progress 3/3, got %d/%d", processed, total)
 	}
 
-	// Test that document is no longer found by index
-	results, err := engine.FindByIndex("test_collection", "name", "Alice")
+	result, err := engine.FindAll("users", map[string]interface{}{"town": "Paris"}, nil)
 	if err != nil {
-		t.Fatalf("Failed to find by index: %v", err)
+		t.Fatalf("FindAll failed: %v", err)
+	}
+	if len(result.Documents) != 1 {
+		t.Errorf("Expected the town index to find the renamed document, got %d documents", len(result.Documents))
 	}
 
-	if len(results) != 0 {
-		t.Errorf("Expected 0 results after deletion, got %d", len(results))
+	if changed, _ := engine.TransformDocumentsContext(context.Background(), "users", rename, nil); changed != 0 {
+		t.Errorf("Expected a repeated transform to change nothing, got %d", changed)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := engine.TransformDocumentsContext(ctx, "users", rename, nil); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+	if _, err := engine.TransformDocumentsContext(context.Background(), "missing", rename, nil); err == nil {
+		t.Error("Expected an error for a missing collection")
+	}
+}
+
+func TestStorageEngine_SnapshotRead(t *testing.T) {
+	walDir, dataDir, checkpointDir := createTestDirs(t)
+	engine := NewStorageEngine(
+		WithWALDir(walDir),
+		WithDataDir(dataDir),
+		WithCheckpointDir(checkpointDir),
+		WithDurabilityLevel(DurabilityMemory),
+		WithSnapshotRead(true),
+	)
+	defer engine.StopBackgroundWorkers()
+
+	docs := make([]domain.Document, 300)
+	for i := range docs {
+		docs[i] = domain.Document{"version": 1}
+	}
+	inserted, err := engine.BatchInsert("items", docs)
+	if err != nil {
+		t.Fatalf("Failed to insert documents: %v", err)
+	}
+
+	stream, err := engine.FindAllStream("items", nil)
+	if err != nil {
+		t.Fatalf("FindAllStream failed: %v", err)
+	}
+
+	for _, doc := range inserted {
+		if _, err := engine.UpdateById("items", doc["_id"].(string), domain.Document{"version": 2}); err != nil {
+			t.Fatalf("Failed to update document: %v", err)
+		}
+	}
+	if _, err := engine.Insert("items", domain.Document{"version": 2}); err != nil {
+		t.Fatalf("Failed to insert document: %v", err)
+	}
+
+	count := 0
+	for doc := range stream {
+		if doc["version"] != 1 {
+			t.Errorf("Expected the snapshot version of %v, got version %v", doc["_id"], doc["version"])
+		}
+		count++
+	}
+	if count != len(docs) {
+		t.Errorf("Expected %d documents, got %d", len(docs), count)
+	}
+}
+
+func TestStorageEngine_GetNextPrevById(t *testing.T) {
+	walDir, dataDir, checkpointDir := createTestDirs(t)
+	engine := NewStorageEngine(
+		WithWALDir(walDir),
+		WithDataDir(dataDir),
+		WithCheckpointDir(checkpointDir),
+		WithDurabilityLevel(DurabilityMemory),
+	)
+	defer engine.StopBackgroundWorkers()
+
+	var ids []string
+	for i := 0; i < 3; i++ {
+		doc, err := engine.Insert("items", domain.Document{"n": i})
+		if err != nil {
+			t.Fatalf("Failed to insert document: %v", err)
+		}
+		ids = append(ids, doc["_id"].(string))
+	}
+
+	next, err := engine.GetNextById("items", ids[0])
+	if err != nil || next["_id"] != ids[1] {
+		t.Fatalf("Expected %s after %s, got %v (err=%v)", ids[1], ids[0], next["_id"], err)
+	}
+	prev, err := engine.GetPrevById("items", ids[2])
+	if err != nil || prev["_id"] != ids[1] {
+		t.Errorf("Expected %s before %s, got %v (err=%v)", ids[1], ids[2], prev["_id"], err)
+	}
+
+	if err := engine.DeleteById("items", ids[1]); err != nil {
+		t.Fatalf("Failed to delete document: %v", err)
+	}
+	next, err = engine.GetNextById("items", ids[0])
+	if err != nil || next["_id"] != ids[2] {
+		t.Errorf("Expected %s after the deletion, got %v (err=%v)", ids[2], next["_id"], err)
+	}
+
+	if _, err := engine.GetNextById("items", ids[2]); err == nil {
+		t.Error("Expected an error after the last document")
+	}
+	if _, err := engine.GetPrevById("missing", ids[0]); err == nil {
+		t.Error("Expected an error for a missing collection")
+	}
+}
+
+func TestStorageEngine_MaxConcurrentWrites(t *testing.T) {
+	walDir, dataDir, checkpointDir := createTestDirs(t)
+	engine := NewStorageEngine(
+		WithWALDir(walDir),
+		WithDataDir(dataDir),
+		WithCheckpointDir(checkpointDir),
+		WithDurabilityLevel(DurabilityMemory),
+		WithMaxConcurrentWrites(1),
+	)
+	defer engine.StopBackgroundWorkers()
+
+	// Evicting from a capped collection must not wait for the slot its insert holds
+	if err := engine.SetCollectionCapped("logs", 2, domain.EvictFIFO); err != nil {
+		t.Fatalf("Failed to cap collection: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if _, err := engine.Insert("logs", domain.Document{"n": i}); err != nil {
+				t.Errorf("Failed to insert document: %v", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	ids, err := engine.FindIds("logs", nil)
+	if err != nil {
+		t.Fatalf("Failed to find ids: %v", err)
+	}
+	if len(ids) != 2 {
+		t.Errorf("Expected 2 documents in the capped collection, got %v", ids)
+	}
+
+	stats := engine.GetMemoryStats()["concurrent_writes"].(map[string]interface{})
+	if stats["limit"] != 1 {
+		t.Errorf("Expected a limit of 1 in stats, got %v", stats["limit"])
+	}
+	if inFlight := stats["in_flight"].(map[string]int); len(inFlight) != 0 {
+		t.Errorf("Expected no writes in flight, got %v", inFlight)
+	}
+}
+
+func TestStorageEngine_CollectionSchema(t *testing.T) {
+	walDir, dataDir, checkpointDir := createTestDirs(t)
+	engine := NewStorageEngine(
+		WithWALDir(walDir),
+		WithDataDir(dataDir),
+		WithCheckpointDir(checkpointDir),
+		WithDurabilityLevel(DurabilityMemory),
+	)
+	defer engine.StopBackgroundWorkers()
+
+	for _, at := range []string{"2024-01-01T09:59:59.9Z", "2024-01-01T12:30:00+02:00", "2024-01-01T11:00:00Z"} {
+		if _, err := engine.Insert("events", domain.Document{"at": at}); err != nil {
+			t.Fatalf("Failed to insert document: %v", err)
+		}
+	}
+
+	// "12:30:00+02:00" sorts after "11:00:00Z" as a string but is 10:30Z
+	engine.SetCollectionSchema("events", map[string]domain.FieldType{"at": domain.FieldTypeTime})
+	window := map[string]interface{}{"at": map[string]interface{}{"$gte": "2024-01-01T10:00:00Z", "$lt": "2024-01-01T11:00:00Z"}}
+	result, err := engine.FindAll("events", window, nil)
+	if err != nil {
+		t.Fatalf("Failed to find documents: %v", err)
+	}
+	if len(result.Documents) != 1 || result.Documents[0]["at"] != "2024-01-01T12:30:00+02:00" {
+		t.Errorf("Expected only the 10:30Z document in the window, got %v", result.Documents)
+	}
+
+	result, err = engine.FindAll("events", map[string]interface{}{"at": "2024-01-01T10:30:00.000Z"}, nil)
+	if err != nil {
+		t.Fatalf("Failed to find documents: %v", err)
+	}
+	if len(result.Documents) != 1 {
+		t.Errorf("Expected equality to match across offsets, got %d documents", len(result.Documents))
+	}
+
+	if _, err := engine.FindAll("events", map[string]interface{}{"at": map[string]interface{}{"$gt": false}}, nil); !errors.Is(err, domain.ErrInvalidFilter) {
+		t.Errorf("Expected an invalid filter error for a bool bound, got %v", err)
+	}
+
+	engine.SetCollectionSchema("events", nil)
+	if schema := engine.GetCollectionSchema("events"); schema != nil {
+		t.Errorf("Expected the schema to be removed, got %v", schema)
+	}
+}
+
+func TestStorageEngine_StrictSchema(t *testing.T) {
+	walDir, dataDir, checkpointDir := createTestDirs(t)
+	engine := NewStorageEngine(
+		WithWALDir(walDir),
+		WithDataDir(dataDir),
+		WithCheckpointDir(checkpointDir),
+		WithDurabilityLevel(DurabilityMemory),
+	)
+	defer engine.StopBackgroundWorkers()
+
+	engine.SetCollectionSchema("users", map[string]domain.FieldType{"name": domain.FieldTypeAny, "age": domain.FieldTypeAny})
+	engine.SetCollectionSchemaStrict("users", true)
+
+	alice, err := engine.Insert("users", domain.Document{"name": "Alice"})
+	if err != nil {
+		t.Fatalf("Failed to insert document: %v", err)
+	}
+	id := alice["_id"].(string)
+	walEntries := engine.GetMemoryStats()["wal_entries_written"]
+
+	if _, err := engine.Insert("users", domain.Document{"naem": "Bob"}); !errors.Is(err, domain.ErrFieldNotInSchema) {
+		t.Errorf("Expected a field not in schema error for insert, got %v", err)
+	}
+	if _, err := engine.BatchInsert("users", []domain.Document{{"name": "Carol"}, {"agee": 3}}); !errors.Is(err, domain.ErrFieldNotInSchema) {
+		t.Errorf("Expected a field not in schema error for batch insert, got %v", err)
+	}
+	if _, err := engine.UpdateById("users", id, domain.Document{"agee": 3}); !errors.Is(err, domain.ErrFieldNotInSchema) {
+		t.Errorf("Expected a field not in schema error for update, got %v", err)
+	}
+	if _, err := engine.ReplaceById("users", id, domain.Document{"nmae": "Alice"}); !errors.Is(err, domain.ErrFieldNotInSchema) {
+		t.Errorf("Expected a field not in schema error for replace, got %v", err)
+	}
+	if _, err := engine.BatchUpdate("users", []domain.BatchUpdateOperation{{ID: id, Updates: domain.Document{"agee": 3}}}); !errors.Is(err, domain.ErrFieldNotInSchema) {
+		t.Errorf("Expected a field not in schema error for batch update, got %v", err)
+	}
+	if entries := engine.GetMemoryStats()["wal_entries_written"]; entries != walEntries {
+		t.Errorf("Expected rejected writes to skip the WAL, entries went from %v to %v", walEntries, entries)
+	}
+
+	if _, err := engine.UpdateById("users", id, domain.Document{"age": 30}); err != nil {
+		t.Errorf("Expected a declared field to be accepted, got %v", err)
+	}
+	engine.SetCollectionSchemaStrict("users", false)
+	if _, err := engine.UpdateById("users", id, domain.Document{"agee": 3}); err != nil {
+		t.Errorf("Expected any field to be accepted once strict mode is off, got %v", err)
+	}
+}
+
+func TestStorageEngine_SetMaxMemory(t *testing.T) {
+	walDir, dataDir, checkpointDir := createTestDirs(t)
+	engine := NewStorageEngine(
+		WithWALDir(walDir),
+		WithDataDir(dataDir),
+		WithCheckpointDir(checkpointDir),
+		WithDurabilityLevel(DurabilityMemory),
+		WithMaxMemory(1000),
+	)
+	defer engine.StopBackgroundWorkers()
+
+	for i := 0; i < 10; i++ {
+		if _, err := engine.Insert("users", domain.Document{"n": i}); err != nil {
+			t.Fatalf("Failed to insert document: %v", err)
+		}
+	}
+	if size := engine.GetMemoryStats()["cache_size"]; size != 10 {
+		t.Fatalf("Expected 10 cached documents, got %v", size)
+	}
+
+	if err := engine.SetMaxMemory(0); err == nil {
+		t.Error("Expected an error for a zero memory limit")
+	}
+	if err := engine.SetMaxMemory(300); err != nil {
+		t.Fatalf("Failed to set memory limit: %v", err)
+	}
+
+	stats := engine.GetMemoryStats()
+	if stats["max_memory_mb"] != 300 {
+		t.Errorf("Expected a 300MB limit in stats, got %v", stats["max_memory_mb"])
+	}
+	if stats["cache_size"] != 3 {
+		t.Errorf("Expected the cache to shrink to 3 documents, got %v", stats["cache_size"])
+	}
+
+	// Evicted documents are still served from memory
+	ids, err := engine.FindIds("users", nil)
+	if err != nil {
+		t.Fatalf("Failed to find ids: %v", err)
+	}
+	for _, id := range ids {
+		if _, err := engine.GetById("users", id); err != nil {
+			t.Errorf("Failed to get document %s after shrinking the cache: %v", id, err)
+		}
+	}
+
+	usage := engine.CollectionMemoryUsage()
+	if len(usage) != 1 || usage[0].Name != "users" || usage[0].Documents != 10 || !usage[0].Resident {
+		t.Fatalf("Unexpected collection memory usage: %+v", usage)
+	}
+	if usage[0].CachedDocs != 3 || usage[0].EstimatedBytes <= 0 {
+		t.Errorf("Expected 3 cached documents and a positive estimate, got %+v", usage[0])
+	}
+}
+
+func TestStorageEngine_InsertIfNotExists(t *testing.T) {
+	walDir, dataDir, checkpointDir := createTestDirs(t)
+	engine := NewStorageEngine(
+		WithWALDir(walDir),
+		WithDataDir(dataDir),
+		WithCheckpointDir(checkpointDir),
+		WithDurabilityLevel(DurabilityMemory),
+	)
+	defer engine.StopBackgroundWorkers()
+
+	filter := map[string]interface{}{"email": "alice@example.com"}
+
+	// The collection is created by the first conditional insert
+	first, created, err := engine.InsertIfNotExists("users", filter, domain.Document{"email": "alice@example.com", "name": "Alice"})
+	if err != nil {
+		t.Fatalf("Failed to insert document: %v", err)
+	}
+	if !created {
+		t.Fatal("Expected the first insert to create the document")
+	}
+
+	var createdCount int32
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			doc, created, err := engine.InsertIfNotExists("users", filter, domain.Document{"email": "alice@example.com", "attempt": i})
+			if err != nil {
+				t.Errorf("Failed conditional insert: %v", err)
+				return
+			}
+			if created {
+				atomic.AddInt32(&createdCount, 1)
+			} else if doc["_id"] != first["_id"] {
+				t.Errorf("Expected the existing document %v, got %v", first["_id"], doc["_id"])
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if createdCount != 0 {
+		t.Errorf("Expected no further documents to be created, got %d", createdCount)
+	}
+	ids, err := engine.FindIds("users", nil)
+	if err != nil {
+		t.Fatalf("Failed to find ids: %v", err)
+	}
+	if len(ids) != 1 {
+		t.Errorf("Expected 1 document, got %v", ids)
+	}
+
+	if _, _, err := engine.InsertIfNotExists("users", map[string]interface{}{"n": map[string]interface{}{"$lt": nil}}, domain.Document{}); !errors.Is(err, domain.ErrInvalidFilter) {
+		t.Errorf("Expected an invalid filter error, got %v", err)
+	}
+}
+
+func TestStorageEngine_PreloadCollections(t *testing.T) {
+	walDir, dataDir, checkpointDir := createTestDirs(t)
+	engine := NewStorageEngine(
+		WithWALDir(walDir),
+		WithDataDir(dataDir),
+		WithCheckpointDir(checkpointDir),
+		WithDurabilityLevel(DurabilityMemory),
+		WithPreloadCollections([]string{"users", "missing"}),
+	)
+	defer engine.StopBackgroundWorkers()
+
+	if _, err := engine.Insert("users", domain.Document{"city": "Paris"}); err != nil {
+		t.Fatalf("Failed to insert document: %v", err)
+	}
+	if err := engine.CreateIndex("users", "city"); err != nil {
+		t.Fatalf("Failed to create index: %v", err)
+	}
+	if engine.PreloadProgress().Done {
+		t.Fatal("Expected the preload not to be done before it runs")
+	}
+
+	err := engine.PreloadCollections()
+	if err == nil || !strings.Contains(err.Error(), "missing") {
+		t.Fatalf("Expected an error naming the missing collection, got %v", err)
+	}
+	progress := engine.PreloadProgress()
+	if !progress.Done || progress.Loaded != 1 || progress.Failed != 1 {
+		t.Errorf("Unexpected progress: %+v", progress)
+	}
+
+	ids, err := engine.FindIds("users", map[string]interface{}{"city": "Paris"})
+	if err != nil || len(ids) != 1 {
+		t.Errorf("Expected the rebuilt index to find 1 document, got %v (%v)", ids, err)
+	}
+}
+
+func TestStorageEngine_DeleteByIdReturning(t *testing.T) {
+	walDir, dataDir, checkpointDir := createTestDirs(t)
+	engine := NewStorageEngine(
+		WithWALDir(walDir),
+		WithDataDir(dataDir),
+		WithCheckpointDir(checkpointDir),
+		WithDurabilityLevel(DurabilityMemory),
+	)
+	defer engine.StopBackgroundWorkers()
+
+	inserted, err := engine.Insert("users", domain.Document{"name": "Alice"})
+	if err != nil {
+		t.Fatalf("Failed to insert document: %v", err)
+	}
+	id := inserted["_id"].(string)
+
+	deleted, err := engine.DeleteByIdReturning("users", id)
+	if err != nil {
+		t.Fatalf("Failed to delete document: %v", err)
+	}
+	if deleted["_id"] != id || deleted["name"] != "Alice" {
+		t.Errorf("Expected the deleted document, got %v", deleted)
+	}
+	if _, err := engine.GetById("users", id); err == nil {
+		t.Error("Expected the document to be gone")
+	}
+
+	// Nothing to return for a missing document, and nothing is logged
+	written := engine.GetMemoryStats()["wal_entries_written"]
+	if _, err := engine.DeleteByIdReturning("users", id); !errors.Is(err, domain.ErrDocumentNotFound) {
+		t.Errorf("Expected ErrDocumentNotFound, got %v", err)
+	}
+	if engine.GetMemoryStats()["wal_entries_written"] != written {
+		t.Error("Expected no WAL entry for a missing document")
+	}
+}
+
+func TestStorageEngine_GetChanges(t *testing.T) {
+	walDir, dataDir, checkpointDir := createTestDirs(t)
+	engine := NewStorageEngine(
+		WithWALDir(walDir),
+		WithDataDir(dataDir),
+		WithCheckpointDir(checkpointDir),
+		WithDurabilityLevel(DurabilityMemory),
+	)
+	defer engine.StopBackgroundWorkers()
+
+	if _, err := engine.GetChanges(context.Background(), "orders", 0, 0, 0); !errors.Is(err, domain.ErrCollectionNotFound) {
+		t.Fatalf("Expected ErrCollectionNotFound, got %v", err)
+	}
+
+	inserted, err := engine.Insert("orders", domain.Document{"status": "new"})
+	if err != nil {
+		t.Fatalf("Insert failed: %v", err)
+	}
+	id := inserted["_id"].(string)
+	if _, err := engine.UpdateById("orders", id, domain.Document{"status": "paid"}); err != nil {
+		t.Fatalf("UpdateById failed: %v", err)
+	}
+	if _, err := engine.ReplaceById("orders", id, domain.Document{"status": "shipped"}); err != nil {
+		t.Fatalf("ReplaceById failed: %v", err)
+	}
+	if err := engine.DeleteById("orders", id); err != nil {
+		t.Fatalf("DeleteById failed: %v", err)
+	}
+
+	feed, err := engine.GetChanges(context.Background(), "orders", 1, 0, 0)
+	if err != nil {
+		t.Fatalf("GetChanges failed: %v", err)
+	}
+	var ops []string
+	for _, change := range feed.Changes {
+		ops = append(ops, fmt.Sprintf("%d:%s", change.Offset, change.Op))
+	}
+	if fmt.Sprint(ops) != "[2:update 3:update 4:delete]" {
+		t.Errorf("Expected [2:update 3:update 4:delete], got %v", ops)
+	}
+	if feed.Changes[1].Document["status"] != "shipped" || feed.Changes[2].Document != nil {
+		t.Errorf("Unexpected change documents: %v", feed.Changes)
+	}
+	if feed.NextOffset != 4 {
+		t.Errorf("Expected next offset 4, got %d", feed.NextOffset)
+	}
+
+	// A long poll returns as soon as the next write lands
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		engine.Insert("orders", domain.Document{"status": "new"})
+	}()
+	feed, err = engine.GetChanges(context.Background(), "orders", 4, 0, 5*time.Second)
+	if err != nil {
+		t.Fatalf("GetChanges failed: %v", err)
+	}
+	if len(feed.Changes) != 1 || feed.Changes[0].Op != domain.ChangeInsert {
+		t.Errorf("Expected one insert, got %v", feed.Changes)
+	}
+}
+
+func TestStorageEngine_PerCollectionWAL(t *testing.T) {
+	walDir, dataDir, checkpointDir := createTestDirs(t)
+	newEngine := func(perCollection bool) *StorageEngine {
+		return NewStorageEngine(
+			WithWALDir(walDir),
+			WithDataDir(dataDir),
+			WithCheckpointDir(checkpointDir),
+			WithDurabilityLevel(DurabilityMemory),
+			WithPerCollectionWAL(perCollection),
+		)
+	}
+
+	// An earlier run with the shared WAL leaves entries behind
+	shared := newEngine(false)
+	if _, err := shared.Insert("legacy", domain.Document{"_id": "1", "name": "Old"}); err != nil {
+		t.Fatalf("Failed to insert document: %v", err)
+	}
+	shared.StopBackgroundWorkers()
+	shared.walEngine.Close()
+
+	engine := newEngine(true)
+	if _, err := engine.GetById("legacy", "1"); err != nil {
+		t.Fatalf("Shared WAL not recovered in per-collection mode: %v", err)
+	}
+
+	// Concurrent writers to different collections each get their own WAL file
+	collections := []string{"users", "orders", "events"}
+	var wg sync.WaitGroup
+	for _, collName := range collections {
+		wg.Add(1)
+		go func(collName string) {
+			defer wg.Done()
+			for i := 0; i < 20; i++ {
+				if _, err := engine.Insert(collName, domain.Document{"_id": fmt.Sprint(i + 1), "n": i}); err != nil {
+					t.Errorf("Failed to insert into %s: %v", collName, err)
+				}
+			}
+		}(collName)
+	}
+	wg.Wait()
+	if _, err := engine.UpdateById("users", "1", domain.Document{"name": "Alice"}); err != nil {
+		t.Fatalf("Failed to update document: %v", err)
+	}
+	if err := engine.DeleteById("orders", "2"); err != nil {
+		t.Fatalf("Failed to delete document: %v", err)
+	}
+
+	for _, collName := range collections {
+		files, err := filepath.Glob(filepath.Join(walDir, "collections", collName, "wal_*.log"))
+		if err != nil || len(files) != 1 {
+			t.Errorf("Expected one WAL file for %s, got %v (%v)", collName, files, err)
+		}
+	}
+
+	// Rotation closes the collection files; later writes reopen them
+	if err := engine.walEngine.RotateWALFile(); err != nil {
+		t.Fatalf("Failed to rotate WAL: %v", err)
+	}
+	if _, err := engine.Insert("users", domain.Document{"_id": "21", "n": 20}); err != nil {
+		t.Fatalf("Failed to insert after rotation: %v", err)
+	}
+	engine.StopBackgroundWorkers()
+	engine.walEngine.Close()
+
+	// Recovery replays the shared WAL and every collection's WAL
+	recovered := newEngine(true)
+	defer recovered.StopBackgroundWorkers()
+
+	expected := map[string]int{"legacy": 1, "users": 21, "orders": 19, "events": 20}
+	for collName, count := range expected {
+		result, err := recovered.FindAll(collName, nil, nil)
+		if err != nil {
+			t.Fatalf("Failed to find documents in %s: %v", collName, err)
+		}
+		if len(result.Documents) != count {
+			t.Errorf("Expected %d documents in %s after recovery, got %d", count, collName, len(result.Documents))
+		}
+	}
+
+	doc, err := recovered.GetById("users", "1")
+	if err != nil {
+		t.Fatalf("Failed to get recovered document: %v", err)
+	}
+	if doc["name"] != "Alice" {
+		t.Errorf("Expected recovered update, got %v", doc["name"])
+	}
+	if _, err := recovered.GetById("orders", "2"); err == nil {
+		t.Error("Expected deleted document to stay deleted after recovery")
+	}
+
+	// New entries are numbered after the replayed ones
+	if lsn := recovered.walEngine.GetCurrentLSN(); lsn < 64 {
+		t.Errorf("Expected LSN to continue after recovered entries, got %d", lsn)
+	}
+}
+
+func TestStorageEngine_Sample(t *testing.T) {
+	walDir, dataDir, checkpointDir := createTestDirs(t)
+	engine := NewStorageEngine(
+		WithWALDir(walDir),
+		WithDataDir(dataDir),
+		WithCheckpointDir(checkpointDir),
+		WithDurabilityLevel(DurabilityMemory),
+	)
+	defer engine.StopBackgroundWorkers()
+
+	for i := 0; i < 20; i++ {
+		if _, err := engine.Insert("events", domain.Document{"n": i}); err != nil {
+			t.Fatalf("Failed to insert document: %v", err)
+		}
+	}
+
+	docs, err := engine.Sample("events", 5, nil)
+	if err != nil {
+		t.Fatalf("Sample failed: %v", err)
+	}
+	if len(docs) != 5 {
+		t.Errorf("Expected 5 sampled documents, got %d", len(docs))
+	}
+
+	seed := int64(3)
+	docs, err = engine.Sample("events", 50, &seed)
+	if err != nil {
+		t.Fatalf("Random sample failed: %v", err)
+	}
+	if len(docs) != 20 {
+		t.Errorf("Expected sample capped at 20 documents, got %d", len(docs))
+	}
+
+	if _, err := engine.Sample("missing", 5, nil); err == nil {
+		t.Error("Expected error sampling a missing collection")
+	}
+}
+
+func TestStorageEngine_FindIds(t *testing.T) {
+	walDir, dataDir, checkpointDir := createTestDirs(t)
+	engine := NewStorageEngine(
+		WithWALDir(walDir),
+		WithDataDir(dataDir),
+		WithCheckpointDir(checkpointDir),
+		WithDurabilityLevel(DurabilityMemory),
+	)
+	defer engine.StopBackgroundWorkers()
+
+	teams := []string{"core", "web", "core", "core"}
+	for i, team := range teams {
+		doc := domain.Document{"_id": fmt.Sprintf("u%d", i), "team": team, "level": i % 2}
+		if _, err := engine.Insert("users", doc); err != nil {
+			t.Fatalf("Failed to insert document: %v", err)
+		}
+	}
+
+	// Scan path
+	ids, err := engine.FindIds("users", map[string]interface{}{"team": "core"})
+	if err != nil {
+		t.Fatalf("FindIds failed: %v", err)
+	}
+	if fmt.Sprint(ids) != "[u0 u2 u3]" {
+		t.Errorf("Expected [u0 u2 u3], got %v", ids)
+	}
+
+	// Index-only path
+	if err := engine.CreateIndex("users", "team"); err != nil {
+		t.Fatalf("CreateIndex failed: %v", err)
+	}
+	ids, err = engine.FindIds("users", map[string]interface{}{
+		"team": "core",
+		"_id":  map[string]interface{}{"$in": []interface{}{"u3", "u1", "u0"}},
+	})
+	if err != nil {
+		t.Fatalf("FindIds failed: %v", err)
+	}
+	if fmt.Sprint(ids) != "[u0 u3]" {
+		t.Errorf("Expected [u0 u3], got %v", ids)
+	}
+
+	// Indexed field narrowed by an unindexed one
+	ids, err = engine.FindIds("users", map[string]interface{}{"team": "core", "level": 1})
+	if err != nil {
+		t.Fatalf("FindIds failed: %v", err)
+	}
+	if fmt.Sprint(ids) != "[u3]" {
+		t.Errorf("Expected [u3], got %v", ids)
+	}
+
+	if _, err := engine.FindIds("missing", nil); err == nil {
+		t.Error("Expected error finding IDs in a missing collection")
+	}
+}
+
+func TestStorageEngine_ArrayFilters(t *testing.T) {
+	walDir, dataDir, checkpointDir := createTestDirs(t)
+	engine := NewStorageEngine(
+		WithWALDir(walDir),
+		WithDataDir(dataDir),
+		WithCheckpointDir(checkpointDir),
+		WithDurabilityLevel(DurabilityMemory),
+	)
+	defer engine.StopBackgroundWorkers()
+
+	docs := []domain.Document{
+		{"_id": "p1", "tags": []interface{}{"go", "db"}},
+		{"_id": "p2", "tags": []interface{}{"rust"}},
+		{"_id": "p3", "tags": "go"},
+	}
+	for _, doc := range docs {
+		if _, err := engine.Insert("posts", doc); err != nil {
+			t.Fatalf("Failed to insert document: %v", err)
+		}
+	}
+
+	check := func(label string, filter map[string]interface{}, expected string) {
+		t.Helper()
+		ids, err := engine.FindIds("posts", filter)
+		if err != nil {
+			t.Fatalf("%s: FindIds failed: %v", label, err)
+		}
+		sort.Strings(ids)
+		if fmt.Sprint(ids) != expected {
+			t.Errorf("%s: expected %s, got %v", label, expected, ids)
+		}
+	}
+
+	equality := map[string]interface{}{"tags": "go"}
+	contains := map[string]interface{}{"tags": map[string]interface{}{"$contains": "go"}}
+	check("scan equality", equality, "[p1 p3]")
+	check("scan contains", contains, "[p1]")
+
+	if err := engine.CreateIndex("posts", "tags"); err != nil {
+		t.Fatalf("CreateIndex failed: %v", err)
+	}
+	check("indexed equality", equality, "[p1 p3]")
+	check("indexed contains", contains, "[p1]")
+
+	// Updating the array moves the document between element keys
+	if _, err := engine.UpdateById("posts", "p1", domain.Document{"tags": []interface{}{"db"}}); err != nil {
+		t.Fatalf("UpdateById failed: %v", err)
+	}
+	check("after update", equality, "[p3]")
+	check("kept element", map[string]interface{}{"tags": "db"}, "[p1]")
+
+	// $elemMatch needs one array element matching every condition
+	items := []interface{}{
+		map[string]interface{}{"sku": "A", "qty": 2},
+		map[string]interface{}{"sku": "B", "qty": 5},
+	}
+	if _, err := engine.UpdateById("posts", "p2", domain.Document{"items": items}); err != nil {
+		t.Fatalf("UpdateById failed: %v", err)
+	}
+	elemMatch := func(conditions map[string]interface{}) map[string]interface{} {
+		return map[string]interface{}{"items": map[string]interface{}{"$elemMatch": conditions}}
+	}
+	check("elemMatch", elemMatch(map[string]interface{}{"qty": map[string]interface{}{"$gt": 3}, "sku": "B"}), "[p2]")
+	check("elemMatch across elements", elemMatch(map[string]interface{}{"qty": map[string]interface{}{"$gt": 3}, "sku": "A"}), "[]")
+
+	result, err := engine.FindAll("posts", elemMatch(map[string]interface{}{"sku": "A"}), nil)
+	if err != nil {
+		t.Fatalf("FindAll failed: %v", err)
+	}
+	if len(result.Documents) != 1 {
+		t.Errorf("Expected 1 document, got %d", len(result.Documents))
+	}
+}
+
+func TestStorageEngine_RebuildIndexes(t *testing.T) {
+	walDir, dataDir, checkpointDir := createTestDirs(t)
+	engine := NewStorageEngine(
+		WithWALDir(walDir),
+		WithDataDir(dataDir),
+		WithCheckpointDir(checkpointDir),
+		WithDurabilityLevel(DurabilityMemory),
+	)
+	defer engine.StopBackgroundWorkers()
+
+	for i, team := range []string{"core", "web", "core"} {
+		doc := domain.Document{"_id": fmt.Sprintf("u%d", i), "team": team}
+		if _, err := engine.Insert("users", doc); err != nil {
+			t.Fatalf("Failed to insert document: %v", err)
+		}
+	}
+	if err := engine.CreateIndex("users", "team"); err != nil {
+		t.Fatalf("CreateIndex failed: %v", err)
+	}
+
+	var processed, total int
+	err := engine.RebuildIndexesContext(context.Background(), "users", func(p, tot int) {
+		processed, total = p, tot
+	})
+	if err != nil {
+		t.Fatalf("RebuildIndexesContext failed: %v", err)
+	}
+	if processed != 3 || total != 3 {
+		t.Errorf("Expected final progress 3/3, got %d/%d", processed, total)
+	}
+	index, _ := engine.indexEngine.GetIndex("users", "team")
+	if count := len(index.Query("core")); count != 2 {
+		t.Errorf("Expected 2 indexed core documents, got %d", count)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := engine.RebuildIndexesContext(ctx, "users", nil); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected cancelled rebuild, got %v", err)
+	}
+	if err := engine.RebuildIndexes("missing"); err == nil {
+		t.Error("Expected error rebuilding indexes of a missing collection")
+	}
+}
+
+func TestStorageEngine_Facets(t *testing.T) {
+	walDir, dataDir, checkpointDir := createTestDirs(t)
+	engine := NewStorageEngine(
+		WithWALDir(walDir),
+		WithDataDir(dataDir),
+		WithCheckpointDir(checkpointDir),
+		WithDurabilityLevel(DurabilityMemory),
+	)
+	defer engine.StopBackgroundWorkers()
+
+	products := []domain.Document{
+		{"brand": "acme", "color": "red"},
+		{"brand": "acme", "color": "blue"},
+		{"brand": "globex", "color": "red"},
+	}
+	if _, err := engine.BatchInsert("products", products); err != nil {
+		t.Fatalf("Failed to insert documents: %v", err)
+	}
+	if err := engine.CreateIndex("products", "brand"); err != nil {
+		t.Fatalf("Failed to create index: %v", err)
+	}
+
+	facets, err := engine.Facets("products", nil, []string{"brand", "color"})
+	if err != nil {
+		t.Fatalf("Facets failed: %v", err)
+	}
+	if facets["brand"]["acme"] != 2 || facets["brand"]["globex"] != 1 {
+		t.Errorf("Unexpected brand counts: %v", facets["brand"])
+	}
+	if facets["color"]["red"] != 2 || facets["color"]["blue"] != 1 {
+		t.Errorf("Unexpected color counts: %v", facets["color"])
+	}
+
+	facets, err = engine.Facets("products", map[string]interface{}{"color": "red"}, []string{"brand"})
+	if err != nil {
+		t.Fatalf("Facets with filter failed: %v", err)
+	}
+	if facets["brand"]["acme"] != 1 || facets["brand"]["globex"] != 1 {
+		t.Errorf("Unexpected filtered brand counts: %v", facets["brand"])
+	}
+
+	if _, err := engine.Facets("products", nil, nil); err == nil {
+		t.Error("Expected error for empty field list")
+	}
+	if _, err := engine.Facets("missing", nil, []string{"brand"}); !errors.Is(err, domain.ErrCollectionNotFound) {
+		t.Errorf("Expected ErrCollectionNotFound for a missing collection, got %v", err)
+	}
+}
+
+func TestStorageEngine_LinearizableConcurrentUpdates(t *testing.T) {
+	walDir, dataDir, checkpointDir := createTestDirs(t)
+	engine := NewStorageEngine(
+		WithWALDir(walDir),
+		WithDataDir(dataDir),
+		WithCheckpointDir(checkpointDir),
+		WithDurabilityLevel(DurabilityMemory),
+		WithConsistencyLevel(ConsistencyLinearizable),
+	)
+	defer engine.StopBackgroundWorkers()
+
+	if _, err := engine.Insert("docs", domain.Document{"_id": "d1"}); err != nil {
+		t.Fatalf("Failed to insert document: %v", err)
+	}
+
+	// Each writer sets a different field; none of them may be lost
+	const writers = 20
+	var wg sync.WaitGroup
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if _, err := engine.UpdateById("docs", "d1", domain.Document{fmt.Sprintf("field%d", i): i}); err != nil {
+				t.Errorf("Failed to update document: %v", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	doc, err := engine.GetById("docs", "d1")
+	if err != nil {
+		t.Fatalf("Failed to get document: %v", err)
+	}
+	for i := 0; i < writers; i++ {
+		if doc[fmt.Sprintf("field%d", i)] != i {
+			t.Errorf("Expected field%d to be %d, got %v", i, i, doc[fmt.Sprintf("field%d", i)])
+		}
+	}
+
+	// Document locks are dropped once the last writer is done with them
+	engine.docLocksMu.Lock()
+	remaining := len(engine.documentLocks)
+	engine.docLocksMu.Unlock()
+	if remaining != 0 {
+		t.Errorf("Expected no document locks to be kept, got %d", remaining)
+	}
+}
+
+func TestStorageEngine_GetMemoryStats(t *testing.T) {
+	walDir, dataDir, checkpointDir := createTestDirs(t)
+	engine := NewStorageEngine(
+		WithWALDir(walDir),
+		WithDataDir(dataDir),
+		WithCheckpointDir(checkpointDir),
+	)
+
+	stats := engine.GetMemoryStats()
+	if stats == nil {
+		t.Fatal("Expected stats to be returned")
+	}
+
+	// Insert a document to generate some stats
+	doc := domain.Document{"_id": "stats-test", "name": "Test"}
+	_, err := engine.Insert("test_collection", doc)
+	if err != nil {
+		t.Fatalf("Failed to insert document: %v", err)
+	}
+
+	stats = engine.GetMemoryStats()
+	if stats["collection_count"] == nil {
+		t.Error("Expected collection_count in stats")
+	}
+}
+
+func TestStorageEngine_CreateIndex(t *testing.T) {
+	walDir, dataDir, checkpointDir := createTestDirs(t)
+	engine := NewStorageEngine(
+		WithWALDir(walDir),
+		WithDataDir(dataDir),
+		WithCheckpointDir(checkpointDir),
+	)
+
+	// Create collection first
+	if err := engine.CreateCollection("test_collection"); err != nil {
+		t.Fatalf("Failed to create collection: %v", err)
+	}
+
+	// Insert some test documents
+	docs := []domain.Document{
+		{"_id": "doc1", "name": "Alice", "age": 30},
+		{"_id": "doc2", "name": "Bob", "age": 25},
+		{"_id": "doc3", "name": "Charlie", "age": 35},
+	}
+
+	for _, doc := range docs {
+		_, err := engine.Insert("test_collection", doc)
+		if err != nil {
+			t.Fatalf("Failed to insert document: %v", err)
+		}
+	}
+
+	// Create index on name field
+	if err := engine.CreateIndex("test_collection", "name"); err != nil {
+		t.Fatalf("Failed to create index: %v", err)
+	}
+
+	// Test finding documents by index
+	results, err := engine.FindByIndex("test_collection", "name", "Alice")
+	if err != nil {
+		t.Fatalf("Failed to find by index: %v", err)
+	}
+
+	if len(results) != 1 {
+		t.Errorf("Expected 1 result, got %d", len(results))
+	}
+
+	if results[0]["name"] != "Alice" {
+		t.Errorf("Expected Alice, got %v", results[0]["name"])
+	}
+}
+
+func TestStorageEngine_IndexUpdates(t *testing.T) {
+	walDir, dataDir, checkpointDir := createTestDirs(t)
+	engine := NewStorageEngine(
+		WithWALDir(walDir),
+		WithDataDir(dataDir),
+		WithCheckpointDir(checkpointDir),
+	)
+
+	// Create collection and insert document
+	doc := domain.Document{"_id": "doc1", "name": "Alice", "age": 30}
+	_, err := engine.Insert("test_collection", doc)
+	if err != nil {
+		t.Fatalf("Failed to insert document: %v", err)
+	}
+
+	// Create index on name field
+	if err := engine.CreateIndex("test_collection", "name"); err != nil {
+		t.Fatalf("Failed to create index: %v", err)
+	}
+
+	// Update document
+	updates := domain.Document{"name": "Alice Updated"}
+	_, err = engine.UpdateById("test_collection", "doc1", updates)
+	if err != nil {
+		t.Fatalf("Failed to update document: %v", err)
+	}
+
+	// Test that index was updated
+	results, err := engine.FindByIndex("test_collection", "name", "Alice Updated")
+	if err != nil {
+		t.Fatalf("Failed to find by index: %v", err)
+	}
+
+	if len(results) != 1 {
+		t.Errorf("Expected 1 result, got %d", len(results))
+	}
+
+	if results[0]["name"] != "Alice Updated" {
+		t.Errorf("Expected Alice Updated, got %v", results[0]["name"])
+	}
+
+	// Test that old value is no longer indexed
+	oldResults, err := engine.FindByIndex("test_collection", "name", "Alice")
+	if err != nil {
+		t.Fatalf("Failed to find by index: %v", err)
+	}
+
+	if len(oldResults) != 0 {
+		t.Errorf("Expected 0 results for old value, got %d", len(oldResults))
+	}
+}
+
+func TestStorageEngine_IndexDeletion(t *testing.T) {
+	walDir, dataDir, checkpointDir := createTestDirs(t)
+	engine := NewStorageEngine(
+		WithWALDir(walDir),
+		WithDataDir(dataDir),
+		WithCheckpointDir(checkpointDir),
+	)
+
+	// Create collection and insert document
+	doc := domain.Document{"_id": "doc1", "name": "Alice", "age": 30}
+	_, err := engine.Insert("test_collection", doc)
+	if err != nil {
+		t.Fatalf("Failed to insert document: %v", err)
+	}
+
+	// Create index on name field
+	if err := engine.CreateIndex("test_collection", "name"); err != nil {
+		t.Fatalf("Failed to create index: %v", err)
+	}
+
+	// Delete document
+	err = engine.DeleteById("test_collection", "doc1")
+	if err != nil {
+		t.Fatalf("Failed to delete document: %v", err)
+	}
+
+	// Test that document is no longer found by index
+	results, err := engine.FindByIndex("test_collection", "name", "Alice")
+	if err != nil {
+		t.Fatalf("Failed to find by index: %v", err)
+	}
+
+	if len(results) != 0 {
+		t.Errorf("Expected 0 results after deletion, got %d", len(results))
+	}
+}
+
+func TestStorageEngine_CopyOnRead(t *testing.T) {
+	walDir, dataDir, checkpointDir := createTestDirs(t)
+	engine := NewStorageEngine(
+		WithWALDir(walDir),
+		WithDataDir(dataDir),
+		WithCheckpointDir(checkpointDir),
+		WithDurabilityLevel(DurabilityMemory),
+		WithCopyOnRead(true),
+	)
+	defer engine.StopBackgroundWorkers()
+
+	inserted, err := engine.Insert("users", domain.Document{
+		"name":    "Alice",
+		"address": map[string]interface{}{"city": "Paris"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to insert document: %v", err)
+	}
+	id := inserted["_id"].(string)
+
+	mutate := func(doc domain.Document) {
+		doc["name"] = "Mallory"
+		doc["address"].(map[string]interface{})["city"] = "Nowhere"
+	}
+	checkStored := func(read string) {
+		t.Helper()
+		stored, err := engine.memoryMgr.GetById("users", id)
+		if err != nil {
+			t.Fatalf("Failed to read stored document: %v", err)
+		}
+		if stored["name"] != "Alice" || stored["address"].(map[string]interface{})["city"] != "Paris" {
+			t.Errorf("Mutating the %s result changed the stored document: %v", read, stored)
+		}
+	}
+
+	doc, err := engine.GetById("users", id)
+	if err != nil {
+		t.Fatalf("GetById failed: %v", err)
+	}
+	mutate(doc)
+	checkStored("GetById")
+
+	result, err := engine.FindAll("users", nil, nil)
+	if err != nil || len(result.Documents) != 1 {
+		t.Fatalf("FindAll failed: %v", err)
+	}
+	mutate(result.Documents[0])
+	checkStored("FindAll")
+
+	stream, err := engine.FindAllStream("users", nil)
+	if err != nil {
+		t.Fatalf("FindAllStream failed: %v", err)
+	}
+	for doc := range stream {
+		mutate(doc)
+	}
+	checkStored("FindAllStream")
+
+	sample, err := engine.Sample("users", 1, nil)
+	if err != nil || len(sample) != 1 {
+		t.Fatalf("Sample failed: %v", err)
+	}
+	mutate(sample[0])
+	checkStored("Sample")
+}
+
+func TestCheckpointManager_Triggers(t *testing.T) {
+	newEngine := func(t *testing.T, options ...StorageOption) *StorageEngine {
+		walDir, dataDir, checkpointDir := createTestDirs(t)
+		return NewStorageEngine(append([]StorageOption{
+			WithWALDir(walDir),
+			WithDataDir(dataDir),
+			WithCheckpointDir(checkpointDir),
+			WithDurabilityLevel(DurabilityMemory),
+			WithCheckpointInterval(time.Hour),
+		}, options...)...)
+	}
+
+	t.Run("WALEntries", func(t *testing.T) {
+		engine := newEngine(t, WithCheckpointThreshold(3), WithMaxWALSize(0))
+		defer engine.StopBackgroundWorkers()
+
+		for i := 0; i < 2; i++ {
+			if _, err := engine.Insert("users", domain.Document{"n": i}); err != nil {
+				t.Fatalf("Insert failed: %v", err)
+			}
+		}
+		if trigger := engine.checkpointMgr.dueTrigger(); trigger != "" {
+			t.Errorf("Expected no checkpoint due below the threshold, got %q", trigger)
+		}
+		if _, err := engine.Insert("users", domain.Document{"n": 2}); err != nil {
+			t.Fatalf("Insert failed: %v", err)
+		}
+		if trigger := engine.checkpointMgr.dueTrigger(); trigger != CheckpointTriggerWALEntries {
+			t.Errorf("Expected %q trigger, got %q", CheckpointTriggerWALEntries, trigger)
+		}
+		select {
+		case <-engine.checkpointMgr.trigger:
+		default:
+			t.Error("Expected the WAL append to signal the checkpoint worker")
+		}
+
+		if err := engine.checkpointMgr.Checkpoint(); err != nil {
+			t.Fatalf("Checkpoint failed: %v", err)
+		}
+		if trigger := engine.checkpointMgr.dueTrigger(); trigger != "" {
+			t.Errorf("Expected the counters to reset after a checkpoint, got %q", trigger)
+		}
+		if next := engine.checkpointMgr.NextCheckpoint(); next["trigger"] != CheckpointTriggerNone {
+			t.Errorf("Expected trigger none after a checkpoint, got %v", next["trigger"])
+		}
+	})
+
+	t.Run("WALSize", func(t *testing.T) {
+		engine := newEngine(t, WithCheckpointThreshold(0), WithMaxWALSize(256))
+		defer engine.StopBackgroundWorkers()
+
+		for i := 0; engine.checkpointMgr.dueTrigger() == ""; i++ {
+			if i == 100 {
+				t.Fatal("Expected the WAL size trigger to fire")
+			}
+			if _, err := engine.Insert("users", domain.Document{"bio": "some text to fill the log"}); err != nil {
+				t.Fatalf("Insert failed: %v", err)
+			}
+		}
+		if trigger := engine.checkpointMgr.dueTrigger(); trigger != CheckpointTriggerWALSize {
+			t.Errorf("Expected %q trigger, got %q", CheckpointTriggerWALSize, trigger)
+		}
+		if next := engine.checkpointMgr.NextCheckpoint(); next["trigger"] != CheckpointTriggerWALSize {
+			t.Errorf("Expected next trigger %q, got %v", CheckpointTriggerWALSize, next["trigger"])
+		}
+	})
+
+	t.Run("IdleInterval", func(t *testing.T) {
+		engine := newEngine(t, WithCheckpointInterval(10*time.Millisecond))
+		engine.StartBackgroundWorkers()
+		time.Sleep(50 * time.Millisecond)
+		engine.StopBackgroundWorkers()
+
+		if performed := engine.GetMemoryStats()["checkpoints_performed"]; performed != int64(0) {
+			t.Errorf("Expected an idle engine not to checkpoint, got %v checkpoints", performed)
+		}
+	})
+
+	t.Run("BurstWakesWorker", func(t *testing.T) {
+		engine := newEngine(t, WithCheckpointThreshold(5))
+		engine.StartBackgroundWorkers()
+		defer engine.StopBackgroundWorkers()
+
+		for i := 0; i < 5; i++ {
+			if _, err := engine.Insert("users", domain.Document{"n": i}); err != nil {
+				t.Fatalf("Insert failed: %v", err)
+			}
+		}
+		deadline := time.Now().Add(2 * time.Second)
+		for engine.GetMemoryStats()["checkpoints_performed"] == int64(0) {
+			if time.Now().After(deadline) {
+				t.Fatal("Expected the entry threshold to trigger a checkpoint before the interval")
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	})
+}
+
+func TestCheckpointManager_CompactsUpdateHistory(t *testing.T) {
+	walDir, dataDir, checkpointDir := createTestDirs(t)
+	options := []StorageOption{
+		WithWALDir(walDir),
+		WithDataDir(dataDir),
+		WithCheckpointDir(checkpointDir),
+		WithDurabilityLevel(DurabilityMemory),
+		WithCheckpointInterval(time.Hour),
+		WithCheckpointThreshold(1),
+		WithWALRetentionCount(0),
+	}
+	const updates = 1000
+
+	// crash reopens the engine without the final checkpoint of a graceful shutdown
+	crash := func(engine *StorageEngine) *StorageEngine {
+		engine.walEngine.Close()
+		return NewStorageEngine(options...)
+	}
+	checkRecovered := func(engine *StorageEngine, id string, n int) {
+		t.Helper()
+		doc, err := engine.GetById("counters", id)
+		if err != nil {
+			t.Fatalf("GetById after recovery failed: %v", err)
+		}
+		if doc["n"] != float64(n) {
+			t.Errorf("Expected n=%d after recovery, got %v", n, doc["n"])
+		}
+	}
+
+	engine := NewStorageEngine(options...)
+	doc, err := engine.Insert("counters", domain.Document{"n": 0})
+	if err != nil {
+		t.Fatalf("Insert failed: %v", err)
+	}
+	id := doc["_id"].(string)
+	if _, err := engine.Insert("untouched", domain.Document{"name": "Alice"}); err != nil {
+		t.Fatalf("Insert failed: %v", err)
+	}
+	for i := 1; i <= updates; i++ {
+		if _, err := engine.UpdateById("counters", id, domain.Document{"n": i}); err != nil {
+			t.Fatalf("UpdateById failed: %v", err)
+		}
+	}
+
+	// Without a checkpoint, recovery replays every update
+	engine = crash(engine)
+	checkRecovered(engine, id, updates)
+	replayed := engine.GetMemoryStats()["wal_entries_replayed"].(int64)
+	if replayed < updates {
+		t.Errorf("Expected at least %d WAL entries replayed without a checkpoint, got %d", updates, replayed)
+	}
+	before := engine.stats.RecoveryTime
+
+	// A checkpoint holds each document's latest value, so recovery replays only the
+	// entries written after it and the WAL files before it can be deleted. Index
+	// definitions are not logged and reach the checkpoint only.
+	if err := engine.CreateIndex("counters", "n"); err != nil {
+		t.Fatalf("CreateIndex failed: %v", err)
+	}
+	if err := engine.checkpointMgr.Checkpoint(); err != nil {
+		t.Fatalf("Checkpoint failed: %v", err)
+	}
+	if _, err := engine.UpdateById("counters", id, domain.Document{"n": updates + 1}); err != nil {
+		t.Fatalf("UpdateById failed: %v", err)
+	}
+	engine = crash(engine)
+	defer engine.StopBackgroundWorkers()
+	checkRecovered(engine, id, updates+1)
+	if replayed := engine.GetMemoryStats()["wal_entries_replayed"]; replayed != int64(1) {
+		t.Errorf("Expected 1 WAL entry replayed after the checkpoint, got %v", replayed)
+	}
+	docs, err := engine.FindByIndex("counters", "n", updates+1)
+	if err != nil || len(docs) != 1 {
+		t.Errorf("Expected the rebuilt index to find the replayed value, got %d docs: %v", len(docs), err)
+	}
+	t.Logf("Recovery replayed %d entries in %v without a checkpoint, 1 in %v after one", replayed, before, engine.stats.RecoveryTime)
+
+	// Collections not written since the previous checkpoint are carried forward
+	result, err := engine.FindAll("untouched", nil, nil)
+	if err != nil || len(result.Documents) != 1 {
+		t.Errorf("Expected the untouched collection to survive recovery, got %v: %v", result, err)
+	}
+	if count := engine.collections["counters"].DocumentCount; count != 1 {
+		t.Errorf("Expected a recovered document count of 1, got %d", count)
+	}
+}
+
+func TestStorageEngine_CreateCollectionWithOptions(t *testing.T) {
+	walDir, dataDir, checkpointDir := createTestDirs(t)
+	engine := NewStorageEngine(
+		WithWALDir(walDir),
+		WithDataDir(dataDir),
+		WithCheckpointDir(checkpointDir),
+		WithDurabilityLevel(DurabilityMemory),
+	)
+	defer engine.StopBackgroundWorkers()
+
+	opts := domain.CollectionOptions{
+		Indexes:  []domain.CollectionIndex{{Field: "status"}},
+		Defaults: domain.Document{"status": "open"},
+		Capped:   &domain.CappedConfig{MaxDocs: 10, Policy: domain.EvictFIFO},
+	}
+	if err := engine.CreateCollectionWithOptions("orders", opts); err != nil {
+		t.Fatalf("CreateCollectionWithOptions failed: %v", err)
+	}
+	if _, err := engine.Insert("orders", domain.Document{"total": 5}); err != nil {
+		t.Fatalf("Insert failed: %v", err)
+	}
+	docs, err := engine.FindByIndex("orders", "status", "open")
+	if err != nil || len(docs) != 1 {
+		t.Errorf("Expected the default to be indexed on the first insert, got %d docs: %v", len(docs), err)
+	}
+	if capped := engine.GetCollectionCapped("orders"); capped == nil || capped.MaxDocs != 10 {
+		t.Errorf("Expected the collection to be capped at 10, got %v", capped)
+	}
+
+	err = engine.CreateCollectionWithOptions("orders", domain.CollectionOptions{})
+	if !errors.Is(err, domain.ErrCollectionExists) {
+		t.Errorf("Expected ErrCollectionExists for an existing collection, got %v", err)
+	}
+
+	err = engine.CreateCollectionWithOptions("broken", domain.CollectionOptions{
+		Defaults: domain.Document{"status": "open"},
+		Indexes:  []domain.CollectionIndex{{Field: "_id"}},
+	})
+	if !errors.Is(err, domain.ErrInvalidField) {
+		t.Errorf("Expected ErrInvalidField for an _id index, got %v", err)
+	}
+	if _, err := engine.GetCollection("broken"); !errors.Is(err, domain.ErrCollectionNotFound) {
+		t.Errorf("Expected no collection after invalid options, got %v", err)
+	}
+	if defaults := engine.GetCollectionDefaults("broken"); defaults != nil {
+		t.Errorf("Expected no defaults after invalid options, got %v", defaults)
+	}
+}
+
+func TestStorageEngine_CheckpointNow(t *testing.T) {
+	walDir, dataDir, checkpointDir := createTestDirs(t)
+	engine := NewStorageEngine(
+		WithWALDir(walDir),
+		WithDataDir(dataDir),
+		WithCheckpointDir(checkpointDir),
+		WithDurabilityLevel(DurabilityMemory),
+	)
+	defer engine.StopBackgroundWorkers()
+
+	if _, err := engine.Insert("events", domain.Document{"seq": 1}); err != nil {
+		t.Fatalf("Insert failed: %v", err)
+	}
+
+	// A checkpoint is written even though no trigger is due
+	for i := 1; i <= 2; i++ {
+		if err := engine.CheckpointNow(); err != nil {
+			t.Fatalf("CheckpointNow failed: %v", err)
+		}
+		if performed := engine.stats.CheckpointsPerformed; performed != int64(i) {
+			t.Errorf("Expected %d checkpoints performed, got %d", i, performed)
+		}
+	}
+	files, err := filepath.Glob(filepath.Join(checkpointDir, "*"))
+	if err != nil || len(files) == 0 {
+		t.Errorf("Expected a checkpoint file in %s, got %v: %v", checkpointDir, files, err)
+	}
+
+	// The stats report the size of the latest checkpoint file
+	info, err := os.Stat(filepath.Join(checkpointDir, "latest_checkpoint.json"))
+	if err != nil {
+		t.Fatalf("Failed to stat latest checkpoint: %v", err)
+	}
+	if size := engine.GetMemoryStats()["last_checkpoint_bytes"]; size != info.Size() {
+		t.Errorf("Expected last_checkpoint_bytes %d, got %v", info.Size(), size)
+	}
+}
+
+func TestStorageEngine_CheckpointNowWaitsForApply(t *testing.T) {
+	walDir, dataDir, checkpointDir := createTestDirs(t)
+	engine := NewStorageEngine(
+		WithWALDir(walDir),
+		WithDataDir(dataDir),
+		WithCheckpointDir(checkpointDir),
+		WithDurabilityLevel(DurabilityFull),
+	)
+	defer engine.StopBackgroundWorkers()
+
+	// Held shared as by a write whose WAL entry is written but not yet applied
+	engine.applyMu.RLock()
+	done := make(chan error, 1)
+	go func() {
+		done <- engine.CheckpointNow()
+	}()
+	select {
+	case err := <-done:
+		t.Fatalf("Checkpoint read the WAL position before the write was applied: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	engine.applyMu.RUnlock()
+	if err := <-done; err != nil {
+		t.Fatalf("CheckpointNow failed: %v", err)
+	}
+
+	// Writes completed before the checkpoint are in it
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if _, err := engine.Insert("events", domain.Document{"seq": i}); err != nil {
+				t.Errorf("Insert failed: %v", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if err := engine.CheckpointNow(); err != nil {
+		t.Fatalf("CheckpointNow failed: %v", err)
+	}
+	checkpoint, err := engine.checkpointMgr.LoadCheckpoint()
+	if err != nil || checkpoint == nil {
+		t.Fatalf("Failed to load checkpoint: %v", err)
+	}
+	if got := len(checkpoint.Collections["events"].Documents); got != 20 {
+		t.Errorf("Expected 20 documents in the checkpoint, got %d", got)
+	}
+	if checkpoint.LSN != engine.walEngine.GetCurrentLSN() {
+		t.Errorf("Expected checkpoint LSN %d, got %d", engine.walEngine.GetCurrentLSN(), checkpoint.LSN)
+	}
+}
+
+func TestStorageEngine_FindAllInsertionOrder(t *testing.T) {
+	walDir, dataDir, checkpointDir := createTestDirs(t)
+	engine := NewStorageEngine(
+		WithWALDir(walDir),
+		WithDataDir(dataDir),
+		WithCheckpointDir(checkpointDir),
+		WithDurabilityLevel(DurabilityMemory),
+		WithInsertionOrder(true),
+	)
+	defer engine.StopBackgroundWorkers()
+
+	var want []string
+	for i := 1; i <= 20; i++ {
+		doc, err := engine.Insert("events", domain.Document{"seq": i})
+		if err != nil {
+			t.Fatalf("Insert failed: %v", err)
+		}
+		want = append(want, doc["_id"].(string))
+	}
+	if _, err := engine.UpdateById("events", want[0], domain.Document{"touched": true}); err != nil {
+		t.Fatalf("UpdateById failed: %v", err)
+	}
+	if err := engine.DeleteById("events", want[1]); err != nil {
+		t.Fatalf("DeleteById failed: %v", err)
+	}
+	want = append(want[:1], want[2:]...)
+
+	options := domain.DefaultPaginationOptions()
+	options.Order = domain.OrderInserted
+	options.Limit = 100
+	result, err := engine.FindAll("events", nil, options)
+	if err != nil {
+		t.Fatalf("FindAll failed: %v", err)
+	}
+	var got []string
+	for _, doc := range result.Documents {
+		got = append(got, doc["_id"].(string))
+	}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("Expected insertion order %v, got %v", want, got)
+	}
+
+	untracked := NewStorageEngine(WithDurabilityLevel(DurabilityMemory), WithWALDir(t.TempDir()), WithDataDir(t.TempDir()), WithCheckpointDir(t.TempDir()))
+	defer untracked.StopBackgroundWorkers()
+	if _, err := untracked.Insert("events", domain.Document{"seq": 1}); err != nil {
+		t.Fatalf("Insert failed: %v", err)
+	}
+	if _, err := untracked.FindAll("events", nil, options); !errors.Is(err, domain.ErrInsertionOrderDisabled) {
+		t.Errorf("Expected ErrInsertionOrderDisabled without tracking, got %v", err)
+	}
+}
+
+func TestStorageEngine_FindAllSortField(t *testing.T) {
+	walDir, dataDir, checkpointDir := createTestDirs(t)
+	engine := NewStorageEngine(
+		WithWALDir(walDir),
+		WithDataDir(dataDir),
+		WithCheckpointDir(checkpointDir),
+		WithDurabilityLevel(DurabilityMemory),
+	)
+	defer engine.StopBackgroundWorkers()
+
+	for _, doc := range []domain.Document{{"name": "b", "age": 30}, {"name": "c"}, {"name": "a", "age": 4}, {"name": "d", "age": 30}} {
+		if _, err := engine.Insert("users", doc); err != nil {
+			t.Fatalf("Insert failed: %v", err)
+		}
+	}
+
+	options := domain.DefaultPaginationOptions()
+	options.SortField = "age"
+	options.SortDesc = true
+	result, err := engine.FindAll("users", nil, options)
+	if err != nil {
+		t.Fatalf("FindAll failed: %v", err)
+	}
+	var got []string
+	for _, doc := range result.Documents {
+		got = append(got, doc["name"].(string))
+	}
+	if want := "b,d,a,c"; strings.Join(got, ",") != want {
+		t.Errorf("Expected order %s, got %v", want, got)
+	}
+}
+
+func TestStorageEngine_FindAcrossCollections(t *testing.T) {
+	walDir, dataDir, checkpointDir := createTestDirs(t)
+	engine := NewStorageEngine(
+		WithWALDir(walDir),
+		WithDataDir(dataDir),
+		WithCheckpointDir(checkpointDir),
+		WithDurabilityLevel(DurabilityMemory),
+	)
+	defer engine.StopBackgroundWorkers()
+
+	for _, day := range []string{"logs_2024_01_02", "logs_2024_01_01", "users"} {
+		for i := 0; i < 3; i++ {
+			if _, err := engine.Insert(day, domain.Document{"n": i}); err != nil {
+				t.Fatalf("Insert failed: %v", err)
+			}
+		}
+	}
+
+	options := domain.DefaultPaginationOptions()
+	options.Limit = 4
+	result, err := engine.FindAcrossCollections("logs_*", nil, options)
+	if err != nil {
+		t.Fatalf("FindAcrossCollections failed: %v", err)
+	}
+	var got []string
+	for _, doc := range result.Documents {
+		got = append(got, doc[storage.CollectionFieldKey].(string))
+	}
+	want := "logs_2024_01_01,logs_2024_01_01,logs_2024_01_01,logs_2024_01_02"
+	if strings.Join(got, ",") != want || !result.HasNext {
+		t.Errorf("Expected %s with a next page, got %v (has_next %v)", want, got, result.HasNext)
+	}
+}
+
+func TestStorageEngine_AppliedOffset(t *testing.T) {
+	walDir, dataDir, checkpointDir := createTestDirs(t)
+	engine := NewStorageEngine(
+		WithWALDir(walDir),
+		WithDataDir(dataDir),
+		WithCheckpointDir(checkpointDir),
+		WithDurabilityLevel(DurabilityMemory),
+	)
+	defer engine.StopBackgroundWorkers()
+
+	before := engine.AppliedOffset()
+	doc, err := engine.Insert("events", domain.Document{"seq": 1})
+	if err != nil {
+		t.Fatalf("Insert failed: %v", err)
+	}
+	afterInsert := engine.AppliedOffset()
+	if afterInsert <= before {
+		t.Errorf("Expected the offset to advance past %d on insert, got %d", before, afterInsert)
+	}
+
+	if _, err := engine.GetById("events", doc["_id"].(string)); err != nil {
+		t.Fatalf("GetById failed: %v", err)
+	}
+	if offset := engine.AppliedOffset(); offset != afterInsert {
+		t.Errorf("Expected reads to leave the offset at %d, got %d", afterInsert, offset)
+	}
+}
+
+func TestStorageEngine_MoveDocument(t *testing.T) {
+	walDir, dataDir, checkpointDir := createTestDirs(t)
+	newEngine := func() *StorageEngine {
+		return NewStorageEngine(
+			WithWALDir(walDir),
+			WithDataDir(dataDir),
+			WithCheckpointDir(checkpointDir),
+			WithDurabilityLevel(DurabilityMemory),
+		)
+	}
+	engine := newEngine()
+
+	pending, err := engine.Insert("pending", domain.Document{"task": "build"})
+	if err != nil {
+		t.Fatalf("Insert failed: %v", err)
+	}
+	pendingID := pending["_id"].(string)
+	if err := engine.CreateCollection("completed"); err != nil {
+		t.Fatalf("CreateCollection failed: %v", err)
+	}
+	if err := engine.CreateIndex("completed", "task"); err != nil {
+		t.Fatalf("CreateIndex failed: %v", err)
+	}
+
+	moved, err := engine.MoveDocument("pending", pendingID, "completed", false)
+	if err != nil {
+		t.Fatalf("MoveDocument failed: %v", err)
+	}
+	movedID := moved["_id"].(string)
+	if movedID == pendingID {
+		t.Errorf("Expected a new _id in the destination, got %s", movedID)
+	}
+	if _, err := engine.GetById("pending", pendingID); !errors.Is(err, domain.ErrDocumentNotFound) {
+		t.Errorf("Expected the document to leave pending, got %v", err)
+	}
+	if doc, err := engine.GetById("completed", movedID); err != nil || doc["task"] != "build" {
+		t.Errorf("Expected the document in completed, got %v: %v", doc, err)
+	}
+	if docs, err := engine.FindByIndex("completed", "task", "build"); err != nil || len(docs) != 1 {
+		t.Errorf("Expected the moved document in the task index, got %v: %v", docs, err)
+	}
+
+	kept, err := engine.Insert("pending", domain.Document{"task": "test"})
+	if err != nil {
+		t.Fatalf("Insert failed: %v", err)
+	}
+	keptID := kept["_id"].(string)
+	if moved, err := engine.MoveDocument("pending", keptID, "completed", true); err != nil || moved["_id"] != keptID {
+		t.Fatalf("Expected the move to keep _id %s, got %v: %v", keptID, moved, err)
+	}
+	if _, err := engine.MoveDocument("completed", keptID, "pending", false); err != nil {
+		t.Fatalf("MoveDocument back failed: %v", err)
+	}
+	if _, err := engine.MoveDocument("pending", "missing", "completed", false); !errors.Is(err, domain.ErrDocumentNotFound) {
+		t.Errorf("Expected ErrDocumentNotFound, got %v", err)
+	}
+
+	// A kept ID already taken in the destination is refused
+	if _, err := engine.Insert("pending", domain.Document{"_id": movedID, "task": "clash"}); err != nil {
+		t.Fatalf("Insert failed: %v", err)
+	}
+	if _, err := engine.MoveDocument("pending", movedID, "completed", true); !errors.Is(err, domain.ErrDocumentExists) {
+		t.Errorf("Expected ErrDocumentExists, got %v", err)
+	}
+
+	counts := map[string]int{"pending": 2, "completed": 1}
+	for collName, count := range counts {
+		result, err := engine.FindAll(collName, nil, nil)
+		if err != nil || len(result.Documents) != count {
+			t.Errorf("Expected %d documents in %s, got %v: %v", count, collName, result, err)
+		}
+	}
+	engine.StopBackgroundWorkers()
+	engine.walEngine.Close()
+
+	// Recovery replays each move as a whole
+	recovered := newEngine()
+	defer recovered.StopBackgroundWorkers()
+	for collName, count := range counts {
+		result, err := recovered.FindAll(collName, nil, nil)
+		if err != nil || len(result.Documents) != count {
+			t.Errorf("Expected %d documents in %s after recovery, got %v: %v", count, collName, result, err)
+		}
+	}
+	if doc, err := recovered.GetById("completed", movedID); err != nil || doc["task"] != "build" {
+		t.Errorf("Expected the moved document after recovery, got %v: %v", doc, err)
+	}
+}
+
+func TestStorageEngine_GetArraySlice(t *testing.T) {
+	walDir, dataDir, checkpointDir := createTestDirs(t)
+	engine := NewStorageEngine(
+		WithWALDir(walDir),
+		WithDataDir(dataDir),
+		WithCheckpointDir(checkpointDir),
+		WithDurabilityLevel(DurabilityMemory),
+	)
+
+	doc, err := engine.Insert("posts", domain.Document{"title": "hello", "comments": []interface{}{"a", "b", "c"}})
+	if err != nil {
+		t.Fatalf("Insert failed: %v", err)
+	}
+	docID := doc["_id"].(string)
+
+	slice, err := engine.GetArraySlice("posts", docID, "comments", 1, 5)
+	if err != nil {
+		t.Fatalf("GetArraySlice failed: %v", err)
+	}
+	if len(slice.Items) != 2 || slice.Items[0] != "b" || slice.Items[1] != "c" {
+		t.Errorf("Expected items [b c], got %v", slice.Items)
+	}
+	if slice.Total != 3 || slice.HasMore {
+		t.Errorf("Expected total 3 and no more, got total %d, has_more %v", slice.Total, slice.HasMore)
+	}
+
+	if _, err := engine.GetArraySlice("posts", docID, "title", 0, 5); !errors.Is(err, domain.ErrInvalidField) {
+		t.Errorf("Expected ErrInvalidField for a non-array field, got %v", err)
+	}
+	if _, err := engine.GetArraySlice("posts", docID, "likes", 0, 5); !errors.Is(err, domain.ErrFieldNotFound) {
+		t.Errorf("Expected ErrFieldNotFound for a missing field, got %v", err)
+	}
+	if _, err := engine.GetArraySlice("posts", "missing", "comments", 0, 5); !errors.Is(err, domain.ErrDocumentNotFound) {
+		t.Errorf("Expected ErrDocumentNotFound, got %v", err)
+	}
+}
+
+func TestStorageEngine_DurableWrites(t *testing.T) {
+	walDir, dataDir, checkpointDir := createTestDirs(t)
+	engine := NewStorageEngine(
+		WithWALDir(walDir),
+		WithDataDir(dataDir),
+		WithCheckpointDir(checkpointDir),
+		WithDurabilityLevel(DurabilityMemory),
+	)
+	durable := domain.WithDurableWrite(context.Background())
+
+	doc, err := engine.InsertContext(durable, "payments", domain.Document{"amount": 10})
+	if err != nil {
+		t.Fatalf("InsertContext failed: %v", err)
+	}
+	docID := doc["_id"].(string)
+	if _, err := engine.UpdateByIdContext(durable, "payments", docID, domain.Document{"amount": 11}); err != nil {
+		t.Fatalf("UpdateByIdContext failed: %v", err)
+	}
+	if _, err := engine.ReplaceByIdContext(durable, "payments", docID, domain.Document{"amount": 12}); err != nil {
+		t.Fatalf("ReplaceByIdContext failed: %v", err)
+	}
+	if err := engine.DeleteByIdContext(durable, "payments", docID); err != nil {
+		t.Fatalf("DeleteByIdContext failed: %v", err)
+	}
+
+	// The durable flag is not part of the logged entries
+	files, err := engine.walEngine.GetWALFiles()
+	if err != nil || len(files) == 0 {
+		t.Fatalf("Expected WAL files, got %v (%v)", files, err)
+	}
+	data, err := os.ReadFile(files[0])
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+	if strings.Contains(string(data), "durable") {
+		t.Errorf("Expected no durable field in the WAL, got %s", data)
+	}
+}
+
+func TestStorageEngine_WriteDurability(t *testing.T) {
+	// Writes to /dev/null succeed but fsyncs fail, which exposes the fsyncs made
+	unsyncable := func(t *testing.T) *os.File {
+		t.Helper()
+		file, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+		if err != nil {
+			t.Fatalf("Failed to open %s: %v", os.DevNull, err)
+		}
+		t.Cleanup(func() { file.Close() })
+		if file.Sync() == nil {
+			t.Skipf("fsync of %s succeeds on this platform", os.DevNull)
+		}
+		return file
+	}
+	newEngine := func(t *testing.T, level DurabilityLevel) *StorageEngine {
+		t.Helper()
+		walDir, dataDir, checkpointDir := createTestDirs(t)
+		engine := NewStorageEngine(
+			WithWALDir(walDir),
+			WithDataDir(dataDir),
+			WithCheckpointDir(checkpointDir),
+			WithDurabilityLevel(level),
+		)
+		if _, err := engine.Insert("events", domain.Document{"_id": "seed", "n": 0}); err != nil {
+			t.Fatalf("Insert failed: %v", err)
+		}
+		original := engine.walEngine.walFile.File
+		engine.walEngine.walFile.File = unsyncable(t)
+		t.Cleanup(func() { engine.walEngine.walFile.File = original })
+		return engine
+	}
+	writes := map[string]func(engine *StorageEngine, ctx context.Context) error{
+		"InsertContext": func(engine *StorageEngine, ctx context.Context) error {
+			_, err := engine.InsertContext(ctx, "events", domain.Document{"n": 1})
+			return err
+		},
+		"BatchInsertContext": func(engine *StorageEngine, ctx context.Context) error {
+			_, err := engine.BatchInsertContext(ctx, "events", []domain.Document{{"n": 2}, {"n": 3}})
+			return err
+		},
+		"UpdateByIdContext": func(engine *StorageEngine, ctx context.Context) error {
+			_, err := engine.UpdateByIdContext(ctx, "events", "seed", domain.Document{"n": 4})
+			return err
+		},
+	}
+
+	t.Run("full for one write", func(t *testing.T) {
+		engine := newEngine(t, DurabilityOS)
+		full := WithWriteDurability(context.Background(), DurabilityFull)
+		for name, write := range writes {
+			if err := write(engine, context.Background()); err != nil {
+				t.Errorf("%s at the engine level failed: %v", name, err)
+			}
+			if err := write(engine, full); err == nil {
+				t.Errorf("Expected %s with DurabilityFull to fsync", name)
+			}
+		}
+	})
+
+	t.Run("os for one write", func(t *testing.T) {
+		engine := newEngine(t, DurabilityFull)
+		osLevel := WithWriteDurability(context.Background(), DurabilityOS)
+		for name, write := range writes {
+			if err := write(engine, context.Background()); err == nil {
+				t.Errorf("Expected %s at the engine level to fsync", name)
+			}
+			if err := write(engine, osLevel); err != nil {
+				t.Errorf("%s with DurabilityOS failed: %v", name, err)
+			}
+		}
+
+		// A durable write is fsynced whatever the level, and unknown levels are ignored
+		durable := domain.WithDurableWrite(osLevel)
+		if err := writes["InsertContext"](engine, durable); !errors.Is(err, domain.ErrNotDurable) {
+			t.Errorf("Expected ErrNotDurable for a durable write, got %v", err)
+		}
+		unknown := WithWriteDurability(context.Background(), DurabilityLevel(9))
+		if err := writes["InsertContext"](engine, unknown); err == nil {
+			t.Error("Expected an unknown level to leave the engine level in place")
+		}
+	})
+}
+
+func TestStorageEngine_FieldPathFilters(t *testing.T) {
+	walDir, dataDir, checkpointDir := createTestDirs(t)
+	engine := NewStorageEngine(
+		WithWALDir(walDir),
+		WithDataDir(dataDir),
+		WithCheckpointDir(checkpointDir),
+		WithDurabilityLevel(DurabilityMemory),
+	)
+
+	var firstID string
+	for _, items := range [][]interface{}{
+		{map[string]interface{}{"sku": "A"}},
+		{map[string]interface{}{"sku": "B"}, map[string]interface{}{"sku": "A"}},
+	} {
+		doc, err := engine.Insert("orders", domain.Document{"status": "open", "items": items})
+		if err != nil {
+			t.Fatalf("Insert failed: %v", err)
+		}
+		if firstID == "" {
+			firstID = doc["_id"].(string)
+		}
+	}
+	if err := engine.CreateIndex("orders", "status"); err != nil {
+		t.Fatalf("CreateIndex failed: %v", err)
+	}
+
+	ids, err := engine.FindIds("orders", map[string]interface{}{"status": "open", "items.0.sku": "A"})
+	if err != nil {
+		t.Fatalf("FindIds failed: %v", err)
+	}
+	if len(ids) != 1 || ids[0] != firstID {
+		t.Errorf("Expected only the order whose first item is A, got %v", ids)
+	}
+
+	result, err := engine.FindAll("orders", map[string]interface{}{"items.sku": "A"}, nil)
+	if err != nil {
+		t.Fatalf("FindAll failed: %v", err)
+	}
+	if len(result.Documents) != 2 {
+		t.Errorf("Expected both orders to have an item A, got %d", len(result.Documents))
+	}
+}
+
+func TestStorageEngine_Upsert(t *testing.T) {
+	walDir, dataDir, checkpointDir := createTestDirs(t)
+	engine := NewStorageEngine(
+		WithWALDir(walDir),
+		WithDataDir(dataDir),
+		WithCheckpointDir(checkpointDir),
+		WithDurabilityLevel(DurabilityMemory),
+	)
+
+	filter := map[string]interface{}{"email": "alice@example.com"}
+	doc, created, err := engine.Upsert("users", filter, domain.Document{
+		"$set":         map[string]interface{}{"name": "Alice"},
+		"$setOnInsert": map[string]interface{}{"created_at": "2024-01-01T00:00:00Z"},
+	})
+	if err != nil {
+		t.Fatalf("Upsert failed: %v", err)
+	}
+	if !created || doc["email"] != "alice@example.com" || doc["created_at"] != "2024-01-01T00:00:00Z" {
+		t.Errorf("Expected a created document with the filter and $setOnInsert fields, got %v (created %v)", doc, created)
+	}
+	docID := doc["_id"].(string)
+
+	doc, created, err = engine.Upsert("users", filter, domain.Document{
+		"$set":         map[string]interface{}{"name": "Alice Smith"},
+		"$setOnInsert": map[string]interface{}{"created_at": "2025-06-01T00:00:00Z"},
+	})
+	if err != nil {
+		t.Fatalf("Upsert failed: %v", err)
+	}
+	if created || doc["_id"] != docID || doc["name"] != "Alice Smith" || doc["created_at"] != "2024-01-01T00:00:00Z" {
+		t.Errorf("Expected the document updated without $setOnInsert, got %v (created %v)", doc, created)
+	}
+
+	if _, _, err := engine.Upsert("users", filter, domain.Document{"$set": map[string]interface{}{"_id": "x"}}); !errors.Is(err, domain.ErrInvalidField) {
+		t.Errorf("Expected ErrInvalidField for setting _id, got %v", err)
+	}
+
+	ids, err := engine.FindIds("users", nil)
+	if err != nil {
+		t.Fatalf("FindIds failed: %v", err)
+	}
+	if len(ids) != 1 {
+		t.Errorf("Expected one document, got %v", ids)
+	}
+}
+
+func TestStorageEngine_UpsertById(t *testing.T) {
+	walDir, dataDir, checkpointDir := createTestDirs(t)
+	engine := NewStorageEngine(
+		WithWALDir(walDir),
+		WithDataDir(dataDir),
+		WithCheckpointDir(checkpointDir),
+		WithDurabilityLevel(DurabilityMemory),
+	)
+	if err := engine.CreateIndex("users", "name"); err != nil {
+		t.Fatalf("CreateIndex failed: %v", err)
+	}
+
+	doc, created, err := engine.UpsertById("users", "10", domain.Document{"name": "Bob"})
+	if err != nil {
+		t.Fatalf("UpsertById failed: %v", err)
+	}
+	if !created || doc["_id"] != "10" || doc["name"] != "Bob" {
+		t.Errorf("Expected a created document with ID 10, got %v (created %v)", doc, created)
+	}
+
+	doc, created, err = engine.UpsertById("users", "10", domain.Document{"name": "Robert", "_id": "x"})
+	if err != nil {
+		t.Fatalf("UpsertById failed: %v", err)
+	}
+	if created || doc["_id"] != "10" || doc["name"] != "Robert" {
+		t.Errorf("Expected the document updated in place, got %v (created %v)", doc, created)
+	}
+
+	for name, want := range map[string][]string{"Bob": nil, "Robert": {"10"}} {
+		ids, err := engine.FindIds("users", map[string]interface{}{"name": name})
+		if err != nil {
+			t.Fatalf("FindIds failed: %v", err)
+		}
+		if len(ids) != len(want) || (len(want) > 0 && ids[0] != want[0]) {
+			t.Errorf("Expected %v for name %s, got %v", want, name, ids)
+		}
+	}
+
+	if _, _, err := engine.UpsertById("users", "", domain.Document{"name": "Nobody"}); !errors.Is(err, domain.ErrInvalidField) {
+		t.Errorf("Expected ErrInvalidField for an empty ID, got %v", err)
+	}
+}
+
+func TestStorageEngine_LockStats(t *testing.T) {
+	walDir, dataDir, checkpointDir := createTestDirs(t)
+	engine := NewStorageEngine(
+		WithWALDir(walDir),
+		WithDataDir(dataDir),
+		WithCheckpointDir(checkpointDir),
+		WithDurabilityLevel(DurabilityMemory),
+		WithConsistencyLevel(ConsistencyLinearizable),
+	)
+
+	doc, err := engine.Insert("users", domain.Document{"name": "Alice"})
+	if err != nil {
+		t.Fatalf("Insert failed: %v", err)
+	}
+	if _, _, err := engine.Upsert("users", map[string]interface{}{"name": "Bob"}, domain.Document{"age": 30}); err != nil {
+		t.Fatalf("Upsert failed: %v", err)
+	}
+
+	// Hold a document lock while a second writer waits for it
+	unlock := engine.lockDocument("users", doc["_id"].(string))
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		engine.UpdateById("users", doc["_id"].(string), domain.Document{"age": 31})
+	}()
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		stats := engine.LockStats()
+		if len(stats) == 1 && stats[0].Documents.WriteWaiters == 1 {
+			if stats[0].Name != "users" || stats[0].Documents.WriteHolders != 1 || stats[0].Collection.WriteHolders != 0 {
+				t.Errorf("Unexpected lock stats %+v", stats[0])
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Waiting writer never counted: %+v", stats)
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	unlock()
+	<-done
+	if stats := engine.LockStats(); len(stats) != 1 || stats[0] != (domain.CollectionLockStats{Name: "users"}) {
+		t.Errorf("Expected no holders or waiters once released, got %+v", stats)
+	}
+}
+
+func TestStorageEngine_UpdateMaxMin(t *testing.T) {
+	walDir, dataDir, checkpointDir := createTestDirs(t)
+	newEngine := func() *StorageEngine {
+		return NewStorageEngine(WithWALDir(walDir), WithDataDir(dataDir), WithCheckpointDir(checkpointDir))
+	}
+	engine := newEngine()
+
+	doc, err := engine.Insert("players", domain.Document{"highScore": 300, "bestLap": 62.5})
+	if err != nil {
+		t.Fatalf("Insert failed: %v", err)
+	}
+	docID := doc["_id"].(string)
+
+	doc, err = engine.UpdateById("players", docID, domain.Document{
+		"$max": map[string]interface{}{"highScore": 500},
+		"$min": map[string]interface{}{"bestLap": 70},
+	})
+	if err != nil {
+		t.Fatalf("UpdateById failed: %v", err)
+	}
+	if doc["highScore"] != 500 || doc["bestLap"] != 62.5 {
+		t.Errorf("Expected highScore 500 and bestLap 62.5, got %v", doc)
+	}
+
+	if _, err := engine.BatchUpdate("players", []domain.BatchUpdateOperation{
+		{ID: docID, Updates: domain.Document{"$max": map[string]interface{}{"highScore": 400}, "$min": map[string]interface{}{"bestLap": 61}}},
+	}); err != nil {
+		t.Fatalf("BatchUpdate failed: %v", err)
+	}
+	if _, err := engine.UpdateById("players", docID, domain.Document{"$max": map[string]interface{}{"highScore": "lots"}}); !errors.Is(err, domain.ErrInvalidField) {
+		t.Errorf("Expected ErrInvalidField for an incomparable value, got %v", err)
+	}
+	engine.StopBackgroundWorkers()
+	engine.walEngine.Close()
+
+	// The WAL holds the resolved fields, so replay gives the same document
+	recovered := newEngine()
+	defer recovered.StopBackgroundWorkers()
+	doc, err = recovered.GetById("players", docID)
+	if err != nil {
+		t.Fatalf("GetById after recovery failed: %v", err)
+	}
+	if highScore, _ := storage.ToFloat64(doc["highScore"]); highScore != 500 {
+		t.Errorf("Expected recovered highScore 500, got %v", doc["highScore"])
+	}
+	if bestLap, _ := storage.ToFloat64(doc["bestLap"]); bestLap != 61 {
+		t.Errorf("Expected recovered bestLap 61, got %v", doc["bestLap"])
+	}
+	if _, exists := doc["$max"]; exists {
+		t.Errorf("Operator section stored as a field: %v", doc)
+	}
+}
+
+func TestStorageEngine_UpdateMaxMinConcurrent(t *testing.T) {
+	walDir, dataDir, checkpointDir := createTestDirs(t)
+	engine := NewStorageEngine(
+		WithWALDir(walDir),
+		WithDataDir(dataDir),
+		WithCheckpointDir(checkpointDir),
+		WithDurabilityLevel(DurabilityMemory),
+	)
+	defer engine.StopBackgroundWorkers()
+
+	doc, err := engine.Insert("players", domain.Document{"highScore": 0, "bestLap": 1000})
+	if err != nil {
+		t.Fatalf("Insert failed: %v", err)
+	}
+	docID := doc["_id"].(string)
+
+	// Each writer compares against the document as the others leave it, so the
+	// extremes survive without ConsistencyLinearizable too
+	const writers = 50
+	var wg sync.WaitGroup
+	start := make(chan struct{})
+	for i := 1; i <= writers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			<-start
+			if _, err := engine.UpdateById("players", docID, domain.Document{
+				"$max": map[string]interface{}{"highScore": i},
+				"$min": map[string]interface{}{"bestLap": 1000 - i},
+			}); err != nil {
+				t.Errorf("UpdateById failed: %v", err)
+			}
+		}(i)
+	}
+	close(start)
+	wg.Wait()
+
+	doc, err = engine.GetById("players", docID)
+	if err != nil {
+		t.Fatalf("GetById failed: %v", err)
+	}
+	if highScore, _ := storage.ToFloat64(doc["highScore"]); highScore != writers {
+		t.Errorf("Expected highScore %d, got %v", writers, doc["highScore"])
+	}
+	if bestLap, _ := storage.ToFloat64(doc["bestLap"]); bestLap != 1000-writers {
+		t.Errorf("Expected bestLap %d, got %v", 1000-writers, doc["bestLap"])
+	}
+}
+
+func TestStorageEngine_UpdateInc(t *testing.T) {
+	walDir, dataDir, checkpointDir := createTestDirs(t)
+	newEngine := func() *StorageEngine {
+		return NewStorageEngine(
+			WithWALDir(walDir),
+			WithDataDir(dataDir),
+			WithCheckpointDir(checkpointDir),
+			WithConsistencyLevel(ConsistencyLinearizable),
+		)
+	}
+	engine := newEngine()
+	if err := engine.CreateIndex("pages", "views"); err != nil {
+		t.Fatalf("CreateIndex failed: %v", err)
+	}
+
+	doc, err := engine.Insert("pages", domain.Document{"views": 0})
+	if err != nil {
+		t.Fatalf("Insert failed: %v", err)
+	}
+	docID := doc["_id"].(string)
+
+	// Increments of one document are serialized by its lock, so none is lost
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := engine.UpdateById("pages", docID, domain.Document{"$inc": map[string]interface{}{"views": 1}}); err != nil {
+				t.Errorf("UpdateById failed: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	// Repeated operations on one document in a batch add up
+	if _, err := engine.BatchUpdate("pages", []domain.BatchUpdateOperation{
+		{ID: docID, Updates: domain.Document{"$inc": map[string]interface{}{"views": 5, "likes": 1}}},
+		{ID: docID, Updates: domain.Document{"$inc": map[string]interface{}{"views": 5}}},
+	}); err != nil {
+		t.Fatalf("BatchUpdate failed: %v", err)
+	}
+	for views, want := range map[int64]int{20: 0, 25: 0, 30: 1} {
+		ids, err := engine.FindIds("pages", map[string]interface{}{"views": views})
+		if err != nil {
+			t.Fatalf("FindIds failed: %v", err)
+		}
+		if len(ids) != want {
+			t.Errorf("Expected %d documents with views %d, got %v", want, views, ids)
+		}
+	}
+
+	if _, err := engine.UpdateById("pages", docID, domain.Document{"$inc": map[string]interface{}{"views": "1"}}); !errors.Is(err, domain.ErrInvalidField) {
+		t.Errorf("Expected ErrInvalidField for a non-numeric increment, got %v", err)
+	}
+	engine.StopBackgroundWorkers()
+	engine.walEngine.Close()
+
+	// The WAL holds the resolved sums, so replay does not add again
+	recovered := newEngine()
+	defer recovered.StopBackgroundWorkers()
+	doc, err = recovered.GetById("pages", docID)
+	if err != nil {
+		t.Fatalf("GetById after recovery failed: %v", err)
+	}
+	if views, _ := storage.ToFloat64(doc["views"]); views != 30 {
+		t.Errorf("Expected recovered views 30, got %v", doc["views"])
+	}
+	if likes, _ := storage.ToFloat64(doc["likes"]); likes != 1 {
+		t.Errorf("Expected recovered likes 1, got %v", doc["likes"])
+	}
+}
+
+func TestStorageEngine_UpdateByIdIfVersion(t *testing.T) {
+	walDir, dataDir, checkpointDir := createTestDirs(t)
+	engine := NewStorageEngine(WithWALDir(walDir), WithDataDir(dataDir), WithCheckpointDir(checkpointDir))
+	defer engine.StopBackgroundWorkers()
+
+	doc, err := engine.Insert("users", domain.Document{"name": "Alice"})
+	if err != nil {
+		t.Fatalf("Insert failed: %v", err)
+	}
+	if engine.DocumentVersionsEnabled() {
+		t.Error("Expected document versions to be disabled")
+	}
+	if _, err := engine.UpdateByIdIfVersion("users", doc["_id"].(string), 1, domain.Document{"age": 30}); !errors.Is(err, domain.ErrVersionsDisabled) {
+		t.Errorf("Expected ErrVersionsDisabled, got %v", err)
+	}
+}
+
+func TestStorageEngine_ListCollections(t *testing.T) {
+	walDir, dataDir, checkpointDir := createTestDirs(t)
+	engine := NewStorageEngine(
+		WithWALDir(walDir),
+		WithDataDir(dataDir),
+		WithCheckpointDir(checkpointDir),
+		WithDurabilityLevel(DurabilityMemory),
+		WithCheckpointInterval(time.Hour),
+	)
+	defer engine.StopBackgroundWorkers()
+
+	for i := 0; i < 2; i++ {
+		if _, err := engine.Insert("users", domain.Document{"n": i}); err != nil {
+			t.Fatalf("Failed to insert document: %v", err)
+		}
+	}
+	if err := engine.CreateCollection("archive"); err != nil {
+		t.Fatalf("Failed to create collection: %v", err)
+	}
+
+	summaries := engine.ListCollections()
+	if len(summaries) != 2 || summaries[0].Name != "archive" || summaries[1].Name != "users" {
+		t.Fatalf("Expected archive and users sorted by name, got %+v", summaries)
+	}
+	if summaries[0].State != "loaded" || summaries[0].DocumentCount != 0 {
+		t.Errorf("Expected an empty loaded archive, got %+v", summaries[0])
+	}
+	if summaries[1].State != "dirty" || summaries[1].DocumentCount != 2 {
+		t.Errorf("Expected users dirty with 2 documents, got %+v", summaries[1])
+	}
+}
+
+func TestStorageEngine_UpdateMany(t *testing.T) {
+	walDir, dataDir, checkpointDir := createTestDirs(t)
+	options := []StorageOption{
+		WithWALDir(walDir),
+		WithDataDir(dataDir),
+		WithCheckpointDir(checkpointDir),
+		WithDurabilityLevel(DurabilityMemory),
+		WithCheckpointInterval(time.Hour),
+	}
+	engine := NewStorageEngine(options...)
+
+	var paris []string
+	var berlin string
+	for _, city := range []string{"Paris", "Berlin", "Paris"} {
+		doc, err := engine.Insert("users", domain.Document{"city": city, "active": true})
+		if err != nil {
+			t.Fatalf("Failed to insert document: %v", err)
+		}
+		if city == "Paris" {
+			paris = append(paris, doc["_id"].(string))
+		} else {
+			berlin = doc["_id"].(string)
+		}
+	}
+	sort.Strings(paris)
+	for _, field := range []string{"city", "active"} {
+		if err := engine.CreateIndex("users", field); err != nil {
+			t.Fatalf("Failed to create index: %v", err)
+		}
+	}
+
+	modified, err := engine.UpdateMany("users", map[string]interface{}{"city": "Paris"}, domain.Document{"active": false, "_id": "x"})
+	if err != nil {
+		t.Fatalf("UpdateMany failed: %v", err)
+	}
+	if modified != 2 {
+		t.Errorf("Expected 2 documents updated, got %d", modified)
+	}
+
+	// The indexes follow the update, as with one UpdateById per document
+	if ids, _ := engine.FindIds("users", map[string]interface{}{"active": false}); !reflect.DeepEqual(ids, paris) {
+		t.Errorf("Expected %v inactive, got %v", paris, ids)
+	}
+	if ids, _ := engine.FindIds("users", map[string]interface{}{"active": true}); !reflect.DeepEqual(ids, []string{berlin}) {
+		t.Errorf("Expected [%s] active, got %v", berlin, ids)
+	}
+	if doc, _ := engine.GetById("users", paris[0]); doc["_id"] != paris[0] {
+		t.Errorf("Expected _id to stay %s, got %v", paris[0], doc["_id"])
+	}
+
+	if _, err := engine.UpdateMany("missing", nil, domain.Document{"active": false}); !errors.Is(err, domain.ErrCollectionNotFound) {
+		t.Errorf("Expected ErrCollectionNotFound, got %v", err)
+	}
+
+	// The batch entry is replayed on recovery
+	engine.walEngine.Close()
+	recovered := NewStorageEngine(options...)
+	defer recovered.StopBackgroundWorkers()
+	result, err := recovered.FindAll("users", map[string]interface{}{"active": false}, nil)
+	if err != nil {
+		t.Fatalf("FindAll failed: %v", err)
+	}
+	if len(result.Documents) != 2 {
+		t.Errorf("Expected 2 inactive users after recovery, got %d", len(result.Documents))
 	}
 }
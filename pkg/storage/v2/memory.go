@@ -1,18 +1,25 @@
 package v2
 
 import (
+	"context"
 	"fmt"
+	"sort"
 	"time"
 
 	"github.com/adfharrison1/go-db/pkg/domain"
+	"github.com/adfharrison1/go-db/pkg/indexing"
+	"github.com/adfharrison1/go-db/pkg/storage"
 )
 
+// ctxCheckInterval controls how often long scans poll their context
+const ctxCheckInterval = 256
+
 // NewMemoryManager creates a new memory manager
 func NewMemoryManager(engine *StorageEngine) *MemoryManager {
 	return &MemoryManager{
 		engine:      engine,
 		maxMemoryMB: engine.maxMemoryMB,
-		cache:       NewLRUCache(engine.maxMemoryMB / 100), // 100MB per collection estimate
+		cache:       NewLRUCache(storage.MaxMemoryCacheCapacity(engine.maxMemoryMB)),
 		collections: make(map[string]*Collection),
 	}
 }
@@ -74,13 +81,13 @@ func (mm *MemoryManager) GetById(collName, docID string) (domain.Document, error
 	// Get collection
 	coll, exists := mm.collections[collName]
 	if !exists {
-		return nil, fmt.Errorf("collection %s not found", collName)
+		return nil, domain.Errorf(domain.ErrCollectionNotFound, "collection %s not found", collName)
 	}
 
 	// Get document
 	doc, exists := coll.Documents[docID]
 	if !exists {
-		return nil, fmt.Errorf("document %s not found in collection %s", docID, collName)
+		return nil, domain.Errorf(domain.ErrDocumentNotFound, "document %s not found in collection %s", docID, collName)
 	}
 
 	// Update cache
@@ -89,6 +96,34 @@ func (mm *MemoryManager) GetById(collName, docID string) (domain.Document, error
 	return doc, nil
 }
 
+// documentCount returns the number of documents in a collection
+func (mm *MemoryManager) documentCount(collName string) (int, error) {
+	mm.mu.RLock()
+	defer mm.mu.RUnlock()
+
+	coll, exists := mm.collections[collName]
+	if !exists {
+		return 0, domain.Errorf(domain.ErrCollectionNotFound, "collection %s not found", collName)
+	}
+	return len(coll.Documents), nil
+}
+
+// documentIDs returns the IDs of a collection's documents in no particular order
+func (mm *MemoryManager) documentIDs(collName string) []string {
+	mm.mu.RLock()
+	defer mm.mu.RUnlock()
+
+	coll, exists := mm.collections[collName]
+	if !exists {
+		return nil
+	}
+	ids := make([]string, 0, len(coll.Documents))
+	for docID := range coll.Documents {
+		ids = append(ids, docID)
+	}
+	return ids
+}
+
 // UpdateDocument updates a document in memory
 func (mm *MemoryManager) UpdateDocument(collName, docID string, doc domain.Document) error {
 	mm.mu.Lock()
@@ -97,7 +132,7 @@ func (mm *MemoryManager) UpdateDocument(collName, docID string, doc domain.Docum
 	// Get collection
 	coll, exists := mm.collections[collName]
 	if !exists {
-		return fmt.Errorf("collection %s not found", collName)
+		return domain.Errorf(domain.ErrCollectionNotFound, "collection %s not found", collName)
 	}
 
 	// Update document
@@ -122,7 +157,7 @@ func (mm *MemoryManager) DeleteDocument(collName, docID string) error {
 	// Get collection
 	coll, exists := mm.collections[collName]
 	if !exists {
-		return fmt.Errorf("collection %s not found", collName)
+		return domain.Errorf(domain.ErrCollectionNotFound, "collection %s not found", collName)
 	}
 
 	// Delete document
@@ -134,8 +169,49 @@ func (mm *MemoryManager) DeleteDocument(collName, docID string) error {
 	return nil
 }
 
+// MoveDocument removes a document from srcColl and stores doc, its moved form, in
+// dstColl under one lock, so readers never see it in both collections or in neither
+func (mm *MemoryManager) MoveDocument(srcColl, docID, dstColl string, doc domain.Document) error {
+	mm.mu.Lock()
+	defer mm.mu.Unlock()
+
+	src, exists := mm.collections[srcColl]
+	if !exists {
+		return domain.Errorf(domain.ErrCollectionNotFound, "collection %s not found", srcColl)
+	}
+	dst, err := mm.getOrCreateCollection(dstColl)
+	if err != nil {
+		return fmt.Errorf("failed to get collection: %w", err)
+	}
+
+	delete(src.Documents, docID)
+	mm.cache.Remove(srcColl + ":" + docID)
+
+	newID := doc["_id"].(string)
+	dst.Documents[newID] = doc
+	mm.cache.Put(dstColl+":"+newID, doc, dstColl)
+
+	return nil
+}
+
+// DropCollection removes a collection and its cached documents from memory
+func (mm *MemoryManager) DropCollection(collName string) {
+	mm.mu.Lock()
+	defer mm.mu.Unlock()
+
+	coll, exists := mm.collections[collName]
+	if !exists {
+		return
+	}
+	for docID := range coll.Documents {
+		mm.cache.Remove(collName + ":" + docID)
+	}
+	delete(mm.collections, collName)
+}
+
 // FindAll finds all documents matching a filter
-func (mm *MemoryManager) FindAll(collName string, filter map[string]interface{}, options *domain.PaginationOptions) (*domain.PaginationResult, error) {
+// The scan is abandoned with the context error once ctx is done.
+func (mm *MemoryManager) FindAll(ctx context.Context, collName string, filter map[string]interface{}, options *domain.PaginationOptions) (*domain.PaginationResult, error) {
 	mm.mu.RLock()
 	defer mm.mu.RUnlock()
 
@@ -150,12 +226,44 @@ func (mm *MemoryManager) FindAll(collName string, filter map[string]interface{},
 		}, nil
 	}
 
-	// Filter documents
+	// Filter documents, in insertion order if asked
 	var filteredDocs []domain.Document
-	for _, doc := range coll.Documents {
+	scanned := 0
+	keep := func(doc domain.Document) error {
+		if scanned%ctxCheckInterval == 0 {
+			if err := ctx.Err(); err != nil {
+				return fmt.Errorf("query aborted: %w", err)
+			}
+		}
+		scanned++
 		if mm.matchesFilter(doc, filter) {
 			filteredDocs = append(filteredDocs, doc)
+			return storage.CheckResultSize(len(filteredDocs), mm.engine.maxResultSize)
+		}
+		return nil
+	}
+	if options != nil && options.Order == domain.OrderInserted {
+		ids, err := mm.engine.insertionOrder.OrderedIDs(collName, coll.Documents)
+		if err != nil {
+			return nil, err
+		}
+		for _, docID := range ids {
+			if doc, exists := coll.Documents[docID]; exists {
+				if err := keep(doc); err != nil {
+					return nil, err
+				}
+			}
 		}
+	} else {
+		for _, doc := range coll.Documents {
+			if err := keep(doc); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if options != nil && options.SortField != "" {
+		storage.SortDocuments(filteredDocs, options.SortField, options.SortDesc, options.Collation)
 	}
 
 	// Apply pagination
@@ -201,23 +309,142 @@ func (mm *MemoryManager) FindAll(collName string, filter map[string]interface{},
 		}
 	}
 
-	return &domain.PaginationResult{
+	result := &domain.PaginationResult{
 		Documents:  filteredDocs,
 		Total:      int64(total),
 		HasNext:    end < total,
 		HasPrev:    offset > 0,
 		NextCursor: nextCursor,
 		PrevCursor: prevCursor,
-	}, nil
+	}
+	result.SetPage(offset, limit)
+	return result, nil
 }
 
-// FindAllStream finds all documents matching a filter and streams them
-func (mm *MemoryManager) FindAllStream(collName string, filter map[string]interface{}) (<-chan domain.Document, error) {
+// Facets tallies the values of fields across documents matching a filter into counts
+func (mm *MemoryManager) Facets(ctx context.Context, collName string, filter map[string]interface{}, fields []string, counts map[string]map[interface{}]int64) error {
+	mm.mu.RLock()
+	defer mm.mu.RUnlock()
+
+	coll, exists := mm.collections[collName]
+	if !exists {
+		return nil
+	}
+
+	scanned := 0
+	for _, doc := range coll.Documents {
+		if scanned%ctxCheckInterval == 0 {
+			if err := ctx.Err(); err != nil {
+				return fmt.Errorf("query aborted: %w", err)
+			}
+		}
+		scanned++
+		if mm.matchesFilter(doc, filter) {
+			storage.AddFacetCounts(counts, doc, fields)
+		}
+	}
+
+	return nil
+}
+
+// FindIds returns the IDs of documents matching a filter, in no particular order
+func (mm *MemoryManager) FindIds(ctx context.Context, collName string, filter map[string]interface{}) ([]string, error) {
+	mm.mu.RLock()
+	defer mm.mu.RUnlock()
+
+	coll, exists := mm.collections[collName]
+	if !exists {
+		return nil, nil
+	}
+
+	var ids []string
+	scanned := 0
+	for docID, doc := range coll.Documents {
+		if scanned%ctxCheckInterval == 0 {
+			if err := ctx.Err(); err != nil {
+				return nil, fmt.Errorf("query aborted: %w", err)
+			}
+		}
+		scanned++
+		if mm.matchesFilter(doc, filter) {
+			ids = append(ids, docID)
+		}
+	}
+
+	return ids, nil
+}
+
+// Sample offers documents matching a filter to sampler until it has enough
+func (mm *MemoryManager) Sample(ctx context.Context, collName string, filter map[string]interface{}, sampler *storage.Sampler) error {
+	mm.mu.RLock()
+	defer mm.mu.RUnlock()
+
+	coll, exists := mm.collections[collName]
+	if !exists {
+		return nil
+	}
+
+	scanned := 0
+	for _, doc := range coll.Documents {
+		if scanned%ctxCheckInterval == 0 {
+			if err := ctx.Err(); err != nil {
+				return fmt.Errorf("query aborted: %w", err)
+			}
+		}
+		scanned++
+		if !mm.matchesFilter(doc, filter) {
+			continue
+		}
+		if !sampler.Add(doc) {
+			break
+		}
+	}
+
+	return nil
+}
+
+// FindAllStream finds all documents matching a filter and streams them.
+// Streaming stops and the channel is closed once ctx is done. With snapshot reads
+// the documents are listed before streaming starts; writes store new document maps
+// instead of modifying stored ones, so the listed versions never change.
+func (mm *MemoryManager) FindAllStream(ctx context.Context, collName string, filter map[string]interface{}) (<-chan domain.Document, error) {
 	ch := make(chan domain.Document, 100) // Buffer for performance
 
+	var snapshot []domain.Document
+	if mm.engine.snapshotRead {
+		snapshot = mm.snapshotDocuments(collName)
+	}
+
 	go func() {
 		defer close(ch)
 
+		scanned := 0
+		send := func(doc domain.Document) bool {
+			if scanned%ctxCheckInterval == 0 && ctx.Err() != nil {
+				return false
+			}
+			scanned++
+			if mm.matchesFilter(doc, filter) {
+				select {
+				case ch <- doc:
+				case <-ctx.Done():
+					return false
+				case <-time.After(5 * time.Second):
+					return false // Timeout to prevent blocking
+				}
+			}
+			return true
+		}
+
+		if mm.engine.snapshotRead {
+			for _, doc := range snapshot {
+				if !send(doc) {
+					return
+				}
+			}
+			return
+		}
+
 		mm.mu.RLock()
 		coll, exists := mm.collections[collName]
 		mm.mu.RUnlock()
@@ -227,12 +454,8 @@ func (mm *MemoryManager) FindAllStream(collName string, filter map[string]interf
 		}
 
 		for _, doc := range coll.Documents {
-			if mm.matchesFilter(doc, filter) {
-				select {
-				case ch <- doc:
-				case <-time.After(5 * time.Second):
-					return // Timeout to prevent blocking
-				}
+			if !send(doc) {
+				return
 			}
 		}
 	}()
@@ -248,7 +471,7 @@ func (mm *MemoryManager) BatchUpdateDocuments(collName string, updates []domain.
 	// Get collection
 	coll, exists := mm.collections[collName]
 	if !exists {
-		return nil, fmt.Errorf("collection %s not found", collName)
+		return nil, domain.Errorf(domain.ErrCollectionNotFound, "collection %s not found", collName)
 	}
 
 	// Validate all operations first (atomic behavior)
@@ -260,7 +483,7 @@ func (mm *MemoryManager) BatchUpdateDocuments(collName string, updates []domain.
 		// Check if document exists
 		_, exists := coll.Documents[update.ID]
 		if !exists {
-			return nil, fmt.Errorf("operation %d: document with id %s not found", i, update.ID)
+			return nil, domain.Errorf(domain.ErrDocumentNotFound, "operation %d: document with id %s not found", i, update.ID)
 		}
 	}
 
@@ -304,6 +527,41 @@ func (mm *MemoryManager) GetAllDocuments(collName string) (map[string]interface{
 	return result, nil
 }
 
+// snapshotDocuments lists a collection's current documents under the read lock
+func (mm *MemoryManager) snapshotDocuments(collName string) []domain.Document {
+	mm.mu.RLock()
+	defer mm.mu.RUnlock()
+
+	coll, exists := mm.collections[collName]
+	if !exists {
+		return nil
+	}
+
+	docs := make([]domain.Document, 0, len(coll.Documents))
+	for _, doc := range coll.Documents {
+		docs = append(docs, doc)
+	}
+	return docs
+}
+
+// CopyDocuments returns deep copies of all documents in a collection, taken
+// under the read lock so the snapshot is consistent
+func (mm *MemoryManager) CopyDocuments(collName string) []domain.Document {
+	mm.mu.RLock()
+	defer mm.mu.RUnlock()
+
+	coll, exists := mm.collections[collName]
+	if !exists {
+		return nil
+	}
+
+	docs := make([]domain.Document, 0, len(coll.Documents))
+	for _, doc := range coll.Documents {
+		docs = append(docs, storage.CopyDocument(doc))
+	}
+	return docs
+}
+
 // GetMemoryStats returns memory usage statistics
 func (mm *MemoryManager) GetMemoryStats() map[string]interface{} {
 	mm.mu.RLock()
@@ -322,6 +580,46 @@ func (mm *MemoryManager) GetMemoryStats() map[string]interface{} {
 	}
 }
 
+// setMaxMemory changes the memory limit, shrinking the document cache when needed
+func (mm *MemoryManager) setMaxMemory(mb int) {
+	mm.mu.Lock()
+	defer mm.mu.Unlock()
+
+	mm.maxMemoryMB = mb
+	mm.cache.SetCapacity(storage.MaxMemoryCacheCapacity(mb))
+}
+
+// getMaxMemoryMB returns the current memory limit
+func (mm *MemoryManager) getMaxMemoryMB() int {
+	mm.mu.RLock()
+	defer mm.mu.RUnlock()
+	return mm.maxMemoryMB
+}
+
+// collectionMemoryUsage estimates the memory each collection holds, sorted by name
+func (mm *MemoryManager) collectionMemoryUsage() []domain.CollectionMemoryUsage {
+	cached := mm.cache.CountByCollection()
+
+	mm.mu.RLock()
+	defer mm.mu.RUnlock()
+
+	usage := make([]domain.CollectionMemoryUsage, 0, len(mm.collections))
+	for name, coll := range mm.collections {
+		entry := domain.CollectionMemoryUsage{
+			Name:       name,
+			Documents:  int64(len(coll.Documents)),
+			Resident:   true,
+			CachedDocs: cached[name],
+		}
+		for _, doc := range coll.Documents {
+			entry.EstimatedBytes += storage.EstimateDocumentSize(doc)
+		}
+		usage = append(usage, entry)
+	}
+	sort.Slice(usage, func(i, j int) bool { return usage[i].Name < usage[j].Name })
+	return usage
+}
+
 // Private methods
 
 func (mm *MemoryManager) getOrCreateCollection(collName string) (*Collection, error) {
@@ -345,10 +643,31 @@ func (mm *MemoryManager) matchesFilter(doc domain.Document, filter map[string]in
 		return true
 	}
 
+	filter = storage.ApplyCollation(filter)
 	for key, expectedValue := range filter {
+		// Expression predicates share the v1 evaluator
+		if key == storage.ExprFilterKey {
+			if !storage.MatchesFilter(doc, map[string]interface{}{key: expectedValue}) {
+				return false
+			}
+			continue
+		}
+
 		actualValue, exists := doc[key]
 		if !exists {
-			return false
+			// Dotted field paths share the v1 resolution
+			if !storage.MatchesFilter(doc, map[string]interface{}{key: expectedValue}) {
+				return false
+			}
+			continue
+		}
+
+		// Operators, schema-typed conditions and array fields share the v1 matching
+		if _, isArray := indexing.ArrayElements(actualValue); isArray || storage.IsFilterCondition(expectedValue) {
+			if !storage.MatchesFilter(doc, map[string]interface{}{key: expectedValue}) {
+				return false
+			}
+			continue
 		}
 
 		if actualValue != expectedValue {
@@ -387,8 +706,9 @@ func NewLRUCache(capacity int) *LRUCache {
 
 // Get retrieves a value from the cache
 func (c *LRUCache) Get(key string) (interface{}, bool) {
-	c.mu.RLock()
-	defer c.mu.RUnlock()
+	// Exclusive: a hit reorders the list
+	c.mu.Lock()
+	defer c.mu.Unlock()
 
 	entry, exists := c.cache[key]
 	if !exists {
@@ -447,6 +767,30 @@ func (c *LRUCache) Remove(key string) {
 	delete(c.cache, key)
 }
 
+// SetCapacity changes the number of entries the cache holds, evicting the least
+// recently used entries beyond it
+func (c *LRUCache) SetCapacity(capacity int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.capacity = capacity
+	for len(c.cache) > c.capacity {
+		c.evictLRU()
+	}
+}
+
+// CountByCollection returns the number of cached entries per collection
+func (c *LRUCache) CountByCollection() map[string]int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	counts := make(map[string]int)
+	for _, entry := range c.cache {
+		counts[entry.collection]++
+	}
+	return counts
+}
+
 // Size returns the current cache size
 func (c *LRUCache) Size() int {
 	c.mu.RLock()
@@ -496,6 +840,7 @@ func (c *LRUCache) evictLRU() {
 	}
 
 	// Remove tail (least recently used)
-	c.removeEntry(c.tail)
-	delete(c.cache, c.tail.key)
+	tail := c.tail
+	c.removeEntry(tail)
+	delete(c.cache, tail.key)
 }
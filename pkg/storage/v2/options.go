@@ -1,6 +1,11 @@
 package v2
 
-import "time"
+import (
+	"regexp"
+	"time"
+
+	"github.com/adfharrison1/go-db/pkg/storage"
+)
 
 // StorageOption configures the v2 storage engine
 type StorageOption func(*StorageEngine)
@@ -54,7 +59,8 @@ func WithMaxMemory(mb int) StorageOption {
 	}
 }
 
-// WithCheckpointInterval sets how often to perform checkpoints
+// WithCheckpointInterval sets the longest time between checkpoints while there are
+// writes to checkpoint; an idle engine does not checkpoint
 func WithCheckpointInterval(interval time.Duration) StorageOption {
 	return func(engine *StorageEngine) {
 		engine.checkpointInterval = interval
@@ -68,23 +74,137 @@ func WithDurabilityLevel(level DurabilityLevel) StorageOption {
 	}
 }
 
-// WithMaxWALSize sets the maximum WAL size before forced checkpoint
+// WithConsistencyLevel sets the read-after-write guarantee for document operations
+func WithConsistencyLevel(level ConsistencyLevel) StorageOption {
+	return func(engine *StorageEngine) {
+		engine.consistencyLevel = level
+	}
+}
+
+// WithCollectionNamePattern sets the allowed-character pattern for collection names.
+// Path separators, null bytes and reserved filesystem characters are always rejected.
+func WithCollectionNamePattern(pattern *regexp.Regexp) StorageOption {
+	return func(engine *StorageEngine) {
+		engine.collectionNamePattern = pattern
+	}
+}
+
+// WithMaxCollections limits how many collections can exist, including collections
+// created implicitly by inserts. Zero means unlimited.
+func WithMaxCollections(n int) StorageOption {
+	return func(engine *StorageEngine) {
+		engine.maxCollections = n
+	}
+}
+
+// WithMaxResultSize limits how many documents a FindAll may match before pagination
+// is applied. Queries matching more fail with domain.ErrResultTooLarge. Zero means unlimited.
+func WithMaxResultSize(n int) StorageOption {
+	return func(engine *StorageEngine) {
+		engine.maxResultSize = n
+	}
+}
+
+// WithMaxWALSize sets how many bytes may be appended to the WAL after a checkpoint
+// before the next one is forced. Zero or less disables the size trigger.
 func WithMaxWALSize(size int64) StorageOption {
 	return func(engine *StorageEngine) {
 		engine.maxWALSize = size
 	}
 }
 
-// WithCheckpointThreshold sets the minimum dirty pages before checkpoint
+// WithCheckpointThreshold sets how many WAL entries may be written after a checkpoint
+// before the next one is forced. Zero or less disables the entry trigger.
 func WithCheckpointThreshold(threshold int) StorageOption {
 	return func(engine *StorageEngine) {
 		engine.checkpointThreshold = threshold
 	}
 }
 
+// WithPerCollectionWAL gives each collection its own WAL files under
+// <walDir>/collections/<name>, so writes to different collections do not wait on
+// the same WAL lock or fsync. The default is a single WAL shared by all collections.
+func WithPerCollectionWAL(enabled bool) StorageOption {
+	return func(engine *StorageEngine) {
+		engine.perCollectionWAL = enabled
+	}
+}
+
 // WithCompression enables WAL entry compression
 func WithCompression(enabled bool) StorageOption {
 	return func(engine *StorageEngine) {
 		engine.compressionEnabled = enabled
 	}
 }
+
+// WithCopyOnRead makes GetById, FindAll, FindAllStream and Sample return deep copies
+// of stored documents, so embedding callers can modify results safely. Off by default
+// since copying allocates for every returned document.
+func WithCopyOnRead(enabled bool) StorageOption {
+	return func(engine *StorageEngine) {
+		engine.copyOnRead = enabled
+	}
+}
+
+// WithSnapshotRead makes FindAllStream list the collection's documents when the stream
+// starts and stream only those versions, so exports reflect a single moment despite
+// concurrent writes. V2 writes never modify stored documents in place, so the list is
+// the whole snapshot: about one pointer per document, held until the stream ends,
+// plus the old versions of documents replaced meanwhile.
+func WithSnapshotRead(enabled bool) StorageOption {
+	return func(engine *StorageEngine) {
+		engine.snapshotRead = enabled
+	}
+}
+
+// WithMaxConcurrentWrites bounds how many writes run at once on a single collection;
+// further writers queue until one finishes. Current in-flight and queued counts are
+// reported in concurrent_writes of the memory stats. Zero means unlimited.
+func WithMaxConcurrentWrites(n int) StorageOption {
+	return func(engine *StorageEngine) {
+		engine.writeLimiter = storage.NewWriteLimiter(n)
+	}
+}
+
+// WithPreloadCollections rebuilds the indexes of the named collections when
+// PreloadCollections is called at startup, several in parallel. Recovery already
+// holds every document in memory, so this warms the indexes rather than the data.
+// Until every listed collection has been attempted, PreloadProgress reports the
+// preload as not done.
+func WithPreloadCollections(collections []string) StorageOption {
+	return func(engine *StorageEngine) {
+		engine.preloader = storage.NewPreloader(collections)
+	}
+}
+
+// WithPinnedCollections pins the named collections (see PinCollection). V2 keeps
+// every document in memory, so this only marks them as pinned.
+func WithPinnedCollections(collections []string) StorageOption {
+	return func(engine *StorageEngine) {
+		for _, collName := range collections {
+			engine.pinned[collName] = true
+		}
+	}
+}
+
+// WithChangeLogSize sets how many recent changes each collection's change log retains
+// for GetChanges (default storage.DefaultChangeLogSize). Every write stores a copy of
+// the written document in the log. The log is not rebuilt from the WAL on recovery.
+// Zero turns the change log off.
+func WithChangeLogSize(n int) StorageOption {
+	return func(engine *StorageEngine) {
+		engine.changeLog = storage.NewChangeLog(n)
+	}
+}
+
+// WithInsertionOrder tracks the order documents are inserted into each collection, so
+// FindAll can return them in that order (domain.OrderInserted). The order is not
+// rebuilt from the WAL on recovery: recovered documents start in _id order.
+func WithInsertionOrder(enabled bool) StorageOption {
+	return func(engine *StorageEngine) {
+		engine.insertionOrder = nil
+		if enabled {
+			engine.insertionOrder = storage.NewInsertionOrder()
+		}
+	}
+}
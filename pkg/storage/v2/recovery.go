@@ -3,7 +3,7 @@ package v2
 import (
 	"fmt"
 	"log"
-	"sort"
+	"sync/atomic"
 	"time"
 
 	"github.com/adfharrison1/go-db/pkg/domain"
@@ -39,14 +39,26 @@ func (rm *RecoveryManager) Recover() error {
 			return fmt.Errorf("failed to restore from checkpoint: %w", err)
 		}
 		log.Printf("Restored from checkpoint at LSN %d", checkpoint.LSN)
+		// Only entries replayed after the checkpoint count toward the next one
+		atomic.StoreInt64(&rm.engine.checkpointMgr.lastCheckpointLSN, checkpoint.LSN)
 	}
 
 	// Replay WAL entries since checkpoint
-	if err := rm.replayWALEntries(checkpoint); err != nil {
+	replayed, err := rm.replayWALEntries(checkpoint)
+	if err != nil {
 		return fmt.Errorf("failed to replay WAL entries: %w", err)
 	}
+	rm.engine.updateStats(func(s *StorageStats) {
+		s.WALEntriesReplayed = replayed
+	})
+
+	// Restored and replayed documents go straight to memory; bring the indexes and
+	// document counts up to date with them
+	if err := rm.rebuildCollections(); err != nil {
+		return fmt.Errorf("failed to rebuild collections: %w", err)
+	}
 
-	log.Printf("Recovery completed in %v", time.Since(start))
+	log.Printf("Recovery completed in %v (%d WAL entries replayed)", time.Since(start), replayed)
 	return nil
 }
 
@@ -55,7 +67,7 @@ func (rm *RecoveryManager) restoreFromCheckpoint(checkpoint *CheckpointData) err
 	// Restore collections
 	for name, collData := range checkpoint.Collections {
 		// Create collection
-		if err := rm.engine.CreateCollection(name); err != nil {
+		if err := rm.engine.createCollection(name, false); err != nil {
 			return fmt.Errorf("failed to create collection %s: %w", name, err)
 		}
 
@@ -85,83 +97,109 @@ func (rm *RecoveryManager) restoreFromCheckpoint(checkpoint *CheckpointData) err
 			}
 		}
 
-		// Restore indexes
+		// Restore indexes. Creating the collection already added the _id index.
 		for _, indexName := range collData.Indexes {
+			if _, exists := rm.engine.indexEngine.GetIndex(name, indexName); exists {
+				continue
+			}
 			if err := rm.engine.indexEngine.CreateIndex(name, indexName); err != nil {
 				return fmt.Errorf("failed to restore index %s for collection %s: %w", indexName, name, err)
 			}
 		}
 	}
 
-	// Restore indexes from checkpoint
+	// Restore indexes from checkpoint. They hold placeholders until rebuildCollections
+	// rebuilds them from the documents once the WAL has been replayed.
 	if err := rm.engine.indexEngine.ImportIndexes(checkpoint.Indexes); err != nil {
 		return fmt.Errorf("failed to restore indexes: %w", err)
 	}
 
-	// Rebuild indexes with actual document data
-	for name, collData := range checkpoint.Collections {
-		// Create a domain.Collection for index rebuilding
-		collection := &domain.Collection{
-			Name:      name,
-			Documents: make(map[string]domain.Document),
-		}
+	return nil
+}
 
-		// Convert documents to domain.Document format
-		for docID, docData := range collData.Documents {
-			if doc, ok := docData.(map[string]interface{}); ok {
-				collection.Documents[docID] = domain.Document(doc)
-			}
-		}
+// rebuildCollections rebuilds every collection's indexes from its recovered documents
+// and recounts them
+func (rm *RecoveryManager) rebuildCollections() error {
+	rm.engine.collectionsMu.RLock()
+	names := make([]string, 0, len(rm.engine.collections))
+	for name := range rm.engine.collections {
+		names = append(names, name)
+	}
+	rm.engine.collectionsMu.RUnlock()
 
-		// Rebuild indexes for this collection
+	for _, name := range names {
+		collection, err := rm.engine.indexableCollection(name)
+		if err != nil {
+			return fmt.Errorf("failed to read collection %s: %w", name, err)
+		}
 		rm.engine.indexEngine.RebuildIndexForCollection(name, collection)
-	}
 
+		rm.engine.collectionsMu.Lock()
+		if collInfo, exists := rm.engine.collections[name]; exists {
+			collInfo.DocumentCount = int64(len(collection.Documents))
+		}
+		rm.engine.collectionsMu.Unlock()
+	}
 	return nil
 }
 
-// replayWALEntries replays WAL entries since the last checkpoint
-func (rm *RecoveryManager) replayWALEntries(checkpoint *CheckpointData) error {
+// replayWALEntries replays WAL entries since the last checkpoint and returns how many
+// were replayed
+func (rm *RecoveryManager) replayWALEntries(checkpoint *CheckpointData) (int64, error) {
 	// Get all WAL files
 	walFiles, err := rm.engine.walEngine.GetWALFiles()
 	if err != nil {
-		return fmt.Errorf("failed to get WAL files: %w", err)
+		return 0, fmt.Errorf("failed to get WAL files: %w", err)
 	}
 
 	if len(walFiles) == 0 {
-		return nil // No WAL files to replay
+		return 0, nil // No WAL files to replay
 	}
 
-	// Sort WAL files by name (which includes timestamp)
-	sort.Strings(walFiles)
-
-	// Determine starting LSN
+	// Determine starting LSN: the checkpoint holds every entry before the LSN it
+	// recorded, which is the next LSN that was going to be assigned
 	startLSN := int64(0)
 	if checkpoint != nil {
 		startLSN = checkpoint.LSN
 	}
 
-	// Replay entries from each WAL file
+	// Replay entries from each WAL file. Files are grouped by collection in creation
+	// order, which keeps each collection's entries in the order they were written.
+	nextLSN := startLSN
+	var replayed int64
 	for _, walFile := range walFiles {
-		if err := rm.replayWALFile(walFile, startLSN); err != nil {
-			return fmt.Errorf("failed to replay WAL file %s: %w", walFile, err)
+		maxLSN, count, err := rm.replayWALFile(walFile, startLSN)
+		if err != nil {
+			return 0, fmt.Errorf("failed to replay WAL file %s: %w", walFile, err)
 		}
+		if maxLSN+1 > nextLSN {
+			nextLSN = maxLSN + 1
+		}
+		replayed += count
 	}
 
-	return nil
+	// Continue numbering after the replayed entries
+	rm.engine.walEngine.advanceLSN(nextLSN)
+
+	return replayed, nil
 }
 
-// replayWALFile replays entries from a single WAL file
-func (rm *RecoveryManager) replayWALFile(filename string, startLSN int64) error {
+// replayWALFile replays entries from a single WAL file and returns the highest LSN in
+// it and the number of entries replayed
+func (rm *RecoveryManager) replayWALFile(filename string, startLSN int64) (int64, int64, error) {
 	entries, err := rm.engine.walEngine.ReadEntries(filename)
 	if err != nil {
-		return fmt.Errorf("failed to read WAL entries: %w", err)
+		return 0, 0, fmt.Errorf("failed to read WAL entries: %w", err)
 	}
 
 	// Filter entries by LSN
+	maxLSN := int64(-1)
 	var entriesToReplay []*WALEntry
 	for _, entry := range entries {
-		if entry.LSN > startLSN {
+		if entry.LSN > maxLSN {
+			maxLSN = entry.LSN
+		}
+		if entry.LSN >= startLSN {
 			entriesToReplay = append(entriesToReplay, entry)
 		}
 	}
@@ -169,11 +207,11 @@ func (rm *RecoveryManager) replayWALFile(filename string, startLSN int64) error
 	// Replay entries in order
 	for _, entry := range entriesToReplay {
 		if err := rm.replayWALEntry(entry); err != nil {
-			return fmt.Errorf("failed to replay WAL entry LSN %d: %w", entry.LSN, err)
+			return 0, 0, fmt.Errorf("failed to replay WAL entry LSN %d: %w", entry.LSN, err)
 		}
 	}
 
-	return nil
+	return maxLSN, int64(len(entriesToReplay)), nil
 }
 
 // replayWALEntry replays a single WAL entry
@@ -191,6 +229,11 @@ func (rm *RecoveryManager) replayWALEntry(entry *WALEntry) error {
 		return rm.replayBatchInsert(entry)
 	case WALEntryBatchUpdate:
 		return rm.replayBatchUpdate(entry)
+	case WALEntryMove:
+		return rm.replayMove(entry)
+	case WALEntryDropCollection:
+		rm.engine.dropCollection(entry.Collection)
+		return nil
 	case WALEntryCheckpoint:
 		// Checkpoint entries are handled separately
 		return nil
@@ -205,7 +248,7 @@ func (rm *RecoveryManager) replayWALEntry(entry *WALEntry) error {
 // replayInsert replays an insert operation
 func (rm *RecoveryManager) replayInsert(entry *WALEntry) error {
 	// Ensure collection exists
-	if err := rm.engine.CreateCollection(entry.Collection); err != nil {
+	if err := rm.engine.createCollection(entry.Collection, false); err != nil {
 		return fmt.Errorf("failed to create collection %s: %w", entry.Collection, err)
 	}
 
@@ -216,7 +259,7 @@ func (rm *RecoveryManager) replayInsert(entry *WALEntry) error {
 // replayUpdate replays an update operation
 func (rm *RecoveryManager) replayUpdate(entry *WALEntry) error {
 	// Ensure collection exists
-	if err := rm.engine.CreateCollection(entry.Collection); err != nil {
+	if err := rm.engine.createCollection(entry.Collection, false); err != nil {
 		return fmt.Errorf("failed to create collection %s: %w", entry.Collection, err)
 	}
 
@@ -237,7 +280,7 @@ func (rm *RecoveryManager) replayUpdate(entry *WALEntry) error {
 // replayReplace replays a replace operation
 func (rm *RecoveryManager) replayReplace(entry *WALEntry) error {
 	// Ensure collection exists
-	if err := rm.engine.CreateCollection(entry.Collection); err != nil {
+	if err := rm.engine.createCollection(entry.Collection, false); err != nil {
 		return fmt.Errorf("failed to create collection %s: %w", entry.Collection, err)
 	}
 
@@ -247,17 +290,28 @@ func (rm *RecoveryManager) replayReplace(entry *WALEntry) error {
 // replayDelete replays a delete operation
 func (rm *RecoveryManager) replayDelete(entry *WALEntry) error {
 	// Ensure collection exists
-	if err := rm.engine.CreateCollection(entry.Collection); err != nil {
+	if err := rm.engine.createCollection(entry.Collection, false); err != nil {
 		return fmt.Errorf("failed to create collection %s: %w", entry.Collection, err)
 	}
 
 	return rm.engine.memoryMgr.DeleteDocument(entry.Collection, entry.DocumentID)
 }
 
+// replayMove replays a move of a document between collections
+func (rm *RecoveryManager) replayMove(entry *WALEntry) error {
+	for _, collName := range []string{entry.Collection, entry.Target} {
+		if err := rm.engine.createCollection(collName, false); err != nil {
+			return fmt.Errorf("failed to create collection %s: %w", collName, err)
+		}
+	}
+
+	return rm.engine.memoryMgr.MoveDocument(entry.Collection, entry.DocumentID, entry.Target, entry.Document)
+}
+
 // replayBatchInsert replays a batch insert operation
 func (rm *RecoveryManager) replayBatchInsert(entry *WALEntry) error {
 	// Ensure collection exists
-	if err := rm.engine.CreateCollection(entry.Collection); err != nil {
+	if err := rm.engine.createCollection(entry.Collection, false); err != nil {
 		return fmt.Errorf("failed to create collection %s: %w", entry.Collection, err)
 	}
 
@@ -280,7 +334,7 @@ func (rm *RecoveryManager) replayBatchInsert(entry *WALEntry) error {
 // replayBatchUpdate replays a batch update operation
 func (rm *RecoveryManager) replayBatchUpdate(entry *WALEntry) error {
 	// Ensure collection exists
-	if err := rm.engine.CreateCollection(entry.Collection); err != nil {
+	if err := rm.engine.createCollection(entry.Collection, false); err != nil {
 		return fmt.Errorf("failed to create collection %s: %w", entry.Collection, err)
 	}
 
@@ -294,7 +348,8 @@ func (rm *RecoveryManager) GetRecoveryStats() map[string]interface{} {
 	defer rm.engine.statsMu.RUnlock()
 
 	return map[string]interface{}{
-		"recovery_time_ms": rm.engine.stats.RecoveryTime.Milliseconds(),
-		"last_checkpoint":  rm.engine.stats.LastCheckpoint,
+		"recovery_time_ms":     rm.engine.stats.RecoveryTime.Milliseconds(),
+		"wal_entries_replayed": rm.engine.stats.WALEntriesReplayed,
+		"last_checkpoint":      rm.engine.stats.LastCheckpoint,
 	}
 }
@@ -1,12 +1,15 @@
 package v2
 
 import (
+	"context"
 	"os"
+	"regexp"
 	"sync"
 	"time"
 
 	"github.com/adfharrison1/go-db/pkg/domain"
 	"github.com/adfharrison1/go-db/pkg/indexing"
+	"github.com/adfharrison1/go-db/pkg/storage"
 )
 
 // DurabilityLevel represents the level of durability guarantee
@@ -19,6 +22,48 @@ const (
 	DurabilityFull                          // Full durability with fsync
 )
 
+type writeDurabilityKey struct{}
+
+// WithWriteDurability returns a context asking the engine to apply level to the WAL
+// entries of writes made with it, in place of the engine's durability level, e.g.
+// DurabilityFull for a critical insert on an engine running at DurabilityOS, or
+// DurabilityOS for a bulk load on one running at DurabilityFull. It is honoured by
+// the ...Context write methods. A ctx that is also from domain.WithDurableWrite is
+// fsynced whatever the level, and a level outside the defined ones is ignored.
+func WithWriteDurability(ctx context.Context, level DurabilityLevel) context.Context {
+	return context.WithValue(ctx, writeDurabilityKey{}, level)
+}
+
+// writeDurability is the durability a write asks of its WAL entry. The zero value
+// applies the WAL's durability level.
+type writeDurability struct {
+	durable  bool            // From domain.WithDurableWrite: fsynced whatever the level
+	level    DurabilityLevel // Applied in place of the WAL's level when hasLevel is set
+	hasLevel bool
+}
+
+// durabilityOf returns the durability the writes made with ctx ask for
+func durabilityOf(ctx context.Context) writeDurability {
+	level, hasLevel := ctx.Value(writeDurabilityKey{}).(DurabilityLevel)
+	if level < DurabilityNone || level > DurabilityFull {
+		hasLevel = false
+	}
+	return writeDurability{durable: domain.DurableWrite(ctx), level: level, hasLevel: hasLevel}
+}
+
+// ConsistencyLevel represents the read-after-write guarantee for document operations
+type ConsistencyLevel int
+
+const (
+	// ConsistencyReadYourWrites applies every write to the in-memory collection and cache
+	// synchronously before the write call returns, so a subsequent GetById observes it (default)
+	ConsistencyReadYourWrites ConsistencyLevel = iota
+	// ConsistencyLinearizable additionally serializes reads of a document with its writes.
+	// Writes to the same document are serialized at every level, so concurrent
+	// read-modify-write updates never interleave and lose each other's changes
+	ConsistencyLinearizable
+)
+
 // WALEntryType represents the type of WAL entry
 type WALEntryType uint8
 
@@ -31,6 +76,8 @@ const (
 	WALEntryBatchUpdate
 	WALEntryCheckpoint
 	WALEntryCommit
+	WALEntryMove
+	WALEntryDropCollection
 )
 
 // WALEntry represents a single entry in the write-ahead log
@@ -39,11 +86,14 @@ type WALEntry struct {
 	Timestamp  int64                         `json:"timestamp"`
 	Collection string                        `json:"collection"`
 	DocumentID string                        `json:"document_id,omitempty"`
+	Target     string                        `json:"target,omitempty"` // Destination collection of a move
 	Document   domain.Document               `json:"document,omitempty"`
 	Updates    domain.Document               `json:"updates,omitempty"`
 	BatchOps   []domain.BatchUpdateOperation `json:"batch_ops,omitempty"`
 	LSN        int64                         `json:"lsn"` // Log Sequence Number
 	Checksum   uint32                        `json:"checksum"`
+
+	durability writeDurability // Durability asked for by the write; not logged
 }
 
 // CollectionState represents the state of a collection
@@ -56,6 +106,22 @@ const (
 	CollectionStateDirty
 )
 
+// String returns the state's name, as reported by ListCollections
+func (s CollectionState) String() string {
+	switch s {
+	case CollectionStateUnloaded:
+		return "unloaded"
+	case CollectionStateLoading:
+		return "loading"
+	case CollectionStateLoaded:
+		return "loaded"
+	case CollectionStateDirty:
+		return "dirty"
+	default:
+		return "unknown"
+	}
+}
+
 // CollectionInfo holds metadata about a collection
 type CollectionInfo struct {
 	Name          string
@@ -75,6 +141,10 @@ type StorageEngine struct {
 	memoryMgr     *MemoryManager
 	indexEngine   *indexing.IndexEngine
 
+	// Held shared by writes from their WAL append until memory and indexes reflect it,
+	// and exclusively by checkpoints while they read the WAL position
+	applyMu sync.RWMutex
+
 	// Configuration
 	walDir              string
 	dataDir             string
@@ -82,9 +152,26 @@ type StorageEngine struct {
 	maxMemoryMB         int
 	checkpointInterval  time.Duration
 	durabilityLevel     DurabilityLevel
+	consistencyLevel    ConsistencyLevel
 	maxWALSize          int64
 	checkpointThreshold int
 	compressionEnabled  bool
+	perCollectionWAL    bool
+
+	// Allowed-character pattern for collection names (nil = storage.DefaultCollectionNamePattern)
+	collectionNamePattern *regexp.Regexp
+
+	// Maximum number of collections (0 = unlimited)
+	maxCollections int
+
+	// Maximum number of documents a FindAll may match before pagination (0 = unlimited)
+	maxResultSize int
+
+	// Return deep copies of stored documents from reads
+	copyOnRead bool
+
+	// Streams read the documents listed when they start
+	snapshotRead bool
 
 	// Cleanup configuration
 	walRetentionCount        int           // Keep N most recent WAL files
@@ -108,6 +195,61 @@ type StorageEngine struct {
 	idCounter    int64
 	idCounters   map[string]*int64
 	idCountersMu sync.Mutex
+
+	// Per-document locks serializing writes ("collection:docID" -> lock), kept only
+	// while some caller holds or waits for them
+	documentLocks map[string]*documentLock
+	docLocksMu    sync.Mutex
+
+	// Per-collection locks serializing InsertIfNotExists checks with their inserts
+	conditionalInsertLocks map[string]*sync.Mutex
+	conditionalInsertMu    sync.Mutex
+
+	// Per-collection locks held by writes while they check and store unique index keys
+	uniqueKeyLocks map[string]*sync.RWMutex
+	uniqueKeyMu    sync.Mutex
+
+	// Collections pinned with PinCollection, reported by CollectionMemoryUsage
+	pinned   map[string]bool
+	pinnedMu sync.RWMutex
+
+	// Per-collection counts of lock holders and waiters, for LockStats
+	lockStats      map[string]*collectionLockCounters
+	lockCountersMu sync.Mutex
+
+	// Serializes MoveDocument calls, so a document cannot be moved twice at once
+	moveMu sync.Mutex
+
+	// Per-collection default filters ANDed into queries (in memory only)
+	defaultFilters   map[string]map[string]interface{}
+	defaultFiltersMu sync.RWMutex
+
+	// Per-collection field defaults applied on insert (in memory only)
+	documentDefaults   map[string]domain.Document
+	documentDefaultsMu sync.RWMutex
+
+	// Per-collection field type hints used by filters, and which of them are strict (in memory only)
+	schemas       map[string]map[string]domain.FieldType
+	strictSchemas map[string]bool
+	schemasMu     sync.RWMutex
+
+	// Per-collection caps with their eviction order (in memory only)
+	capped   map[string]*storage.CappedTracker
+	cappedMu sync.RWMutex
+	// Sorted document IDs for next/previous navigation, built on first use
+	idKeysets *storage.IDKeysets
+
+	// Per-collection bound on concurrent writes (nil = unlimited)
+	writeLimiter *storage.WriteLimiter
+
+	// Collections whose indexes are rebuilt eagerly at startup (nil = none)
+	preloader *storage.Preloader
+
+	// Recent writes per collection for polling clients (nil = disabled)
+	changeLog *storage.ChangeLog
+
+	// Document IDs per collection in insertion order (nil = not tracked)
+	insertionOrder *storage.InsertionOrder
 }
 
 // StorageStats holds performance and health statistics
@@ -116,9 +258,11 @@ type StorageStats struct {
 	WALBytesWritten      int64
 	CheckpointsPerformed int64
 	RecoveryTime         time.Duration
+	WALEntriesReplayed   int64 // WAL entries replayed after the checkpoint by the last recovery
 	MemoryUsageMB        int64
 	CollectionCount      int64
 	LastCheckpoint       time.Time
+	LastCheckpointBytes  int64 // Size of the last checkpoint file written
 }
 
 // WALEngine manages the write-ahead log
@@ -129,6 +273,22 @@ type WALEngine struct {
 	currentLSN         int64
 	walFile            *WALFile
 	mu                 sync.RWMutex
+
+	// Per-collection mode: each collection writes walDir/collections/<name>/wal_*.log
+	perCollection  bool
+	collectionWALs map[string]*collectionWAL
+
+	// Total bytes appended since startup, read atomically
+	bytesWritten int64
+
+	// Called after each successful append; must not block
+	onAppend func()
+}
+
+// collectionWAL is one collection's WAL file in per-collection mode
+type collectionWAL struct {
+	walFile *WALFile
+	mu      sync.Mutex
 }
 
 // WALFile represents an open WAL file
@@ -147,6 +307,13 @@ type CheckpointManager struct {
 	maxWALSize     int64
 	lastCheckpoint time.Time
 	mu             sync.RWMutex
+
+	// WAL position at the last checkpoint, read atomically by the write path
+	lastCheckpointLSN   int64
+	lastCheckpointBytes int64
+
+	// Signalled by WAL appends once a volume trigger is reached
+	trigger chan struct{}
 }
 
 // RecoveryManager handles startup recovery
@@ -188,3 +355,11 @@ type Collection struct {
 	Documents map[string]domain.Document
 	CreatedAt time.Time
 }
+
+// documentLock serializes the writes of one document. refs counts the callers holding or
+// waiting for it, so the lock can be removed from StorageEngine.documentLocks once the
+// last of them unlocks (guarded by docLocksMu).
+type documentLock struct {
+	sync.Mutex
+	refs int
+}
@@ -7,7 +7,11 @@ import (
 	"hash/crc32"
 	"os"
 	"path/filepath"
+	"sort"
+	"sync/atomic"
 	"time"
+
+	"github.com/adfharrison1/go-db/pkg/domain"
 )
 
 // NewWALEngine creates a new WAL engine
@@ -22,12 +26,15 @@ func NewWALEngine(walDir string, durabilityLevel DurabilityLevel, compressionEna
 
 // WriteEntry writes a WAL entry to the log
 func (w *WALEngine) WriteEntry(entry *WALEntry) error {
+	if w.perCollection {
+		return w.writeCollectionEntry(entry)
+	}
+
 	w.mu.Lock()
 	defer w.mu.Unlock()
 
 	// Assign LSN
-	entry.LSN = w.currentLSN
-	w.currentLSN++
+	entry.LSN = atomic.AddInt64(&w.currentLSN, 1) - 1
 
 	// Calculate checksum
 	entry.Checksum = w.calculateChecksum(entry)
@@ -49,10 +56,11 @@ func (w *WALEngine) WriteEntry(entry *WALEntry) error {
 	}
 
 	// Apply durability guarantees
-	if err := w.applyDurability(); err != nil {
+	if err := w.syncEntry(w.walFile, entry); err != nil {
 		return fmt.Errorf("failed to apply durability: %w", err)
 	}
 
+	w.noteAppend(len(data))
 	return nil
 }
 
@@ -93,11 +101,88 @@ func (w *WALEngine) ReadEntries(filename string) ([]*WALEntry, error) {
 	return entries, nil
 }
 
+// writeCollectionEntry writes an entry to its collection's WAL file. Only writers
+// to the same collection wait on each other; LSNs stay global so checkpoints and
+// recovery compare them across files.
+func (w *WALEngine) writeCollectionEntry(entry *WALEntry) error {
+	cw := w.getCollectionWAL(entry.Collection)
+	cw.mu.Lock()
+	defer cw.mu.Unlock()
+
+	// Assigned under the collection lock so LSNs increase within each file
+	entry.LSN = atomic.AddInt64(&w.currentLSN, 1) - 1
+	entry.Checksum = w.calculateChecksum(entry)
+
+	if cw.walFile == nil {
+		walFile, err := openWALFile(w.collectionWALDir(entry.Collection))
+		if err != nil {
+			return fmt.Errorf("failed to ensure WAL file: %w", err)
+		}
+		cw.walFile = walFile
+	}
+
+	data, err := w.serializeEntry(entry)
+	if err != nil {
+		return fmt.Errorf("failed to serialize WAL entry: %w", err)
+	}
+	if err := writeToFile(cw.walFile, data); err != nil {
+		return fmt.Errorf("failed to write to WAL file: %w", err)
+	}
+	if err := w.syncEntry(cw.walFile, entry); err != nil {
+		return fmt.Errorf("failed to apply durability: %w", err)
+	}
+	w.noteAppend(len(data))
+	return nil
+}
+
+// noteAppend records an appended entry of n bytes and notifies onAppend
+func (w *WALEngine) noteAppend(n int) {
+	atomic.AddInt64(&w.bytesWritten, int64(n))
+	if w.onAppend != nil {
+		w.onAppend()
+	}
+}
+
+// GetBytesWritten returns the number of bytes appended to the WAL since startup
+func (w *WALEngine) GetBytesWritten() int64 {
+	return atomic.LoadInt64(&w.bytesWritten)
+}
+
+// getCollectionWAL returns the per-collection WAL state, creating it on first use
+func (w *WALEngine) getCollectionWAL(collName string) *collectionWAL {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.collectionWALs == nil {
+		w.collectionWALs = make(map[string]*collectionWAL)
+	}
+	cw, exists := w.collectionWALs[collName]
+	if !exists {
+		cw = &collectionWAL{}
+		w.collectionWALs[collName] = cw
+	}
+	return cw
+}
+
+// collectionWALDir returns the directory holding a collection's WAL files
+func (w *WALEngine) collectionWALDir(collName string) string {
+	return filepath.Join(w.walDir, "collections", collName)
+}
+
 // GetCurrentLSN returns the current log sequence number
 func (w *WALEngine) GetCurrentLSN() int64 {
-	w.mu.RLock()
-	defer w.mu.RUnlock()
-	return w.currentLSN
+	return atomic.LoadInt64(&w.currentLSN)
+}
+
+// advanceLSN makes sure the next LSN assigned is at least lsn, so entries written
+// after recovery sort after the ones that were replayed
+func (w *WALEngine) advanceLSN(lsn int64) {
+	for {
+		current := atomic.LoadInt64(&w.currentLSN)
+		if current >= lsn || atomic.CompareAndSwapInt64(&w.currentLSN, current, lsn) {
+			return
+		}
+	}
 }
 
 // Close closes the WAL engine
@@ -105,10 +190,30 @@ func (w *WALEngine) Close() error {
 	w.mu.Lock()
 	defer w.mu.Unlock()
 
+	var closeErr error
 	if w.walFile != nil {
-		return w.walFile.File.Close()
+		closeErr = w.walFile.File.Close()
 	}
-	return nil
+	if err := w.closeCollectionWALs(); err != nil && closeErr == nil {
+		closeErr = err
+	}
+	return closeErr
+}
+
+// closeCollectionWALs closes every open per-collection WAL file (caller must hold w.mu)
+func (w *WALEngine) closeCollectionWALs() error {
+	var closeErr error
+	for _, cw := range w.collectionWALs {
+		cw.mu.Lock()
+		if cw.walFile != nil {
+			if err := cw.walFile.File.Close(); err != nil && closeErr == nil {
+				closeErr = err
+			}
+			cw.walFile = nil
+		}
+		cw.mu.Unlock()
+	}
+	return closeErr
 }
 
 // Private methods
@@ -118,43 +223,80 @@ func (w *WALEngine) ensureWALFile() error {
 		return nil
 	}
 
+	walFile, err := openWALFile(w.walDir)
+	if err != nil {
+		return err
+	}
+	w.walFile = walFile
+
+	return nil
+}
+
+// openWALFile opens a new timestamped WAL file in dir
+func openWALFile(dir string) (*WALFile, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create WAL directory: %w", err)
+	}
+
 	// Create WAL filename with timestamp
 	filename := fmt.Sprintf("wal_%d.log", time.Now().Unix())
-	filepath := filepath.Join(w.walDir, filename)
+	path := filepath.Join(dir, filename)
 
-	file, err := os.OpenFile(filepath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
 	if err != nil {
-		return fmt.Errorf("failed to create WAL file: %w", err)
+		return nil, fmt.Errorf("failed to create WAL file: %w", err)
 	}
 
-	w.walFile = &WALFile{
-		Path:     filepath,
+	return &WALFile{
+		Path:     path,
 		File:     file,
 		Position: 0,
 		Entries:  0,
-	}
-
-	return nil
+	}, nil
 }
 
 func (w *WALEngine) writeToWALFile(data []byte) error {
 	if w.walFile == nil {
 		return fmt.Errorf("WAL file not initialized")
 	}
+	return writeToFile(w.walFile, data)
+}
 
-	n, err := w.walFile.File.Write(data)
+func writeToFile(walFile *WALFile, data []byte) error {
+	n, err := walFile.File.Write(data)
 	if err != nil {
 		return fmt.Errorf("failed to write to WAL file: %w", err)
 	}
 
-	w.walFile.Position += int64(n)
-	w.walFile.Entries++
+	walFile.Position += int64(n)
+	walFile.Entries++
 
 	return nil
 }
 
 func (w *WALEngine) applyDurability() error {
-	switch w.durabilityLevel {
+	return w.syncWALFile(w.walFile, w.durabilityLevel)
+}
+
+// syncEntry applies the durability level to the file an entry was just written to:
+// the level the entry's write asked for, if any, otherwise the WAL's. A durable entry
+// is fsynced whatever the level.
+func (w *WALEngine) syncEntry(walFile *WALFile, entry *WALEntry) error {
+	level := w.durabilityLevel
+	if entry.durability.hasLevel {
+		level = entry.durability.level
+	}
+	if entry.durability.durable && level != DurabilityFull {
+		if err := walFile.File.Sync(); err != nil {
+			return domain.Errorf(domain.ErrNotDurable, "failed to sync WAL file: %v", err)
+		}
+		return nil
+	}
+	return w.syncWALFile(walFile, level)
+}
+
+func (w *WALEngine) syncWALFile(walFile *WALFile, level DurabilityLevel) error {
+	switch level {
 	case DurabilityNone:
 		// No durability guarantees
 		return nil
@@ -167,9 +309,9 @@ func (w *WALEngine) applyDurability() error {
 		return nil
 	case DurabilityFull:
 		// Full durability with fsync - force data to disk
-		return w.walFile.File.Sync()
+		return walFile.File.Sync()
 	default:
-		return fmt.Errorf("unknown durability level: %d", w.durabilityLevel)
+		return fmt.Errorf("unknown durability level: %d", level)
 	}
 }
 
@@ -209,20 +351,34 @@ func (w *WALEngine) verifyChecksum(entry *WALEntry) bool {
 	return entry.Checksum == expectedChecksum
 }
 
-// GetWALFiles returns a list of WAL files in the WAL directory
+// GetWALFiles returns a list of WAL files in the WAL directory, including
+// per-collection WAL files. Files of the shared WAL come first, then each
+// collection's files; within a directory files are in the order they were created.
 func (w *WALEngine) GetWALFiles() ([]string, error) {
 	files, err := filepath.Glob(filepath.Join(w.walDir, "wal_*.log"))
 	if err != nil {
 		return nil, fmt.Errorf("failed to list WAL files: %w", err)
 	}
-	return files, nil
+	collectionFiles, err := filepath.Glob(filepath.Join(w.walDir, "collections", "*", "wal_*.log"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list WAL files: %w", err)
+	}
+	sort.Strings(files)
+	sort.Strings(collectionFiles)
+	return append(files, collectionFiles...), nil
 }
 
-// RotateWALFile creates a new WAL file and closes the current one
+// RotateWALFile creates a new WAL file and closes the current one.
+// With per-collection WALs every collection file is closed and a new one is
+// opened on the collection's next write.
 func (w *WALEngine) RotateWALFile() error {
 	w.mu.Lock()
 	defer w.mu.Unlock()
 
+	if w.perCollection {
+		return w.closeCollectionWALs()
+	}
+
 	if w.walFile != nil {
 		if err := w.walFile.File.Close(); err != nil {
 			return fmt.Errorf("failed to close current WAL file: %w", err)
@@ -0,0 +1,170 @@
+package storage
+
+import (
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/adfharrison1/go-db/pkg/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStorageEngine_DocumentVersions(t *testing.T) {
+	engine := NewStorageEngine(WithNoSaves(true), WithDocumentVersions(true))
+	defer engine.StopBackgroundWorkers()
+
+	// Client-supplied versions are ignored
+	doc, err := engine.Insert("users", domain.Document{"name": "Alice", VersionField: 9})
+	require.NoError(t, err)
+	docID := doc["_id"].(string)
+	assert.EqualValues(t, 1, doc[VersionField])
+
+	writes := []func() error{
+		func() error {
+			_, err := engine.UpdateById("users", docID, domain.Document{"age": 30, VersionField: 9})
+			return err
+		},
+		func() error {
+			_, err := engine.UpdateById("users", docID, domain.Document{IncKey: map[string]interface{}{"age": 1}})
+			return err
+		},
+		func() error {
+			_, err := engine.ReplaceById("users", docID, domain.Document{"name": "Alicia", VersionField: 9})
+			return err
+		},
+		func() error {
+			_, err := engine.BatchUpdate("users", []domain.BatchUpdateOperation{{ID: docID, Updates: domain.Document{"age": 40}}})
+			return err
+		},
+		func() error {
+			_, err := engine.UpdateMany("users", map[string]interface{}{"name": "Alicia"}, domain.Document{"age": 41})
+			return err
+		},
+		func() error {
+			_, _, err := engine.Upsert("users", map[string]interface{}{"name": "Alicia"}, domain.Document{"age": 42})
+			return err
+		},
+		func() error {
+			_, _, err := engine.UpsertById("users", docID, domain.Document{"age": 43})
+			return err
+		},
+		func() error {
+			_, err := engine.CompareAndSetField("users", docID, "age", 43, 44)
+			return err
+		},
+	}
+	for i, write := range writes {
+		require.NoError(t, write())
+		doc, err := engine.GetById("users", docID)
+		require.NoError(t, err)
+		assert.EqualValues(t, i+2, doc[VersionField], "after write %d", i)
+	}
+
+	batch, err := engine.BatchInsert("users", []domain.Document{{"name": "Bob"}, {"name": "Carol", VersionField: 5}})
+	require.NoError(t, err)
+	for _, doc := range batch {
+		assert.EqualValues(t, 1, doc[VersionField])
+	}
+
+	// Strict schemas allow the version field
+	engine.SetCollectionSchema("strict", map[string]domain.FieldType{"name": domain.FieldTypeAny})
+	engine.SetCollectionSchemaStrict("strict", true)
+	_, err = engine.Insert("strict", domain.Document{"name": "Dave"})
+	require.NoError(t, err)
+	_, err = engine.UpdateById("strict", "1", domain.Document{"name": "David"})
+	require.NoError(t, err)
+}
+
+func TestStorageEngine_DocumentVersionsDisabledByDefault(t *testing.T) {
+	engine := NewStorageEngine(WithNoSaves(true))
+	defer engine.StopBackgroundWorkers()
+
+	doc, err := engine.Insert("users", domain.Document{"name": "Alice"})
+	require.NoError(t, err)
+	assert.NotContains(t, doc, VersionField)
+	assert.False(t, engine.DocumentVersionsEnabled())
+
+	_, err = engine.UpdateByIdIfVersion("users", "1", 0, domain.Document{"age": 30})
+	assert.ErrorIs(t, err, domain.ErrVersionsDisabled)
+}
+
+func TestStorageEngine_UpdateByIdIfVersion(t *testing.T) {
+	engine := NewStorageEngine(WithNoSaves(true), WithDocumentVersions(true))
+	defer engine.StopBackgroundWorkers()
+
+	_, err := engine.Insert("users", domain.Document{"name": "Alice", "age": 30})
+	require.NoError(t, err)
+
+	doc, err := engine.UpdateByIdIfVersion("users", "1", 1, domain.Document{"age": 31})
+	require.NoError(t, err)
+	assert.EqualValues(t, 2, doc[VersionField])
+	assert.Equal(t, 31, doc["age"])
+
+	// A stale version is a conflict and changes nothing
+	_, err = engine.UpdateByIdIfVersion("users", "1", 1, domain.Document{"age": 99})
+	assert.ErrorIs(t, err, domain.ErrVersionConflict)
+	doc, err = engine.GetById("users", "1")
+	require.NoError(t, err)
+	assert.Equal(t, 31, doc["age"])
+	assert.EqualValues(t, 2, doc[VersionField])
+
+	_, err = engine.UpdateByIdIfVersion("users", "missing", 1, domain.Document{"age": 1})
+	assert.ErrorIs(t, err, domain.ErrDocumentNotFound)
+
+	// Of several writers that read the same version, exactly one succeeds
+	var wg sync.WaitGroup
+	var succeeded, conflicted int32
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := engine.UpdateByIdIfVersion("users", "1", 2, domain.Document{IncKey: map[string]interface{}{"age": 1}})
+			switch {
+			case err == nil:
+				atomic.AddInt32(&succeeded, 1)
+			case assert.ErrorIs(t, err, domain.ErrVersionConflict):
+				atomic.AddInt32(&conflicted, 1)
+			}
+		}()
+	}
+	wg.Wait()
+	assert.EqualValues(t, 1, succeeded)
+	assert.EqualValues(t, 19, conflicted)
+	doc, err = engine.GetById("users", "1")
+	require.NoError(t, err)
+	assert.EqualValues(t, 32, doc["age"])
+	assert.EqualValues(t, 3, doc[VersionField])
+}
+
+func TestStorageEngine_DocumentVersions_Persist(t *testing.T) {
+	for name, options := range map[string][]StorageOption{
+		"DocumentSaves": nil,
+		"DeltaLog":      {WithDeltaLog(true)},
+	} {
+		t.Run(name, func(t *testing.T) {
+			tempDir := t.TempDir()
+			options := append([]StorageOption{WithDataDir(tempDir), WithDocumentVersions(true)}, options...)
+			engine := NewStorageEngine(options...)
+			defer engine.StopBackgroundWorkers()
+
+			_, err := engine.Insert("users", domain.Document{"name": "Alice"})
+			require.NoError(t, err)
+			_, err = engine.UpdateById("users", "1", domain.Document{"age": 30})
+			require.NoError(t, err)
+			_, err = engine.UpdateById("users", "1", domain.Document{"age": 31})
+			require.NoError(t, err)
+
+			reloaded := NewStorageEngine(options...)
+			defer reloaded.StopBackgroundWorkers()
+			require.NoError(t, reloaded.LoadCollectionMetadata(filepath.Join(tempDir, "missing.godb")))
+
+			doc, err := reloaded.GetById("users", "1")
+			require.NoError(t, err)
+			assert.EqualValues(t, 3, doc[VersionField])
+			_, err = reloaded.UpdateByIdIfVersion("users", "1", 3, domain.Document{"age": 32})
+			require.NoError(t, err)
+		})
+	}
+}
@@ -0,0 +1,175 @@
+package storage
+
+import (
+	"context"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/adfharrison1/go-db/pkg/domain"
+)
+
+// writeBuffer coalesces the immediate document saves of the dual-write path: saves to
+// one collection within the window are written together in one collection file rewrite
+type writeBuffer struct {
+	window  time.Duration // 0 = every save is written at once
+	mu      sync.Mutex
+	batches map[string]*writeBatch // Collection -> batch waiting for its window to end
+
+	buffered int64 // Document saves added to a batch
+	flushes  int64 // Batches written
+}
+
+// writeBatch is the documents of one collection waiting to be saved together. done is
+// closed once they are written, or once a whole-collection save made writing them
+// unnecessary, with err the outcome.
+type writeBatch struct {
+	docs map[string]domain.Document
+	done chan struct{}
+	err  error
+}
+
+// WithWriteCoalescing makes dual-write saves of single documents wait up to window
+// so that saves to the same collection in that time are written in one collection
+// file rewrite instead of one each. A write returns once its save is buffered; a
+// durable write (domain.WithDurableWrite) waits for the rewrite. A failed rewrite is
+// queued for background retry. 0, the default, writes every save at once. Only
+// applies to the per-collection layout.
+func WithWriteCoalescing(window time.Duration) StorageOption {
+	return func(engine *StorageEngine) {
+		engine.writeBuffer.window = window
+	}
+}
+
+// saveDocument saves one document in dual-write mode, through the write buffer when
+// coalescing is on. The error is that of saveDocumentToDisk; for a buffered non-durable
+// save it is always nil, as the flush itself queues a failed rewrite for retry.
+func (se *StorageEngine) saveDocument(ctx context.Context, collName, docID string, doc domain.Document) error {
+	if se.writeBuffer.window <= 0 || se.layout == LayoutSingleFile {
+		return se.saveDocumentToDisk(collName, docID, doc)
+	}
+
+	se.mu.RLock()
+	_, exists := se.collections[collName]
+	se.mu.RUnlock()
+	if !exists {
+		return domain.Errorf(domain.ErrCollectionNotFound, "collection %s does not exist", collName)
+	}
+
+	b := &se.writeBuffer
+	b.mu.Lock()
+	batch := b.batches[collName]
+	if batch == nil {
+		batch = &writeBatch{docs: make(map[string]domain.Document), done: make(chan struct{})}
+		if b.batches == nil {
+			b.batches = make(map[string]*writeBatch)
+		}
+		b.batches[collName] = batch
+		time.AfterFunc(b.window, func() { se.flushWriteBatch(collName, batch) })
+	}
+	batch.docs[docID] = doc
+	b.mu.Unlock()
+	atomic.AddInt64(&b.buffered, 1)
+
+	if !domain.DurableWrite(ctx) {
+		return nil
+	}
+	<-batch.done
+	return batch.err
+}
+
+// flushWriteBatch writes a collection's batch once its window ends, unless a
+// whole-collection save already took it. The batch is detached under the delta lock,
+// so a whole-collection save of the same collection, which reflects every buffered
+// document, is never followed by this older rewrite.
+func (se *StorageEngine) flushWriteBatch(collName string, batch *writeBatch) {
+	deltaLock := se.deltaLock(collName)
+	deltaLock.Lock()
+	defer deltaLock.Unlock()
+
+	if !se.detachWriteBatch(collName, batch) {
+		return
+	}
+
+	err := se.saveDocumentsToDiskLocked(collName, batch.docs)
+	atomic.AddInt64(&se.writeBuffer.flushes, 1)
+	if err != nil {
+		// Non-durable writers have already returned, so the retry is queued here
+		log.Printf("WARN: Coalesced save of %d documents to collection %s failed: %v", len(batch.docs), collName, err)
+		for docID, doc := range batch.docs {
+			se.queueDiskWrite(collName, docID, doc)
+		}
+	}
+	batch.err = err
+	close(batch.done)
+}
+
+// detachWriteBatch removes batch from the write buffer, reporting whether it was still
+// waiting there
+func (se *StorageEngine) detachWriteBatch(collName string, batch *writeBatch) bool {
+	b := &se.writeBuffer
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.batches[collName] != batch {
+		return false
+	}
+	delete(b.batches, collName)
+	return true
+}
+
+// discardWriteBatch drops a collection's buffered saves because a whole-collection
+// save is writing the documents from memory, and releases their writers (caller must
+// hold the collection write lock and its delta lock)
+func (se *StorageEngine) discardWriteBatch(collName string) {
+	b := &se.writeBuffer
+	b.mu.Lock()
+	batch := b.batches[collName]
+	delete(b.batches, collName)
+	b.mu.Unlock()
+
+	if batch != nil {
+		close(batch.done)
+	}
+}
+
+// unbufferDocument drops a document's buffered save, for a delete persisted as a
+// tombstone. A batch already detached is being flushed under the delta lock, which
+// the tombstone waits for.
+func (se *StorageEngine) unbufferDocument(collName, docID string) {
+	b := &se.writeBuffer
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if batch := b.batches[collName]; batch != nil {
+		delete(batch.docs, docID)
+	}
+}
+
+// flushWriteBuffer writes every buffered batch at once, for shutdown
+func (se *StorageEngine) flushWriteBuffer() {
+	b := &se.writeBuffer
+	b.mu.Lock()
+	pending := make(map[string]*writeBatch, len(b.batches))
+	for collName, batch := range b.batches {
+		pending[collName] = batch
+	}
+	b.mu.Unlock()
+
+	for collName, batch := range pending {
+		se.flushWriteBatch(collName, batch)
+	}
+}
+
+// writeBufferStats returns write coalescing statistics
+func (se *StorageEngine) writeBufferStats() map[string]interface{} {
+	b := &se.writeBuffer
+	b.mu.Lock()
+	pending := len(b.batches)
+	b.mu.Unlock()
+	return map[string]interface{}{
+		"window":              b.window.String(),
+		"buffered":            atomic.LoadInt64(&b.buffered),
+		"flushes":             atomic.LoadInt64(&b.flushes),
+		"pending_collections": pending,
+	}
+}
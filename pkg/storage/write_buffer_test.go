@@ -0,0 +1,96 @@
+package storage
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/adfharrison1/go-db/pkg/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// readCollectionFile returns the documents in a collection's file
+func readCollectionFile(t *testing.T, engine *StorageEngine, dataDir, collName string) map[string]interface{} {
+	t.Helper()
+	docs := make(map[string]interface{})
+	filename := filepath.Join(dataDir, "collections", collName+".godb")
+	if _, err := os.Stat(filename); os.IsNotExist(err) {
+		return docs
+	}
+	require.NoError(t, engine.loadCollectionFromFile(filename, docs))
+	return docs
+}
+
+func TestWriteCoalescing(t *testing.T) {
+	tempDir := t.TempDir()
+	engine := NewStorageEngine(WithDataDir(tempDir), WithWriteCoalescing(50*time.Millisecond))
+	defer engine.StopBackgroundWorkers()
+	require.NoError(t, engine.CreateCollection("events"))
+
+	for i := 0; i < 20; i++ {
+		_, err := engine.Insert("events", domain.Document{"n": i})
+		require.NoError(t, err)
+	}
+	_, err := engine.UpdateById("events", "1", domain.Document{"n": 100})
+	require.NoError(t, err)
+
+	// Writes return once buffered and reach the file together when the window ends
+	require.Eventually(t, func() bool {
+		return len(readCollectionFile(t, engine, tempDir, "events")) == 20
+	}, 5*time.Second, 10*time.Millisecond)
+
+	stats := engine.writeBufferStats()
+	assert.Equal(t, int64(21), stats["buffered"])
+	assert.Less(t, stats["flushes"].(int64), int64(21), "saves within a window are written together")
+
+	docs := readCollectionFile(t, engine, tempDir, "events")
+	assert.EqualValues(t, 100, docs["1"].(map[string]interface{})["n"])
+}
+
+func TestWriteCoalescing_Durable(t *testing.T) {
+	tempDir := t.TempDir()
+	engine := NewStorageEngine(WithDataDir(tempDir), WithWriteCoalescing(20*time.Millisecond))
+	defer engine.StopBackgroundWorkers()
+	require.NoError(t, engine.CreateCollection("events"))
+
+	// A durable write returns only once its batch is written
+	doc, err := engine.InsertContext(domain.WithDurableWrite(context.Background()), "events", domain.Document{"kind": "click"})
+	require.NoError(t, err)
+	assert.Contains(t, readCollectionFile(t, engine, tempDir, "events"), doc["_id"])
+}
+
+func TestWriteCoalescing_CollectionSave(t *testing.T) {
+	tempDir := t.TempDir()
+	engine := NewStorageEngine(WithDataDir(tempDir), WithWriteCoalescing(time.Hour))
+	defer engine.StopBackgroundWorkers()
+	require.NoError(t, engine.CreateCollection("events"))
+
+	for i := 0; i < 3; i++ {
+		_, err := engine.Insert("events", domain.Document{"n": i})
+		require.NoError(t, err)
+	}
+
+	// A delete rewrites the collection from memory, taking the buffered saves with it,
+	// so the deleted document is not written back when the window ends
+	require.NoError(t, engine.DeleteById("events", "2"))
+	docs := readCollectionFile(t, engine, tempDir, "events")
+	assert.Len(t, docs, 2)
+	assert.NotContains(t, docs, "2")
+	assert.Equal(t, 0, engine.writeBufferStats()["pending_collections"])
+}
+
+func TestWriteCoalescing_FlushedOnStop(t *testing.T) {
+	tempDir := t.TempDir()
+	engine := NewStorageEngine(WithDataDir(tempDir), WithWriteCoalescing(time.Hour))
+	require.NoError(t, engine.CreateCollection("events"))
+
+	_, err := engine.Insert("events", domain.Document{"kind": "click"})
+	require.NoError(t, err)
+	assert.Empty(t, readCollectionFile(t, engine, tempDir, "events"))
+
+	engine.StopBackgroundWorkers()
+	assert.Len(t, readCollectionFile(t, engine, tempDir, "events"), 1)
+}
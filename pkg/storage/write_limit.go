@@ -0,0 +1,95 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+// WriteLimiter bounds how many write operations run at once on each collection.
+// Writers beyond the limit queue for a slot before taking any lock, so a write storm
+// on one collection waits on a channel instead of piling onto the collection and
+// document locks. A nil limiter imposes no limit.
+type WriteLimiter struct {
+	limit int
+	mu    sync.Mutex
+	slots map[string]*writeSlots
+}
+
+// writeSlots is one collection's semaphore
+type writeSlots struct {
+	sem    chan struct{} // Holds a token per write in flight
+	queued int64         // Writers waiting for a token
+}
+
+// NewWriteLimiter creates a limiter allowing n concurrent writes per collection, or
+// returns nil (unlimited) if n is zero or less
+func NewWriteLimiter(n int) *WriteLimiter {
+	if n <= 0 {
+		return nil
+	}
+	return &WriteLimiter{limit: n, slots: make(map[string]*writeSlots)}
+}
+
+// collectionSlots returns the semaphore of a collection, creating it on first use
+func (l *WriteLimiter) collectionSlots(collName string) *writeSlots {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	slots, exists := l.slots[collName]
+	if !exists {
+		slots = &writeSlots{sem: make(chan struct{}, l.limit)}
+		l.slots[collName] = slots
+	}
+	return slots
+}
+
+// Acquire waits for a write slot on the collection and returns the function that
+// releases it. It fails only if ctx is done before a slot frees up.
+func (l *WriteLimiter) Acquire(ctx context.Context, collName string) (func(), error) {
+	if l == nil {
+		return func() {}, nil
+	}
+
+	slots := l.collectionSlots(collName)
+	select {
+	case slots.sem <- struct{}{}:
+	default:
+		atomic.AddInt64(&slots.queued, 1)
+		select {
+		case slots.sem <- struct{}{}:
+			atomic.AddInt64(&slots.queued, -1)
+		case <-ctx.Done():
+			atomic.AddInt64(&slots.queued, -1)
+			return nil, fmt.Errorf("waiting for a write slot on collection %s: %w", collName, ctx.Err())
+		}
+	}
+
+	var once sync.Once
+	return func() {
+		once.Do(func() { <-slots.sem })
+	}, nil
+}
+
+// Stats returns the per-collection limit and, for each collection with writes in
+// flight or queued, how many. The limit is 0 for a nil (unlimited) limiter.
+func (l *WriteLimiter) Stats() map[string]interface{} {
+	inFlight := make(map[string]int)
+	queued := make(map[string]int64)
+	if l == nil {
+		return map[string]interface{}{"limit": 0, "in_flight": inFlight, "queued": queued}
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for collName, slots := range l.slots {
+		if n := len(slots.sem); n > 0 {
+			inFlight[collName] = n
+		}
+		if n := atomic.LoadInt64(&slots.queued); n > 0 {
+			queued[collName] = n
+		}
+	}
+	return map[string]interface{}{"limit": l.limit, "in_flight": inFlight, "queued": queued}
+}
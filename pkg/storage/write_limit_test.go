@@ -0,0 +1,123 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/adfharrison1/go-db/pkg/domain"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteLimiter(t *testing.T) {
+	t.Run("Nil Is Unlimited", func(t *testing.T) {
+		var limiter *WriteLimiter
+		assert.Nil(t, NewWriteLimiter(0))
+
+		release, err := limiter.Acquire(context.Background(), "users")
+		require.NoError(t, err)
+		release()
+		assert.Equal(t, 0, limiter.Stats()["limit"])
+	})
+
+	t.Run("Queues Beyond Limit", func(t *testing.T) {
+		limiter := NewWriteLimiter(2)
+		first, err := limiter.Acquire(context.Background(), "users")
+		require.NoError(t, err)
+		second, err := limiter.Acquire(context.Background(), "users")
+		require.NoError(t, err)
+
+		// Other collections have their own slots
+		other, err := limiter.Acquire(context.Background(), "orders")
+		require.NoError(t, err)
+		other()
+
+		acquired := make(chan struct{})
+		go func() {
+			release, err := limiter.Acquire(context.Background(), "users")
+			if err == nil {
+				close(acquired)
+				release()
+			}
+		}()
+
+		require.Eventually(t, func() bool {
+			queued := limiter.Stats()["queued"].(map[string]int64)
+			return queued["users"] == 1
+		}, time.Second, time.Millisecond)
+		assert.Equal(t, map[string]int{"users": 2}, limiter.Stats()["in_flight"])
+
+		first()
+		first() // Releasing twice frees only one slot
+		select {
+		case <-acquired:
+		case <-time.After(time.Second):
+			t.Fatal("queued writer did not get the released slot")
+		}
+		second()
+
+		require.Eventually(t, func() bool {
+			return len(limiter.Stats()["in_flight"].(map[string]int)) == 0
+		}, time.Second, time.Millisecond)
+	})
+
+	t.Run("Context Cancelled While Queued", func(t *testing.T) {
+		limiter := NewWriteLimiter(1)
+		release, err := limiter.Acquire(context.Background(), "users")
+		require.NoError(t, err)
+		defer release()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		_, err = limiter.Acquire(ctx, "users")
+		assert.True(t, errors.Is(err, context.DeadlineExceeded), "got %v", err)
+		assert.Empty(t, limiter.Stats()["queued"])
+	})
+}
+
+func TestStorageEngine_MaxConcurrentWrites(t *testing.T) {
+	engine := NewStorageEngine(WithNoSaves(true), WithMaxConcurrentWrites(2))
+	defer engine.StopBackgroundWorkers()
+
+	doc, err := engine.Insert("users", domain.Document{"n": 0})
+	require.NoError(t, err)
+	docID := doc["_id"].(string)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, err := engine.Insert("users", domain.Document{"n": i})
+			assert.NoError(t, err)
+			_, err = engine.UpdateById("users", docID, domain.Document{"n": i})
+			assert.NoError(t, err)
+		}(i)
+	}
+	wg.Wait()
+
+	result, err := engine.FindAll("users", nil, &domain.PaginationOptions{Limit: 100, MaxLimit: 100})
+	require.NoError(t, err)
+	assert.Len(t, result.Documents, 51)
+
+	stats := engine.GetMemoryStats()["concurrent_writes"].(map[string]interface{})
+	assert.Equal(t, 2, stats["limit"])
+	assert.Empty(t, stats["in_flight"])
+
+	t.Run("Capped Eviction Within Slot", func(t *testing.T) {
+		engine := NewStorageEngine(WithNoSaves(true), WithMaxConcurrentWrites(1))
+		defer engine.StopBackgroundWorkers()
+
+		require.NoError(t, engine.SetCollectionCapped("logs", 2, domain.EvictFIFO))
+		for i := 0; i < 5; i++ {
+			_, err := engine.Insert("logs", domain.Document{"n": i})
+			require.NoError(t, err)
+		}
+		collection, err := engine.GetCollection("logs")
+		require.NoError(t, err)
+		assert.Len(t, collection.Documents, 2)
+	})
+}